@@ -0,0 +1,205 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sw-consulting/media-pi.device/internal/agent"
+)
+
+// clientTimeout bounds a single call of a client subcommand to the agent.
+const clientTimeout = 30 * time.Second
+
+// clientCommand maps a client subcommand to the local API call it makes.
+type clientCommand struct {
+	method string
+	path   string
+}
+
+// clientCommands lists the client subcommands by their space-joined words.
+var clientCommands = map[string]clientCommand{
+	"status":         {http.MethodGet, "/api/system/status"},
+	"version":        {http.MethodGet, "/api/system/version"},
+	"sync now":       {http.MethodPost, "/api/menu/video/start-upload"},
+	"sync cancel":    {http.MethodPost, "/api/sync/cancel"},
+	"sync plan":      {http.MethodGet, "/api/sync/plan"},
+	"units list":     {http.MethodGet, "/api/units"},
+	"playback start": {http.MethodPost, "/api/menu/playback/start"},
+	"playback stop":  {http.MethodPost, "/api/menu/playback/stop"},
+}
+
+// isClientCommand reports whether args start with a client subcommand.
+func isClientCommand(args []string) bool {
+	_, _, ok := lookupClientCommand(args)
+	return ok
+}
+
+// lookupClientCommand matches the one or two leading words of args against
+// clientCommands and returns the command with the remaining arguments.
+func lookupClientCommand(args []string) (clientCommand, []string, bool) {
+	if len(args) > 1 {
+		if command, ok := clientCommands[args[0]+" "+args[1]]; ok {
+			return command, args[2:], true
+		}
+	}
+	if len(args) > 0 {
+		if command, ok := clientCommands[args[0]]; ok {
+			return command, args[1:], true
+		}
+	}
+	return clientCommand{}, nil, false
+}
+
+// localAPIBase returns the URL of the agent API on this device. Wildcard
+// listen addresses are reached over the loopback interface.
+func localAPIBase(listenAddr string) string {
+	if listenAddr == "" {
+		listenAddr = agent.DefaultListenAddr
+	}
+	host, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return "http://" + listenAddr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// localAPI calls the API of the agent running on this device.
+type localAPI struct {
+	base string
+	key  string
+}
+
+// apiResult is the APIResponse envelope with the data left undecoded.
+type apiResult struct {
+	OK     bool            `json:"ok"`
+	ErrMsg string          `json:"errmsg"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// newLocalAPI reads the server key and listen address from the config at
+// configPath. A non-empty addr overrides the listen address.
+func newLocalAPI(configPath, addr string) (localAPI, error) {
+	cfg, err := agent.LoadConfigFrom(configPath)
+	if err != nil {
+		return localAPI{}, fmt.Errorf("failed to load config: %w", err)
+	}
+	if addr == "" {
+		addr = localAPIBase(cfg.ListenAddr)
+	}
+	return localAPI{base: strings.TrimRight(addr, "/"), key: cfg.ServerKey}, nil
+}
+
+// call sends body, when not nil, as JSON and decodes the response envelope.
+// It returns an error only when the API could not be reached or answered
+// with something other than an APIResponse.
+func (api localAPI) call(ctx context.Context, method, path string, body any) (apiResult, int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return apiResult{}, 0, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, api.base+path, reader)
+	if err != nil {
+		return apiResult{}, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+api.key)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return apiResult{}, 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result apiResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return apiResult{}, resp.StatusCode, fmt.Errorf("unexpected response (HTTP %d): %w", resp.StatusCode, err)
+	}
+	return result, resp.StatusCode, nil
+}
+
+// clientSyncScope encodes the -scope flag: a JSON list of manifest IDs is
+// passed through, anything else is sent as a scope name.
+func clientSyncScope(scope string) json.RawMessage {
+	if scope = strings.TrimSpace(scope); strings.HasPrefix(scope, "[") {
+		return json.RawMessage(scope)
+	}
+	data, _ := json.Marshal(scope)
+	return data
+}
+
+// runClient implements the client subcommands, for example
+// `media-pi-agent sync now [-scope SCOPE] [-config PATH]`: it calls the
+// local API with the server key from the config, prints the response data
+// as indented JSON to out and returns the process exit code.
+func runClient(args []string, out io.Writer) int {
+	// Keep stdout machine-readable.
+	log.SetOutput(os.Stderr)
+
+	command, rest, ok := lookupClientCommand(args)
+	if !ok {
+		fmt.Fprintf(out, "unknown command: %s\n", strings.Join(args, " "))
+		return 2
+	}
+
+	flags := flag.NewFlagSet(strings.Join(args[:len(args)-len(rest)], " "), flag.ContinueOnError)
+	flags.SetOutput(out)
+	configPath := flags.String("config", defaultConfigPath(), "agent configuration file")
+	addr := flags.String("addr", "", "agent API base URL (default: derived from listen_addr)")
+	scope := flags.String("scope", "", "sync scope for `sync now`: videos, playlist, all or a JSON list of manifest IDs")
+	if err := flags.Parse(rest); err != nil {
+		return 2
+	}
+
+	api, err := newLocalAPI(*configPath, *addr)
+	if err != nil {
+		fmt.Fprintf(out, "%v\n", err)
+		return 2
+	}
+
+	var body any
+	if *scope != "" {
+		body = agent.SyncScopeRequest{Scope: clientSyncScope(*scope)}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+	result, status, err := api.call(ctx, command.method, command.path, body)
+	if err != nil {
+		fmt.Fprintf(out, "%v\n", err)
+		return 1
+	}
+	if len(result.Data) > 0 {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, result.Data, "", "  "); err == nil {
+			indented.WriteByte('\n')
+			_, _ = indented.WriteTo(out)
+		}
+	}
+	if !result.OK {
+		fmt.Fprintf(out, "error (HTTP %d): %s\n", status, result.ErrMsg)
+		return 1
+	}
+	return 0
+}
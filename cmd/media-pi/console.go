@@ -0,0 +1,280 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/sw-consulting/media-pi.device/internal/agent"
+)
+
+// Defaults for `media-pi-agent console`.
+const (
+	defaultConsoleRefresh  = 2 * time.Second
+	defaultConsoleLogLines = 10
+)
+
+// consoleAction is an API call bound to a console key.
+type consoleAction struct {
+	key    byte
+	label  string
+	method string
+	path   string
+}
+
+var consoleActions = []consoleAction{
+	{'s', "sync now", http.MethodPost, "/api/menu/video/start-upload"},
+	{'c', "cancel sync", http.MethodPost, "/api/sync/cancel"},
+	{'p', "start playback", http.MethodPost, "/api/menu/playback/start"},
+	{'o', "stop playback", http.MethodPost, "/api/menu/playback/stop"},
+}
+
+// consoleLogs returns the last lines of the agent journal. Tests may
+// override it.
+var consoleLogs = func(ctx context.Context, lines int) ([]string, error) {
+	output, err := exec.CommandContext(ctx, "journalctl", "-u", "media-pi-agent.service",
+		"-n", fmt.Sprint(lines), "--no-pager", "-o", "short").Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(output), "\n"), "\n"), nil
+}
+
+// consoleState is one screen of the console.
+type consoleState struct {
+	Time     time.Time
+	Units    []agent.UnitInfo
+	Services *agent.ServiceStatusResponse
+	Logs     []string
+	Message  string
+	Errors   []string
+}
+
+// fetchConsoleState collects unit states, sync state and the journal tail.
+func fetchConsoleState(ctx context.Context, api localAPI, logLines int) consoleState {
+	state := consoleState{Time: time.Now()}
+
+	var units []agent.UnitInfo
+	if err := api.get(ctx, "/api/units", &units); err != nil {
+		state.Errors = append(state.Errors, "units: "+err.Error())
+	}
+	slices.SortFunc(units, func(a, b agent.UnitInfo) int { return strings.Compare(a.Unit, b.Unit) })
+	state.Units = units
+
+	var services agent.ServiceStatusResponse
+	if err := api.get(ctx, "/api/menu/service/status", &services); err != nil {
+		state.Errors = append(state.Errors, "service status: "+err.Error())
+	} else {
+		state.Services = &services
+	}
+
+	if logLines > 0 {
+		logs, err := consoleLogs(ctx, logLines)
+		if err != nil {
+			state.Errors = append(state.Errors, "journal: "+err.Error())
+		}
+		state.Logs = logs
+	}
+	return state
+}
+
+// get calls a GET endpoint and decodes its data into v.
+func (api localAPI) get(ctx context.Context, path string, v any) error {
+	result, status, err := api.call(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("HTTP %d: %s", status, result.ErrMsg)
+	}
+	if len(result.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(result.Data, v)
+}
+
+// onOff renders a service flag.
+func onOff(active bool, on, off string) string {
+	if active {
+		return on
+	}
+	return off
+}
+
+// renderConsole draws state to out, clearing the terminal first.
+func renderConsole(out io.Writer, state consoleState) {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "Media Pi agent console  %s\r\n\r\n", state.Time.Format("2006-01-02 15:04:05"))
+
+	if state.Services != nil {
+		fmt.Fprintf(&b, "Playback: %s   Video sync: %s   Playlist sync: %s",
+			onOff(state.Services.PlaybackServiceStatus, "playing", "stopped"),
+			onOff(state.Services.VideoUploadServiceStatus, "running", "idle"),
+			onOff(state.Services.PlaylistUploadServiceStatus, "running", "idle"))
+		if activation := state.Services.PlaylistActivation; activation.State != "" {
+			fmt.Fprintf(&b, "   Playlist activation: %s", activation.State)
+			if activation.Phase != "" {
+				fmt.Fprintf(&b, " (%s)", activation.Phase)
+			}
+		}
+		b.WriteString("\r\n\r\n")
+	}
+
+	b.WriteString("Units:\r\n")
+	if len(state.Units) == 0 {
+		b.WriteString("  (none)\r\n")
+	}
+	for _, unit := range state.Units {
+		if unit.Error != "" {
+			fmt.Fprintf(&b, "  %-32s error: %s\r\n", unit.Unit, unit.Error)
+			continue
+		}
+		fmt.Fprintf(&b, "  %-32s %v/%v\r\n", unit.Unit, unit.Active, unit.Sub)
+	}
+
+	if len(state.Logs) > 0 {
+		b.WriteString("\r\nLog:\r\n")
+		for _, line := range state.Logs {
+			fmt.Fprintf(&b, "  %s\r\n", line)
+		}
+	}
+
+	for _, err := range state.Errors {
+		fmt.Fprintf(&b, "\r\n! %s", err)
+	}
+	if state.Message != "" {
+		fmt.Fprintf(&b, "\r\n> %s", state.Message)
+	}
+
+	b.WriteString("\r\n\r\n")
+	for _, action := range consoleActions {
+		fmt.Fprintf(&b, "[%c] %s  ", action.key, action.label)
+	}
+	b.WriteString("[r] refresh  [q] quit\r\n")
+	_, _ = io.WriteString(out, b.String())
+}
+
+// runConsoleAction performs the action bound to key and returns the
+// message to show, or "" when no action is bound.
+func runConsoleAction(ctx context.Context, api localAPI, key byte) string {
+	for _, action := range consoleActions {
+		if action.key != key {
+			continue
+		}
+		result, status, err := api.call(ctx, action.method, action.path, nil)
+		switch {
+		case err != nil:
+			return fmt.Sprintf("%s: %v", action.label, err)
+		case !result.OK:
+			return fmt.Sprintf("%s: HTTP %d: %s", action.label, status, result.ErrMsg)
+		}
+		return action.label + ": ok"
+	}
+	return ""
+}
+
+// makeRaw switches the terminal on fd to non-canonical mode without echo so
+// single key presses are read immediately. It returns a function restoring
+// the previous mode, or an error when fd is not a terminal.
+func makeRaw(fd uintptr) (func(), error) {
+	var original syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&original))); errno != 0 {
+		return nil, errno
+	}
+	raw := original
+	// Ctrl+C arrives as a key so the terminal mode is always restored.
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&raw))); errno != 0 {
+		return nil, errno
+	}
+	return func() {
+		syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&original)))
+	}, nil
+}
+
+// runConsole implements `media-pi-agent console [-config PATH] [-addr URL]
+// [-refresh 2s] [-log-lines 10]`: a terminal UI for technicians on site
+// showing unit states, sync state and the agent journal, with single-key
+// actions. It returns the process exit code.
+func runConsole(args []string, in *os.File, out io.Writer) int {
+	// Log lines would tear the screen apart.
+	log.SetOutput(io.Discard)
+
+	flags := flag.NewFlagSet("console", flag.ContinueOnError)
+	flags.SetOutput(out)
+	configPath := flags.String("config", defaultConfigPath(), "agent configuration file")
+	addr := flags.String("addr", "", "agent API base URL (default: derived from listen_addr)")
+	refresh := flags.Duration("refresh", defaultConsoleRefresh, "screen refresh interval")
+	logLines := flags.Int("log-lines", defaultConsoleLogLines, "journal lines to show, 0 to hide the log")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *refresh <= 0 {
+		*refresh = defaultConsoleRefresh
+	}
+
+	api, err := newLocalAPI(*configPath, *addr)
+	if err != nil {
+		fmt.Fprintf(out, "%v\n", err)
+		return 2
+	}
+
+	if restore, err := makeRaw(in.Fd()); err == nil {
+		defer restore()
+	}
+
+	keys := make(chan byte)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 1)
+		for {
+			if _, err := in.Read(buf); err != nil {
+				return
+			}
+			keys <- buf[0]
+		}
+	}()
+
+	ticker := time.NewTicker(*refresh)
+	defer ticker.Stop()
+
+	message := ""
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		state := fetchConsoleState(ctx, api, *logLines)
+		cancel()
+		state.Message = message
+		renderConsole(out, state)
+
+		select {
+		case <-ticker.C:
+		case key, ok := <-keys:
+			if !ok || key == 'q' || key == 'Q' || key == 3 {
+				_, _ = io.WriteString(out, "\r\n")
+				return 0
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+			if msg := runConsoleAction(ctx, api, key); msg != "" {
+				message = msg
+			}
+			cancel()
+		}
+	}
+}
@@ -1,18 +1,36 @@
 // Copyright (C) 2025-2026 sw.consulting
 // This file is a part of Media Pi device agent
 
-// Package main implements the media-pi-agent CLI & HTTP service. The
-// binary supports a `setup` command which writes a configuration file and
-// exits, and otherwise runs an HTTP API that controls allowed systemd
-// units. Configuration is read from `/etc/media-pi-agent/agent.yaml` by
-// default; tests can override that path with the `MEDIA_PI_AGENT_CONFIG`
-// environment variable.
+// Command media-pi-agent is the Media Pi device agent. Without a command
+// it runs the HTTP API that controls the allowed systemd units, playback
+// and media sync of the device.
+//
+// Usage:
+//
+//	media-pi-agent [command] [flags]
+//
+// The commands are:
+//
+//   - setup writes a configuration file and exits.
+//   - doctor prints a self-test report.
+//   - install-units writes the managed systemd units.
+//   - helper serves privileged operations to an unprivileged agent.
+//   - config export and config import clone the setup of a device.
+//   - status, sync now and the other client commands call the local API.
+//   - console opens a terminal UI for technicians.
+//
+// The configuration is read from /etc/media-pi-agent/agent.yaml; the
+// MEDIA_PI_AGENT_CONFIG environment variable overrides the path.
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -28,6 +46,8 @@ const (
 	serverReadTimeout  = 15 * time.Second
 	serverWriteTimeout = 15 * time.Second
 	serverIdleTimeout  = 60 * time.Second
+	// serverShutdownTimeout bounds waiting for requests in flight on SIGTERM.
+	serverShutdownTimeout = 5 * time.Second
 )
 
 func isSystemdServiceRun() bool {
@@ -47,9 +67,246 @@ func configureLogging() {
 	log.SetOutput(os.Stdout)
 }
 
+// defaultConfigPath returns the config path; tests and packaging may
+// override it via environment variable so integration tests can run
+// without needing /etc access.
+func defaultConfigPath() string {
+	if configPath := os.Getenv("MEDIA_PI_AGENT_CONFIG"); configPath != "" {
+		return configPath
+	}
+	return agent.RootedPath("/etc/media-pi-agent/agent.yaml")
+}
+
+// runDoctor implements `media-pi-agent doctor [config]`: it runs the self-test,
+// prints the JSON report to out and returns the process exit code.
+func runDoctor(args []string, out io.Writer) int {
+	// Keep stdout machine-readable.
+	log.SetOutput(os.Stderr)
+
+	configPath := defaultConfigPath()
+	if len(args) > 0 {
+		configPath = args[0]
+	}
+	agent.ConfigPath = configPath
+	if _, err := agent.LoadConfigFrom(configPath); err != nil {
+		log.Printf("Failed to load config: %v", err)
+	}
+
+	report := agent.RunSelfTest(context.Background())
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Printf("Failed to write report: %v", err)
+		return 2
+	}
+	if !report.Passed {
+		return 1
+	}
+	return 0
+}
+
+// runInstallUnits implements `media-pi-agent install-units [-dir DIR] [-no-enable]
+// [config]`: it lays down the unit files rendered from templates embedded
+// in the binary.
+func runInstallUnits(args []string) error {
+	flags := flag.NewFlagSet("install-units", flag.ContinueOnError)
+	dir := flags.String("dir", agent.SystemdUnitDir, "directory to write unit files to")
+	noEnable := flags.Bool("no-enable", false, "do not reload systemd and enable the units")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	configPath := defaultConfigPath()
+	if flags.NArg() > 0 {
+		configPath = flags.Arg(0)
+	}
+	cfg, err := agent.LoadConfigFrom(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Helper.Socket != "" {
+		policyPath := agent.RootedPath(agent.DefaultHelperPolicyPath)
+		created, err := agent.InstallHelperPolicy(policyPath, *cfg)
+		if err != nil {
+			return fmt.Errorf("failed to write helper policy: %w", err)
+		}
+		if created {
+			log.Printf("Installed %s", policyPath)
+		}
+	}
+
+	written, err := agent.InstallUnitFiles(context.Background(), *cfg, *dir, !*noEnable)
+	for _, path := range written {
+		log.Printf("Installed %s", path)
+	}
+	return err
+}
+
+// runConfigBundle implements `media-pi-agent config export [-o FILE] [config]`
+// and `media-pi-agent config import FILE [config]`: it writes or applies a
+// signed configuration bundle without going through the running agent.
+func runConfigBundle(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: config export|import")
+	}
+	flags := flag.NewFlagSet("config "+args[0], flag.ContinueOnError)
+	output := flags.String("o", "", "bundle file to write (default: stdout)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	rest := flags.Args()
+
+	switch args[0] {
+	case "export":
+		configPath := defaultConfigPath()
+		if len(rest) > 0 {
+			configPath = rest[0]
+		}
+		cfg, err := agent.LoadConfigFrom(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if *output == "" {
+			return agent.ExportConfigBundle(out, *cfg)
+		}
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		if err := agent.ExportConfigBundle(file, *cfg); err != nil {
+			_ = file.Close()
+			return err
+		}
+		return file.Close()
+	case "import":
+		if len(rest) == 0 {
+			return errors.New("usage: config import FILE [config]")
+		}
+		configPath := defaultConfigPath()
+		if len(rest) > 1 {
+			configPath = rest[1]
+		}
+		if _, err := agent.LoadConfigFrom(configPath); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		agent.ConfigPath = configPath
+		file, err := os.Open(rest[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		manifest, err := agent.ImportConfigBundle(file)
+		if err != nil {
+			return err
+		}
+		log.Printf("Imported configuration of %s created %s; run `systemctl daemon-reload && systemctl reload media-pi-agent` to apply it",
+			manifest.DeviceName, manifest.CreatedAt.Format(time.RFC3339))
+		return nil
+	}
+	return fmt.Errorf("unknown config command %q", args[0])
+}
+
+// runHelper implements `media-pi-agent helper [policy]`: it runs as root and
+// performs systemd control, unit file, crontab and power operations for the
+// agent over its unix socket until SIGINT or SIGTERM. What it does is read
+// from the helper policy, not from agent.yaml, which the agent can change.
+func runHelper(args []string) error {
+	policyPath := agent.RootedPath(agent.DefaultHelperPolicyPath)
+	if len(args) > 0 {
+		policyPath = args[0]
+	}
+	policy, err := agent.LoadHelperPolicy(policyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load helper policy: %w", err)
+	}
+
+	listener, err := agent.ListenHelper(policy.HelperConfig)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	log.Printf("Media Pi helper listening on %s", listener.Addr())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return agent.ServeHelper(ctx, policy, listener)
+}
+
+// startServices restores persisted state and starts the scheduler, playback
+// and the background monitors. It is skipped in safe mode.
+func startServices() {
+	// Restore sync status and manifest cache; corrupt state is recovered
+	// from the previous generation or ignored.
+	agent.LoadPersistedState()
+	agent.ResumeTakeover()
+	agent.RestoreSyncPause()
+	agent.RestoreCalendar()
+	agent.ResumeWebContent()
+
+	// Start sync scheduler
+	log.Println("Starting sync scheduler")
+	if err := agent.StartScheduler(); err != nil {
+		log.Fatalf("Failed to start scheduler: %v", err)
+	}
+	log.Println("Started sync scheduler")
+
+	if err := agent.EnsurePlaybackStateOnStartup(); err != nil {
+		log.Printf("Warning: Failed to ensure playback startup state: %v", err)
+	}
+
+	// Answer mDNS queries for LAN services (peer sharing) enabled in config.
+	if err := agent.StartMDNSResponder(); err != nil {
+		log.Printf("Warning: Failed to start mDNS responder: %v", err)
+	}
+
+	// Remove stale temp files and empty directories left by interrupted syncs.
+	agent.StartCleanupJob()
+
+	// A container has no USB storage, sensors, backlight or power supply
+	// of its own.
+	if agent.InContainer() {
+		log.Println("Running in a container: USB import, presence, brightness and power monitors are disabled")
+	} else {
+		// Watch removable storage for signed media bundles (usb_import.enabled).
+		agent.StartUSBImportWatcher()
+
+		// Pause playback while nobody is around (presence.enabled).
+		if err := agent.StartPresenceMonitor(); err != nil {
+			log.Printf("Warning: Failed to start presence monitor: %v", err)
+		}
+
+		// Follow ambient light or the brightness schedule (brightness.enabled).
+		agent.StartBrightnessControl()
+
+		// Report undervoltage and throttling (unless power.disabled).
+		agent.StartPowerMonitor()
+	}
+
+	// Switch playlist, volume and brightness between day parts (profiles).
+	agent.StartProfiles()
+
+	// Watch the agent itself for leaks (unless resource_watchdog.disabled).
+	agent.StartResourceWatchdog()
+
+	// Count plays for proof-of-play reports (proof_of_play.enabled).
+	agent.StartProofOfPlay()
+
+	// Skip corrupt files before they play (player.verify_next).
+	agent.StartPlaybackVerify()
+
+	// Follow or lead a video wall (sync_play.enabled).
+	if err := agent.StartSyncPlay(); err != nil {
+		log.Printf("Warning: Failed to start synchronized playback: %v", err)
+	}
+}
+
 func main() {
 	configureLogging()
 
+	// MEDIA_PI_AGENT_ROOT moves every path the agent writes under one
+	// prefix, e.g. a volume of a container.
+	agent.SetStateRoot(os.Getenv("MEDIA_PI_AGENT_ROOT"))
+
 	if len(os.Args) > 1 && os.Args[1] == "setup" {
 		configPath := "/etc/media-pi-agent/agent.yaml"
 		if len(os.Args) > 2 {
@@ -61,13 +318,52 @@ func main() {
 		return
 	}
 
-	// Allow tests and packaging to override the config path via environment
-	// variable so integration tests can run without needing /etc access.
-	configPath := os.Getenv("MEDIA_PI_AGENT_CONFIG")
-	if configPath == "" {
-		configPath = "/etc/media-pi-agent/agent.yaml"
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctor(os.Args[2:], os.Stdout))
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "install-units" {
+		if err := runInstallUnits(os.Args[2:]); err != nil {
+			log.Fatalf("Install units failed: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		// Keep stdout for the bundle.
+		log.SetOutput(os.Stderr)
+		if err := runConfigBundle(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Config command failed: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "console" {
+		os.Exit(runConsole(os.Args[2:], os.Stdin, os.Stdout))
+	}
+
+	if isClientCommand(os.Args[1:]) {
+		os.Exit(runClient(os.Args[1:], os.Stdout))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "helper" {
+		if err := runHelper(os.Args[2:]); err != nil {
+			log.Fatalf("Helper failed: %v", err)
+		}
+		return
+	}
+
+	// --simulate (or MEDIA_PI_AGENT_SIMULATE=1) fakes D-Bus, reboot,
+	// crontab and the player, e.g. to run a virtual fleet in Docker.
+	flags := flag.NewFlagSet("media-pi-agent", flag.ExitOnError)
+	simulate := flags.Bool("simulate", os.Getenv("MEDIA_PI_AGENT_SIMULATE") == "1", "replace system interactions with in-memory fakes")
+	_ = flags.Parse(os.Args[1:])
+	if *simulate {
+		agent.EnableSimulation()
+	}
+
+	configPath := defaultConfigPath()
+
 	cfg, err := agent.LoadConfigFrom(configPath)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
@@ -75,49 +371,137 @@ func main() {
 	// Make the loaded config path available to the agent package for reloads
 	agent.ConfigPath = configPath
 
-	// Start sync scheduler
-	log.Println("Starting sync scheduler")
-	if err := agent.StartScheduler(); err != nil {
-		log.Fatalf("Failed to start scheduler: %v", err)
-	}
-	log.Println("Started sync scheduler")
+	// Earlier versions kept state in the media directory, where sync
+	// garbage collection could remove it.
+	agent.MigrateLegacyState()
 
-	if err := agent.EnsurePlaybackStateOnStartup(); err != nil {
-		log.Printf("Warning: Failed to ensure playback startup state: %v", err)
+	// Record supported features for /health before serving requests.
+	agent.DetectCapabilities()
+
+	// Report a crash of the previous run and record one of this run
+	// (unless crash_report.disabled).
+	agent.BeginCrashCapture()
+
+	// Bring up the management VPN (wireguard.enabled) before the listener
+	// may be bound to it; it is kept in safe mode too.
+	if !agent.InContainer() {
+		agent.StartWireGuard()
 	}
 
-	// Set callback to restart play.video service after scheduled playlist syncs
-	agent.SetScheduledSyncCallback(func() error {
-		return agent.RestartVideoPlayServiceWithLogs("scheduled playlist sync")
-	})
+	// After repeated failed startups only health, system and configuration
+	// endpoints are served, so the device stays remotely repairable.
+	if agent.BeginStartup() {
+		log.Println("Safe mode: background services are not started")
+	} else {
+		startServices()
+		agent.StartStartupWatch()
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", agent.HandleHealth)
+	mux.HandleFunc("/health/live", agent.HandleHealthLive)
+	mux.HandleFunc("/health/ready", agent.HandleHealthReady)
+	mux.HandleFunc("/metrics", agent.AuthMiddleware(agent.HandleMetrics))
+	// pprof and expvar, served only while debug.enabled or unlocked
+	mux.HandleFunc("/debug/", agent.AuthMiddleware(agent.HandleDebug))
+	// LAN peers fetch verified media by SHA256; unauthenticated by design
+	mux.HandleFunc("/peer/content/", agent.HandlePeerContent)
 	// internal authenticated reload endpoint - used by setup scripts or ExecReload
 	mux.HandleFunc("/internal/reload", agent.AuthMiddleware(agent.HandleReload))
-	mux.HandleFunc("/api/units", agent.AuthMiddleware(agent.HandleListUnits))
+	mux.HandleFunc("/api/units", agent.AuthMiddleware(agent.CachedResponse(agent.HandleListUnits)))
 	mux.HandleFunc("/api/units/status", agent.AuthMiddleware(agent.HandleUnitStatus))
+	mux.HandleFunc("/api/units/timer", agent.AuthMiddleware(agent.HandleTimerStatus))
 	mux.HandleFunc("/api/units/start", agent.AuthMiddleware(agent.HandleUnitAction("start")))
 	mux.HandleFunc("/api/units/stop", agent.AuthMiddleware(agent.HandleUnitAction("stop")))
 	mux.HandleFunc("/api/units/restart", agent.AuthMiddleware(agent.HandleUnitAction("restart")))
 	mux.HandleFunc("/api/units/enable", agent.AuthMiddleware(agent.HandleUnitAction("enable")))
 	mux.HandleFunc("/api/units/disable", agent.AuthMiddleware(agent.HandleUnitAction("disable")))
+	mux.HandleFunc("/api/units/mask", agent.AuthMiddleware(agent.HandleUnitAction("mask")))
+	mux.HandleFunc("/api/units/unmask", agent.AuthMiddleware(agent.HandleUnitAction("unmask")))
+	mux.HandleFunc("/api/units/orchestrations", agent.AuthMiddleware(agent.HandleOrchestrations))
+	mux.HandleFunc("/api/units/orchestrate", agent.AuthMiddleware(agent.HandleOrchestrate))
 
 	// Menu endpoints
 	mux.HandleFunc("/api/menu", agent.AuthMiddleware(agent.HandleMenuList))
 	mux.HandleFunc("/api/menu/playback/stop", agent.AuthMiddleware(agent.HandlePlaybackStop))
 	mux.HandleFunc("/api/menu/playback/start", agent.AuthMiddleware(agent.HandlePlaybackStart))
-	mux.HandleFunc("/api/menu/service/status", agent.AuthMiddleware(agent.HandleServiceStatus))
+	mux.HandleFunc("/api/menu/service/status", agent.AuthMiddleware(agent.CachedResponse(agent.HandleServiceStatus)))
 	mux.HandleFunc("/api/menu/configuration/get", agent.AuthMiddleware(agent.HandleConfigurationGet))
 	mux.HandleFunc("/api/menu/configuration/update", agent.AuthMiddleware(agent.HandleConfigurationUpdate))
+	mux.HandleFunc("/api/configuration/effective", agent.AuthMiddleware(agent.HandleEffectiveConfiguration))
+	mux.HandleFunc("/api/configuration/export", agent.AuthMiddleware(agent.HandleConfigurationExport))
+	mux.HandleFunc("/api/configuration/import", agent.AuthMiddleware(agent.HandleConfigurationImport))
+	mux.HandleFunc("/api/menu/schedule/next", agent.AuthMiddleware(agent.HandleScheduleNext))
+	mux.HandleFunc("/api/menu/schedule/pause", agent.AuthMiddleware(agent.HandleSchedulePause))
+	mux.HandleFunc("/api/menu/schedule/resume", agent.AuthMiddleware(agent.HandleScheduleResume))
 	mux.HandleFunc("/api/menu/playlist/start-upload", agent.AuthMiddleware(agent.HandlePlaylistStartUpload))
 	mux.HandleFunc("/api/menu/playlist/stop-upload", agent.AuthMiddleware(agent.HandlePlaylistStopUpload))
 	mux.HandleFunc("/api/menu/video/start-upload", agent.AuthMiddleware(agent.HandleVideoStartUpload))
 	mux.HandleFunc("/api/menu/video/stop-upload", agent.AuthMiddleware(agent.HandleVideoStopUpload))
 	mux.HandleFunc("/api/menu/screenshot/take", agent.AuthMiddleware(agent.HandleTakeScreenshot))
+	mux.HandleFunc("/api/menu/display", agent.AuthMiddleware(agent.HandleDisplayList))
+	mux.HandleFunc("/api/menu/display/outputs", agent.AuthMiddleware(agent.HandleDisplayOutputsUpdate))
+	mux.HandleFunc("/api/menu/display/config", agent.AuthMiddleware(agent.HandleDisplayConfig))
+	mux.HandleFunc("/api/menu/display/start", agent.AuthMiddleware(agent.HandleDisplayPlayback("start")))
+	mux.HandleFunc("/api/menu/display/stop", agent.AuthMiddleware(agent.HandleDisplayPlayback("stop")))
 	mux.HandleFunc("/api/menu/system/reload", agent.AuthMiddleware(agent.HandleSystemReload))
 	mux.HandleFunc("/api/menu/system/reboot", agent.AuthMiddleware(agent.HandleSystemReboot))
 	mux.HandleFunc("/api/menu/system/shutdown", agent.AuthMiddleware(agent.HandleSystemShutdown))
+	mux.HandleFunc("/api/playback/takeover", agent.AuthMiddleware(agent.HandleTakeover))
+	mux.HandleFunc("/api/profiles", agent.AuthMiddleware(agent.HandleProfiles))
+	mux.HandleFunc("/api/profiles/activate", agent.AuthMiddleware(agent.HandleProfileActivate))
+	mux.HandleFunc("/api/playback/web", agent.AuthMiddleware(agent.HandleWebContent))
+	mux.HandleFunc("/api/playback/web/cache", agent.AuthMiddleware(agent.HandleWebCache))
+	mux.HandleFunc("/api/playback/sync", agent.AuthMiddleware(agent.HandleSyncPlayStatus))
+	mux.HandleFunc("/api/calendar", agent.AuthMiddleware(agent.HandleCalendar))
+	mux.HandleFunc("/api/audio/playback", agent.AuthMiddleware(agent.HandleAudioPlayback))
+	mux.HandleFunc("/api/audio/playback/start", agent.AuthMiddleware(agent.HandleAudioPlaybackStart))
+	mux.HandleFunc("/api/audio/playback/stop", agent.AuthMiddleware(agent.HandleAudioPlaybackStop))
+	mux.HandleFunc("/api/audio/playback/volume", agent.AuthMiddleware(agent.HandleAudioPlaybackVolume))
+	mux.HandleFunc("/api/playback/overlay", agent.AuthMiddleware(agent.HandleOverlay))
+	mux.HandleFunc("/api/playback/stats", agent.AuthMiddleware(agent.HandlePlaybackStats))
+	mux.HandleFunc("/api/system/status", agent.AuthMiddleware(agent.CachedResponse(agent.HandleSystemStatus)))
+	mux.HandleFunc("/api/system/version", agent.AuthMiddleware(agent.HandleSystemVersion))
+	mux.HandleFunc("/api/system/safe-mode", agent.AuthMiddleware(agent.HandleSafeMode))
+	mux.HandleFunc("/api/system/safe-mode/exit", agent.AuthMiddleware(agent.HandleSafeModeExit))
+	mux.HandleFunc("/api/system/debug", agent.AuthMiddleware(agent.HandleDebugStatus))
+	mux.HandleFunc("/api/system/debug/unlock", agent.AuthMiddleware(agent.HandleDebugUnlock))
+	mux.HandleFunc("/api/system/exec", agent.AuthMiddleware(agent.HandleExec))
+	mux.HandleFunc("/api/system/jobs", agent.AuthMiddleware(agent.HandleJobs))
+	mux.HandleFunc("/api/system/tunnel", agent.AuthMiddleware(agent.HandleTunnelStatus))
+	mux.HandleFunc("/api/system/tunnel/start", agent.AuthMiddleware(agent.HandleTunnelStart))
+	mux.HandleFunc("/api/system/tunnel/stop", agent.AuthMiddleware(agent.HandleTunnelStop))
+	mux.HandleFunc("/api/system/selftest", agent.AuthMiddleware(agent.HandleSelfTest))
+	mux.HandleFunc("/api/system/presence", agent.AuthMiddleware(agent.HandlePresenceStatus))
+	mux.HandleFunc("/api/system/identity", agent.AuthMiddleware(agent.HandleSystemIdentity))
+
+	// Offline media import and garbage collection trash
+	mux.HandleFunc("/api/media/import", agent.AuthMiddleware(agent.HandleMediaImport))
+	mux.HandleFunc("/api/media/trash", agent.AuthMiddleware(agent.HandleTrashList))
+	mux.HandleFunc("/api/media/trash/restore", agent.AuthMiddleware(agent.HandleTrashRestore))
+	mux.HandleFunc("/api/media/files", agent.AuthMiddleware(agent.HandleMediaFiles))
+	mux.HandleFunc("/api/media/files/download", agent.AuthMiddleware(agent.HandleMediaFileDownload))
+	mux.HandleFunc("/api/media/thumbnails/{id}", agent.AuthMiddleware(agent.HandleMediaThumbnail))
+	mux.HandleFunc("/api/sync/cancel", agent.AuthMiddleware(agent.HandleSyncCancel))
+	mux.HandleFunc("/api/sync/events", agent.AuthMiddleware(agent.HandleSyncEvents))
+	mux.HandleFunc("/api/sync/plan", agent.AuthMiddleware(agent.HandleSyncPlan))
+	mux.HandleFunc("/api/sync/deletion", agent.AuthMiddleware(agent.HandleDeletionGuard))
+	mux.HandleFunc("/api/sync/deletion/confirm", agent.AuthMiddleware(agent.HandleDeletionConfirm))
+	mux.HandleFunc("/api/sync/report", agent.AuthMiddleware(agent.HandleSyncReport))
+	mux.HandleFunc("/api/sync/quarantine", agent.AuthMiddleware(agent.HandleSyncQuarantine))
+	mux.HandleFunc("/api/sync/quarantine/release", agent.AuthMiddleware(agent.HandleSyncQuarantineRelease))
+
+	// Media storage management
+	mux.HandleFunc("/api/storage", agent.AuthMiddleware(agent.HandleStorageStatus))
+	mux.HandleFunc("/api/storage/mount", agent.AuthMiddleware(agent.HandleStorageMount))
+	mux.HandleFunc("/api/storage/migrate", agent.AuthMiddleware(agent.HandleStorageMigrate))
+	mux.HandleFunc("/api/storage/migrate/status", agent.AuthMiddleware(agent.HandleStorageMigrateStatus))
+	mux.HandleFunc("/api/storage/network", agent.AuthMiddleware(agent.HandleNetworkMounts))
+	mux.HandleFunc("/api/storage/network/mount", agent.AuthMiddleware(agent.HandleNetworkMountAction("mount")))
+	mux.HandleFunc("/api/storage/network/unmount", agent.AuthMiddleware(agent.HandleNetworkMountAction("unmount")))
+
+	// /api/v2/ serves every route above with the v2 response envelope.
+	mux.Handle("/api/v2/", agent.APIv2Handler(mux))
 
 	listenAddr := cfg.ListenAddr
 	if listenAddr == "" {
@@ -125,33 +509,63 @@ func main() {
 	}
 	server := &http.Server{
 		Addr:         listenAddr,
-		Handler:      mux,
+		Handler:      agent.ClientFilterMiddleware(agent.LocaleMiddleware(agent.SafeModeMiddleware(mux))),
 		ReadTimeout:  serverReadTimeout,
 		WriteTimeout: serverWriteTimeout,
 		IdleTimeout:  serverIdleTimeout,
 	}
 
 	log.Printf("Starting Media Pi Agent service on %s", listenAddr)
-	listener, err := net.Listen("tcp", listenAddr)
+	listener, err := agent.ListenAPI(context.Background(), *cfg)
 	if err != nil {
 		log.Fatalf("Failed to start Media Pi Agent service on %s: %v", listenAddr, err)
 	}
 	log.Printf("Started Media Pi Agent service on %s", listenAddr)
 
 	// Handle SIGHUP to reload configuration without restarting the process.
+	// SIGUSR1 (sent by video.upload.service) starts a video sync. SIGTERM
+	// and SIGINT shut the server down cleanly, which is not reported as a
+	// crash on the next start.
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGHUP)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGTERM, syscall.SIGINT)
+	shutdownDone := make(chan struct{})
 	go func() {
-		for range sigs {
-			log.Printf("Received SIGHUP, reloading configuration")
-			if err := agent.ReloadConfig(); err != nil {
-				log.Printf("Failed to reload configuration: %v", err)
-			} else {
-				log.Printf("Reloaded configuration")
+		for sig := range sigs {
+			switch sig {
+			case syscall.SIGUSR1:
+				if agent.IsSafeMode() {
+					log.Printf("Received SIGUSR1, ignored in safe mode")
+					continue
+				}
+				log.Printf("Received SIGUSR1, starting video sync")
+				if err := agent.TriggerSync(nil); err != nil {
+					log.Printf("Failed to trigger video sync: %v", err)
+				}
+			case syscall.SIGTERM, syscall.SIGINT:
+				log.Printf("Received %v, shutting down", sig)
+				agent.EndStartup()
+				agent.EndCrashCapture()
+				ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+				if err := server.Shutdown(ctx); err != nil {
+					log.Printf("Failed to shut down cleanly: %v", err)
+				}
+				cancel()
+				close(shutdownDone)
+				return
+			default:
+				log.Printf("Received SIGHUP, reloading configuration")
+				if err := agent.ReloadConfig(); err != nil {
+					log.Printf("Failed to reload configuration: %v", err)
+				} else {
+					log.Printf("Reloaded configuration")
+				}
 			}
 		}
 	}()
-	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		log.Fatalf("Media Pi Agent service failed: %v", err)
+	if err := server.Serve(listener); err != nil {
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Media Pi Agent service failed: %v", err)
+		}
+		<-shutdownDone
 	}
 }
@@ -5,12 +5,15 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/sw-consulting/media-pi.device/internal/agent"
@@ -287,3 +290,163 @@ func TestConfigureLoggingOutput(t *testing.T) {
 		}
 	})
 }
+
+func TestRunDoctorReportsFailure(t *testing.T) {
+	t.Setenv("MEDIA_PI_AGENT_MOCK_DBUS", "1")
+	origOutput := log.Writer()
+	defer log.SetOutput(origOutput)
+
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer core.Close()
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "agent.yaml")
+	yamlData := "server_key: doctor-key\ncore_api_base: " + core.URL + "\nplaylist:\n  destination: " + tmpDir + "\n"
+	if err := os.WriteFile(configPath, []byte(yamlData), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var out bytes.Buffer
+	code := runDoctor([]string{configPath}, &out)
+	if code != 1 {
+		t.Fatalf("expected exit code 1, got %d\n%s", code, out.String())
+	}
+
+	var report agent.SelfTestReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("doctor output is not JSON: %v\n%s", err, out.String())
+	}
+	if report.Passed {
+		t.Fatalf("expected failing report: %+v", report)
+	}
+	for _, check := range report.Checks {
+		if check.OK == (check.Name == "core") {
+			t.Errorf("unexpected check result: %+v", check)
+		}
+	}
+}
+
+func TestLocalAPIBase(t *testing.T) {
+	cases := map[string]string{
+		"":                 "http://127.0.0.1:8081",
+		"0.0.0.0:8081":     "http://127.0.0.1:8081",
+		"[::]:9000":        "http://127.0.0.1:9000",
+		":9000":            "http://127.0.0.1:9000",
+		"192.168.1.5:8081": "http://192.168.1.5:8081",
+	}
+	for listenAddr, want := range cases {
+		if got := localAPIBase(listenAddr); got != want {
+			t.Errorf("localAPIBase(%q) = %q, want %q", listenAddr, got, want)
+		}
+	}
+}
+
+func TestRunClient(t *testing.T) {
+	origOutput := log.Writer()
+	defer log.SetOutput(origOutput)
+
+	var gotMethod, gotPath, gotAuth, gotBody string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotAuth = r.Method, r.URL.Path, r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		if r.URL.Path == "/api/menu/playback/stop" {
+			agent.JSONResponse(w, http.StatusInternalServerError, agent.APIResponse{OK: false, ErrMsg: "boom"})
+			return
+		}
+		agent.JSONResponse(w, http.StatusOK, agent.APIResponse{OK: true, Data: map[string]string{"version": "v1"}})
+	}))
+	defer api.Close()
+
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	if err := os.WriteFile(configPath, []byte("server_key: client-key\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	var out bytes.Buffer
+	if code := runClient([]string{"status", "-config", configPath, "-addr", api.URL}, &out); code != 0 {
+		t.Fatalf("status exit code %d\n%s", code, out.String())
+	}
+	if gotMethod != http.MethodGet || gotPath != "/api/system/status" || gotAuth != "Bearer client-key" {
+		t.Fatalf("unexpected request %s %s %q", gotMethod, gotPath, gotAuth)
+	}
+	if !strings.Contains(out.String(), `"version": "v1"`) {
+		t.Fatalf("unexpected output: %s", out.String())
+	}
+
+	out.Reset()
+	if code := runClient([]string{"sync", "now", "-config", configPath, "-addr", api.URL, "-scope", "[3,4]"}, &out); code != 0 {
+		t.Fatalf("sync now exit code %d\n%s", code, out.String())
+	}
+	if gotMethod != http.MethodPost || gotPath != "/api/menu/video/start-upload" || gotBody != `{"scope":[3,4]}` {
+		t.Fatalf("unexpected request %s %s %s", gotMethod, gotPath, gotBody)
+	}
+
+	out.Reset()
+	if code := runClient([]string{"playback", "stop", "-config", configPath, "-addr", api.URL}, &out); code != 1 {
+		t.Fatalf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(out.String(), "boom") {
+		t.Fatalf("error message missing: %s", out.String())
+	}
+
+	if isClientCommand([]string{"units"}) || !isClientCommand([]string{"units", "list"}) {
+		t.Fatal("unexpected client command matching")
+	}
+}
+
+func TestRunConsole(t *testing.T) {
+	origOutput := log.Writer()
+	defer log.SetOutput(origOutput)
+	origLogs := consoleLogs
+	defer func() { consoleLogs = origLogs }()
+	consoleLogs = func(context.Context, int) ([]string, error) {
+		return []string{"agent started"}, nil
+	}
+
+	var actions []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/units":
+			agent.JSONResponse(w, http.StatusOK, agent.APIResponse{OK: true, Data: []agent.UnitInfo{{Unit: "play.video.service", Active: "active", Sub: "running"}}})
+		case "/api/menu/service/status":
+			agent.JSONResponse(w, http.StatusOK, agent.APIResponse{OK: true, Data: agent.ServiceStatusResponse{VideoUploadServiceStatus: true}})
+		default:
+			actions = append(actions, r.Method+" "+r.URL.Path)
+			agent.JSONResponse(w, http.StatusOK, agent.APIResponse{OK: true})
+		}
+	}))
+	defer api.Close()
+
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	if err := os.WriteFile(configPath, []byte("server_key: console-key\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	in, err := os.CreateTemp(t.TempDir(), "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.WriteString("sq"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	var out bytes.Buffer
+	if code := runConsole([]string{"-config", configPath, "-addr", api.URL, "-refresh", "1h"}, in, &out); code != 0 {
+		t.Fatalf("exit code %d\n%s", code, out.String())
+	}
+	if len(actions) != 1 || actions[0] != "POST /api/menu/video/start-upload" {
+		t.Fatalf("unexpected actions: %v", actions)
+	}
+	screen := out.String()
+	for _, want := range []string{"play.video.service", "active/running", "Video sync: running", "agent started", "> sync now: ok"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("screen is missing %q:\n%s", want, screen)
+		}
+	}
+}
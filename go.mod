@@ -4,8 +4,12 @@ go 1.25.1
 
 require (
 	github.com/coreos/go-systemd/v22 v22.6.0
+	github.com/godbus/dbus/v5 v5.1.0
+	github.com/klauspost/compress v1.18.0
 	github.com/robfig/cron/v3 v3.0.1
+	golang.org/x/net v0.44.0
 	gopkg.in/yaml.v3 v3.0.1
+	lukechampine.com/blake3 v1.4.1
 )
 
-require github.com/godbus/dbus/v5 v5.1.0 // indirect
+require github.com/klauspost/cpuid/v2 v2.0.9 // indirect
@@ -36,6 +36,9 @@ type RestTimePairConfig struct {
 type PlaylistConfig struct {
 	Source      string `yaml:"source,omitempty" json:"source,omitempty"`
 	Destination string `yaml:"destination,omitempty" json:"destination,omitempty"`
+	// Variables add to or override the {NAME} placeholders expanded in
+	// downloaded playlists; see playlistVariables.
+	Variables map[string]string `yaml:"variables,omitempty" json:"variables,omitempty"`
 }
 
 // ScheduleConfig represents schedule times for playlist/video uploads and rest periods.
@@ -47,7 +50,8 @@ type ScheduleConfig struct {
 
 // AudioConfig describes the audio output setting.
 type AudioConfig struct {
-	Output string `yaml:"output,omitempty" json:"output,omitempty"`
+	Output   string              `yaml:"output,omitempty" json:"output,omitempty"`
+	Playback AudioPlaybackConfig `yaml:"playback,omitempty" json:"playback,omitempty"`
 }
 
 // ScreenshotConfig describes playlist-relative screenshot capture settings.
@@ -58,21 +62,116 @@ type ScreenshotConfig struct {
 	ResendLimit  int      `yaml:"resend_limit,omitempty" json:"resend_limit,omitempty"`
 }
 
+// SyncConfig describes optional media synchronization behavior.
+type SyncConfig struct {
+	// Source selects where the manifest and files come from; see
+	// SyncSourceCore.
+	Source           string           `yaml:"source,omitempty"`
+	S3               S3SourceConfig   `yaml:"s3,omitempty"`
+	SFTP             SFTPSourceConfig `yaml:"sftp,omitempty"`
+	ContentStore     bool             `yaml:"content_store,omitempty"`
+	TempMaxAge       time.Duration    `yaml:"temp_max_age,omitempty"`
+	CleanupInterval  time.Duration    `yaml:"cleanup_interval,omitempty"`
+	TrashRetention   time.Duration    `yaml:"trash_retention,omitempty"`
+	ManifestPageSize int              `yaml:"manifest_page_size,omitempty"`
+	Tags             []string         `yaml:"tags,omitempty"`
+	// ThermalLimit pauses hashing and downloads while the SoC is hotter
+	// than this many degrees Celsius; 0 disables the check.
+	ThermalLimit         float64       `yaml:"thermal_limit,omitempty"`
+	ThermalResume        float64       `yaml:"thermal_resume,omitempty"`
+	ThermalCheckInterval time.Duration `yaml:"thermal_check_interval,omitempty"`
+	// MaxDeletePercent holds back garbage collection that would remove a
+	// larger share of media files; see DefaultMaxDeletePercent.
+	MaxDeletePercent int `yaml:"max_delete_percent,omitempty"`
+	// VerifyWorkers limits how many local files are hashed in parallel; see
+	// verifyWorkers. VerifyMmap hashes them through mmap.
+	VerifyWorkers int  `yaml:"verify_workers,omitempty"`
+	VerifyMmap    bool `yaml:"verify_mmap,omitempty"`
+	// FullVerifyInterval is how long a file that kept its size and
+	// modification time is trusted without hashing; see
+	// DefaultFullVerifyInterval.
+	FullVerifyInterval time.Duration `yaml:"full_verify_interval,omitempty"`
+	// QuarantineAfter is how many verification failures in a row make sync
+	// skip an item; see DefaultQuarantineAfter.
+	QuarantineAfter int `yaml:"quarantine_after,omitempty"`
+	// ReportDisabled stops posting the result of each sync to the core;
+	// see SyncReport.
+	ReportDisabled bool `yaml:"report_disabled,omitempty"`
+	// ScheduleJitter bounds the per-device offset of scheduled syncs; see
+	// DefaultScheduleJitter. A negative value disables it.
+	ScheduleJitter time.Duration `yaml:"schedule_jitter,omitempty"`
+	// PlaybackDuringSync pauses or lowers playback while a sync downloads
+	// more than LargeSyncBytes on a constrained device; see
+	// PlaybackDuringSyncPause and PlaybackDuringSyncLower.
+	PlaybackDuringSync string `yaml:"playback_during_sync,omitempty"`
+	LargeSyncBytes     int64  `yaml:"large_sync_bytes,omitempty"`
+	// Nice and IOPriority lower the priority of hashing and downloads; see
+	// DefaultSyncNice and SyncIOPriorityLow; they apply per thread.
+	// Cgroup runs the whole agent, not only sync, in a slice with limits.
+	Nice       *int             `yaml:"nice,omitempty"`
+	IOPriority string           `yaml:"io_priority,omitempty"`
+	Cgroup     SyncCgroupConfig `yaml:"cgroup,omitempty"`
+	// Thumbnails grabs a preview frame of each synced video; see
+	// HandleMediaThumbnail.
+	Thumbnails SyncThumbnailConfig `yaml:"thumbnails,omitempty"`
+}
+
 // Config represents the agent configuration file structure. It is loaded
 // from YAML and contains the list of allowed systemd units, the server
 // authentication key and the listen address for the HTTP API, as well as
 // all configuration settings that were previously stored only in systemd unit files.
 type Config struct {
-	AllowedUnits         []string         `yaml:"allowed_units"`
-	ServerKey            string           `yaml:"server_key,omitempty"`
-	ListenAddr           string           `yaml:"listen_addr,omitempty"`
-	MediaPiServiceUser   string           `yaml:"media_pi_service_user,omitempty"`
-	CoreAPIBase          string           `yaml:"core_api_base,omitempty"`
-	MaxParallelDownloads int              `yaml:"max_parallel_downloads,omitempty"`
-	Playlist             PlaylistConfig   `yaml:"playlist,omitempty"`
-	Schedule             ScheduleConfig   `yaml:"schedule,omitempty"`
-	Audio                AudioConfig      `yaml:"audio,omitempty"`
-	Screenshot           ScreenshotConfig `yaml:"screenshot,omitempty"`
+	AllowedUnits         []string               `yaml:"allowed_units"`
+	ServerKey            string                 `yaml:"server_key,omitempty"`
+	EncryptSecrets       bool                   `yaml:"encrypt_secrets,omitempty"`
+	DeviceName           string                 `yaml:"device_name,omitempty"`
+	Labels               map[string]string      `yaml:"labels,omitempty"`
+	Locale               string                 `yaml:"locale,omitempty"`
+	ListenAddr           string                 `yaml:"listen_addr,omitempty"`
+	ListenInterface      string                 `yaml:"listen_interface,omitempty"`
+	AllowedClients       []string               `yaml:"allowed_clients,omitempty"`
+	MediaPiServiceUser   string                 `yaml:"media_pi_service_user,omitempty"`
+	CoreAPIBase          string                 `yaml:"core_api_base,omitempty"`
+	MaxParallelDownloads int                    `yaml:"max_parallel_downloads,omitempty"`
+	Playlist             PlaylistConfig         `yaml:"playlist,omitempty"`
+	Schedule             ScheduleConfig         `yaml:"schedule,omitempty"`
+	Audio                AudioConfig            `yaml:"audio,omitempty"`
+	Screenshot           ScreenshotConfig       `yaml:"screenshot,omitempty"`
+	HTTPClient           HTTPClientConfig       `yaml:"http_client,omitempty"`
+	Timeouts             TimeoutsConfig         `yaml:"timeouts,omitempty"`
+	Sync                 SyncConfig             `yaml:"sync,omitempty"`
+	Peer                 PeerConfig             `yaml:"peer,omitempty"`
+	Discovery            DiscoveryConfig        `yaml:"discovery,omitempty"`
+	USBImport            USBImportConfig        `yaml:"usb_import,omitempty"`
+	Storage              StorageConfig          `yaml:"storage,omitempty"`
+	Metrics              MetricsConfig          `yaml:"metrics,omitempty"`
+	Health               HealthConfig           `yaml:"health,omitempty"`
+	Clock                ClockConfig            `yaml:"clock,omitempty"`
+	Player               PlayerConfig           `yaml:"player,omitempty"`
+	Web                  WebContentConfig       `yaml:"web,omitempty"`
+	ProofOfPlay          ProofOfPlayConfig      `yaml:"proof_of_play,omitempty"`
+	Presence             PresenceConfig         `yaml:"presence,omitempty"`
+	Brightness           BrightnessConfig       `yaml:"brightness,omitempty"`
+	Power                PowerConfig            `yaml:"power,omitempty"`
+	SyncPlay             SyncPlayConfig         `yaml:"sync_play,omitempty"`
+	Displays             []DisplayOutputConfig  `yaml:"displays,omitempty"`
+	Helper               HelperConfig           `yaml:"helper,omitempty"`
+	ConfigBundle         ConfigBundleConfig     `yaml:"config_bundle,omitempty"`
+	SafeMode             SafeModeConfig         `yaml:"safe_mode,omitempty"`
+	CrashReport          CrashReportConfig      `yaml:"crash_report,omitempty"`
+	Debug                DebugConfig            `yaml:"debug,omitempty"`
+	ResourceWatchdog     ResourceWatchdogConfig `yaml:"resource_watchdog,omitempty"`
+	Upload               UploadConfig           `yaml:"upload,omitempty"`
+	Exec                 ExecConfig             `yaml:"exec,omitempty"`
+	Tunnel               TunnelConfig           `yaml:"tunnel,omitempty"`
+	WireGuard            WireGuardConfig        `yaml:"wireguard,omitempty"`
+	RequestSigning       RequestSigningConfig   `yaml:"request_signing,omitempty"`
+	Profiles             []ProfileConfig        `yaml:"profiles,omitempty"`
+	StatusCache          StatusCacheConfig      `yaml:"status_cache,omitempty"`
+	Orchestrations       []OrchestrationConfig  `yaml:"orchestrations,omitempty"`
+	// Revision grows with every save through the API; configuration
+	// updates must echo the revision they were based on.
+	Revision int64 `yaml:"revision,omitempty"`
 }
 
 // APIResponse is the standard envelope used by HTTP handlers to return
@@ -90,19 +189,38 @@ type UnitInfo struct {
 	Unit   string      `json:"unit"`
 	Active interface{} `json:"active,omitempty"`
 	Sub    interface{} `json:"sub,omitempty"`
-	Error  string      `json:"error,omitempty"`
+	// UnitFileState is enabled, disabled, masked, static and so on;
+	// Preset is the vendor preset, enabled or disabled.
+	UnitFileState interface{} `json:"unitFileState,omitempty"`
+	Preset        interface{} `json:"preset,omitempty"`
+	Error         string      `json:"error,omitempty"`
+}
+
+// unitInfo builds the UnitInfo of unit from its D-Bus properties.
+func unitInfo(unit string, props map[string]any) UnitInfo {
+	return UnitInfo{
+		Unit:          unit,
+		Active:        props["ActiveState"],
+		Sub:           props["SubState"],
+		UnitFileState: props["UnitFileState"],
+		Preset:        props["UnitFilePreset"],
+	}
 }
 
 // UnitActionRequest is the JSON body used for unit control actions such as
 // start/stop/restart.
 type UnitActionRequest struct {
 	Unit string `json:"unit"`
+	// Wait makes start, stop and restart also wait for the unit to settle
+	// and report its final ActiveState.
+	Wait bool `json:"wait,omitempty"`
 }
 
 // UnitActionResponse is returned after performing a unit action.
 type UnitActionResponse struct {
-	Unit   string `json:"unit"`
-	Result string `json:"result,omitempty"`
+	Unit        string `json:"unit"`
+	Result      string `json:"result,omitempty"`
+	ActiveState string `json:"activeState,omitempty"`
 }
 
 // HealthResponse describes the healthcheck endpoint payload. ServiceStatus is
@@ -111,6 +229,13 @@ type HealthResponse struct {
 	Status        string                 `json:"status"`
 	Version       string                 `json:"version"`
 	Time          string                 `json:"time"`
+	DeviceName    string                 `json:"deviceName,omitempty"`
+	Labels        map[string]string      `json:"labels,omitempty"`
+	APIVersions   []string               `json:"apiVersions"`
+	SafeMode      bool                   `json:"safeMode,omitempty"`
+	Simulated     bool                   `json:"simulated,omitempty"`
+	Board         BoardInfo              `json:"board"`
+	Capabilities  *Capabilities          `json:"capabilities,omitempty"`
 	ServiceStatus *ServiceStatusResponse `json:"serviceStatus,omitempty"`
 }
 
@@ -148,6 +273,9 @@ const DefaultScreenshotPathTemplate = "/var/media-pi/screenshots/cam_$(date +%F_
 // DefaultScreenshotInput is used when screenshot input source is not configured.
 const DefaultScreenshotInput = "/dev/video0"
 
+// DefaultMediaDir is used when playlist.destination is not configured.
+var DefaultMediaDir = "/var/media-pi"
+
 // DefaultScreenshotResendLimit controls how many pending screenshots are retried per capture cycle.
 const DefaultScreenshotResendLimit = 5
 
@@ -180,15 +308,16 @@ func DefaultConfig() Config {
 		ListenAddr:           DefaultListenAddr,
 		MediaPiServiceUser:   "pi",
 		CoreAPIBase:          "https://vezyn.fvds.ru",
-		MaxParallelDownloads: 3,
+		MaxParallelDownloads: currentBoard().ParallelDownloads,
 		Playlist: PlaylistConfig{
-			Destination: "/var/media-pi",
+			Destination: DefaultMediaDir,
 		},
 		Screenshot: ScreenshotConfig{
-			PathTemplate: DefaultScreenshotPathTemplate,
+			PathTemplate: RootedPath(DefaultScreenshotPathTemplate),
 			Input:        DefaultScreenshotInput,
 			ResendLimit:  DefaultScreenshotResendLimit,
 		},
+		HTTPClient: DefaultHTTPClientConfig(),
 	}
 }
 
@@ -213,6 +342,10 @@ func LoadConfigFrom(path string) (*Config, error) {
 	if c.ServerKey == "" {
 		return nil, fmt.Errorf("server_key is required in configuration")
 	}
+	plainSecrets := hasPlainSecrets(&c)
+	if err := openConfigSecrets(&c); err != nil {
+		return nil, err
+	}
 
 	// Set default media-pi service user if not specified
 	if c.MediaPiServiceUser == "" {
@@ -221,7 +354,7 @@ func LoadConfigFrom(path string) (*Config, error) {
 
 	// Set default playlist destination if not specified
 	if c.Playlist.Destination == "" {
-		c.Playlist.Destination = "/var/media-pi"
+		c.Playlist.Destination = DefaultMediaDir
 	}
 
 	// Set default core API base if not specified
@@ -231,12 +364,12 @@ func LoadConfigFrom(path string) (*Config, error) {
 
 	// Set default max parallel downloads if not specified
 	if c.MaxParallelDownloads == 0 {
-		c.MaxParallelDownloads = 3
+		c.MaxParallelDownloads = currentBoard().ParallelDownloads
 	}
 
 	// Set default screenshot path template if not specified.
 	if strings.TrimSpace(c.Screenshot.PathTemplate) == "" {
-		c.Screenshot.PathTemplate = DefaultScreenshotPathTemplate
+		c.Screenshot.PathTemplate = RootedPath(DefaultScreenshotPathTemplate)
 	}
 	if strings.TrimSpace(c.Screenshot.Input) == "" {
 		c.Screenshot.Input = DefaultScreenshotInput
@@ -245,16 +378,79 @@ func LoadConfigFrom(path string) (*Config, error) {
 		c.Screenshot.ResendLimit = DefaultScreenshotResendLimit
 	}
 
+	clients, err := parseAllowedClients(c.AllowedClients)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := newSyncSource(c); err != nil {
+		return nil, fmt.Errorf("invalid sync configuration: %w", err)
+	}
+	if err := validateTimeouts(c.Timeouts); err != nil {
+		return nil, err
+	}
+	if _, err := normalizeLocale(c.Locale); err != nil {
+		return nil, err
+	}
+	if err := validatePlaylistVariables(c.Playlist.Variables); err != nil {
+		return nil, err
+	}
+	if err := validateAudioPlayback(c.Audio.Playback); err != nil {
+		return nil, err
+	}
+	if err := validatePlaybackDuringSync(c.Sync); err != nil {
+		return nil, err
+	}
+	if err := validateSyncPriority(c.Sync); err != nil {
+		return nil, err
+	}
+	if err := validateExecJobs(c.Exec); err != nil {
+		return nil, err
+	}
+	if err := validateSyncPlay(c.SyncPlay); err != nil {
+		return nil, err
+	}
+	if err := validateProfiles(c.Profiles); err != nil {
+		return nil, err
+	}
+	if err := validateOrchestrations(c.Orchestrations, c.AllowedUnits); err != nil {
+		return nil, err
+	}
+	if err := validateNetworkMounts(c.Storage.Network); err != nil {
+		return nil, err
+	}
+	if err := validateMediaDirs(c); err != nil {
+		return nil, err
+	}
+
+	// Build the shared core API client before touching any global state so an
+	// invalid TLS setting leaves the previous configuration in effect.
+	applyHTTPClientDefaults(&c.HTTPClient)
+	client, err := NewCoreClient(c.HTTPClient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http_client configuration: %w", err)
+	}
+
 	// Set global variables.
 	AllowedUnits = newAllowedUnits
 	ServerKey = c.ServerKey
 	MediaPiServiceUser = c.MediaPiServiceUser
+	setAllowedClients(clients)
+	SetCoreClient(client)
 
 	// Store the configuration for later access
 	configMutex.Lock()
 	currentConfig = &c
 	configMutex.Unlock()
 
+	// Encrypt plain secrets as soon as encrypt_secrets is turned on.
+	if c.EncryptSecrets && plainSecrets {
+		if err := saveConfigToFile(path, &c); err != nil {
+			log.Printf("Warning: failed to encrypt secrets in %s: %v", path, err)
+		} else {
+			log.Printf("Encrypted secrets in %s", path)
+		}
+	}
+
 	return &c, nil
 }
 
@@ -280,18 +476,16 @@ func UpdateConfigSettings(playlist PlaylistConfig, schedule ScheduleConfig, audi
 		return fmt.Errorf("configuration not loaded")
 	}
 
-	// Update in-memory config
+	// Update in-memory config, keeping the previous one if the file cannot
+	// be saved.
+	previous := *currentConfig
 	currentConfig.Playlist = playlist
 	currentConfig.Schedule = schedule
 	currentConfig.Audio = audio
 	currentConfig.Screenshot = screenshot
 
-	// Save to file
-	if ConfigPath == "" {
-		return fmt.Errorf("config path is not set")
-	}
-
-	if err := saveConfigToFile(ConfigPath, currentConfig); err != nil {
+	if err := saveCurrentConfig("settings"); err != nil {
+		*currentConfig = previous
 		return err
 	}
 
@@ -307,7 +501,11 @@ func UpdateConfigSettings(playlist PlaylistConfig, schedule ScheduleConfig, audi
 // file is always in a consistent state.
 // This function is NOT thread-safe and should be called with configMutex held or from LoadConfigFrom.
 func saveConfigToFile(path string, c *Config) error {
-	data, err := yaml.Marshal(c)
+	disk, err := configForDisk(*c)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(&disk)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -326,6 +524,22 @@ func saveConfigToFile(path string, c *Config) error {
 	return nil
 }
 
+// saveCurrentConfig writes currentConfig to ConfigPath under the next
+// revision and announces the change of section. Callers must hold
+// configMutex.
+func saveCurrentConfig(section string) error {
+	if ConfigPath == "" {
+		return fmt.Errorf("config path is not set")
+	}
+	currentConfig.Revision++
+	if err := saveConfigToFile(ConfigPath, currentConfig); err != nil {
+		currentConfig.Revision--
+		return err
+	}
+	publishEvent(EventConfigChanged, ConfigChangedEvent{Section: section})
+	return nil
+}
+
 // migrateConfigFromSystemd reads settings from systemd unit files and populates
 // the config if those settings are missing. It sets needsSave to true if any
 // settings were migrated.
@@ -411,6 +625,8 @@ func ReloadConfig() error {
 
 	// Signal scheduler to rebuild cron jobs with the reloaded config.
 	SignalSchedulerReload()
+	DetectCapabilities()
+	publishEvent(EventConfigChanged, ConfigChangedEvent{})
 
 	// Optionally we could do something with cfg here in the future.
 	_ = cfg
@@ -499,7 +715,11 @@ func SetupConfig(configPath string) error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	data, err = yaml.Marshal(config)
+	disk, err := configForDisk(config)
+	if err != nil {
+		return err
+	}
+	data, err = yaml.Marshal(disk)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -565,6 +785,7 @@ func isAuthorizedRequest(r *http.Request) bool {
 // JSONResponse writes an APIResponse as JSON with the provided HTTP status
 // code and sets the Content-Type header.
 func JSONResponse(w http.ResponseWriter, status int, response APIResponse) {
+	response = localizeResponse(w, response)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -593,7 +814,7 @@ func HandleListUnits(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conn, err := getDBusConnection(context.Background())
+	conn, err := getDBusConnection(r.Context())
 	if err != nil {
 		JSONResponse(w, http.StatusInternalServerError, APIResponse{
 			OK:     false,
@@ -603,7 +824,7 @@ func HandleListUnits(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), dbusOperationTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), dbusTimeout())
 	defer cancel()
 
 	var infos []UnitInfo
@@ -613,11 +834,7 @@ func HandleListUnits(w http.ResponseWriter, r *http.Request) {
 			infos = append(infos, UnitInfo{Unit: unit, Error: err.Error()})
 			continue
 		}
-		infos = append(infos, UnitInfo{
-			Unit:   unit,
-			Active: props["ActiveState"],
-			Sub:    props["SubState"],
-		})
+		infos = append(infos, unitInfo(unit, props))
 	}
 
 	JSONResponse(w, http.StatusOK, APIResponse{
@@ -650,7 +867,7 @@ func HandleUnitStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conn, err := getDBusConnection(context.Background())
+	conn, err := getDBusConnection(r.Context())
 	if err != nil {
 		JSONResponse(w, http.StatusInternalServerError, APIResponse{
 			OK:     false,
@@ -660,7 +877,7 @@ func HandleUnitStatus(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), dbusOperationTimeout)
+	ctx, cancel := context.WithTimeout(r.Context(), dbusTimeout())
 	defer cancel()
 
 	props, err := conn.GetUnitPropertiesContext(ctx, unit)
@@ -673,18 +890,14 @@ func HandleUnitStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	JSONResponse(w, http.StatusOK, APIResponse{
-		OK: true,
-		Data: UnitInfo{
-			Unit:   unit,
-			Active: props["ActiveState"],
-			Sub:    props["SubState"],
-		},
+		OK:   true,
+		Data: unitInfo(unit, props),
 	})
 }
 
 // HandleUnitAction returns an HTTP handler which performs the specified
-// action (start/stop/restart/enable/disable) on the unit provided in the
-// request body.
+// action (start/stop/restart/enable/disable/mask/unmask) on the unit
+// provided in the request body.
 func HandleUnitAction(action string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !requireMethod(w, r, http.MethodPost) {
@@ -738,18 +951,36 @@ func HandleUnitAction(action string) http.HandlerFunc {
 		case "restart":
 			result, actionErr = runDBusUnitOperation(requestCtx, conn, dbusUnitOperationRestart, req.Unit)
 		case "enable":
-			ctx, cancel := context.WithTimeout(requestCtx, dbusOperationTimeout)
+			ctx, cancel := context.WithTimeout(requestCtx, dbusTimeout())
 			defer cancel()
 			_, _, actionErr = conn.EnableUnitFilesContext(ctx, []string{req.Unit}, false, true)
 			if actionErr == nil {
 				result = "enabled"
+				publishEvent(EventUnitChanged, UnitEvent{Unit: req.Unit, Action: action, Result: result})
 			}
 		case "disable":
-			ctx, cancel := context.WithTimeout(requestCtx, dbusOperationTimeout)
+			ctx, cancel := context.WithTimeout(requestCtx, dbusTimeout())
 			defer cancel()
 			_, actionErr = conn.DisableUnitFilesContext(ctx, []string{req.Unit}, false)
 			if actionErr == nil {
 				result = "disabled"
+				publishEvent(EventUnitChanged, UnitEvent{Unit: req.Unit, Action: action, Result: result})
+			}
+		case "mask":
+			ctx, cancel := context.WithTimeout(requestCtx, dbusTimeout())
+			defer cancel()
+			_, actionErr = conn.MaskUnitFilesContext(ctx, []string{req.Unit}, false, true)
+			if actionErr == nil {
+				result = "masked"
+				publishEvent(EventUnitChanged, UnitEvent{Unit: req.Unit, Action: action, Result: result})
+			}
+		case "unmask":
+			ctx, cancel := context.WithTimeout(requestCtx, dbusTimeout())
+			defer cancel()
+			_, actionErr = conn.UnmaskUnitFilesContext(ctx, []string{req.Unit}, false)
+			if actionErr == nil {
+				result = "unmasked"
+				publishEvent(EventUnitChanged, UnitEvent{Unit: req.Unit, Action: action, Result: result})
 			}
 		default:
 			JSONResponse(w, http.StatusBadRequest, APIResponse{
@@ -767,16 +998,43 @@ func HandleUnitAction(action string) http.HandlerFunc {
 			return
 		}
 
+		response := UnitActionResponse{Unit: req.Unit, Result: result}
+		if operation, ok := waitableUnitActions[action]; ok && req.Wait {
+			state, err := waitForUnitState(requestCtx, conn, req.Unit)
+			response.ActiveState = state
+			if err != nil {
+				JSONResponse(w, http.StatusInternalServerError, APIResponse{
+					OK:     false,
+					ErrMsg: fmt.Sprintf("Не удалось дождаться завершения действия для %s: %v", req.Unit, err),
+					Data:   response,
+				})
+				return
+			}
+			if !unitReachedTarget(operation, result, state) {
+				JSONResponse(w, http.StatusInternalServerError, APIResponse{
+					OK:     false,
+					ErrMsg: fmt.Sprintf("Юнит %s не выполнил действие %s: результат %s, состояние %s", req.Unit, action, result, state),
+					Data:   response,
+				})
+				return
+			}
+		}
+
 		JSONResponse(w, http.StatusOK, APIResponse{
-			OK: true,
-			Data: UnitActionResponse{
-				Unit:   req.Unit,
-				Result: result,
-			},
+			OK:   true,
+			Data: response,
 		})
 	}
 }
 
+// waitableUnitActions maps the unit actions that run a systemd job, and so
+// accept wait, to their operation.
+var waitableUnitActions = map[string]dbusUnitOperation{
+	"start":   dbusUnitOperationStart,
+	"stop":    dbusUnitOperationStop,
+	"restart": dbusUnitOperationRestart,
+}
+
 // HandleHealth provides a simple healthcheck endpoint with version and
 // timestamp information. Authenticated requests also include service status.
 func HandleHealth(w http.ResponseWriter, r *http.Request) {
@@ -784,10 +1042,18 @@ func HandleHealth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	identity := getDeviceIdentity(GetCurrentConfig())
 	data := HealthResponse{
-		Status:  "healthy",
-		Version: GetVersion(),
-		Time:    time.Now().UTC().Format(time.RFC3339),
+		Status:       "healthy",
+		Version:      GetVersion(),
+		Time:         time.Now().UTC().Format(time.RFC3339),
+		DeviceName:   identity.DeviceName,
+		Labels:       identity.Labels,
+		APIVersions:  supportedAPIVersions,
+		Capabilities: getCapabilities(),
+		SafeMode:     IsSafeMode(),
+		Simulated:    IsSimulated(),
+		Board:        currentBoard(),
 	}
 
 	if isAuthorizedRequest(r) {
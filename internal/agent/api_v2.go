@@ -0,0 +1,184 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// API versions served by the agent. v1 routes live under /api/ and answer
+// with APIResponse; v2 routes live under /api/v2/ and answer with
+// APIResponseV2.
+const (
+	APIVersion1 = "v1"
+	APIVersion2 = "v2"
+
+	apiV2Prefix = "/api/v2/"
+)
+
+// supportedAPIVersions is reported in /health so the core can pick the
+// newest version every device of a mixed fleet understands.
+var supportedAPIVersions = []string{APIVersion1, APIVersion2}
+
+// APIResponseV2 is the v2 response envelope. Failures carry a machine
+// readable code next to the message instead of a bare errmsg string.
+type APIResponseV2 struct {
+	OK    bool            `json:"ok"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error *APIErrorV2     `json:"error,omitempty"`
+}
+
+// APIErrorV2 describes a failed v2 request.
+type APIErrorV2 struct {
+	// Code is derived from the HTTP status, e.g. not_found or conflict.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// apiErrorCodes maps HTTP statuses to v2 error codes.
+var apiErrorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusMethodNotAllowed:    "method_not_allowed",
+	http.StatusRequestTimeout:      "timeout",
+	http.StatusConflict:            "conflict",
+	http.StatusTooManyRequests:     "too_many_requests",
+	http.StatusServiceUnavailable:  "unavailable",
+	http.StatusInternalServerError: "internal",
+}
+
+func apiErrorCode(status int) string {
+	if code, ok := apiErrorCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return "internal"
+	}
+	return "error"
+}
+
+// bufferedResponse holds a handler response until it is rewritten. Headers
+// go straight to the underlying writer so middleware settings such as
+// Content-Language stay visible to the handler.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// v2Response decides at WriteHeader time whether a handler response is
+// rewritten. A JSON envelope is buffered until the handler returns; any
+// other response, such as a file download or an event stream, passes
+// through to the underlying writer unbuffered. As with bufferedResponse,
+// headers go straight to the underlying writer.
+type v2Response struct {
+	w      http.ResponseWriter
+	status int
+	buffer bool
+	body   bytes.Buffer
+}
+
+func (v *v2Response) Header() http.Header { return v.w.Header() }
+
+func (v *v2Response) WriteHeader(status int) {
+	if v.status != 0 {
+		return
+	}
+	v.status = status
+	v.w.Header().Set("API-Version", APIVersion2)
+	v.buffer = strings.HasPrefix(v.w.Header().Get("Content-Type"), "application/json")
+	if !v.buffer {
+		v.w.WriteHeader(status)
+	}
+}
+
+func (v *v2Response) Write(p []byte) (int, error) {
+	v.WriteHeader(http.StatusOK)
+	if v.buffer {
+		return v.body.Write(p)
+	}
+	return v.w.Write(p)
+}
+
+// Flush sends a passed through response to the client; a buffered
+// envelope is sent when the handler returns.
+func (v *v2Response) Flush() {
+	v.WriteHeader(http.StatusOK)
+	if !v.buffer {
+		_ = http.NewResponseController(v.w).Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (v *v2Response) Unwrap() http.ResponseWriter { return v.w }
+
+// toV2 converts a v1 JSON envelope to APIResponseV2. Other bodies, such as
+// screenshots, are not converted.
+func toV2(status int, body []byte) (APIResponseV2, bool) {
+	var v1 struct {
+		OK     *bool           `json:"ok"`
+		ErrMsg string          `json:"errmsg"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &v1); err != nil || v1.OK == nil {
+		return APIResponseV2{}, false
+	}
+	response := APIResponseV2{OK: *v1.OK, Data: v1.Data}
+	if !response.OK {
+		response.Error = &APIErrorV2{Code: apiErrorCode(status), Message: v1.ErrMsg}
+	}
+	return response, true
+}
+
+// APIv2Handler serves /api/v2/ by dispatching to the v1 route of the same
+// name through next and rewriting the envelope to APIResponseV2. Other
+// responses, such as files and /api/v2/sync/events, pass through unchanged.
+// Authentication and method checks are those of the v1 route.
+func APIv2Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v1 := r.Clone(r.Context())
+		v1.URL.Path = "/api/" + strings.TrimPrefix(r.URL.Path, apiV2Prefix)
+		v1.URL.RawPath = ""
+
+		response := &v2Response{w: w}
+		next.ServeHTTP(response, v1)
+		response.WriteHeader(http.StatusOK)
+		if !response.buffer {
+			return
+		}
+
+		converted, ok := toV2(response.status, response.body.Bytes())
+		if !ok {
+			w.WriteHeader(response.status)
+			_, _ = w.Write(response.body.Bytes())
+			return
+		}
+		w.Header().Del("Content-Length")
+		w.WriteHeader(response.status)
+		if err := json.NewEncoder(w).Encode(converted); err != nil {
+			log.Printf("Failed to encode JSON response: %v", err)
+		}
+	})
+}
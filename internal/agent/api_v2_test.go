@@ -0,0 +1,120 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAPIv2Handler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/items", func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: map[string]int{"count": 2}})
+	})
+	mux.HandleFunc("/api/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		_, _ = w.Write([]byte("jpeg"))
+	})
+	mux.Handle("/api/v2/", APIv2Handler(mux))
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// v1 keeps its envelope.
+	if w := serve(http.MethodGet, "/api/items"); w.Body.String() != "{\"ok\":true,\"data\":{\"count\":2}}\n" {
+		t.Fatalf("unexpected v1 body %s", w.Body.String())
+	}
+
+	w := serve(http.MethodGet, "/api/v2/items")
+	var ok APIResponseV2
+	if err := json.Unmarshal(w.Body.Bytes(), &ok); err != nil || !ok.OK || string(ok.Data) != `{"count":2}` || ok.Error != nil {
+		t.Fatalf("unexpected v2 body %s (%v)", w.Body.String(), err)
+	}
+	if w.Header().Get("API-Version") != APIVersion2 {
+		t.Fatalf("expected API-Version header, got %v", w.Header())
+	}
+
+	w = serve(http.MethodPost, "/api/v2/items")
+	var failed APIResponseV2
+	if err := json.Unmarshal(w.Body.Bytes(), &failed); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusMethodNotAllowed || failed.OK || failed.Error == nil ||
+		failed.Error.Code != "method_not_allowed" || failed.Error.Message != "Метод не разрешён" {
+		t.Fatalf("unexpected v2 error %d %s", w.Code, w.Body.String())
+	}
+
+	// Non-JSON responses pass through unchanged.
+	if w := serve(http.MethodGet, "/api/v2/image"); w.Body.String() != "jpeg" || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("unexpected image response %q %v", w.Body.String(), w.Header())
+	}
+}
+
+func TestAPIv2HandlerStreamsNonJSON(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		for i := 0; i < 3; i++ {
+			before := recorder.Body.Len()
+			_, _ = w.Write(make([]byte, 1<<20))
+			if recorder.Body.Len() != before+1<<20 {
+				t.Fatalf("chunk %d was buffered", i)
+			}
+		}
+	})
+	mux.Handle("/api/v2/", APIv2Handler(mux))
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v2/download", nil))
+	if recorder.Body.Len() != 3<<20 || recorder.Header().Get("API-Version") != APIVersion2 {
+		t.Fatalf("unexpected download %d bytes, %v", recorder.Body.Len(), recorder.Header())
+	}
+
+	mux.HandleFunc("/api/sync/events", HandleSyncEvents)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v2/sync/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if line, err := bufio.NewReader(resp.Body).ReadString('\n'); err != nil || line != ": connected\n" {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+}
+
+func TestHealthReportsAPIVersions(t *testing.T) {
+	setCurrentConfigForTest(t, Config{ServerKey: "key"})
+	w := httptest.NewRecorder()
+	HandleHealth(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var health struct {
+		Data HealthResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if len(health.Data.APIVersions) != 2 || health.Data.APIVersions[1] != APIVersion2 {
+		t.Fatalf("unexpected apiVersions %v", health.Data.APIVersions)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UploadConfig controls how device artifacts such as screenshots are sent
+// to the core. Files of at least threshold_mb are sent in chunks of
+// chunk_size_kb that survive a dropped connection, since a single large POST
+// times out on sites with slow uplinks.
+type UploadConfig struct {
+	ChunkSizeKB int `yaml:"chunk_size_kb,omitempty"`
+	ThresholdMB int `yaml:"threshold_mb,omitempty"`
+}
+
+// Defaults for chunked uploads.
+const (
+	DefaultUploadChunkSizeKB = 1024
+	DefaultUploadThresholdMB = 8
+
+	uploadChunkRequestTimeout = 2 * time.Minute
+	// maxUploadResyncs bounds how often the offset is fetched again after
+	// the core rejected a chunk.
+	maxUploadResyncs = 3
+)
+
+// errChunkedUploadUnsupported is returned when the core does not offer the
+// upload session API; callers fall back to a single request.
+var errChunkedUploadUnsupported = errors.New("core does not support chunked uploads")
+
+var (
+	// uploadStateFilePath persists open upload sessions so an interrupted
+	// upload resumes after a restart.
+	uploadStateFilePath = filepath.Join(agentStateDir, "uploads.json")
+
+	uploadStateLock sync.Mutex
+)
+
+// uploadSession is an upload session opened on the core.
+type uploadSession struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Filename  string `json:"filename"`
+	SizeBytes int64  `json:"sizeBytes"`
+	SHA256    string `json:"sha256"`
+}
+
+// uploadSessionRequest opens an upload session.
+type uploadSessionRequest struct {
+	Kind      string `json:"kind"`
+	Filename  string `json:"filename"`
+	SizeBytes int64  `json:"sizeBytes"`
+	SHA256    string `json:"sha256"`
+	ChunkSize int64  `json:"chunkSize"`
+}
+
+// uploadSessionStatus is returned by the core for a session: its ID and
+// how many bytes it has received.
+type uploadSessionStatus struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+}
+
+func uploadChunkSize(config UploadConfig) int64 {
+	if config.ChunkSizeKB > 0 {
+		return int64(config.ChunkSizeKB) << 10
+	}
+	return DefaultUploadChunkSizeKB << 10
+}
+
+func uploadThreshold(config UploadConfig) int64 {
+	if config.ThresholdMB > 0 {
+		return int64(config.ThresholdMB) << 20
+	}
+	return DefaultUploadThresholdMB << 20
+}
+
+// useChunkedUpload reports whether a file of size bytes is sent in chunks.
+func useChunkedUpload(config UploadConfig, size int64) bool {
+	return size >= uploadThreshold(config)
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// loadUploadSessions returns the persisted sessions by file digest.
+func loadUploadSessions() map[string]uploadSession {
+	sessions := map[string]uploadSession{}
+	if err := readStateFile(uploadStateFilePath, &sessions); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Warning: ignoring upload state: %v", err)
+	}
+	return sessions
+}
+
+func saveUploadSession(session uploadSession) {
+	uploadStateLock.Lock()
+	defer uploadStateLock.Unlock()
+	sessions := loadUploadSessions()
+	sessions[session.SHA256] = session
+	if err := writeStateFile(uploadStateFilePath, sessions); err != nil {
+		log.Printf("Warning: failed to persist upload session: %v", err)
+	}
+}
+
+func dropUploadSession(digest string) {
+	uploadStateLock.Lock()
+	defer uploadStateLock.Unlock()
+	sessions := loadUploadSessions()
+	if _, ok := sessions[digest]; !ok {
+		return
+	}
+	delete(sessions, digest)
+	if err := writeStateFile(uploadStateFilePath, sessions); err != nil {
+		log.Printf("Warning: failed to persist upload sessions: %v", err)
+	}
+}
+
+func findUploadSession(digest string) (uploadSession, bool) {
+	uploadStateLock.Lock()
+	defer uploadStateLock.Unlock()
+	session, ok := loadUploadSessions()[digest]
+	return session, ok
+}
+
+// uploadsURL returns the upload session endpoint of the core, followed by
+// the escaped elements of path.
+func uploadsURL(config Config, path ...string) string {
+	u := strings.TrimRight(config.CoreAPIBase, "/") + "/api/devicesync/uploads"
+	for _, element := range path {
+		u += "/" + url.PathEscape(element)
+	}
+	return u
+}
+
+// uploadRequest sends one request of the upload session API and decodes a
+// JSON answer into v when v is not nil. It returns the status code with
+// errors for statuses outside 2xx.
+func uploadRequest(ctx context.Context, config Config, method, url, contentType string, body []byte, header http.Header, v any) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-Device-Id", config.ServerKey)
+
+	resp, err := getCoreClient().Do(ctx, req, uploadChunkRequestTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+	}
+	if v != nil {
+		// An empty body leaves v unchanged.
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return resp.StatusCode, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// openUploadSession resumes the persisted session of the file or opens a
+// new one, and returns it with the offset to continue from.
+func openUploadSession(ctx context.Context, config Config, kind, path string, size int64, digest string) (uploadSession, int64, error) {
+	if session, ok := findUploadSession(digest); ok {
+		var status uploadSessionStatus
+		code, err := uploadRequest(ctx, config, http.MethodGet, uploadsURL(config, session.ID), "", nil, nil, &status)
+		switch {
+		case err == nil:
+			log.Printf("Resuming upload of %s at %d of %d bytes", session.Filename, status.Offset, session.SizeBytes)
+			return session, status.Offset, nil
+		case code == http.StatusNotFound || code == http.StatusGone:
+			dropUploadSession(digest)
+		default:
+			return uploadSession{}, 0, fmt.Errorf("get upload session: %w", err)
+		}
+	}
+
+	request := uploadSessionRequest{Kind: kind, Filename: filepath.Base(path), SizeBytes: size, SHA256: digest, ChunkSize: uploadChunkSize(config.Upload)}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return uploadSession{}, 0, err
+	}
+	var status uploadSessionStatus
+	code, err := uploadRequest(ctx, config, http.MethodPost, uploadsURL(config), "application/json", body, nil, &status)
+	if code == http.StatusNotFound || code == http.StatusMethodNotAllowed {
+		return uploadSession{}, 0, errChunkedUploadUnsupported
+	}
+	if err != nil {
+		return uploadSession{}, 0, fmt.Errorf("open upload session: %w", err)
+	}
+	if status.ID == "" {
+		return uploadSession{}, 0, fmt.Errorf("open upload session: no session id in response")
+	}
+	session := uploadSession{ID: status.ID, Kind: kind, Filename: request.Filename, SizeBytes: size, SHA256: digest}
+	saveUploadSession(session)
+	return session, status.Offset, nil
+}
+
+// uploadArtifact sends the file at path to the core in chunks through an
+// upload session: the session is opened with the size and SHA256 of the
+// file, every chunk is PUT with a Content-Range header and the core checks
+// the digest when the session is completed. An interrupted upload resumes
+// from the offset the core reports. It returns errChunkedUploadUnsupported
+// when the core has no session API.
+func uploadArtifact(ctx context.Context, config Config, kind, path string) error {
+	if strings.TrimSpace(config.CoreAPIBase) == "" {
+		return fmt.Errorf("core_api_base not configured")
+	}
+	if strings.TrimSpace(config.ServerKey) == "" {
+		return fmt.Errorf("server_key not configured")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	digest, err := fileSHA256(path)
+	if err != nil {
+		return fmt.Errorf("hash %s: %w", path, err)
+	}
+	session, offset, err := openUploadSession(ctx, config, kind, path, info.Size(), digest)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	chunk := make([]byte, uploadChunkSize(config.Upload))
+	resyncs := 0
+	for offset < session.SizeBytes {
+		n, err := file.ReadAt(chunk, offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		if n == 0 {
+			return fmt.Errorf("read %s: file shrank during upload", path)
+		}
+
+		header := http.Header{}
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(n)-1, session.SizeBytes))
+		status := uploadSessionStatus{Offset: offset + int64(n)}
+		code, err := uploadRequest(ctx, config, http.MethodPut, uploadsURL(config, session.ID), "application/octet-stream", chunk[:n], header, &status)
+		if code == http.StatusConflict || code == http.StatusRequestedRangeNotSatisfiable {
+			// The core has a different offset, e.g. after a lost response.
+			if resyncs++; resyncs > maxUploadResyncs {
+				return fmt.Errorf("upload chunk: %w", err)
+			}
+			var current uploadSessionStatus
+			if _, err := uploadRequest(ctx, config, http.MethodGet, uploadsURL(config, session.ID), "", nil, nil, &current); err != nil {
+				return fmt.Errorf("get upload session: %w", err)
+			}
+			offset = current.Offset
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("upload chunk at %d: %w", offset, err)
+		}
+		offset = status.Offset
+	}
+
+	body, err := json.Marshal(map[string]string{"sha256": digest})
+	if err != nil {
+		return err
+	}
+	code, err := uploadRequest(ctx, config, http.MethodPost, uploadsURL(config, session.ID, "complete"), "application/json", body, nil, nil)
+	if err != nil {
+		if code == http.StatusUnprocessableEntity {
+			// The assembled file did not match; start over next time.
+			dropUploadSession(digest)
+		}
+		return fmt.Errorf("complete upload: %w", err)
+	}
+	dropUploadSession(digest)
+	log.Printf("Uploaded %s (%d bytes) in chunks", session.Filename, session.SizeBytes)
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeUploadCore implements the upload session API of the core.
+type fakeUploadCore struct {
+	mu        sync.Mutex
+	data      map[string][]byte
+	completed map[string]bool
+	puts      int
+	// failPut fails the PUT with this number (1-based) once.
+	failPut int
+}
+
+func (c *fakeUploadCore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rest := strings.TrimPrefix(r.URL.Path, "/api/devicesync/uploads")
+	switch {
+	case r.Method == http.MethodPost && rest == "":
+		id := fmt.Sprintf("u%d", len(c.data)+1)
+		c.data[id] = nil
+		_ = json.NewEncoder(w).Encode(uploadSessionStatus{ID: id})
+	case r.Method == http.MethodGet:
+		id := strings.TrimPrefix(rest, "/")
+		data, ok := c.data[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(uploadSessionStatus{ID: id, Offset: int64(len(data))})
+	case r.Method == http.MethodPut:
+		c.puts++
+		if c.puts == c.failPut {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		id := strings.TrimPrefix(rest, "/")
+		var start, end, total int64
+		if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil || start != int64(len(c.data[id])) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		chunk, _ := io.ReadAll(r.Body)
+		c.data[id] = append(c.data[id], chunk...)
+		_ = json.NewEncoder(w).Encode(uploadSessionStatus{ID: id, Offset: int64(len(c.data[id]))})
+	case r.Method == http.MethodPost && strings.HasSuffix(rest, "/complete"):
+		c.completed[strings.TrimSuffix(strings.TrimPrefix(rest, "/"), "/complete")] = true
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func setUploadStateForTest(t *testing.T) {
+	t.Helper()
+	original := uploadStateFilePath
+	uploadStateFilePath = filepath.Join(t.TempDir(), "uploads.json")
+	t.Cleanup(func() { uploadStateFilePath = original })
+}
+
+func TestUploadArtifactResumes(t *testing.T) {
+	setUploadStateForTest(t)
+	core := &fakeUploadCore{data: map[string][]byte{}, completed: map[string]bool{}, failPut: 3}
+	server := httptest.NewServer(core)
+	defer server.Close()
+
+	content := bytes.Repeat([]byte("0123456789"), 500)
+	path := filepath.Join(t.TempDir(), "archive.tar.gz")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{CoreAPIBase: server.URL, ServerKey: "key", Upload: UploadConfig{ChunkSizeKB: 1}}
+
+	if err := uploadArtifact(context.Background(), config, "logs", path); err == nil {
+		t.Fatal("expected the interrupted upload to fail")
+	}
+	digest, _ := fileSHA256(path)
+	if _, ok := findUploadSession(digest); !ok {
+		t.Fatal("expected the session kept for resuming")
+	}
+
+	if err := uploadArtifact(context.Background(), config, "logs", path); err != nil {
+		t.Fatalf("uploadArtifact() error = %v", err)
+	}
+	if len(core.data) != 1 || !bytes.Equal(core.data["u1"], content) || !core.completed["u1"] {
+		t.Fatalf("expected one completed session with the file, got %d sessions, %d bytes", len(core.data), len(core.data["u1"]))
+	}
+	if _, ok := findUploadSession(digest); ok {
+		t.Fatal("expected the session dropped after completion")
+	}
+}
+
+func TestUploadScreenshotFallsBackWithoutChunkedUploads(t *testing.T) {
+	setUploadStateForTest(t)
+	var single int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/devicesync/screenshot" {
+			single++
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "cam.jpg")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{1}, 2<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{CoreAPIBase: server.URL, ServerKey: "key", Upload: UploadConfig{ThresholdMB: 1}}
+	if err := uploadScreenshot(context.Background(), config, path); err != nil {
+		t.Fatalf("uploadScreenshot() error = %v", err)
+	}
+	if single != 1 {
+		t.Fatalf("expected a single request upload, got %d", single)
+	}
+}
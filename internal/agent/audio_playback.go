@@ -0,0 +1,529 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// audioPlaybackUnit plays the background music playlist. It runs next to
+// play.video.service and goes to the ALSA default device, i.e. the output
+// selected by audio.output.
+const audioPlaybackUnit = "play.audio.service"
+
+const (
+	// DefaultAudioPlayerCommand plays the audio playlist in a loop;
+	// {volume} is replaced with audio.playback.volume.
+	DefaultAudioPlayerCommand = "/usr/bin/mpv --no-video --no-terminal --loop-playlist=inf --volume={volume}"
+	// DefaultAudioPlaylist is the audio playlist in playlist.destination.
+	DefaultAudioPlaylist = "audio.m3u"
+	// DefaultAudioVolume is used when audio.playback.volume is not set.
+	DefaultAudioVolume = 70
+)
+
+// Values of audio.playback.mode.
+const (
+	// AudioModeWithVideo plays music and video at the same time.
+	AudioModeWithVideo = "with_video"
+	// AudioModeInsteadOfVideo stops video while music plays.
+	AudioModeInsteadOfVideo = "instead_of_video"
+)
+
+const metricAudioPlaybackActive = "media_pi_audio_playback_active"
+
+func init() {
+	registerGauge(metricAudioPlaybackActive, "1 while the agent plays the background music playlist.")
+}
+
+// AudioPlaybackConfig configures the background music channel.
+type AudioPlaybackConfig struct {
+	Enabled bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	// Command is the audio player with its options; the playlist path is
+	// appended.
+	Command string `yaml:"command,omitempty" json:"command,omitempty"`
+	// Playlist is the audio playlist relative to playlist.destination.
+	Playlist string `yaml:"playlist,omitempty" json:"playlist,omitempty"`
+	// Volume is the player volume, 0-100.
+	Volume *int   `yaml:"volume,omitempty" json:"volume,omitempty"`
+	Mode   string `yaml:"mode,omitempty" json:"mode,omitempty"`
+	// Schedule lists the daily windows music plays in; without it the
+	// music plays whenever play.audio.service runs.
+	Schedule []AudioWindowConfig `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	// IPCSocket is the mpv --input-ipc-server socket of the audio player.
+	// With it volume changes apply without restarting the music.
+	IPCSocket string `yaml:"ipc_socket,omitempty" json:"ipc_socket,omitempty"`
+}
+
+// AudioWindowConfig is a daily HH:MM window; Stop before Start spans
+// midnight.
+type AudioWindowConfig struct {
+	Start string `yaml:"start" json:"start"`
+	Stop  string `yaml:"stop" json:"stop"`
+}
+
+// AudioPlaybackStatus is returned by GET /api/audio/playback.
+type AudioPlaybackStatus struct {
+	Enabled  bool                `json:"enabled"`
+	Active   bool                `json:"active"`
+	Volume   int                 `json:"volume"`
+	Mode     string              `json:"mode"`
+	Playlist string              `json:"playlist"`
+	Schedule []AudioWindowConfig `json:"schedule,omitempty"`
+	// InWindow reports whether now is inside a schedule window.
+	InWindow *bool `json:"inWindow,omitempty"`
+}
+
+// AudioVolumeRequest is the body of POST /api/audio/playback/volume.
+type AudioVolumeRequest struct {
+	Volume *int `json:"volume"`
+}
+
+var (
+	audioLock sync.Mutex
+	// audioStoppedVideo records that starting the music in
+	// AudioModeInsteadOfVideo stopped video, which is restarted with the
+	// music stopped.
+	audioStoppedVideo bool
+
+	// audioNow is the clock of the audio schedule. Tests may override it.
+	audioNow = time.Now
+)
+
+func audioVolume(config AudioPlaybackConfig) int {
+	if config.Volume == nil {
+		return DefaultAudioVolume
+	}
+	return *config.Volume
+}
+
+func audioMode(config AudioPlaybackConfig) string {
+	if config.Mode == "" {
+		return AudioModeWithVideo
+	}
+	return config.Mode
+}
+
+func audioPlaylistPath(config Config) string {
+	name := strings.TrimSpace(config.Audio.Playback.Playlist)
+	if name == "" {
+		name = DefaultAudioPlaylist
+	}
+	return filepath.Join(strings.TrimRight(config.Playlist.Destination, "/"), filepath.FromSlash(name))
+}
+
+func audioPlayerCommand(config Config) string {
+	command := strings.TrimSpace(config.Audio.Playback.Command)
+	if command == "" {
+		command = DefaultAudioPlayerCommand
+	}
+	return SanitizeSystemdValue(strings.ReplaceAll(command, "{volume}", strconv.Itoa(audioVolume(config.Audio.Playback))))
+}
+
+// validateAudioPlayback checks audio.playback.
+func validateAudioPlayback(config AudioPlaybackConfig) error {
+	if config.Volume != nil && (*config.Volume < 0 || *config.Volume > 100) {
+		return fmt.Errorf("audio.playback.volume must be between 0 and 100")
+	}
+	if mode := audioMode(config); mode != AudioModeWithVideo && mode != AudioModeInsteadOfVideo {
+		return fmt.Errorf("audio.playback.mode: unknown mode %q, expected %s or %s", config.Mode, AudioModeWithVideo, AudioModeInsteadOfVideo)
+	}
+	playlist := filepath.Clean(filepath.FromSlash(strings.TrimSpace(config.Playlist)))
+	if config.Playlist != "" && (filepath.IsAbs(playlist) || strings.HasPrefix(playlist, "..")) {
+		return fmt.Errorf("audio.playback.playlist must be relative to playlist.destination")
+	}
+	for _, window := range config.Schedule {
+		if _, _, err := parseHourMinute(window.Start); err != nil {
+			return fmt.Errorf("audio.playback.schedule: invalid start %q: %w", window.Start, err)
+		}
+		if _, _, err := parseHourMinute(window.Stop); err != nil {
+			return fmt.Errorf("audio.playback.schedule: invalid stop %q: %w", window.Stop, err)
+		}
+		if window.Start == window.Stop {
+			return fmt.Errorf("audio.playback.schedule: window %s-%s is empty", window.Start, window.Stop)
+		}
+	}
+	return nil
+}
+
+// renderAudioPlaybackUnit renders play.audio.service for config.
+func renderAudioPlaybackUnit(config Config) (UnitFile, error) {
+	user := SanitizeSystemdValue(config.MediaPiServiceUser)
+	if user == "" {
+		user = "pi"
+	}
+	content, err := renderUnitTemplate("play.audio.service.tmpl", map[string]string{
+		"User":          user,
+		"PlayerCommand": audioPlayerCommand(config),
+		"Playlist":      SanitizeSystemdValue(audioPlaylistPath(config)),
+	})
+	if err != nil {
+		return UnitFile{}, err
+	}
+	return UnitFile{Name: audioPlaybackUnit, Content: content, Enable: true}, nil
+}
+
+// minutesOfDay parses HH:MM validated by validateAudioPlayback.
+func minutesOfDay(value string) int {
+	hour, minute, _ := parseHourMinute(value)
+	return hour*60 + minute
+}
+
+// audioInWindow reports whether now falls into one of the schedule
+// windows.
+func audioInWindow(schedule []AudioWindowConfig, now time.Time) bool {
+	current := now.Hour()*60 + now.Minute()
+	for _, window := range schedule {
+		start, stop := minutesOfDay(window.Start), minutesOfDay(window.Stop)
+		if start < stop && current >= start && current < stop {
+			return true
+		}
+		if start > stop && (current >= start || current < stop) {
+			return true
+		}
+	}
+	return false
+}
+
+func runAudioUnitOperation(parent context.Context, operation dbusUnitOperation, unit string) error {
+	conn, err := getDBusConnection(parent)
+	if err != nil {
+		return fmt.Errorf("connect to D-Bus: %w", err)
+	}
+	defer conn.Close()
+	if _, err := runDBusUnitOperation(parent, conn, operation, unit); err != nil {
+		return fmt.Errorf("%s %s: %w", operation, unit, err)
+	}
+	return nil
+}
+
+func isAudioPlaybackActive(parent context.Context) bool {
+	conn, err := getDBusConnection(parent)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(parent, dbusTimeout())
+	defer cancel()
+	return isUnitActive(ctx, conn, audioPlaybackUnit)
+}
+
+// StartAudioPlayback starts the music. In AudioModeInsteadOfVideo it stops
+// video playback first and remembers to restart it.
+func StartAudioPlayback(ctx context.Context, config Config) error {
+	if !config.Audio.Playback.Enabled {
+		return errors.New("audio playback is disabled, set audio.playback.enabled")
+	}
+	audioLock.Lock()
+	defer audioLock.Unlock()
+
+	if audioMode(config.Audio.Playback) == AudioModeInsteadOfVideo && !audioStoppedVideo {
+		status, err := getServiceStatus(ctx)
+		if err == nil && status.PlaybackServiceStatus {
+			if err := runAudioUnitOperation(ctx, dbusUnitOperationStop, playbackServiceUnit); err != nil {
+				return err
+			}
+			audioStoppedVideo = true
+		}
+	}
+	if err := runAudioUnitOperation(ctx, dbusUnitOperationStart, audioPlaybackUnit); err != nil {
+		return err
+	}
+	metricSet(metricAudioPlaybackActive, 1)
+	log.Printf("Audio playback started (%s)", audioMode(config.Audio.Playback))
+	return nil
+}
+
+// StopAudioPlayback stops the music and restarts video stopped by
+// StartAudioPlayback.
+func StopAudioPlayback(ctx context.Context) error {
+	audioLock.Lock()
+	defer audioLock.Unlock()
+
+	if err := runAudioUnitOperation(ctx, dbusUnitOperationStop, audioPlaybackUnit); err != nil {
+		return err
+	}
+	metricSet(metricAudioPlaybackActive, 0)
+	if audioStoppedVideo {
+		audioStoppedVideo = false
+		if err := startPlaybackService(ctx); err != nil {
+			return fmt.Errorf("restart video playback: %w", err)
+		}
+	}
+	log.Println("Audio playback stopped")
+	return nil
+}
+
+// SetAudioVolume saves audio.playback.volume and applies it: through the
+// mpv IPC socket when configured, otherwise by rewriting play.audio.service
+// and restarting running music.
+func SetAudioVolume(ctx context.Context, volume int) error {
+	configMutex.Lock()
+	if currentConfig == nil {
+		configMutex.Unlock()
+		return fmt.Errorf("configuration not loaded")
+	}
+	previous := currentConfig.Audio.Playback.Volume
+	currentConfig.Audio.Playback.Volume = &volume
+	if err := validateAudioPlayback(currentConfig.Audio.Playback); err != nil {
+		currentConfig.Audio.Playback.Volume = previous
+		configMutex.Unlock()
+		return err
+	}
+	if err := saveCurrentConfig("audio"); err != nil {
+		currentConfig.Audio.Playback.Volume = previous
+		configMutex.Unlock()
+		return err
+	}
+	config := *currentConfig
+	configMutex.Unlock()
+
+	unit, err := renderAudioPlaybackUnit(config)
+	if err != nil {
+		return err
+	}
+	if err := writeSystemFile(filepath.Join(SystemdUnitDir, unit.Name), unit.Content); err != nil {
+		return fmt.Errorf("write %s: %w", unit.Name, err)
+	}
+	if err := reloadSystemd(ctx); err != nil {
+		return err
+	}
+	if socket := strings.TrimSpace(config.Audio.Playback.IPCSocket); socket != "" {
+		_, err := mpvCommand(ctx, socket, []any{"set_property", "volume", volume})
+		if err == nil {
+			log.Printf("Audio volume set to %d", volume)
+			return nil
+		}
+		log.Printf("Warning: audio player IPC unavailable: %v", err)
+	}
+	if isAudioPlaybackActive(ctx) {
+		if err := runAudioUnitOperation(ctx, dbusUnitOperationRestart, audioPlaybackUnit); err != nil {
+			return err
+		}
+	}
+	log.Printf("Audio volume set to %d", volume)
+	return nil
+}
+
+func reloadSystemd(parent context.Context) error {
+	conn, err := getDBusConnection(parent)
+	if err != nil {
+		return fmt.Errorf("connect to D-Bus: %w", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(parent, dbusTimeout())
+	defer cancel()
+	if err := conn.ReloadContext(ctx); err != nil {
+		return fmt.Errorf("daemon reload: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes content to path through a temporary file.
+func writeFileAtomic(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// reconcileAudioSchedule starts or stops the music to match the schedule,
+// e.g. after the agent started inside or outside a window.
+func reconcileAudioSchedule(ctx context.Context, config Config) {
+	playback := config.Audio.Playback
+	if !playback.Enabled || len(playback.Schedule) == 0 {
+		return
+	}
+	want := audioInWindow(playback.Schedule, audioNow())
+	if want == isAudioPlaybackActive(ctx) {
+		return
+	}
+	var err error
+	if want {
+		err = StartAudioPlayback(ctx, config)
+	} else {
+		err = StopAudioPlayback(ctx)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to apply audio schedule: %v", err)
+	}
+}
+
+// addAudioScheduleJobs adds the start and stop of every audio window to
+// cronScheduler. Callers hold cronSchedulerLock.
+func addAudioScheduleJobs(config Config) {
+	playback := config.Audio.Playback
+	if !playback.Enabled {
+		return
+	}
+	for _, window := range playback.Schedule {
+		for _, job := range []struct {
+			kind, time string
+			run        func(context.Context) error
+		}{
+			{"audio-start", window.Start, func(ctx context.Context) error { return StartAudioPlayback(ctx, GetCurrentConfig()) }},
+			{"audio-stop", window.Stop, StopAudioPlayback},
+		} {
+			job := job
+			hour, minute, err := parseHourMinute(job.time)
+			if err != nil {
+				log.Printf("Warning: Invalid audio schedule time format '%s', expected HH:MM", job.time)
+				continue
+			}
+			id, err := cronScheduler.AddFunc(fmt.Sprintf("%d %d * * *", minute, hour), func() {
+				log.Printf("Running scheduled %s at %s", job.kind, job.time)
+				if err := job.run(context.Background()); err != nil {
+					log.Printf("Failed to run scheduled %s: %v", job.kind, err)
+				}
+			})
+			if err != nil {
+				log.Printf("Warning: Failed to schedule %s at %s: %v", job.kind, job.time, err)
+				continue
+			}
+			cronJobs = append(cronJobs, cronJob{kind: job.kind, time: job.time, id: id})
+		}
+	}
+}
+
+func audioPlaybackStatus(ctx context.Context, config Config) AudioPlaybackStatus {
+	playback := config.Audio.Playback
+	status := AudioPlaybackStatus{
+		Enabled:  playback.Enabled,
+		Volume:   audioVolume(playback),
+		Mode:     audioMode(playback),
+		Playlist: audioPlaylistPath(config),
+		Schedule: playback.Schedule,
+	}
+	if playback.Enabled {
+		status.Active = isAudioPlaybackActive(ctx)
+	}
+	if len(playback.Schedule) > 0 {
+		inWindow := audioInWindow(playback.Schedule, audioNow())
+		status.InWindow = &inWindow
+	}
+	return status
+}
+
+// HandleAudioPlayback reports the background music channel (GET).
+func HandleAudioPlayback(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: audioPlaybackStatus(r.Context(), GetCurrentConfig())})
+}
+
+// HandleAudioPlaybackStart starts the music (POST).
+func HandleAudioPlaybackStart(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	config := GetCurrentConfig()
+	if !config.Audio.Playback.Enabled {
+		JSONResponse(w, http.StatusConflict, APIResponse{OK: false, ErrMsg: "Фоновая музыка не включена"})
+		return
+	}
+	if err := StartAudioPlayback(r.Context(), config); err != nil {
+		log.Printf("Failed to start audio playback: %v", err)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось запустить фоновую музыку: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: MenuActionResponse{
+			Action:  "audio-start",
+			Result:  "success",
+			Message: "Фоновая музыка запущена",
+		},
+	})
+}
+
+// HandleAudioPlaybackStop stops the music (POST).
+func HandleAudioPlaybackStop(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	if err := StopAudioPlayback(r.Context()); err != nil {
+		log.Printf("Failed to stop audio playback: %v", err)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось остановить фоновую музыку: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: MenuActionResponse{
+			Action:  "audio-stop",
+			Result:  "success",
+			Message: "Фоновая музыка остановлена",
+		},
+	})
+}
+
+// HandleAudioPlaybackVolume sets the music volume (POST).
+func HandleAudioPlaybackVolume(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req AudioVolumeRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&req); err != nil || req.Volume == nil || *req.Volume < 0 || *req.Volume > 100 {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Громкость должна быть числом от 0 до 100"})
+		return
+	}
+	if err := SetAudioVolume(r.Context(), *req.Volume); err != nil {
+		log.Printf("Failed to set audio volume: %v", err)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось изменить громкость: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: MenuActionResponse{
+			Action:  "audio-volume",
+			Result:  "success",
+			Message: fmt.Sprintf("Громкость фоновой музыки: %d", *req.Volume),
+		},
+	})
+}
+
+// syncAudioPlaylist downloads the audio playlist and saves it to
+// audio.playback.playlist. Running music is restarted to play it.
+func syncAudioPlaylist(ctx context.Context, config Config) error {
+	data, err := fetchPlaylist(ctx, config, config.CoreAPIBase+"/api/devicesync/playlist?type=audio")
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+	data = rewritePlaylistMediaPaths(expandPlaylistTemplate(data, config), config)
+	path := audioPlaylistPath(config)
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	if err := writeFileAtomic(path, string(data)); err != nil {
+		return fmt.Errorf("failed to write audio playlist: %w", err)
+	}
+	log.Printf("Audio playlist saved to %s", path)
+	if isAudioPlaybackActive(ctx) {
+		return runAudioUnitOperation(ctx, dbusUnitOperationRestart, audioPlaybackUnit)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupAudioPlaybackForTest(t *testing.T, active bool, playback AudioPlaybackConfig) (*playbackDBusConn, Config) {
+	t.Helper()
+	conn := &playbackDBusConn{active: active}
+	SetDBusConnectionFactory(func(ctx context.Context) (DBusConnection, error) { return conn, nil })
+	setSystemdUnitDirForTest(t)
+	t.Cleanup(func() {
+		SetDBusConnectionFactory(nil)
+		audioLock.Lock()
+		audioStoppedVideo = false
+		audioLock.Unlock()
+	})
+	playback.Enabled = true
+	config := Config{
+		ServerKey:          "key",
+		MediaPiServiceUser: "pi",
+		Playlist:           PlaylistConfig{Destination: t.TempDir()},
+		Audio:              AudioConfig{Output: "jack", Playback: playback},
+	}
+	setCurrentConfigForTest(t, config)
+	return conn, config
+}
+
+func TestValidateAudioPlayback(t *testing.T) {
+	volume := 120
+	for name, config := range map[string]AudioPlaybackConfig{
+		"volume":   {Volume: &volume},
+		"mode":     {Mode: "solo"},
+		"playlist": {Playlist: "../music.m3u"},
+		"time":     {Schedule: []AudioWindowConfig{{Start: "25:00", Stop: "10:00"}}},
+		"empty":    {Schedule: []AudioWindowConfig{{Start: "10:00", Stop: "10:00"}}},
+	} {
+		if err := validateAudioPlayback(config); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := validateAudioPlayback(AudioPlaybackConfig{Mode: AudioModeInsteadOfVideo, Playlist: "music/lobby.m3u", Schedule: []AudioWindowConfig{{Start: "22:00", Stop: "02:00"}}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAudioInWindow(t *testing.T) {
+	schedule := []AudioWindowConfig{{Start: "09:00", Stop: "12:30"}, {Start: "22:00", Stop: "01:00"}}
+	at := func(hour, minute int) time.Time { return time.Date(2026, 3, 1, hour, minute, 0, 0, time.Local) }
+	for _, tc := range []struct {
+		now  time.Time
+		want bool
+	}{
+		{at(8, 59), false},
+		{at(9, 0), true},
+		{at(12, 29), true},
+		{at(12, 30), false},
+		{at(23, 15), true},
+		{at(0, 30), true},
+		{at(1, 0), false},
+	} {
+		if got := audioInWindow(schedule, tc.now); got != tc.want {
+			t.Errorf("audioInWindow(%s) = %v, want %v", tc.now.Format("15:04"), got, tc.want)
+		}
+	}
+}
+
+func TestRenderAudioPlaybackUnit(t *testing.T) {
+	volume := 35
+	config := Config{
+		MediaPiServiceUser: "pi",
+		Playlist:           PlaylistConfig{Destination: "/var/media-pi/"},
+		Audio:              AudioConfig{Playback: AudioPlaybackConfig{Enabled: true, Volume: &volume, Playlist: "music/lobby.m3u"}},
+	}
+	units, err := RenderUnitFiles(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var audio *UnitFile
+	for i := range units {
+		if units[i].Name == audioPlaybackUnit {
+			audio = &units[i]
+		}
+	}
+	if audio == nil {
+		t.Fatalf("missing %s in %v", audioPlaybackUnit, units)
+	}
+	if want := "ExecStart=/usr/bin/mpv --no-video --no-terminal --loop-playlist=inf --volume=35 /var/media-pi/music/lobby.m3u\n"; !strings.Contains(audio.Content, want) || !strings.Contains(audio.Content, "User=pi\n") {
+		t.Fatalf("unexpected unit:\n%s", audio.Content)
+	}
+
+	config.Audio.Playback.Enabled = false
+	units, _ = RenderUnitFiles(config)
+	for _, unit := range units {
+		if unit.Name == audioPlaybackUnit {
+			t.Fatal("expected no audio unit while audio playback is disabled")
+		}
+	}
+}
+
+func TestAudioPlaybackInsteadOfVideo(t *testing.T) {
+	conn, config := setupAudioPlaybackForTest(t, true, AudioPlaybackConfig{Mode: AudioModeInsteadOfVideo})
+
+	if err := StartAudioPlayback(t.Context(), config); err != nil {
+		t.Fatal(err)
+	}
+	if metricValue(metricAudioPlaybackActive) != 1 {
+		t.Fatal("expected audio metric to be set")
+	}
+	if err := StopAudioPlayback(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"stop play.video.service", "start play.audio.service", "stop play.audio.service", "start play.video.service"}
+	if !reflect.DeepEqual(conn.operations(), want) {
+		t.Fatalf("operations = %v, want %v", conn.operations(), want)
+	}
+}
+
+func TestAudioPlaybackWithVideo(t *testing.T) {
+	conn, config := setupAudioPlaybackForTest(t, true, AudioPlaybackConfig{})
+
+	if err := StartAudioPlayback(t.Context(), config); err != nil {
+		t.Fatal(err)
+	}
+	if err := StopAudioPlayback(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"start play.audio.service", "stop play.audio.service"}; !reflect.DeepEqual(conn.operations(), want) {
+		t.Fatalf("operations = %v, want %v", conn.operations(), want)
+	}
+}
+
+func TestReconcileAudioSchedule(t *testing.T) {
+	conn, config := setupAudioPlaybackForTest(t, false, AudioPlaybackConfig{Schedule: []AudioWindowConfig{{Start: "09:00", Stop: "18:00"}}})
+	original := audioNow
+	audioNow = func() time.Time { return time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local) }
+	t.Cleanup(func() { audioNow = original })
+
+	reconcileAudioSchedule(t.Context(), config)
+	if want := []string{"start play.audio.service"}; !reflect.DeepEqual(conn.operations(), want) {
+		t.Fatalf("operations = %v, want %v", conn.operations(), want)
+	}
+
+	audioNow = func() time.Time { return time.Date(2026, 3, 1, 19, 0, 0, 0, time.Local) }
+	reconcileAudioSchedule(t.Context(), config)
+	if ops := conn.operations(); len(ops) != 1 {
+		t.Fatalf("inactive music outside the window needs no operation, got %v", ops)
+	}
+}
+
+func TestSetAudioVolume(t *testing.T) {
+	conn, _ := setupAudioPlaybackForTest(t, true, AudioPlaybackConfig{})
+	setConfigPathForTest(t, filepath.Join(t.TempDir(), "agent.yaml"))
+
+	if err := SetAudioVolume(t.Context(), 20); err != nil {
+		t.Fatal(err)
+	}
+	unit, err := os.ReadFile(filepath.Join(SystemdUnitDir, audioPlaybackUnit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(unit), "--volume=20 ") {
+		t.Fatalf("unexpected unit:\n%s", unit)
+	}
+	if volume := GetCurrentConfig().Audio.Playback.Volume; volume == nil || *volume != 20 {
+		t.Fatalf("expected volume to be saved, got %v", volume)
+	}
+	saved, err := os.ReadFile(ConfigPath)
+	if err != nil || !strings.Contains(string(saved), "volume: 20") {
+		t.Fatalf("expected saved config with the volume, got %s, %v", saved, err)
+	}
+	if want := []string{"restart play.audio.service"}; !reflect.DeepEqual(conn.operations(), want) {
+		t.Fatalf("operations = %v, want %v", conn.operations(), want)
+	}
+}
+
+func TestHandleAudioPlayback(t *testing.T) {
+	_, config := setupAudioPlaybackForTest(t, false, AudioPlaybackConfig{})
+
+	for _, body := range []string{`{}`, `{"volume":-1}`, `{"volume":101}`, `loud`} {
+		w := httptest.NewRecorder()
+		HandleAudioPlaybackVolume(w, httptest.NewRequest(http.MethodPost, "/api/audio/playback/volume", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	HandleAudioPlayback(w, httptest.NewRequest(http.MethodGet, "/api/audio/playback", nil))
+	if !strings.Contains(w.Body.String(), `"volume":70`) || !strings.Contains(w.Body.String(), `"mode":"with_video"`) {
+		t.Fatalf("unexpected status: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	HandleAudioPlaybackStart(w, httptest.NewRequest(http.MethodPost, "/api/audio/playback/start", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	config.Audio.Playback.Enabled = false
+	setCurrentConfigForTest(t, config)
+	w = httptest.NewRecorder()
+	HandleAudioPlaybackStart(w, httptest.NewRequest(http.MethodPost, "/api/audio/playback/start", nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 when disabled, got %d", w.Code)
+	}
+}
+
+func TestPerformPlaylistSyncDownloadsAudioPlaylist(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("type") == "audio" {
+			_, _ = w.Write([]byte("music/one.mp3\nmusic/two.ogg\n"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	_, config := setupAudioPlaybackForTest(t, false, AudioPlaybackConfig{})
+	config.CoreAPIBase = server.URL
+	setCurrentConfigForTest(t, config)
+
+	if err := PerformPlaylistSync(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(config.Playlist.Destination, DefaultAudioPlaylist))
+	if err != nil || string(content) != "music/one.mp3\nmusic/two.ogg\n" {
+		t.Fatalf("audio playlist = %q, %v", content, err)
+	}
+}
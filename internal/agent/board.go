@@ -0,0 +1,133 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Board models recognized by detectBoard.
+const (
+	BoardPi5     = "pi5"
+	BoardPi4     = "pi4"
+	BoardPi3     = "pi3"
+	BoardZero2   = "zero2"
+	BoardUnknown = "unknown"
+)
+
+// BoardModelPath holds the device tree model string. Tests may override it.
+var BoardModelPath = "/sys/firmware/devicetree/base/model"
+
+// BoardInfo identifies the hardware and the build of the agent binary. It
+// is reported in /health.
+type BoardInfo struct {
+	// Board is one of the Board* constants.
+	Board string `json:"board"`
+	// Model is the model string of the device tree or /proc/cpuinfo.
+	Model string `json:"model,omitempty"`
+	// Arch is the architecture the binary was built for, e.g. arm64 or
+	// armv7.
+	Arch string `json:"arch"`
+	// ParallelDownloads, VerifyWorkers and PlayerFlags are the defaults
+	// selected for the board.
+	ParallelDownloads int    `json:"parallelDownloads"`
+	VerifyWorkers     int    `json:"verifyWorkers,omitempty"`
+	PlayerFlags       string `json:"playerFlags,omitempty"`
+}
+
+// boardDefaults are used when max_parallel_downloads, sync.verify_workers
+// or player.command are not set. The Zero 2 and the Pi 3 have 512 MB and
+// 1 GB of memory, so they download and hash less at once and give the
+// player a larger cache.
+var boardDefaults = map[string]BoardInfo{
+	BoardPi5:     {ParallelDownloads: 4},
+	BoardPi4:     {ParallelDownloads: 3},
+	BoardPi3:     {ParallelDownloads: 2, VerifyWorkers: 2, PlayerFlags: "--file-caching=2000"},
+	BoardZero2:   {ParallelDownloads: 1, VerifyWorkers: 1, PlayerFlags: "--file-caching=3000"},
+	BoardUnknown: {ParallelDownloads: 3},
+}
+
+// boardModels maps prefixes of the model string to boards.
+var boardModels = []struct {
+	prefix string
+	board  string
+}{
+	{"Raspberry Pi 5", BoardPi5},
+	{"Raspberry Pi Compute Module 5", BoardPi5},
+	{"Raspberry Pi 500", BoardPi5},
+	{"Raspberry Pi 4", BoardPi4},
+	{"Raspberry Pi 400", BoardPi4},
+	{"Raspberry Pi Compute Module 4", BoardPi4},
+	{"Raspberry Pi Zero 2", BoardZero2},
+	{"Raspberry Pi 3", BoardPi3},
+	{"Raspberry Pi Compute Module 3", BoardPi3},
+}
+
+// detectedBoard runs the detection once. Tests may override it.
+var detectedBoard = sync.OnceValue(detectBoard)
+
+// currentBoard returns the board the agent runs on.
+func currentBoard() BoardInfo {
+	return detectedBoard()
+}
+
+func detectBoard() BoardInfo {
+	model := readBoardModel()
+	board := BoardUnknown
+	for _, m := range boardModels {
+		if strings.HasPrefix(model, m.prefix) {
+			board = m.board
+			break
+		}
+	}
+	info := boardDefaults[board]
+	info.Board = board
+	info.Model = model
+	info.Arch = binaryArch()
+	return info
+}
+
+// readBoardModel returns the device tree model, or the Model line of
+// /proc/cpuinfo.
+func readBoardModel() string {
+	if data, err := os.ReadFile(BoardModelPath); err == nil {
+		if model := strings.Trim(string(data), "\x00 \n"); model != "" {
+			return model
+		}
+	}
+	file, err := os.Open(CPUInfoPath)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = file.Close() }()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "Model" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// binaryArch returns GOARCH, with the GOARM version for 32-bit ARM builds
+// (armv6, armv7).
+func binaryArch() string {
+	if runtime.GOARCH != "arm" {
+		return runtime.GOARCH
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "GOARM" {
+				return "armv" + strings.SplitN(setting.Value, ",", 2)[0]
+			}
+		}
+	}
+	return runtime.GOARCH
+}
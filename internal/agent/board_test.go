@@ -0,0 +1,78 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDetectBoard(t *testing.T) {
+	dir := t.TempDir()
+	originalModel, originalCPUInfo := BoardModelPath, CPUInfoPath
+	BoardModelPath, CPUInfoPath = filepath.Join(dir, "model"), filepath.Join(dir, "cpuinfo")
+	t.Cleanup(func() { BoardModelPath, CPUInfoPath = originalModel, originalCPUInfo })
+
+	for model, want := range map[string]string{
+		"Raspberry Pi 5 Model B Rev 1.0\x00":           BoardPi5,
+		"Raspberry Pi 4 Model B Rev 1.4\x00":           BoardPi4,
+		"Raspberry Pi Compute Module 4 Rev 1.0\x00":    BoardPi4,
+		"Raspberry Pi 3 Model B Plus Rev 1.3\x00":      BoardPi3,
+		"Raspberry Pi Zero 2 W Rev 1.0\x00":            BoardZero2,
+		"Raspberry Pi Zero W Rev 1.1\x00":              BoardUnknown,
+		"Generic x86/64 compatible machine (QEMU)\x00": BoardUnknown,
+	} {
+		if err := os.WriteFile(BoardModelPath, []byte(model), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := detectBoard(); got.Board != want || got.ParallelDownloads == 0 {
+			t.Errorf("detectBoard(%q) = %+v, want %s", model, got, want)
+		}
+	}
+
+	if err := os.Remove(BoardModelPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(CPUInfoPath, []byte("Hardware\t: BCM2835\nModel\t\t: Raspberry Pi Zero 2 W Rev 1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got := detectBoard()
+	if got.Board != BoardZero2 || got.Model != "Raspberry Pi Zero 2 W Rev 1.0" || got.Arch == "" {
+		t.Fatalf("detectBoard from cpuinfo = %+v", got)
+	}
+}
+
+func TestBoardDefaults(t *testing.T) {
+	original := detectedBoard
+	t.Cleanup(func() { detectedBoard = original })
+	detectedBoard = func() BoardInfo { return boardDefaults[BoardZero2] }
+
+	if got := playerCommand(Config{}); got != DefaultPlayerCommand+" --file-caching=3000" {
+		t.Fatalf("playerCommand = %q", got)
+	}
+	if got := playerCommand(Config{Player: PlayerConfig{Command: "/usr/bin/mpv"}}); got != "/usr/bin/mpv" {
+		t.Fatalf("player.command must win, got %q", got)
+	}
+	if got := verifyWorkers(SyncConfig{}); got != 1 {
+		t.Fatalf("verifyWorkers = %d, want the board default", got)
+	}
+	if got := verifyWorkers(SyncConfig{VerifyWorkers: runtime.NumCPU()}); got != runtime.NumCPU() {
+		t.Fatalf("sync.verify_workers must win, got %d", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	if err := os.WriteFile(path, []byte("server_key: key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setCurrentConfigForTest(t, Config{})
+	config, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MaxParallelDownloads != 1 {
+		t.Fatalf("max_parallel_downloads = %d, want the board default", config.MaxParallelDownloads)
+	}
+}
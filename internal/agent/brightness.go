@@ -0,0 +1,351 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// BrightnessConfig controls display brightness from an ambient light
+// sensor or a time of day schedule.
+type BrightnessConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Sensor is the I2C light sensor model; only "bh1750" is supported.
+	// Without a sensor the schedule is used.
+	Sensor     string `yaml:"sensor,omitempty"`
+	I2CBus     string `yaml:"i2c_bus,omitempty"`
+	I2CAddress int    `yaml:"i2c_address,omitempty"`
+	// LuxMin and LuxMax map ambient light onto the Min..Max range.
+	LuxMin float64 `yaml:"lux_min,omitempty"`
+	LuxMax float64 `yaml:"lux_max,omitempty"`
+	// Min and Max clamp the brightness in percent.
+	Min int `yaml:"min,omitempty"`
+	Max int `yaml:"max,omitempty"`
+	// Schedule sets brightness by time of day when there is no sensor or
+	// it cannot be read.
+	Schedule []BrightnessScheduleEntry `yaml:"schedule,omitempty"`
+	// BacklightPath is a /sys/class/backlight device; the first one found
+	// is used when empty.
+	BacklightPath string `yaml:"backlight_path,omitempty"`
+	// Command sets brightness on displays without a backlight device, for
+	// example "ddcutil setvcp 10 {percent}" for HDMI monitors.
+	Command  string        `yaml:"command,omitempty"`
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// BrightnessScheduleEntry sets Percent from Time (HH:MM) onwards.
+type BrightnessScheduleEntry struct {
+	Time    string `yaml:"time" json:"time"`
+	Percent int    `yaml:"percent" json:"percent"`
+}
+
+// BrightnessStatus reports the brightness last applied.
+type BrightnessStatus struct {
+	Percent   int      `json:"percent"`
+	Source    string   `json:"source"`
+	Lux       *float64 `json:"lux,omitempty"`
+	UpdatedAt string   `json:"updatedAt,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Defaults for display brightness control.
+const (
+	DefaultBrightnessI2CBus     = "/dev/i2c-1"
+	DefaultBrightnessI2CAddress = 0x23
+	DefaultBrightnessLuxMin     = 10
+	DefaultBrightnessLuxMax     = 1000
+	DefaultBrightnessMin        = 10
+	DefaultBrightnessMax        = 100
+	DefaultBrightnessInterval   = 30 * time.Second
+)
+
+const (
+	brightnessSensorBH1750 = "bh1750"
+	i2cSlaveIoctl          = 0x0703
+	// bh1750OneTimeHighRes starts a single 1 lx resolution measurement.
+	bh1750OneTimeHighRes = 0x20
+	bh1750MeasureTime    = 180 * time.Millisecond
+
+	metricBrightnessPercent = "media_pi_display_brightness_percent"
+	metricAmbientLux        = "media_pi_ambient_light_lux"
+)
+
+func init() {
+	registerGauge(metricBrightnessPercent, "Display brightness last applied, in percent.")
+	registerGauge(metricAmbientLux, "Ambient light measured by the light sensor.")
+}
+
+var (
+	// BacklightRoot holds backlight devices. Tests may override it.
+	BacklightRoot = "/sys/class/backlight"
+
+	// readAmbientLux reads the configured light sensor. Tests may override it.
+	readAmbientLux = readBH1750
+
+	runBrightnessCommand = func(ctx context.Context, command string) error {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return nil
+		}
+		out, err := exec.CommandContext(ctx, fields[0], fields[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %w: %s", command, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	brightnessLock   sync.Mutex
+	brightnessCancel context.CancelFunc
+	brightnessState  *BrightnessStatus
+)
+
+// readBH1750 performs a one-time measurement on a BH1750 sensor.
+func readBH1750(config BrightnessConfig) (float64, error) {
+	bus := config.I2CBus
+	if bus == "" {
+		bus = DefaultBrightnessI2CBus
+	}
+	address := config.I2CAddress
+	if address == 0 {
+		address = DefaultBrightnessI2CAddress
+	}
+
+	file, err := os.OpenFile(bus, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), i2cSlaveIoctl, uintptr(address)); errno != 0 {
+		return 0, fmt.Errorf("select i2c address 0x%02x: %w", address, errno)
+	}
+	if _, err := file.Write([]byte{bh1750OneTimeHighRes}); err != nil {
+		return 0, fmt.Errorf("start measurement: %w", err)
+	}
+	time.Sleep(bh1750MeasureTime)
+	var raw [2]byte
+	if _, err := file.Read(raw[:]); err != nil {
+		return 0, fmt.Errorf("read measurement: %w", err)
+	}
+	return float64(uint16(raw[0])<<8|uint16(raw[1])) / 1.2, nil
+}
+
+func brightnessClamps(config BrightnessConfig) (int, int) {
+	minPercent, maxPercent := config.Min, config.Max
+	if minPercent <= 0 {
+		minPercent = DefaultBrightnessMin
+	}
+	if maxPercent <= 0 || maxPercent > 100 {
+		maxPercent = DefaultBrightnessMax
+	}
+	if minPercent > maxPercent {
+		minPercent = maxPercent
+	}
+	return minPercent, maxPercent
+}
+
+func clampPercent(percent, minPercent, maxPercent int) int {
+	return max(minPercent, min(maxPercent, percent))
+}
+
+// percentForLux maps lux logarithmically onto the clamp range, matching
+// how the eye perceives brightness.
+func percentForLux(config BrightnessConfig, lux float64) int {
+	minPercent, maxPercent := brightnessClamps(config)
+	luxMin, luxMax := config.LuxMin, config.LuxMax
+	if luxMin <= 0 {
+		luxMin = DefaultBrightnessLuxMin
+	}
+	if luxMax <= luxMin {
+		luxMax = math.Max(DefaultBrightnessLuxMax, luxMin*10)
+	}
+	lux = math.Min(math.Max(lux, luxMin), luxMax)
+	fraction := math.Log(lux/luxMin) / math.Log(luxMax/luxMin)
+	return clampPercent(int(math.Round(float64(minPercent)+fraction*float64(maxPercent-minPercent))), minPercent, maxPercent)
+}
+
+// percentForSchedule returns the percent of the latest entry at or before
+// now, wrapping around midnight; ok is false without a valid schedule.
+func percentForSchedule(config BrightnessConfig, now time.Time) (int, bool) {
+	type entry struct{ minute, percent int }
+	var entries []entry
+	for _, e := range config.Schedule {
+		hour, minute, err := parseTimeValue(strings.TrimSpace(e.Time))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry{hour*60 + minute, e.Percent})
+	}
+	if len(entries) == 0 {
+		return 0, false
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].minute < entries[j].minute })
+
+	current := now.Hour()*60 + now.Minute()
+	selected := entries[len(entries)-1]
+	for _, e := range entries {
+		if e.minute <= current {
+			selected = e
+		}
+	}
+	minPercent, maxPercent := brightnessClamps(config)
+	return clampPercent(selected.percent, minPercent, maxPercent), true
+}
+
+// findBacklight returns the configured or first available backlight.
+func findBacklight(config BrightnessConfig) (string, error) {
+	if config.BacklightPath != "" {
+		return config.BacklightPath, nil
+	}
+	entries, err := os.ReadDir(BacklightRoot)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		return filepath.Join(BacklightRoot, entry.Name()), nil
+	}
+	return "", fmt.Errorf("no backlight device in %s", BacklightRoot)
+}
+
+// applyBrightness sets the display brightness in percent.
+func applyBrightness(ctx context.Context, config BrightnessConfig, percent int) error {
+	if command := strings.TrimSpace(config.Command); command != "" {
+		return runBrightnessCommand(ctx, strings.ReplaceAll(command, "{percent}", strconv.Itoa(percent)))
+	}
+	dir, err := findBacklight(config)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "max_brightness"))
+	if err != nil {
+		return err
+	}
+	maxValue, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("invalid max_brightness: %w", err)
+	}
+	value := int(math.Round(float64(maxValue) * float64(percent) / 100))
+	return os.WriteFile(filepath.Join(dir, "brightness"), []byte(strconv.Itoa(value)), 0644)
+}
+
+// adjustBrightness computes and applies the brightness for now; previous
+// is the last applied status, used to skip redundant writes.
+func adjustBrightness(ctx context.Context, config BrightnessConfig, now time.Time, previous *BrightnessStatus) *BrightnessStatus {
+	status := &BrightnessStatus{UpdatedAt: now.UTC().Format(time.RFC3339)}
+	var sensorErr error
+	percent, ok := 0, false
+	if config.Sensor != "" {
+		if config.Sensor != brightnessSensorBH1750 {
+			sensorErr = fmt.Errorf("unsupported light sensor %q", config.Sensor)
+		} else if lux, err := readAmbientLux(config); err != nil {
+			sensorErr = err
+		} else {
+			metricSet(metricAmbientLux, lux)
+			status.Lux = &lux
+			status.Source = "sensor"
+			percent, ok = percentForLux(config, lux), true
+		}
+	}
+	if !ok {
+		if percent, ok = activeProfileBrightness(GetCurrentConfig()); ok {
+			minPercent, maxPercent := brightnessClamps(config)
+			percent = clampPercent(percent, minPercent, maxPercent)
+			status.Source = "profile"
+		} else if percent, ok = percentForSchedule(config, now); ok {
+			status.Source = "schedule"
+		}
+	}
+	if sensorErr != nil {
+		status.Error = sensorErr.Error()
+	}
+	if !ok {
+		if previous != nil {
+			status.Percent = previous.Percent
+		}
+		status.Source = "none"
+		return status
+	}
+
+	status.Percent = percent
+	if previous != nil && previous.Percent == percent && previous.Error == "" {
+		return status
+	}
+	if err := applyBrightness(ctx, config, percent); err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	metricSet(metricBrightnessPercent, float64(percent))
+	return status
+}
+
+// StartBrightnessControl adjusts display brightness every
+// brightness.interval when brightness.enabled is set.
+func StartBrightnessControl() {
+	StopBrightnessControl()
+	config := GetCurrentConfig().Brightness
+	if !config.Enabled {
+		return
+	}
+	interval := config.Interval
+	if interval <= 0 {
+		interval = DefaultBrightnessInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	brightnessLock.Lock()
+	brightnessCancel = cancel
+	brightnessLock.Unlock()
+
+	go func() {
+		var previous *BrightnessStatus
+		for {
+			status := adjustBrightness(ctx, GetCurrentConfig().Brightness, time.Now(), previous)
+			if status.Error != "" && (previous == nil || previous.Error != status.Error) {
+				log.Printf("Warning: brightness control: %s", status.Error)
+			}
+			previous = status
+			brightnessLock.Lock()
+			brightnessState = status
+			brightnessLock.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// StopBrightnessControl stops the brightness control loop.
+func StopBrightnessControl() {
+	brightnessLock.Lock()
+	defer brightnessLock.Unlock()
+	if brightnessCancel != nil {
+		brightnessCancel()
+		brightnessCancel = nil
+	}
+	brightnessState = nil
+}
+
+func getBrightnessStatus() *BrightnessStatus {
+	brightnessLock.Lock()
+	defer brightnessLock.Unlock()
+	if brightnessState == nil {
+		return nil
+	}
+	status := *brightnessState
+	return &status
+}
@@ -0,0 +1,153 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupBacklightForTest(t *testing.T, maxBrightness string) string {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "rpi_backlight")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "max_brightness"), []byte(maxBrightness+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	original := BacklightRoot
+	BacklightRoot = root
+	t.Cleanup(func() { BacklightRoot = original })
+	return dir
+}
+
+func stubAmbientLux(t *testing.T, lux float64, err error) {
+	t.Helper()
+	original := readAmbientLux
+	readAmbientLux = func(BrightnessConfig) (float64, error) { return lux, err }
+	t.Cleanup(func() { readAmbientLux = original })
+}
+
+func TestPercentForLux(t *testing.T) {
+	config := BrightnessConfig{Min: 20, Max: 80, LuxMin: 10, LuxMax: 1000}
+	cases := map[float64]int{1: 20, 10: 20, 100: 50, 1000: 80, 50000: 80}
+	for lux, want := range cases {
+		if got := percentForLux(config, lux); got != want {
+			t.Errorf("percentForLux(%v) = %d, want %d", lux, got, want)
+		}
+	}
+}
+
+func TestPercentForSchedule(t *testing.T) {
+	config := BrightnessConfig{Min: 10, Schedule: []BrightnessScheduleEntry{
+		{Time: "22:00", Percent: 5},
+		{Time: "07:00", Percent: 100},
+		{Time: "bad", Percent: 50},
+	}}
+	day := time.Date(2026, 5, 1, 0, 0, 0, 0, time.Local)
+	if got, ok := percentForSchedule(config, day.Add(12*time.Hour)); !ok || got != 100 {
+		t.Errorf("noon brightness = %d, %v; want 100", got, ok)
+	}
+	// Clamped by Min, wraps around midnight.
+	if got, _ := percentForSchedule(config, day.Add(3*time.Hour)); got != 10 {
+		t.Errorf("night brightness = %d, want 10", got)
+	}
+	if _, ok := percentForSchedule(BrightnessConfig{}, day); ok {
+		t.Error("expected no brightness without schedule")
+	}
+}
+
+func TestAdjustBrightnessFromSensorWritesBacklight(t *testing.T) {
+	dir := setupBacklightForTest(t, "255")
+	stubAmbientLux(t, 1000, nil)
+
+	config := BrightnessConfig{Sensor: "bh1750", Min: 10, Max: 100}
+	status := adjustBrightness(context.Background(), config, time.Now(), nil)
+	if status.Error != "" || status.Percent != 100 || status.Source != "sensor" || status.Lux == nil {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "brightness"))
+	if err != nil || string(data) != "255" {
+		t.Fatalf("brightness = %q, %v; want 255", data, err)
+	}
+}
+
+func TestAdjustBrightnessFallsBackToSchedule(t *testing.T) {
+	setupBacklightForTest(t, "100")
+	stubAmbientLux(t, 0, errors.New("no sensor"))
+
+	var commands []string
+	original := runBrightnessCommand
+	runBrightnessCommand = func(ctx context.Context, command string) error {
+		commands = append(commands, command)
+		return nil
+	}
+	t.Cleanup(func() { runBrightnessCommand = original })
+
+	config := BrightnessConfig{
+		Sensor:   "bh1750",
+		Command:  "ddcutil setvcp 10 {percent}",
+		Schedule: []BrightnessScheduleEntry{{Time: "00:00", Percent: 40}},
+	}
+	status := adjustBrightness(context.Background(), config, time.Now(), nil)
+	if status.Percent != 40 || status.Source != "schedule" || status.Error == "" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	// An unchanged brightness is not applied again.
+	adjustBrightness(context.Background(), config, time.Now(), &BrightnessStatus{Percent: 40})
+	if len(commands) != 1 || commands[0] != "ddcutil setvcp 10 40" {
+		t.Fatalf("commands = %v", commands)
+	}
+}
+
+func TestAdjustBrightnessPrefersActiveProfile(t *testing.T) {
+	dir := setupBacklightForTest(t, "200")
+	now := time.Now()
+	setProfilesForTest(t, &now)
+	setCurrentConfigForTest(t, Config{Profiles: []ProfileConfig{{Name: "overnight", Brightness: intPtr(5)}}})
+	profileLock.Lock()
+	profileState.Active = "overnight"
+	profileLock.Unlock()
+
+	config := BrightnessConfig{Min: 10, Max: 100, Schedule: []BrightnessScheduleEntry{{Time: "00:00", Percent: 80}}}
+	status := adjustBrightness(context.Background(), config, now, nil)
+	if status.Percent != 10 || status.Source != "profile" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "brightness"))
+	if err != nil || string(data) != "20" {
+		t.Fatalf("brightness = %q, %v; want 20", data, err)
+	}
+}
+
+func TestHandleSystemStatus(t *testing.T) {
+	brightnessLock.Lock()
+	brightnessState = &BrightnessStatus{Percent: 55, Source: "schedule"}
+	brightnessLock.Unlock()
+	t.Cleanup(StopBrightnessControl)
+
+	w := httptest.NewRecorder()
+	HandleSystemStatus(w, httptest.NewRequest(http.MethodGet, "/api/system/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp struct {
+		Data SystemStatusResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Brightness == nil || resp.Data.Brightness.Percent != 55 {
+		t.Fatalf("unexpected brightness: %+v", resp.Data.Brightness)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Commit and BuildDate can be set at build time with -ldflags, like Version.
+var (
+	Commit    = ""
+	BuildDate = ""
+)
+
+// BuildInfo describes the running binary, returned by /api/system/version.
+type BuildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit,omitempty"`
+	BuildDate string   `json:"buildDate,omitempty"`
+	GoVersion string   `json:"goVersion"`
+	Platform  string   `json:"platform"`
+	BuildTags []string `json:"buildTags"`
+}
+
+// readBuildInfo is replaced in tests.
+var readBuildInfo = debug.ReadBuildInfo
+
+// getBuildInfo collects the build information. Commit and build date fall
+// back to the VCS stamp embedded by the Go toolchain when they are not set
+// with -ldflags.
+func getBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   GetVersion(),
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		BuildTags: []string{},
+	}
+	build, ok := readBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "-tags":
+			for _, tag := range strings.Split(setting.Value, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					info.BuildTags = append(info.BuildTags, tag)
+				}
+			}
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "" {
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+// HandleSystemVersion returns the build information of the agent.
+func HandleSystemVersion(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getBuildInfo()})
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestGetBuildInfo(t *testing.T) {
+	originalRead, originalCommit, originalDate := readBuildInfo, Commit, BuildDate
+	t.Cleanup(func() { readBuildInfo, Commit, BuildDate = originalRead, originalCommit, originalDate })
+
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{Settings: []debug.BuildSetting{
+			{Key: "-tags", Value: "netgo, osusergo"},
+			{Key: "vcs.revision", Value: "abc123"},
+			{Key: "vcs.time", Value: "2026-10-01T10:00:00Z"},
+		}}, true
+	}
+
+	Commit, BuildDate = "", ""
+	info := getBuildInfo()
+	if info.Commit != "abc123" || info.BuildDate != "2026-10-01T10:00:00Z" {
+		t.Fatalf("unexpected VCS fallback: %+v", info)
+	}
+	if !reflect.DeepEqual(info.BuildTags, []string{"netgo", "osusergo"}) {
+		t.Fatalf("BuildTags = %v", info.BuildTags)
+	}
+	if info.GoVersion != runtime.Version() || info.Platform != runtime.GOOS+"/"+runtime.GOARCH {
+		t.Fatalf("unexpected runtime info: %+v", info)
+	}
+
+	Commit, BuildDate = "def456", "2026-10-02"
+	info = getBuildInfo()
+	if info.Commit != "def456" || info.BuildDate != "2026-10-02" {
+		t.Fatalf("ldflags values must take precedence: %+v", info)
+	}
+}
+
+func TestHandleSystemVersion(t *testing.T) {
+	w := httptest.NewRecorder()
+	HandleSystemVersion(w, httptest.NewRequest(http.MethodGet, "/api/system/version", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var resp struct {
+		OK   bool      `json:"ok"`
+		Data BuildInfo `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.OK || resp.Data.GoVersion == "" || resp.Data.BuildTags == nil {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	HandleSystemVersion(w, httptest.NewRequest(http.MethodPost, "/api/system/version", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST status = %d", w.Code)
+	}
+}
@@ -0,0 +1,498 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCalendarLookahead is how long before a calendar slot starts its
+// playlist and media files are checked, so gaps reach the core while there
+// is still time to sync them.
+const DefaultCalendarLookahead = 30 * time.Minute
+
+// maxCalendarSlots bounds the calendar document.
+const maxCalendarSlots = 96
+
+// Kinds of calendar entries in the sync scheduler.
+const (
+	scheduleKindCalendar      = "calendar"
+	scheduleKindCalendarCheck = "calendar-check"
+)
+
+var (
+	// calendarStateFilePath persists the calendar across restarts.
+	calendarStateFilePath = filepath.Join(agentStateDir, "calendar.json")
+
+	calendarLock sync.Mutex
+	calendar     CalendarState
+
+	// calendarNow is the clock of the calendar. Tests may override it.
+	calendarNow = time.Now
+
+	// restartAfterCalendarSwitch restarts playback so a new slot takes
+	// effect. Tests may override it.
+	restartAfterCalendarSwitch = func(ctx context.Context) error {
+		return RestartVideoPlayServiceWithLogs(ctx, "calendar slot change")
+	}
+)
+
+// Calendar is the content calendar published by the core. Every slot plays
+// its playlist from Start until the next slot starts, the last slot of the
+// day until the first one of the next day.
+type Calendar struct {
+	Slots []CalendarSlot `json:"slots"`
+}
+
+// CalendarSlot switches playback to the core playlist Playlist at Start
+// (HH:MM).
+type CalendarSlot struct {
+	Start    string `json:"start"`
+	Playlist string `json:"playlist"`
+}
+
+// CalendarGap is a slot that cannot play as planned: its playlist was not
+// downloaded or references media files missing on the device.
+type CalendarGap struct {
+	Start           string   `json:"start"`
+	Playlist        string   `json:"playlist"`
+	PlaylistMissing bool     `json:"playlistMissing,omitempty"`
+	Missing         []string `json:"missing,omitempty"`
+	CheckedAt       string   `json:"checkedAt"`
+}
+
+// CalendarState is the calendar in use, returned by GET /api/calendar.
+type CalendarState struct {
+	Slots []CalendarSlot `json:"slots"`
+	// Active is the playlist of the slot playing now.
+	Active string `json:"active,omitempty"`
+	// Gaps are the findings of the last check of every slot.
+	Gaps []CalendarGap `json:"gaps,omitempty"`
+}
+
+// validateCalendar checks a calendar received from the core and sorts its
+// slots by start.
+func validateCalendar(cal *Calendar) error {
+	if len(cal.Slots) > maxCalendarSlots {
+		return fmt.Errorf("more than %d calendar slots", maxCalendarSlots)
+	}
+	starts := map[int]bool{}
+	for i, slot := range cal.Slots {
+		if _, _, err := parseTimeValue(slot.Start); err != nil {
+			return fmt.Errorf("slot %d: invalid start %q", i, slot.Start)
+		}
+		if !validCalendarPlaylist(slot.Playlist) {
+			return fmt.Errorf("slot %d: invalid playlist name %q", i, slot.Playlist)
+		}
+		if starts[minutesOfDay(slot.Start)] {
+			return fmt.Errorf("slot %d: another slot starts at %s", i, slot.Start)
+		}
+		starts[minutesOfDay(slot.Start)] = true
+	}
+	sort.Slice(cal.Slots, func(i, j int) bool {
+		return minutesOfDay(cal.Slots[i].Start) < minutesOfDay(cal.Slots[j].Start)
+	})
+	return nil
+}
+
+// validCalendarPlaylist reports whether name can be stored as a file name.
+func validCalendarPlaylist(name string) bool {
+	if name == "" || len(name) > 64 || strings.HasPrefix(name, ".") {
+		return false
+	}
+	return !strings.ContainsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	})
+}
+
+// calendarPlaylistPath is the local copy of a calendar playlist. It sits
+// next to playlist.m3u so relative entries resolve the same way.
+func calendarPlaylistPath(config Config, name string) string {
+	return filepath.Join(strings.TrimRight(config.Playlist.Destination, "/"), "calendar-"+name+".m3u")
+}
+
+// storedCalendarPlaylists lists the calendar playlists stored next to
+// playlist.m3u by file name, so garbage collection keeps them even before
+// the calendar is loaded after a restart.
+func storedCalendarPlaylists(config Config) []string {
+	dir := strings.TrimRight(config.Playlist.Destination, "/")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, entry := range entries {
+		name, prefixed := strings.CutPrefix(entry.Name(), "calendar-")
+		name, suffixed := strings.CutSuffix(name, ".m3u")
+		if prefixed && suffixed && !entry.IsDir() && validCalendarPlaylist(name) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files
+}
+
+// activeCalendarSlot returns the slot playing at now; slots are sorted.
+func activeCalendarSlot(slots []CalendarSlot, now time.Time) (CalendarSlot, bool) {
+	if len(slots) == 0 {
+		return CalendarSlot{}, false
+	}
+	current := now.Hour()*60 + now.Minute()
+	active := slots[len(slots)-1]
+	for _, slot := range slots {
+		if minutesOfDay(slot.Start) > current {
+			break
+		}
+		active = slot
+	}
+	return active, true
+}
+
+func getCalendarState() CalendarState {
+	calendarLock.Lock()
+	defer calendarLock.Unlock()
+	state := calendar
+	state.Slots = append([]CalendarSlot(nil), calendar.Slots...)
+	state.Gaps = append([]CalendarGap(nil), calendar.Gaps...)
+	return state
+}
+
+// setCalendarSlots stores slots and reports whether they changed. Gaps of
+// slots no longer in the calendar are dropped.
+func setCalendarSlots(slots []CalendarSlot) (bool, error) {
+	calendarLock.Lock()
+	defer calendarLock.Unlock()
+
+	previous, _ := json.Marshal(calendar.Slots)
+	next, _ := json.Marshal(slots)
+	if bytes.Equal(previous, next) {
+		return false, nil
+	}
+	state := CalendarState{Slots: slots, Active: calendar.Active}
+	for _, gap := range calendar.Gaps {
+		for _, slot := range slots {
+			if slot.Start == gap.Start && slot.Playlist == gap.Playlist {
+				state.Gaps = append(state.Gaps, gap)
+				break
+			}
+		}
+	}
+	if err := writeStateFile(calendarStateFilePath, state); err != nil {
+		return false, err
+	}
+	calendar = state
+	return true, nil
+}
+
+// updateCalendarState changes the calendar state with update and persists
+// it.
+func updateCalendarState(update func(*CalendarState)) {
+	calendarLock.Lock()
+	defer calendarLock.Unlock()
+	update(&calendar)
+	if err := writeStateFile(calendarStateFilePath, calendar); err != nil {
+		log.Printf("Warning: failed to save calendar state: %v", err)
+	}
+}
+
+// RestoreCalendar restores the calendar persisted by a previous run.
+func RestoreCalendar() {
+	var state CalendarState
+	if err := readStateFile(calendarStateFilePath, &state); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: ignoring calendar state: %v", err)
+		}
+		return
+	}
+	calendarLock.Lock()
+	calendar = state
+	calendarLock.Unlock()
+	if len(state.Slots) > 0 {
+		log.Printf("Restored content calendar with %d slots", len(state.Slots))
+	}
+}
+
+// fetchCalendar downloads the calendar. It returns nil without an error
+// when the core has no calendar for the device (HTTP 204, or 404 from a
+// core without calendars).
+func fetchCalendar(ctx context.Context, config Config) (*Calendar, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.CoreAPIBase+"/api/devicesync/calendar", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Device-Id", config.ServerKey)
+
+	resp, err := getCoreClient().Do(ctx, req, playlistTimeout())
+	if err != nil {
+		return nil, fmt.Errorf("failed to download calendar: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent, http.StatusNotFound:
+		return nil, nil
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+	var cal Calendar
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&cal); err != nil {
+		return nil, fmt.Errorf("failed to decode calendar: %w", err)
+	}
+	if err := validateCalendar(&cal); err != nil {
+		return nil, fmt.Errorf("invalid calendar: %w", err)
+	}
+	return &cal, nil
+}
+
+// syncCalendar downloads the calendar and the playlists of its slots. A
+// changed calendar reloads the scheduler; the slot playing now is applied
+// to playlist.m3u, which the caller restarts playback for.
+func syncCalendar(ctx context.Context, config Config) error {
+	cal, err := fetchCalendar(ctx, config)
+	if err != nil {
+		return err
+	}
+	var slots []CalendarSlot
+	if cal != nil {
+		slots = cal.Slots
+	}
+	downloaded := map[string]bool{}
+	for _, slot := range slots {
+		if downloaded[slot.Playlist] {
+			continue
+		}
+		downloaded[slot.Playlist] = true
+		data, err := fetchPlaylist(ctx, config, config.CoreAPIBase+"/api/devicesync/playlist?name="+url.QueryEscape(slot.Playlist))
+		if err != nil {
+			return fmt.Errorf("playlist %s: %w", slot.Playlist, err)
+		}
+		if data == nil {
+			log.Printf("Warning: core has no calendar playlist %s", slot.Playlist)
+			continue
+		}
+		data = rewritePlaylistMediaPaths(expandPlaylistTemplate(data, config), config)
+		if err := writeFileAtomic(calendarPlaylistPath(config, slot.Playlist), string(data)); err != nil {
+			return fmt.Errorf("failed to write calendar playlist %s: %w", slot.Playlist, err)
+		}
+	}
+
+	changed, err := setCalendarSlots(slots)
+	if err != nil {
+		return fmt.Errorf("failed to save calendar: %w", err)
+	}
+	if changed {
+		log.Printf("Content calendar updated: %d slots", len(slots))
+		SignalSchedulerReload()
+	}
+	if len(slots) > 0 {
+		if _, err := applyCalendarSlot(config, calendarNow()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyCalendarSlot copies the playlist of the slot playing at now to
+// playlist.m3u and reports whether playlist.m3u changed.
+func applyCalendarSlot(config Config, now time.Time) (bool, error) {
+	slot, ok := activeCalendarSlot(getCalendarState().Slots, now)
+	if !ok || config.Playlist.Destination == "" {
+		return false, nil
+	}
+	data, err := os.ReadFile(calendarPlaylistPath(config, slot.Playlist))
+	if err != nil {
+		return false, fmt.Errorf("calendar playlist %s: %w", slot.Playlist, err)
+	}
+	destPath := displayPlaylistPath(config, DisplayOutputConfig{})
+	updateCalendarState(func(state *CalendarState) { state.Active = slot.Playlist })
+	if current, err := os.ReadFile(destPath); err == nil && bytes.Equal(current, data) {
+		return false, nil
+	}
+	if err := writeFileAtomic(destPath, string(data)); err != nil {
+		return false, fmt.Errorf("failed to write playlist: %w", err)
+	}
+	log.Printf("Calendar slot %s: playing %s", slot.Start, slot.Playlist)
+	writeSlideshowConfigs(config)
+	return true, nil
+}
+
+// switchCalendarSlot applies the slot playing now and restarts playback
+// if the playlist changed.
+func switchCalendarSlot(ctx context.Context, config Config) error {
+	changed, err := applyCalendarSlot(config, calendarNow())
+	if err != nil || !changed {
+		return err
+	}
+	return restartAfterCalendarSwitch(ctx)
+}
+
+// calendarPlaylistFiles lists the media files a playlist references,
+// resolving relative entries against the playlist directory like the
+// players do. Streams are skipped.
+func calendarPlaylistFiles(data []byte, playlistPath string) []string {
+	var files []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") || strings.Contains(entry, "://") {
+			continue
+		}
+		path := filepath.FromSlash(entry)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(playlistPath), path)
+		}
+		files = append(files, path)
+	}
+	return files
+}
+
+// checkCalendarSlot verifies that the playlist of slot and the media files
+// it references are on the device. It returns nil when nothing is missing.
+func checkCalendarSlot(config Config, slot CalendarSlot, now time.Time) *CalendarGap {
+	gap := &CalendarGap{Start: slot.Start, Playlist: slot.Playlist, CheckedAt: now.UTC().Format(time.RFC3339)}
+	path := calendarPlaylistPath(config, slot.Playlist)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		gap.PlaylistMissing = true
+		return gap
+	}
+	for _, file := range calendarPlaylistFiles(data, path) {
+		if _, err := os.Stat(file); err != nil {
+			gap.Missing = append(gap.Missing, file)
+		}
+	}
+	if len(gap.Missing) == 0 {
+		return nil
+	}
+	return gap
+}
+
+// checkUpcomingCalendarSlot checks slot ahead of its start, records the
+// result and reports a gap to the core.
+func checkUpcomingCalendarSlot(config Config, slot CalendarSlot) {
+	gap := checkCalendarSlot(config, slot, calendarNow())
+	updateCalendarState(func(state *CalendarState) {
+		gaps := state.Gaps[:0]
+		for _, existing := range state.Gaps {
+			if existing.Start != slot.Start {
+				gaps = append(gaps, existing)
+			}
+		}
+		if gap != nil {
+			gaps = append(gaps, *gap)
+		}
+		state.Gaps = gaps
+	})
+	if gap == nil {
+		log.Printf("Calendar slot %s (%s) is ready", slot.Start, slot.Playlist)
+		return
+	}
+	log.Printf("Warning: calendar slot %s (%s) has gaps: playlist missing %t, %d media files missing",
+		slot.Start, slot.Playlist, gap.PlaylistMissing, len(gap.Missing))
+	if config.CoreAPIBase == "" || config.ServerKey == "" {
+		return
+	}
+	go postCalendarGap(config, gap)
+}
+
+// postCalendarGap delivers a gap to the core. Tests may override it.
+var postCalendarGap = func(config Config, gap *CalendarGap) {
+	ctx, cancel := context.WithTimeout(context.Background(), playlistTimeout())
+	defer cancel()
+	if err := sendCalendarGap(ctx, config, gap); err != nil {
+		log.Printf("Warning: failed to report calendar gap: %v", err)
+	}
+}
+
+// sendCalendarGap posts gap to the core.
+func sendCalendarGap(ctx context.Context, config Config, gap *CalendarGap) error {
+	body, err := json.Marshal(gap)
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimRight(config.CoreAPIBase, "/") + "/api/devicesync/calendar-gaps"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Device-Id", config.ServerKey)
+
+	resp, err := getCoreClient().Do(ctx, req, playlistTimeout())
+	if err != nil {
+		return fmt.Errorf("post calendar gap: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// addCalendarJobs adds the switch of every calendar slot and its check
+// DefaultCalendarLookahead earlier to cronScheduler. Callers hold
+// cronSchedulerLock.
+func addCalendarJobs(config Config) {
+	if config.Playlist.Destination == "" {
+		return
+	}
+	lookahead := int(DefaultCalendarLookahead / time.Minute)
+	for _, slot := range getCalendarState().Slots {
+		slot := slot
+		start := minutesOfDay(slot.Start)
+		check := (start - lookahead + 24*60) % (24 * 60)
+		for _, job := range []struct {
+			kind    string
+			minutes int
+			run     func()
+		}{
+			{scheduleKindCalendarCheck, check, func() { checkUpcomingCalendarSlot(GetCurrentConfig(), slot) }},
+			{scheduleKindCalendar, start, func() {
+				if err := switchCalendarSlot(context.Background(), GetCurrentConfig()); err != nil {
+					log.Printf("Failed to switch to calendar slot %s: %v", slot.Start, err)
+				}
+			}},
+		} {
+			id, err := cronScheduler.AddFunc(fmt.Sprintf("%d %d * * *", job.minutes%60, job.minutes/60), job.run)
+			if err != nil {
+				log.Printf("Warning: Failed to schedule %s at %s: %v", job.kind, slot.Start, err)
+				continue
+			}
+			cronJobs = append(cronJobs, cronJob{kind: job.kind, time: fmt.Sprintf("%02d:%02d", job.minutes/60, job.minutes%60), id: id})
+		}
+	}
+}
+
+// reconcileCalendar applies the slot playing now, e.g. after the agent
+// started in the middle of a slot.
+func reconcileCalendar(ctx context.Context, config Config) {
+	if err := switchCalendarSlot(ctx, config); err != nil {
+		log.Printf("Warning: failed to apply content calendar: %v", err)
+	}
+}
+
+// HandleCalendar reports the content calendar (GET).
+func HandleCalendar(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getCalendarState()})
+}
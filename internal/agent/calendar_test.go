@@ -0,0 +1,192 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func setupCalendarForTest(t *testing.T, now time.Time) *int {
+	t.Helper()
+	originalPath, originalNow, originalRestart, originalPost := calendarStateFilePath, calendarNow, restartAfterCalendarSwitch, postCalendarGap
+	calendarStateFilePath = filepath.Join(t.TempDir(), "calendar.json")
+	calendarNow = func() time.Time { return now }
+	restarts := 0
+	restartAfterCalendarSwitch = func(ctx context.Context) error {
+		restarts++
+		return nil
+	}
+	t.Cleanup(func() {
+		calendarStateFilePath, calendarNow, restartAfterCalendarSwitch, postCalendarGap = originalPath, originalNow, originalRestart, originalPost
+		calendarLock.Lock()
+		calendar = CalendarState{}
+		calendarLock.Unlock()
+	})
+	return &restarts
+}
+
+func TestValidateCalendar(t *testing.T) {
+	cal := Calendar{Slots: []CalendarSlot{{Start: "18:00", Playlist: "evening"}, {Start: "06:30", Playlist: "morning"}}}
+	if err := validateCalendar(&cal); err != nil {
+		t.Fatal(err)
+	}
+	if cal.Slots[0].Playlist != "morning" {
+		t.Fatalf("slots must be sorted by start: %+v", cal.Slots)
+	}
+	for _, slots := range [][]CalendarSlot{
+		{{Start: "25:00", Playlist: "late"}},
+		{{Start: "06:00", Playlist: "../escape"}},
+		{{Start: "06:00", Playlist: ""}},
+		{{Start: "06:00", Playlist: "a"}, {Start: "6:00", Playlist: "b"}},
+	} {
+		if err := validateCalendar(&Calendar{Slots: slots}); err == nil {
+			t.Errorf("expected an error for %+v", slots)
+		}
+	}
+}
+
+func TestActiveCalendarSlot(t *testing.T) {
+	slots := []CalendarSlot{{Start: "06:00", Playlist: "morning"}, {Start: "12:00", Playlist: "lunch"}, {Start: "18:00", Playlist: "evening"}}
+	for clock, want := range map[string]string{"05:59": "evening", "06:00": "morning", "11:59": "morning", "12:30": "lunch", "23:00": "evening"} {
+		hour, minute, _ := parseTimeValue(clock)
+		slot, ok := activeCalendarSlot(slots, time.Date(2026, 3, 2, hour, minute, 0, 0, time.Local))
+		if !ok || slot.Playlist != want {
+			t.Errorf("%s: got %q, want %q", clock, slot.Playlist, want)
+		}
+	}
+	if _, ok := activeCalendarSlot(nil, time.Now()); ok {
+		t.Error("an empty calendar has no active slot")
+	}
+}
+
+func TestPerformPlaylistSyncFollowsCalendar(t *testing.T) {
+	restarts := setupCalendarForTest(t, time.Date(2026, 3, 2, 13, 0, 0, 0, time.Local))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/devicesync/calendar":
+			_, _ = w.Write([]byte(`{"slots": [{"start": "12:00", "playlist": "lunch"}, {"start": "06:00", "playlist": "morning"}]}`))
+		case r.URL.Query().Get("name") != "":
+			_, _ = w.Write([]byte(r.URL.Query().Get("name") + ".mp4\n"))
+		default:
+			_, _ = w.Write([]byte("regular.mp4\n"))
+		}
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	config := Config{ServerKey: "key", CoreAPIBase: server.URL, Playlist: PlaylistConfig{Destination: dir}}
+	setCurrentConfigForTest(t, config)
+
+	if err := PerformPlaylistSync(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, playlistFileName)); string(data) != "lunch.mp4\n" {
+		t.Fatalf("playlist.m3u = %q, want the lunch slot", data)
+	}
+	if data, _ := os.ReadFile(calendarPlaylistPath(config, "morning")); string(data) != "morning.mp4\n" {
+		t.Fatalf("morning playlist = %q", data)
+	}
+	state := getCalendarState()
+	if state.Active != "lunch" || len(state.Slots) != 2 || state.Slots[0].Playlist != "morning" {
+		t.Fatalf("state = %+v", state)
+	}
+
+	calendarNow = func() time.Time { return time.Date(2026, 3, 3, 7, 0, 0, 0, time.Local) }
+	if err := switchCalendarSlot(t.Context(), config); err != nil || *restarts != 1 {
+		t.Fatalf("switch: err %v, restarts %d", err, *restarts)
+	}
+	if err := switchCalendarSlot(t.Context(), config); err != nil || *restarts != 1 {
+		t.Fatalf("the same slot must not restart playback: err %v, restarts %d", err, *restarts)
+	}
+
+	calendarLock.Lock()
+	calendar = CalendarState{}
+	calendarLock.Unlock()
+	RestoreCalendar()
+	if restored := getCalendarState(); restored.Active != "morning" || len(restored.Slots) != 2 {
+		t.Fatalf("restored %+v", restored)
+	}
+}
+
+func TestCheckUpcomingCalendarSlot(t *testing.T) {
+	setupCalendarForTest(t, time.Date(2026, 3, 2, 11, 30, 0, 0, time.Local))
+	var posted []*CalendarGap
+	postCalendarGap = func(config Config, gap *CalendarGap) { posted = append(posted, gap) }
+	dir := t.TempDir()
+	config := Config{Playlist: PlaylistConfig{Destination: dir}}
+	if err := os.WriteFile(filepath.Join(dir, "present.mp4"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(calendarPlaylistPath(config, "lunch"), []byte("#EXTM3U\npresent.mp4\nabsent.mp4\nhttp://stream/live\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checkUpcomingCalendarSlot(config, CalendarSlot{Start: "12:00", Playlist: "lunch"})
+	gaps := getCalendarState().Gaps
+	if len(gaps) != 1 || !reflect.DeepEqual(gaps[0].Missing, []string{filepath.Join(dir, "absent.mp4")}) || gaps[0].PlaylistMissing {
+		t.Fatalf("gaps = %+v", gaps)
+	}
+	if len(posted) != 0 {
+		t.Fatal("gaps are not posted without a core")
+	}
+
+	if gap := checkCalendarSlot(config, CalendarSlot{Start: "18:00", Playlist: "evening"}, time.Now()); gap == nil || !gap.PlaylistMissing {
+		t.Fatalf("a missing playlist is a gap: %+v", gap)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "absent.mp4"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkUpcomingCalendarSlot(config, CalendarSlot{Start: "12:00", Playlist: "lunch"})
+	if gaps := getCalendarState().Gaps; len(gaps) != 0 {
+		t.Fatalf("a ready slot must clear its gap: %+v", gaps)
+	}
+}
+
+func TestGarbageCollectionKeepsCalendarPlaylists(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{Playlist: PlaylistConfig{Destination: dir}}
+	// The calendar is not loaded yet, e.g. right after a restart.
+	writeMediaFilesForTest(t, dir, "calendar-lunch.m3u", "calendar-.m3u", "calendar-lunch.txt")
+	s := fileSyncerFor(config, nil)
+	if err := s.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(calendarPlaylistPath(config, "lunch")); err != nil {
+		t.Fatalf("expected the calendar playlist to be kept: %v", err)
+	}
+	for _, name := range []string{"calendar-.m3u", "calendar-lunch.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be collected, got %v", name, err)
+		}
+	}
+}
+
+func TestHandleCalendar(t *testing.T) {
+	setupCalendarForTest(t, time.Now())
+	calendarLock.Lock()
+	calendar = CalendarState{Slots: []CalendarSlot{{Start: "06:00", Playlist: "morning"}}, Active: "morning"}
+	calendarLock.Unlock()
+
+	w := httptest.NewRecorder()
+	HandleCalendar(w, httptest.NewRequest(http.MethodGet, "/api/calendar", nil))
+	var resp struct {
+		Data CalendarState `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || resp.Data.Active != "morning" {
+		t.Fatalf("status %d, body %s, err %v", w.Code, w.Body.String(), err)
+	}
+	w = httptest.NewRecorder()
+	HandleCalendar(w, httptest.NewRequest(http.MethodPost, "/api/calendar", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST: status %d", w.Code)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Capabilities lists the features this device supports, so the core only
+// calls endpoints that work here. It is reported in /health.
+type Capabilities struct {
+	// SyncSources are the sync.source values usable on this device.
+	SyncSources []string `json:"syncSources"`
+	// PlaybackController is mpv-ipc when the player is controlled through
+	// player.ipc_socket (overlays, proof-of-play), otherwise systemd.
+	PlaybackController string `json:"playbackController"`
+	Metrics            bool   `json:"metrics"`
+	// MQTT is always false: this build has no MQTT client.
+	MQTT bool `json:"mqtt"`
+	// DisplayControl reports DRM connectors for /api/menu/display.
+	DisplayControl bool `json:"displayControl"`
+	// DisplayModeLive reports wlr-randr, which applies display modes
+	// without a reboot.
+	DisplayModeLive bool `json:"displayModeLive"`
+	// Helper reports that privileged operations go through media-pi-helper.
+	Helper bool `json:"helper"`
+	// HashAlgorithms are the manifest hashAlgorithm values verified here.
+	HashAlgorithms []string `json:"hashAlgorithms"`
+	// WebContent reports the kiosk browser channel of /api/playback/web.
+	WebContent bool `json:"webContent"`
+	// AudioPlayback reports the background music channel of
+	// /api/audio/playback.
+	AudioPlayback bool `json:"audioPlayback"`
+	// SyncPlay reports the video wall role of /api/playback/sync, or "".
+	SyncPlay string `json:"syncPlay,omitempty"`
+	// Container reports that host-only features are disabled.
+	Container bool `json:"container,omitempty"`
+}
+
+// Playback controller types reported in Capabilities.
+const (
+	PlaybackControllerSystemd = "systemd"
+	PlaybackControllerMPV     = "mpv-ipc"
+)
+
+// capabilityLookPath finds the external tools some features need. Tests may
+// override it.
+var capabilityLookPath = exec.LookPath
+
+var (
+	capabilitiesLock sync.RWMutex
+	capabilities     *Capabilities
+)
+
+// detectCapabilities inspects config and the device.
+func detectCapabilities(config Config) Capabilities {
+	caps := Capabilities{
+		SyncSources:        []string{SyncSourceCore, SyncSourceS3},
+		PlaybackController: PlaybackControllerSystemd,
+		Metrics:            config.Metrics.Enabled,
+		Helper:             strings.TrimSpace(config.Helper.Socket) != "",
+		HashAlgorithms:     supportedHashAlgorithms,
+		WebContent:         config.Web.Enabled && len(config.Displays) == 0,
+		AudioPlayback:      config.Audio.Playback.Enabled,
+	}
+	if config.SyncPlay.Enabled {
+		caps.SyncPlay = config.SyncPlay.Role
+	}
+	if _, err := capabilityLookPath("sftp"); err == nil {
+		caps.SyncSources = append(caps.SyncSources, SyncSourceSFTP)
+	}
+	if strings.TrimSpace(config.Player.IPCSocket) != "" {
+		caps.PlaybackController = PlaybackControllerMPV
+	}
+	if outputs, err := discoverDisplays(DRMRoot); err == nil && len(outputs) > 0 {
+		caps.DisplayControl = true
+	}
+	if _, err := capabilityLookPath("wlr-randr"); err == nil {
+		caps.DisplayModeLive = true
+	}
+	if InContainer() {
+		caps.Container = true
+		caps.DisplayControl = false
+		caps.DisplayModeLive = false
+	}
+	return caps
+}
+
+// DetectCapabilities records the capabilities of the current configuration
+// and device. It runs at startup and after every configuration reload.
+func DetectCapabilities() {
+	caps := detectCapabilities(GetCurrentConfig())
+	capabilitiesLock.Lock()
+	capabilities = &caps
+	capabilitiesLock.Unlock()
+}
+
+// getCapabilities returns the recorded capabilities, or nil before
+// DetectCapabilities ran.
+func getCapabilities() *Capabilities {
+	capabilitiesLock.RLock()
+	defer capabilitiesLock.RUnlock()
+	return capabilities
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectCapabilities(t *testing.T) {
+	drm := t.TempDir()
+	originalDRM, originalLookPath, originalContainer := DRMRoot, capabilityLookPath, inContainer
+	DRMRoot = drm
+	inContainer = func() bool { return false }
+	t.Cleanup(func() {
+		DRMRoot, capabilityLookPath, inContainer = originalDRM, originalLookPath, originalContainer
+		capabilitiesLock.Lock()
+		capabilities = nil
+		capabilitiesLock.Unlock()
+	})
+	found := map[string]bool{}
+	capabilityLookPath = func(name string) (string, error) {
+		if found[name] {
+			return "/usr/bin/" + name, nil
+		}
+		return "", errors.New("not found")
+	}
+
+	caps := detectCapabilities(Config{})
+	want := Capabilities{SyncSources: []string{"core", "s3"}, PlaybackController: PlaybackControllerSystemd, HashAlgorithms: []string{"blake3", "sha512", "sha256"}}
+	if !reflect.DeepEqual(caps, want) {
+		t.Fatalf("detectCapabilities = %+v, want %+v", caps, want)
+	}
+
+	if err := os.Mkdir(filepath.Join(drm, "card1-HDMI-A-1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	found["sftp"], found["wlr-randr"] = true, true
+	caps = detectCapabilities(Config{
+		Metrics: MetricsConfig{Enabled: true},
+		Player:  PlayerConfig{IPCSocket: "/tmp/mpv.sock"},
+		Helper:  HelperConfig{Socket: "/run/media-pi-helper.sock"},
+		Web:     WebContentConfig{Enabled: true},
+		Audio:   AudioConfig{Playback: AudioPlaybackConfig{Enabled: true}},
+	})
+	want = Capabilities{
+		SyncSources:        []string{"core", "s3", "sftp"},
+		PlaybackController: PlaybackControllerMPV,
+		Metrics:            true,
+		DisplayControl:     true,
+		DisplayModeLive:    true,
+		Helper:             true,
+		HashAlgorithms:     []string{"blake3", "sha512", "sha256"},
+		WebContent:         true,
+		AudioPlayback:      true,
+	}
+	if !reflect.DeepEqual(caps, want) {
+		t.Fatalf("detectCapabilities = %+v, want %+v", caps, want)
+	}
+
+	inContainer = func() bool { return true }
+	if caps = detectCapabilities(Config{}); !caps.Container || caps.DisplayControl || caps.DisplayModeLive {
+		t.Fatalf("a container must disable display control: %+v", caps)
+	}
+	inContainer = func() bool { return false }
+
+	setCurrentConfigForTest(t, Config{ServerKey: "key", Metrics: MetricsConfig{Enabled: true}})
+	DetectCapabilities()
+	w := httptest.NewRecorder()
+	HandleHealth(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var health struct {
+		Data HealthResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if health.Data.Capabilities == nil || !health.Data.Capabilities.Metrics || !health.Data.Capabilities.DisplayControl {
+		t.Fatalf("unexpected capabilities in health: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// Hash algorithms a manifest item may name in hashAlgorithm.
+const (
+	HashSHA256 = "sha256"
+	HashSHA512 = "sha512"
+	HashBLAKE3 = "blake3"
+)
+
+// hashAlgorithmsHeader advertises supportedHashAlgorithms on manifest
+// requests, so the core can send items hashed with an algorithm this agent
+// verifies.
+const hashAlgorithmsHeader = "X-Hash-Algorithms"
+
+var hashConstructors = map[string]func() hash.Hash{
+	HashSHA256: sha256.New,
+	HashSHA512: sha512.New,
+	HashBLAKE3: func() hash.Hash { return blake3.New(32, nil) },
+}
+
+// supportedHashAlgorithms lists the algorithms of hashConstructors in the
+// order the agent prefers them.
+var supportedHashAlgorithms = []string{HashBLAKE3, HashSHA512, HashSHA256}
+
+// itemVerifier hashes content written to it and compares the digest with
+// the one the manifest gives for the item.
+type itemVerifier struct {
+	hash.Hash
+	algorithm string
+	expected  string
+}
+
+// newItemVerifier picks the digest to verify item with. An item naming
+// hashAlgorithm and hash is verified with that algorithm; an unsupported
+// algorithm falls back to sha256 when the item also carries it, so the
+// core can introduce a new algorithm without breaking older agents.
+func newItemVerifier(item ManifestItem) (*itemVerifier, error) {
+	algorithm := strings.ToLower(strings.TrimSpace(item.HashAlgorithm))
+	if algorithm != "" && algorithm != HashSHA256 {
+		if newHash, ok := hashConstructors[algorithm]; ok && item.Hash != "" {
+			return &itemVerifier{Hash: newHash(), algorithm: algorithm, expected: item.Hash}, nil
+		}
+		if item.SHA256 == "" {
+			return nil, fmt.Errorf("unsupported hash algorithm %q", item.HashAlgorithm)
+		}
+	}
+	expected := item.SHA256
+	if expected == "" && algorithm == HashSHA256 {
+		expected = item.Hash
+	}
+	return &itemVerifier{Hash: sha256.New(), algorithm: HashSHA256, expected: expected}, nil
+}
+
+func (v *itemVerifier) actual() string {
+	return hex.EncodeToString(v.Sum(nil))
+}
+
+// matches reports whether the content written so far has the expected
+// digest. Hex digits compare case-insensitively.
+func (v *itemVerifier) matches() bool {
+	return strings.EqualFold(v.actual(), strings.TrimSpace(v.expected))
+}
+
+// mismatchError describes a failed verification, e.g.
+// "SHA256 mismatch: expected ..., got ...".
+func (v *itemVerifier) mismatchError() error {
+	return contentMismatchf("%s mismatch: expected %s, got %s", strings.ToUpper(v.algorithm), v.expected, v.actual())
+}
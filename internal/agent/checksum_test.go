@@ -0,0 +1,101 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func blake3Hex(s string) string {
+	h := hashConstructors[HashBLAKE3]()
+	_, _ = h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// TestBLAKE3Vectors checks the wiring of the BLAKE3 hash against official
+// test vectors, whose input is the byte sequence 0, 1, ... 250, 0, 1, ...
+// of the given length.
+func TestBLAKE3Vectors(t *testing.T) {
+	vectors := map[int]string{
+		0:    "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262",
+		1025: "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444",
+	}
+	for n, want := range vectors {
+		input := make([]byte, n)
+		for i := range input {
+			input[i] = byte(i % 251)
+		}
+		h := hashConstructors[HashBLAKE3]()
+		_, _ = h.Write(input)
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			t.Errorf("BLAKE3 of %d bytes = %s, want %s", n, got, want)
+		}
+	}
+}
+
+func TestWriteVerifiedContentHashAlgorithms(t *testing.T) {
+	sha512Sum := sha512.Sum512([]byte("video"))
+	tests := []struct {
+		name    string
+		item    ManifestItem
+		wantErr string
+	}{
+		{name: "sha256", item: ManifestItem{SHA256: sha256Hex("video")}},
+		{name: "uppercase sha256", item: ManifestItem{SHA256: strings.ToUpper(sha256Hex("video"))}},
+		{name: "sha512", item: ManifestItem{HashAlgorithm: "SHA512", Hash: hex.EncodeToString(sha512Sum[:])}},
+		{name: "blake3", item: ManifestItem{HashAlgorithm: "blake3", Hash: blake3Hex("video")}},
+		{name: "blake3 mismatch", item: ManifestItem{HashAlgorithm: "blake3", Hash: blake3Hex("other"), SHA256: sha256Hex("video")}, wantErr: "BLAKE3 mismatch"},
+		// An algorithm this agent does not know falls back to sha256.
+		{name: "unknown with sha256", item: ManifestItem{HashAlgorithm: "k12", Hash: "00", SHA256: sha256Hex("video")}},
+		{name: "unknown without sha256", item: ManifestItem{HashAlgorithm: "k12", Hash: "00"}, wantErr: `unsupported hash algorithm "k12"`},
+		{name: "sha256 in hash", item: ManifestItem{HashAlgorithm: "sha256", Hash: sha256Hex("video")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := tt.item
+			item.Filename, item.FileSizeBytes = "video.mp4", 5
+			dest := filepath.Join(t.TempDir(), "video.mp4")
+			err := writeVerifiedContent(strings.NewReader("video"), item, dest)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected %q error, got %v", tt.wantErr, err)
+				}
+				if _, statErr := os.Stat(dest); !os.IsNotExist(statErr) {
+					t.Fatalf("unverified file must not be renamed into place: %v", statErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if valid, err := verifyLocalFile(dest, item); err != nil || !valid {
+				t.Fatalf("verifyLocalFile = %v, %v", valid, err)
+			}
+		})
+	}
+}
+
+func TestManifestRequestAdvertisesHashAlgorithms(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(hashAlgorithmsHeader)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	if _, _, err := fetchManifestConditional(context.Background(), Config{CoreAPIBase: server.URL}, manifestValidators{}); err != nil {
+		t.Fatal(err)
+	}
+	if got != "blake3, sha512, sha256" {
+		t.Fatalf("unexpected %s header %q", hashAlgorithmsHeader, got)
+	}
+}
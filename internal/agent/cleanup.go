@@ -0,0 +1,196 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for the media directory cleanup job.
+const (
+	DefaultTempFileMaxAge  = time.Hour
+	DefaultCleanupInterval = 6 * time.Hour
+)
+
+const (
+	metricCleanupRuns         = "media_pi_cleanup_runs_total"
+	metricCleanupTempRemoved  = "media_pi_cleanup_temp_files_removed_total"
+	metricCleanupBytesFreed   = "media_pi_cleanup_bytes_freed_total"
+	metricCleanupDirsRemoved  = "media_pi_cleanup_dirs_removed_total"
+	metricCleanupErrors       = "media_pi_cleanup_errors_total"
+	metricCleanupLastRunEpoch = "media_pi_cleanup_last_run_timestamp_seconds"
+)
+
+func init() {
+	registerCounter(metricCleanupRuns, "Media directory cleanup runs.")
+	registerCounter(metricCleanupTempRemoved, "Stale temp files removed by cleanup.")
+	registerCounter(metricCleanupBytesFreed, "Bytes freed by removing stale temp files.")
+	registerCounter(metricCleanupDirsRemoved, "Empty orphan directories removed by cleanup.")
+	registerCounter(metricCleanupErrors, "Entries cleanup failed to remove.")
+	registerGauge(metricCleanupLastRunEpoch, "Unix time of the last cleanup run.")
+}
+
+var (
+	cleanupJobLock   sync.Mutex
+	cleanupJobCancel context.CancelFunc
+)
+
+// cleanupResult summarizes one cleanup pass.
+type cleanupResult struct {
+	TempFiles   int
+	BytesFreed  int64
+	Directories int
+	Errors      []string
+}
+
+// cleanupMediaDir removes ".tmp" files not modified for maxAge and empty
+// subdirectories below mediaDir. In-flight downloads keep their temp file
+// fresh, so the age threshold protects them. Directories in skip are
+// neither walked nor removed.
+func cleanupMediaDir(mediaDir string, maxAge time.Duration, now time.Time, skip ...string) (cleanupResult, error) {
+	var result cleanupResult
+	if _, err := os.Stat(mediaDir); os.IsNotExist(err) {
+		return result, nil
+	}
+
+	var dirs []string
+	err := filepath.Walk(mediaDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", path, err))
+			return nil
+		}
+		if info.IsDir() {
+			if slices.Contains(skip, path) {
+				return filepath.SkipDir
+			}
+			if path != mediaDir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".tmp" || now.Sub(info.ModTime()) < maxAge {
+			return nil
+		}
+		log.Printf("Removing stale temp file: %s", path)
+		if err := os.Remove(path); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", path, err))
+			return nil
+		}
+		result.TempFiles++
+		result.BytesFreed += info.Size()
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// Deepest first so parents emptied by their children go too.
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], string(filepath.Separator)) > strings.Count(dirs[j], string(filepath.Separator))
+	})
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dir); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", dir, err))
+			continue
+		}
+		result.Directories++
+	}
+	return result, nil
+}
+
+// runMediaCleanup performs a cleanup pass unless a sync is writing to the
+// media directory, purges expired trash and records the outcome in metrics.
+func runMediaCleanup(config Config) {
+	if IsVideoSyncRunning() {
+		log.Println("Skipping media cleanup while video sync is running")
+		return
+	}
+
+	maxAge := config.Sync.TempMaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultTempFileMaxAge
+	}
+	now := time.Now()
+	var result cleanupResult
+	for _, dir := range mediaDirs(config) {
+		dirResult, err := cleanupMediaDir(dir, maxAge, now, nestedMediaDirs(config, dir)...)
+		result.TempFiles += dirResult.TempFiles
+		result.BytesFreed += dirResult.BytesFreed
+		result.Directories += dirResult.Directories
+		result.Errors = append(result.Errors, dirResult.Errors...)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+
+		if _, err := purgeTrash(dir, trashRetention(config), now); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+
+	metricAdd(metricCleanupRuns, 1)
+	metricAdd(metricCleanupTempRemoved, float64(result.TempFiles))
+	metricAdd(metricCleanupBytesFreed, float64(result.BytesFreed))
+	metricAdd(metricCleanupDirsRemoved, float64(result.Directories))
+	metricAdd(metricCleanupErrors, float64(len(result.Errors)))
+	metricSet(metricCleanupLastRunEpoch, float64(now.Unix()))
+
+	if len(result.Errors) > 0 {
+		log.Printf("Warning: media cleanup errors: %v", result.Errors)
+	}
+	if result.TempFiles > 0 || result.Directories > 0 {
+		log.Printf("Media cleanup removed %d temp file(s) (%d bytes) and %d empty director(ies)", result.TempFiles, result.BytesFreed, result.Directories)
+	}
+}
+
+// StartCleanupJob runs media cleanup now and then every
+// sync.cleanup_interval. Calling it again restarts the job.
+func StartCleanupJob() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cleanupJobLock.Lock()
+	if cleanupJobCancel != nil {
+		cleanupJobCancel()
+	}
+	cleanupJobCancel = cancel
+	cleanupJobLock.Unlock()
+
+	go func() {
+		for {
+			config := GetCurrentConfig()
+			runMediaCleanup(config)
+
+			interval := config.Sync.CleanupInterval
+			if interval <= 0 {
+				interval = DefaultCleanupInterval
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// StopCleanupJob stops the periodic cleanup job.
+func StopCleanupJob() {
+	cleanupJobLock.Lock()
+	defer cleanupJobLock.Unlock()
+	if cleanupJobCancel != nil {
+		cleanupJobCancel()
+		cleanupJobCancel = nil
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCleanupMediaDirRemovesStaleTempFilesAndEmptyDirs(t *testing.T) {
+	mediaDir := t.TempDir()
+	now := time.Now()
+
+	write := func(rel string, age time.Duration) string {
+		path := filepath.Join(mediaDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	stale := write("deep/nested/clip.mp4.tmp", 2*time.Hour)
+	fresh := write("clip2.mp4.tmp", time.Minute)
+	media := write("keep/clip.mp4", 48*time.Hour)
+	if err := os.MkdirAll(filepath.Join(mediaDir, "empty", "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := cleanupMediaDir(mediaDir, time.Hour, now)
+	if err != nil {
+		t.Fatalf("cleanupMediaDir() error = %v", err)
+	}
+	if result.TempFiles != 1 || result.BytesFreed != 4 {
+		t.Errorf("unexpected temp file result %+v", result)
+	}
+	if result.Directories != 4 {
+		t.Errorf("expected deep, deep/nested, empty and empty/child removed, got %+v", result)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected stale temp file removed, stat err = %v", err)
+	}
+	for _, path := range []string{fresh, media, mediaDir} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to be kept: %v", path, err)
+		}
+	}
+}
+
+func TestRunMediaCleanupRecordsMetrics(t *testing.T) {
+	mediaDir := t.TempDir()
+	old := time.Now().Add(-2 * DefaultTempFileMaxAge)
+	path := filepath.Join(mediaDir, "x.tmp")
+	if err := os.WriteFile(path, []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	runsBefore := metricValue(metricCleanupRuns)
+	removedBefore := metricValue(metricCleanupTempRemoved)
+	runMediaCleanup(Config{Playlist: PlaylistConfig{Destination: mediaDir}})
+
+	if got := metricValue(metricCleanupRuns) - runsBefore; got != 1 {
+		t.Errorf("cleanup runs delta = %v, want 1", got)
+	}
+	if got := metricValue(metricCleanupTempRemoved) - removedBefore; got != 1 {
+		t.Errorf("temp files removed delta = %v, want 1", got)
+	}
+}
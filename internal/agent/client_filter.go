@@ -0,0 +1,124 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+const metricHTTPRejectedClients = "media_pi_http_rejected_clients_total"
+
+func init() {
+	registerCounter(metricHTTPRejectedClients, "API requests rejected because the client is outside allowed_clients.")
+}
+
+// allowedClients holds the parsed allowed_clients ranges. A nil slice
+// accepts every client. It is populated by LoadConfigFrom.
+var allowedClients atomic.Pointer[[]netip.Prefix]
+
+// parseAllowedClients parses CIDR ranges and single addresses from
+// allowed_clients.
+func parseAllowedClients(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed_clients entry %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed_clients entry %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func setAllowedClients(prefixes []netip.Prefix) {
+	if len(prefixes) == 0 {
+		allowedClients.Store(nil)
+		return
+	}
+	allowedClients.Store(&prefixes)
+}
+
+// isAllowedClient reports whether remoteAddr may reach the API. Loopback
+// clients are always allowed so local tools keep working.
+func isAllowedClient(remoteAddr string) bool {
+	prefixes := allowedClients.Load()
+	if prefixes == nil {
+		return true
+	}
+	addrPort, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	if addr.IsLoopback() {
+		return true
+	}
+	for _, prefix := range *prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientFilterMiddleware rejects requests from clients outside
+// allowed_clients before any other handler runs.
+func ClientFilterMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAllowedClient(r.RemoteAddr) {
+			metricAdd(metricHTTPRejectedClients, 1)
+			JSONResponse(w, http.StatusForbidden, APIResponse{OK: false, ErrMsg: "Доступ с этого адреса запрещён"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListenAPI opens the API listener on config.ListenAddr. When
+// listen_interface is set, or wireguard.restrict_api, the socket is bound to
+// that interface with SO_BINDTODEVICE, so the API is unreachable through
+// other networks even when the interface address changes.
+func ListenAPI(ctx context.Context, config Config) (net.Listener, error) {
+	listenAddr := config.ListenAddr
+	if listenAddr == "" {
+		listenAddr = DefaultListenAddr
+	}
+	var lc net.ListenConfig
+	if iface := apiInterface(config); iface != "" {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			if err := c.Control(func(fd uintptr) {
+				sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+			}); err != nil {
+				return err
+			}
+			if sockErr != nil {
+				return fmt.Errorf("bind to interface %s: %w", iface, sockErr)
+			}
+			return nil
+		}
+		log.Printf("Binding API listener to interface %s", iface)
+	}
+	return lc.Listen(ctx, "tcp", listenAddr)
+}
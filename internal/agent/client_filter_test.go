@@ -0,0 +1,131 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func setAllowedClientsForTest(t *testing.T, entries ...string) {
+	t.Helper()
+	prefixes, err := parseAllowedClients(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setAllowedClients(prefixes)
+	t.Cleanup(func() { setAllowedClients(nil) })
+}
+
+func TestIsAllowedClient(t *testing.T) {
+	if !isAllowedClient("192.168.1.20:5000") {
+		t.Fatal("expected every client to be allowed without allowed_clients")
+	}
+
+	setAllowedClientsForTest(t, "10.8.0.0/24", "192.168.1.5", "fd00::/64")
+	cases := map[string]bool{
+		"10.8.0.7:40000":             true,
+		"[::ffff:10.8.0.7]:40000":    true,
+		"192.168.1.5:1234":           true,
+		"192.168.1.6:1234":           false,
+		"[fd00::1]:8081":             true,
+		"[fd01::1]:8081":             false,
+		"127.0.0.1:5555":             true,
+		"[::1]:5555":                 true,
+		"not-an-address":             false,
+		"10.8.1.1:40000":             false,
+		"[fe80::1%eth0]:40000":       false,
+		"[::ffff:192.168.1.5]:60000": true,
+	}
+	for remote, want := range cases {
+		if got := isAllowedClient(remote); got != want {
+			t.Errorf("isAllowedClient(%q) = %v, want %v", remote, got, want)
+		}
+	}
+}
+
+func TestParseAllowedClientsRejectsGarbage(t *testing.T) {
+	if _, err := parseAllowedClients([]string{"10.8.0.0/33"}); err == nil {
+		t.Fatal("expected invalid prefix to be rejected")
+	}
+	if _, err := parseAllowedClients([]string{"vpn"}); err == nil {
+		t.Fatal("expected invalid address to be rejected")
+	}
+	prefixes, err := parseAllowedClients([]string{" 10.8.0.9/24 ", ""})
+	if err != nil || len(prefixes) != 1 || prefixes[0].String() != "10.8.0.0/24" {
+		t.Fatalf("parseAllowedClients = %v, %v", prefixes, err)
+	}
+}
+
+func TestClientFilterMiddleware(t *testing.T) {
+	setAllowedClientsForTest(t, "10.8.0.0/24")
+	handler := ClientFilterMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	before := metricValue(metricHTTPRejectedClients)
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.RemoteAddr = "192.168.1.20:5000"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden || metricValue(metricHTTPRejectedClients)-before != 1 {
+		t.Fatalf("expected 403 for store LAN client, got %d", w.Code)
+	}
+
+	req.RemoteAddr = "10.8.0.2:5000"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected VPN client to pass, got %d", w.Code)
+	}
+}
+
+func TestLoadConfigAppliesAllowedClients(t *testing.T) {
+	t.Cleanup(func() { setAllowedClients(nil) })
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	if err := os.WriteFile(path, []byte("server_key: key\nallowed_clients: [\"10.8.0.0/24\"]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfigFrom(path); err != nil {
+		t.Fatal(err)
+	}
+	if isAllowedClient("192.168.1.20:5000") || !isAllowedClient("10.8.0.2:5000") {
+		t.Fatal("expected allowed_clients to be applied")
+	}
+
+	if err := os.WriteFile(path, []byte("server_key: key\nallowed_clients: [\"10.8.0.0/99\"]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfigFrom(path); err == nil || !strings.Contains(err.Error(), "allowed_clients") {
+		t.Fatalf("expected invalid allowed_clients to be rejected, got %v", err)
+	}
+	if err := validateConfigFile(path); err == nil {
+		t.Fatal("expected self-test to reject invalid allowed_clients")
+	}
+	// A rejected reload keeps the previous ranges.
+	if isAllowedClient("192.168.1.20:5000") {
+		t.Fatal("expected previous allowed_clients to stay in effect")
+	}
+}
+
+func TestListenAPIBindsToInterface(t *testing.T) {
+	listener, err := ListenAPI(t.Context(), Config{ListenAddr: "127.0.0.1:0", ListenInterface: "lo"})
+	if errors.Is(err, syscall.EPERM) {
+		t.Skip("SO_BINDTODEVICE requires CAP_NET_RAW")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = listener.Close()
+
+	if _, err := ListenAPI(t.Context(), Config{ListenAddr: "127.0.0.1:0", ListenInterface: "media-pi-missing0"}); err == nil {
+		t.Fatal("expected unknown interface to fail")
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ClockConfig controls clock drift detection against the core's Date header.
+type ClockConfig struct {
+	// MaxDrift is the largest offset from core time still considered sane.
+	MaxDrift time.Duration `yaml:"max_drift,omitempty"`
+	// Resync restarts systemd-timesyncd when drift exceeds MaxDrift.
+	Resync bool `yaml:"resync,omitempty"`
+	// WaitForTrustedTime delays the sync scheduler until time is trusted,
+	// for at most TrustTimeout.
+	WaitForTrustedTime bool          `yaml:"wait_for_trusted_time,omitempty"`
+	TrustTimeout       time.Duration `yaml:"trust_timeout,omitempty"`
+}
+
+// Defaults for clock drift detection.
+const (
+	DefaultClockMaxDrift     = 2 * time.Minute
+	DefaultClockTrustTimeout = 10 * time.Minute
+)
+
+const (
+	timesyncUnit          = "systemd-timesyncd.service"
+	metricClockDrift      = "media_pi_clock_drift_seconds"
+	metricClockResyncs    = "media_pi_clock_resyncs_total"
+	clockResyncMinBackoff = 10 * time.Minute
+)
+
+func init() {
+	registerGauge(metricClockDrift, "Local clock offset from the core Date header (positive when ahead).")
+	registerCounter(metricClockResyncs, "Time resyncs requested after excessive clock drift.")
+}
+
+var (
+	// minSaneTime is the earliest wall clock time considered plausible; an
+	// RTC-less Pi that boots without network starts far before it.
+	minSaneTime = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// timesyncSyncedPath is created by systemd-timesyncd once the clock
+	// has been synchronized. Tests may override it.
+	timesyncSyncedPath = "/run/systemd/timesync/synchronized"
+
+	// clockTrustPollInterval is how often the scheduler re-checks time trust.
+	clockTrustPollInterval = 5 * time.Second
+
+	// requestTimeResync asks systemd-timesyncd to resynchronize. Tests may
+	// override it.
+	requestTimeResync = restartTimesyncd
+
+	clockMu         sync.Mutex
+	clockDrift      time.Duration
+	clockDriftKnown bool
+	clockDriftAt    time.Time
+	lastResyncAt    time.Time
+)
+
+// ClockStatus reports the last measured clock drift.
+type ClockStatus struct {
+	DriftSeconds float64 `json:"driftSeconds"`
+	Known        bool    `json:"known"`
+	MeasuredAt   string  `json:"measuredAt,omitempty"`
+	Trusted      bool    `json:"trusted"`
+}
+
+func clockMaxDrift(config Config) time.Duration {
+	if config.Clock.MaxDrift > 0 {
+		return config.Clock.MaxDrift
+	}
+	return DefaultClockMaxDrift
+}
+
+// recordCoreDate derives the local clock drift from the Date header of a
+// core response received at local time at.
+func recordCoreDate(header string, at time.Time) {
+	if header == "" {
+		return
+	}
+	serverTime, err := http.ParseTime(header)
+	if err != nil {
+		return
+	}
+	// Date has one second resolution; compare at that precision.
+	drift := at.Truncate(time.Second).Sub(serverTime)
+
+	clockMu.Lock()
+	clockDrift = drift
+	clockDriftKnown = true
+	clockDriftAt = at
+	clockMu.Unlock()
+	metricSet(metricClockDrift, drift.Seconds())
+
+	config := GetCurrentConfig()
+	if abs := absDuration(drift); abs > clockMaxDrift(config) {
+		log.Printf("Warning: local clock differs from core by %s", drift)
+		if config.Clock.Resync {
+			maybeResyncClock(at)
+		}
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// maybeResyncClock requests a resync unless one was requested recently.
+func maybeResyncClock(now time.Time) {
+	clockMu.Lock()
+	if !lastResyncAt.IsZero() && now.Sub(lastResyncAt) < clockResyncMinBackoff {
+		clockMu.Unlock()
+		return
+	}
+	lastResyncAt = now
+	clockMu.Unlock()
+
+	metricAdd(metricClockResyncs, 1)
+	go func() {
+		if err := requestTimeResync(context.Background()); err != nil {
+			log.Printf("Warning: failed to request time resync: %v", err)
+			return
+		}
+		log.Printf("Requested time resync via %s", timesyncUnit)
+	}()
+}
+
+// restartTimesyncd restarts systemd-timesyncd, which makes it query the
+// NTP servers again.
+func restartTimesyncd(ctx context.Context) error {
+	conn, err := getDBusConnection(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = runDBusUnitOperation(ctx, conn, dbusUnitOperationRestart, timesyncUnit)
+	return err
+}
+
+// getClockStatus returns the last measured drift and whether the clock is
+// trusted: timesyncd reported a sync, or the drift is within clock.max_drift.
+func getClockStatus(config Config) ClockStatus {
+	clockMu.Lock()
+	drift, known, at := clockDrift, clockDriftKnown, clockDriftAt
+	clockMu.Unlock()
+
+	status := ClockStatus{Known: known}
+	if known {
+		status.DriftSeconds = drift.Seconds()
+		status.MeasuredAt = at.UTC().Format(time.RFC3339)
+		status.Trusted = absDuration(drift) <= clockMaxDrift(config)
+		return status
+	}
+	if _, err := os.Stat(timesyncSyncedPath); err == nil {
+		status.Trusted = true
+	}
+	return status
+}
+
+// checkClock verifies the clock is plausible and close to core time.
+func checkClock(config Config, now time.Time) HealthCheck {
+	if now.Before(minSaneTime) {
+		return HealthCheck{Name: "clock", OK: false, Detail: fmt.Sprintf("system time %s is before %s", now.UTC().Format(time.RFC3339), minSaneTime.Format("2006-01-02"))}
+	}
+	status := getClockStatus(config)
+	if !status.Known {
+		return HealthCheck{Name: "clock", OK: true, Detail: "drift unknown: no Date header from core yet"}
+	}
+	detail := fmt.Sprintf("drift %.0fs", status.DriftSeconds)
+	if !status.Trusted {
+		return HealthCheck{Name: "clock", OK: false, Detail: detail + fmt.Sprintf(" exceeds %s", clockMaxDrift(config))}
+	}
+	return HealthCheck{Name: "clock", OK: true, Detail: detail}
+}
+
+// waitForTrustedTime blocks until the clock is trusted, the timeout
+// elapses or ctx is done.
+func waitForTrustedTime(ctx context.Context, config Config) {
+	timeout := config.Clock.TrustTimeout
+	if timeout <= 0 {
+		timeout = DefaultClockTrustTimeout
+	}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(clockTrustPollInterval)
+	defer ticker.Stop()
+
+	for !getClockStatus(GetCurrentConfig()).Trusted {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline.C:
+			log.Printf("Warning: clock not trusted after %s, starting scheduler anyway", timeout)
+			return
+		case <-ticker.C:
+		}
+	}
+}
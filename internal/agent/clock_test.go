@@ -0,0 +1,144 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func resetClockStateForTest(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		clockMu.Lock()
+		clockDrift, clockDriftKnown, clockDriftAt, lastResyncAt = 0, false, time.Time{}, time.Time{}
+		clockMu.Unlock()
+	}
+	reset()
+	originalPath := timesyncSyncedPath
+	timesyncSyncedPath = filepath.Join(t.TempDir(), "synchronized")
+	t.Cleanup(func() {
+		reset()
+		timesyncSyncedPath = originalPath
+	})
+}
+
+func stubTimeResync(t *testing.T) *atomic.Int32 {
+	t.Helper()
+	var calls atomic.Int32
+	original := requestTimeResync
+	requestTimeResync = func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	}
+	t.Cleanup(func() { requestTimeResync = original })
+	return &calls
+}
+
+func TestRecordCoreDateMeasuresDrift(t *testing.T) {
+	resetClockStateForTest(t)
+	setCurrentConfigForTest(t, Config{})
+
+	server := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	recordCoreDate(server.Format(http.TimeFormat), server.Add(30*time.Second))
+
+	status := getClockStatus(GetCurrentConfig())
+	if !status.Known || status.DriftSeconds != 30 || !status.Trusted {
+		t.Fatalf("unexpected clock status: %+v", status)
+	}
+	if got := metricValue(metricClockDrift); got != 30 {
+		t.Errorf("drift metric = %v, want 30", got)
+	}
+}
+
+func TestRecordCoreDateRequestsResyncOnDrift(t *testing.T) {
+	resetClockStateForTest(t)
+	calls := stubTimeResync(t)
+	setCurrentConfigForTest(t, Config{Clock: ClockConfig{MaxDrift: time.Minute, Resync: true}})
+
+	server := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	local := server.Add(-time.Hour)
+	recordCoreDate(server.Format(http.TimeFormat), local)
+	recordCoreDate(server.Format(http.TimeFormat), local.Add(time.Minute))
+
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected one resync request, got %d", got)
+	}
+
+	config := GetCurrentConfig()
+	if status := getClockStatus(config); status.Trusted {
+		t.Errorf("expected drifted clock to be untrusted: %+v", status)
+	}
+	if check := checkClock(config, time.Now()); check.OK {
+		t.Errorf("expected clock check to fail: %+v", check)
+	}
+}
+
+func TestGetClockStatusTrustsTimesync(t *testing.T) {
+	resetClockStateForTest(t)
+	if status := getClockStatus(Config{}); status.Trusted {
+		t.Fatalf("expected untrusted clock without measurements: %+v", status)
+	}
+	if err := os.WriteFile(timesyncSyncedPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status := getClockStatus(Config{}); !status.Trusted {
+		t.Fatalf("expected timesync to make clock trusted: %+v", status)
+	}
+}
+
+func TestCheckClockRejectsImplausibleTime(t *testing.T) {
+	resetClockStateForTest(t)
+	if check := checkClock(Config{}, time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)); check.OK {
+		t.Errorf("expected 1970 clock to fail: %+v", check)
+	}
+	if check := checkClock(Config{}, minSaneTime.Add(time.Hour)); !check.OK {
+		t.Errorf("expected clock to pass: %+v", check)
+	}
+}
+
+func TestWaitForTrustedTime(t *testing.T) {
+	resetClockStateForTest(t)
+	setCurrentConfigForTest(t, Config{})
+	originalInterval := clockTrustPollInterval
+	clockTrustPollInterval = time.Millisecond
+	t.Cleanup(func() { clockTrustPollInterval = originalInterval })
+
+	done := make(chan struct{})
+	go func() {
+		waitForTrustedTime(context.Background(), Config{Clock: ClockConfig{TrustTimeout: time.Minute}})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected wait until the clock is trusted")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	now := time.Now()
+	recordCoreDate(now.UTC().Format(http.TimeFormat), now)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected wait to end once the clock is trusted")
+	}
+
+	// The timeout also ends the wait.
+	resetClockStateForTest(t)
+	start := time.Now()
+	waitForTrustedTime(context.Background(), Config{Clock: ClockConfig{TrustTimeout: 10 * time.Millisecond}})
+	if time.Since(start) > time.Second {
+		t.Errorf("wait did not honour trust timeout")
+	}
+}
@@ -0,0 +1,445 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigBundleConfig holds the Ed25519 keys of configuration bundles, the
+// signed tarballs that clone the setup of a reference device.
+type ConfigBundleConfig struct {
+	// PrivateKey signs exported bundles, base64 of the 32-byte seed or the
+	// 64-byte private key. Only the reference device needs it.
+	PrivateKey string `yaml:"private_key,omitempty"`
+	// PublicKey verifies imported bundles, base64.
+	PublicKey string `yaml:"public_key,omitempty"`
+}
+
+// Configuration bundle layout. manifest.json lists the SHA256 of every
+// other file and manifest.json.sig is its base64 Ed25519 signature.
+const (
+	configBundleManifestName  = "manifest.json"
+	configBundleSignatureName = configBundleManifestName + ".sig"
+	configBundleConfigName    = "agent.yaml"
+	configBundleCrontabName   = "crontab"
+	configBundleAudioName     = "asound.conf"
+	configBundleSystemdDir    = "systemd"
+)
+
+// maxConfigBundleSize bounds an uncompressed bundle.
+const maxConfigBundleSize = 16 << 20
+
+// ConfigBundleManifest describes a configuration bundle.
+type ConfigBundleManifest struct {
+	CreatedAt    time.Time         `json:"createdAt"`
+	DeviceName   string            `json:"deviceName"`
+	AgentVersion string            `json:"agentVersion"`
+	Files        map[string]string `json:"files"`
+}
+
+// ConfigBundleImportResponse is returned by POST /api/configuration/import.
+type ConfigBundleImportResponse struct {
+	Manifest ConfigBundleManifest `json:"manifest"`
+	Message  string               `json:"message"`
+}
+
+func parseConfigBundlePrivateKey(value string) (ed25519.PrivateKey, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("config_bundle.private_key not configured")
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config_bundle.private_key: %w", err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	}
+	return nil, fmt.Errorf("invalid config_bundle.private_key: expected %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(key))
+}
+
+func parseConfigBundlePublicKey(value string) (ed25519.PublicKey, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("config_bundle.public_key not configured")
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config_bundle.public_key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid config_bundle.public_key: expected %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// configBundleFixedPaths maps the bundle names of the schedule timers, the
+// playlist upload service and the audio settings to their device paths.
+func configBundleFixedPaths() map[string]string {
+	return map[string]string{
+		path.Join(configBundleSystemdDir, filepath.Base(PlaylistTimerPath)):   PlaylistTimerPath,
+		path.Join(configBundleSystemdDir, filepath.Base(VideoTimerPath)):      VideoTimerPath,
+		path.Join(configBundleSystemdDir, filepath.Base(PlaylistServicePath)): PlaylistServicePath,
+		configBundleAudioName: AudioConfigPath,
+	}
+}
+
+// isBundleDropInUnit reports whether drop-ins of unit travel in bundles:
+// allowed units and the playback units.
+func isBundleDropInUnit(config Config, unit string) bool {
+	if slices.Contains(config.AllowedUnits, unit) {
+		return true
+	}
+	matched, _ := path.Match("play.video*.service", unit)
+	return matched
+}
+
+// configBundlePath returns the device path of the bundle file name. Drop-ins
+// the agent writes at runtime (media-pi-*.conf, e.g. a takeover) are not
+// customizations and are rejected.
+func configBundlePath(config Config, name string) (string, bool) {
+	if target, ok := configBundleFixedPaths()[name]; ok {
+		return target, true
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] != configBundleSystemdDir || !strings.HasSuffix(parts[1], ".d") {
+		return "", false
+	}
+	unit, file := strings.TrimSuffix(parts[1], ".d"), parts[2]
+	if !isBundleDropInUnit(config, unit) || !strings.HasSuffix(file, ".conf") || strings.HasPrefix(file, "media-pi-") || file != path.Clean(file) || strings.HasPrefix(file, ".") {
+		return "", false
+	}
+	return filepath.Join(SystemdUnitDir, parts[1], file), true
+}
+
+// exportableConfig returns config without the values that belong to the
+// device rather than its setup: the server key, the bundle signing key and
+// the revision.
+func exportableConfig(config Config) Config {
+	config.ServerKey = ""
+	config.ConfigBundle.PrivateKey = ""
+	config.Revision = 0
+	return config
+}
+
+// collectConfigBundleFiles reads the files of a bundle of config.
+func collectConfigBundleFiles(config Config) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+
+	data, err := yaml.Marshal(exportableConfig(config))
+	if err != nil {
+		return nil, fmt.Errorf("marshal config: %w", err)
+	}
+	files[configBundleConfigName] = data
+
+	crontab, err := CrontabReadFunc()
+	if err != nil {
+		return nil, fmt.Errorf("read crontab: %w", err)
+	}
+	files[configBundleCrontabName] = []byte(crontab)
+
+	paths := configBundleFixedPaths()
+	dropIns, _ := filepath.Glob(filepath.Join(SystemdUnitDir, "*.service.d", "*.conf"))
+	for _, dropIn := range dropIns {
+		name := path.Join(configBundleSystemdDir, filepath.Base(filepath.Dir(dropIn)), filepath.Base(dropIn))
+		if _, ok := configBundlePath(config, name); ok {
+			paths[name] = dropIn
+		}
+	}
+	for name, source := range paths {
+		data, err := os.ReadFile(source)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", source, err)
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// ExportConfigBundle writes a signed bundle of the agent configuration,
+// the crontab, the schedule timers, the audio settings and the drop-ins of
+// managed units to w as a gzipped tarball. The configuration includes
+// other secrets, such as sync.s3.secret_key, in clear text.
+func ExportConfigBundle(w io.Writer, config Config) error {
+	privateKey, err := parseConfigBundlePrivateKey(config.ConfigBundle.PrivateKey)
+	if err != nil {
+		return err
+	}
+	files, err := collectConfigBundleFiles(config)
+	if err != nil {
+		return err
+	}
+
+	manifest := ConfigBundleManifest{
+		CreatedAt:    time.Now().UTC(),
+		DeviceName:   deviceName(config),
+		AgentVersion: GetVersion(),
+		Files:        make(map[string]string, len(files)),
+	}
+	for name, data := range files {
+		sum := sha256.Sum256(data)
+		manifest.Files[name] = hex.EncodeToString(sum[:])
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, manifestData))
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	write := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: manifest.CreatedAt, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := write(configBundleManifestName, manifestData); err != nil {
+		return err
+	}
+	if err := write(configBundleSignatureName, []byte(signature+"\n")); err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if err := write(name, files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// readConfigBundle unpacks the bundle from r and verifies the manifest
+// signature and the digest of every file.
+func readConfigBundle(r io.Reader, publicKey ed25519.PublicKey) (ConfigBundleManifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return ConfigBundleManifest{}, nil, fmt.Errorf("bundle is not a gzip file: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	var total int64
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ConfigBundleManifest{}, nil, fmt.Errorf("read bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return ConfigBundleManifest{}, nil, fmt.Errorf("bundle entry %s is not a regular file", header.Name)
+		}
+		if _, dup := files[header.Name]; dup {
+			return ConfigBundleManifest{}, nil, fmt.Errorf("bundle entry %s is duplicated", header.Name)
+		}
+		total += header.Size
+		if total > maxConfigBundleSize {
+			return ConfigBundleManifest{}, nil, fmt.Errorf("bundle exceeds %d bytes", maxConfigBundleSize)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return ConfigBundleManifest{}, nil, fmt.Errorf("read bundle entry %s: %w", header.Name, err)
+		}
+		files[header.Name] = data
+	}
+
+	manifestData, ok := files[configBundleManifestName]
+	if !ok {
+		return ConfigBundleManifest{}, nil, fmt.Errorf("bundle has no %s", configBundleManifestName)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(files[configBundleSignatureName])))
+	if err != nil {
+		return ConfigBundleManifest{}, nil, fmt.Errorf("invalid bundle signature encoding: %w", err)
+	}
+	if !ed25519.Verify(publicKey, manifestData, signature) {
+		return ConfigBundleManifest{}, nil, fmt.Errorf("bundle signature verification failed")
+	}
+	delete(files, configBundleManifestName)
+	delete(files, configBundleSignatureName)
+
+	var manifest ConfigBundleManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return ConfigBundleManifest{}, nil, fmt.Errorf("failed to decode bundle manifest: %w", err)
+	}
+	if len(manifest.Files) != len(files) {
+		return ConfigBundleManifest{}, nil, fmt.Errorf("bundle files do not match the manifest")
+	}
+	for name, data := range files {
+		sum := sha256.Sum256(data)
+		if manifest.Files[name] != hex.EncodeToString(sum[:]) {
+			return ConfigBundleManifest{}, nil, fmt.Errorf("bundle file %s does not match the manifest", name)
+		}
+	}
+	if _, ok := files[configBundleConfigName]; !ok {
+		return ConfigBundleManifest{}, nil, fmt.Errorf("bundle has no %s", configBundleConfigName)
+	}
+	return manifest, files, nil
+}
+
+// importedConfigStep saves the configuration of a bundle, keeping the
+// device's own server key, bundle keys and revision sequence, and reloads
+// it. A configuration the agent rejects is replaced by the previous file.
+func importedConfigStep(data []byte) (configStep, error) {
+	var imported Config
+	if err := yaml.Unmarshal(data, &imported); err != nil {
+		return configStep{}, fmt.Errorf("decode %s: %w", configBundleConfigName, err)
+	}
+	if ConfigPath == "" {
+		return configStep{}, fmt.Errorf("config path is not set")
+	}
+	previous, err := os.ReadFile(ConfigPath)
+	if err != nil {
+		return configStep{}, err
+	}
+	current := GetCurrentConfig()
+	imported.ServerKey = current.ServerKey
+	imported.ConfigBundle = current.ConfigBundle
+	imported.Revision = current.Revision + 1
+
+	return configStep{
+		name: "конфигурация агента",
+		commit: func() error {
+			if err := saveConfigToFile(ConfigPath, &imported); err != nil {
+				return err
+			}
+			if err := ReloadConfig(); err != nil {
+				if restoreErr := os.WriteFile(ConfigPath, previous, 0600); restoreErr != nil {
+					log.Printf("Warning: failed to restore %s: %v", ConfigPath, restoreErr)
+				}
+				return err
+			}
+			return nil
+		},
+	}, nil
+}
+
+// ImportConfigBundle verifies the bundle read from r with
+// config_bundle.public_key and applies it: unit files, audio settings and
+// the crontab are replaced and the configuration is saved and reloaded.
+// When a step fails the steps already applied are rolled back. systemd
+// reads the replaced unit files after a daemon reload.
+func ImportConfigBundle(r io.Reader) (ConfigBundleManifest, error) {
+	current := GetCurrentConfig()
+	publicKey, err := parseConfigBundlePublicKey(current.ConfigBundle.PublicKey)
+	if err != nil {
+		return ConfigBundleManifest{}, err
+	}
+	manifest, files, err := readConfigBundle(r, publicKey)
+	if err != nil {
+		return ConfigBundleManifest{}, err
+	}
+
+	var bundleConfig Config
+	if err := yaml.Unmarshal(files[configBundleConfigName], &bundleConfig); err != nil {
+		return ConfigBundleManifest{}, fmt.Errorf("decode %s: %w", configBundleConfigName, err)
+	}
+	var steps []configStep
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if name == configBundleConfigName || name == configBundleCrontabName {
+			continue
+		}
+		target, ok := configBundlePath(bundleConfig, name)
+		if !ok {
+			return ConfigBundleManifest{}, fmt.Errorf("unexpected bundle file %s", name)
+		}
+		step, err := fileConfigStep(name, target, files[name])
+		if err != nil {
+			return ConfigBundleManifest{}, err
+		}
+		steps = append(steps, step)
+	}
+	if crontab, ok := files[configBundleCrontabName]; ok {
+		previous, err := CrontabReadFunc()
+		if err != nil {
+			return ConfigBundleManifest{}, fmt.Errorf("read crontab: %w", err)
+		}
+		steps = append(steps, crontabConfigStep("crontab", previous, string(crontab)))
+	}
+	// The configuration goes last, like in a configuration update.
+	step, err := importedConfigStep(files[configBundleConfigName])
+	if err != nil {
+		return ConfigBundleManifest{}, err
+	}
+	steps = append(steps, step)
+
+	if err := applyConfigSteps(steps); err != nil {
+		return ConfigBundleManifest{}, err
+	}
+	log.Printf("Imported configuration bundle of %s created %s", manifest.DeviceName, manifest.CreatedAt.Format(time.RFC3339))
+	return manifest, nil
+}
+
+// HandleConfigurationExport returns the configuration bundle of the device.
+func HandleConfigurationExport(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	config := GetCurrentConfig()
+	var buf bytes.Buffer
+	if err := ExportConfigBundle(&buf, config); err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось экспортировать конфигурацию: %v", err)})
+		return
+	}
+	filename := fmt.Sprintf("media-pi-config-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
+
+// HandleConfigurationImport applies the configuration bundle in the request
+// body.
+func HandleConfigurationImport(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	unlock := lockConfigResources(w, configResourceConfig, configResourceTimers, configResourceCrontab, configResourceAudio)
+	if unlock == nil {
+		return
+	}
+	defer unlock()
+
+	manifest, err := ImportConfigBundle(http.MaxBytesReader(w, r.Body, maxConfigBundleSize))
+	if err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось импортировать конфигурацию, изменения отменены: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: ConfigBundleImportResponse{
+		Manifest: manifest,
+		Message:  "Конфигурация импортирована; выполните /api/menu/system/reload, чтобы применить unit-файлы",
+	}})
+}
@@ -0,0 +1,184 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupConfigBundleTest points every file of a bundle at a temp directory
+// and returns the directory and the crontab of the fake device.
+func setupConfigBundleTest(t *testing.T) (string, *string) {
+	t.Helper()
+	dir := t.TempDir()
+	unitDir := filepath.Join(dir, "systemd")
+
+	originalUnitDir, originalPlaylistTimer, originalVideoTimer, originalService, originalAudio := SystemdUnitDir, PlaylistTimerPath, VideoTimerPath, PlaylistServicePath, AudioConfigPath
+	originalRead, originalWrite := CrontabReadFunc, CrontabWriteFunc
+	t.Cleanup(func() {
+		SystemdUnitDir, PlaylistTimerPath, VideoTimerPath, PlaylistServicePath, AudioConfigPath = originalUnitDir, originalPlaylistTimer, originalVideoTimer, originalService, originalAudio
+		CrontabReadFunc, CrontabWriteFunc = originalRead, originalWrite
+	})
+	SystemdUnitDir = unitDir
+	PlaylistTimerPath = filepath.Join(unitDir, "playlist.upload.timer")
+	VideoTimerPath = filepath.Join(unitDir, "video.upload.timer")
+	PlaylistServicePath = filepath.Join(unitDir, "playlist.upload.service")
+	AudioConfigPath = filepath.Join(dir, "asound.conf")
+
+	crontab := new(string)
+	CrontabReadFunc = func() (string, error) { return *crontab, nil }
+	CrontabWriteFunc = func(content string) error {
+		*crontab = content
+		return nil
+	}
+	return dir, crontab
+}
+
+func writeBundleTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newConfigBundleKeys(t *testing.T) ConfigBundleConfig {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ConfigBundleConfig{
+		PrivateKey: base64.StdEncoding.EncodeToString(privateKey.Seed()),
+		PublicKey:  base64.StdEncoding.EncodeToString(publicKey),
+	}
+}
+
+func TestConfigBundleRoundTrip(t *testing.T) {
+	dir, crontab := setupConfigBundleTest(t)
+	keys := newConfigBundleKeys(t)
+
+	// Reference device.
+	writeBundleTestFile(t, PlaylistTimerPath, "[Timer]\nOnCalendar=*-*-* 03:00:00\n")
+	writeBundleTestFile(t, VideoTimerPath, "[Timer]\nOnCalendar=*-*-* 04:00:00\n")
+	writeBundleTestFile(t, AudioConfigPath, "defaults.pcm.card 1\n")
+	writeBundleTestFile(t, filepath.Join(SystemdUnitDir, "play.video.service.d", "volume.conf"), "[Service]\nEnvironment=VOLUME=50\n")
+	writeBundleTestFile(t, filepath.Join(SystemdUnitDir, "play.video.service.d", takeoverDropInName), "[Service]\nExecStart=\n")
+	writeBundleTestFile(t, filepath.Join(SystemdUnitDir, "other.service.d", "x.conf"), "[Service]\n")
+	*crontab = "0 22 * * * stop\n"
+	reference := Config{
+		ServerKey:    "reference-key",
+		DeviceName:   "store-12",
+		AllowedUnits: []string{"play.video.service"},
+		Playlist:     PlaylistConfig{Destination: filepath.Join(dir, "media")},
+		ConfigBundle: keys,
+		Revision:     7,
+	}
+
+	var bundle bytes.Buffer
+	if err := ExportConfigBundle(&bundle, reference); err != nil {
+		t.Fatalf("ExportConfigBundle() error = %v", err)
+	}
+
+	// Replacement device with its own key and a blank setup.
+	for _, path := range []string{PlaylistTimerPath, VideoTimerPath, AudioConfigPath} {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.RemoveAll(filepath.Join(SystemdUnitDir, "play.video.service.d")); err != nil {
+		t.Fatal(err)
+	}
+	*crontab = ""
+	configPath := filepath.Join(dir, "agent.yaml")
+	writeBundleTestFile(t, configPath, "server_key: replacement-key\nrevision: 2\nconfig_bundle:\n  public_key: "+keys.PublicKey+"\n")
+	setConfigPathForTest(t, configPath)
+	setCurrentConfigForTest(t, Config{})
+	if _, err := LoadConfigFrom(configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := ImportConfigBundle(bytes.NewReader(bundle.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportConfigBundle() error = %v", err)
+	}
+	if manifest.DeviceName != "store-12" {
+		t.Errorf("manifest device = %q", manifest.DeviceName)
+	}
+	for path, want := range map[string]string{
+		PlaylistTimerPath: "[Timer]\nOnCalendar=*-*-* 03:00:00\n",
+		VideoTimerPath:    "[Timer]\nOnCalendar=*-*-* 04:00:00\n",
+		AudioConfigPath:   "defaults.pcm.card 1\n",
+		filepath.Join(SystemdUnitDir, "play.video.service.d", "volume.conf"): "[Service]\nEnvironment=VOLUME=50\n",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", path, data, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(SystemdUnitDir, "play.video.service.d", takeoverDropInName)); !os.IsNotExist(err) {
+		t.Errorf("runtime drop-in must not be imported: %v", err)
+	}
+	if *crontab != "0 22 * * * stop\n" {
+		t.Errorf("crontab = %q", *crontab)
+	}
+
+	imported := GetCurrentConfig()
+	if imported.ServerKey != "replacement-key" || imported.DeviceName != "store-12" || imported.Revision != 3 {
+		t.Errorf("unexpected imported config: key %q, name %q, revision %d", imported.ServerKey, imported.DeviceName, imported.Revision)
+	}
+	if imported.ConfigBundle.PrivateKey != "" || imported.ConfigBundle.PublicKey != keys.PublicKey {
+		t.Errorf("bundle keys must stay those of the device: %+v", imported.ConfigBundle)
+	}
+}
+
+func TestImportConfigBundleRejectsForeignSignature(t *testing.T) {
+	dir, _ := setupConfigBundleTest(t)
+	var bundle bytes.Buffer
+	if err := ExportConfigBundle(&bundle, Config{ConfigBundle: newConfigBundleKeys(t)}); err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(dir, "agent.yaml")
+	writeBundleTestFile(t, configPath, "server_key: key\n")
+	setConfigPathForTest(t, configPath)
+	setCurrentConfigForTest(t, Config{ServerKey: "key", ConfigBundle: ConfigBundleConfig{PublicKey: newConfigBundleKeys(t).PublicKey}})
+
+	if _, err := ImportConfigBundle(&bundle); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+	if data, _ := os.ReadFile(configPath); string(data) != "server_key: key\n" {
+		t.Fatalf("config changed: %s", data)
+	}
+}
+
+func TestHandleConfigurationExportRequiresKey(t *testing.T) {
+	setupConfigBundleTest(t)
+	setCurrentConfigForTest(t, Config{ServerKey: "key"})
+
+	w := httptest.NewRecorder()
+	HandleConfigurationExport(w, httptest.NewRequest(http.MethodGet, "/api/configuration/export", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var resp APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.OK || !strings.Contains(resp.ErrMsg, "config_bundle.private_key") {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+// configStep is one change of a configuration transaction. rollback undoes
+// commit and is only called after commit succeeded.
+type configStep struct {
+	// name describes the step in error messages, in Russian like ErrMsg.
+	name     string
+	commit   func() error
+	rollback func() error
+}
+
+// configStepError reports the step that failed to commit.
+type configStepError struct {
+	step string
+	err  error
+}
+
+func (e *configStepError) Error() string {
+	return fmt.Sprintf("%s: %v", e.step, e.err)
+}
+
+func (e *configStepError) Unwrap() error { return e.err }
+
+// fileConfigStep replaces path with data. The current content is read now
+// and written back on rollback; a file that did not exist is removed.
+func fileConfigStep(name, path string, data []byte) (configStep, error) {
+	previous, err := os.ReadFile(path)
+	existed := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return configStep{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return configStep{
+		name:   name,
+		commit: func() error { return writeSystemFile(path, string(data)) },
+		rollback: func() error {
+			if !existed {
+				return removeSystemFile(path)
+			}
+			return writeSystemFile(path, string(previous))
+		},
+	}, nil
+}
+
+// crontabConfigStep replaces the crontab with content and restores previous
+// on rollback.
+func crontabConfigStep(name, previous, content string) configStep {
+	return configStep{
+		name:     name,
+		commit:   func() error { return CrontabWriteFunc(content) },
+		rollback: func() error { return CrontabWriteFunc(previous) },
+	}
+}
+
+// applyConfigSteps commits steps in order. When one fails, the steps already
+// committed are rolled back in reverse order so the device keeps its
+// previous configuration instead of a half-applied one.
+func applyConfigSteps(steps []configStep) error {
+	for i, step := range steps {
+		if err := step.commit(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if steps[j].rollback == nil {
+					continue
+				}
+				if rollbackErr := steps[j].rollback(); rollbackErr != nil {
+					log.Printf("Warning: failed to roll back %s: %v", steps[j].name, rollbackErr)
+				}
+			}
+			return &configStepError{step: step.name, err: err}
+		}
+	}
+	return nil
+}
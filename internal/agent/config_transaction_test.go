@@ -0,0 +1,130 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyConfigStepsRollsBackCommittedSteps(t *testing.T) {
+	tmp := t.TempDir()
+	existing := filepath.Join(tmp, "existing.conf")
+	created := filepath.Join(tmp, "new", "created.conf")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := fileConfigStep("existing", existing, []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := fileConfigStep("created", created, []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var thirdRolledBack bool
+	failing := configStep{
+		name:     "failing",
+		commit:   func() error { return errors.New("disk full") },
+		rollback: func() error { thirdRolledBack = true; return nil },
+	}
+
+	err = applyConfigSteps([]configStep{first, second, failing})
+	var stepErr *configStepError
+	if !errors.As(err, &stepErr) || stepErr.step != "failing" {
+		t.Fatalf("expected failing step error, got %v", err)
+	}
+	if data, err := os.ReadFile(existing); err != nil || string(data) != "old" {
+		t.Fatalf("expected existing file restored, got %q, %v", data, err)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Fatalf("expected created file removed, stat err = %v", err)
+	}
+	if thirdRolledBack {
+		t.Fatal("failed step must not be rolled back")
+	}
+}
+
+func TestHandleConfigurationUpdateRollsBackOnFailure(t *testing.T) {
+	tmp := t.TempDir()
+	servicePath := filepath.Join(tmp, "playlist.upload.service")
+	playlistTimer := filepath.Join(tmp, "playlist.upload.timer")
+	videoTimer := filepath.Join(tmp, "video.upload.timer")
+	audioPath := filepath.Join(tmp, "asound.conf")
+
+	originalServicePath := PlaylistServicePath
+	originalPlaylist := PlaylistTimerPath
+	originalVideo := VideoTimerPath
+	originalAudio := AudioConfigPath
+	PlaylistServicePath = servicePath
+	PlaylistTimerPath = playlistTimer
+	VideoTimerPath = videoTimer
+	AudioConfigPath = audioPath
+	t.Cleanup(func() {
+		PlaylistServicePath = originalServicePath
+		PlaylistTimerPath = originalPlaylist
+		VideoTimerPath = originalVideo
+		AudioConfigPath = originalAudio
+	})
+	config := Config{ServerKey: "key", Playlist: PlaylistConfig{Destination: "/var/media-pi"}, Audio: AudioConfig{Output: "hdmi"}}
+	setCurrentConfigForTest(t, config)
+
+	originals := map[string]string{
+		servicePath:   "[Service]\nExecStart = /usr/bin/rsync -a /src/ /var/media-pi/\n",
+		playlistTimer: "[Timer]\nOnCalendar=*-*-* 01:00:00\n",
+		audioPath:     "defaults.pcm.card 0\ndefaults.ctl.card 0\n",
+	}
+	for path, content := range originals {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	originalRead := CrontabReadFunc
+	originalWrite := CrontabWriteFunc
+	const crontab = "0 3 * * * /usr/bin/backup\n"
+	CrontabReadFunc = func() (string, error) { return crontab, nil }
+	var writes []string
+	CrontabWriteFunc = func(content string) error {
+		writes = append(writes, content)
+		return nil
+	}
+	t.Cleanup(func() {
+		CrontabReadFunc = originalRead
+		CrontabWriteFunc = originalWrite
+	})
+
+	// agent.yaml is written last; a missing directory makes it fail after
+	// every other file has been replaced.
+	setConfigPathForTest(t, filepath.Join(tmp, "missing", "agent.yaml"))
+
+	body := `{"revision":0,"playlist":{"destination":"/mnt/usb"},"schedule":{"playlist":["06:05"],"video":["22:22"],"rest":[{"start":"12:00","stop":"13:00"}]},"audio":{"output":"jack"}}`
+	w := httptest.NewRecorder()
+	HandleConfigurationUpdate(w, httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body)))
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "изменения отменены") {
+		t.Fatalf("expected rolled back failure, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for path, content := range originals {
+		if data, err := os.ReadFile(path); err != nil || string(data) != content {
+			t.Errorf("expected %s restored, got %q, %v", filepath.Base(path), data, err)
+		}
+	}
+	if _, err := os.Stat(videoTimer); !os.IsNotExist(err) {
+		t.Errorf("expected new video timer removed, stat err = %v", err)
+	}
+	if len(writes) != 2 || writes[1] != crontab {
+		t.Errorf("expected crontab written and restored, got %q", writes)
+	}
+	if got := GetCurrentConfig(); !reflect.DeepEqual(got, config) {
+		t.Errorf("expected in-memory config unchanged, got %+v", got)
+	}
+}
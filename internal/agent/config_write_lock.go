@@ -0,0 +1,68 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Resources written by configuration requests. A request takes the locks of
+// every resource it writes, so concurrent requests cannot interleave their
+// writes and rollbacks.
+const (
+	configResourceConfig  = "config"
+	configResourceTimers  = "timers"
+	configResourceCrontab = "crontab"
+	configResourceAudio   = "audio"
+)
+
+// configWriteRetryAfter is suggested to clients that hit a write in progress.
+var configWriteRetryAfter = 2 * time.Second
+
+var (
+	configWriteLock sync.Mutex
+	// configWritesHeld lists the resources being written, guarded by
+	// configWriteLock.
+	configWritesHeld = map[string]bool{}
+)
+
+// tryLockConfigResources takes the write locks of resources without
+// waiting: either all of them or none. busy names a resource another
+// request is writing when ok is false.
+func tryLockConfigResources(resources ...string) (unlock func(), busy string, ok bool) {
+	configWriteLock.Lock()
+	defer configWriteLock.Unlock()
+
+	for _, resource := range resources {
+		if configWritesHeld[resource] {
+			return nil, resource, false
+		}
+	}
+	for _, resource := range resources {
+		configWritesHeld[resource] = true
+	}
+	return func() {
+		configWriteLock.Lock()
+		defer configWriteLock.Unlock()
+		for _, resource := range resources {
+			delete(configWritesHeld, resource)
+		}
+	}, "", true
+}
+
+// lockConfigResources takes the write locks of resources for a request or
+// answers 409 with Retry-After and returns nil.
+func lockConfigResources(w http.ResponseWriter, resources ...string) (unlock func()) {
+	unlock, busy, ok := tryLockConfigResources(resources...)
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(configWriteRetryAfter/time.Second)))
+		JSONResponse(w, http.StatusConflict, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Другой запрос уже изменяет %s, повторите запрос позже", busy)})
+		return nil
+	}
+	return unlock
+}
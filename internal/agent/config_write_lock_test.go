@@ -0,0 +1,130 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTryLockConfigResourcesIsAllOrNothing(t *testing.T) {
+	unlockCrontab, _, ok := tryLockConfigResources(configResourceCrontab)
+	if !ok {
+		t.Fatal("expected the crontab lock")
+	}
+
+	if _, busy, ok := tryLockConfigResources(configResourceConfig, configResourceCrontab); ok || busy != configResourceCrontab {
+		t.Fatalf("expected crontab to be busy, got %q, %v", busy, ok)
+	}
+	// The failed attempt must not keep the config lock.
+	unlockConfig, _, ok := tryLockConfigResources(configResourceConfig)
+	if !ok {
+		t.Fatal("expected the config lock to be free")
+	}
+	unlockConfig()
+	unlockCrontab()
+
+	unlock, _, ok := tryLockConfigResources(configResourceConfig, configResourceCrontab)
+	if !ok {
+		t.Fatal("expected the locks to be free after unlocking")
+	}
+	unlock()
+}
+
+func TestHandleConfigurationUpdateConflict(t *testing.T) {
+	setCurrentConfigForTest(t, Config{ServerKey: "key", Playlist: PlaylistConfig{Destination: "/var/media-pi"}})
+	originalRead := CrontabReadFunc
+	CrontabReadFunc = func() (string, error) {
+		t.Error("crontab must not be read while another update holds it")
+		return "", errors.New("unexpected read")
+	}
+	t.Cleanup(func() { CrontabReadFunc = originalRead })
+
+	unlock, _, ok := tryLockConfigResources(configResourceCrontab)
+	if !ok {
+		t.Fatal("expected the crontab lock")
+	}
+	defer unlock()
+
+	body := `{"revision":0,"playlist":{"destination":"/mnt/usb"},"schedule":{"playlist":["06:05"],"video":["22:22"]},"audio":{"output":"jack"}}`
+	w := httptest.NewRecorder()
+	HandleConfigurationUpdate(w, httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body)))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Fatalf("Retry-After = %q, want 2", got)
+	}
+	if !strings.Contains(w.Body.String(), configResourceCrontab) {
+		t.Fatalf("expected the busy resource in the error, got %s", w.Body.String())
+	}
+}
+
+func TestHandleConfigurationUpdateRevision(t *testing.T) {
+	tmp := t.TempDir()
+	originalService, originalPlaylist, originalVideo, originalAudio := PlaylistServicePath, PlaylistTimerPath, VideoTimerPath, AudioConfigPath
+	PlaylistServicePath = filepath.Join(tmp, "playlist.upload.service")
+	PlaylistTimerPath = filepath.Join(tmp, "playlist.upload.timer")
+	VideoTimerPath = filepath.Join(tmp, "video.upload.timer")
+	AudioConfigPath = filepath.Join(tmp, "asound.conf")
+	originalRead, originalWrite := CrontabReadFunc, CrontabWriteFunc
+	CrontabReadFunc = func() (string, error) { return "", nil }
+	CrontabWriteFunc = func(string) error { return nil }
+	t.Cleanup(func() {
+		PlaylistServicePath, PlaylistTimerPath, VideoTimerPath, AudioConfigPath = originalService, originalPlaylist, originalVideo, originalAudio
+		CrontabReadFunc, CrontabWriteFunc = originalRead, originalWrite
+	})
+	if err := os.WriteFile(PlaylistServicePath, []byte("[Service]\nExecStart = /usr/bin/rsync -a /src/ /var/media-pi/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(tmp, "agent.yaml")
+	setConfigPathForTest(t, configPath)
+	setCurrentConfigForTest(t, Config{ServerKey: "key", Playlist: PlaylistConfig{Destination: "/var/media-pi"}, Revision: 3})
+
+	update := func(revision string) *httptest.ResponseRecorder {
+		body := `{` + revision + `"playlist":{"destination":"/mnt/usb"},"schedule":{"playlist":["06:05"],"video":["22:22"]},"audio":{"output":"jack"}}`
+		w := httptest.NewRecorder()
+		HandleConfigurationUpdate(w, httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body)))
+		return w
+	}
+
+	if w := update(""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 without a revision, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := update(`"revision":2,`); w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for a stale revision, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := GetCurrentConfig().Playlist.Destination; got != "/var/media-pi" {
+		t.Fatalf("expected a stale update to change nothing, destination = %q", got)
+	}
+	if w := update(`"revision":3,`); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	HandleConfigurationGet(w, httptest.NewRequest(http.MethodGet, "/api/menu/configuration/get", nil))
+	var resp struct {
+		Data ConfigurationSettings `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Revision != 4 {
+		t.Fatalf("expected revision 4 after the update, got %d", resp.Data.Revision)
+	}
+	if data, err := os.ReadFile(configPath); err != nil || !strings.Contains(string(data), "revision: 4") {
+		t.Fatalf("expected the revision saved, got %q, %v", data, err)
+	}
+
+	// The technician's update based on revision 3 is now stale.
+	if w := update(`"revision":3,`); w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 after another update, got %d: %s", w.Code, w.Body.String())
+	}
+}
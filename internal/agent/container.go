@@ -0,0 +1,105 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// stateRoot is the prefix set by SetStateRoot, "" on a device.
+var stateRoot string
+
+// rootedPaths are the files and directories the agent writes outside its
+// configuration. SetStateRoot moves all of them under one prefix.
+var rootedPaths = []*string{
+	&DefaultMediaDir,
+	&agentStateDir,
+	&legacyStateDir,
+	&syncStatusFilePath,
+	&manifestCacheFilePath,
+	&verifyCacheFilePath,
+	&manifestIndexFilePath,
+	&downloadQuarantineFilePath,
+	&uploadStateFilePath,
+	&profileStateFilePath,
+	&playStatsFilePath,
+	&execAuditLogPath,
+	&jobOutputDir,
+	&thumbnailDir,
+	&startupStateFilePath,
+	&syncPauseStateFilePath,
+	&takeoverStateFilePath,
+	&webStateFilePath,
+	&calendarStateFilePath,
+	&restoredFilesPath,
+	&crashDir,
+	&AudioConfigPath,
+	&PlaylistTimerPath,
+	&VideoTimerPath,
+	&PlaylistServicePath,
+	&SystemdUnitDir,
+	&FstabPath,
+	&NetworkMountCredentialsDir,
+	&DavfsSecretsPath,
+	&OverlayImageDir,
+}
+
+// SetStateRoot prefixes every path the agent writes (media, sync state,
+// crash reports, asound.conf, unit files, fstab) with root, so a container
+// or CI job runs the agent unchanged with a writable directory. It must be
+// called once, before the configuration is loaded.
+func SetStateRoot(root string) {
+	if root == "" || root == "/" {
+		return
+	}
+	stateRoot = root
+	for _, path := range rootedPaths {
+		*path = filepath.Join(root, *path)
+	}
+}
+
+// RootedPath returns path under the state root set by SetStateRoot.
+func RootedPath(path string) string {
+	if stateRoot == "" {
+		return path
+	}
+	return filepath.Join(stateRoot, path)
+}
+
+// containerMarkers are files container runtimes create in the container
+// (Docker and Podman). Tests may override it.
+var containerMarkers = []string{"/.dockerenv", "/run/.containerenv"}
+
+// inContainer runs the detection once. Tests may override it.
+var inContainer = sync.OnceValue(detectContainer)
+
+// InContainer reports whether the agent runs in a container, where
+// host-only features (WireGuard, USB import, display, brightness, power and
+// presence monitors) are disabled. MEDIA_PI_AGENT_CONTAINER=1 or 0
+// overrides the detection.
+func InContainer() bool {
+	return inContainer()
+}
+
+func detectContainer() bool {
+	switch os.Getenv("MEDIA_PI_AGENT_CONTAINER") {
+	case "1":
+		return true
+	case "0":
+		return false
+	}
+	// systemd-nspawn, Podman and LXC set $container for PID 1.
+	if strings.TrimSpace(os.Getenv("container")) != "" {
+		return true
+	}
+	for _, marker := range containerMarkers {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+	return false
+}
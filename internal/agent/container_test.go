@@ -0,0 +1,68 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetStateRoot(t *testing.T) {
+	saved := make([]string, len(rootedPaths))
+	for i, path := range rootedPaths {
+		saved[i] = *path
+	}
+	t.Cleanup(func() {
+		stateRoot = ""
+		for i, path := range rootedPaths {
+			*path = saved[i]
+		}
+	})
+
+	SetStateRoot("/srv/agent")
+	if DefaultMediaDir != "/srv/agent/var/media-pi" || AudioConfigPath != "/srv/agent/etc/asound.conf" {
+		t.Fatalf("media dir %q, asound.conf %q", DefaultMediaDir, AudioConfigPath)
+	}
+	if syncStatusFilePath != "/srv/agent/var/lib/media-pi-agent/sync-status.json" || SystemdUnitDir != "/srv/agent/etc/systemd/system" {
+		t.Fatalf("sync status %q, unit dir %q", syncStatusFilePath, SystemdUnitDir)
+	}
+	if got := RootedPath("/etc/media-pi-agent/agent.yaml"); got != "/srv/agent/etc/media-pi-agent/agent.yaml" {
+		t.Fatalf("RootedPath = %q", got)
+	}
+	if got := mediaDirFor(Config{}); got != "/srv/agent/var/media-pi" {
+		t.Fatalf("mediaDirFor = %q", got)
+	}
+}
+
+func TestDetectContainer(t *testing.T) {
+	original := containerMarkers
+	t.Cleanup(func() { containerMarkers = original })
+	marker := filepath.Join(t.TempDir(), ".dockerenv")
+	containerMarkers = []string{marker}
+	t.Setenv("container", "")
+
+	t.Setenv("MEDIA_PI_AGENT_CONTAINER", "")
+	if detectContainer() {
+		t.Fatal("no marker, no container")
+	}
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !detectContainer() {
+		t.Fatal("the marker file must be detected")
+	}
+	t.Setenv("MEDIA_PI_AGENT_CONTAINER", "0")
+	if detectContainer() {
+		t.Fatal("MEDIA_PI_AGENT_CONTAINER=0 must override the detection")
+	}
+	t.Setenv("MEDIA_PI_AGENT_CONTAINER", "")
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("container", "podman")
+	if !detectContainer() {
+		t.Fatal("$container must be detected")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// contentStoreDirName is the directory inside the media directory that holds
+// downloaded files keyed by their SHA256. Manifest filenames are exposed as
+// hardlinks (or symlinks where hardlinks are unsupported) to store entries.
+const contentStoreDirName = ".store"
+
+func contentStoreDir(mediaDir string) string {
+	return filepath.Join(mediaDir, contentStoreDirName)
+}
+
+// contentStorePath returns the store location for a SHA256 digest. It
+// reports false when the digest is not a well-formed hex SHA256, so manifest
+// values can never be used to escape the store directory.
+func contentStorePath(mediaDir, sha string) (string, bool) {
+	sha = strings.ToLower(strings.TrimSpace(sha))
+	if len(sha) != 64 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(sha); err != nil {
+		return "", false
+	}
+	return filepath.Join(contentStoreDir(mediaDir), sha[:2], sha), true
+}
+
+// syncItemViaContentStore makes fullPath reference a verified store entry for
+// item, fetching the content only when the store does not already hold it.
+func syncItemViaContentStore(ctx context.Context, config Config, mediaDir string, item ManifestItem, fullPath string, fetch fetchItemFunc) error {
+	storePath, ok := contentStorePath(mediaDir, item.SHA256)
+	if !ok {
+		return fetch(ctx, config, item, fullPath)
+	}
+
+	if valid, err := verifyLocalFile(storePath, item); err != nil || !valid {
+		if err := os.MkdirAll(filepath.Dir(storePath), 0755); err != nil {
+			return fmt.Errorf("failed to create content store directory: %w", err)
+		}
+		log.Printf("Downloading %s (ID: %d, size: %d bytes) into content store", item.Filename, item.ID, item.FileSizeBytes)
+		if err := fetch(ctx, config, item, storePath); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("Reusing stored content for %s (sha256 %s)", item.Filename, item.SHA256)
+	}
+
+	return linkIntoPlace(storePath, fullPath)
+}
+
+// adoptIntoContentStore records an already valid media file in the store so
+// libraries synced before the store was enabled become deduplicated without
+// another download. Failures are not fatal; the file simply stays unshared.
+func adoptIntoContentStore(mediaDir string, item ManifestItem, fullPath string) {
+	storePath, ok := contentStorePath(mediaDir, item.SHA256)
+	if !ok {
+		return
+	}
+	if _, err := os.Stat(storePath); err == nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(storePath), 0755); err != nil {
+		log.Printf("Warning: failed to create content store directory: %v", err)
+		return
+	}
+	if err := os.Link(fullPath, storePath); err != nil {
+		log.Printf("Warning: failed to add %s to content store: %v", fullPath, err)
+	}
+}
+
+// linkIntoPlace atomically replaces dest with a hardlink to src, falling back
+// to a symlink on filesystems without hardlink support (e.g. FAT on USB).
+// A symlinked name depends on the store entry; see pruneContentStore.
+func linkIntoPlace(src, dest string) error {
+	tmpPath := dest + ".tmp"
+	_ = os.Remove(tmpPath)
+	if err := os.Link(src, tmpPath); err != nil {
+		if serr := os.Symlink(src, tmpPath); serr != nil {
+			return fmt.Errorf("failed to link %s from content store: %v (symlink: %v)", dest, err, serr)
+		}
+	}
+	if err := os.Rename(tmpPath, dest); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename linked file: %w", err)
+	}
+	return nil
+}
+
+// pruneContentStore removes store entries whose digest is not referenced by
+// the current manifest. A media name hardlinked to an entry keeps its
+// content when the entry goes, but one that linkIntoPlace had to symlink
+// would dangle, so entries still targeted by a symlink in the media
+// directory or its trash are kept.
+func pruneContentStore(mediaDir string, referenced map[string]struct{}) error {
+	storeDir := contentStoreDir(mediaDir)
+	if _, err := os.Stat(storeDir); os.IsNotExist(err) {
+		return nil
+	}
+	targets := contentStoreSymlinkTargets(mediaDir)
+
+	var errs []string
+	err := filepath.Walk(storeDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if filepath.Ext(path) == ".tmp" {
+			return nil
+		}
+		if _, ok := referenced[strings.ToLower(info.Name())]; ok {
+			return nil
+		}
+		if _, ok := targets[path]; ok {
+			return nil
+		}
+		log.Printf("Pruning unreferenced content store entry: %s", path)
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", path, err))
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("walk error: %v", err))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// contentStoreSymlinkTargets returns the store entries symlinks in mediaDir
+// point to.
+func contentStoreSymlinkTargets(mediaDir string) map[string]struct{} {
+	storeDir := contentStoreDir(mediaDir)
+	targets := make(map[string]struct{})
+	_ = filepath.Walk(mediaDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && path == storeDir {
+			return filepath.SkipDir
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		if target = filepath.Clean(target); strings.HasPrefix(target, storeDir+string(filepath.Separator)) {
+			targets[target] = struct{}{}
+		}
+		return nil
+	})
+	return targets
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestContentStorePathRejectsMalformedDigests(t *testing.T) {
+	mediaDir := t.TempDir()
+	for _, sha := range []string{"", "abc", "../../etc/passwd", strings.Repeat("z", 64)} {
+		if _, ok := contentStorePath(mediaDir, sha); ok {
+			t.Errorf("contentStorePath(%q) accepted malformed digest", sha)
+		}
+	}
+
+	digest := sha256Hex("x")
+	path, ok := contentStorePath(mediaDir, strings.ToUpper(digest))
+	if !ok {
+		t.Fatal("expected valid digest to be accepted")
+	}
+	want := filepath.Join(mediaDir, contentStoreDirName, digest[:2], digest)
+	if path != want {
+		t.Errorf("contentStorePath() = %q, want %q", path, want)
+	}
+}
+
+func TestSyncFilesContentStoreAvoidsRedownloadOnRename(t *testing.T) {
+	content := "video bytes"
+	digest := sha256Hex(content)
+
+	var downloads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&downloads, 1)
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	mediaDir := t.TempDir()
+	config := Config{
+		CoreAPIBase: server.URL,
+		ServerKey:   "test-key",
+		Playlist:    PlaylistConfig{Destination: mediaDir},
+		Sync:        SyncConfig{ContentStore: true},
+	}
+
+	first := Manifest{{ID: 1, Filename: "old.mp4", FileSizeBytes: int64(len(content)), SHA256: digest}}
+	if err := syncFiles(context.Background(), config, &first); err != nil {
+		t.Fatalf("first syncFiles() error = %v", err)
+	}
+
+	renamed := Manifest{{ID: 1, Filename: "sub/new.mp4", FileSizeBytes: int64(len(content)), SHA256: digest}}
+	if err := syncFiles(context.Background(), config, &renamed); err != nil {
+		t.Fatalf("second syncFiles() error = %v", err)
+	}
+
+	if got := atomic.LoadInt32(&downloads); got != 1 {
+		t.Fatalf("expected a single download, got %d", got)
+	}
+	data, err := os.ReadFile(filepath.Join(mediaDir, "sub", "new.mp4"))
+	if err != nil || string(data) != content {
+		t.Fatalf("renamed file not materialized: %v %q", err, data)
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "old.mp4")); !os.IsNotExist(err) {
+		t.Fatalf("expected old name to be garbage collected, stat err = %v", err)
+	}
+	storePath, _ := contentStorePath(mediaDir, digest)
+	if _, err := os.Stat(storePath); err != nil {
+		t.Fatalf("expected store entry to survive garbage collection: %v", err)
+	}
+}
+
+func TestSyncFilesPrunesUnreferencedStoreEntries(t *testing.T) {
+	mediaDir := t.TempDir()
+	unused := sha256Hex("unused")
+	storePath, _ := contentStorePath(mediaDir, unused)
+	if err := os.MkdirAll(filepath.Dir(storePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(storePath, []byte("unused"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{Playlist: PlaylistConfig{Destination: mediaDir}, Sync: SyncConfig{ContentStore: true}}
+	if err := syncFiles(context.Background(), config, &Manifest{}); err != nil {
+		t.Fatalf("syncFiles() error = %v", err)
+	}
+	if _, err := os.Stat(storePath); !os.IsNotExist(err) {
+		t.Fatalf("expected unreferenced store entry to be pruned, stat err = %v", err)
+	}
+}
+
+func TestPruneContentStoreKeepsSymlinkTargets(t *testing.T) {
+	mediaDir := t.TempDir()
+	storePath, _ := contentStorePath(mediaDir, sha256Hex("linked"))
+	if err := os.MkdirAll(filepath.Dir(storePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(storePath, []byte("linked"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A name in the trash still points at the entry, as linkIntoPlace
+	// leaves it on filesystems without hardlinks.
+	link := filepath.Join(trashDir(mediaDir), "20260101T000000.000000000Z", "linked.mp4")
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(storePath, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pruneContentStore(mediaDir, map[string]struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(link); err != nil || string(data) != "linked" {
+		t.Fatalf("expected the symlinked entry to be kept, got %q, %v", data, err)
+	}
+
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := pruneContentStore(mediaDir, map[string]struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(storePath); !os.IsNotExist(err) {
+		t.Fatalf("expected the entry to be pruned once unlinked, stat err = %v", err)
+	}
+}
+
+func TestSyncFilesAdoptsExistingFilesIntoStore(t *testing.T) {
+	mediaDir := t.TempDir()
+	content := "already here"
+	digest := sha256Hex(content)
+	existing := filepath.Join(mediaDir, "clip.mp4")
+	if err := os.WriteFile(existing, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{Playlist: PlaylistConfig{Destination: mediaDir}, Sync: SyncConfig{ContentStore: true}}
+	manifest := Manifest{{ID: 7, Filename: "clip.mp4", FileSizeBytes: int64(len(content)), SHA256: digest}}
+	if err := syncFiles(context.Background(), config, &manifest); err != nil {
+		t.Fatalf("syncFiles() error = %v", err)
+	}
+
+	storePath, _ := contentStorePath(mediaDir, digest)
+	storeInfo, err := os.Stat(storePath)
+	if err != nil {
+		t.Fatalf("expected existing file to be adopted: %v", err)
+	}
+	fileInfo, _ := os.Stat(existing)
+	if !os.SameFile(storeInfo, fileInfo) {
+		t.Fatalf("expected store entry to be a hardlink of the media file")
+	}
+}
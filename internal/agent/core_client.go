@@ -0,0 +1,423 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPClientConfig describes the shared HTTP client used for all core API
+// communication. Zero values are replaced with defaults by LoadConfigFrom.
+type HTTPClientConfig struct {
+	ConnectTimeout        time.Duration `yaml:"connect_timeout,omitempty"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout,omitempty"`
+	KeepAlive             time.Duration `yaml:"keep_alive,omitempty"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout,omitempty"`
+	MaxIdleConns          int           `yaml:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost   int           `yaml:"max_idle_conns_per_host,omitempty"`
+	TLSCAFile             string        `yaml:"tls_ca_file,omitempty"`
+	TLSInsecureSkipVerify bool          `yaml:"tls_insecure_skip_verify,omitempty"`
+	// TLSPins are SPKI pins of the core API certificate chain; see
+	// parseTLSPins.
+	TLSPins []string `yaml:"tls_pins,omitempty"`
+	// MaxRetries limits retries on 429 and 503; 0 disables them. See
+	// DefaultHTTPMaxRetries.
+	MaxRetries    *int          `yaml:"max_retries,omitempty"`
+	MaxRetryAfter time.Duration `yaml:"max_retry_after,omitempty"`
+}
+
+// Defaults for the shared core API HTTP client.
+const (
+	DefaultHTTPConnectTimeout        = 10 * time.Second
+	DefaultHTTPResponseHeaderTimeout = 30 * time.Second
+	DefaultHTTPKeepAlive             = 30 * time.Second
+	DefaultHTTPIdleConnTimeout       = 90 * time.Second
+	DefaultHTTPMaxIdleConns          = 10
+	DefaultHTTPMaxIdleConnsPerHost   = 4
+	DefaultHTTPMaxRetries            = 2
+	DefaultHTTPMaxRetryAfter         = 60 * time.Second
+)
+
+// Per-request timeouts for core API calls. They bound the whole exchange,
+// including reading the response body.
+var (
+	manifestRequestTimeout   = 30 * time.Second
+	downloadRequestTimeout   = 5 * time.Minute
+	playlistRequestTimeout   = 30 * time.Second
+	screenshotRequestTimeout = 30 * time.Second
+
+	// defaultRetryAfter is used when a 429 response carries no usable Retry-After header.
+	defaultRetryAfter = time.Second
+
+	// retrySleep waits before retrying a throttled request. Tests may override it.
+	retrySleep = sleepContext
+
+	// backoffJitter returns a random duration in [0, d) added to computed
+	// backoffs, so devices throttled together do not retry together.
+	// Tests may override it.
+	backoffJitter = func(d time.Duration) time.Duration {
+		if d <= 0 {
+			return 0
+		}
+		return rand.N(d)
+	}
+)
+
+// CoreClient is the HTTP client shared by all core API communication. It
+// owns a single transport so connections are reused between manifest,
+// download, playlist and screenshot requests.
+type CoreClient struct {
+	client        *http.Client
+	maxRetries    int
+	maxRetryAfter time.Duration
+
+	// backoff holds the throttling state of each endpoint; see
+	// coreEndpoint.
+	backoffLock sync.Mutex
+	backoff     map[string]*endpointBackoff
+}
+
+// endpointBackoff is the throttling state of one core endpoint. Requests
+// wait until until; failures counts throttled responses in a row.
+type endpointBackoff struct {
+	failures int
+	until    time.Time
+}
+
+var (
+	coreClientMu sync.RWMutex
+	coreClient   *CoreClient
+)
+
+// DefaultHTTPClientConfig returns the default shared HTTP client settings.
+func DefaultHTTPClientConfig() HTTPClientConfig {
+	return HTTPClientConfig{
+		ConnectTimeout:        DefaultHTTPConnectTimeout,
+		ResponseHeaderTimeout: DefaultHTTPResponseHeaderTimeout,
+		KeepAlive:             DefaultHTTPKeepAlive,
+		IdleConnTimeout:       DefaultHTTPIdleConnTimeout,
+		MaxIdleConns:          DefaultHTTPMaxIdleConns,
+		MaxIdleConnsPerHost:   DefaultHTTPMaxIdleConnsPerHost,
+		MaxRetries:            httpMaxRetries(DefaultHTTPMaxRetries),
+		MaxRetryAfter:         DefaultHTTPMaxRetryAfter,
+	}
+}
+
+// httpMaxRetries returns a MaxRetries value.
+func httpMaxRetries(retries int) *int {
+	return &retries
+}
+
+// applyHTTPClientDefaults fills unset fields of cfg with defaults.
+func applyHTTPClientDefaults(cfg *HTTPClientConfig) {
+	defaults := DefaultHTTPClientConfig()
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = defaults.ConnectTimeout
+	}
+	if cfg.ResponseHeaderTimeout <= 0 {
+		cfg.ResponseHeaderTimeout = defaults.ResponseHeaderTimeout
+	}
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = defaults.KeepAlive
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = defaults.IdleConnTimeout
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = defaults.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = defaults.MaxIdleConnsPerHost
+	}
+	if cfg.MaxRetries == nil {
+		cfg.MaxRetries = defaults.MaxRetries
+	}
+	if cfg.MaxRetryAfter <= 0 {
+		cfg.MaxRetryAfter = defaults.MaxRetryAfter
+	}
+}
+
+// NewCoreClient builds a CoreClient from cfg. Unset fields use defaults.
+func NewCoreClient(cfg HTTPClientConfig) (*CoreClient, error) {
+	applyHTTPClientDefaults(&cfg)
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify, // #nosec G402 -- explicit opt-in for lab setups
+	}
+	if caFile := strings.TrimSpace(cfg.TLSCAFile); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls_ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls_ca_file %q contains no PEM certificates", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	pins, err := parseTLSPins(cfg.TLSPins)
+	if err != nil {
+		return nil, err
+	}
+	if len(pins) > 0 {
+		tlsConfig.VerifyConnection = verifyCorePins(pins)
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.ConnectTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   cfg.ConnectTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		ForceAttemptHTTP2:     true,
+	}
+
+	return &CoreClient{
+		client:        &http.Client{Transport: transport},
+		maxRetries:    max(*cfg.MaxRetries, 0),
+		maxRetryAfter: cfg.MaxRetryAfter,
+		backoff:       map[string]*endpointBackoff{},
+	}, nil
+}
+
+// SetCoreClient overrides the shared core API client. Passing nil makes the
+// next request build a client from the default settings.
+func SetCoreClient(client *CoreClient) {
+	coreClientMu.Lock()
+	defer coreClientMu.Unlock()
+	coreClient = client
+}
+
+func getCoreClient() *CoreClient {
+	coreClientMu.RLock()
+	client := coreClient
+	coreClientMu.RUnlock()
+	if client != nil {
+		return client
+	}
+
+	coreClientMu.Lock()
+	defer coreClientMu.Unlock()
+	if coreClient == nil {
+		// Defaults never reference files, so building cannot fail.
+		coreClient, _ = NewCoreClient(DefaultHTTPClientConfig())
+	}
+	return coreClient
+}
+
+// Do sends req, bounding the whole exchange by timeout when it is positive.
+// Core requests are signed when request_signing.enabled is set. Responses
+// with HTTP 429 or 503 are retried up to the configured limit, honouring
+// the Retry-After header; without it the wait doubles with every throttled
+// response of the endpoint. Later requests to a throttled endpoint wait
+// for the backoff too. The caller must close the response body.
+func (c *CoreClient) Do(ctx context.Context, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	endpoint := coreEndpoint(req)
+	if wait := c.backoffRemaining(endpoint, time.Now()); wait > 0 {
+		log.Printf("Core API endpoint %s is backing off, waiting %s", endpoint, wait.Round(time.Millisecond))
+		if err := retrySleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+
+		attemptReq := req.Clone(attemptCtx)
+		if session := syncSessionFrom(ctx); session != "" && attemptReq.Header.Get(syncSessionHeader) == "" {
+			attemptReq.Header.Set(syncSessionHeader, session)
+		}
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				cancel()
+				return nil, fmt.Errorf("rewind request body: %w", err)
+			}
+			attemptReq.Body = body
+		}
+
+		var config Config
+		var nonce string
+		coreRequest := isCoreRequest(req)
+		if coreRequest {
+			config = GetCurrentConfig()
+		}
+		if coreRequest && config.RequestSigning.Enabled {
+			var err error
+			if nonce, err = signCoreRequest(attemptReq, config, time.Now()); err != nil {
+				cancel()
+				return nil, fmt.Errorf("sign request: %w", err)
+			}
+		}
+
+		resp, err := c.client.Do(attemptReq)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if nonce != "" && config.RequestSigning.VerifyResponses {
+			if err := verifyCoreResponse(resp, config, nonce); err != nil {
+				metricAdd(metricResponseSignatureFailures, 1)
+				_ = resp.Body.Close()
+				cancel()
+				return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, err)
+			}
+		}
+		if coreRequest {
+			noteCoreResponse(resp, time.Now())
+		}
+
+		throttled := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		if !throttled {
+			c.resetBackoff(endpoint)
+		}
+		var wait time.Duration
+		if throttled {
+			wait = c.noteThrottled(endpoint, resp.Header.Get("Retry-After"), time.Now())
+		}
+		canRetry := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+		if !throttled || attempt >= c.maxRetries || !canRetry {
+			resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+		cancel()
+
+		log.Printf("Core API throttled %s %s (HTTP %d), retrying in %s", req.Method, req.URL.Path, resp.StatusCode, wait.Round(time.Millisecond))
+		if err := retrySleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// coreEndpoint names the endpoint of req for backoff: the method, host and
+// path with numeric segments (item IDs) replaced by {id}.
+func coreEndpoint(req *http.Request) string {
+	segments := strings.Split(req.URL.Path, "/")
+	for i, segment := range segments {
+		if _, err := strconv.ParseInt(segment, 10, 64); err == nil {
+			segments[i] = "{id}"
+		}
+	}
+	return req.Method + " " + req.URL.Host + strings.Join(segments, "/")
+}
+
+// backoffRemaining returns how long requests to endpoint still wait.
+func (c *CoreClient) backoffRemaining(endpoint string, now time.Time) time.Duration {
+	c.backoffLock.Lock()
+	defer c.backoffLock.Unlock()
+	if state, ok := c.backoff[endpoint]; ok && now.Before(state.until) {
+		return state.until.Sub(now)
+	}
+	return 0
+}
+
+// noteThrottled records a throttled response of endpoint and returns the
+// backoff: Retry-After when the core sent it, otherwise defaultRetryAfter
+// doubled for every throttled response in a row, plus jitter. Both are
+// capped at max_retry_after.
+func (c *CoreClient) noteThrottled(endpoint, retryAfter string, now time.Time) time.Duration {
+	c.backoffLock.Lock()
+	defer c.backoffLock.Unlock()
+	state, ok := c.backoff[endpoint]
+	if !ok {
+		state = &endpointBackoff{}
+		c.backoff[endpoint] = state
+	}
+	state.failures++
+
+	var wait time.Duration
+	if strings.TrimSpace(retryAfter) != "" {
+		wait = parseRetryAfter(retryAfter, now)
+	} else {
+		wait = defaultRetryAfter << min(state.failures-1, 16)
+		wait += backoffJitter(wait / 2)
+	}
+	if wait > c.maxRetryAfter {
+		wait = c.maxRetryAfter
+	}
+	state.until = now.Add(wait)
+	return wait
+}
+
+// resetBackoff forgets the throttling of endpoint after a normal response.
+func (c *CoreClient) resetBackoff(endpoint string) {
+	c.backoffLock.Lock()
+	delete(c.backoff, endpoint)
+	c.backoffLock.Unlock()
+}
+
+// parseRetryAfter interprets a Retry-After header value given either as a
+// number of seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultRetryAfter
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return defaultRetryAfter
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := at.Sub(now); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// cancelOnCloseBody releases the per-request context once the caller has
+// finished reading the response body.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,290 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func stubRetrySleep(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var waits []time.Duration
+	original := retrySleep
+	retrySleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return ctx.Err()
+	}
+	t.Cleanup(func() { retrySleep = original })
+	return &waits
+}
+
+func TestCoreClientRetriesOn429WithRetryAfter(t *testing.T) {
+	waits := stubRetrySleep(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client, err := NewCoreClient(HTTPClientConfig{})
+	if err != nil {
+		t.Fatalf("NewCoreClient() error = %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.Do(context.Background(), req, time.Second)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 after retry, got %d", resp.StatusCode)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
+	}
+	if len(*waits) != 1 || (*waits)[0] != 7*time.Second {
+		t.Fatalf("expected single 7s wait, got %v", *waits)
+	}
+}
+
+func TestCoreClientStopsRetryingAfterLimit(t *testing.T) {
+	waits := stubRetrySleep(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client, err := NewCoreClient(HTTPClientConfig{MaxRetries: httpMaxRetries(1), MaxRetryAfter: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("NewCoreClient() error = %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+	resp, err := client.Do(context.Background(), req, time.Second)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected final 429, got %d", resp.StatusCode)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("expected 2 calls, got %d", calls)
+	}
+	if len(*waits) != 1 || (*waits)[0] != 5*time.Second {
+		t.Fatalf("expected wait clamped to 5s, got %v", *waits)
+	}
+}
+
+func TestCoreClientMaxRetriesZeroDisablesRetries(t *testing.T) {
+	waits := stubRetrySleep(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := HTTPClientConfig{MaxRetries: httpMaxRetries(0)}
+	applyHTTPClientDefaults(&cfg)
+	if *cfg.MaxRetries != 0 {
+		t.Fatalf("max_retries: 0 must not be replaced by the default, got %d", *cfg.MaxRetries)
+	}
+	client, err := NewCoreClient(cfg)
+	if err != nil {
+		t.Fatalf("NewCoreClient() error = %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.Do(context.Background(), req, time.Second)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if atomic.LoadInt32(&calls) != 1 || len(*waits) != 0 {
+		t.Fatalf("expected a single call without waits, got %d calls, waits %v", calls, *waits)
+	}
+
+	cfg = HTTPClientConfig{}
+	applyHTTPClientDefaults(&cfg)
+	if *cfg.MaxRetries != DefaultHTTPMaxRetries {
+		t.Fatalf("unset max_retries = %d, want %d", *cfg.MaxRetries, DefaultHTTPMaxRetries)
+	}
+}
+
+func TestCoreClientTimeoutCoversRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewCoreClient(HTTPClientConfig{})
+	if err != nil {
+		t.Fatalf("NewCoreClient() error = %v", err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	if _, err := client.Do(context.Background(), req, 50*time.Millisecond); err == nil {
+		t.Fatal("expected timeout error")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", defaultRetryAfter},
+		{"15", 15 * time.Second},
+		{"-1", defaultRetryAfter},
+		{"garbage", defaultRetryAfter},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNewCoreClientRejectsInvalidCAFile(t *testing.T) {
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caPath, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("write ca: %v", err)
+	}
+	if _, err := NewCoreClient(HTTPClientConfig{TLSCAFile: caPath}); err == nil {
+		t.Fatal("expected error for CA file without certificates")
+	}
+	if _, err := NewCoreClient(HTTPClientConfig{TLSCAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Fatal("expected error for missing CA file")
+	}
+}
+
+func TestLoadConfigFromAppliesHTTPClientSettings(t *testing.T) {
+	t.Cleanup(func() { SetCoreClient(nil) })
+
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	data := "server_key: key\nhttp_client:\n  connect_timeout: 3s\n  max_retries: 5\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	cfg, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFrom() error = %v", err)
+	}
+	if cfg.HTTPClient.ConnectTimeout != 3*time.Second {
+		t.Errorf("connect timeout = %v, want 3s", cfg.HTTPClient.ConnectTimeout)
+	}
+	if cfg.HTTPClient.MaxRetries == nil || *cfg.HTTPClient.MaxRetries != 5 {
+		t.Errorf("max retries = %v, want 5", cfg.HTTPClient.MaxRetries)
+	}
+	if cfg.HTTPClient.IdleConnTimeout != DefaultHTTPIdleConnTimeout {
+		t.Errorf("idle timeout = %v, want default", cfg.HTTPClient.IdleConnTimeout)
+	}
+	if getCoreClient().maxRetries != 5 {
+		t.Errorf("shared client was not rebuilt from config")
+	}
+
+	out, err := yaml.Marshal(cfg.HTTPClient)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(out), "connect_timeout: 3s") {
+		t.Errorf("expected durations to round-trip as strings, got:\n%s", out)
+	}
+
+	badPath := filepath.Join(t.TempDir(), "bad.yaml")
+	bad := "server_key: key\nhttp_client:\n  tls_ca_file: /nonexistent/ca.pem\n"
+	if err := os.WriteFile(badPath, []byte(bad), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if _, err := LoadConfigFrom(badPath); err == nil {
+		t.Fatal("expected error for invalid tls_ca_file")
+	}
+}
+
+func TestCoreClientBacksOffPerEndpointOn503(t *testing.T) {
+	waits := stubRetrySleep(t)
+	originalJitter := backoffJitter
+	backoffJitter = func(time.Duration) time.Duration { return 0 }
+	t.Cleanup(func() { backoffJitter = originalJitter })
+
+	var manifestCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/devicesync" && atomic.AddInt32(&manifestCalls, 1) <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client, err := NewCoreClient(HTTPClientConfig{MaxRetries: httpMaxRetries(1)})
+	if err != nil {
+		t.Fatalf("NewCoreClient() error = %v", err)
+	}
+	get := func(path string) int {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		resp, err := client.Do(context.Background(), req, time.Second)
+		if err != nil {
+			t.Fatalf("Do(%s) error = %v", path, err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := get("/api/devicesync"); status != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 after the retry, got %d", status)
+	}
+	if len(*waits) != 1 || (*waits)[0] != defaultRetryAfter {
+		t.Fatalf("expected one %s wait, got %v", defaultRetryAfter, *waits)
+	}
+	// Other endpoints are not held back.
+	if status := get("/api/devicesync/42"); status != http.StatusOK || len(*waits) != 1 {
+		t.Fatalf("download: status %d, waits %v", status, *waits)
+	}
+	// The next manifest request waits for the doubled backoff first.
+	if status := get("/api/devicesync"); status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if len(*waits) != 3 || (*waits)[1] <= time.Second || (*waits)[2] != 4*defaultRetryAfter {
+		t.Fatalf("expected adaptive waits, got %v", *waits)
+	}
+	if remaining := client.backoffRemaining(coreEndpoint(httptest.NewRequest(http.MethodGet, server.URL+"/api/devicesync", nil)), time.Now()); remaining != 0 {
+		t.Fatalf("a successful response must reset the backoff, %s left", remaining)
+	}
+}
+
+func TestCoreEndpoint(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://core/api/devicesync/123?x=1", nil)
+	if got := coreEndpoint(req); got != "GET core/api/devicesync/{id}" {
+		t.Fatalf("coreEndpoint = %q", got)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestSigningConfig controls HMAC signatures of core API requests. The
+// static X-Device-Id header carries server_key itself, so captured traffic
+// could be replayed; signed requests prove knowledge of the key instead.
+type RequestSigningConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// KeepDeviceID still sends X-Device-Id while the core is migrated to
+	// signatures.
+	KeepDeviceID bool `yaml:"keep_device_id,omitempty"`
+	// VerifyResponses rejects core responses without a valid signature.
+	VerifyResponses bool `yaml:"verify_responses,omitempty"`
+}
+
+// Headers of signed core requests and responses.
+const (
+	deviceKeyIDHeader        = "X-Device-Key-Id"
+	signatureTimestampHeader = "X-Signature-Timestamp"
+	signatureNonceHeader     = "X-Signature-Nonce"
+	signatureHeader          = "X-Signature"
+	// contentDigestHeader carries the SHA-256 of a signed response body
+	// as in RFC 9530, "sha-256=:<base64>:".
+	contentDigestHeader = "Content-Digest"
+
+	// unsignedPayload replaces the body digest of streamed bodies that
+	// cannot be read twice.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+
+	metricResponseSignatureFailures = "media_pi_core_response_signature_failures_total"
+)
+
+func init() {
+	registerCounter(metricResponseSignatureFailures, "Core responses rejected because of a missing or invalid signature.")
+}
+
+// errResponseSignature is returned for core responses that fail
+// request_signing.verify_responses.
+var errResponseSignature = errors.New("core response signature is missing or invalid")
+
+// deviceKeyID identifies the device key without revealing it: the first 8
+// bytes of SHA-256 of server_key, hex encoded.
+func deviceKeyID(serverKey string) string {
+	sum := sha256.Sum256([]byte(serverKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// coreTime returns now on the core clock as estimated from the Date
+// headers of its responses, so a device with a wrong clock still signs
+// fresh timestamps.
+func coreTime(now time.Time) time.Time {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	if clockDriftKnown {
+		return now.Add(-clockDrift)
+	}
+	return now
+}
+
+// requestBodyDigest returns the hex SHA-256 of the request body, or
+// unsignedPayload when the body cannot be replayed.
+func requestBodyDigest(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return hex.EncodeToString(sha256.New().Sum(nil)), nil
+	}
+	if req.GetBody == nil {
+		return unsignedPayload, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", fmt.Errorf("read request body: %w", err)
+	}
+	defer func() { _ = body.Close() }()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", fmt.Errorf("read request body: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// requestSigningString is the signed representation of a request:
+// method, path with query, timestamp, nonce and body digest on separate
+// lines.
+func requestSigningString(method, uri, timestamp, nonce, bodyDigest string) string {
+	return strings.Join([]string{method, uri, timestamp, nonce, bodyDigest}, "\n")
+}
+
+// responseSigningString binds a response to the nonce of its request, so
+// a recorded response cannot be replayed to another request, and to the
+// hex SHA-256 of its body, so the body cannot be swapped.
+func responseSigningString(nonce string, status int, date, bodyDigest string) string {
+	return strings.Join([]string{"response", nonce, strconv.Itoa(status), date, bodyDigest}, "\n")
+}
+
+// parseContentDigest returns the sha-256 digest of a Content-Digest
+// header in hex.
+func parseContentDigest(header string) (string, bool) {
+	for _, entry := range strings.Split(header, ",") {
+		algorithm, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || !strings.EqualFold(algorithm, "sha-256") {
+			continue
+		}
+		value, ok = strings.CutPrefix(value, ":")
+		if !ok {
+			return "", false
+		}
+		value, ok = strings.CutSuffix(value, ":")
+		if !ok {
+			return "", false
+		}
+		sum, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(sum) != sha256.Size {
+			return "", false
+		}
+		return hex.EncodeToString(sum), true
+	}
+	return "", false
+}
+
+// digestCheckingBody fails the read that reaches the end of a signed
+// response body when the body does not match its signed digest. Bodies
+// are streamed, so the check cannot happen before the caller reads.
+type digestCheckingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	want string
+}
+
+func (b *digestCheckingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(b.hash.Sum(nil)) != b.want {
+		metricAdd(metricResponseSignatureFailures, 1)
+		return n, errResponseSignature
+	}
+	return n, err
+}
+
+func hmacSignature(key, message string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(message))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signCoreRequest adds the signature headers to req and returns its nonce.
+// Each attempt of a retried request is signed with a new nonce.
+func signCoreRequest(req *http.Request, config Config, now time.Time) (string, error) {
+	if config.ServerKey == "" {
+		return "", errors.New("server_key not configured")
+	}
+	digest, err := requestBodyDigest(req)
+	if err != nil {
+		return "", err
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(raw)
+	timestamp := strconv.FormatInt(coreTime(now).Unix(), 10)
+
+	if !config.RequestSigning.KeepDeviceID {
+		req.Header.Del("X-Device-Id")
+	}
+	req.Header.Set(deviceKeyIDHeader, deviceKeyID(config.ServerKey))
+	req.Header.Set(signatureTimestampHeader, timestamp)
+	req.Header.Set(signatureNonceHeader, nonce)
+	req.Header.Set(signatureHeader, hmacSignature(config.ServerKey, requestSigningString(req.Method, req.URL.RequestURI(), timestamp, nonce, digest)))
+	return nonce, nil
+}
+
+// verifyCoreResponse checks the X-Signature of a response to the request
+// signed with nonce. The body is checked against the signed
+// Content-Digest while it is read.
+func verifyCoreResponse(resp *http.Response, config Config, nonce string) error {
+	got, err := base64.StdEncoding.DecodeString(resp.Header.Get(signatureHeader))
+	if err != nil || len(got) == 0 {
+		return errResponseSignature
+	}
+	digest, ok := parseContentDigest(resp.Header.Get(contentDigestHeader))
+	if !ok {
+		return errResponseSignature
+	}
+	want, _ := base64.StdEncoding.DecodeString(hmacSignature(config.ServerKey, responseSigningString(nonce, resp.StatusCode, resp.Header.Get("Date"), digest)))
+	if !hmac.Equal(got, want) {
+		return errResponseSignature
+	}
+	resp.Body = &digestCheckingBody{ReadCloser: resp.Body, hash: sha256.New(), want: digest}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signingCore checks request signatures the way the core does and signs
+// its responses.
+func signingCore(t *testing.T, key string, signResponses bool, seen map[string]bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		nonce := r.Header.Get(signatureNonceHeader)
+		timestamp := r.Header.Get(signatureTimestampHeader)
+		want := hmacSignature(key, requestSigningString(r.Method, r.URL.RequestURI(), timestamp, nonce, hex.EncodeToString(sum[:])))
+		switch {
+		case r.Header.Get("X-Device-Id") != "":
+			t.Errorf("server_key sent in X-Device-Id")
+		case r.Header.Get(deviceKeyIDHeader) != deviceKeyID(key):
+			t.Errorf("unexpected key id %q", r.Header.Get(deviceKeyIDHeader))
+		case r.Header.Get(signatureHeader) != want:
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		case seen[nonce]:
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if unix, _ := strconv.ParseInt(timestamp, 10, 64); time.Since(time.Unix(unix, 0)).Abs() > time.Minute {
+			t.Errorf("stale timestamp %s", timestamp)
+		}
+		seen[nonce] = true
+		if signResponses {
+			signTestResponse(w, key, nonce, nil)
+		}
+	}
+}
+
+// signTestResponse signs a 200 response with body the way the core does.
+func signTestResponse(w http.ResponseWriter, key, nonce string, body []byte) {
+	sum := sha256.Sum256(body)
+	date := time.Now().UTC().Format(http.TimeFormat)
+	w.Header().Set("Date", date)
+	w.Header().Set(contentDigestHeader, "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+	w.Header().Set(signatureHeader, hmacSignature(key, responseSigningString(nonce, http.StatusOK, date, hex.EncodeToString(sum[:]))))
+}
+
+func TestCoreClientSignsRequests(t *testing.T) {
+	seen := map[string]bool{}
+	server := httptest.NewServer(signingCore(t, "device-key", true, seen))
+	defer server.Close()
+	setCurrentConfigForTest(t, Config{CoreAPIBase: server.URL, ServerKey: "device-key",
+		RequestSigning: RequestSigningConfig{Enabled: true, VerifyResponses: true}})
+	client, err := NewCoreClient(HTTPClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"", `{"files":["a.mp4"]}`, `{"files":["a.mp4"]}`} {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/devicesync/report?x=1", reader)
+		req.Header.Set("X-Device-Id", "device-key")
+		resp, err := client.Do(context.Background(), req, 0)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d for body %q", resp.StatusCode, body)
+		}
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected a new nonce per request, got %d", len(seen))
+	}
+}
+
+func TestCoreClientRejectsUnsignedResponses(t *testing.T) {
+	server := httptest.NewServer(signingCore(t, "device-key", false, map[string]bool{}))
+	defer server.Close()
+	setCurrentConfigForTest(t, Config{CoreAPIBase: server.URL, ServerKey: "device-key",
+		RequestSigning: RequestSigningConfig{Enabled: true, VerifyResponses: true}})
+	client, err := NewCoreClient(HTTPClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/devicesync", nil)
+	if _, err := client.Do(context.Background(), req, 0); !errors.Is(err, errResponseSignature) {
+		t.Fatalf("expected errResponseSignature, got %v", err)
+	}
+}
+
+func TestCoreClientRejectsTamperedResponseBody(t *testing.T) {
+	manifest := []byte(`[{"id":1,"filename":"a.mp4"}]`)
+	tamper := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The signed headers are kept; only the body is swapped.
+		signTestResponse(w, "device-key", r.Header.Get(signatureNonceHeader), manifest)
+		if tamper {
+			_, _ = w.Write([]byte(`[{"id":1,"filename":"evil.mp4"}]`))
+			return
+		}
+		_, _ = w.Write(manifest)
+	}))
+	defer server.Close()
+	setCurrentConfigForTest(t, Config{CoreAPIBase: server.URL, ServerKey: "device-key",
+		RequestSigning: RequestSigningConfig{Enabled: true, VerifyResponses: true}})
+	client, err := NewCoreClient(HTTPClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tamper = range []bool{false, true} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/devicesync", nil)
+		resp, err := client.Do(context.Background(), req, 0)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if tamper && !errors.Is(err, errResponseSignature) {
+			t.Fatalf("tampered body: expected errResponseSignature, got %v", err)
+		}
+		if !tamper && (err != nil || string(body) != string(manifest)) {
+			t.Fatalf("signed body: %q, %v", body, err)
+		}
+	}
+
+	if _, ok := parseContentDigest("sha-512=:AAAA:, sha-256=:" + base64.StdEncoding.EncodeToString(make([]byte, 32)) + ":"); !ok {
+		t.Error("sha-256 entry of a Content-Digest list not found")
+	}
+	if _, ok := parseContentDigest("sha-256=:AAAA:"); ok {
+		t.Error("a short digest must be rejected")
+	}
+}
+
+func TestCoreTimeFollowsCoreClock(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	setCurrentConfigForTest(t, Config{})
+	t.Cleanup(func() {
+		clockMu.Lock()
+		clockDrift, clockDriftKnown = 0, false
+		clockMu.Unlock()
+	})
+	// The local clock is an hour behind the core.
+	recordCoreDate(now.Add(time.Hour).Format(http.TimeFormat), now)
+	if got := coreTime(now); !got.Equal(now.Add(time.Hour)) {
+		t.Fatalf("coreTime() = %v, want the core time", got)
+	}
+}
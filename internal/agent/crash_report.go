@@ -0,0 +1,325 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CrashReportConfig controls crash reports. A crash is a panic or fatal
+// runtime error, or any exit that was not a shutdown on SIGTERM/SIGINT. The
+// report is written on the next start and uploaded to the core.
+type CrashReportConfig struct {
+	// Disabled turns crash capture and upload off.
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Endpoint receives the reports instead of
+	// {core_api_base}/api/devicesync/crash-report.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// LogLines is how many journal lines of the crashed run are included.
+	LogLines int `yaml:"log_lines,omitempty"`
+}
+
+// Defaults for crash reports.
+const (
+	DefaultCrashReportLogLines = 50
+	// maxCrashReports bounds the reports kept while the core is unreachable.
+	maxCrashReports = 10
+	// maxCrashStackBytes bounds the stack trace kept in a report.
+	maxCrashStackBytes = 256 << 10
+
+	crashReportRequestTimeout = 30 * time.Second
+)
+
+// Crash kinds.
+const (
+	CrashKindPanic        = "panic"
+	CrashKindAbnormalExit = "abnormal-exit"
+)
+
+const (
+	crashOutputFileName    = "crash-output.log"
+	crashRunMarkerFileName = "running.json"
+)
+
+var (
+	// crashDir holds the run marker, the crash output of the runtime and
+	// the reports waiting for upload. It is kept with the agent state, out
+	// of reach of sync garbage collection.
+	crashDir = filepath.Join(agentStateDir, "crash")
+
+	// setCrashOutput is debug.SetCrashOutput; tests may override it.
+	setCrashOutput = debug.SetCrashOutput
+
+	// crashLogLines returns the last journal lines of the process pid.
+	// Tests may override it.
+	crashLogLines = func(ctx context.Context, pid, lines int) ([]string, error) {
+		output, err := exec.CommandContext(ctx, "journalctl", "_PID="+strconv.Itoa(pid),
+			"-n", strconv.Itoa(lines), "--no-pager", "-o", "short-iso").Output()
+		if err != nil {
+			return nil, err
+		}
+		text := strings.TrimRight(string(output), "\n")
+		if text == "" {
+			return nil, nil
+		}
+		return strings.Split(text, "\n"), nil
+	}
+)
+
+// crashRun describes the running agent. It is written at startup and
+// removed on a clean shutdown, so a leftover marker means the previous run
+// did not end cleanly.
+type crashRun struct {
+	PID               int       `json:"pid"`
+	StartedAt         time.Time `json:"startedAt"`
+	Version           string    `json:"version"`
+	ConfigRevision    int64     `json:"configRevision"`
+	ConfigFingerprint string    `json:"configFingerprint"`
+}
+
+// CrashReport is uploaded to the core after a crash.
+type CrashReport struct {
+	Kind              string    `json:"kind"`
+	DetectedAt        time.Time `json:"detectedAt"`
+	StartedAt         time.Time `json:"startedAt"`
+	Version           string    `json:"version"`
+	DeviceName        string    `json:"deviceName,omitempty"`
+	ConfigRevision    int64     `json:"configRevision"`
+	ConfigFingerprint string    `json:"configFingerprint,omitempty"`
+	Stack             string    `json:"stack,omitempty"`
+	LogLines          []string  `json:"logLines,omitempty"`
+}
+
+func crashReportLogLines(config CrashReportConfig) int {
+	if config.LogLines > 0 {
+		return config.LogLines
+	}
+	return DefaultCrashReportLogLines
+}
+
+// configFingerprint hashes the config file so a crash can be matched with
+// the configuration it ran with without sending the configuration itself.
+func configFingerprint(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// BeginCrashCapture turns a crash of the previous run into a report,
+// starts uploading pending reports and arranges for a crash of this run to
+// be recorded. It does nothing when crash_report.disabled is set.
+func BeginCrashCapture() {
+	config := GetCurrentConfig()
+	if config.CrashReport.Disabled {
+		return
+	}
+	if err := os.MkdirAll(crashDir, 0755); err != nil {
+		log.Printf("Warning: crash reports disabled: %v", err)
+		return
+	}
+
+	if report, ok := collectCrashReport(context.Background(), config); ok {
+		log.Printf("Previous run ended abnormally (%s), saving crash report", report.Kind)
+		if err := saveCrashReport(report); err != nil {
+			log.Printf("Warning: failed to save crash report: %v", err)
+		}
+	}
+
+	run := crashRun{
+		PID:               os.Getpid(),
+		StartedAt:         time.Now().UTC(),
+		Version:           GetVersion(),
+		ConfigRevision:    config.Revision,
+		ConfigFingerprint: configFingerprint(ConfigPath),
+	}
+	if err := writeStateFile(filepath.Join(crashDir, crashRunMarkerFileName), run); err != nil {
+		log.Printf("Warning: failed to write run marker: %v", err)
+	}
+
+	output, err := os.OpenFile(filepath.Join(crashDir, crashOutputFileName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		log.Printf("Warning: failed to open crash output: %v", err)
+	} else {
+		// The runtime keeps its own duplicate of the descriptor.
+		if err := setCrashOutput(output, debug.CrashOptions{}); err != nil {
+			log.Printf("Warning: failed to set crash output: %v", err)
+		}
+		_ = output.Close()
+	}
+
+	reports, err := pendingCrashReports()
+	if err != nil || len(reports) == 0 {
+		return
+	}
+	go func() {
+		if err := uploadCrashReports(context.Background(), config, reports); err != nil {
+			log.Printf("Warning: failed to upload crash reports: %v", err)
+		}
+	}()
+}
+
+// EndCrashCapture records a clean shutdown so the next start does not
+// report a crash.
+func EndCrashCapture() {
+	if GetCurrentConfig().CrashReport.Disabled {
+		return
+	}
+	marker := filepath.Join(crashDir, crashRunMarkerFileName)
+	for _, path := range []string{marker, marker + stateBackupExt} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: failed to remove run marker: %v", err)
+		}
+	}
+}
+
+// collectCrashReport builds a report from the run marker and the crash
+// output left by the previous run. It reports false when that run ended
+// cleanly.
+func collectCrashReport(ctx context.Context, config Config) (CrashReport, bool) {
+	marker := filepath.Join(crashDir, crashRunMarkerFileName)
+	var run crashRun
+	runErr := readStateFile(marker, &run)
+	if runErr != nil && !errors.Is(runErr, os.ErrNotExist) {
+		log.Printf("Warning: ignoring run marker: %v", runErr)
+	}
+	_ = os.Remove(marker)
+	_ = os.Remove(marker + stateBackupExt)
+
+	stack, _ := os.ReadFile(filepath.Join(crashDir, crashOutputFileName))
+	if len(stack) > maxCrashStackBytes {
+		stack = stack[:maxCrashStackBytes]
+	}
+
+	report := CrashReport{
+		DetectedAt:        time.Now().UTC(),
+		StartedAt:         run.StartedAt,
+		Version:           run.Version,
+		DeviceName:        config.DeviceName,
+		ConfigRevision:    run.ConfigRevision,
+		ConfigFingerprint: run.ConfigFingerprint,
+		Stack:             string(stack),
+	}
+	switch {
+	case len(bytes.TrimSpace(stack)) > 0:
+		report.Kind = CrashKindPanic
+	case runErr == nil:
+		report.Kind = CrashKindAbnormalExit
+	default:
+		return CrashReport{}, false
+	}
+
+	if run.PID > 0 {
+		logCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		lines, err := crashLogLines(logCtx, run.PID, crashReportLogLines(config.CrashReport))
+		cancel()
+		if err != nil {
+			log.Printf("Warning: failed to read the journal of the crashed run: %v", err)
+		}
+		report.LogLines = lines
+	}
+	return report, true
+}
+
+// saveCrashReport queues report for upload, dropping the oldest reports
+// beyond maxCrashReports.
+func saveCrashReport(report CrashReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("report-%d.json", report.DetectedAt.UnixNano())
+	if err := writeFileSync(filepath.Join(crashDir, name), data, 0644); err != nil {
+		return err
+	}
+	reports, err := pendingCrashReports()
+	if err != nil {
+		return err
+	}
+	for len(reports) > maxCrashReports {
+		_ = os.Remove(reports[0])
+		reports = reports[1:]
+	}
+	return nil
+}
+
+// pendingCrashReports lists the queued reports, oldest first.
+func pendingCrashReports() ([]string, error) {
+	reports, err := filepath.Glob(filepath.Join(crashDir, "report-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(reports)
+	return reports, nil
+}
+
+// crashReportURL returns crash_report.endpoint or the core endpoint.
+func crashReportURL(config Config) (string, error) {
+	if endpoint := strings.TrimSpace(config.CrashReport.Endpoint); endpoint != "" {
+		return endpoint, nil
+	}
+	if strings.TrimSpace(config.CoreAPIBase) == "" {
+		return "", fmt.Errorf("core_api_base not configured")
+	}
+	return strings.TrimRight(config.CoreAPIBase, "/") + "/api/devicesync/crash-report", nil
+}
+
+// uploadCrashReports sends the queued reports and removes the accepted ones.
+// Reports that fail stay queued for the next start.
+func uploadCrashReports(ctx context.Context, config Config, reports []string) error {
+	url, err := crashReportURL(config)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(config.ServerKey) == "" {
+		return fmt.Errorf("server_key not configured")
+	}
+
+	for _, path := range reports {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Device-Id", config.ServerKey)
+
+		resp, err := getCoreClient().Do(ctx, req, crashReportRequestTimeout)
+		if err != nil {
+			return fmt.Errorf("post crash report: %w", err)
+		}
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		log.Printf("Uploaded crash report %s", filepath.Base(path))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+	"time"
+)
+
+func setupCrashReportTest(t *testing.T) {
+	t.Helper()
+	originalDir, originalSetOutput, originalLogLines := crashDir, setCrashOutput, crashLogLines
+	t.Cleanup(func() {
+		crashDir, setCrashOutput, crashLogLines = originalDir, originalSetOutput, originalLogLines
+	})
+	crashDir = t.TempDir()
+	setCrashOutput = func(*os.File, debug.CrashOptions) error { return nil }
+	crashLogLines = func(_ context.Context, pid, lines int) ([]string, error) {
+		if pid != 4242 {
+			t.Errorf("journal read for pid %d", pid)
+		}
+		return []string{"last line"}, nil
+	}
+}
+
+func TestCollectCrashReport(t *testing.T) {
+	setupCrashReportTest(t)
+	config := Config{DeviceName: "store-12"}
+
+	if _, ok := collectCrashReport(context.Background(), config); ok {
+		t.Fatal("expected no report after a clean shutdown")
+	}
+
+	run := crashRun{PID: 4242, Version: "1.2.3", ConfigRevision: 7, ConfigFingerprint: "abc"}
+	if err := writeStateFile(filepath.Join(crashDir, crashRunMarkerFileName), run); err != nil {
+		t.Fatal(err)
+	}
+	report, ok := collectCrashReport(context.Background(), config)
+	if !ok || report.Kind != CrashKindAbnormalExit || report.Version != "1.2.3" || report.ConfigRevision != 7 ||
+		report.ConfigFingerprint != "abc" || report.DeviceName != "store-12" || len(report.LogLines) != 1 {
+		t.Fatalf("unexpected report %+v, %v", report, ok)
+	}
+	if _, ok := collectCrashReport(context.Background(), config); ok {
+		t.Fatal("the marker must be consumed")
+	}
+
+	if err := writeStateFile(filepath.Join(crashDir, crashRunMarkerFileName), run); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(crashDir, crashOutputFileName), []byte("panic: boom\n\ngoroutine 1 [running]:\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, ok = collectCrashReport(context.Background(), config)
+	if !ok || report.Kind != CrashKindPanic || report.Stack == "" {
+		t.Fatalf("unexpected report %+v, %v", report, ok)
+	}
+}
+
+func TestBeginCrashCaptureDisabled(t *testing.T) {
+	setupCrashReportTest(t)
+	setCurrentConfigForTest(t, Config{CrashReport: CrashReportConfig{Disabled: true}})
+
+	BeginCrashCapture()
+	if entries, _ := os.ReadDir(crashDir); len(entries) != 0 {
+		t.Fatalf("expected nothing written, got %d entries", len(entries))
+	}
+}
+
+func TestCrashCaptureCleanShutdown(t *testing.T) {
+	setupCrashReportTest(t)
+	setCurrentConfigForTest(t, Config{})
+
+	BeginCrashCapture()
+	if _, err := os.Stat(filepath.Join(crashDir, crashRunMarkerFileName)); err != nil {
+		t.Fatalf("expected run marker: %v", err)
+	}
+	EndCrashCapture()
+	if _, ok := collectCrashReport(context.Background(), Config{}); ok {
+		t.Fatal("expected no report after a clean shutdown")
+	}
+}
+
+func TestUploadCrashReports(t *testing.T) {
+	setupCrashReportTest(t)
+	var received []CrashReport
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/devicesync/crash-report" || r.Header.Get("X-Device-Id") != "key" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		if fail {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var report CrashReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Error(err)
+		}
+		received = append(received, report)
+	}))
+	defer server.Close()
+
+	for i := 0; i < maxCrashReports+2; i++ {
+		report := CrashReport{Kind: CrashKindPanic, Version: "1.2.3", DetectedAt: time.Date(2026, 3, 1, 10, 0, i, 0, time.UTC)}
+		if err := saveCrashReport(report); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := Config{CoreAPIBase: server.URL, ServerKey: "key"}
+
+	reports, err := pendingCrashReports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := uploadCrashReports(context.Background(), config, reports); err == nil {
+		t.Fatal("expected an error from the core")
+	}
+	if reports, _ := pendingCrashReports(); len(reports) != maxCrashReports {
+		t.Fatalf("expected %d queued reports, got %d", maxCrashReports, len(reports))
+	}
+
+	fail = false
+	if err := uploadCrashReports(context.Background(), config, reports); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != maxCrashReports {
+		t.Fatalf("expected %d uploaded reports, got %d", maxCrashReports, len(received))
+	}
+	if reports, _ := pendingCrashReports(); len(reports) != 0 {
+		t.Fatalf("expected uploaded reports removed, got %v", reports)
+	}
+}
+
+func TestCrashReportURL(t *testing.T) {
+	if url, err := crashReportURL(Config{CoreAPIBase: "https://core/"}); err != nil || url != "https://core/api/devicesync/crash-report" {
+		t.Fatalf("url = %q, %v", url, err)
+	}
+	if url, err := crashReportURL(Config{CrashReport: CrashReportConfig{Endpoint: "https://crash.example/report"}}); err != nil || url != "https://crash.example/report" {
+		t.Fatalf("url = %q, %v", url, err)
+	}
+	if _, err := crashReportURL(Config{}); err == nil {
+		t.Fatal("expected an error without core_api_base")
+	}
+}
+
+func TestGarbageCollectionKeepsCrashState(t *testing.T) {
+	rootStatePaths(t)
+	paths := []string{
+		filepath.Join(crashDir, crashRunMarkerFileName),
+		filepath.Join(crashDir, crashOutputFileName),
+		filepath.Join(crashDir, "report-1.json"),
+	}
+	if garbage := garbageNextTo(t, paths...); len(garbage) != 0 {
+		t.Fatalf("crash state must not be garbage collected: %v", garbage)
+	}
+}
@@ -21,7 +21,14 @@ type DBusConnection interface {
 	RestartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error)
 	EnableUnitFilesContext(ctx context.Context, files []string, runtime, force bool) (bool, []dbus.EnableUnitFileChange, error)
 	DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error)
+	MaskUnitFilesContext(ctx context.Context, files []string, runtime, force bool) ([]dbus.MaskUnitFileChange, error)
+	UnmaskUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.UnmaskUnitFileChange, error)
 	GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error)
+	// GetUnitTypePropertiesContext returns the properties of the unit type
+	// interface, e.g. "Timer".
+	GetUnitTypePropertiesContext(ctx context.Context, unit, unitType string) (map[string]any, error)
+	StartTransientUnitContext(ctx context.Context, name, mode string, properties []dbus.Property, ch chan<- string) (int, error)
+	ResetFailedUnitContext(ctx context.Context, name string) error
 	RebootContext(ctx context.Context) error
 	PowerOffContext(ctx context.Context) error
 }
@@ -38,6 +45,15 @@ func defaultDBusConnectionFactory(ctx context.Context) (DBusConnection, error) {
 	if os.Getenv("MEDIA_PI_AGENT_MOCK_DBUS") == "1" {
 		return &noopDBusConnection{}, nil
 	}
+	// An unprivileged agent goes through the privileged helper.
+	if socket := helperSocketPath(); socket != "" {
+		return &helperDBusConnection{socket: socket}, nil
+	}
+	return systemDBusConnection(ctx)
+}
+
+// systemDBusConnection connects to systemd and logind directly.
+func systemDBusConnection(ctx context.Context) (DBusConnection, error) {
 	// Create the systemd manager connection
 	sysconn, err := dbus.NewWithContext(ctx)
 	if err != nil {
@@ -72,6 +88,9 @@ func getDBusConnection(ctx context.Context) (DBusConnection, error) {
 	dbusFactoryMu.RLock()
 	factory := dbusFactory
 	dbusFactoryMu.RUnlock()
+	if err := injectDBusDelay(ctx); err != nil {
+		return nil, err
+	}
 	return factory(ctx)
 }
 
@@ -122,6 +141,14 @@ func (n *noopDBusConnection) DisableUnitFilesContext(ctx context.Context, files
 	return nil, nil
 }
 
+func (n *noopDBusConnection) MaskUnitFilesContext(ctx context.Context, files []string, runtime, force bool) ([]dbus.MaskUnitFileChange, error) {
+	return nil, nil
+}
+
+func (n *noopDBusConnection) UnmaskUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.UnmaskUnitFileChange, error) {
+	return nil, nil
+}
+
 func (n *noopDBusConnection) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error) {
 	return map[string]any{
 		"ActiveState": "inactive",
@@ -129,6 +156,18 @@ func (n *noopDBusConnection) GetUnitPropertiesContext(ctx context.Context, unit
 	}, nil
 }
 
+func (n *noopDBusConnection) GetUnitTypePropertiesContext(ctx context.Context, unit, unitType string) (map[string]any, error) {
+	return map[string]any{}, nil
+}
+
+func (n *noopDBusConnection) StartTransientUnitContext(ctx context.Context, name, mode string, properties []dbus.Property, ch chan<- string) (int, error) {
+	return 1, nil
+}
+
+func (n *noopDBusConnection) ResetFailedUnitContext(ctx context.Context, name string) error {
+	return nil
+}
+
 func (n *noopDBusConnection) RebootContext(ctx context.Context) error {
 	return nil
 }
@@ -147,7 +186,12 @@ type systemdConn interface {
 	RestartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error)
 	EnableUnitFilesContext(ctx context.Context, files []string, runtime, force bool) (bool, []dbus.EnableUnitFileChange, error)
 	DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error)
+	MaskUnitFilesContext(ctx context.Context, files []string, runtime, force bool) ([]dbus.MaskUnitFileChange, error)
+	UnmaskUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.UnmaskUnitFileChange, error)
 	GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error)
+	GetUnitTypePropertiesContext(ctx context.Context, unit, unitType string) (map[string]any, error)
+	StartTransientUnitContext(ctx context.Context, name, mode string, properties []dbus.Property, ch chan<- string) (int, error)
+	ResetFailedUnitContext(ctx context.Context, name string) error
 }
 
 type login1Conn interface {
@@ -197,10 +241,30 @@ func (r *realDBusConnection) DisableUnitFilesContext(ctx context.Context, files
 	return r.sys.DisableUnitFilesContext(ctx, files, runtime)
 }
 
+func (r *realDBusConnection) MaskUnitFilesContext(ctx context.Context, files []string, runtime, force bool) ([]dbus.MaskUnitFileChange, error) {
+	return r.sys.MaskUnitFilesContext(ctx, files, runtime, force)
+}
+
+func (r *realDBusConnection) UnmaskUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.UnmaskUnitFileChange, error) {
+	return r.sys.UnmaskUnitFilesContext(ctx, files, runtime)
+}
+
 func (r *realDBusConnection) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error) {
 	return r.sys.GetUnitPropertiesContext(ctx, unit)
 }
 
+func (r *realDBusConnection) GetUnitTypePropertiesContext(ctx context.Context, unit, unitType string) (map[string]any, error) {
+	return r.sys.GetUnitTypePropertiesContext(ctx, unit, unitType)
+}
+
+func (r *realDBusConnection) StartTransientUnitContext(ctx context.Context, name, mode string, properties []dbus.Property, ch chan<- string) (int, error) {
+	return r.sys.StartTransientUnitContext(ctx, name, mode, properties, ch)
+}
+
+func (r *realDBusConnection) ResetFailedUnitContext(ctx context.Context, name string) error {
+	return r.sys.ResetFailedUnitContext(ctx, name)
+}
+
 // RebootContext delegates to login1.Conn.Reboot. login1's API does not
 // accept a context, so we call it directly. The askForAuth flag is set to
 // false to match the previous behavior of calling reboot without prompting.
@@ -40,9 +40,24 @@ func (f *fakeConn) EnableUnitFilesContext(ctx context.Context, files []string, r
 func (f *fakeConn) DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
 	return nil, nil
 }
+func (f *fakeConn) MaskUnitFilesContext(ctx context.Context, files []string, runtime, force bool) ([]dbus.MaskUnitFileChange, error) {
+	return nil, nil
+}
+func (f *fakeConn) UnmaskUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.UnmaskUnitFileChange, error) {
+	return nil, nil
+}
 func (f *fakeConn) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error) {
 	return map[string]any{}, nil
 }
+func (f *fakeConn) GetUnitTypePropertiesContext(ctx context.Context, unit, unitType string) (map[string]any, error) {
+	return map[string]any{}, nil
+}
+func (f *fakeConn) StartTransientUnitContext(ctx context.Context, name, mode string, properties []dbus.Property, ch chan<- string) (int, error) {
+	return 1, nil
+}
+func (f *fakeConn) ResetFailedUnitContext(ctx context.Context, name string) error {
+	return nil
+}
 func (f *fakeConn) RebootContext(ctx context.Context) error   { return nil }
 func (f *fakeConn) PowerOffContext(ctx context.Context) error { return nil }
 
@@ -141,3 +156,27 @@ func TestHandleSystemReloadUsesNormalTimeoutForDBusConnection(t *testing.T) {
 		t.Fatalf("expected playback restart D-Bus connection to use longer playback timeout, got %s", playbackTimeout)
 	}
 }
+
+func TestUnitHandlersUseRequestContext(t *testing.T) {
+	originalFactory := dbusFactory
+	originalUnits := AllowedUnits
+	t.Cleanup(func() {
+		SetDBusConnectionFactory(originalFactory)
+		AllowedUnits = originalUnits
+	})
+	AllowedUnits = map[string]struct{}{"test.service": {}}
+
+	type ctxKey struct{}
+	var seen []any
+	SetDBusConnectionFactory(func(ctx context.Context) (DBusConnection, error) {
+		seen = append(seen, ctx.Value(ctxKey{}))
+		return &fakeConn{}, nil
+	})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	HandleListUnits(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/units", nil).WithContext(ctx))
+	HandleUnitStatus(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/units/status?unit=test.service", nil).WithContext(ctx))
+	if len(seen) != 2 || seen[0] != "request" || seen[1] != "request" {
+		t.Fatalf("expected D-Bus connections derived from the request context, got %v", seen)
+	}
+}
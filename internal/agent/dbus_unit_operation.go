@@ -7,11 +7,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
 const playbackServiceUnit = "play.video.service"
 
+// playbackOutputUnitPrefix names the per-output playback units pulled in by
+// play.video.service when displays are configured.
+const playbackOutputUnitPrefix = "play.video@"
+
+func isPlaybackUnit(unit string) bool {
+	return unit == playbackServiceUnit || strings.HasPrefix(unit, playbackOutputUnitPrefix)
+}
+
 var (
 	dbusOperationTimeout              = 10 * time.Second
 	playbackServiceOperationTimeout   = 30 * time.Second
@@ -28,9 +37,9 @@ const (
 )
 
 func runDBusUnitOperation(parent context.Context, conn DBusConnection, operation dbusUnitOperation, unit string) (string, error) {
-	timeout := dbusOperationTimeout
-	if unit == playbackServiceUnit {
-		timeout = playbackServiceOperationTimeout
+	timeout := dbusTimeout()
+	if isPlaybackUnit(unit) {
+		timeout = playbackOperationTimeout()
 	}
 
 	ctx, cancel := context.WithTimeout(parent, timeout)
@@ -54,10 +63,12 @@ func runDBusUnitOperation(parent context.Context, conn DBusConnection, operation
 
 	select {
 	case result := <-ch:
+		publishEvent(EventUnitChanged, UnitEvent{Unit: unit, Action: string(operation), Result: result})
 		return result, nil
 	case <-ctx.Done():
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 			if playbackServiceReachedTargetState(parent, conn, operation, unit) {
+				publishEvent(EventUnitChanged, UnitEvent{Unit: unit, Action: string(operation), Result: "done"})
 				return "done", nil
 			}
 			return "", errDBusUnitOperationTimeout
@@ -67,7 +78,7 @@ func runDBusUnitOperation(parent context.Context, conn DBusConnection, operation
 }
 
 func playbackServiceReachedTargetState(parent context.Context, conn DBusConnection, operation dbusUnitOperation, unit string) bool {
-	if unit != playbackServiceUnit {
+	if !isPlaybackUnit(unit) {
 		return false
 	}
 
@@ -102,3 +113,56 @@ func isUnitNotActive(ctx context.Context, conn DBusConnection, unit string) bool
 	state, ok := unitActiveState(ctx, conn, unit)
 	return ok && state != "active"
 }
+
+// unitStatePollInterval is how often waitForUnitState re-reads ActiveState.
+// Tests may override it.
+var unitStatePollInterval = 200 * time.Millisecond
+
+// isTransitionalUnitState reports whether systemd is still moving the unit
+// between states.
+func isTransitionalUnitState(state string) bool {
+	switch state {
+	case "activating", "deactivating", "reloading", "refreshing":
+		return true
+	}
+	return false
+}
+
+// waitForUnitState polls ActiveState after a finished job until the unit
+// leaves the transitional states or the operation timeout expires. It
+// returns the last state read.
+func waitForUnitState(parent context.Context, conn DBusConnection, unit string) (string, error) {
+	timeout := dbusTimeout()
+	if isPlaybackUnit(unit) {
+		timeout = playbackOperationTimeout()
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	for {
+		state, ok := unitActiveState(ctx, conn, unit)
+		if ok && !isTransitionalUnitState(state) {
+			return state, nil
+		}
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return state, errDBusUnitOperationTimeout
+			}
+			return state, ctx.Err()
+		case <-time.After(unitStatePollInterval):
+		}
+	}
+}
+
+// unitReachedTarget reports whether a finished job left the unit in the
+// state the operation asked for.
+func unitReachedTarget(operation dbusUnitOperation, result, state string) bool {
+	if result != "done" {
+		return false
+	}
+	if operation == dbusUnitOperationStop {
+		return state != "active"
+	}
+	return state == "active"
+}
@@ -0,0 +1,172 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMaxDeletePercent is the share of media files one sync may move to
+// the trash before the deletion guard asks for a confirmation.
+const DefaultMaxDeletePercent = 50
+
+// deletionGuardMinFiles is the smallest deletion the guard may block, so
+// replacing one or two videos of a small library never needs a confirmation.
+const deletionGuardMinFiles = 3
+
+// manifestForceDeleteHeader lets the core mark a manifest whose removals
+// are intended, e.g. after an operator cleared a device's library.
+const manifestForceDeleteHeader = "X-Force-Delete"
+
+const metricDeletionsBlocked = "media_pi_sync_deletions_blocked_total"
+
+func init() {
+	registerCounter(metricDeletionsBlocked, "Sync passes whose garbage collection was blocked by the deletion guard.")
+}
+
+// errDeletionBlocked is returned when a manifest would remove more files
+// than sync.max_delete_percent allows.
+var errDeletionBlocked = errors.New("deletion blocked")
+
+// DeletionGuardStatus describes a garbage collection held back by the
+// guard. It is returned by GET /api/sync/deletion.
+type DeletionGuardStatus struct {
+	Blocked    bool       `json:"blocked"`
+	Files      int        `json:"files,omitempty"`
+	Total      int        `json:"total,omitempty"`
+	MaxPercent int        `json:"maxPercent,omitempty"`
+	DetectedAt *time.Time `json:"detectedAt,omitempty"`
+}
+
+var (
+	deletionGuard     DeletionGuardStatus
+	deletionConfirmed int // files the operator allowed the next pass to remove
+	deletionGuardLock sync.Mutex
+)
+
+// confirmDeletionSync starts the sync that applies a confirmed deletion.
+// Tests may override it.
+var confirmDeletionSync = func() error { return TriggerSync(nil) }
+
+func maxDeletePercent(config Config) int {
+	if config.Sync.MaxDeletePercent <= 0 {
+		return DefaultMaxDeletePercent
+	}
+	return config.Sync.MaxDeletePercent
+}
+
+// forceDeleteRequested reports whether a manifest response carries the
+// force flag of the core.
+func forceDeleteRequested(resp *http.Response) bool {
+	force, _ := strconv.ParseBool(resp.Header.Get(manifestForceDeleteHeader))
+	return force
+}
+
+// deletionExceeds reports whether removing files of total media files needs
+// a confirmation.
+func deletionExceeds(config Config, files, total int) bool {
+	return files >= deletionGuardMinFiles && files*100 > total*maxDeletePercent(config)
+}
+
+// checkDeletionGuard decides whether files of total media files may be
+// moved to the trash. A forced manifest or an operator confirmation
+// covering at least files lets a large deletion through; otherwise it is
+// recorded and errDeletionBlocked is returned.
+func checkDeletionGuard(config Config, files, total int, force bool) error {
+	maxPercent := maxDeletePercent(config)
+
+	deletionGuardLock.Lock()
+	defer deletionGuardLock.Unlock()
+
+	switch {
+	case !deletionExceeds(config, files, total):
+	case force:
+		log.Printf("Deleting %d of %d media files as forced by the core", files, total)
+	case deletionConfirmed >= files:
+		log.Printf("Deleting %d of %d media files as confirmed by the operator", files, total)
+	default:
+		// Repeated passes over the same manifest keep the first record;
+		// a different deletion needs a new confirmation.
+		if !deletionGuard.Blocked || deletionGuard.Files != files || deletionGuard.Total != total {
+			now := time.Now()
+			deletionGuard = DeletionGuardStatus{
+				Blocked:    true,
+				Files:      files,
+				Total:      total,
+				MaxPercent: maxPercent,
+				DetectedAt: &now,
+			}
+			deletionConfirmed = 0
+			metricAdd(metricDeletionsBlocked, 1)
+			log.Printf("Warning: manifest removes %d of %d media files, keeping them until confirmed", files, total)
+		}
+		return fmt.Errorf("%w: manifest removes %d of %d files, more than %d%%", errDeletionBlocked, files, total, maxPercent)
+	}
+	deletionGuard = DeletionGuardStatus{}
+	deletionConfirmed = 0
+	return nil
+}
+
+func getDeletionGuardStatus() DeletionGuardStatus {
+	deletionGuardLock.Lock()
+	defer deletionGuardLock.Unlock()
+	return deletionGuard
+}
+
+// confirmDeletion allows the next sync pass to remove the blocked files.
+func confirmDeletion() (DeletionGuardStatus, bool) {
+	deletionGuardLock.Lock()
+	defer deletionGuardLock.Unlock()
+	if !deletionGuard.Blocked {
+		return deletionGuard, false
+	}
+	deletionConfirmed = deletionGuard.Files
+	return deletionGuard, true
+}
+
+// HandleDeletionGuard returns the garbage collection held back by the
+// deletion guard, if any.
+func HandleDeletionGuard(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getDeletionGuardStatus()})
+}
+
+// HandleDeletionConfirm lets the operator approve a blocked deletion and
+// starts a video sync that applies it.
+func HandleDeletionConfirm(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	status, ok := confirmDeletion()
+	if !ok {
+		JSONResponse(w, http.StatusConflict, APIResponse{OK: false, ErrMsg: "Нет заблокированного удаления файлов"})
+		return
+	}
+	log.Printf("Operator confirmed deletion of %d of %d media files", status.Files, status.Total)
+	if err := confirmDeletionSync(); err != nil {
+		log.Printf("Failed to trigger video sync: %v", err)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{
+			OK:     false,
+			ErrMsg: fmt.Sprintf("Удаление подтверждено, но не удалось запустить загрузку видео: %v", err),
+		})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: MenuActionResponse{
+			Action:  "deletion-confirm",
+			Result:  "success",
+			Message: fmt.Sprintf("Удаление %d файлов подтверждено", status.Files),
+		},
+	})
+}
@@ -0,0 +1,144 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func resetDeletionGuardForTest(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		deletionGuardLock.Lock()
+		deletionGuard = DeletionGuardStatus{}
+		deletionConfirmed = 0
+		deletionGuardLock.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+// writeMediaFilesForTest creates names with content "old" in dir.
+func writeMediaFilesForTest(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDeletionGuardBlocksUntilConfirmed(t *testing.T) {
+	resetDeletionGuardForTest(t)
+	mediaDir := t.TempDir()
+	writeMediaFilesForTest(t, mediaDir, "a.mp4", "b.mp4", "c.mp4", "d.mp4")
+	source := &fakeSyncSource{
+		batches:    [][]ManifestItem{{{ID: 1, Filename: "one.mp4", FileSizeBytes: 3, SHA256: sha256Hex("one")}}},
+		files:      map[string]string{"one.mp4": "one"},
+		validators: manifestValidators{ETag: `"v1"`},
+	}
+	config := Config{Playlist: PlaylistConfig{Destination: mediaDir}}
+
+	_, _, err := syncFromSource(context.Background(), config, source, manifestValidators{})
+	if !errors.Is(err, errDeletionBlocked) {
+		t.Fatalf("expected errDeletionBlocked, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "a.mp4")); err != nil {
+		t.Fatalf("expected files kept while blocked: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "one.mp4")); err != nil {
+		t.Fatalf("expected new items downloaded while blocked: %v", err)
+	}
+	if status := getDeletionGuardStatus(); !status.Blocked || status.Files != 4 || status.Total != 5 || status.MaxPercent != DefaultMaxDeletePercent {
+		t.Fatalf("unexpected guard status %+v", status)
+	}
+
+	triggered := 0
+	original := confirmDeletionSync
+	confirmDeletionSync = func() error { triggered++; return nil }
+	t.Cleanup(func() { confirmDeletionSync = original })
+	w := httptest.NewRecorder()
+	HandleDeletionConfirm(w, httptest.NewRequest(http.MethodPost, "/api/sync/deletion/confirm", nil))
+	if w.Code != http.StatusOK || triggered != 1 {
+		t.Fatalf("expected confirmation to start a sync, got %d, %d: %s", w.Code, triggered, w.Body.String())
+	}
+
+	if _, _, err := syncFromSource(context.Background(), config, source, manifestValidators{}); err != nil {
+		t.Fatalf("expected confirmed deletion to succeed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "a.mp4")); !os.IsNotExist(err) {
+		t.Fatalf("expected a.mp4 moved to the trash, stat err = %v", err)
+	}
+	if status := getDeletionGuardStatus(); status.Blocked {
+		t.Fatalf("expected guard cleared, got %+v", status)
+	}
+
+	w = httptest.NewRecorder()
+	HandleDeletionConfirm(w, httptest.NewRequest(http.MethodPost, "/api/sync/deletion/confirm", nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 without a blocked deletion, got %d", w.Code)
+	}
+}
+
+func TestDeletionGuardThresholds(t *testing.T) {
+	resetDeletionGuardForTest(t)
+	config := Config{}
+
+	if err := checkDeletionGuard(config, 2, 2, false); err != nil {
+		t.Errorf("deletions below the minimum must pass: %v", err)
+	}
+	if err := checkDeletionGuard(config, 5, 10, false); err != nil {
+		t.Errorf("deletions at the limit must pass: %v", err)
+	}
+	if err := checkDeletionGuard(config, 6, 10, true); err != nil {
+		t.Errorf("forced deletions must pass: %v", err)
+	}
+	if err := checkDeletionGuard(Config{Sync: SyncConfig{MaxDeletePercent: 100}}, 10, 10, false); err != nil {
+		t.Errorf("100%% must disable the guard: %v", err)
+	}
+	if err := checkDeletionGuard(config, 6, 10, false); !errors.Is(err, errDeletionBlocked) {
+		t.Fatalf("expected errDeletionBlocked, got %v", err)
+	}
+
+	// A confirmation covers only the deletion it was given for.
+	if _, ok := confirmDeletion(); !ok {
+		t.Fatal("expected a blocked deletion to confirm")
+	}
+	if err := checkDeletionGuard(config, 8, 10, false); !errors.Is(err, errDeletionBlocked) {
+		t.Fatalf("expected a larger deletion to need a new confirmation, got %v", err)
+	}
+	if status := getDeletionGuardStatus(); status.Files != 8 {
+		t.Fatalf("expected the new deletion recorded, got %+v", status)
+	}
+}
+
+func TestCoreForceDeleteHeader(t *testing.T) {
+	resetDeletionGuardForTest(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"empty"`)
+		w.Header().Set(manifestForceDeleteHeader, "true")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	mediaDir := t.TempDir()
+	writeMediaFilesForTest(t, mediaDir, "a.mp4", "b.mp4", "c.mp4")
+	config := Config{CoreAPIBase: server.URL, ServerKey: "key", Playlist: PlaylistConfig{Destination: mediaDir}}
+	_, validators, err := syncFromSource(context.Background(), config, coreSyncSource{config: config}, manifestValidators{})
+	if err != nil {
+		t.Fatalf("expected forced manifest to be applied, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "a.mp4")); !os.IsNotExist(err) {
+		t.Fatalf("expected a.mp4 moved to the trash, stat err = %v", err)
+	}
+	if validators != (manifestValidators{ETag: `"empty"`}) {
+		t.Fatalf("expected force flag cleared from cached validators, got %+v", validators)
+	}
+}
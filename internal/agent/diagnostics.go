@@ -0,0 +1,158 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugConfig controls the runtime diagnostics served under /debug/:
+// net/http/pprof profiles and expvar variables. They are off unless
+// enabled here or unlocked for a while through /api/system/debug/unlock.
+type DebugConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// MaxUnlock bounds the duration of an unlock.
+	MaxUnlock time.Duration `yaml:"max_unlock,omitempty"`
+}
+
+// Defaults for /debug/ unlocks.
+const (
+	DefaultDebugUnlock    = 15 * time.Minute
+	DefaultDebugMaxUnlock = time.Hour
+)
+
+var (
+	debugUnlockLock  sync.Mutex
+	debugUnlockUntil time.Time
+
+	// debugNow is the clock of unlocks; tests may override it.
+	debugNow = time.Now
+
+	debugMux = newDebugMux()
+)
+
+// DebugStatus is returned by /api/system/debug.
+type DebugStatus struct {
+	Enabled       bool       `json:"enabled"`
+	Configured    bool       `json:"configured"`
+	UnlockedUntil *time.Time `json:"unlockedUntil,omitempty"`
+}
+
+// DebugUnlockRequest is the body of POST /api/system/debug/unlock.
+// DurationSeconds defaults to 15 minutes; Lock ends an unlock early.
+type DebugUnlockRequest struct {
+	DurationSeconds int  `json:"durationSeconds,omitempty"`
+	Lock            bool `json:"lock,omitempty"`
+}
+
+func newDebugMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+func debugMaxUnlock(config DebugConfig) time.Duration {
+	if config.MaxUnlock > 0 {
+		return config.MaxUnlock
+	}
+	return DefaultDebugMaxUnlock
+}
+
+func getDebugStatus() DebugStatus {
+	debugUnlockLock.Lock()
+	defer debugUnlockLock.Unlock()
+	status := DebugStatus{Configured: GetCurrentConfig().Debug.Enabled}
+	if debugNow().Before(debugUnlockUntil) {
+		until := debugUnlockUntil
+		status.UnlockedUntil = &until
+	}
+	status.Enabled = status.Configured || status.UnlockedUntil != nil
+	return status
+}
+
+// debugEnabled reports whether /debug/ is served now.
+func debugEnabled() bool {
+	return getDebugStatus().Enabled
+}
+
+// unlockDebug serves /debug/ for duration, capped at debug.max_unlock.
+func unlockDebug(duration time.Duration) DebugStatus {
+	if duration <= 0 {
+		duration = DefaultDebugUnlock
+	}
+	if limit := debugMaxUnlock(GetCurrentConfig().Debug); duration > limit {
+		duration = limit
+	}
+	debugUnlockLock.Lock()
+	debugUnlockUntil = debugNow().Add(duration)
+	debugUnlockLock.Unlock()
+	log.Printf("Diagnostics under /debug/ unlocked for %v", duration)
+	return getDebugStatus()
+}
+
+// lockDebug ends an unlock early.
+func lockDebug() DebugStatus {
+	debugUnlockLock.Lock()
+	debugUnlockUntil = time.Time{}
+	debugUnlockLock.Unlock()
+	return getDebugStatus()
+}
+
+// HandleDebug serves pprof and expvar under /debug/ while debug.enabled is
+// set or an unlock lasts, and answers 404 otherwise.
+func HandleDebug(w http.ResponseWriter, r *http.Request) {
+	if !debugEnabled() {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Диагностика отключена"})
+		return
+	}
+	// CPU profiles and traces run longer than the server write timeout.
+	if strings.HasPrefix(r.URL.Path, "/debug/pprof/") {
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	}
+	debugMux.ServeHTTP(w, r)
+}
+
+// HandleDebugStatus returns whether /debug/ is served and until when it is
+// unlocked.
+func HandleDebugStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getDebugStatus()})
+}
+
+// HandleDebugUnlock serves /debug/ for a limited time, or locks it again.
+func HandleDebugUnlock(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req DebugUnlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+		return
+	}
+	if req.DurationSeconds < 0 {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "durationSeconds не может быть отрицательным"})
+		return
+	}
+	if req.Lock {
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: lockDebug()})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: unlockDebug(time.Duration(req.DurationSeconds) * time.Second)})
+}
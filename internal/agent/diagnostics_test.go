@@ -0,0 +1,85 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setDebugClockForTest(t *testing.T, now time.Time) *time.Time {
+	t.Helper()
+	originalNow := debugNow
+	current := now
+	debugNow = func() time.Time { return current }
+	t.Cleanup(func() {
+		debugNow = originalNow
+		lockDebug()
+	})
+	return &current
+}
+
+func TestHandleDebugGate(t *testing.T) {
+	setCurrentConfigForTest(t, Config{})
+	now := setDebugClockForTest(t, time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC))
+
+	get := func() int {
+		w := httptest.NewRecorder()
+		HandleDebug(w, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+		return w.Code
+	}
+	if code := get(); code != http.StatusNotFound {
+		t.Fatalf("expected 404 by default, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	HandleDebugUnlock(w, httptest.NewRequest(http.MethodPost, "/api/system/debug/unlock", strings.NewReader(`{"durationSeconds":86400}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("unlock status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data DebugStatus `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Data.Enabled || resp.Data.UnlockedUntil == nil || !resp.Data.UnlockedUntil.Equal(now.Add(DefaultDebugMaxUnlock)) {
+		t.Fatalf("expected unlock capped at max_unlock, got %+v", resp.Data)
+	}
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("expected /debug/vars served while unlocked, got %d", code)
+	}
+
+	*now = now.Add(DefaultDebugMaxUnlock)
+	if code := get(); code != http.StatusNotFound {
+		t.Fatalf("expected 404 after the unlock expired, got %d", code)
+	}
+
+	setCurrentConfigForTest(t, Config{Debug: DebugConfig{Enabled: true}})
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("expected /debug/vars served with debug.enabled, got %d", code)
+	}
+}
+
+func TestHandleDebugUnlockLock(t *testing.T) {
+	setCurrentConfigForTest(t, Config{})
+	setDebugClockForTest(t, time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC))
+
+	unlockDebug(0)
+	w := httptest.NewRecorder()
+	HandleDebugUnlock(w, httptest.NewRequest(http.MethodPost, "/api/system/debug/unlock", strings.NewReader(`{"lock":true}`)))
+	if w.Code != http.StatusOK || debugEnabled() {
+		t.Fatalf("expected diagnostics locked, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	HandleDebugUnlock(w, httptest.NewRequest(http.MethodPost, "/api/system/debug/unlock", strings.NewReader(`{"durationSeconds":-1}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a negative duration, got %d", w.Code)
+	}
+}
@@ -0,0 +1,392 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultDisplayPlayerArgs selects the output for the default player when
+// displays[].player_args is not set; {output} is the connector name.
+const DefaultDisplayPlayerArgs = "--vout=drm_vout --drm-vout-display={output}"
+
+// DRMRoot is where the kernel exposes DRM/KMS connectors. Tests may override
+// it.
+var DRMRoot = "/sys/class/drm"
+
+var (
+	displayOutputPattern     = regexp.MustCompile(`^[A-Za-z]+(-[A-Za-z0-9]+)*$`)
+	displayResolutionPattern = regexp.MustCompile(`^[0-9]+x[0-9]+(@[0-9]+(\.[0-9]+)?)?$`)
+	drmConnectorPattern      = regexp.MustCompile(`^card[0-9]+-(.+)$`)
+)
+
+// DisplayOutputConfig configures playback on one display output.
+type DisplayOutputConfig struct {
+	// Output is the DRM connector name, for example "HDMI-A-1".
+	Output string `yaml:"output" json:"output"`
+	// Resolution is WIDTHxHEIGHT with an optional @RATE; empty keeps the
+	// preferred mode.
+	Resolution string `yaml:"resolution,omitempty" json:"resolution,omitempty"`
+	// Rotation in degrees: 0, 90, 180 or 270.
+	Rotation int `yaml:"rotation,omitempty" json:"rotation,omitempty"`
+	// Playlist played on the output, relative to playlist.destination;
+	// playlist.m3u when empty.
+	Playlist string `yaml:"playlist,omitempty" json:"playlist,omitempty"`
+	// PlayerArgs are appended to player.command to select the output.
+	PlayerArgs string `yaml:"player_args,omitempty" json:"playerArgs,omitempty"`
+}
+
+// DisplayOutput describes a display output found via DRM/KMS or configured.
+type DisplayOutput struct {
+	Name      string               `json:"name"`
+	Card      string               `json:"card,omitempty"`
+	Connected bool                 `json:"connected"`
+	Enabled   bool                 `json:"enabled"`
+	Modes     []string             `json:"modes"`
+	Config    *DisplayOutputConfig `json:"config,omitempty"`
+	Unit      string               `json:"unit,omitempty"`
+	UnitState string               `json:"unitState,omitempty"`
+}
+
+// DisplayOutputsUpdateRequest is the body of PUT /api/menu/display/outputs.
+type DisplayOutputsUpdateRequest struct {
+	Outputs []DisplayOutputConfig `json:"outputs"`
+}
+
+// DisplayOutputRequest is the body of POST /api/menu/display/start and
+// /api/menu/display/stop.
+type DisplayOutputRequest struct {
+	Output string `json:"output"`
+}
+
+// playbackUnitForOutput returns the playback unit of a display output.
+func playbackUnitForOutput(output string) string {
+	return playbackOutputUnitPrefix + output + ".service"
+}
+
+// discoverDisplays lists DRM connectors below root, skipping writeback
+// connectors that cannot drive a display.
+func discoverDisplays(root string) ([]DisplayOutput, error) {
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return []DisplayOutput{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []DisplayOutput{}
+	for _, entry := range entries {
+		match := drmConnectorPattern.FindStringSubmatch(entry.Name())
+		if match == nil || strings.HasPrefix(match[1], "Writeback") {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		output := DisplayOutput{
+			Name:      match[1],
+			Card:      strings.TrimSuffix(entry.Name(), "-"+match[1]),
+			Connected: readSysfsValue(filepath.Join(dir, "status")) == "connected",
+			Enabled:   readSysfsValue(filepath.Join(dir, "enabled")) == "enabled",
+			Modes:     []string{},
+		}
+		seen := make(map[string]bool)
+		for _, mode := range strings.Split(readSysfsValue(filepath.Join(dir, "modes")), "\n") {
+			mode = strings.TrimSpace(mode)
+			if mode != "" && !seen[mode] {
+				seen[mode] = true
+				output.Modes = append(output.Modes, mode)
+			}
+		}
+		outputs = append(outputs, output)
+	}
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].Name < outputs[j].Name })
+	return outputs, nil
+}
+
+func readSysfsValue(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// normalizeDisplays validates display output settings and returns them
+// trimmed.
+func normalizeDisplays(displays []DisplayOutputConfig) ([]DisplayOutputConfig, error) {
+	result := make([]DisplayOutputConfig, 0, len(displays))
+	seen := make(map[string]bool)
+	for _, display := range displays {
+		display.Output = strings.TrimSpace(display.Output)
+		display.Resolution = strings.TrimSpace(display.Resolution)
+		display.Playlist = strings.TrimSpace(display.Playlist)
+		display.PlayerArgs = strings.TrimSpace(display.PlayerArgs)
+
+		if !displayOutputPattern.MatchString(display.Output) {
+			return nil, fmt.Errorf("invalid display output %q", display.Output)
+		}
+		if seen[display.Output] {
+			return nil, fmt.Errorf("display output %s is configured twice", display.Output)
+		}
+		seen[display.Output] = true
+		if display.Resolution != "" && !displayResolutionPattern.MatchString(display.Resolution) {
+			return nil, fmt.Errorf("invalid resolution %q for %s", display.Resolution, display.Output)
+		}
+		switch display.Rotation {
+		case 0, 90, 180, 270:
+		default:
+			return nil, fmt.Errorf("invalid rotation %d for %s", display.Rotation, display.Output)
+		}
+		if display.Playlist != "" {
+			clean := filepath.Clean(filepath.FromSlash(display.Playlist))
+			if filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+				return nil, fmt.Errorf("invalid playlist %q for %s", display.Playlist, display.Output)
+			}
+			display.Playlist = filepath.ToSlash(clean)
+		}
+		result = append(result, display)
+	}
+	return result, nil
+}
+
+// displayPlaylistPath returns the playlist file played on display.
+func displayPlaylistPath(config Config, display DisplayOutputConfig) string {
+	name := display.Playlist
+	if name == "" {
+		name = playlistFileName
+	}
+	return filepath.Join(strings.TrimRight(config.Playlist.Destination, "/"), filepath.FromSlash(name))
+}
+
+// installPlaybackUnits rewrites play.video.service and the per-output units
+// in SystemdUnitDir, removes units of outputs no longer configured and
+// reloads systemd.
+func installPlaybackUnits(parent context.Context, config Config) error {
+	units, err := renderPlaybackUnits(config)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(units))
+	for _, unit := range units {
+		if err := writeSystemFile(filepath.Join(SystemdUnitDir, unit.Name), unit.Content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", unit.Name, err)
+		}
+		keep[unit.Name] = true
+	}
+	writeSlideshowConfigs(config)
+
+	stale, _ := filepath.Glob(filepath.Join(SystemdUnitDir, playbackOutputUnitPrefix+"*.service"))
+	for _, path := range stale {
+		if !keep[filepath.Base(path)] {
+			log.Printf("Removing playback unit of unconfigured output: %s", path)
+			if err := removeSystemFile(path); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", filepath.Base(path), err)
+			}
+		}
+	}
+
+	connCtx, cancelConn := context.WithTimeout(parent, dbusTimeout())
+	defer cancelConn()
+	conn, err := getDBusConnection(connCtx)
+	if err != nil {
+		return fmt.Errorf("connect to D-Bus: %w", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(parent, dbusTimeout())
+	defer cancel()
+	if err := conn.ReloadContext(ctx); err != nil {
+		return fmt.Errorf("daemon reload: %w", err)
+	}
+	return nil
+}
+
+// updateDisplays replaces the display outputs in the current configuration
+// and saves it.
+func updateDisplays(displays []DisplayOutputConfig) error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	if currentConfig == nil {
+		return fmt.Errorf("configuration not loaded")
+	}
+	currentConfig.Displays = displays
+
+	return saveCurrentConfig("displays")
+}
+
+// listDisplays merges discovered outputs with configured ones and, when
+// D-Bus is available, adds the state of their playback units.
+func listDisplays(ctx context.Context, config Config) ([]DisplayOutput, error) {
+	outputs, err := discoverDisplays(DRMRoot)
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int, len(outputs))
+	for i, output := range outputs {
+		index[output.Name] = i
+	}
+	for _, display := range config.Displays {
+		i, ok := index[display.Output]
+		if !ok {
+			outputs = append(outputs, DisplayOutput{Name: display.Output, Modes: []string{}})
+			i = len(outputs) - 1
+			index[display.Output] = i
+		}
+		outputs[i].Config = &display
+		outputs[i].Unit = playbackUnitForOutput(display.Output)
+	}
+
+	if len(config.Displays) == 0 {
+		return outputs, nil
+	}
+	conn, err := getDBusConnection(ctx)
+	if err != nil {
+		log.Printf("Warning: display playback state unavailable: %v", err)
+		return outputs, nil
+	}
+	defer conn.Close()
+	stateCtx, cancel := context.WithTimeout(ctx, dbusTimeout())
+	defer cancel()
+	for i := range outputs {
+		if outputs[i].Unit == "" {
+			continue
+		}
+		if state, ok := unitActiveState(stateCtx, conn, outputs[i].Unit); ok {
+			outputs[i].UnitState = state
+		}
+	}
+	return outputs, nil
+}
+
+// HandleDisplayList returns display outputs with their configuration and
+// playback state.
+func HandleDisplayList(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	outputs, err := listDisplays(r.Context(), GetCurrentConfig())
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось получить список дисплеев: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: outputs})
+}
+
+// HandleDisplayOutputsUpdate saves display output settings, rewrites the
+// playback units and restarts playback when it is running.
+func HandleDisplayOutputsUpdate(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPut) {
+		return
+	}
+
+	var req DisplayOutputsUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+		return
+	}
+	displays, err := normalizeDisplays(req.Outputs)
+	if err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Неверные настройки дисплеев: %v", err)})
+		return
+	}
+	if err := updateDisplays(displays); err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось сохранить настройки дисплеев: %v", err)})
+		return
+	}
+	if err := installPlaybackUnits(r.Context(), GetCurrentConfig()); err != nil {
+		log.Printf("Failed to install playback units: %v", err)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось обновить сервисы воспроизведения: %v", err)})
+		return
+	}
+
+	message := "Настройки дисплеев сохранены"
+	if status, err := getServiceStatus(r.Context()); err == nil && status.PlaybackServiceStatus {
+		if err := RestartVideoPlayServiceWithLogs(r.Context(), "display outputs update"); err != nil {
+			message = fmt.Sprintf("Настройки дисплеев сохранены, но перезапустить воспроизведение не удалось: %v", err)
+		}
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: MenuActionResponse{
+			Action:  "display-outputs-update",
+			Result:  "success",
+			Message: message,
+		},
+	})
+}
+
+// HandleDisplayPlayback starts or stops playback on a single configured
+// output.
+func HandleDisplayPlayback(operation dbusUnitOperation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+
+		var req DisplayOutputRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Output) == "" {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Поле output обязательно"})
+			return
+		}
+		output := strings.TrimSpace(req.Output)
+		configured := false
+		for _, display := range GetCurrentConfig().Displays {
+			if display.Output == output {
+				configured = true
+				break
+			}
+		}
+		if !configured {
+			JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Дисплей %s не настроен", output)})
+			return
+		}
+
+		unit := playbackUnitForOutput(output)
+		log.Printf("Running %s for %s on manual request", operation, unit)
+		connCtx, cancel := context.WithTimeout(r.Context(), dbusTimeout())
+		defer cancel()
+		conn, err := getDBusConnection(connCtx)
+		if err != nil {
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось подключиться к D-Bus: %v", err)})
+			return
+		}
+		defer conn.Close()
+
+		result, err := runDBusUnitOperation(r.Context(), conn, operation, unit)
+		if err != nil {
+			log.Printf("Failed to %s %s: %v", operation, unit, err)
+			if errors.Is(err, errDBusUnitOperationTimeout) {
+				JSONResponse(w, http.StatusRequestTimeout, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Таймаут управления воспроизведением на %s", output)})
+				return
+			}
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось управлять воспроизведением на %s: %v", output, err)})
+			return
+		}
+
+		message := fmt.Sprintf("Воспроизведение на %s запущено", output)
+		if operation == dbusUnitOperationStop {
+			message = fmt.Sprintf("Воспроизведение на %s остановлено", output)
+		}
+		JSONResponse(w, http.StatusOK, APIResponse{
+			OK: true,
+			Data: MenuActionResponse{
+				Action:  "display-" + string(operation),
+				Result:  result,
+				Message: message,
+			},
+		})
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CmdlinePaths are the kernel command line files checked in order; the
+// first existing one receives video= parameters. Tests may override it.
+var CmdlinePaths = []string{"/boot/firmware/cmdline.txt", "/boot/cmdline.txt"}
+
+// DefaultWaylandDisplay is the compositor socket used by wlr-randr when the
+// agent environment does not set WAYLAND_DISPLAY.
+const DefaultWaylandDisplay = "wayland-1"
+
+const wlrRandrTimeout = 10 * time.Second
+
+// runWlrRandr applies a mode to the running compositor. It is a variable so
+// tests can replace it.
+var runWlrRandr = func(ctx context.Context, username string, args []string) error {
+	name, cmdArgs := "wlr-randr", args
+	env := os.Environ()
+	if os.Geteuid() == 0 && username != "" {
+		account, err := user.Lookup(username)
+		if err != nil {
+			return err
+		}
+		name, cmdArgs = "runuser", append([]string{"-u", username, "--", "wlr-randr"}, args...)
+		env = append(env, "XDG_RUNTIME_DIR=/run/user/"+account.Uid)
+	}
+	if os.Getenv("WAYLAND_DISPLAY") == "" {
+		env = append(env, "WAYLAND_DISPLAY="+DefaultWaylandDisplay)
+	}
+	cmd := exec.CommandContext(ctx, name, cmdArgs...)
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("wlr-randr: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// DisplayModeConfig is the mode of one output returned by
+// GET /api/menu/display/config.
+type DisplayModeConfig struct {
+	Output     string   `json:"output"`
+	Connected  bool     `json:"connected"`
+	Resolution string   `json:"resolution,omitempty"`
+	Rotation   int      `json:"rotation"`
+	Modes      []string `json:"modes"`
+	// Cmdline is the video= parameter currently set for the output.
+	Cmdline string `json:"cmdline,omitempty"`
+}
+
+// DisplayModeRequest is the body of PUT /api/menu/display/config.
+type DisplayModeRequest struct {
+	Output     string `json:"output"`
+	Resolution string `json:"resolution"`
+	Rotation   int    `json:"rotation"`
+}
+
+func resolveCmdlinePath() (string, error) {
+	for _, path := range CmdlinePaths {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("kernel command line file not found")
+}
+
+// cmdlineVideoParam returns the video= parameter for output in cmdline.
+func cmdlineVideoParam(cmdline, output string) string {
+	prefix := "video=" + output + ":"
+	for _, field := range strings.Fields(cmdline) {
+		if strings.HasPrefix(field, prefix) {
+			return field
+		}
+	}
+	return ""
+}
+
+// parseVideoParam extracts the mode and rotation from a video= parameter.
+func parseVideoParam(param string) (string, int) {
+	_, value, ok := strings.Cut(param, ":")
+	if !ok {
+		return "", 0
+	}
+	resolution, rotation := "", 0
+	for i, part := range strings.Split(value, ",") {
+		if degrees, ok := strings.CutPrefix(part, "rotate="); ok {
+			rotation, _ = strconv.Atoi(degrees)
+		} else if i == 0 && displayResolutionPattern.MatchString(part) {
+			resolution = part
+		}
+	}
+	return resolution, rotation
+}
+
+// videoParam renders the kernel video= parameter; an empty result means the
+// output keeps its defaults.
+func videoParam(output, resolution string, rotation int) string {
+	var options []string
+	if resolution != "" {
+		options = append(options, resolution)
+	}
+	if rotation != 0 {
+		options = append(options, fmt.Sprintf("rotate=%d", rotation))
+	}
+	if len(options) == 0 {
+		return ""
+	}
+	return "video=" + output + ":" + strings.Join(options, ",")
+}
+
+// writeCmdlineVideoParam replaces the video= parameter of output in the
+// kernel command line file, keeping every other parameter.
+func writeCmdlineVideoParam(path, output, resolution string, rotation int) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	prefix := "video=" + output + ":"
+	var fields []string
+	for _, field := range strings.Fields(string(data)) {
+		if !strings.HasPrefix(field, prefix) {
+			fields = append(fields, field)
+		}
+	}
+	if param := videoParam(output, resolution, rotation); param != "" {
+		fields = append(fields, param)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strings.Join(fields, " ")+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// wlrRandrArgs builds the wlr-randr arguments for a mode change.
+func wlrRandrArgs(output, resolution string, rotation int) []string {
+	args := []string{"--output", output}
+	if resolution != "" {
+		mode := resolution
+		if strings.Contains(mode, "@") {
+			mode += "Hz"
+		}
+		args = append(args, "--mode", mode)
+	}
+	transform := "normal"
+	if rotation != 0 {
+		transform = strconv.Itoa(rotation)
+	}
+	return append(args, "--transform", transform)
+}
+
+// displayModes merges discovered outputs with the modes stored in the
+// configuration and the kernel command line.
+func displayModes(config Config) ([]DisplayModeConfig, error) {
+	outputs, err := discoverDisplays(DRMRoot)
+	if err != nil {
+		return nil, err
+	}
+	cmdline := ""
+	if path, err := resolveCmdlinePath(); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			cmdline = string(data)
+		}
+	}
+
+	configured := make(map[string]DisplayOutputConfig, len(config.Displays))
+	for _, display := range config.Displays {
+		configured[display.Output] = display
+	}
+	result := []DisplayModeConfig{}
+	seen := make(map[string]bool)
+	add := func(name string, connected bool, modes []string) {
+		mode := DisplayModeConfig{Output: name, Connected: connected, Modes: modes}
+		mode.Cmdline = cmdlineVideoParam(cmdline, name)
+		if display, ok := configured[name]; ok {
+			mode.Resolution, mode.Rotation = display.Resolution, display.Rotation
+		} else {
+			mode.Resolution, mode.Rotation = parseVideoParam(mode.Cmdline)
+		}
+		result = append(result, mode)
+		seen[name] = true
+	}
+	for _, output := range outputs {
+		add(output.Name, output.Connected, output.Modes)
+	}
+	for _, display := range config.Displays {
+		if !seen[display.Output] {
+			add(display.Output, false, []string{})
+		}
+	}
+	return result, nil
+}
+
+// updateDisplayMode stores the mode in the matching displays entry, if any.
+func updateDisplayMode(output, resolution string, rotation int) error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	if currentConfig == nil {
+		return fmt.Errorf("configuration not loaded")
+	}
+	// Copy so configs handed out by GetCurrentConfig stay unchanged.
+	displays := append([]DisplayOutputConfig(nil), currentConfig.Displays...)
+	changed := false
+	for i := range displays {
+		if displays[i].Output == output {
+			displays[i].Resolution = resolution
+			displays[i].Rotation = rotation
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	currentConfig.Displays = displays
+	return saveCurrentConfig("displays")
+}
+
+// HandleDisplayConfig reads (GET) or sets (PUT) display resolution and
+// rotation. A PUT writes the kernel command line so the mode survives a
+// reboot and applies it to the running compositor with wlr-randr; when that
+// is not possible the response asks for a reboot.
+func HandleDisplayConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		modes, err := displayModes(GetCurrentConfig())
+		if err != nil {
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось получить настройки дисплеев: %v", err)})
+			return
+		}
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: modes})
+	case http.MethodPut:
+		handleDisplayConfigUpdate(w, r)
+	default:
+		JSONResponse(w, http.StatusMethodNotAllowed, APIResponse{OK: false, ErrMsg: "Метод не разрешён"})
+	}
+}
+
+func handleDisplayConfigUpdate(w http.ResponseWriter, r *http.Request) {
+	var req DisplayModeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+		return
+	}
+	normalized, err := normalizeDisplays([]DisplayOutputConfig{{Output: req.Output, Resolution: req.Resolution, Rotation: req.Rotation}})
+	if err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Неверные настройки дисплея: %v", err)})
+		return
+	}
+	mode := normalized[0]
+
+	path, err := resolveCmdlinePath()
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось найти cmdline.txt: %v", err)})
+		return
+	}
+	if err := writeCmdlineVideoParam(path, mode.Output, mode.Resolution, mode.Rotation); err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось записать %s: %v", path, err)})
+		return
+	}
+	if err := updateDisplayMode(mode.Output, mode.Resolution, mode.Rotation); err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось сохранить настройки дисплея: %v", err)})
+		return
+	}
+	log.Printf("Display mode of %s set to resolution %q, rotation %d", mode.Output, mode.Resolution, mode.Rotation)
+
+	ctx, cancel := context.WithTimeout(r.Context(), wlrRandrTimeout)
+	defer cancel()
+	result, message := "applied", fmt.Sprintf("Настройки дисплея %s применены", mode.Output)
+	if err := runWlrRandr(ctx, GetCurrentConfig().MediaPiServiceUser, wlrRandrArgs(mode.Output, mode.Resolution, mode.Rotation)); err != nil {
+		log.Printf("Could not apply display mode of %s without reboot: %v", mode.Output, err)
+		result, message = "reboot-required", fmt.Sprintf("Настройки дисплея %s сохранены и будут применены после перезагрузки", mode.Output)
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: MenuActionResponse{
+			Action:  "display-config-update",
+			Result:  result,
+			Message: message,
+		},
+	})
+}
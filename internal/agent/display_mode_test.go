@@ -0,0 +1,168 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setCmdlineForTest(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cmdline.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	original := CmdlinePaths
+	CmdlinePaths = []string{filepath.Join(t.TempDir(), "missing.txt"), path}
+	t.Cleanup(func() { CmdlinePaths = original })
+	return path
+}
+
+func stubWlrRandr(t *testing.T, err error) *[][]string {
+	t.Helper()
+	var calls [][]string
+	original := runWlrRandr
+	runWlrRandr = func(ctx context.Context, username string, args []string) error {
+		calls = append(calls, args)
+		return err
+	}
+	t.Cleanup(func() { runWlrRandr = original })
+	return &calls
+}
+
+func TestWriteCmdlineVideoParamReplacesOutputEntry(t *testing.T) {
+	path := setCmdlineForTest(t, "console=tty1 video=HDMI-A-1:1280x720 video=HDMI-A-2:1920x1080 rootwait\n")
+
+	if err := writeCmdlineVideoParam(path, "HDMI-A-1", "1920x1080@60", 90); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if got := string(data); got != "console=tty1 video=HDMI-A-2:1920x1080 rootwait video=HDMI-A-1:1920x1080@60,rotate=90\n" {
+		t.Fatalf("unexpected cmdline: %q", got)
+	}
+
+	if err := writeCmdlineVideoParam(path, "HDMI-A-2", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if strings.Contains(string(data), "HDMI-A-2") {
+		t.Fatalf("expected default mode to drop the parameter: %q", data)
+	}
+}
+
+func TestParseVideoParam(t *testing.T) {
+	resolution, rotation := parseVideoParam("video=HDMI-A-1:1920x1080@60,rotate=270")
+	if resolution != "1920x1080@60" || rotation != 270 {
+		t.Fatalf("got %q, %d", resolution, rotation)
+	}
+	if resolution, rotation := parseVideoParam("video=HDMI-A-1:rotate=90"); resolution != "" || rotation != 90 {
+		t.Fatalf("got %q, %d", resolution, rotation)
+	}
+}
+
+func TestWlrRandrArgs(t *testing.T) {
+	got := strings.Join(wlrRandrArgs("HDMI-A-1", "1920x1080@60", 180), " ")
+	if got != "--output HDMI-A-1 --mode 1920x1080@60Hz --transform 180" {
+		t.Fatalf("unexpected args: %s", got)
+	}
+	if got := strings.Join(wlrRandrArgs("HDMI-A-2", "", 0), " "); got != "--output HDMI-A-2 --transform normal" {
+		t.Fatalf("unexpected args: %s", got)
+	}
+}
+
+func TestHandleDisplayConfigGet(t *testing.T) {
+	root := t.TempDir()
+	writeDRMConnectorForTest(t, root, "card1-HDMI-A-1", "connected\n", "enabled\n", "1920x1080\n")
+	writeDRMConnectorForTest(t, root, "card1-HDMI-A-2", "connected\n", "enabled\n", "1920x1080\n")
+	original := DRMRoot
+	DRMRoot = root
+	t.Cleanup(func() { DRMRoot = original })
+	setCmdlineForTest(t, "console=tty1 video=HDMI-A-1:1280x720,rotate=90\n")
+	setCurrentConfigForTest(t, Config{Displays: []DisplayOutputConfig{{Output: "HDMI-A-2", Rotation: 180}}})
+
+	w := httptest.NewRecorder()
+	HandleDisplayConfig(w, httptest.NewRequest(http.MethodGet, "/api/menu/display/config", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp struct {
+		Data []DisplayModeConfig `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("expected 2 outputs, got %+v", resp.Data)
+	}
+	if first := resp.Data[0]; first.Resolution != "1280x720" || first.Rotation != 90 || first.Cmdline == "" {
+		t.Fatalf("expected mode from cmdline, got %+v", first)
+	}
+	if second := resp.Data[1]; second.Rotation != 180 {
+		t.Fatalf("expected mode from config, got %+v", second)
+	}
+}
+
+func TestHandleDisplayConfigPutAppliesLive(t *testing.T) {
+	path := setCmdlineForTest(t, "console=tty1\n")
+	calls := stubWlrRandr(t, nil)
+	setConfigPathForTest(t, filepath.Join(t.TempDir(), "agent.yaml"))
+	setCurrentConfigForTest(t, Config{Displays: []DisplayOutputConfig{{Output: "HDMI-A-1", Playlist: "left.m3u"}}})
+	before := GetCurrentConfig()
+
+	body := `{"output":"HDMI-A-1","resolution":"1080x1920","rotation":90}`
+	w := httptest.NewRecorder()
+	HandleDisplayConfig(w, httptest.NewRequest(http.MethodPut, "/api/menu/display/config", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"result":"applied"`) {
+		t.Fatalf("expected live apply, got %s", w.Body.String())
+	}
+	if len(*calls) != 1 {
+		t.Fatalf("expected one wlr-randr call, got %v", *calls)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "video=HDMI-A-1:1080x1920,rotate=90") {
+		t.Fatalf("unexpected cmdline: %q", data)
+	}
+	display := GetCurrentConfig().Displays[0]
+	if display.Rotation != 90 || display.Resolution != "1080x1920" || display.Playlist != "left.m3u" {
+		t.Fatalf("unexpected stored display: %+v", display)
+	}
+	if before.Displays[0].Rotation != 0 {
+		t.Fatal("previously returned config must not change")
+	}
+}
+
+func TestHandleDisplayConfigPutRequiresRebootWithoutCompositor(t *testing.T) {
+	setCmdlineForTest(t, "console=tty1\n")
+	stubWlrRandr(t, errors.New("no compositor"))
+	setCurrentConfigForTest(t, Config{})
+
+	w := httptest.NewRecorder()
+	HandleDisplayConfig(w, httptest.NewRequest(http.MethodPut, "/api/menu/display/config", strings.NewReader(`{"output":"HDMI-A-1","rotation":270}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"result":"reboot-required"`) {
+		t.Fatalf("expected reboot-required, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	HandleDisplayConfig(w, httptest.NewRequest(http.MethodPut, "/api/menu/display/config", strings.NewReader(`{"output":"HDMI-A-1","rotation":45}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid rotation, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	HandleDisplayConfig(w, httptest.NewRequest(http.MethodPost, "/api/menu/display/config", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", w.Code)
+	}
+}
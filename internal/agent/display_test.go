@@ -0,0 +1,255 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeDRMConnectorForTest(t *testing.T, root, name, status, enabled, modes string) {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for file, value := range map[string]string{"status": status, "enabled": enabled, "modes": modes} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func setSystemdUnitDirForTest(t *testing.T) string {
+	t.Helper()
+	original := SystemdUnitDir
+	SystemdUnitDir = t.TempDir()
+	t.Cleanup(func() { SystemdUnitDir = original })
+	return SystemdUnitDir
+}
+
+func TestDiscoverDisplays(t *testing.T) {
+	root := t.TempDir()
+	writeDRMConnectorForTest(t, root, "card1-HDMI-A-2", "disconnected\n", "disabled\n", "")
+	writeDRMConnectorForTest(t, root, "card1-HDMI-A-1", "connected\n", "enabled\n", "1920x1080\n1920x1080\n1280x720\n")
+	writeDRMConnectorForTest(t, root, "card1-Writeback-1", "unknown\n", "disabled\n", "")
+	if err := os.MkdirAll(filepath.Join(root, "card1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	outputs, err := discoverDisplays(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 2 {
+		t.Fatalf("expected 2 outputs, got %+v", outputs)
+	}
+	first := outputs[0]
+	if first.Name != "HDMI-A-1" || first.Card != "card1" || !first.Connected || !first.Enabled {
+		t.Fatalf("unexpected first output: %+v", first)
+	}
+	if strings.Join(first.Modes, ",") != "1920x1080,1280x720" {
+		t.Fatalf("unexpected modes: %v", first.Modes)
+	}
+	if outputs[1].Name != "HDMI-A-2" || outputs[1].Connected {
+		t.Fatalf("unexpected second output: %+v", outputs[1])
+	}
+
+	missing, err := discoverDisplays(filepath.Join(root, "missing"))
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("expected no outputs for missing root, got %v, %v", missing, err)
+	}
+}
+
+func TestNormalizeDisplaysRejectsInvalidSettings(t *testing.T) {
+	cases := map[string][]DisplayOutputConfig{
+		"output":     {{Output: "HDMI A 1"}},
+		"duplicate":  {{Output: "HDMI-A-1"}, {Output: "HDMI-A-1"}},
+		"resolution": {{Output: "HDMI-A-1", Resolution: "1080p"}},
+		"rotation":   {{Output: "HDMI-A-1", Rotation: 45}},
+		"playlist":   {{Output: "HDMI-A-1", Playlist: "../etc/passwd"}},
+	}
+	for name, displays := range cases {
+		if _, err := normalizeDisplays(displays); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	displays, err := normalizeDisplays([]DisplayOutputConfig{{Output: " HDMI-A-2 ", Resolution: "1280x720@60", Rotation: 90, Playlist: "right/./list.m3u"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if displays[0].Output != "HDMI-A-2" || displays[0].Playlist != "right/list.m3u" {
+		t.Fatalf("unexpected normalized display: %+v", displays[0])
+	}
+}
+
+func TestRenderPlaybackUnitsForDisplays(t *testing.T) {
+	config := Config{
+		MediaPiServiceUser: "pi",
+		Playlist:           PlaylistConfig{Destination: "/var/media-pi/"},
+		Displays: []DisplayOutputConfig{
+			{Output: "HDMI-A-1"},
+			{Output: "HDMI-A-2", Playlist: "right.m3u", PlayerArgs: "--screen {output}"},
+		},
+	}
+	units, err := renderPlaybackUnits(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 3 {
+		t.Fatalf("expected 3 units, got %d", len(units))
+	}
+
+	group := units[0]
+	if group.Name != playbackServiceUnit || !group.Enable {
+		t.Fatalf("unexpected group unit: %+v", group)
+	}
+	for _, want := range []string{"Wants=play.video@HDMI-A-1.service play.video@HDMI-A-2.service", "Type=oneshot", "RemainAfterExit=yes"} {
+		if !strings.Contains(group.Content, want) {
+			t.Errorf("group unit missing %q:\n%s", want, group.Content)
+		}
+	}
+
+	first, second := units[1], units[2]
+	if first.Name != "play.video@HDMI-A-1.service" || first.Enable {
+		t.Fatalf("unexpected output unit: %+v", first)
+	}
+	if !strings.Contains(first.Content, "ExecStart="+DefaultPlayerCommand+" --vout=drm_vout --drm-vout-display=HDMI-A-1 /var/media-pi/playlist.m3u") {
+		t.Errorf("unexpected ExecStart:\n%s", first.Content)
+	}
+	if !strings.Contains(first.Content, "PartOf=play.video.service") {
+		t.Errorf("output unit must be part of play.video.service:\n%s", first.Content)
+	}
+	if !strings.Contains(second.Content, "--screen HDMI-A-2 /var/media-pi/right.m3u") {
+		t.Errorf("unexpected ExecStart:\n%s", second.Content)
+	}
+
+	single, err := renderPlaybackUnits(Config{Playlist: PlaylistConfig{Destination: "/var/media-pi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(single) != 1 || !strings.Contains(single[0].Content, "Type=simple") {
+		t.Fatalf("expected a single simple playback unit, got %+v", single)
+	}
+}
+
+func TestHandleDisplayOutputsUpdate(t *testing.T) {
+	t.Setenv("MEDIA_PI_AGENT_MOCK_DBUS", "1")
+	unitDir := setSystemdUnitDirForTest(t)
+	stale := filepath.Join(unitDir, "play.video@HDMI-A-9.service")
+	if err := os.WriteFile(stale, []byte("[Unit]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setConfigPathForTest(t, filepath.Join(t.TempDir(), "agent.yaml"))
+	setCurrentConfigForTest(t, Config{Playlist: PlaylistConfig{Destination: "/var/media-pi"}})
+
+	body := `{"outputs":[{"output":"HDMI-A-1"},{"output":"HDMI-A-2","rotation":90,"playlist":"right.m3u"}]}`
+	w := httptest.NewRecorder()
+	HandleDisplayOutputsUpdate(w, httptest.NewRequest(http.MethodPut, "/api/menu/display/outputs", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if got := GetCurrentConfig().Displays; len(got) != 2 || got[1].Rotation != 90 {
+		t.Fatalf("unexpected displays: %+v", got)
+	}
+	saved, err := os.ReadFile(ConfigPath)
+	if err != nil || !bytes.Contains(saved, []byte("right.m3u")) {
+		t.Fatalf("expected displays saved to config, got %q, %v", saved, err)
+	}
+	for _, unit := range []string{playbackServiceUnit, "play.video@HDMI-A-1.service", "play.video@HDMI-A-2.service"} {
+		if _, err := os.Stat(filepath.Join(unitDir, unit)); err != nil {
+			t.Errorf("expected %s to be written: %v", unit, err)
+		}
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected stale unit to be removed, got %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	HandleDisplayOutputsUpdate(w, httptest.NewRequest(http.MethodPut, "/api/menu/display/outputs", strings.NewReader(`{"outputs":[{"output":"HDMI-A-1","rotation":45}]}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid rotation, got %d", w.Code)
+	}
+}
+
+func TestHandleDisplayPlayback(t *testing.T) {
+	t.Setenv("MEDIA_PI_AGENT_MOCK_DBUS", "1")
+	setCurrentConfigForTest(t, Config{Displays: []DisplayOutputConfig{{Output: "HDMI-A-1"}}})
+
+	w := httptest.NewRecorder()
+	HandleDisplayPlayback(dbusUnitOperationStop)(w, httptest.NewRequest(http.MethodPost, "/api/menu/display/stop", strings.NewReader(`{"output":"HDMI-A-2"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for unconfigured output, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	HandleDisplayPlayback(dbusUnitOperationStart)(w, httptest.NewRequest(http.MethodPost, "/api/menu/display/start", strings.NewReader(`{"output":"HDMI-A-1"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data MenuActionResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Action != "display-start" || resp.Data.Result != "done" {
+		t.Fatalf("unexpected response: %+v", resp.Data)
+	}
+}
+
+func TestListDisplaysIncludesConfiguredOutputs(t *testing.T) {
+	t.Setenv("MEDIA_PI_AGENT_MOCK_DBUS", "1")
+	root := t.TempDir()
+	writeDRMConnectorForTest(t, root, "card1-HDMI-A-1", "connected\n", "enabled\n", "1920x1080\n")
+	original := DRMRoot
+	DRMRoot = root
+	t.Cleanup(func() { DRMRoot = original })
+
+	outputs, err := listDisplays(t.Context(), Config{Displays: []DisplayOutputConfig{{Output: "HDMI-A-1"}, {Output: "HDMI-A-2"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 2 {
+		t.Fatalf("expected 2 outputs, got %+v", outputs)
+	}
+	if outputs[0].Config == nil || outputs[0].Unit != "play.video@HDMI-A-1.service" || outputs[0].UnitState != "inactive" {
+		t.Fatalf("unexpected configured output: %+v", outputs[0])
+	}
+	if outputs[1].Name != "HDMI-A-2" || outputs[1].Connected || outputs[1].Config == nil {
+		t.Fatalf("unexpected undiscovered output: %+v", outputs[1])
+	}
+}
+
+func TestSyncKeepsDisplayPlaylists(t *testing.T) {
+	mediaDir := t.TempDir()
+	for _, name := range []string{"playlist.m3u", "right.m3u", "orphan.mp4"} {
+		if err := os.WriteFile(filepath.Join(mediaDir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := Config{
+		Playlist: PlaylistConfig{Destination: mediaDir},
+		Displays: []DisplayOutputConfig{{Output: "HDMI-A-1"}, {Output: "HDMI-A-2", Playlist: "right.m3u"}},
+	}
+	if err := syncFiles(t.Context(), config, &Manifest{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"playlist.m3u", "right.m3u"} {
+		if _, err := os.Stat(filepath.Join(mediaDir, name)); err != nil {
+			t.Errorf("expected %s to be kept: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "orphan.mp4")); !os.IsNotExist(err) {
+		t.Errorf("expected orphan.mp4 to be collected, got %v", err)
+	}
+}
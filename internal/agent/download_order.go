@@ -0,0 +1,83 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// playlistFileName is the playlist written by playlist sync.
+const playlistFileName = "playlist.m3u"
+
+// activePlaylistFiles returns the media paths, relative to the media
+// directory holding them, that the playlist in playlistDir references. A
+// missing playlist yields an empty set.
+func activePlaylistFiles(playlistDir string, mediaDirs ...string) map[string]struct{} {
+	files := make(map[string]struct{})
+	if playlistDir == "" {
+		return files
+	}
+	file, err := os.Open(filepath.Join(playlistDir, playlistFileName))
+	if err != nil {
+		return files
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") || strings.Contains(entry, "://") {
+			continue
+		}
+		entry = filepath.FromSlash(entry)
+		if filepath.IsAbs(entry) {
+			// Relative to the innermost media directory holding it
+			rel := ""
+			for _, dir := range mediaDirs {
+				r, err := filepath.Rel(dir, entry)
+				if err != nil || strings.HasPrefix(r, "..") {
+					continue
+				}
+				if rel == "" || len(r) < len(rel) {
+					rel = r
+				}
+			}
+			if rel == "" {
+				continue
+			}
+			entry = rel
+		}
+		files[filepath.Clean(entry)] = struct{}{}
+	}
+	return files
+}
+
+// orderForDownload sorts items so that files of the active playlist come
+// first, then by descending Priority and ascending Order. Items without an
+// Order follow ordered ones; ties keep manifest order. A paged manifest is
+// downloaded page by page to bound memory, so items are ordered only
+// within their page.
+func orderForDownload(items []ManifestItem, active map[string]struct{}) {
+	inPlaylist := func(item ManifestItem) bool {
+		_, ok := active[filepath.Clean(filepath.FromSlash(item.Filename))]
+		return ok
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if pa, pb := inPlaylist(a), inPlaylist(b); pa != pb {
+			return pa
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if (a.Order == 0) != (b.Order == 0) {
+			return a.Order != 0
+		}
+		return a.Order < b.Order
+	})
+}
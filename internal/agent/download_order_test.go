@@ -0,0 +1,107 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOrderForDownload(t *testing.T) {
+	items := []ManifestItem{
+		{ID: 1, Filename: "a.mp4"},
+		{ID: 2, Filename: "b.mp4", Order: 2},
+		{ID: 3, Filename: "c.mp4", Priority: 5},
+		{ID: 4, Filename: "d.mp4", Order: 1},
+		{ID: 5, Filename: "sub/e.mp4"},
+		{ID: 6, Filename: "f.mp4"},
+	}
+	orderForDownload(items, map[string]struct{}{filepath.FromSlash("sub/e.mp4"): {}})
+
+	var got []int64
+	for _, item := range items {
+		got = append(got, item.ID)
+	}
+	want := []int64{5, 3, 4, 2, 1, 6}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("download order = %v, want %v", got, want)
+	}
+}
+
+func TestActivePlaylistFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	playlist := "#EXTM3U\n#EXTINF:-1,clip\n" + filepath.Join(tmpDir, "clip.mp4") + "\nsub/other.mp4\nhttp://example.com/live.m3u8\n/elsewhere/x.mp4\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, playlistFileName), []byte(playlist), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := activePlaylistFiles(tmpDir, tmpDir)
+	if len(files) != 2 {
+		t.Fatalf("expected 2 playlist files, got %v", files)
+	}
+	for _, name := range []string{"clip.mp4", filepath.FromSlash("sub/other.mp4")} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in playlist files %v", name, files)
+		}
+	}
+
+	if files := activePlaylistFiles(t.TempDir(), tmpDir); len(files) != 0 {
+		t.Errorf("expected no files without playlist, got %v", files)
+	}
+}
+
+func TestSyncFilesDownloadsPlaylistFilesFirst(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, playlistFileName), []byte("late.mp4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "data"
+	manifest := &Manifest{
+		{ID: 1, Filename: "early.mp4", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content)},
+		{ID: 2, Filename: "urgent.mp4", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content), Priority: 1},
+		{ID: 3, Filename: "late.mp4", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content)},
+	}
+
+	var order []string
+	fetch := func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		order = append(order, item.Filename)
+		return os.WriteFile(destPath, []byte(content), 0644)
+	}
+	config := Config{Playlist: PlaylistConfig{Destination: tmpDir}}
+	if err := syncFilesFrom(context.Background(), config, manifest, fetch); err != nil {
+		t.Fatalf("syncFilesFrom() error = %v", err)
+	}
+
+	want := []string{"late.mp4", "urgent.mp4", "early.mp4"}
+	if !reflect.DeepEqual(order, want) {
+		t.Fatalf("download order = %v, want %v", order, want)
+	}
+}
+
+func TestSyncPagedManifestOrdersDownloadsWithinEachPage(t *testing.T) {
+	item := func(id int64, name string, priority int) ManifestItem {
+		return ManifestItem{ID: id, Filename: name, FileSizeBytes: int64(len(name)), SHA256: sha256Hex(name), Priority: priority}
+	}
+	source := &fakeSyncSource{
+		batches: [][]ManifestItem{
+			{item(1, "low.mp4", 0), item(2, "mid.mp4", 1)},
+			{item(3, "high.mp4", 5)},
+		},
+		files: map[string]string{"low.mp4": "low.mp4", "mid.mp4": "mid.mp4", "high.mp4": "high.mp4"},
+	}
+	config := Config{Playlist: PlaylistConfig{Destination: t.TempDir()}}
+	if _, _, err := syncFromSource(context.Background(), config, source, manifestValidators{}); err != nil {
+		t.Fatal(err)
+	}
+	// Pages are downloaded as they arrive, so a later page does not
+	// overtake an earlier one whatever its priority.
+	want := []string{"mid.mp4", "low.mp4", "high.mp4"}
+	if !reflect.DeepEqual(source.fetched, want) {
+		t.Fatalf("download order = %v, want %v", source.fetched, want)
+	}
+}
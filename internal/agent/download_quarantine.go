@@ -0,0 +1,274 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultQuarantineAfter is how many downloads of an item in a row may fail
+// verification before the item is quarantined.
+const DefaultQuarantineAfter = 3
+
+// downloadQuarantineFilePath persists the failure counts across restarts.
+var downloadQuarantineFilePath = filepath.Join(agentStateDir, "quarantine.json")
+
+const metricSyncQuarantined = "media_pi_sync_quarantined_items"
+
+func init() {
+	registerGauge(metricSyncQuarantined, "Manifest items skipped by sync after repeatedly failing verification.")
+}
+
+// errContentMismatch matches downloads whose size or digest differs from
+// the manifest item. Only these count towards the quarantine: a network
+// error says nothing about the content the core serves.
+var errContentMismatch = errors.New("content mismatch")
+
+type contentMismatchError struct{ msg string }
+
+func (e contentMismatchError) Error() string        { return e.msg }
+func (e contentMismatchError) Is(target error) bool { return target == errContentMismatch }
+
+func contentMismatchf(format string, args ...any) error {
+	return contentMismatchError{msg: fmt.Sprintf(format, args...)}
+}
+
+// DownloadFailure counts the failed downloads of one manifest item since
+// its last good copy. QuarantinedAt is set once the item is skipped.
+type DownloadFailure struct {
+	ID            int64      `json:"id"`
+	Filename      string     `json:"filename"`
+	Hash          string     `json:"hash"`
+	Failures      int        `json:"failures"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastFailure   time.Time  `json:"lastFailure"`
+	QuarantinedAt *time.Time `json:"quarantinedAt,omitempty"`
+}
+
+var (
+	downloadFailures     = map[int64]DownloadFailure{}
+	downloadFailuresLock sync.Mutex
+)
+
+// quarantineAfter returns sync.quarantine_after; a negative value disables
+// the quarantine.
+func quarantineAfter(config SyncConfig) int {
+	if config.QuarantineAfter == 0 {
+		return DefaultQuarantineAfter
+	}
+	return config.QuarantineAfter
+}
+
+// itemContentDigest identifies the content a manifest item promises; a new
+// digest lifts the quarantine of the item.
+func itemContentDigest(item ManifestItem) string {
+	verifier, err := newItemVerifier(item)
+	if err != nil {
+		return ""
+	}
+	return verifier.algorithm + ":" + strings.ToLower(strings.TrimSpace(verifier.expected))
+}
+
+// downloadQuarantined reports whether sync must skip item. A record kept
+// for another digest of the item is dropped.
+func downloadQuarantined(config SyncConfig, item ManifestItem) bool {
+	downloadFailuresLock.Lock()
+	defer downloadFailuresLock.Unlock()
+	record, ok := downloadFailures[item.ID]
+	if !ok {
+		return false
+	}
+	if record.Hash != itemContentDigest(item) {
+		if record.QuarantinedAt != nil {
+			log.Printf("Manifest hash of %s (ID: %d) changed, lifting its quarantine", item.Filename, item.ID)
+		}
+		delete(downloadFailures, item.ID)
+		updateQuarantineMetricLocked()
+		return false
+	}
+	return record.QuarantinedAt != nil && quarantineAfter(config) > 0
+}
+
+// recordDownloadFailure counts a failed download of item and quarantines
+// it after sync.quarantine_after verification failures in a row.
+func recordDownloadFailure(config SyncConfig, item ManifestItem, err error) {
+	if !errors.Is(err, errContentMismatch) {
+		return
+	}
+	downloadFailuresLock.Lock()
+	defer downloadFailuresLock.Unlock()
+	digest := itemContentDigest(item)
+	record := downloadFailures[item.ID]
+	if record.Hash != digest {
+		record = DownloadFailure{ID: item.ID, Hash: digest}
+	}
+	now := time.Now()
+	record.Filename = item.Filename
+	record.Failures++
+	record.LastError = err.Error()
+	record.LastFailure = now
+	if limit := quarantineAfter(config); limit > 0 && record.Failures >= limit && record.QuarantinedAt == nil {
+		record.QuarantinedAt = &now
+		log.Printf("Warning: %s (ID: %d) failed verification %d times in a row, quarantining it until its manifest hash changes", item.Filename, item.ID, record.Failures)
+	}
+	downloadFailures[item.ID] = record
+	updateQuarantineMetricLocked()
+}
+
+// clearDownloadFailures forgets the failures of item once a good copy is in
+// place.
+func clearDownloadFailures(item ManifestItem) {
+	downloadFailuresLock.Lock()
+	defer downloadFailuresLock.Unlock()
+	if _, ok := downloadFailures[item.ID]; ok {
+		delete(downloadFailures, item.ID)
+		updateQuarantineMetricLocked()
+	}
+}
+
+// pruneDownloadFailures drops records of items the manifest no longer
+// lists and persists the rest.
+func pruneDownloadFailures(items map[string]ManifestItem) {
+	ids := make(map[int64]struct{}, len(items))
+	for _, item := range items {
+		ids[item.ID] = struct{}{}
+	}
+	downloadFailuresLock.Lock()
+	for id := range downloadFailures {
+		if _, ok := ids[id]; !ok {
+			delete(downloadFailures, id)
+		}
+	}
+	updateQuarantineMetricLocked()
+	downloadFailuresLock.Unlock()
+	persistDownloadFailures()
+}
+
+// quarantinedDownloads lists the quarantined items by filename.
+func quarantinedDownloads() []DownloadFailure {
+	downloadFailuresLock.Lock()
+	defer downloadFailuresLock.Unlock()
+	var quarantined []DownloadFailure
+	for _, record := range downloadFailures {
+		if record.QuarantinedAt != nil {
+			quarantined = append(quarantined, record)
+		}
+	}
+	sort.Slice(quarantined, func(i, j int) bool { return quarantined[i].Filename < quarantined[j].Filename })
+	return quarantined
+}
+
+// releaseQuarantine lets the next sync retry the quarantined item id, or
+// every quarantined item when id is 0. It returns how many were released.
+func releaseQuarantine(id int64) int {
+	downloadFailuresLock.Lock()
+	released := 0
+	for key, record := range downloadFailures {
+		if record.QuarantinedAt != nil && (id == 0 || key == id) {
+			delete(downloadFailures, key)
+			released++
+		}
+	}
+	updateQuarantineMetricLocked()
+	downloadFailuresLock.Unlock()
+	if released > 0 {
+		persistDownloadFailures()
+	}
+	return released
+}
+
+func updateQuarantineMetricLocked() {
+	quarantined := 0
+	for _, record := range downloadFailures {
+		if record.QuarantinedAt != nil {
+			quarantined++
+		}
+	}
+	metricSet(metricSyncQuarantined, float64(quarantined))
+}
+
+func persistDownloadFailures() {
+	downloadFailuresLock.Lock()
+	records := make([]DownloadFailure, 0, len(downloadFailures))
+	for _, record := range downloadFailures {
+		records = append(records, record)
+	}
+	downloadFailuresLock.Unlock()
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	if err := writeStateFile(downloadQuarantineFilePath, records); err != nil {
+		log.Printf("Warning: Failed to persist download quarantine: %v", err)
+	}
+}
+
+func loadDownloadFailures() {
+	var records []DownloadFailure
+	switch err := readStateFile(downloadQuarantineFilePath, &records); {
+	case err == nil:
+		downloadFailuresLock.Lock()
+		downloadFailures = make(map[int64]DownloadFailure, len(records))
+		for _, record := range records {
+			downloadFailures[record.ID] = record
+		}
+		updateQuarantineMetricLocked()
+		downloadFailuresLock.Unlock()
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("Warning: ignoring download quarantine: %v", err)
+	}
+}
+
+// QuarantineReleaseRequest selects the item to release; without an id
+// every quarantined item is released.
+type QuarantineReleaseRequest struct {
+	ID int64 `json:"id,omitempty"`
+}
+
+// HandleSyncQuarantine lists the items sync skips after repeated
+// verification failures.
+func HandleSyncQuarantine(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	quarantined := quarantinedDownloads()
+	if quarantined == nil {
+		quarantined = []DownloadFailure{}
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: quarantined})
+}
+
+// HandleSyncQuarantineRelease lets the next sync retry quarantined items,
+// e.g. after the core fixed a file without changing its hash.
+func HandleSyncQuarantineRelease(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req QuarantineReleaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+		return
+	}
+	released := releaseQuarantine(req.ID)
+	if req.ID != 0 && released == 0 {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Файл не в карантине: %v", req.ID)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: MenuActionResponse{
+			Action:  "quarantine-release",
+			Result:  "success",
+			Message: fmt.Sprintf("Из карантина возвращено файлов: %d", released),
+		},
+	})
+}
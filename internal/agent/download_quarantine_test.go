@@ -0,0 +1,136 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setDownloadFailuresForTest(t *testing.T) {
+	t.Helper()
+	originalPath := downloadQuarantineFilePath
+	downloadQuarantineFilePath = filepath.Join(t.TempDir(), "quarantine.json")
+	downloadFailuresLock.Lock()
+	original := downloadFailures
+	downloadFailures = map[int64]DownloadFailure{}
+	downloadFailuresLock.Unlock()
+	t.Cleanup(func() {
+		downloadFailuresLock.Lock()
+		downloadFailures = original
+		downloadFailuresLock.Unlock()
+		downloadQuarantineFilePath = originalPath
+	})
+}
+
+func TestContentMismatchErrors(t *testing.T) {
+	err := writeVerifiedContent(strings.NewReader("short"), ManifestItem{FileSizeBytes: 10, SHA256: sha256Hex("short")}, filepath.Join(t.TempDir(), "f"))
+	if !errors.Is(err, errContentMismatch) || !strings.Contains(err.Error(), "file size mismatch") {
+		t.Fatalf("size mismatch error = %v", err)
+	}
+	err = writeVerifiedContent(strings.NewReader("other"), ManifestItem{FileSizeBytes: 5, SHA256: sha256Hex("video")}, filepath.Join(t.TempDir(), "f"))
+	if !errors.Is(fmt.Errorf("failed to sync files: %w", err), errContentMismatch) {
+		t.Fatalf("digest mismatch error = %v", err)
+	}
+}
+
+func TestSyncQuarantinesRepeatedlyFailingItem(t *testing.T) {
+	setDownloadFailuresForTest(t)
+	mediaDir := t.TempDir()
+	config := Config{Playlist: PlaylistConfig{Destination: mediaDir}, Sync: SyncConfig{QuarantineAfter: 2}}
+
+	fetches := 0
+	content := "corrupt"
+	fetch := func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		fetches++
+		return writeVerifiedContent(strings.NewReader(content), item, destPath)
+	}
+	manifest := &Manifest{{ID: 7, Filename: "clip.mp4", FileSizeBytes: 7, SHA256: sha256Hex("good-v1")}}
+
+	for range 2 {
+		if err := syncFilesFrom(context.Background(), config, manifest, fetch); err == nil {
+			t.Fatal("expected a download error")
+		}
+	}
+	quarantined := quarantinedDownloads()
+	if len(quarantined) != 1 || quarantined[0].ID != 7 || quarantined[0].Failures != 2 {
+		t.Fatalf("quarantined = %+v", quarantined)
+	}
+
+	// A quarantined item is skipped without failing the sync.
+	if err := syncFilesFrom(context.Background(), config, manifest, fetch); err != nil {
+		t.Fatalf("syncFilesFrom() error = %v", err)
+	}
+	if fetches != 2 {
+		t.Fatalf("fetches = %d, want 2", fetches)
+	}
+
+	// The quarantine survives a restart.
+	downloadFailuresLock.Lock()
+	downloadFailures = map[int64]DownloadFailure{}
+	downloadFailuresLock.Unlock()
+	loadDownloadFailures()
+	if len(quarantinedDownloads()) != 1 {
+		t.Fatal("the quarantine was not persisted")
+	}
+
+	// A new hash in the manifest lifts the quarantine.
+	content = "good-v2"
+	(*manifest)[0].SHA256 = sha256Hex("good-v2")
+	if err := syncFilesFrom(context.Background(), config, manifest, fetch); err != nil {
+		t.Fatalf("syncFilesFrom() error = %v", err)
+	}
+	if fetches != 3 || len(quarantinedDownloads()) != 0 {
+		t.Fatalf("fetches = %d, quarantined = %+v", fetches, quarantinedDownloads())
+	}
+	if data, _ := os.ReadFile(filepath.Join(mediaDir, "clip.mp4")); string(data) != "good-v2" {
+		t.Fatalf("clip.mp4 = %q", data)
+	}
+}
+
+func TestNetworkErrorsDoNotQuarantine(t *testing.T) {
+	setDownloadFailuresForTest(t)
+	item := ManifestItem{ID: 1, Filename: "clip.mp4", FileSizeBytes: 1, SHA256: sha256Hex("x")}
+	for range 5 {
+		recordDownloadFailure(SyncConfig{}, item, errors.New("connection reset"))
+	}
+	if downloadQuarantined(SyncConfig{}, item) {
+		t.Fatal("network errors must not quarantine an item")
+	}
+	for range DefaultQuarantineAfter {
+		recordDownloadFailure(SyncConfig{}, item, contentMismatchf("SHA256 mismatch"))
+	}
+	if downloadQuarantined(SyncConfig{QuarantineAfter: -1}, item) {
+		t.Fatal("a negative quarantine_after disables the quarantine")
+	}
+	if !downloadQuarantined(SyncConfig{}, item) {
+		t.Fatal("expected the item to be quarantined")
+	}
+}
+
+func TestHandleSyncQuarantineRelease(t *testing.T) {
+	setDownloadFailuresForTest(t)
+	item := ManifestItem{ID: 3, Filename: "clip.mp4", FileSizeBytes: 1, SHA256: sha256Hex("x")}
+	for range DefaultQuarantineAfter {
+		recordDownloadFailure(SyncConfig{}, item, contentMismatchf("SHA256 mismatch"))
+	}
+
+	w := httptest.NewRecorder()
+	HandleSyncQuarantineRelease(w, httptest.NewRequest(http.MethodPost, "/api/sync/quarantine/release", strings.NewReader(`{"id":4}`)))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+	w = httptest.NewRecorder()
+	HandleSyncQuarantineRelease(w, httptest.NewRequest(http.MethodPost, "/api/sync/quarantine/release", nil))
+	if w.Code != http.StatusOK || len(quarantinedDownloads()) != 0 {
+		t.Fatalf("status = %d, quarantined = %+v", w.Code, quarantinedDownloads())
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// EffectiveConfiguration is what the agent actually runs with: the loaded
+// agent.yaml, the environment variables that change its behaviour and the
+// runtime state derived from them.
+type EffectiveConfiguration struct {
+	ConfigPath string `json:"configPath"`
+	// Config holds the loaded configuration with agent.yaml keys and
+	// defaults applied. Secrets are masked.
+	Config      map[string]any    `json:"config"`
+	Environment map[string]string `json:"environment"`
+	// Timeouts are the operation timeouts in effect, defaults included.
+	Timeouts  map[string]string `json:"timeouts"`
+	Schedules []ScheduledJob    `json:"schedules"`
+	// Audio is the output selected by asound.conf, which may differ from
+	// audio.output when the file was edited by hand.
+	Audio AudioSettings `json:"audio"`
+}
+
+// ScheduledJob is an entry loaded in the sync scheduler.
+type ScheduledJob struct {
+	// Kind is playlist, video or rest-end.
+	Kind string `json:"kind"`
+	Time string `json:"time"`
+	// Effective is the configured time moved by the device's sync offset
+	// (HH:MM:SS); it is set for playlist and video syncs.
+	Effective string     `json:"effective,omitempty"`
+	Next      *time.Time `json:"next,omitempty"`
+}
+
+// cronJob records an entry added to cronScheduler.
+type cronJob struct {
+	kind      string
+	time      string
+	effective string
+	// delay is waited after the cron entry fires.
+	delay time.Duration
+	id    cron.EntryID
+}
+
+// maskedSecret replaces secret values in the effective configuration.
+const maskedSecret = "***"
+
+// effectiveEnvironment lists the environment variables read by the running
+// agent.
+var effectiveEnvironment = []string{"MEDIA_PI_AGENT_CONFIG", "FFMPEG_PATH", "MEDIA_PI_AGENT_MOCK_DBUS", "MEDIA_PI_AGENT_SIMULATE", "MEDIA_PI_AGENT_ROOT", "MEDIA_PI_AGENT_CONTAINER", "WAYLAND_DISPLAY"}
+
+// loadedSchedules returns the entries of the running sync scheduler.
+func loadedSchedules() []ScheduledJob {
+	cronSchedulerLock.Lock()
+	defer cronSchedulerLock.Unlock()
+
+	jobs := make([]ScheduledJob, 0, len(cronJobs))
+	for _, job := range cronJobs {
+		scheduled := ScheduledJob{Kind: job.kind, Time: job.time, Effective: job.effective}
+		if cronScheduler != nil {
+			if next := cronScheduler.Entry(job.id).Next; !next.IsZero() {
+				next = next.Add(job.delay)
+				scheduled.Next = &next
+			}
+		}
+		jobs = append(jobs, scheduled)
+	}
+	return jobs
+}
+
+// configAsMap converts config to a map keyed like agent.yaml, with secrets
+// masked.
+func configAsMap(config Config) (map[string]any, error) {
+	for _, secret := range configSecrets(&config) {
+		if *secret.value != "" {
+			*secret.value = maskedSecret
+		}
+	}
+	data, err := yaml.Marshal(&config)
+	if err != nil {
+		return nil, err
+	}
+	view := map[string]any{}
+	if err := yaml.Unmarshal(data, &view); err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
+func getEffectiveConfiguration() (EffectiveConfiguration, error) {
+	view, err := configAsMap(GetCurrentConfig())
+	if err != nil {
+		return EffectiveConfiguration{}, err
+	}
+
+	environment := map[string]string{}
+	for _, name := range effectiveEnvironment {
+		if value, ok := os.LookupEnv(name); ok {
+			environment[name] = value
+		}
+	}
+
+	audio, err := readAudioSettings()
+	if err != nil {
+		return EffectiveConfiguration{}, err
+	}
+
+	return EffectiveConfiguration{
+		ConfigPath:  ConfigPath,
+		Config:      view,
+		Environment: environment,
+		Timeouts: map[string]string{
+			"manifest":           manifestTimeout().String(),
+			"download":           downloadTimeout().String(),
+			"playlist":           playlistTimeout().String(),
+			"screenshot":         screenshotTimeout().String(),
+			"dbus_operation":     dbusTimeout().String(),
+			"playback_operation": playbackOperationTimeout().String(),
+		},
+		Schedules: loadedSchedules(),
+		Audio:     audio,
+	}, nil
+}
+
+// HandleEffectiveConfiguration returns the effective configuration, to
+// compare what agent.yaml says with what the device does.
+func HandleEffectiveConfiguration(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	effective, err := getEffectiveConfiguration()
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось получить действующую конфигурацию: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: effective})
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestHandleEffectiveConfiguration(t *testing.T) {
+	tmp := t.TempDir()
+	originalAudio := AudioConfigPath
+	AudioConfigPath = filepath.Join(tmp, "asound.conf")
+	t.Cleanup(func() { AudioConfigPath = originalAudio })
+	if err := os.WriteFile(AudioConfigPath, []byte("defaults.pcm.card 1\ndefaults.ctl.card 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setConfigPathForTest(t, filepath.Join(tmp, "agent.yaml"))
+	setCurrentConfigForTest(t, Config{
+		ServerKey: "secret-key",
+		Playlist:  PlaylistConfig{Destination: "/var/media-pi"},
+		Audio:     AudioConfig{Output: "hdmi"},
+		Schedule:  ScheduleConfig{Video: []string{"06:05"}},
+		Timeouts:  TimeoutsConfig{Download: 30 * time.Minute},
+	})
+	t.Setenv("FFMPEG_PATH", "/opt/ffmpeg")
+
+	cronSchedulerLock.Lock()
+	originalScheduler, originalJobs := cronScheduler, cronJobs
+	cronScheduler = cron.New()
+	id, err := cronScheduler.AddFunc("5 6 * * *", func() {})
+	cronScheduler.Start()
+	cronJobs = []cronJob{{kind: "video", time: "06:05", effective: "06:05:30", delay: 30 * time.Second, id: id}}
+	cronSchedulerLock.Unlock()
+	t.Cleanup(func() {
+		cronSchedulerLock.Lock()
+		cronScheduler.Stop()
+		cronScheduler, cronJobs = originalScheduler, originalJobs
+		cronSchedulerLock.Unlock()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	HandleEffectiveConfiguration(w, httptest.NewRequest(http.MethodGet, "/api/configuration/effective", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "secret-key") {
+		t.Fatalf("server key leaked: %s", w.Body.String())
+	}
+	var resp struct {
+		Data EffectiveConfiguration `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	got := resp.Data
+	if got.Config["server_key"] != maskedSecret {
+		t.Errorf("expected masked server_key, got %v", got.Config["server_key"])
+	}
+	if playlist, _ := got.Config["playlist"].(map[string]any); playlist["destination"] != "/var/media-pi" {
+		t.Errorf("expected agent.yaml keys, got %v", got.Config)
+	}
+	if got.Environment["FFMPEG_PATH"] != "/opt/ffmpeg" {
+		t.Errorf("expected FFMPEG_PATH, got %v", got.Environment)
+	}
+	if got.Timeouts["download"] != "30m0s" || got.Timeouts["manifest"] != manifestRequestTimeout.String() {
+		t.Errorf("unexpected timeouts %v", got.Timeouts)
+	}
+	if len(got.Schedules) != 1 || got.Schedules[0].Kind != "video" || got.Schedules[0].Next == nil ||
+		got.Schedules[0].Effective != "06:05:30" || got.Schedules[0].Next.Second() != 30 {
+		t.Errorf("unexpected schedules %+v", got.Schedules)
+	}
+	// The device plays through the jack although agent.yaml says hdmi.
+	if got.Audio.Output != "jack" {
+		t.Errorf("expected audio from asound.conf, got %+v", got.Audio)
+	}
+
+	w = httptest.NewRecorder()
+	HandleEffectiveConfiguration(w, httptest.NewRequest(http.MethodPost, "/api/configuration/effective", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", w.Code)
+	}
+}
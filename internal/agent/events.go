@@ -0,0 +1,159 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published on the agent event bus.
+const (
+	EventSyncStarted  = "sync.started"
+	EventSyncFinished = "sync.finished"
+	// Per-file events of a video sync.
+	EventSyncFileStarted  = "sync.file.started"
+	EventSyncFileFinished = "sync.file.finished"
+	EventSyncFileFailed   = "sync.file.failed"
+	EventUnitChanged      = "unit.changed"
+	EventPlaybackPlay     = "playback.play"
+	EventPlaybackSkipped  = "playback.skipped"
+	EventConfigChanged    = "config.changed"
+)
+
+// eventQueueSize is how many events a slow subscriber may fall behind
+// before further events are dropped for it.
+const eventQueueSize = 64
+
+const metricEventsDropped = "media_pi_events_dropped_total"
+
+func init() {
+	registerCounter(metricEventsDropped, "Events dropped because a subscriber fell behind.")
+}
+
+// Event is one notification on the agent event bus. Data holds the
+// payload of the type: SyncEvent, SyncFileEvent, UnitEvent, PlaybackEvent,
+// PlaybackSkipEvent or ConfigChangedEvent.
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data,omitempty"`
+}
+
+// SyncEvent describes a video or playlist sync run.
+type SyncEvent struct {
+	Kind      string `json:"kind"` // "video" or "playlist"
+	SessionID string `json:"sessionId,omitempty"`
+	Items     int    `json:"items,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SyncFileEvent describes the download of one manifest item.
+type SyncFileEvent struct {
+	SessionID       string  `json:"sessionId,omitempty"`
+	ID              int64   `json:"id"`
+	Filename        string  `json:"filename"`
+	SizeBytes       int64   `json:"sizeBytes"`
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// UnitEvent describes a systemd unit action the agent performed.
+type UnitEvent struct {
+	Unit   string `json:"unit"`
+	Action string `json:"action"`
+	Result string `json:"result,omitempty"`
+}
+
+// PlaybackEvent describes one finished play of a media file.
+type PlaybackEvent struct {
+	Output          string    `json:"output,omitempty"`
+	Filename        string    `json:"filename"`
+	StartedAt       time.Time `json:"startedAt"`
+	DurationSeconds float64   `json:"durationSeconds"`
+}
+
+// PlaybackSkipEvent describes a playlist file removed before playback
+// because its content is corrupt.
+type PlaybackSkipEvent struct {
+	Output   string `json:"output,omitempty"`
+	Filename string `json:"filename"`
+	Reason   string `json:"reason"`
+}
+
+// ConfigChangedEvent names the configuration section that changed; an
+// empty section means the whole file was reloaded.
+type ConfigChangedEvent struct {
+	Section string `json:"section,omitempty"`
+}
+
+type eventSubscription struct {
+	types map[string]struct{}
+	queue chan Event
+}
+
+var (
+	eventSubscribers   = map[*eventSubscription]struct{}{}
+	eventSubscribersMu sync.RWMutex
+)
+
+// SubscribeEvents calls handler for every event of the given types, or of
+// all types when none are given. Each subscriber gets its own goroutine
+// and sees events in publish order; publishers never wait for it. The
+// returned function unsubscribes.
+func SubscribeEvents(handler func(Event), types ...string) (unsubscribe func()) {
+	sub := &eventSubscription{queue: make(chan Event, eventQueueSize)}
+	if len(types) > 0 {
+		sub.types = make(map[string]struct{}, len(types))
+		for _, t := range types {
+			sub.types[t] = struct{}{}
+		}
+	}
+
+	eventSubscribersMu.Lock()
+	eventSubscribers[sub] = struct{}{}
+	eventSubscribersMu.Unlock()
+
+	go func() {
+		for event := range sub.queue {
+			handler(event)
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			eventSubscribersMu.Lock()
+			delete(eventSubscribers, sub)
+			close(sub.queue)
+			eventSubscribersMu.Unlock()
+		})
+	}
+}
+
+// publishEvent delivers an event to every interested subscriber. A
+// subscriber whose queue is full misses the event.
+func publishEvent(eventType string, data any) {
+	event := Event{Type: eventType, Time: time.Now().UTC(), Data: data}
+	switch eventType {
+	case EventSyncStarted, EventSyncFinished, EventUnitChanged, EventConfigChanged:
+		// Cached status responses describe units, syncs and the config.
+		invalidateResponseCache()
+	}
+
+	eventSubscribersMu.RLock()
+	defer eventSubscribersMu.RUnlock()
+	for sub := range eventSubscribers {
+		if sub.types != nil {
+			if _, ok := sub.types[eventType]; !ok {
+				continue
+			}
+		}
+		select {
+		case sub.queue <- event:
+		default:
+			metricAdd(metricEventsDropped, 1)
+		}
+	}
+}
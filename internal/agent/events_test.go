@@ -0,0 +1,95 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// collectEventsForTest subscribes to types and returns a function that
+// waits for n events.
+func collectEventsForTest(t *testing.T, types ...string) func(n int) []Event {
+	t.Helper()
+	events := make(chan Event, eventQueueSize)
+	unsubscribe := SubscribeEvents(func(event Event) { events <- event }, types...)
+	t.Cleanup(unsubscribe)
+	return func(n int) []Event {
+		t.Helper()
+		var got []Event
+		for len(got) < n {
+			select {
+			case event := <-events:
+				got = append(got, event)
+			case <-time.After(2 * time.Second):
+				t.Fatalf("expected %d events, got %+v", n, got)
+			}
+		}
+		return got
+	}
+}
+
+func TestSubscribeEventsFiltersAndOrders(t *testing.T) {
+	wait := collectEventsForTest(t, EventUnitChanged)
+	publishEvent(EventConfigChanged, ConfigChangedEvent{})
+	publishEvent(EventUnitChanged, UnitEvent{Unit: "a.service", Action: "start"})
+	publishEvent(EventUnitChanged, UnitEvent{Unit: "b.service", Action: "stop"})
+
+	got := wait(2)
+	if got[0].Data != (UnitEvent{Unit: "a.service", Action: "start"}) || got[1].Data != (UnitEvent{Unit: "b.service", Action: "stop"}) {
+		t.Fatalf("unexpected events %+v", got)
+	}
+}
+
+func TestPublishEventNeverBlocks(t *testing.T) {
+	block := make(chan struct{})
+	unsubscribe := SubscribeEvents(func(Event) { <-block }, EventPlaybackPlay)
+	defer unsubscribe()
+	defer close(block)
+
+	dropped := metricValue(metricEventsDropped)
+	for i := 0; i < eventQueueSize+2; i++ {
+		publishEvent(EventPlaybackPlay, PlaybackEvent{Filename: "a.mp4"})
+	}
+	if metricValue(metricEventsDropped) <= dropped {
+		t.Fatal("expected events for a stuck subscriber to be dropped")
+	}
+
+	// Unsubscribing twice is harmless.
+	unsubscribe()
+}
+
+func TestSyncAndConfigEvents(t *testing.T) {
+	wait := collectEventsForTest(t, EventSyncStarted, EventSyncFinished, EventConfigChanged)
+	setSyncSourceForTest(t, &fakeSyncSource{
+		batches: [][]ManifestItem{{{ID: 1, Filename: "one.mp4", FileSizeBytes: 3, SHA256: sha256Hex("one")}}},
+		files:   map[string]string{"one.mp4": "one"},
+	})
+	setConfigPathForTest(t, filepath.Join(t.TempDir(), "agent.yaml"))
+	setCurrentConfigForTest(t, Config{ServerKey: "key", Playlist: PlaylistConfig{Destination: t.TempDir()}})
+	setAppliedManifestValidators(GetCurrentConfig(), manifestValidators{})
+
+	if err := PerformSync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := updateDeviceIdentity(DeviceIdentity{DeviceName: "store-12"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := wait(3)
+	types := []string{got[0].Type, got[1].Type, got[2].Type}
+	if !reflect.DeepEqual(types, []string{EventSyncStarted, EventSyncFinished, EventConfigChanged}) {
+		t.Fatalf("unexpected event types %v", types)
+	}
+	session := got[0].Data.(SyncEvent).SessionID
+	if session == "" {
+		t.Fatal("expected the sync events to carry a session id")
+	}
+	if got[1].Data != (SyncEvent{Kind: "video", SessionID: session, Items: 1}) || got[2].Data != (ConfigChangedEvent{Section: "identity"}) {
+		t.Fatalf("unexpected event data %+v", got)
+	}
+}
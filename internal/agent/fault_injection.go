@@ -0,0 +1,143 @@
+//go:build chaos
+
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FaultSettings are the faults injected by a chaos build. They are read and
+// changed through /debug/faults.
+type FaultSettings struct {
+	// DropDownloadsPercent fails that share of file downloads.
+	DropDownloadsPercent int `json:"dropDownloadsPercent"`
+	// DBusDelayMillis delays every D-Bus connection.
+	DBusDelayMillis int `json:"dbusDelayMillis"`
+	// CorruptOnePerSync makes the first download of every sync run fail
+	// verification.
+	CorruptOnePerSync bool `json:"corruptOnePerSync"`
+}
+
+var (
+	faultLock     sync.Mutex
+	faultSettings FaultSettings
+	// corruptedSessions records the sync runs that already had a
+	// corrupted download.
+	corruptedSessions = map[string]bool{}
+
+	// faultRand decides which downloads are dropped; tests may override it.
+	faultRand = func() int { return rand.IntN(100) }
+)
+
+func init() {
+	debugMux.HandleFunc("/debug/faults", handleDebugFaults)
+	log.Println("Chaos build: fault injection is available under /debug/faults")
+}
+
+func getFaultSettings() FaultSettings {
+	faultLock.Lock()
+	defer faultLock.Unlock()
+	return faultSettings
+}
+
+func setFaultSettings(settings FaultSettings) {
+	faultLock.Lock()
+	faultSettings = settings
+	corruptedSessions = map[string]bool{}
+	faultLock.Unlock()
+	log.Printf("Fault injection: %+v", settings)
+}
+
+// takeCorruption reports whether the current download of session is the
+// one to corrupt.
+func takeCorruption(session string) bool {
+	faultLock.Lock()
+	defer faultLock.Unlock()
+	if !faultSettings.CorruptOnePerSync || corruptedSessions[session] {
+		return false
+	}
+	corruptedSessions[session] = true
+	return true
+}
+
+// injectFetchFaults wraps fetch to drop and corrupt downloads.
+func injectFetchFaults(fetch fetchItemFunc) fetchItemFunc {
+	if fetch == nil {
+		return nil
+	}
+	return func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		if percent := getFaultSettings().DropDownloadsPercent; percent > 0 && faultRand() < percent {
+			return fmt.Errorf("fault injection: download of %s dropped", item.Filename)
+		}
+		if takeCorruption(syncSessionFrom(ctx)) {
+			// The content no longer matches the expected digest, so
+			// verification fails as for a corrupt download.
+			log.Printf("Fault injection: corrupting download of %s", item.Filename)
+			item.SHA256 = corruptDigest(item.SHA256)
+			item.Hash = corruptDigest(item.Hash)
+		}
+		return fetch(ctx, config, item, destPath)
+	}
+}
+
+// corruptDigest changes the first hex digit of digest.
+func corruptDigest(digest string) string {
+	if digest == "" {
+		return ""
+	}
+	replacement := "0"
+	if strings.HasPrefix(digest, "0") {
+		replacement = "1"
+	}
+	return replacement + digest[1:]
+}
+
+// injectDBusDelay waits dbusDelayMillis before a D-Bus connection.
+func injectDBusDelay(ctx context.Context) error {
+	delay := time.Duration(getFaultSettings().DBusDelayMillis) * time.Millisecond
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleDebugFaults returns the injected faults (GET) or replaces them
+// (POST with FaultSettings; an empty body clears them).
+func handleDebugFaults(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getFaultSettings()})
+	case http.MethodPost:
+		var req FaultSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+			return
+		}
+		if req.DropDownloadsPercent < 0 || req.DropDownloadsPercent > 100 || req.DBusDelayMillis < 0 {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверные параметры сбоев"})
+			return
+		}
+		setFaultSettings(req)
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getFaultSettings()})
+	default:
+		JSONResponse(w, http.StatusMethodNotAllowed, APIResponse{OK: false, ErrMsg: "Метод не разрешён"})
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !chaos
+
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import "context"
+
+// Without the chaos build tag no faults are injected; see
+// fault_injection.go.
+
+func injectFetchFaults(fetch fetchItemFunc) fetchItemFunc {
+	return fetch
+}
+
+func injectDBusDelay(ctx context.Context) error {
+	return nil
+}
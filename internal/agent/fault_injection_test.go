@@ -0,0 +1,92 @@
+//go:build chaos
+
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setFaultsForTest(t *testing.T, settings FaultSettings) {
+	t.Helper()
+	setFaultSettings(settings)
+	t.Cleanup(func() { setFaultSettings(FaultSettings{}) })
+}
+
+func TestInjectFetchFaults(t *testing.T) {
+	original := faultRand
+	t.Cleanup(func() { faultRand = original })
+	dest := filepath.Join(t.TempDir(), "clip.mp4")
+	item := ManifestItem{ID: 1, Filename: "clip.mp4", FileSizeBytes: 4, SHA256: sha256Hex("clip")}
+	fetch := injectFetchFaults(func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		return writeVerifiedContent(strings.NewReader("clip"), item, destPath)
+	})
+
+	setFaultsForTest(t, FaultSettings{DropDownloadsPercent: 50})
+	faultRand = func() int { return 49 }
+	if err := fetch(context.Background(), Config{}, item, dest); err == nil || !strings.Contains(err.Error(), "dropped") {
+		t.Fatalf("expected a dropped download, got %v", err)
+	}
+	faultRand = func() int { return 50 }
+	if err := fetch(context.Background(), Config{}, item, dest); err != nil {
+		t.Fatalf("download must pass above the drop rate: %v", err)
+	}
+
+	setFaultsForTest(t, FaultSettings{CorruptOnePerSync: true})
+	ctx := withSyncSession(context.Background(), "session-1")
+	if err := fetch(ctx, Config{}, item, dest); !errors.Is(err, errContentMismatch) {
+		t.Fatalf("the first download of a sync must be corrupt, got %v", err)
+	}
+	if err := fetch(ctx, Config{}, item, dest); err != nil {
+		t.Fatalf("only one download per sync is corrupt: %v", err)
+	}
+	if err := fetch(withSyncSession(context.Background(), "session-2"), Config{}, item, dest); !errors.Is(err, errContentMismatch) {
+		t.Fatalf("the next sync gets a corrupt download again, got %v", err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "clip" {
+		t.Fatalf("a corrupt download must not replace the file, got %q", data)
+	}
+}
+
+func TestInjectDBusDelay(t *testing.T) {
+	setFaultsForTest(t, FaultSettings{DBusDelayMillis: 50})
+	started := time.Now()
+	if err := injectDBusDelay(context.Background()); err != nil || time.Since(started) < 50*time.Millisecond {
+		t.Fatalf("delay %v, err %v", time.Since(started), err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := injectDBusDelay(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("a canceled context must end the delay, got %v", err)
+	}
+}
+
+func TestHandleDebugFaults(t *testing.T) {
+	setFaultsForTest(t, FaultSettings{})
+	setCurrentConfigForTest(t, Config{Debug: DebugConfig{Enabled: true}})
+
+	w := httptest.NewRecorder()
+	HandleDebug(w, httptest.NewRequest(http.MethodPost, "/debug/faults", strings.NewReader(`{"dropDownloadsPercent": 10, "corruptOnePerSync": true}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	if got := getFaultSettings(); got.DropDownloadsPercent != 10 || !got.CorruptOnePerSync {
+		t.Fatalf("settings = %+v", got)
+	}
+
+	w = httptest.NewRecorder()
+	HandleDebug(w, httptest.NewRequest(http.MethodPost, "/debug/faults", strings.NewReader(`{"dropDownloadsPercent": 101}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d for an invalid rate", w.Code)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthConfig tunes the readiness probe.
+type HealthConfig struct {
+	// CoreMaxAge is how long ago the core may last have answered before
+	// the device is reported as not ready.
+	CoreMaxAge time.Duration `yaml:"core_max_age,omitempty"`
+}
+
+// DefaultCoreMaxAge is used when health.core_max_age is not set.
+const DefaultCoreMaxAge = 15 * time.Minute
+
+// readinessCheckTimeout bounds each readiness check that may block.
+var readinessCheckTimeout = 5 * time.Second
+
+// readinessCacheTTL is how long the result of the readiness checks is
+// reused, so frequent unauthenticated probes do not keep creating files in
+// the media directories and connecting to D-Bus.
+var readinessCacheTTL = 5 * time.Second
+
+var (
+	readinessCacheAt     time.Time
+	readinessCacheChecks []HealthCheck
+	readinessCacheLock   sync.Mutex
+)
+
+// readinessFailures are the details of failed checks shown to callers
+// without the server key; the real details may name paths and errors.
+var readinessFailures = map[string]string{
+	"config":    "configuration not loaded",
+	"dbus":      "D-Bus unavailable",
+	"media_dir": "media directory not writable",
+	"core":      "no recent response from core",
+	"clock":     "clock not in sync with core",
+	"safe_mode": "agent runs in safe mode",
+}
+
+var (
+	// processStart is when the agent started; before the first core
+	// response it stands in for the last contact.
+	processStart = time.Now()
+
+	// lastCoreContact holds the Unix nanoseconds of the last core response.
+	lastCoreContact atomic.Int64
+)
+
+// HealthCheck is the result of one readiness check.
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ReadinessResponse is the payload of /health/ready.
+type ReadinessResponse struct {
+	Status  string        `json:"status"`
+	Version string        `json:"version"`
+	Time    string        `json:"time"`
+	Checks  []HealthCheck `json:"checks"`
+	Clock   ClockStatus   `json:"clock"`
+}
+
+// recordCoreContact notes that the core answered a request.
+func recordCoreContact(at time.Time) {
+	lastCoreContact.Store(at.UnixNano())
+}
+
+// noteCoreResponse records core reachability and clock drift.
+func noteCoreResponse(resp *http.Response, at time.Time) {
+	recordCoreContact(at)
+	recordCoreDate(resp.Header.Get("Date"), at)
+}
+
+// isCoreRequest reports whether req targets the core rather than a LAN peer:
+// its scheme and host are those of core_api_base and its path lies below.
+func isCoreRequest(req *http.Request) bool {
+	base, err := url.Parse(GetCurrentConfig().CoreAPIBase)
+	if err != nil || base.Host == "" {
+		return false
+	}
+	if !strings.EqualFold(req.URL.Scheme, base.Scheme) || !strings.EqualFold(req.URL.Host, base.Host) {
+		return false
+	}
+	prefix := strings.TrimSuffix(base.Path, "/")
+	return req.URL.Path == prefix || strings.HasPrefix(req.URL.Path, prefix+"/")
+}
+
+func isConfigLoaded() bool {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return currentConfig != nil
+}
+
+func checkConfigLoaded() HealthCheck {
+	if !isConfigLoaded() {
+		return HealthCheck{Name: "config", OK: false, Detail: "configuration not loaded"}
+	}
+	return HealthCheck{Name: "config", OK: true}
+}
+
+func checkDBus(ctx context.Context) HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+	conn, err := getDBusConnection(ctx)
+	if err != nil {
+		return HealthCheck{Name: "dbus", OK: false, Detail: err.Error()}
+	}
+	conn.Close()
+	return HealthCheck{Name: "dbus", OK: true}
+}
+
+func checkMediaDirWritable(config Config) HealthCheck {
+	if err := checkMediaStorage(config); err != nil {
+		return HealthCheck{Name: "media_dir", OK: false, Detail: err.Error()}
+	}
+	dirs := mediaDirs(config)
+	for _, dir := range dirs {
+		file, err := os.CreateTemp(dir, ".health-*")
+		if err != nil {
+			return HealthCheck{Name: "media_dir", OK: false, Detail: err.Error()}
+		}
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}
+	return HealthCheck{Name: "media_dir", OK: true, Detail: strings.Join(dirs, ", ")}
+}
+
+func checkCoreContact(config Config, now time.Time) HealthCheck {
+	maxAge := config.Health.CoreMaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultCoreMaxAge
+	}
+	last := processStart
+	contacted := false
+	if nanos := lastCoreContact.Load(); nanos > 0 {
+		last = time.Unix(0, nanos)
+		contacted = true
+	}
+	age := now.Sub(last)
+	if age > maxAge {
+		if !contacted {
+			return HealthCheck{Name: "core", OK: false, Detail: fmt.Sprintf("no response from core since start %s ago", age.Round(time.Second))}
+		}
+		return HealthCheck{Name: "core", OK: false, Detail: fmt.Sprintf("last response from core %s ago", age.Round(time.Second))}
+	}
+	if !contacted {
+		return HealthCheck{Name: "core", OK: true, Detail: "no response from core yet"}
+	}
+	return HealthCheck{Name: "core", OK: true, Detail: fmt.Sprintf("last response from core %s ago", age.Round(time.Second))}
+}
+
+// readinessChecks runs the readiness checks or returns a copy of their
+// result if it is younger than readinessCacheTTL.
+func readinessChecks(ctx context.Context, config Config, now time.Time) []HealthCheck {
+	readinessCacheLock.Lock()
+	defer readinessCacheLock.Unlock()
+	if readinessCacheChecks == nil || now.Sub(readinessCacheAt) >= readinessCacheTTL || now.Before(readinessCacheAt) {
+		readinessCacheChecks = []HealthCheck{
+			checkConfigLoaded(),
+			checkDBus(ctx),
+			checkMediaDirWritable(config),
+			checkCoreContact(config, now),
+			checkClock(config, now),
+			checkSafeMode(),
+		}
+		readinessCacheAt = now
+	}
+	return slices.Clone(readinessCacheChecks)
+}
+
+// HandleHealthLive reports that the agent process is up and serving.
+func HandleHealthLive(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: HealthResponse{
+			Status:  "alive",
+			Version: GetVersion(),
+			Time:    time.Now().UTC().Format(time.RFC3339),
+		},
+	})
+}
+
+// HandleHealthReady reports whether the device can do its job: config is
+// loaded, D-Bus is reachable, the media directory is writable, the core
+// answered recently, the clock agrees with it and the agent is not in safe
+// mode. It returns 503 with per-check detail otherwise. The checks run at
+// most once per readinessCacheTTL; callers without the server key get
+// generic details only.
+func HandleHealthReady(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	config := GetCurrentConfig()
+	now := time.Now()
+	checks := readinessChecks(r.Context(), config, now)
+	if !isAuthorizedRequest(r) {
+		for i := range checks {
+			checks[i].Detail = ""
+			if !checks[i].OK {
+				checks[i].Detail = readinessFailures[checks[i].Name]
+			}
+		}
+	}
+
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.OK
+	}
+	data := ReadinessResponse{
+		Status:  "ready",
+		Version: GetVersion(),
+		Time:    now.UTC().Format(time.RFC3339),
+		Checks:  checks,
+		Clock:   getClockStatus(config),
+	}
+	status := http.StatusOK
+	response := APIResponse{OK: true, Data: data}
+	if !ready {
+		data.Status = "degraded"
+		status = http.StatusServiceUnavailable
+		response = APIResponse{OK: false, ErrMsg: "Устройство не готово", Data: data}
+	}
+	JSONResponse(w, status, response)
+}
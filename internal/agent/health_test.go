@@ -0,0 +1,194 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeReadiness(t *testing.T, w *httptest.ResponseRecorder) ReadinessResponse {
+	t.Helper()
+	var resp struct {
+		OK   bool              `json:"ok"`
+		Data ReadinessResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp.Data
+}
+
+func findCheck(checks []HealthCheck, name string) HealthCheck {
+	for _, check := range checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	return HealthCheck{}
+}
+
+func resetReadinessCacheForTest(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		readinessCacheLock.Lock()
+		readinessCacheChecks = nil
+		readinessCacheLock.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestHandleHealthLive(t *testing.T) {
+	w := httptest.NewRecorder()
+	HandleHealthLive(w, httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+}
+
+func TestHandleHealthReady(t *testing.T) {
+	t.Setenv("MEDIA_PI_AGENT_MOCK_DBUS", "1")
+	resetReadinessCacheForTest(t)
+	mediaDir := t.TempDir()
+	setCurrentConfigForTest(t, Config{Playlist: PlaylistConfig{Destination: mediaDir}})
+	recordCoreContact(time.Now())
+	t.Cleanup(func() { lastCoreContact.Store(0) })
+
+	w := httptest.NewRecorder()
+	HandleHealthReady(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	data := decodeReadiness(t, w)
+	if data.Status != "ready" || len(data.Checks) != 6 {
+		t.Fatalf("unexpected readiness: %+v", data)
+	}
+	if entries, _ := os.ReadDir(mediaDir); len(entries) != 0 {
+		t.Errorf("readiness probe left files behind: %v", entries)
+	}
+}
+
+func TestHandleHealthReadyDegraded(t *testing.T) {
+	t.Setenv("MEDIA_PI_AGENT_MOCK_DBUS", "1")
+	resetReadinessCacheForTest(t)
+	missing := filepath.Join(t.TempDir(), "missing")
+	setCurrentConfigForTest(t, Config{
+		Playlist: PlaylistConfig{Destination: missing},
+		Health:   HealthConfig{CoreMaxAge: time.Minute},
+	})
+	recordCoreContact(time.Now().Add(-time.Hour))
+	t.Cleanup(func() { lastCoreContact.Store(0) })
+
+	w := httptest.NewRecorder()
+	HandleHealthReady(w, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", w.Code)
+	}
+	data := decodeReadiness(t, w)
+	if data.Status != "degraded" {
+		t.Fatalf("expected degraded status, got %q", data.Status)
+	}
+	if check := findCheck(data.Checks, "media_dir"); check.OK {
+		t.Errorf("expected media_dir check to fail: %+v", check)
+	}
+	if check := findCheck(data.Checks, "core"); check.OK || check.Detail == "" {
+		t.Errorf("expected core check to fail with detail: %+v", check)
+	}
+	if check := findCheck(data.Checks, "dbus"); !check.OK {
+		t.Errorf("expected dbus check to pass: %+v", check)
+	}
+}
+
+func TestHandleHealthReadyHidesDetailsAndCaches(t *testing.T) {
+	t.Setenv("MEDIA_PI_AGENT_MOCK_DBUS", "1")
+	resetReadinessCacheForTest(t)
+	originalKey := ServerKey
+	ServerKey = "test-key"
+	t.Cleanup(func() { ServerKey = originalKey })
+	missing := filepath.Join(t.TempDir(), "missing")
+	setCurrentConfigForTest(t, Config{Playlist: PlaylistConfig{Destination: missing}})
+
+	ready := func(authorized bool) ReadinessResponse {
+		req := httptest.NewRequest(http.MethodGet, "/health/ready", nil)
+		if authorized {
+			req.Header.Set("Authorization", "Bearer test-key")
+		}
+		w := httptest.NewRecorder()
+		HandleHealthReady(w, req)
+		return decodeReadiness(t, w)
+	}
+
+	// Without the server key the path in the error is not shown.
+	if check := findCheck(ready(false).Checks, "media_dir"); check.OK || check.Detail != readinessFailures["media_dir"] {
+		t.Fatalf("unexpected unauthenticated media_dir check: %+v", check)
+	}
+	if check := findCheck(ready(true).Checks, "media_dir"); !strings.Contains(check.Detail, missing) {
+		t.Fatalf("expected the authorized detail to name the directory: %+v", check)
+	}
+
+	// The result is reused until readinessCacheTTL has passed.
+	if err := os.MkdirAll(missing, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if check := findCheck(ready(true).Checks, "media_dir"); check.OK {
+		t.Fatalf("expected the cached result, got %+v", check)
+	}
+	resetReadinessCacheForTest(t)
+	if check := findCheck(ready(true).Checks, "media_dir"); !check.OK {
+		t.Fatalf("expected the media_dir check to pass after the cache expired: %+v", check)
+	}
+}
+
+func TestIsCoreRequest(t *testing.T) {
+	setCurrentConfigForTest(t, Config{CoreAPIBase: "https://core.example.com/media"})
+	for target, want := range map[string]bool{
+		"https://core.example.com/media/api/devicesync": true,
+		"https://CORE.example.com/media":                true,
+		"https://core.example.com.evil.test/media/api":  false,
+		"https://core.example.com/mediaplus/api":        false,
+		"http://core.example.com/media/api":             false,
+		"https://core.example.com:8443/media/api":       false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if got := isCoreRequest(req); got != want {
+			t.Errorf("isCoreRequest(%s) = %v, want %v", target, got, want)
+		}
+	}
+}
+
+func TestCheckCoreContactGraceAfterStart(t *testing.T) {
+	lastCoreContact.Store(0)
+	now := processStart.Add(time.Minute)
+	if check := checkCoreContact(Config{}, now); !check.OK {
+		t.Errorf("expected core check to pass during start grace: %+v", check)
+	}
+	if check := checkCoreContact(Config{}, processStart.Add(DefaultCoreMaxAge+time.Minute)); check.OK {
+		t.Errorf("expected core check to fail without any core response: %+v", check)
+	}
+}
+
+func TestCoreClientRecordsCoreContact(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	setCurrentConfigForTest(t, Config{CoreAPIBase: server.URL})
+	lastCoreContact.Store(0)
+	t.Cleanup(func() { lastCoreContact.Store(0) })
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/devicesync", nil)
+	resp, err := getCoreClient().Do(req.Context(), req, time.Second)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if lastCoreContact.Load() == 0 {
+		t.Fatal("expected core contact to be recorded")
+	}
+}
@@ -0,0 +1,766 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	godbus "github.com/godbus/dbus/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// HelperConfig describes the privileged helper (`media-pi-agent helper`).
+// When Socket is set the agent performs systemd control, crontab and power
+// operations through the helper, so the agent itself can drop root.
+type HelperConfig struct {
+	Socket string `yaml:"socket,omitempty"`
+	// Group owns the socket; only its members and root may connect.
+	Group string `yaml:"group,omitempty"`
+	// Polkit authorizes every request of a non-root peer with polkit in
+	// addition to the socket permissions.
+	Polkit bool `yaml:"polkit,omitempty"`
+}
+
+// Defaults for the privileged helper.
+const (
+	DefaultHelperSocket = "/run/media-pi-agent/helper.sock"
+	DefaultHelperGroup  = "media-pi"
+	// DefaultHelperPolicyPath lies in a directory only root can write,
+	// unlike /etc/media-pi-agent, which the agent's group may change.
+	DefaultHelperPolicyPath = "/etc/media-pi-helper/policy.yaml"
+)
+
+// HelperPolicy is what the helper does for the agent. It is read from its
+// own root-owned file, never from agent.yaml, which the agent rewrites
+// itself, so a compromised agent cannot widen it.
+type HelperPolicy struct {
+	HelperConfig `yaml:",inline"`
+	// ServiceUser owns the crontab the helper edits and runs the services
+	// whose unit files it writes (media_pi_service_user).
+	ServiceUser string `yaml:"service_user,omitempty"`
+	// AllowedUnits are the units besides the playback, upload and mount
+	// units the agent may control and write unit files of.
+	AllowedUnits []string `yaml:"allowed_units,omitempty"`
+	// Jobs are the exec.jobs run-job starts.
+	Jobs []ExecJobConfig `yaml:"jobs,omitempty"`
+}
+
+// helperRequestTimeout bounds one request, covering the longest playback
+// unit operation.
+var helperRequestTimeout = 45 * time.Second
+
+// Operations of the helper protocol. Every connection carries one JSON
+// request line and receives one JSON response line.
+const (
+	helperOpReload       = "reload"
+	helperOpStart        = "start"
+	helperOpStop         = "stop"
+	helperOpRestart      = "restart"
+	helperOpEnable       = "enable"
+	helperOpDisable      = "disable"
+	helperOpMask         = "mask"
+	helperOpUnmask       = "unmask"
+	helperOpProperties   = "properties"
+	helperOpRunJob       = "run-job"
+	helperOpResetFailed  = "reset-failed"
+	helperOpReboot       = "reboot"
+	helperOpPowerOff     = "poweroff"
+	helperOpCrontabRead  = "crontab-read"
+	helperOpCrontabWrite = "crontab-write"
+	helperOpWriteFile    = "write-file"
+	helperOpRemoveFile   = "remove-file"
+)
+
+// helperPolkitActions maps operations to the polkit actions checked when
+// helper.polkit is set. Reading unit properties needs no authorization.
+var helperPolkitActions = map[string]string{
+	helperOpReload:       "org.freedesktop.systemd1.reload-daemon",
+	helperOpStart:        "org.freedesktop.systemd1.manage-units",
+	helperOpStop:         "org.freedesktop.systemd1.manage-units",
+	helperOpRestart:      "org.freedesktop.systemd1.manage-units",
+	helperOpEnable:       "org.freedesktop.systemd1.manage-unit-files",
+	helperOpDisable:      "org.freedesktop.systemd1.manage-unit-files",
+	helperOpMask:         "org.freedesktop.systemd1.manage-unit-files",
+	helperOpUnmask:       "org.freedesktop.systemd1.manage-unit-files",
+	helperOpProperties:   "",
+	helperOpRunJob:       "org.freedesktop.systemd1.manage-units",
+	helperOpResetFailed:  "org.freedesktop.systemd1.manage-units",
+	helperOpReboot:       "org.freedesktop.login1.reboot",
+	helperOpPowerOff:     "org.freedesktop.login1.power-off",
+	helperOpCrontabRead:  "consulting.sw.media-pi.manage-crontab",
+	helperOpCrontabWrite: "consulting.sw.media-pi.manage-crontab",
+	helperOpWriteFile:    "consulting.sw.media-pi.manage-system-files",
+	helperOpRemoveFile:   "consulting.sw.media-pi.manage-system-files",
+}
+
+// helperRequest is a request line on the helper socket.
+type helperRequest struct {
+	Op   string `json:"op"`
+	Unit string `json:"unit,omitempty"`
+	// UnitType makes properties read the unit type interface, e.g. Timer.
+	UnitType string `json:"unitType,omitempty"`
+	// Command and Args name the job of HelperPolicy.Jobs run-job starts
+	// as Unit.
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	// Files are unit names to enable, disable, mask or unmask.
+	Files   []string `json:"files,omitempty"`
+	Runtime bool     `json:"runtime,omitempty"`
+	Force   bool     `json:"force,omitempty"`
+	// Path is the unit file or asound.conf of write-file and remove-file.
+	Path string `json:"path,omitempty"`
+	// Content is the crontab written by crontab-write or the file written
+	// by write-file.
+	Content string `json:"content,omitempty"`
+}
+
+// helperResponse is a response line on the helper socket.
+type helperResponse struct {
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Result string `json:"result,omitempty"`
+	// Properties holds the string and integer properties of a unit, the
+	// integers in decimal.
+	Properties map[string]string `json:"properties,omitempty"`
+	// Content is the crontab returned by crontab-read.
+	Content string `json:"content,omitempty"`
+}
+
+var (
+	// helperSystemConnection connects the helper to systemd and logind.
+	// Tests may override it.
+	helperSystemConnection = systemDBusConnection
+
+	// helperCrontabRead and helperCrontabWrite edit the service user's
+	// crontab on behalf of the agent. Tests may override them.
+	helperCrontabRead  = execCrontabRead
+	helperCrontabWrite = execCrontabWrite
+
+	// polkitAuthorized asks polkit whether the peer may perform action.
+	// Tests may override it.
+	polkitAuthorized = checkPolkitAuthorization
+
+	runningAsRoot = func() bool { return os.Geteuid() == 0 }
+)
+
+// helperWritableUnits are units the agent operates on and writes unit
+// files of besides the allowed, playback and mount units.
+var helperWritableUnits = map[string]struct{}{
+	audioPlaybackUnit:         {},
+	"playlist.upload.service": {},
+	"playlist.upload.timer":   {},
+	"video.upload.service":    {},
+	"video.upload.timer":      {},
+}
+
+// helperManagedUnits are units the agent operates on but whose unit files
+// it must not write: they run as root.
+var helperManagedUnits = map[string]struct{}{
+	"media-pi-agent.service": {},
+	timesyncUnit:             {},
+}
+
+// isAgentMountUnit reports whether unit mounts a point in /mnt or /media,
+// where storage and storage.network mounts are created.
+func isAgentMountUnit(unit string) bool {
+	if !strings.HasPrefix(unit, "mnt-") && !strings.HasPrefix(unit, "media-") {
+		return false
+	}
+	return strings.HasSuffix(unit, ".mount") || strings.HasSuffix(unit, ".automount")
+}
+
+// helperUnitFileAllowed limits write-file to the units the agent writes.
+func helperUnitFileAllowed(policy *HelperPolicy, unit string) bool {
+	if _, ok := helperWritableUnits[unit]; ok {
+		return true
+	}
+	return isPlaybackUnit(unit) || isAgentMountUnit(unit) || slices.Contains(policy.AllowedUnits, unit)
+}
+
+// helperUnitAllowed limits the helper to the units the agent manages.
+func helperUnitAllowed(policy *HelperPolicy, unit string) bool {
+	if _, ok := helperManagedUnits[unit]; ok {
+		return true
+	}
+	return isJobUnit(unit) || helperUnitFileAllowed(policy, unit)
+}
+
+// helperFileAllowed limits write-file and remove-file to asound.conf and
+// the unit files and drop-ins of units the agent writes.
+func helperFileAllowed(policy *HelperPolicy, path string) bool {
+	if path == AudioConfigPath {
+		return true
+	}
+	if path != filepath.Clean(path) {
+		return false
+	}
+	rel, err := filepath.Rel(SystemdUnitDir, path)
+	if err != nil {
+		return false
+	}
+	unit, dropIn, nested := strings.Cut(rel, string(filepath.Separator))
+	if nested {
+		var ok bool
+		if unit, ok = strings.CutSuffix(unit, ".d"); !ok {
+			return false
+		}
+		if strings.ContainsRune(dropIn, filepath.Separator) || !strings.HasSuffix(dropIn, ".conf") || strings.HasPrefix(dropIn, ".") {
+			return false
+		}
+	}
+	return helperUnitFileAllowed(policy, unit)
+}
+
+// checkHelperPolicyOwner rejects a policy file that anyone but the helper's
+// own user (root) owns or may change, including through its directory.
+func checkHelperPolicyOwner(path string) error {
+	for _, p := range []string{path, filepath.Dir(path)} {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return fmt.Errorf("%s: unknown owner", p)
+		}
+		if int(stat.Uid) != os.Geteuid() || info.Mode().Perm()&0o022 != 0 {
+			return fmt.Errorf("%s must be owned by root and writable only by it", p)
+		}
+	}
+	return nil
+}
+
+// LoadHelperPolicy reads the helper policy from path.
+func LoadHelperPolicy(path string) (*HelperPolicy, error) {
+	if err := checkHelperPolicyOwner(path); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy HelperPolicy
+	if err := yaml.Unmarshal(b, &policy); err != nil {
+		return nil, err
+	}
+	if policy.ServiceUser == "" {
+		policy.ServiceUser = "pi"
+	}
+	if err := validateExecJobs(ExecConfig{Jobs: policy.Jobs}); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// InstallHelperPolicy writes the helper policy from config to path unless
+// it exists, so the first install-units carries the units and jobs of
+// agent.yaml over. Later changes to agent.yaml do not reach the helper;
+// root edits the policy. It reports whether the policy was written.
+func InstallHelperPolicy(path string, config Config) (bool, error) {
+	if _, err := os.Stat(path); err == nil {
+		return false, nil
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+	policy := HelperPolicy{
+		HelperConfig: config.Helper,
+		ServiceUser:  config.MediaPiServiceUser,
+		AllowedUnits: config.AllowedUnits,
+		Jobs:         config.Exec.Jobs,
+	}
+	data, err := yaml.Marshal(policy)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	if err := writeFileAtomic(path, string(data)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// peerCredentials returns the credentials of the process on the other end
+// of conn.
+func peerCredentials(conn *net.UnixConn) (*syscall.Ucred, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	return cred, credErr
+}
+
+// processStartTime returns the start time of pid in clock ticks since boot,
+// which polkit uses to tell a process from a later one reusing its pid.
+func processStartTime(pid int32) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(int(pid)), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	// The command name may contain spaces, so fields are counted from the
+	// closing parenthesis; starttime is field 22.
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return 0, fmt.Errorf("unexpected /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("unexpected /proc/%d/stat", pid)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// checkPolkitAuthorization calls CheckAuthorization of the polkit authority
+// for the peer process, without interactive authentication.
+func checkPolkitAuthorization(ctx context.Context, cred syscall.Ucred, action string) (bool, error) {
+	startTime, err := processStartTime(cred.Pid)
+	if err != nil {
+		return false, err
+	}
+	conn, err := godbus.ConnectSystemBus()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	subject := struct {
+		Kind    string
+		Details map[string]godbus.Variant
+	}{
+		Kind: "unix-process",
+		Details: map[string]godbus.Variant{
+			"pid":        godbus.MakeVariant(uint32(cred.Pid)),
+			"start-time": godbus.MakeVariant(startTime),
+			"uid":        godbus.MakeVariant(int32(cred.Uid)),
+		},
+	}
+	var result struct {
+		IsAuthorized bool
+		IsChallenge  bool
+		Details      map[string]string
+	}
+	authority := conn.Object("org.freedesktop.PolicyKit1", "/org/freedesktop/PolicyKit1/Authority")
+	call := authority.CallWithContext(ctx, "org.freedesktop.PolicyKit1.Authority.CheckAuthorization", 0,
+		subject, action, map[string]string{}, uint32(0), "")
+	if err := call.Store(&result); err != nil {
+		return false, err
+	}
+	return result.IsAuthorized, nil
+}
+
+// authorizeHelperRequest checks the request target and the peer.
+func authorizeHelperRequest(ctx context.Context, policy *HelperPolicy, cred syscall.Ucred, req helperRequest) error {
+	action, known := helperPolkitActions[req.Op]
+	if !known {
+		return fmt.Errorf("unknown operation %q", req.Op)
+	}
+	switch req.Op {
+	case helperOpStart, helperOpStop, helperOpRestart, helperOpProperties:
+		if !helperUnitAllowed(policy, req.Unit) {
+			return fmt.Errorf("unit %q is not managed by the agent", req.Unit)
+		}
+	case helperOpRunJob, helperOpResetFailed:
+		if !isJobUnit(req.Unit) {
+			return fmt.Errorf("unit %q is not a job unit", req.Unit)
+		}
+	case helperOpEnable, helperOpDisable, helperOpMask, helperOpUnmask:
+		if len(req.Files) == 0 {
+			return errors.New("no unit files")
+		}
+		for _, file := range req.Files {
+			if file != filepath.Base(file) || !helperUnitAllowed(policy, file) {
+				return fmt.Errorf("unit %q is not managed by the agent", file)
+			}
+		}
+	case helperOpWriteFile, helperOpRemoveFile:
+		if !helperFileAllowed(policy, req.Path) {
+			return fmt.Errorf("file %q is not managed by the agent", req.Path)
+		}
+	}
+	if cred.Uid == 0 || !policy.Polkit || action == "" {
+		return nil
+	}
+	authorized, err := polkitAuthorized(ctx, cred, action)
+	if err != nil {
+		return fmt.Errorf("polkit check for %s: %w", action, err)
+	}
+	if !authorized {
+		return fmt.Errorf("not authorized for %s", action)
+	}
+	return nil
+}
+
+// runHelperRequest performs an authorized request.
+func runHelperRequest(ctx context.Context, policy *HelperPolicy, req helperRequest) (helperResponse, error) {
+	switch req.Op {
+	case helperOpCrontabRead:
+		content, err := helperCrontabRead(policy.ServiceUser)
+		return helperResponse{Content: content}, err
+	case helperOpCrontabWrite:
+		return helperResponse{}, helperCrontabWrite(policy.ServiceUser, req.Content)
+	case helperOpWriteFile:
+		content, err := checkHelperFile(policy, req.Path, req.Content)
+		if err != nil {
+			return helperResponse{}, fmt.Errorf("%s: %w", req.Path, err)
+		}
+		return helperResponse{}, writeFileAtomic(req.Path, content)
+	case helperOpRemoveFile:
+		return helperResponse{}, removeFileAndDropInDir(req.Path)
+	}
+
+	conn, err := helperSystemConnection(ctx)
+	if err != nil {
+		return helperResponse{}, fmt.Errorf("connect to D-Bus: %w", err)
+	}
+	defer conn.Close()
+
+	var resp helperResponse
+	switch req.Op {
+	case helperOpReload:
+		err = conn.ReloadContext(ctx)
+	case helperOpStart, helperOpStop, helperOpRestart:
+		resp.Result, err = runDBusUnitOperation(ctx, conn, dbusUnitOperation(req.Op), req.Unit)
+	case helperOpEnable:
+		var carriesInstall bool
+		carriesInstall, _, err = conn.EnableUnitFilesContext(ctx, req.Files, req.Runtime, req.Force)
+		resp.Result = strconv.FormatBool(carriesInstall)
+	case helperOpDisable:
+		_, err = conn.DisableUnitFilesContext(ctx, req.Files, req.Runtime)
+	case helperOpMask:
+		_, err = conn.MaskUnitFilesContext(ctx, req.Files, req.Runtime, req.Force)
+	case helperOpUnmask:
+		_, err = conn.UnmaskUnitFilesContext(ctx, req.Files, req.Runtime)
+	case helperOpProperties:
+		var props map[string]any
+		if req.UnitType != "" {
+			props, err = conn.GetUnitTypePropertiesContext(ctx, req.Unit, req.UnitType)
+		} else {
+			props, err = conn.GetUnitPropertiesContext(ctx, req.Unit)
+		}
+		if err == nil {
+			resp.Properties = make(map[string]string)
+			for key, value := range props {
+				switch value := value.(type) {
+				case string:
+					resp.Properties[key] = value
+				case uint64:
+					resp.Properties[key] = strconv.FormatUint(value, 10)
+				case int32:
+					resp.Properties[key] = strconv.FormatInt(int64(value), 10)
+				}
+			}
+		}
+	case helperOpRunJob:
+		err = startJobUnit(ctx, conn, ExecConfig{Jobs: policy.Jobs}, req.Unit, ExecRequest{Command: req.Command, Args: req.Args})
+	case helperOpResetFailed:
+		err = conn.ResetFailedUnitContext(ctx, req.Unit)
+	case helperOpReboot:
+		err = conn.RebootContext(ctx)
+	case helperOpPowerOff:
+		err = conn.PowerOffContext(ctx)
+	}
+	return resp, err
+}
+
+func serveHelperConn(ctx context.Context, policy *HelperPolicy, conn *net.UnixConn) {
+	defer func() { _ = conn.Close() }()
+	ctx, cancel := context.WithTimeout(ctx, helperRequestTimeout)
+	defer cancel()
+	_ = conn.SetDeadline(time.Now().Add(helperRequestTimeout))
+
+	resp := func() helperResponse {
+		cred, err := peerCredentials(conn)
+		if err != nil {
+			return helperResponse{Error: fmt.Sprintf("peer credentials: %v", err)}
+		}
+		line, err := bufio.NewReader(conn).ReadBytes('\n')
+		if err != nil {
+			return helperResponse{Error: fmt.Sprintf("read request: %v", err)}
+		}
+		var req helperRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			return helperResponse{Error: fmt.Sprintf("invalid request: %v", err)}
+		}
+		if err := authorizeHelperRequest(ctx, policy, *cred, req); err != nil {
+			log.Printf("Helper denied %s %s for uid %d (pid %d): %v", req.Op, req.Unit, cred.Uid, cred.Pid, err)
+			return helperResponse{Error: err.Error()}
+		}
+		resp, err := runHelperRequest(ctx, policy, req)
+		if err != nil {
+			log.Printf("Helper %s %s failed: %v", req.Op, req.Unit, err)
+			return helperResponse{Error: err.Error()}
+		}
+		resp.OK = true
+		return resp
+	}()
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		log.Printf("Warning: helper failed to write response: %v", err)
+	}
+}
+
+// ServeHelper answers privileged requests on listener as policy allows
+// until ctx is done.
+func ServeHelper(ctx context.Context, policy *HelperPolicy, listener *net.UnixListener) error {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	for {
+		conn, err := listener.AcceptUnix()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go serveHelperConn(ctx, policy, conn)
+	}
+}
+
+// ListenHelper creates the helper socket, owned by root and helper.group
+// with mode 0660 so only the agent's group can connect.
+func ListenHelper(config HelperConfig) (*net.UnixListener, error) {
+	socket := strings.TrimSpace(config.Socket)
+	if socket == "" {
+		socket = DefaultHelperSocket
+	}
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+
+	group := strings.TrimSpace(config.Group)
+	if group == "" {
+		group = DefaultHelperGroup
+	}
+	mode := os.FileMode(0660)
+	if g, err := user.LookupGroup(group); err != nil {
+		log.Printf("Warning: helper group %s not found, only root can connect: %v", group, err)
+		mode = 0600
+	} else if gid, err := strconv.Atoi(g.Gid); err == nil {
+		if err := os.Chown(socket, -1, gid); err != nil {
+			log.Printf("Warning: failed to hand helper socket to group %s: %v", group, err)
+		}
+	}
+	if err := os.Chmod(socket, mode); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// helperSocketPath returns helper.socket of the current configuration, or
+// "" when the process runs as root (the helper itself, install-units, or an
+// agent that did not drop root) and needs no helper.
+func helperSocketPath() string {
+	if runningAsRoot() {
+		return ""
+	}
+	return strings.TrimSpace(GetCurrentConfig().Helper.Socket)
+}
+
+// callHelper sends one request to the helper at socket.
+func callHelper(ctx context.Context, socket string, req helperRequest) (helperResponse, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return helperResponse{}, fmt.Errorf("connect to helper: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	deadline := time.Now().Add(helperRequestTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		return helperResponse{}, err
+	}
+	if _, err := conn.Write(append(line, '\n')); err != nil {
+		return helperResponse{}, fmt.Errorf("helper %s: %w", req.Op, err)
+	}
+	var resp helperResponse
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return helperResponse{}, fmt.Errorf("helper %s: %w", req.Op, err)
+	}
+	if !resp.OK {
+		return resp, fmt.Errorf("helper %s: %s", req.Op, resp.Error)
+	}
+	return resp, nil
+}
+
+func callHelperOp(socket string, req helperRequest) error {
+	_, err := callHelper(context.Background(), socket, req)
+	return err
+}
+
+// writeSystemFile atomically replaces path, a unit file or asound.conf.
+// An unprivileged agent has the helper write it.
+func writeSystemFile(path, content string) error {
+	if socket := helperSocketPath(); socket != "" {
+		return callHelperOp(socket, helperRequest{Op: helperOpWriteFile, Path: path, Content: content})
+	}
+	return writeFileAtomic(path, content)
+}
+
+// removeSystemFile removes what writeSystemFile wrote.
+func removeSystemFile(path string) error {
+	if socket := helperSocketPath(); socket != "" {
+		return callHelperOp(socket, helperRequest{Op: helperOpRemoveFile, Path: path})
+	}
+	return removeFileAndDropInDir(path)
+}
+
+// removeFileAndDropInDir removes path, if it exists, and the drop-in
+// directory it leaves empty.
+func removeFileAndDropInDir(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if dir := filepath.Dir(path); strings.HasSuffix(dir, ".d") {
+		_ = os.Remove(dir) // only succeeds when empty
+	}
+	return nil
+}
+
+// helperDBusConnection implements DBusConnection through the helper.
+type helperDBusConnection struct {
+	socket string
+}
+
+func (h *helperDBusConnection) Close() {}
+
+func (h *helperDBusConnection) ReloadContext(ctx context.Context) error {
+	_, err := callHelper(ctx, h.socket, helperRequest{Op: helperOpReload})
+	return err
+}
+
+// unitOperation runs op on name; the helper always uses the replace mode
+// and waits for the job, whose result is delivered on ch.
+func (h *helperDBusConnection) unitOperation(ctx context.Context, op, name string, ch chan<- string) (int, error) {
+	resp, err := callHelper(ctx, h.socket, helperRequest{Op: op, Unit: name})
+	if err != nil {
+		return 0, err
+	}
+	if ch != nil {
+		select {
+		case ch <- resp.Result:
+		default:
+		}
+	}
+	return 1, nil
+}
+
+func (h *helperDBusConnection) StartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	return h.unitOperation(ctx, helperOpStart, name, ch)
+}
+
+func (h *helperDBusConnection) StopUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	return h.unitOperation(ctx, helperOpStop, name, ch)
+}
+
+func (h *helperDBusConnection) RestartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	return h.unitOperation(ctx, helperOpRestart, name, ch)
+}
+
+func (h *helperDBusConnection) EnableUnitFilesContext(ctx context.Context, files []string, runtime, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+	resp, err := callHelper(ctx, h.socket, helperRequest{Op: helperOpEnable, Files: files, Runtime: runtime, Force: force})
+	return resp.Result == "true", nil, err
+}
+
+func (h *helperDBusConnection) DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+	_, err := callHelper(ctx, h.socket, helperRequest{Op: helperOpDisable, Files: files, Runtime: runtime})
+	return nil, err
+}
+
+func (h *helperDBusConnection) MaskUnitFilesContext(ctx context.Context, files []string, runtime, force bool) ([]dbus.MaskUnitFileChange, error) {
+	_, err := callHelper(ctx, h.socket, helperRequest{Op: helperOpMask, Files: files, Runtime: runtime, Force: force})
+	return nil, err
+}
+
+func (h *helperDBusConnection) UnmaskUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.UnmaskUnitFileChange, error) {
+	_, err := callHelper(ctx, h.socket, helperRequest{Op: helperOpUnmask, Files: files, Runtime: runtime})
+	return nil, err
+}
+
+func (h *helperDBusConnection) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error) {
+	resp, err := callHelper(ctx, h.socket, helperRequest{Op: helperOpProperties, Unit: unit})
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]any, len(resp.Properties))
+	for key, value := range resp.Properties {
+		props[key] = value
+	}
+	return props, nil
+}
+
+func (h *helperDBusConnection) GetUnitTypePropertiesContext(ctx context.Context, unit, unitType string) (map[string]any, error) {
+	resp, err := callHelper(ctx, h.socket, helperRequest{Op: helperOpProperties, Unit: unit, UnitType: unitType})
+	if err != nil {
+		return nil, err
+	}
+	props := make(map[string]any, len(resp.Properties))
+	for key, value := range resp.Properties {
+		props[key] = value
+	}
+	return props, nil
+}
+
+// StartTransientUnitContext is not available through the helper, which
+// runs only the jobs of its own exec.jobs; see runJob.
+func (h *helperDBusConnection) StartTransientUnitContext(ctx context.Context, name, mode string, properties []dbus.Property, ch chan<- string) (int, error) {
+	return 0, fmt.Errorf("transient units are started through the helper with run-job")
+}
+
+// runJob asks the helper to start the job req of exec.jobs as unit.
+func (h *helperDBusConnection) runJob(ctx context.Context, unit string, req ExecRequest) error {
+	_, err := callHelper(ctx, h.socket, helperRequest{Op: helperOpRunJob, Unit: unit, Command: req.Command, Args: req.Args})
+	return err
+}
+
+func (h *helperDBusConnection) ResetFailedUnitContext(ctx context.Context, name string) error {
+	_, err := callHelper(ctx, h.socket, helperRequest{Op: helperOpResetFailed, Unit: name})
+	return err
+}
+
+func (h *helperDBusConnection) RebootContext(ctx context.Context) error {
+	_, err := callHelper(ctx, h.socket, helperRequest{Op: helperOpReboot})
+	return err
+}
+
+func (h *helperDBusConnection) PowerOffContext(ctx context.Context) error {
+	_, err := callHelper(ctx, h.socket, helperRequest{Op: helperOpPowerOff})
+	return err
+}
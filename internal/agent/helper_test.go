@@ -0,0 +1,308 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// startHelperForTest serves the helper on a temporary socket with systemd
+// replaced by a recording connection.
+func startHelperForTest(t *testing.T, policy HelperPolicy) (string, *playbackDBusConn) {
+	t.Helper()
+	conn := &playbackDBusConn{active: true}
+	originalConn := helperSystemConnection
+	helperSystemConnection = func(context.Context) (DBusConnection, error) { return conn, nil }
+	t.Cleanup(func() { helperSystemConnection = originalConn })
+
+	policy.Socket = filepath.Join(t.TempDir(), "helper.sock")
+	if group, err := user.LookupGroupId(strconv.Itoa(os.Getgid())); err == nil {
+		policy.Group = group.Name
+	}
+	listener, err := ListenHelper(policy.HelperConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ServeHelper(ctx, &policy, listener) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("ServeHelper: %v", err)
+		}
+	})
+	return policy.Socket, conn
+}
+
+func TestHelperRunsUnitOperations(t *testing.T) {
+	socket, fake := startHelperForTest(t, HelperPolicy{})
+	conn := &helperDBusConnection{socket: socket}
+
+	result, err := runDBusUnitOperation(t.Context(), conn, dbusUnitOperationRestart, playbackServiceUnit)
+	if err != nil || result != "done" {
+		t.Fatalf("restart = %q, %v", result, err)
+	}
+	if err := conn.ReloadContext(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if !isUnitActive(t.Context(), conn, playbackServiceUnit) {
+		t.Fatal("expected unit properties from the helper")
+	}
+	if want := []string{"restart play.video.service"}; !reflect.DeepEqual(fake.operations(), want) {
+		t.Fatalf("operations = %v, want %v", fake.operations(), want)
+	}
+
+	info, err := os.Stat(socket)
+	if err != nil || info.Mode().Perm() != 0660 {
+		t.Fatalf("expected socket mode 0660, got %v, %v", info, err)
+	}
+}
+
+func TestHelperRejectsUnmanagedUnits(t *testing.T) {
+	socket, fake := startHelperForTest(t, HelperPolicy{AllowedUnits: []string{"kiosk.service"}})
+	// allowed_units of agent.yaml, which the agent can rewrite, is ignored.
+	original := AllowedUnits
+	AllowedUnits = map[string]struct{}{"ssh.service": {}}
+	t.Cleanup(func() { AllowedUnits = original })
+	conn := &helperDBusConnection{socket: socket}
+
+	if _, err := conn.StopUnitContext(t.Context(), "ssh.service", "replace", nil); err == nil || !strings.Contains(err.Error(), "not managed") {
+		t.Fatalf("expected unmanaged unit to be rejected, got %v", err)
+	}
+	if _, _, err := conn.EnableUnitFilesContext(t.Context(), []string{"../ssh.service"}, false, true); err == nil {
+		t.Fatal("expected unit file path to be rejected")
+	}
+	if _, err := conn.MaskUnitFilesContext(t.Context(), []string{"ssh.service"}, false, true); err == nil || !strings.Contains(err.Error(), "not managed") {
+		t.Fatalf("expected masking an unmanaged unit to be rejected, got %v", err)
+	}
+	if _, err := callHelper(t.Context(), socket, helperRequest{Op: "exec"}); err == nil || !strings.Contains(err.Error(), "unknown operation") {
+		t.Fatalf("expected unknown operation error, got %v", err)
+	}
+	if _, err := conn.StartUnitContext(t.Context(), "kiosk.service", "replace", nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"start kiosk.service"}; !reflect.DeepEqual(fake.operations(), want) {
+		t.Fatalf("operations = %v, want %v", fake.operations(), want)
+	}
+}
+
+func TestAuthorizeHelperRequestWithPolkit(t *testing.T) {
+	var checked []string
+	allow := false
+	original := polkitAuthorized
+	polkitAuthorized = func(ctx context.Context, cred syscall.Ucred, action string) (bool, error) {
+		checked = append(checked, action)
+		return allow, nil
+	}
+	t.Cleanup(func() { polkitAuthorized = original })
+
+	config := &HelperPolicy{HelperConfig: HelperConfig{Polkit: true}}
+	agentUser := syscall.Ucred{Pid: 42, Uid: 1000}
+	reboot := helperRequest{Op: helperOpReboot}
+	if err := authorizeHelperRequest(t.Context(), config, agentUser, reboot); err == nil {
+		t.Fatal("expected polkit denial")
+	}
+	allow = true
+	if err := authorizeHelperRequest(t.Context(), config, agentUser, reboot); err != nil {
+		t.Fatal(err)
+	}
+	// Root and read-only requests skip polkit.
+	if err := authorizeHelperRequest(t.Context(), config, syscall.Ucred{}, reboot); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorizeHelperRequest(t.Context(), config, agentUser, helperRequest{Op: helperOpProperties, Unit: playbackServiceUnit}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"org.freedesktop.login1.reboot", "org.freedesktop.login1.reboot"}; !reflect.DeepEqual(checked, want) {
+		t.Fatalf("checked = %v, want %v", checked, want)
+	}
+}
+
+func TestUnprivilegedAgentUsesHelper(t *testing.T) {
+	socket, _ := startHelperForTest(t, HelperPolicy{ServiceUser: "pi"})
+	crontab := "0 1 * * * old\n"
+	var users []string
+	originalRead, originalWrite, originalRoot, originalUser := helperCrontabRead, helperCrontabWrite, runningAsRoot, MediaPiServiceUser
+	helperCrontabRead = func(user string) (string, error) { users = append(users, user); return crontab, nil }
+	helperCrontabWrite = func(user, content string) error { users = append(users, user); crontab = content; return nil }
+	runningAsRoot = func() bool { return false }
+	// The crontab is the policy's service user's, whatever agent.yaml says.
+	MediaPiServiceUser = "root"
+	t.Cleanup(func() {
+		helperCrontabRead, helperCrontabWrite, runningAsRoot, MediaPiServiceUser = originalRead, originalWrite, originalRoot, originalUser
+	})
+	t.Setenv("MEDIA_PI_AGENT_MOCK_DBUS", "")
+	setCurrentConfigForTest(t, Config{Helper: HelperConfig{Socket: socket}})
+
+	if content, err := defaultCrontabRead(); err != nil || content != "0 1 * * * old\n" {
+		t.Fatalf("crontab read = %q, %v", content, err)
+	}
+	if err := defaultCrontabWrite("0 2 * * * new\n"); err != nil || crontab != "0 2 * * * new\n" {
+		t.Fatalf("crontab write = %q, %v", crontab, err)
+	}
+	if want := []string{"pi", "pi"}; !reflect.DeepEqual(users, want) {
+		t.Fatalf("crontab users = %v, want %v", users, want)
+	}
+
+	conn, err := getDBusConnection(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := conn.(*helperDBusConnection); !ok {
+		t.Fatalf("expected helper connection, got %T", conn)
+	}
+	if err := realReboot(); err != nil {
+		t.Fatal(err)
+	}
+	runningAsRoot = func() bool { return true }
+	if helperSocketPath() != "" {
+		t.Fatal("root must not use the helper")
+	}
+}
+
+func TestProcessStartTime(t *testing.T) {
+	start, err := processStartTime(int32(os.Getpid()))
+	if err != nil || start == 0 {
+		t.Fatalf("processStartTime = %d, %v", start, err)
+	}
+}
+
+func TestRenderUnitFilesWithHelper(t *testing.T) {
+	units, err := RenderUnitFiles(Config{
+		MediaPiServiceUser: "pi",
+		Playlist:           PlaylistConfig{Destination: "/var/media-pi"},
+		Helper:             HelperConfig{Socket: DefaultHelperSocket},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]UnitFile)
+	for _, unit := range units {
+		byName[unit.Name] = unit
+	}
+	agentUnit := byName["media-pi-agent.service"].Content
+	for _, want := range []string{"User=pi\n", "Group=media-pi\n", "Wants=network.target media-pi-helper.service\n"} {
+		if !strings.Contains(agentUnit, want) {
+			t.Errorf("agent unit missing %q:\n%s", want, agentUnit)
+		}
+	}
+	helper, ok := byName["media-pi-helper.service"]
+	if !ok || !helper.Enable || !strings.Contains(helper.Content, "ExecStart="+AgentBinaryPath+" helper\n") || !strings.Contains(helper.Content, "User=root\n") {
+		t.Fatalf("unexpected helper unit: %+v", helper)
+	}
+}
+
+func TestUnprivilegedAgentWritesUnitFilesThroughHelper(t *testing.T) {
+	socket, _ := startHelperForTest(t, HelperPolicy{ServiceUser: "signage", AllowedUnits: []string{"kiosk.service"}})
+	originalDir, originalAudio, originalRoot := SystemdUnitDir, AudioConfigPath, runningAsRoot
+	SystemdUnitDir = t.TempDir()
+	AudioConfigPath = filepath.Join(t.TempDir(), "asound.conf")
+	runningAsRoot = func() bool { return false }
+	t.Cleanup(func() { SystemdUnitDir, AudioConfigPath, runningAsRoot = originalDir, originalAudio, originalRoot })
+	setCurrentConfigForTest(t, Config{Helper: HelperConfig{Socket: socket}})
+
+	dropIn := filepath.Join(SystemdUnitDir, playbackServiceUnit+".d", takeoverDropInName)
+	for path, want := range map[string][2]string{
+		dropIn: {"[Service]\nExecStart=\n", "[Service]\nUser=signage\nExecStart=\n"},
+		filepath.Join(SystemdUnitDir, "kiosk.service"):         {"[Unit]\n", "[Unit]\n"},
+		filepath.Join(SystemdUnitDir, "mnt-share.mount"):       {"[Mount]\nOptions=suid\n", "[Mount]\nOptions=nosuid,nodev\n"},
+		filepath.Join(SystemdUnitDir, "playlist.upload.timer"): {"[Timer]\n", "[Timer]\n"},
+		AudioConfigPath: {"defaults.pcm.card 1\n", "defaults.pcm.card 1\n"},
+	} {
+		if err := writeSystemFile(path, want[0]); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+		if data, err := os.ReadFile(path); err != nil || string(data) != want[1] {
+			t.Fatalf("%s = %q, %v", path, data, err)
+		}
+	}
+	// Content that would run as root is refused.
+	if err := writeSystemFile(dropIn, "[Service]\nUser=root\n"); err == nil || !strings.Contains(err.Error(), "units run as signage") {
+		t.Fatalf("expected User=root to be refused, got %v", err)
+	}
+	if err := removeSystemFile(dropIn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Dir(dropIn)); !os.IsNotExist(err) {
+		t.Fatalf("expected the empty drop-in directory to be removed, got %v", err)
+	}
+
+	// The units of the agent and helper run as root, and everything else
+	// is not the agent's.
+	for _, path := range []string{
+		filepath.Join(SystemdUnitDir, "media-pi-agent.service"),
+		filepath.Join(SystemdUnitDir, "media-pi-helper.service"),
+		filepath.Join(SystemdUnitDir, "ssh.service.d", "override.conf"),
+		filepath.Join(SystemdUnitDir, "kiosk.service.d", "..", "..", "ssh.service"),
+		filepath.Join(SystemdUnitDir, "kiosk.service.d", "override"),
+		filepath.Join(filepath.Dir(SystemdUnitDir), "passwd"),
+	} {
+		if err := writeSystemFile(path, "[Service]\nExecStart=/bin/sh\n"); err == nil || !strings.Contains(err.Error(), "not managed") {
+			t.Errorf("write %s: expected rejection, got %v", path, err)
+		}
+	}
+}
+
+func TestRenderUnitFilesWithHelperRequiresServiceUser(t *testing.T) {
+	_, err := RenderUnitFiles(Config{
+		MediaPiServiceUser: "\n\t",
+		Playlist:           PlaylistConfig{Destination: "/var/media-pi"},
+		Helper:             HelperConfig{Socket: DefaultHelperSocket},
+	})
+	if err == nil || !strings.Contains(err.Error(), "media_pi_service_user is empty") {
+		t.Fatalf("expected an empty service user to be rejected, got %v", err)
+	}
+}
+
+func TestLoadHelperPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "media-pi-helper", "policy.yaml")
+	created, err := InstallHelperPolicy(path, Config{
+		MediaPiServiceUser: "signage",
+		AllowedUnits:       []string{"kiosk.service"},
+		Helper:             HelperConfig{Socket: DefaultHelperSocket, Polkit: true},
+		Exec:               ExecConfig{Jobs: []ExecJobConfig{{ExecCommandConfig: ExecCommandConfig{Name: "fsck"}}}},
+	})
+	if err != nil || !created {
+		t.Fatalf("InstallHelperPolicy = %v, %v", created, err)
+	}
+	policy, err := LoadHelperPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.ServiceUser != "signage" || !policy.Polkit || policy.Socket != DefaultHelperSocket ||
+		!reflect.DeepEqual(policy.AllowedUnits, []string{"kiosk.service"}) || len(policy.Jobs) != 1 || policy.Jobs[0].Name != "fsck" {
+		t.Fatalf("policy = %+v", policy)
+	}
+
+	// An existing policy is root's; install-units does not replace it.
+	if created, err := InstallHelperPolicy(path, Config{AllowedUnits: []string{"ssh.service"}}); err != nil || created {
+		t.Fatalf("InstallHelperPolicy over an existing policy = %v, %v", created, err)
+	}
+
+	// A policy others can change is refused.
+	if err := os.Chmod(path, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHelperPolicy(path); err == nil {
+		t.Fatal("expected a group-writable policy to be refused")
+	}
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Dir(path), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHelperPolicy(path); err == nil {
+		t.Fatal("expected a policy in a writable directory to be refused")
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// helperUnitKeys are the keys of each unit file section the helper writes
+// for the agent. A unit runs as root unless it says otherwise, so anything
+// that could lift a unit above the service user, read files as root or
+// start units the agent does not manage is left out.
+var helperUnitKeys = map[string][]string{
+	"Unit": {
+		"Description", "Documentation", "After", "Before", "Wants", "Requires",
+		"BindsTo", "PartOf", "Conflicts", "StartLimitIntervalSec", "StartLimitBurst",
+	},
+	"Service": {
+		"Type", "ExecStart", "ExecStartPre", "ExecStartPost", "ExecStop", "ExecStopPost",
+		"ExecReload", "Restart", "RestartSec", "RemainAfterExit", "TimeoutStartSec",
+		"TimeoutStopSec", "StandardOutput", "StandardError", "SyslogIdentifier",
+		"Environment", "WorkingDirectory", "CacheDirectory", "User", "Group", "Nice", "CPUWeight",
+		"IOWeight", "CPUQuota", "MemoryMax", "Slice", "KillMode", "KillSignal",
+		"NoNewPrivileges", "PrivateTmp", "ProtectKernelTunables", "ProtectKernelModules",
+		"ProtectControlGroups", "RestrictAddressFamilies",
+	},
+	"Timer":     {"OnCalendar", "OnBootSec", "OnUnitActiveSec", "Persistent", "RandomizedDelaySec", "AccuracySec", "Unit"},
+	"Mount":     {"What", "Where", "Type", "Options", "TimeoutSec", "DirectoryMode", "LazyUnmount", "ForceUnmount"},
+	"Automount": {"Where", "TimeoutIdleSec", "DirectoryMode"},
+	"Install":   {"WantedBy", "RequiredBy"},
+}
+
+// helperDependencyKeys start or stop the units they name.
+var helperDependencyKeys = []string{"Wants", "Requires", "BindsTo", "Conflicts"}
+
+// helperMountOptions are forced on every mount unit, so a share cannot
+// bring setuid programs or device nodes.
+var helperMountOptions = []string{"nosuid", "nodev"}
+
+// checkHelperFile validates content the agent asks the helper to write at
+// path and returns what the helper writes. asound.conf is taken as is.
+// Unit files and drop-ins are parsed instead of trusted: every [Service]
+// section runs as the policy's service user, commands cannot ask for full
+// privileges, dependencies name only units the helper manages and mounts
+// are nosuid and nodev.
+func checkHelperFile(policy *HelperPolicy, path, content string) (string, error) {
+	if path == AudioConfigPath {
+		return content, nil
+	}
+	var out strings.Builder
+	section := ""
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			out.WriteString(line + "\n")
+			continue
+		}
+		if strings.HasSuffix(trimmed, `\`) {
+			return "", fmt.Errorf("line %d: continuation lines are not supported", i+1)
+		}
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.Trim(trimmed, "[]")
+			if _, ok := helperUnitKeys[section]; !ok {
+				return "", fmt.Errorf("line %d: section [%s] is not allowed", i+1, section)
+			}
+			out.WriteString(trimmed + "\n")
+			if section == "Service" {
+				out.WriteString("User=" + policy.ServiceUser + "\n")
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || section == "" {
+			return "", fmt.Errorf("line %d: expected key=value in a section", i+1)
+		}
+		if !slices.Contains(helperUnitKeys[section], key) {
+			return "", fmt.Errorf("line %d: %s= is not allowed in [%s]", i+1, key, section)
+		}
+		value, err := checkHelperUnitValue(policy, section, key, value)
+		if err != nil {
+			return "", fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if section == "Service" && key == "User" {
+			// Already forced after the section header.
+			continue
+		}
+		out.WriteString(key + "=" + value + "\n")
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+// checkHelperUnitValue checks the value of an allowed key and returns the
+// value to write.
+func checkHelperUnitValue(policy *HelperPolicy, section, key, value string) (string, error) {
+	switch {
+	case section == "Service" && (key == "User" || key == "Group"):
+		if value != policy.ServiceUser {
+			return "", fmt.Errorf("%s=%s: units run as %s", key, value, policy.ServiceUser)
+		}
+	case section == "Service" && strings.HasPrefix(key, "Exec"):
+		// The prefixes + and ! run a command with full privileges.
+		prefix := value[:len(value)-len(strings.TrimLeft(value, "@-:+!|"))]
+		if strings.ContainsAny(prefix, "+!|") {
+			return "", fmt.Errorf("%s: privileged command prefixes are not allowed", key)
+		}
+	case section == "Service" && (key == "StandardOutput" || key == "StandardError"):
+		// Files are opened by systemd, as root.
+		if strings.Contains(value, ":") {
+			return "", fmt.Errorf("%s=%s is not allowed", key, value)
+		}
+	case section == "Unit" && slices.Contains(helperDependencyKeys, key),
+		section == "Timer" && key == "Unit":
+		for _, unit := range strings.Fields(value) {
+			if !strings.HasSuffix(unit, ".target") && !helperUnitAllowed(policy, unit) {
+				return "", fmt.Errorf("%s=%s: unit is not managed by the agent", key, unit)
+			}
+		}
+	case section == "Mount" && key == "Type":
+		if _, ok := storageFilesystems[value]; !ok && value != networkMountCIFS && value != networkMountNFS && value != networkMountDavfs {
+			return "", fmt.Errorf("mount type %q is not allowed", value)
+		}
+	case section == "Mount" && key == "Options":
+		return helperMountOptionsFor(value)
+	}
+	return value, nil
+}
+
+// helperMountOptionsFor drops options that would undo helperMountOptions
+// and appends them. CIFS credentials are read by root, so only the files
+// the agent keeps in NetworkMountCredentialsDir are accepted.
+func helperMountOptionsFor(value string) (string, error) {
+	var options []string
+	for _, option := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(option, "=")
+		switch name {
+		case "suid", "dev", "nosuid", "nodev":
+			continue
+		case "credentials", "cred":
+			if filepath.Dir(filepath.Clean(arg)) != NetworkMountCredentialsDir {
+				return "", fmt.Errorf("credentials outside %s are not allowed", NetworkMountCredentialsDir)
+			}
+		}
+		options = append(options, option)
+	}
+	return strings.Join(append(options, helperMountOptions...), ","), nil
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckHelperFileAcceptsRenderedUnits(t *testing.T) {
+	policy := &HelperPolicy{ServiceUser: "pi"}
+	config := Config{
+		MediaPiServiceUser: "pi",
+		Playlist:           PlaylistConfig{Destination: "/var/media-pi"},
+		Audio:              AudioConfig{Playback: AudioPlaybackConfig{Enabled: true}},
+	}
+	units, err := RenderUnitFiles(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{
+		"playlist.upload.timer":                       renderTimerSchedule("Playlist upload", "playlist.upload.service", []string{"03:00"}),
+		"mnt-usb.mount":                               renderMountUnit(StorageMountRequest{Device: "/dev/sda1", MountPoint: "/mnt/usb", FSType: "ext4"}),
+		"mnt-share.mount":                             renderNetworkMountUnit(NetworkMountConfig{MountPoint: "/mnt/share", Type: networkMountCIFS, Source: "//nas/media", Username: "pi"}),
+		"mnt-share.automount":                         renderNetworkAutomountUnit(NetworkMountConfig{MountPoint: "/mnt/share", Type: networkMountCIFS}),
+		playbackServiceUnit + ".d/" + webDropInName:   webDropIn(config, "/usr/bin/chromium --kiosk https://example.com"),
+		playbackServiceUnit + ".d/override-test.conf": "[Service]\nExecStart=\nExecStart=/usr/bin/mpv /var/media-pi/a.mp4\n",
+	}
+	for _, unit := range units {
+		if helperUnitFileAllowed(policy, unit.Name) {
+			contents[unit.Name] = unit.Content
+		}
+	}
+	for name, content := range contents {
+		checked, err := checkHelperFile(policy, filepath.Join(SystemdUnitDir, name), content)
+		if err != nil {
+			t.Errorf("%s: %v\n%s", name, err, content)
+			continue
+		}
+		if strings.Contains(content, "[Service]") && !strings.Contains(checked, "[Service]\nUser=pi\n") {
+			t.Errorf("%s: service user not forced:\n%s", name, checked)
+		}
+		if strings.Contains(content, "[Mount]") && !strings.Contains(checked, ",nosuid,nodev\n") {
+			t.Errorf("%s: mount options not forced:\n%s", name, checked)
+		}
+	}
+}
+
+func TestCheckHelperFileRejectsPrivilegedContent(t *testing.T) {
+	policy := &HelperPolicy{ServiceUser: "pi"}
+	path := filepath.Join(SystemdUnitDir, playbackServiceUnit)
+	for _, content := range []string{
+		"[Service]\nUser=root\n",
+		"[Service]\nGroup=root\n",
+		"[Service]\nExecStart=+/bin/sh -c id\n",
+		"[Service]\nExecStartPre=-!/bin/sh\n",
+		"[Service]\nLoadCredential=key:/etc/shadow\n",
+		"[Service]\nStandardOutput=file:/etc/passwd\n",
+		"[Service]\nExecStart=/bin/true \\\n  --flag\n",
+		"[Unit]\nWants=debug-shell.service\n",
+		"[Timer]\nUnit=ssh.service\n",
+		"[Mount]\nType=fuse\n",
+		"[Mount]\nOptions=credentials=/root/.smb\n",
+		"[Socket]\nListenStream=80\n",
+		"User=root\n",
+	} {
+		if _, err := checkHelperFile(policy, path, content); err == nil {
+			t.Errorf("expected %q to be rejected", content)
+		}
+	}
+}
+
+func TestCheckHelperFileForcesServiceUserAndMountOptions(t *testing.T) {
+	policy := &HelperPolicy{ServiceUser: "pi"}
+	checked, err := checkHelperFile(policy, filepath.Join(SystemdUnitDir, "mnt-usb.mount"), "[Mount]\nOptions=defaults,suid,dev\n")
+	if err != nil || checked != "[Mount]\nOptions=defaults,nosuid,nodev\n" {
+		t.Fatalf("mount = %q, %v", checked, err)
+	}
+	checked, err = checkHelperFile(policy, filepath.Join(SystemdUnitDir, audioPlaybackUnit), "[Service]\nUser=pi\nExecStart=/usr/bin/mpv\n[Service]\n")
+	if err != nil || checked != "[Service]\nUser=pi\nExecStart=/usr/bin/mpv\n[Service]\nUser=pi\n" {
+		t.Fatalf("service = %q, %v", checked, err)
+	}
+}
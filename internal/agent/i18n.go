@@ -0,0 +1,431 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Locales of API messages. Handlers write messages in Russian; other
+// locales translate them through messageCatalog.
+const (
+	LocaleRU      = "ru"
+	LocaleEN      = "en"
+	DefaultLocale = LocaleRU
+)
+
+// normalizeLocale returns the supported locale named by value, or the
+// default locale for an empty value.
+func normalizeLocale(value string) (string, error) {
+	switch locale := strings.ToLower(strings.TrimSpace(value)); locale {
+	case "":
+		return DefaultLocale, nil
+	case LocaleRU, LocaleEN:
+		return locale, nil
+	default:
+		return "", fmt.Errorf("unsupported locale %q, expected %s or %s", value, LocaleRU, LocaleEN)
+	}
+}
+
+// messageCatalog maps Russian API messages to their translations. Keys are
+// the format strings used by handlers, so formatted messages are matched
+// with their arguments, which are translated in turn.
+var messageCatalog = map[string]map[string]string{
+	LocaleEN: {
+		// Authentication and common request errors.
+		"Сервер не настроен для аутентификации":       "Server is not configured for authentication",
+		"Требуется заголовок Authorization":           "Authorization header is required",
+		"Требуется токен Bearer":                      "Bearer token is required",
+		"Недействительный токен":                      "Invalid token",
+		"Доступ с этого адреса запрещён":              "Access from this address is forbidden",
+		"Метод не разрешён":                           "Method not allowed",
+		"Неверный JSON в теле запроса":                "Invalid JSON in request body",
+		"Неверный формат запроса":                     "Invalid request format",
+		"Устройство не готово":                        "Device is not ready",
+		"Метрики отключены":                           "Metrics are disabled",
+		"Потоковая передача не поддерживается":        "Streaming is not supported",
+		"Команда не разрешена: %v":                    "Command not allowed: %v",
+		"Задание не найдено: %s":                      "Job not found: %s",
+		"Задание %s уже выполняется":                  "Job %s is already running",
+		"Некорректный идентификатор медиафайла":       "Invalid media file id",
+		"Миниатюра не найдена: %d":                    "Thumbnail not found: %d",
+		"Не удалось запустить задание: %v":            "Failed to start the job: %v",
+		"Ошибка конфигурации exec: %v":                "exec configuration error: %v",
+		"Не удалось выполнить команду: %v":            "Failed to run the command: %v",
+		"Туннель уже открыт":                          "The tunnel is already open",
+		"Не удалось открыть туннель: %v":              "Failed to open the tunnel: %v",
+		"Туннель закрыт":                              "Tunnel closed",
+		"Диагностика отключена":                       "Diagnostics are disabled",
+		"durationSeconds не может быть отрицательным": "durationSeconds must not be negative",
+		"Самопроверка не пройдена":                    "Self-test failed",
+		"Агент работает в безопасном режиме":          "The agent runs in safe mode",
+		"Агент не в безопасном режиме":                "The agent is not in safe mode",
+		"Не удалось выйти из безопасного режима: %v":  "Failed to leave safe mode: %v",
+		"Агент перезапускается в обычном режиме":      "The agent restarts in normal mode",
+		"Профиль не найден: %v":                       "Profile not found: %v",
+
+		// Units.
+		"управление сервисом %q запрещено":                            "managing service %q is not allowed",
+		"Не удалось подключиться к D-Bus: %v":                         "Failed to connect to D-Bus: %v",
+		"Оркестрация не найдена: %v":                                  "Orchestration not found: %v",
+		"Оркестрация уже выполняется":                                 "An orchestration is already running",
+		"Оркестрация прервана, изменения отменены: %v":                "Orchestration aborted, changes rolled back: %v",
+		"подключиться к D-Bus: %w":                                    "connect to D-Bus: %w",
+		"Требуется параметр unit":                                     "Parameter unit is required",
+		"Юнит %s не является таймером":                                "Unit %s is not a timer",
+		"Поле unit обязательно":                                       "Field unit is required",
+		"Неизвестное действие: %s":                                    "Unknown action: %s",
+		"Выполнение действия завершилось с ошибкой: %v":               "Action failed: %v",
+		"Не удалось дождаться завершения действия для %s: %v":         "Failed to wait for the action on %s: %v",
+		"Юнит %s не выполнил действие %s: результат %s, состояние %s": "Unit %s did not complete %s: result %s, state %s",
+		"Не удалось получить статус сервисов: %v":                     "Failed to get service status: %v",
+
+		// Playback and menu actions.
+		"Таймаут остановки воспроизведения":                          "Timed out stopping playback",
+		"Не удалось остановить воспроизведение: %v":                  "Failed to stop playback: %v",
+		"Воспроизведение остановлено":                                "Playback stopped",
+		"Не удалось запустить воспроизведение: %v":                   "Failed to start playback: %v",
+		"Воспроизведение запущено":                                   "Playback started",
+		"таймаут запуска воспроизведения":                            "timed out starting playback",
+		"Не удалось перезагрузить конфигурацию: %v":                  "Failed to reload configuration: %v",
+		"Изменения применены":                                        "Changes applied",
+		"Не удалось перезапустить воспроизведение: %v":               "Failed to restart playback: %v",
+		"Перезагрузка...":                                            "Rebooting...",
+		"Выключение...":                                              "Shutting down...",
+		"Не удалось запустить загрузку плейлиста: %v":                "Failed to start playlist upload: %v",
+		"Загрузка плейлиста запущена":                                "Playlist upload started",
+		"Не удалось остановить загрузку плейлиста: %v":               "Failed to stop playlist upload: %v",
+		"Загрузка плейлиста остановлена":                             "Playlist upload stopped",
+		"Не удалось запустить загрузку видео: %v":                    "Failed to start video upload: %v",
+		"Поле revision обязательно":                                  "The revision field is required",
+		"Конфигурация уже изменена (ревизия %d), получите её заново": "The configuration has already changed (revision %d), fetch it again",
+		"Другой запрос уже изменяет %s, повторите запрос позже":      "Another request is already changing %s, retry later",
+		"Не удалось построить план синхронизации: %v":                "Failed to plan sync: %v",
+		"Неверная область синхронизации: %v":                         "Invalid sync scope: %v",
+		"Загрузка видео запущена":                                    "Video upload started",
+		"Не удалось остановить загрузку видео: %v":                   "Failed to stop video upload: %v",
+		"Загрузка видео остановлена":                                 "Video upload stopped",
+		"Не удалось сделать снимок: %v":                              "Failed to take screenshot: %v",
+		"Не удалось прочитать снимок: %v":                            "Failed to read screenshot: %v",
+		"Не удалось получить действующую конфигурацию: %v":           "Failed to get effective configuration: %v",
+
+		// Configuration settings.
+		"строка ExecStart не содержит '='":                          "ExecStart line has no '='",
+		"строка ExecStart не содержит пути источника и назначения":  "ExecStart line has no source and destination paths",
+		"строка ExecStart не найдена":                               "ExecStart line not found",
+		"не удалось прочитать конфигурационный файл: %w":            "failed to read configuration file: %w",
+		"output должен быть 'hdmi' или 'jack'":                      "output must be 'hdmi' or 'jack'",
+		"Поле destination обязательно":                              "Field destination is required",
+		"Недопустимый путь destination":                             "Invalid destination path",
+		"Неверный формат времени. Используйте HH:MM":                "Invalid time format. Use HH:MM",
+		"Неправильный формат таймера загрузки плейлиста: %v":        "Invalid playlist upload timer: %v",
+		"Неправильный формат таймера загрузки видео: %v":            "Invalid video upload timer: %v",
+		"Не удалось обновить конфигурацию: %v":                      "Failed to update configuration: %v",
+		"Не удалось прочитать crontab: %v":                          "Failed to read crontab: %v",
+		"Не удалось приостановить синхронизацию по расписанию: %v":  "Failed to pause scheduled syncs: %v",
+		"Не удалось возобновить синхронизацию по расписанию: %v":    "Failed to resume scheduled syncs: %v",
+		"Синхронизация по расписанию возобновлена":                  "Scheduled syncs resumed",
+		"Не удалось обновить crontab: %v":                           "Failed to update crontab: %v",
+		"файл службы загрузки плейлиста":                            "playlist upload service file",
+		"файл таймера плейлиста":                                    "playlist timer file",
+		"файл таймера видео":                                        "video timer file",
+		"настройки звука":                                           "audio settings",
+		"конфигурация агента":                                       "agent configuration",
+		"Не удалось применить конфигурацию, изменения отменены: %v": "Failed to apply configuration, changes rolled back: %v",
+		"Обновление плейлиста в %v попадает в нерабочее время %v: воспроизведение будет запущено до его окончания":         "Playlist update at %v falls into rest time %v: playback will start before it ends",
+		"Синхронизация видео в %v попадает в нерабочее время %v: она не выполнится, если на это время отключается питание": "Video sync at %v falls into rest time %v: it does not run if power is cut for that time",
+		"Перезагрузка в %v может прервать синхронизацию, начатую в %v":                                                     "Reboot at %v may interrupt the sync started at %v",
+		"Перезагрузка в %v прервёт воспроизведение: она не попадает в нерабочее время":                                     "Reboot at %v interrupts playback: it is outside rest time",
+		"Конфигурация обновлена":                                                                    "Configuration updated",
+		"Не удалось экспортировать конфигурацию: %v":                                                "Failed to export configuration: %v",
+		"Не удалось импортировать конфигурацию, изменения отменены: %v":                             "Failed to import configuration, changes rolled back: %v",
+		"Конфигурация импортирована; выполните /api/menu/system/reload, чтобы применить unit-файлы": "Configuration imported; call /api/menu/system/reload to apply the unit files",
+
+		// Schedules.
+		"для каждого интервала нерабочего времени необходимо указать начало и конец": "every rest interval needs a start and an end",
+		"неверный формат таймера фотоотчёта %q. Используйте HH:mm:ss":                "invalid photo report timer %q. Use HH:mm:ss",
+		"неверный формат часов в таймере фотоотчёта %q":                              "invalid hours in photo report timer %q",
+		"неверный формат минут в таймере фотоотчёта %q":                              "invalid minutes in photo report timer %q",
+		"неверный формат секунд в таймере фотоотчёта %q":                             "invalid seconds in photo report timer %q",
+		"неверный формат времени. Используйте HH:MM":                                 "invalid time format. Use HH:MM",
+		"ошибка в времени начала нерабочего времени: %v":                             "invalid rest start time: %v",
+		"ошибка в времени окончания нерабочего времени: %v":                          "invalid rest end time: %v",
+		"интервал нерабочего времени не может иметь нулевую длительность":            "rest interval cannot have zero duration",
+		"интервалы нерабочего времени не должны пересекаться":                        "rest intervals must not overlap",
+		"интервалы нерабочего времени не должны пересекаться через границу суток":    "rest intervals must not overlap across midnight",
+		"ошибка в значении начала нерабочего времени: %v":                            "invalid rest start value: %v",
+		"ошибка в значении окончания нерабочего времени: %v":                         "invalid rest end value: %v",
+		"неверный формат времени: %s":                                                "invalid time format: %s",
+		"неверный формат часа: %s":                                                   "invalid hour: %s",
+		"неверный формат минут: %s":                                                  "invalid minutes: %s",
+		"время вне диапазона: %s":                                                    "time out of range: %s",
+		"неожиданная команда: %s":                                                    "unexpected command: %s",
+		"недостаточно полей в cron: %s":                                              "not enough cron fields: %s",
+		"время вне диапазона в cron: %s":                                             "time out of range in cron: %s",
+		"невалидная строка cron: %s":                                                 "invalid cron line: %s",
+		"неверный формат":                                                            "invalid format",
+		"значение вне диапазона":                                                     "value out of range",
+
+		// Displays.
+		"Не удалось получить список дисплеев: %v":                                       "Failed to list displays: %v",
+		"Неверные настройки дисплеев: %v":                                               "Invalid display settings: %v",
+		"Не удалось сохранить настройки дисплеев: %v":                                   "Failed to save display settings: %v",
+		"Не удалось обновить сервисы воспроизведения: %v":                               "Failed to update playback services: %v",
+		"Настройки дисплеев сохранены":                                                  "Display settings saved",
+		"Настройки дисплеев сохранены, но перезапустить воспроизведение не удалось: %v": "Display settings saved, but playback could not be restarted: %v",
+		"Поле output обязательно":                                                       "Field output is required",
+		"Дисплей %s не настроен":                                                        "Display %s is not configured",
+		"Таймаут управления воспроизведением на %s":                                     "Timed out controlling playback on %s",
+		"Не удалось управлять воспроизведением на %s: %v":                               "Failed to control playback on %s: %v",
+		"Воспроизведение на %s запущено":                                                "Playback on %s started",
+		"Воспроизведение на %s остановлено":                                             "Playback on %s stopped",
+		"Не удалось получить настройки дисплеев: %v":                                    "Failed to get display settings: %v",
+		"Неверные настройки дисплея: %v":                                                "Invalid display settings: %v",
+		"Не удалось найти cmdline.txt: %v":                                              "Failed to find cmdline.txt: %v",
+		"Не удалось записать %s: %v":                                                    "Failed to write %s: %v",
+		"Не удалось сохранить настройки дисплея: %v":                                    "Failed to save display settings: %v",
+		"Настройки дисплея %s применены":                                                "Display %s settings applied",
+		"Настройки дисплея %s сохранены и будут применены после перезагрузки":           "Display %s settings saved and will apply after reboot",
+
+		// Sync, media and playback features.
+		"Нет заблокированного удаления файлов":                              "No blocked file deletion",
+		"Удаление подтверждено, но не удалось запустить загрузку видео: %v": "Deletion confirmed, but video upload could not be started: %v",
+		"Удаление %d файлов подтверждено":                                   "Deletion of %d files confirmed",
+		"Синхронизация ещё не выполнялась":                                  "No sync has run yet",
+		"Файл не в карантине: %v":                                           "File is not quarantined: %v",
+		"Из карантина возвращено файлов: %d":                                "Files released from quarantine: %d",
+		"Неверные имя или метки устройства: %v":                             "Invalid device name or labels: %v",
+		"Не удалось сохранить имя и метки устройства: %v":                   "Failed to save device name and labels: %v",
+		"Неверные параметры наложения: %v":                                  "Invalid overlay parameters: %v",
+		"Неверные параметры сбоев":                                          "Invalid fault parameters",
+		"Наложения требуют плеер mpv: задайте player.ipc_socket":            "Overlays require the mpv player: set player.ipc_socket",
+		"Не удалось показать наложение: %v":                                 "Failed to show overlay: %v",
+		"Наложение убрано":                                                  "Overlay removed",
+		"Обмен файлами с соседними устройствами отключён":                   "File sharing with peer devices is disabled",
+		"Файл не найден":                                                    "File not found",
+		"Путь вне каталогов медиафайлов":                                    "Path is outside the media directories",
+		"Не удалось прочитать каталог: %v":                                  "Failed to read the directory: %v",
+		"Можно скачать только обычный файл":                                 "Only regular files can be downloaded",
+		"Синхронное воспроизведение не включено":                            "Synchronized playback is not enabled",
+		"Датчик присутствия не включен":                                     "Presence sensor is not enabled",
+		"Поле asset обязательно":                                            "Field asset is required",
+		"Неверный файл для экстренного показа: %v":                          "Invalid takeover file: %v",
+		"Не удалось запустить экстренный показ: %v":                         "Failed to start takeover: %v",
+		"Не удалось завершить экстренный показ: %v":                         "Failed to end takeover: %v",
+		"Экстренный показ завершён, воспроизведение восстановлено":          "Takeover ended, playback restored",
+		"Фоновая музыка не включена":                                        "Background music is disabled",
+		"Не удалось запустить фоновую музыку: %v":                           "Failed to start background music: %v",
+		"Не удалось остановить фоновую музыку: %v":                          "Failed to stop background music: %v",
+		"Фоновая музыка запущена":                                           "Background music started",
+		"Фоновая музыка остановлена":                                        "Background music stopped",
+		"Громкость должна быть числом от 0 до 100":                          "Volume must be a number from 0 to 100",
+		"Не удалось изменить громкость: %v":                                 "Failed to change the volume: %v",
+		"Громкость фоновой музыки: %d":                                      "Background music volume: %d",
+		"Укажите поле url или bundle":                                       "Set url or bundle",
+		"Показ веб-содержимого не включен":                                  "Web content is disabled",
+		"Не удалось показать веб-содержимое: %v":                            "Failed to show web content: %v",
+		"Не удалось остановить веб-содержимое: %v":                          "Failed to stop web content: %v",
+		"Показ веб-содержимого остановлен, воспроизведение восстановлено":   "Web content stopped, playback restored",
+		"Не удалось очистить кэш браузера: %v":                              "Failed to clear the browser cache: %v",
+		"Кэш браузера очищен, освобождено %d байт":                          "Browser cache cleared, %d bytes freed",
+		"Не удалось прочитать корзину: %v":                                  "Failed to read trash: %v",
+		"Поле id обязательно":                                               "Field id is required",
+		"Не удалось восстановить файл: %v":                                  "Failed to restore file: %v",
+		"Файл %s восстановлен":                                              "File %s restored",
+		"Пакет медиафайлов не найден":                                       "Media bundle not found",
+		"Не удалось запустить импорт медиафайлов: %v":                       "Failed to start media import: %v",
+		"Импорт медиафайлов запущен":                                        "Media import started",
+
+		// Storage.
+		"поле device обязательно":                                        "field device is required",
+		"недопустимое значение device":                                   "invalid device value",
+		"device должен быть путём /dev/... или UUID=, LABEL=, PARTUUID=": "device must be a /dev/... path or UUID=, LABEL=, PARTUUID=",
+		"недопустимый путь mountPoint":                                   "invalid mountPoint path",
+		"mountPoint должен находиться в /mnt или /media":                 "mountPoint must be under /mnt or /media",
+		"неподдерживаемая файловая система: %s":                          "unsupported file system: %s",
+		"недопустимый путь destination":                                  "invalid destination path",
+		"destination должен находиться внутри mountPoint":                "destination must be inside mountPoint",
+		"%s не смонтирован":                                              "%s is not mounted",
+		"destination не может совпадать с текущим каталогом медиафайлов или содержать его": "destination cannot be or contain the current media directory",
+		"перенос уже выполняется":                                   "migration is already running",
+		"Не удалось получить список устройств: %v":                  "Failed to list devices: %v",
+		"Не удалось создать точку монтирования: %v":                 "Failed to create mount point: %v",
+		"Поле mode должно быть systemd или fstab":                   "Field mode must be systemd or fstab",
+		"Не удалось настроить монтирование: %v":                     "Failed to configure mount: %v",
+		"недопустимое значение source":                              "invalid source value",
+		"source для cifs должен иметь вид //server/share":           "cifs source must look like //server/share",
+		"source для nfs должен иметь вид server:/export":            "nfs source must look like server:/export",
+		"nfs не поддерживает имя пользователя и пароль":             "nfs does not support a username and password",
+		"source для davfs должен быть адресом http:// или https://": "davfs source must be an http:// or https:// URL",
+		"неподдерживаемый тип сетевого монтирования: %s":            "unsupported network mount type: %s",
+		"недопустимое значение options":                             "invalid options value",
+		"недопустимые учётные данные":                               "invalid credentials",
+		"Сетевое монтирование не найдено: %v":                       "Network mount not found: %v",
+		"Не удалось удалить монтирование: %v":                       "Failed to remove mount: %v",
+	},
+}
+
+// formatVerb matches the verbs used in catalog keys.
+var formatVerb = regexp.MustCompile(`%[vsdqw]`)
+
+// catalogPattern matches messages produced by one formatted catalog key.
+type catalogPattern struct {
+	re          *regexp.Regexp
+	translation string
+}
+
+var (
+	catalogPatternsOnce sync.Once
+	catalogPatterns     map[string][]catalogPattern
+)
+
+// compileCatalogPatterns turns formatted keys into regular expressions,
+// longest key first so the most specific message wins.
+func compileCatalogPatterns() {
+	catalogPatterns = make(map[string][]catalogPattern, len(messageCatalog))
+	for locale, messages := range messageCatalog {
+		keys := make([]string, 0, len(messages))
+		for key := range messages {
+			if formatVerb.MatchString(key) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) > len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+		for _, key := range keys {
+			literals := formatVerb.Split(key, -1)
+			for i, literal := range literals {
+				literals[i] = regexp.QuoteMeta(literal)
+			}
+			catalogPatterns[locale] = append(catalogPatterns[locale], catalogPattern{
+				re:          regexp.MustCompile(`(?s)^` + strings.Join(literals, `(.*)`) + `$`),
+				translation: messages[key],
+			})
+		}
+	}
+}
+
+// translateMessage returns msg in locale. Messages missing from the catalog
+// are returned unchanged.
+func translateMessage(locale, msg string) string {
+	return translateMessageDepth(locale, msg, 3)
+}
+
+func translateMessageDepth(locale, msg string, depth int) string {
+	messages, ok := messageCatalog[locale]
+	if !ok || msg == "" || depth == 0 {
+		return msg
+	}
+	if translation, ok := messages[msg]; ok {
+		return translation
+	}
+
+	catalogPatternsOnce.Do(compileCatalogPatterns)
+	for _, pattern := range catalogPatterns[locale] {
+		args := pattern.re.FindStringSubmatch(msg)
+		if args == nil {
+			continue
+		}
+		args = args[1:]
+		i := 0
+		return formatVerb.ReplaceAllStringFunc(pattern.translation, func(verb string) string {
+			if i >= len(args) {
+				return verb
+			}
+			arg := translateMessageDepth(locale, args[i], depth-1)
+			i++
+			return arg
+		})
+	}
+	return msg
+}
+
+// acceptedLocale picks the supported locale preferred by an Accept-Language
+// header, or "" when it names none.
+func acceptedLocale(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if language != LocaleRU && language != LocaleEN {
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = language, q
+		}
+	}
+	return best
+}
+
+// requestLocale returns the locale of API messages for r: the Accept-Language
+// header when it names a supported locale, otherwise the locale setting.
+func requestLocale(r *http.Request) string {
+	if locale := acceptedLocale(r.Header.Get("Accept-Language")); locale != "" {
+		return locale
+	}
+	locale, err := normalizeLocale(GetCurrentConfig().Locale)
+	if err != nil {
+		return DefaultLocale
+	}
+	return locale
+}
+
+// LocaleMiddleware selects the language of API messages. It sets the
+// Content-Language response header, which JSONResponse translates to.
+func LocaleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Language", requestLocale(r))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// localizeResponse translates the messages of response to the locale set
+// by LocaleMiddleware.
+func localizeResponse(w http.ResponseWriter, response APIResponse) APIResponse {
+	locale := w.Header().Get("Content-Language")
+	if locale == "" || locale == LocaleRU {
+		return response
+	}
+	response.ErrMsg = translateMessage(locale, response.ErrMsg)
+	switch data := response.Data.(type) {
+	case MenuActionResponse:
+		data.Message = translateMessage(locale, data.Message)
+		data.Warnings = translateConflicts(locale, data.Warnings)
+		response.Data = data
+	case ScheduleNextResponse:
+		data.Conflicts = translateConflicts(locale, data.Conflicts)
+		response.Data = data
+	}
+	return response
+}
+
+func translateConflicts(locale string, conflicts []ScheduleConflict) []ScheduleConflict {
+	if len(conflicts) == 0 {
+		return conflicts
+	}
+	translated := make([]ScheduleConflict, len(conflicts))
+	for i, conflict := range conflicts {
+		conflict.Message = translateMessage(locale, conflict.Message)
+		translated[i] = conflict
+	}
+	return translated
+}
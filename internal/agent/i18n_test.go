@@ -0,0 +1,102 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranslateMessage(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{"Метод не разрешён", "Method not allowed"},
+		{fmt.Sprintf("Не удалось подключиться к D-Bus: %v", "dial unix: no such file"), "Failed to connect to D-Bus: dial unix: no such file"},
+		{fmt.Sprintf("Юнит %s не выполнил действие %s: результат %s, состояние %s", "a.service", "start", "done", "failed"), "Unit a.service did not complete start: result done, state failed"},
+		// Arguments that are catalog messages are translated too.
+		{"Не удалось обновить конфигурацию: строка ExecStart не найдена", "Failed to update configuration: ExecStart line not found"},
+		{"Выполнение действия завершилось с ошибкой: " + fmt.Sprintf("управление сервисом %q запрещено", "x.service"), `Action failed: managing service "x.service" is not allowed`},
+		{"Unknown message", "Unknown message"},
+	}
+	for _, tt := range tests {
+		if got := translateMessage(LocaleEN, tt.msg); got != tt.want {
+			t.Errorf("translateMessage(%q) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+	if got := translateMessage(LocaleRU, "Метод не разрешён"); got != "Метод не разрешён" {
+		t.Errorf("expected Russian unchanged, got %q", got)
+	}
+}
+
+func TestAcceptedLocale(t *testing.T) {
+	tests := map[string]string{
+		"":                          "",
+		"en":                        LocaleEN,
+		"en-US,en;q=0.9,ru;q=0.8":   LocaleEN,
+		"de-DE, ru;q=0.7, en;q=0.5": LocaleRU,
+		"fr, de":                    "",
+		"en;q=0, ru":                LocaleRU,
+	}
+	for header, want := range tests {
+		if got := acceptedLocale(header); got != want {
+			t.Errorf("acceptedLocale(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestLocaleMiddleware(t *testing.T) {
+	setCurrentConfigForTest(t, Config{ServerKey: "key", Locale: "en"})
+	handler := LocaleMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ok" {
+			JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: MenuActionResponse{Action: "stop", Result: "success", Message: "Воспроизведение остановлено"}})
+			return
+		}
+		requireMethod(w, r, http.MethodPost)
+	}))
+
+	request := func(path, acceptLanguage string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The locale setting applies without Accept-Language.
+	w := request("/", "")
+	var resp APIResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.ErrMsg != "Method not allowed" || w.Header().Get("Content-Language") != LocaleEN {
+		t.Fatalf("expected English error, got %s (%v)", w.Body.String(), err)
+	}
+	w = request("/ok", "")
+	if !strings.Contains(w.Body.String(), `"message":"Playback stopped"`) {
+		t.Fatalf("expected English message, got %s", w.Body.String())
+	}
+
+	// Accept-Language overrides it.
+	w = request("/", "ru-RU,ru;q=0.9")
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.ErrMsg != "Метод не разрешён" || w.Header().Get("Content-Language") != LocaleRU {
+		t.Fatalf("expected Russian error, got %s (%v)", w.Body.String(), err)
+	}
+}
+
+func TestLoadConfigRejectsUnknownLocale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	if err := os.WriteFile(path, []byte("server_key: key\nlocale: de\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfigFrom(path); err == nil || !strings.Contains(err.Error(), "unsupported locale") {
+		t.Fatalf("expected unsupported locale error, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits for device identity values. A label is published as one mDNS TXT
+// string "label.<key>=<value>", which must fit in 255 bytes.
+const (
+	maxDeviceNameLength = 63
+	maxLabels           = 32
+	maxLabelKeyLength   = 63
+	maxLabelValueLength = 128
+)
+
+// DeviceIdentity is the operator-assigned name and labels of the device,
+// used to find it in the fleet.
+type DeviceIdentity struct {
+	DeviceName string            `json:"deviceName"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// deviceName returns device_name, or the short host name when it is unset.
+func deviceName(config Config) string {
+	if name := strings.TrimSpace(config.DeviceName); name != "" {
+		return name
+	}
+	return mdnsDeviceName()
+}
+
+// getDeviceIdentity returns the effective identity of config.
+func getDeviceIdentity(config Config) DeviceIdentity {
+	labels := maps.Clone(config.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return DeviceIdentity{DeviceName: deviceName(config), Labels: labels}
+}
+
+// normalizeDeviceIdentity trims and validates an identity update.
+func normalizeDeviceIdentity(identity DeviceIdentity) (DeviceIdentity, error) {
+	name := strings.TrimSpace(identity.DeviceName)
+	if utf8.RuneCountInString(name) > maxDeviceNameLength {
+		return DeviceIdentity{}, fmt.Errorf("device name is longer than %d characters", maxDeviceNameLength)
+	}
+	if strings.ContainsFunc(name, unicode.IsControl) {
+		return DeviceIdentity{}, fmt.Errorf("device name contains control characters")
+	}
+	if len(identity.Labels) > maxLabels {
+		return DeviceIdentity{}, fmt.Errorf("more than %d labels", maxLabels)
+	}
+	var labels map[string]string
+	for key, value := range identity.Labels {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" || len(key) > maxLabelKeyLength || strings.ContainsFunc(key, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+		}) {
+			return DeviceIdentity{}, fmt.Errorf("invalid label key %q", key)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) > maxLabelValueLength || strings.ContainsFunc(value, unicode.IsControl) {
+			return DeviceIdentity{}, fmt.Errorf("invalid value for label %q", key)
+		}
+		if labels == nil {
+			labels = make(map[string]string, len(identity.Labels))
+		}
+		labels[key] = value
+	}
+	return DeviceIdentity{DeviceName: name, Labels: labels}, nil
+}
+
+// labelTXTRecords returns the labels as sorted mDNS TXT entries.
+func labelTXTRecords(labels map[string]string) []string {
+	var records []string
+	for _, key := range slices.Sorted(maps.Keys(labels)) {
+		records = append(records, "label."+key+"="+labels[key])
+	}
+	return records
+}
+
+func updateDeviceIdentity(identity DeviceIdentity) error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	if currentConfig == nil {
+		return fmt.Errorf("configuration not loaded")
+	}
+	currentConfig.DeviceName = identity.DeviceName
+	currentConfig.Labels = identity.Labels
+
+	return saveCurrentConfig("identity")
+}
+
+// HandleSystemIdentity returns (GET) or replaces (PUT) the device name and
+// labels.
+func HandleSystemIdentity(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getDeviceIdentity(GetCurrentConfig())})
+	case http.MethodPut:
+		var req DeviceIdentity
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+			return
+		}
+		identity, err := normalizeDeviceIdentity(req)
+		if err != nil {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Неверные имя или метки устройства: %v", err)})
+			return
+		}
+		if err := updateDeviceIdentity(identity); err != nil {
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось сохранить имя и метки устройства: %v", err)})
+			return
+		}
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getDeviceIdentity(GetCurrentConfig())})
+	default:
+		JSONResponse(w, http.StatusMethodNotAllowed, APIResponse{OK: false, ErrMsg: "Метод не разрешён"})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeDeviceIdentity(t *testing.T) {
+	identity, err := normalizeDeviceIdentity(DeviceIdentity{
+		DeviceName: "  Магазин 12, касса  ",
+		Labels:     map[string]string{" Store ": " 12 ", "floor": "2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DeviceIdentity{DeviceName: "Магазин 12, касса", Labels: map[string]string{"store": "12", "floor": "2"}}
+	if !reflect.DeepEqual(identity, want) {
+		t.Fatalf("normalizeDeviceIdentity = %+v, want %+v", identity, want)
+	}
+
+	invalid := []DeviceIdentity{
+		{DeviceName: strings.Repeat("x", maxDeviceNameLength+1)},
+		{DeviceName: "line\nbreak"},
+		{Labels: map[string]string{"": "x"}},
+		{Labels: map[string]string{"store name": "x"}},
+		{Labels: map[string]string{"store": strings.Repeat("x", maxLabelValueLength+1)}},
+	}
+	for _, identity := range invalid {
+		if _, err := normalizeDeviceIdentity(identity); err == nil {
+			t.Errorf("expected %+v to be rejected", identity)
+		}
+	}
+}
+
+func TestHandleSystemIdentity(t *testing.T) {
+	setConfigPathForTest(t, filepath.Join(t.TempDir(), "agent.yaml"))
+	setCurrentConfigForTest(t, Config{ServerKey: "key"})
+
+	w := httptest.NewRecorder()
+	HandleSystemIdentity(w, httptest.NewRequest(http.MethodGet, "/api/system/identity", nil))
+	var got struct {
+		Data DeviceIdentity `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Data.DeviceName != mdnsDeviceName() {
+		t.Fatalf("expected host name by default, got %s, %v", w.Body.String(), err)
+	}
+
+	body := `{"deviceName":"store-12-entrance","labels":{"store":"12","floor":"1"}}`
+	w = httptest.NewRecorder()
+	HandleSystemIdentity(w, httptest.NewRequest(http.MethodPut, "/api/system/identity", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	config := GetCurrentConfig()
+	if config.DeviceName != "store-12-entrance" || config.Labels["store"] != "12" {
+		t.Fatalf("unexpected config %+v", config)
+	}
+	saved, err := os.ReadFile(ConfigPath)
+	if err != nil || !bytes.Contains(saved, []byte("device_name: store-12-entrance")) || !bytes.Contains(saved, []byte("floor: \"1\"")) {
+		t.Fatalf("expected identity saved to config, got %q, %v", saved, err)
+	}
+
+	w = httptest.NewRecorder()
+	HandleSystemIdentity(w, httptest.NewRequest(http.MethodPut, "/api/system/identity", strings.NewReader(`{"labels":{"bad key":"x"}}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for invalid label, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	HandleSystemIdentity(w, httptest.NewRequest(http.MethodDelete, "/api/system/identity", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", w.Code)
+	}
+}
+
+func TestIdentityInHealthAndMDNS(t *testing.T) {
+	setCurrentConfigForTest(t, Config{ServerKey: "key", DeviceName: "store-12", Labels: map[string]string{"store": "12", "floor": "2"}})
+
+	w := httptest.NewRecorder()
+	HandleHealth(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var health struct {
+		Data HealthResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	if health.Data.DeviceName != "store-12" || health.Data.Labels["floor"] != "2" {
+		t.Fatalf("unexpected health identity %+v", health.Data)
+	}
+
+	svc, ok := agentMDNSService(GetCurrentConfig())
+	if !ok || svc.Instance != "store-12" {
+		t.Fatalf("unexpected service %+v", svc)
+	}
+	if want := []string{"name=store-12", "label.floor=2", "label.store=12"}; !reflect.DeepEqual([]string{svc.TXT[1], svc.TXT[3], svc.TXT[4]}, want) {
+		t.Fatalf("unexpected TXT %v", svc.TXT)
+	}
+}
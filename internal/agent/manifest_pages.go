@@ -0,0 +1,353 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// manifestNextCursorHeader carries the cursor of the next page when the
+// core returns a page as a plain JSON array.
+const manifestNextCursorHeader = "X-Next-Cursor"
+
+// maxManifestPages guards against a core that never stops paginating.
+const maxManifestPages = 100000
+
+// sniffManifestBody checks that a manifest body looks like JSON before it
+// is decoded, so an HTML error page from a proxy or a maintenance screen
+// is reported as such instead of as a JSON syntax error. Leading
+// whitespace and a byte order mark are skipped; contentType is only used
+// in the error message because cores and proxies label JSON
+// inconsistently.
+func sniffManifestBody(r io.Reader, contentType string) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	for {
+		c, _, err := br.ReadRune()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("manifest body is empty (Content-Type %q)", contentType)
+			}
+			return nil, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n', '\ufeff':
+			continue
+		case '[', '{':
+			if err := br.UnreadRune(); err != nil {
+				return nil, err
+			}
+			return br, nil
+		}
+		if err := br.UnreadRune(); err != nil {
+			return nil, err
+		}
+		snippet, _ := br.Peek(256)
+		return nil, fmt.Errorf("manifest is not JSON (Content-Type %q): %s", contentType, strings.TrimSpace(string(snippet)))
+	}
+}
+
+// manifestItemsKeys are the object keys that may hold the manifest items:
+// items in a page object, $values when the core serializes with reference
+// preservation and data in a response envelope. Keys match
+// case-insensitively.
+var manifestItemsKeys = []string{"items", "$values", "data"}
+
+// maxManifestNesting bounds how deep envelopes such as
+// {"data": {"items": [...]}} are unwrapped.
+const maxManifestNesting = 3
+
+// decodeManifestItems stream-decodes a manifest body and calls fn for each
+// item without holding the whole document in memory. Two shapes are
+// accepted: a bare JSON array, and an object holding the array under one
+// of manifestItemsKeys, optionally with "nextCursor"; the cursor is
+// returned for the latter. Unknown keys are skipped and items are decoded
+// leniently, see ManifestItem.UnmarshalJSON.
+func decodeManifestItems(r io.Reader, fn func(ManifestItem) error) (string, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return "", err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return "", fmt.Errorf("unexpected manifest token %v", tok)
+	}
+
+	switch delim {
+	case '[':
+		return "", decodeManifestArray(dec, fn)
+	case '{':
+		return decodeManifestObject(dec, fn, 0)
+	default:
+		return "", fmt.Errorf("unexpected manifest token %v", tok)
+	}
+}
+
+// decodeManifestObject decodes object members after the opening brace has
+// been consumed, including the closing brace, and returns the cursor.
+func decodeManifestObject(dec *json.Decoder, fn func(ManifestItem) error, depth int) (string, error) {
+	var next string
+	for dec.More() {
+		keyTok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+		key, _ := keyTok.(string)
+		switch {
+		case isManifestItemsKey(key):
+			tok, err := dec.Token()
+			if err != nil {
+				return "", err
+			}
+			if tok == nil {
+				continue
+			}
+			d, ok := tok.(json.Delim)
+			switch {
+			case ok && d == '[':
+				if err := decodeManifestArray(dec, fn); err != nil {
+					return "", err
+				}
+			case ok && d == '{' && strings.EqualFold(key, "data") && depth < maxManifestNesting:
+				nested, err := decodeManifestObject(dec, fn, depth+1)
+				if err != nil {
+					return "", err
+				}
+				if nested != "" {
+					next = nested
+				}
+			default:
+				return "", fmt.Errorf("manifest %s must be an array", key)
+			}
+		case strings.EqualFold(key, "nextCursor"):
+			var value *string
+			if err := dec.Decode(&value); err != nil {
+				return "", err
+			}
+			if value != nil {
+				next = *value
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return "", err
+			}
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return "", err
+	}
+	return next, nil
+}
+
+func isManifestItemsKey(key string) bool {
+	for _, k := range manifestItemsKeys {
+		if strings.EqualFold(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeManifestArray decodes array elements after the opening bracket
+// has been consumed, including the closing bracket.
+func decodeManifestArray(dec *json.Decoder, fn func(ManifestItem) error) error {
+	for i := 0; dec.More(); i++ {
+		var item ManifestItem
+		if err := dec.Decode(&item); err != nil {
+			return fmt.Errorf("manifest item %d: %w", i, err)
+		}
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// UnmarshalJSON decodes a manifest item leniently, so that compatible core
+// schema changes do not stop synchronization: unknown fields are ignored,
+// field names match case-insensitively, numbers may be sent as strings and
+// tags as a single string.
+func (m *ManifestItem) UnmarshalJSON(data []byte) error {
+	type plain ManifestItem
+	var raw struct {
+		plain
+		ID            lenientInt     `json:"id"`
+		FileSizeBytes lenientInt     `json:"fileSizeBytes"`
+		Priority      lenientInt     `json:"priority"`
+		Order         lenientInt     `json:"order"`
+		Tags          lenientStrings `json:"tags"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = ManifestItem(raw.plain)
+	m.ID = int64(raw.ID)
+	m.FileSizeBytes = int64(raw.FileSizeBytes)
+	m.Priority = int(raw.Priority)
+	m.Order = int(raw.Order)
+	m.Tags = []string(raw.Tags)
+	return nil
+}
+
+// lenientInt is an integer that may be encoded as a JSON number, a string
+// holding a number, or null. Integral floats such as 3.0 are accepted.
+type lenientInt int64
+
+func (n *lenientInt) UnmarshalJSON(data []byte) error {
+	s := strings.TrimSpace(string(data))
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = strings.TrimSpace(unquoted)
+		if s == "" {
+			*n = 0
+			return nil
+		}
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*n = lenientInt(v)
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f != math.Trunc(f) || math.Abs(f) > math.MaxInt64 {
+		return fmt.Errorf("invalid integer %s", string(data))
+	}
+	*n = lenientInt(f)
+	return nil
+}
+
+// lenientStrings is a string list that may also be encoded as a single
+// string, null, or a reference-preserving {"$values": [...]} wrapper.
+type lenientStrings []string
+
+func (l *lenientStrings) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		*l = list
+		return nil
+	}
+	var wrapped struct {
+		Values *[]string `json:"$values"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err == nil && wrapped.Values != nil {
+		*l = *wrapped.Values
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(data, &single); err != nil {
+		return fmt.Errorf("expected a string or a list of strings, got %s", string(data))
+	}
+	if single == "" {
+		*l = nil
+	} else {
+		*l = []string{single}
+	}
+	return nil
+}
+
+// fetchManifestPage requests one manifest page. Validators are only sent
+// with the first page (empty cursor), so a 304 skips the whole pass.
+func fetchManifestPage(ctx context.Context, config Config, cursor string, previous manifestValidators) ([]ManifestItem, string, manifestValidators, error) {
+	query := syncTagsQuery(config)
+	query.Set("limit", strconv.Itoa(config.Sync.ManifestPageSize))
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.CoreAPIBase+"/api/devicesync?"+query.Encode(), nil)
+	if err != nil {
+		return nil, "", manifestValidators{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Device-Id", config.ServerKey)
+	req.Header.Set(hashAlgorithmsHeader, strings.Join(supportedHashAlgorithms, ", "))
+	if cursor == "" {
+		if previous.ETag != "" {
+			req.Header.Set("If-None-Match", previous.ETag)
+		}
+		if previous.LastModified != "" {
+			req.Header.Set("If-Modified-Since", previous.LastModified)
+		}
+	}
+
+	resp, err := getCoreClient().Do(ctx, req, manifestTimeout())
+	if err != nil {
+		return nil, "", manifestValidators{}, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotModified && cursor == "" {
+		return nil, "", previous, errManifestNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, "", manifestValidators{}, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+
+	items := make([]ManifestItem, 0, config.Sync.ManifestPageSize)
+	body, err := sniffManifestBody(resp.Body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, "", manifestValidators{}, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	next, err := decodeManifestItems(body, func(item ManifestItem) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, "", manifestValidators{}, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if next == "" {
+		next = resp.Header.Get(manifestNextCursorHeader)
+	}
+
+	return items, next, manifestValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ForceDelete:  forceDeleteRequested(resp),
+	}, nil
+}
+
+// fetchPagedManifest fetches the manifest page by page and passes each page
+// to apply before requesting the next one, so memory use is bounded by the
+// page size. The response body is closed before apply runs.
+func fetchPagedManifest(ctx context.Context, config Config, previous manifestValidators, apply func([]ManifestItem) error) (manifestValidators, error) {
+	var validators manifestValidators
+	cursor := ""
+	for page := 0; ; page++ {
+		if page >= maxManifestPages {
+			return manifestValidators{}, fmt.Errorf("manifest exceeds %d pages", maxManifestPages)
+		}
+		items, next, pageValidators, err := fetchManifestPage(ctx, config, cursor, previous)
+		if err != nil {
+			return pageValidators, err
+		}
+		if page == 0 {
+			validators = pageValidators
+		}
+		validators.ForceDelete = validators.ForceDelete || pageValidators.ForceDelete
+		log.Printf("Manifest page %d fetched: %d items", page+1, len(items))
+
+		if err := apply(items); err != nil {
+			return manifestValidators{}, err
+		}
+		if next == "" {
+			return validators, nil
+		}
+		if next == cursor {
+			return manifestValidators{}, errors.New("manifest cursor did not advance")
+		}
+		cursor = next
+	}
+}
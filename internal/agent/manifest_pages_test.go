@@ -0,0 +1,214 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDecodeManifestItemsAcceptsArrayAndPageObject(t *testing.T) {
+	var ids []int64
+	collect := func(item ManifestItem) error {
+		ids = append(ids, item.ID)
+		return nil
+	}
+
+	next, err := decodeManifestItems(strings.NewReader(`[{"id":1},{"id":2}]`), collect)
+	if err != nil || next != "" {
+		t.Fatalf("array: next=%q err=%v", next, err)
+	}
+	next, err = decodeManifestItems(strings.NewReader(`{"total":5,"items":[{"id":3}],"nextCursor":"abc"}`), collect)
+	if err != nil || next != "abc" {
+		t.Fatalf("object: next=%q err=%v", next, err)
+	}
+	next, err = decodeManifestItems(strings.NewReader(`{"items":[],"nextCursor":null}`), collect)
+	if err != nil || next != "" {
+		t.Fatalf("last page: next=%q err=%v", next, err)
+	}
+	if len(ids) != 3 || ids[2] != 3 {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+
+	for _, bad := range []string{`"x"`, `{"items":{}}`, `[{"id":1}`} {
+		if _, err := decodeManifestItems(strings.NewReader(bad), collect); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+}
+
+// pagedManifestServer serves two manifest pages and file downloads. When
+// failSecond is set the second page fails.
+func pagedManifestServer(t *testing.T, failSecond bool) *httptest.Server {
+	t.Helper()
+	files := map[string]string{"1": "one", "2": "two"}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/devicesync":
+			if r.URL.Query().Get("limit") != "1" {
+				t.Errorf("unexpected limit %q", r.URL.Query().Get("limit"))
+			}
+			switch r.URL.Query().Get("cursor") {
+			case "":
+				w.Header().Set(manifestNextCursorHeader, "page2")
+				_ = json.NewEncoder(w).Encode(Manifest{{ID: 1, Filename: "one.mp4", FileSizeBytes: 3, SHA256: sha256Hex("one")}})
+			case "page2":
+				if failSecond {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"items": Manifest{{ID: 2, Filename: "two.mp4", FileSizeBytes: 3, SHA256: sha256Hex("two")}},
+				})
+			}
+		default:
+			_, _ = w.Write([]byte(files[strings.TrimPrefix(r.URL.Path, "/api/devicesync/")]))
+		}
+	}))
+}
+
+func TestSyncPagedManifestAppliesAllPagesBeforeGC(t *testing.T) {
+	server := pagedManifestServer(t, false)
+	defer server.Close()
+
+	mediaDir := t.TempDir()
+	stale := filepath.Join(mediaDir, "stale.mp4")
+	_ = os.WriteFile(stale, []byte("old"), 0644)
+
+	config := Config{CoreAPIBase: server.URL, ServerKey: "key", Playlist: PlaylistConfig{Destination: mediaDir}, Sync: SyncConfig{ManifestPageSize: 1}}
+	total, _, err := syncFromSource(context.Background(), config, coreSyncSource{config: config}, manifestValidators{})
+	if err != nil {
+		t.Fatalf("syncFromSource() error = %v", err)
+	}
+	if total != 2 {
+		t.Errorf("total = %d, want 2", total)
+	}
+	for _, name := range []string{"one.mp4", "two.mp4"} {
+		if _, err := os.Stat(filepath.Join(mediaDir, name)); err != nil {
+			t.Errorf("expected %s to be synced: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected stale file collected, stat err = %v", err)
+	}
+}
+
+func TestSyncPagedManifestSkipsGCWhenPageFails(t *testing.T) {
+	server := pagedManifestServer(t, true)
+	defer server.Close()
+
+	mediaDir := t.TempDir()
+	keep := filepath.Join(mediaDir, "two.mp4")
+	_ = os.WriteFile(keep, []byte("two"), 0644)
+
+	config := Config{CoreAPIBase: server.URL, ServerKey: "key", Playlist: PlaylistConfig{Destination: mediaDir}, Sync: SyncConfig{ManifestPageSize: 1}}
+	if _, _, err := syncFromSource(context.Background(), config, coreSyncSource{config: config}, manifestValidators{}); err == nil {
+		t.Fatal("expected error for failing page")
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Fatalf("incomplete manifest must not garbage collect files: %v", err)
+	}
+}
+
+func TestPerformSyncUsesPagedManifestWhenConfigured(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Query().Get("limit") == "" {
+			t.Errorf("expected paginated request, got %s", r.URL.String())
+		}
+		_, _ = w.Write([]byte(`{"items":[]}`))
+	}))
+	defer server.Close()
+
+	setCurrentConfigForTest(t, Config{CoreAPIBase: server.URL, ServerKey: "key", Playlist: PlaylistConfig{Destination: t.TempDir()}, Sync: SyncConfig{ManifestPageSize: 500, ReportDisabled: true}})
+	if err := PerformSync(context.Background()); err != nil {
+		t.Fatalf("PerformSync() error = %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Fatalf("expected a single page request, got %d", requests)
+	}
+}
+
+// TestRecordedCoreManifests decodes recorded /api/devicesync responses of
+// past and possible future core versions through both manifest fetchers.
+func TestRecordedCoreManifests(t *testing.T) {
+	want := Manifest{
+		{ID: 101, Filename: "promo.mp4", FileSizeBytes: 5, SHA256: sha256Hex("promo")},
+		{ID: 102, Filename: "menu/winter.mp4", FileSizeBytes: 4, SHA256: sha256Hex("menu"), Priority: 10, Tags: []string{"lobby"}},
+	}
+	tests := []struct {
+		file        string
+		contentType string
+		wantErr     string
+	}{
+		{file: "devicesync-array.json", contentType: "application/json; charset=utf-8"},
+		{file: "devicesync-page.json", contentType: "application/json"},
+		{file: "devicesync-preserve.json", contentType: "application/json; charset=utf-8"},
+		{file: "devicesync-pascal.json", contentType: "text/plain"},
+		{file: "devicesync-error.html", contentType: "text/html", wantErr: "manifest is not JSON"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", "core", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				_, _ = w.Write(body)
+			}))
+			defer server.Close()
+			config := Config{CoreAPIBase: server.URL, ServerKey: "key"}
+
+			manifest, _, err := fetchManifestConditional(context.Background(), config, manifestValidators{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), "502 Bad Gateway") {
+					t.Fatalf("expected %q error, got %v", tt.wantErr, err)
+				}
+			} else if err != nil || !reflect.DeepEqual(*manifest, want) {
+				t.Fatalf("fetchManifestConditional = %+v, %v", manifest, err)
+			}
+
+			config.Sync.ManifestPageSize = 10
+			items, next, _, err := fetchManifestPage(context.Background(), config, "", manifestValidators{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected %q error, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil || next != "" || !reflect.DeepEqual(Manifest(items), want) {
+				t.Fatalf("fetchManifestPage = %+v, %q, %v", items, next, err)
+			}
+		})
+	}
+}
+
+func TestManifestItemUnmarshalLenient(t *testing.T) {
+	var item ManifestItem
+	if err := json.Unmarshal([]byte(`{"id":" 7 ","fileSizeBytes":"","order":2.0,"tags":"","extra":{"a":[1]}}`), &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != 7 || item.FileSizeBytes != 0 || item.Order != 2 || item.Tags != nil {
+		t.Fatalf("unexpected item %+v", item)
+	}
+	for _, bad := range []string{`{"id":"abc"}`, `{"id":1.5}`, `{"tags":[1]}`, `{"filename":3}`} {
+		if err := json.Unmarshal([]byte(bad), &item); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+	_, err := decodeManifestItems(strings.NewReader(`[{"id":1},{"id":"x"}]`), func(ManifestItem) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "manifest item 1") {
+		t.Fatalf("expected item index in error, got %v", err)
+	}
+}
@@ -0,0 +1,460 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// mdnsGroupAddr is the IPv4 multicast group and port used by mDNS.
+var mdnsGroupAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsUnicastResponseBit is set in a question's class to request a unicast reply.
+const mdnsUnicastResponseBit = 1 << 15
+
+// mdnsRecordTTL is the TTL announced for all records, in seconds.
+const mdnsRecordTTL = 120
+
+// agentMDNSServiceType is the DNS-SD service type under which the agent
+// advertises its API for discovery and installer tools.
+const agentMDNSServiceType = "_mediapi._tcp"
+
+// DiscoveryConfig controls the mDNS advertisement of the agent API.
+type DiscoveryConfig struct {
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+// mdnsService describes one DNS-SD service instance advertised by the agent.
+type mdnsService struct {
+	Instance string   // instance label, e.g. device id
+	Service  string   // service type, e.g. "_mediapi._tcp"
+	Port     int      // port of the service
+	TXT      []string // key=value TXT entries
+}
+
+// mdnsPeer is a service instance discovered on the LAN.
+type mdnsPeer struct {
+	Instance string
+	Addr     string // host:port
+	TXT      map[string]string
+}
+
+var (
+	// mdnsServicesFunc returns the services currently advertised. It is
+	// evaluated for every query so config reloads take effect immediately.
+	mdnsServicesFunc = advertisedMDNSServices
+
+	mdnsResponderLock   sync.Mutex
+	mdnsResponderCancel context.CancelFunc
+)
+
+// advertisedMDNSServices collects the services enabled in the current config.
+func advertisedMDNSServices() []mdnsService {
+	var services []mdnsService
+	config := GetCurrentConfig()
+	if svc, ok := agentMDNSService(config); ok {
+		services = append(services, svc)
+	}
+	if svc, ok := peerMDNSService(config); ok {
+		services = append(services, svc)
+	}
+	if svc, ok := syncPlayMDNSService(config); ok {
+		services = append(services, svc)
+	}
+	return services
+}
+
+// agentMDNSService advertises the agent API under the device name so
+// devices can be found on the LAN before they are registered with the core.
+func agentMDNSService(config Config) (mdnsService, bool) {
+	if config.Discovery.Disabled {
+		return mdnsService{}, false
+	}
+	port, ok := listenPort(config.ListenAddr)
+	if !ok {
+		return mdnsService{}, false
+	}
+	name := deviceName(config)
+	txt := []string{"id=" + deviceInstanceID(config), "name=" + name, "version=" + GetVersion()}
+	return mdnsService{
+		Instance: name,
+		Service:  agentMDNSServiceType,
+		Port:     port,
+		TXT:      append(txt, labelTXTRecords(config.Labels)...),
+	}, true
+}
+
+// StartMDNSResponder starts answering mDNS queries for the agent's services
+// on the IPv4 multicast group. Calling it again restarts the responder.
+func StartMDNSResponder() error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroupAddr)
+	if err != nil {
+		return fmt.Errorf("listen for mDNS: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mdnsResponderLock.Lock()
+	if mdnsResponderCancel != nil {
+		mdnsResponderCancel()
+	}
+	mdnsResponderCancel = cancel
+	mdnsResponderLock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	go serveMDNS(ctx, conn)
+	return nil
+}
+
+// StopMDNSResponder stops a running mDNS responder.
+func StopMDNSResponder() {
+	mdnsResponderLock.Lock()
+	defer mdnsResponderLock.Unlock()
+	if mdnsResponderCancel != nil {
+		mdnsResponderCancel()
+		mdnsResponderCancel = nil
+	}
+}
+
+func serveMDNS(ctx context.Context, conn *net.UDPConn) {
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Warning: mDNS responder stopped: %v", err)
+			}
+			return
+		}
+
+		reply, unicast, ok := buildMDNSReply(buf[:n], mdnsServicesFunc(), localIPv4Addrs())
+		if !ok {
+			continue
+		}
+		dest := mdnsGroupAddr
+		if unicast || src.Port != mdnsGroupAddr.Port {
+			dest = src
+		}
+		if _, err := conn.WriteToUDP(reply, dest); err != nil {
+			log.Printf("Warning: failed to send mDNS reply: %v", err)
+		}
+	}
+}
+
+// buildMDNSReply parses a query and returns a response covering every
+// question that matches one of services. unicast reports whether the
+// querier asked for a unicast response.
+func buildMDNSReply(query []byte, services []mdnsService, ips []net.IP) ([]byte, bool, bool) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil || header.Response {
+		return nil, false, false
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return nil, false, false
+	}
+
+	host := mdnsHostName()
+	var matched []mdnsService
+	unicast := false
+	for _, q := range questions {
+		name := strings.ToLower(q.Name.String())
+		for _, svc := range services {
+			if name == strings.ToLower(mdnsServiceName(svc.Service)) || name == strings.ToLower(mdnsInstanceName(svc)) {
+				if q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL {
+					matched = append(matched, svc)
+					if uint16(q.Class)&mdnsUnicastResponseBit != 0 {
+						unicast = true
+					}
+				}
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return nil, false, false
+	}
+
+	reply, err := encodeMDNSResponse(matched, host, ips)
+	if err != nil {
+		log.Printf("Warning: failed to encode mDNS reply: %v", err)
+		return nil, false, false
+	}
+	return reply, unicast, true
+}
+
+func encodeMDNSResponse(services []mdnsService, host string, ips []net.IP) ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{Response: true, Authoritative: true})
+	builder.EnableCompression()
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	hostName, err := dnsmessage.NewName(host)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, svc := range services {
+		serviceName, err := dnsmessage.NewName(mdnsServiceName(svc.Service))
+		if err != nil {
+			return nil, err
+		}
+		instanceName, err := dnsmessage.NewName(mdnsInstanceName(svc))
+		if err != nil {
+			return nil, err
+		}
+		if err := builder.PTRResource(mdnsHeader(serviceName), dnsmessage.PTRResource{PTR: instanceName}); err != nil {
+			return nil, err
+		}
+		if err := builder.SRVResource(mdnsHeader(instanceName), dnsmessage.SRVResource{Target: hostName, Port: uint16(svc.Port)}); err != nil {
+			return nil, err
+		}
+		txt := svc.TXT
+		if len(txt) == 0 {
+			txt = []string{""}
+		}
+		if err := builder.TXTResource(mdnsHeader(instanceName), dnsmessage.TXTResource{TXT: txt}); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ip := range ips {
+		ip4 := ip.To4()
+		if ip4 == nil {
+			continue
+		}
+		var a [4]byte
+		copy(a[:], ip4)
+		if err := builder.AResource(mdnsHeader(hostName), dnsmessage.AResource{A: a}); err != nil {
+			return nil, err
+		}
+	}
+
+	return builder.Finish()
+}
+
+func mdnsHeader(name dnsmessage.Name) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: mdnsRecordTTL}
+}
+
+func mdnsServiceName(service string) string {
+	return strings.TrimSuffix(service, ".") + ".local."
+}
+
+func mdnsInstanceName(svc mdnsService) string {
+	return mdnsLabel(svc.Instance) + "." + mdnsServiceName(svc.Service)
+}
+
+// mdnsLabel makes s usable as a single DNS label.
+func mdnsLabel(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '.' || r < 32 {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(s))
+	if len(s) > 63 {
+		// Drop a multi-byte character cut in half.
+		s = strings.ToValidUTF8(s[:63], "")
+	}
+	if s == "" {
+		s = "media-pi"
+	}
+	return s
+}
+
+// mdnsDeviceName returns the short host name used as the device name.
+func mdnsDeviceName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "media-pi"
+	}
+	return mdnsLabel(strings.Split(host, ".")[0])
+}
+
+func mdnsHostName() string {
+	return mdnsDeviceName() + ".local."
+}
+
+func localIPv4Addrs() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
+			continue
+		}
+		ips = append(ips, ipNet.IP.To4())
+	}
+	return ips
+}
+
+// browseMDNS sends a PTR query for service and collects the instances that
+// answer before timeout expires.
+func browseMDNS(ctx context.Context, service string, timeout time.Duration) ([]mdnsPeer, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("open mDNS query socket: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	query, err := encodeMDNSQuery(service)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(query, mdnsGroupAddr); err != nil {
+		return nil, fmt.Errorf("send mDNS query: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetReadDeadline(deadline)
+
+	peers := make(map[string]mdnsPeer)
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		for _, peer := range parseMDNSResponse(buf[:n], service, src.IP) {
+			peers[peer.Instance] = peer
+		}
+	}
+
+	result := make([]mdnsPeer, 0, len(peers))
+	for _, peer := range peers {
+		result = append(result, peer)
+	}
+	return result, nil
+}
+
+func encodeMDNSQuery(service string) ([]byte, error) {
+	name, err := dnsmessage.NewName(mdnsServiceName(service))
+	if err != nil {
+		return nil, err
+	}
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(dnsmessage.Question{
+		Name:  name,
+		Type:  dnsmessage.TypePTR,
+		Class: dnsmessage.ClassINET | mdnsUnicastResponseBit,
+	}); err != nil {
+		return nil, err
+	}
+	return builder.Finish()
+}
+
+// parseMDNSResponse extracts service instances from a response. The sender
+// address is used as the peer host; A records are only a fallback because
+// multi-homed devices may list addresses unreachable from here.
+func parseMDNSResponse(packet []byte, service string, src net.IP) []mdnsPeer {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(packet)
+	if err != nil || !header.Response {
+		return nil
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return nil
+	}
+
+	suffix := strings.ToLower("." + mdnsServiceName(service))
+	ports := make(map[string]uint16)
+	txts := make(map[string]map[string]string)
+	var hostIP net.IP
+
+	for {
+		res, err := parser.Answer()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			if parser.SkipAllAuthorities() != nil {
+				break
+			}
+			res, err = parser.Additional()
+			if err != nil {
+				break
+			}
+			collectMDNSResource(res, suffix, ports, txts, &hostIP)
+			for {
+				res, err = parser.Additional()
+				if err != nil {
+					break
+				}
+				collectMDNSResource(res, suffix, ports, txts, &hostIP)
+			}
+			break
+		}
+		if err != nil {
+			break
+		}
+		collectMDNSResource(res, suffix, ports, txts, &hostIP)
+	}
+
+	ip := src
+	if ip == nil || ip.IsUnspecified() {
+		ip = hostIP
+	}
+	if ip == nil {
+		return nil
+	}
+
+	peers := make([]mdnsPeer, 0, len(ports))
+	for instance, port := range ports {
+		peers = append(peers, mdnsPeer{
+			Instance: instance,
+			Addr:     net.JoinHostPort(ip.String(), fmt.Sprintf("%d", port)),
+			TXT:      txts[instance],
+		})
+	}
+	return peers
+}
+
+func collectMDNSResource(res dnsmessage.Resource, suffix string, ports map[string]uint16, txts map[string]map[string]string, hostIP *net.IP) {
+	name := strings.ToLower(res.Header.Name.String())
+	switch body := res.Body.(type) {
+	case *dnsmessage.SRVResource:
+		if instance, ok := strings.CutSuffix(name, suffix); ok {
+			ports[instance] = body.Port
+		}
+	case *dnsmessage.TXTResource:
+		if instance, ok := strings.CutSuffix(name, suffix); ok {
+			values := make(map[string]string, len(body.TXT))
+			for _, entry := range body.TXT {
+				key, value, _ := strings.Cut(entry, "=")
+				if key != "" {
+					values[key] = value
+				}
+			}
+			txts[instance] = values
+		}
+	case *dnsmessage.AResource:
+		if *hostIP == nil {
+			*hostIP = net.IP(body.A[:])
+		}
+	}
+}
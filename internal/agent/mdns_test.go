@@ -0,0 +1,96 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMDNSReplyRoundTrip(t *testing.T) {
+	svc := mdnsService{Instance: "abc123", Service: peerMDNSServiceType, Port: 8081, TXT: []string{"id=abc123", "version=1.0"}}
+
+	query, err := encodeMDNSQuery(peerMDNSServiceType)
+	if err != nil {
+		t.Fatalf("encodeMDNSQuery() error = %v", err)
+	}
+	reply, unicast, ok := buildMDNSReply(query, []mdnsService{svc}, []net.IP{net.IPv4(192, 168, 1, 20)})
+	if !ok {
+		t.Fatal("expected reply for matching query")
+	}
+	if !unicast {
+		t.Error("expected unicast reply for QU question")
+	}
+
+	peers := parseMDNSResponse(reply, peerMDNSServiceType, net.IPv4(10, 0, 0, 5))
+	if len(peers) != 1 {
+		t.Fatalf("expected one peer, got %v", peers)
+	}
+	if peers[0].Instance != "abc123" || peers[0].Addr != "10.0.0.5:8081" {
+		t.Errorf("unexpected peer %+v", peers[0])
+	}
+	if peers[0].TXT["id"] != "abc123" || peers[0].TXT["version"] != "1.0" {
+		t.Errorf("unexpected TXT %v", peers[0].TXT)
+	}
+
+	// Without a sender address the advertised A record is used.
+	peers = parseMDNSResponse(reply, peerMDNSServiceType, nil)
+	if len(peers) != 1 || peers[0].Addr != "192.168.1.20:8081" {
+		t.Errorf("expected A record fallback, got %v", peers)
+	}
+}
+
+func TestMDNSReplyIgnoresOtherServices(t *testing.T) {
+	svc := mdnsService{Instance: "abc123", Service: peerMDNSServiceType, Port: 8081}
+	query, err := encodeMDNSQuery("_http._tcp")
+	if err != nil {
+		t.Fatalf("encodeMDNSQuery() error = %v", err)
+	}
+	if _, _, ok := buildMDNSReply(query, []mdnsService{svc}, nil); ok {
+		t.Error("expected no reply for unrelated service")
+	}
+	if _, _, ok := buildMDNSReply([]byte("garbage"), []mdnsService{svc}, nil); ok {
+		t.Error("expected no reply for malformed packet")
+	}
+}
+
+func TestMDNSLabel(t *testing.T) {
+	if got := mdnsLabel("a.b c"); got != "a-b c" {
+		t.Errorf("mdnsLabel() = %q", got)
+	}
+	if got := mdnsLabel("  "); got != "media-pi" {
+		t.Errorf("mdnsLabel(empty) = %q", got)
+	}
+}
+
+func TestAdvertisedMDNSServicesIncludesAgent(t *testing.T) {
+	setCurrentConfigForTest(t, Config{ServerKey: "key", ListenAddr: "0.0.0.0:8081"})
+	services := advertisedMDNSServices()
+	if len(services) != 1 || services[0].Service != agentMDNSServiceType || services[0].Instance != mdnsDeviceName() {
+		t.Fatalf("unexpected services %+v", services)
+	}
+
+	query, err := encodeMDNSQuery(agentMDNSServiceType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, _, ok := buildMDNSReply(query, services, nil)
+	if !ok {
+		t.Fatal("expected reply for _mediapi._tcp")
+	}
+	found := parseMDNSResponse(reply, agentMDNSServiceType, net.IPv4(10, 0, 0, 5))
+	if len(found) != 1 || found[0].Addr != "10.0.0.5:8081" {
+		t.Fatalf("unexpected discovery result %v", found)
+	}
+	txt := found[0].TXT
+	if txt["name"] != mdnsDeviceName() || txt["version"] != GetVersion() || txt["id"] != deviceInstanceID(Config{ServerKey: "key"}) {
+		t.Errorf("unexpected TXT %v", txt)
+	}
+
+	setCurrentConfigForTest(t, Config{ServerKey: "key", Discovery: DiscoveryConfig{Disabled: true}, Peer: PeerConfig{Enabled: true}})
+	services = advertisedMDNSServices()
+	if len(services) != 1 || services[0].Service != peerMDNSServiceType {
+		t.Fatalf("expected only the peer service with discovery disabled, got %+v", services)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// manifestIndexFilePath persists which manifest item each media file
+// belongs to, for the file browser.
+var manifestIndexFilePath = filepath.Join(agentStateDir, "manifest-index.json")
+
+// ManifestFileRef links a media file to the manifest item it was synced
+// for.
+type ManifestFileRef struct {
+	ID            int64    `json:"id"`
+	Filename      string   `json:"filename"`
+	Type          string   `json:"type"`
+	FileSizeBytes int64    `json:"fileSizeBytes"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+var (
+	// manifestIndex maps media file paths to their item of the last
+	// applied manifest.
+	manifestIndex     = map[string]ManifestFileRef{}
+	manifestIndexLock sync.Mutex
+)
+
+// setManifestIndex replaces the manifest index with the admitted items of
+// a finished sync and persists it.
+func setManifestIndex(items map[string]ManifestItem) {
+	index := make(map[string]ManifestFileRef, len(items))
+	for path, item := range items {
+		index[path] = ManifestFileRef{ID: item.ID, Filename: item.Filename, Type: mediaKindOf(item), FileSizeBytes: item.FileSizeBytes, Tags: item.Tags}
+	}
+	manifestIndexLock.Lock()
+	manifestIndex = index
+	manifestIndexLock.Unlock()
+	if err := writeStateFile(manifestIndexFilePath, index); err != nil {
+		log.Printf("Warning: Failed to persist manifest index: %v", err)
+	}
+}
+
+func loadManifestIndex() {
+	var index map[string]ManifestFileRef
+	switch err := readStateFile(manifestIndexFilePath, &index); {
+	case err == nil:
+		if index == nil {
+			index = map[string]ManifestFileRef{}
+		}
+		manifestIndexLock.Lock()
+		manifestIndex = index
+		manifestIndexLock.Unlock()
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("Warning: ignoring manifest index: %v", err)
+	}
+}
+
+// MediaFileEntry is one file or directory of the media directory tree.
+type MediaFileEntry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Dir     bool      `json:"dir,omitempty"`
+	Symlink bool      `json:"symlink,omitempty"`
+	Size    int64     `json:"size"`
+	Files   int       `json:"files,omitempty"`
+	ModTime time.Time `json:"modTime"`
+	// Hash is the digest recorded when the file was last verified against
+	// the manifest; HashCurrent is unset when the file changed since.
+	HashAlgorithm string     `json:"hashAlgorithm,omitempty"`
+	Hash          string     `json:"hash,omitempty"`
+	VerifiedAt    *time.Time `json:"verifiedAt,omitempty"`
+	HashCurrent   bool       `json:"hashCurrent,omitempty"`
+	// Manifest is the item of the last applied manifest the file belongs
+	// to; files without one are removed by the next sync.
+	Manifest *ManifestFileRef `json:"manifest,omitempty"`
+}
+
+// MediaBrowseResponse is returned by GET /api/media/files.
+type MediaBrowseResponse struct {
+	Path    string           `json:"path,omitempty"`
+	Entries []MediaFileEntry `json:"entries"`
+	// Missing lists manifest items of this directory that are not on disk.
+	Missing []ManifestFileRef `json:"missing,omitempty"`
+}
+
+// errMediaPathNotAllowed is returned for paths outside the media
+// directories.
+var errMediaPathNotAllowed = errors.New("path is outside the media directories")
+
+// resolveBrowsePath checks that path lies in one of the media directories,
+// also after resolving symlinks.
+func resolveBrowsePath(config Config, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", errMediaPathNotAllowed
+	}
+	path = filepath.Clean(path)
+	roots := mediaDirs(config)
+	if !slices.ContainsFunc(roots, func(root string) bool { return pathWithin(path, root) }) {
+		return "", errMediaPathNotAllowed
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range roots {
+		if resolvedRoot, err := filepath.EvalSymlinks(root); err == nil && pathWithin(resolved, resolvedRoot) {
+			return path, nil
+		}
+	}
+	return "", errMediaPathNotAllowed
+}
+
+// mediaFileEntry describes path for the file browser.
+func mediaFileEntry(path string, info fs.FileInfo) MediaFileEntry {
+	entry := MediaFileEntry{
+		Name:    info.Name(),
+		Path:    path,
+		Dir:     info.IsDir(),
+		Symlink: info.Mode()&fs.ModeSymlink != 0,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UTC(),
+	}
+	if entry.Dir {
+		entry.Size = 0
+		// Sizes of directories are the sum of their files; symlinks are
+		// not followed.
+		_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || d.Type()&fs.ModeSymlink != 0 {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				entry.Size += info.Size()
+				entry.Files++
+			}
+			return nil
+		})
+		return entry
+	}
+
+	verifyCacheLock.Lock()
+	cached, ok := verifyCache[path]
+	verifyCacheLock.Unlock()
+	if ok {
+		verifiedAt := cached.VerifiedAt.UTC()
+		entry.HashAlgorithm, entry.Hash, entry.VerifiedAt = cached.Algorithm, cached.Hash, &verifiedAt
+		entry.HashCurrent = cached.Size == info.Size() && cached.ModTime.Equal(info.ModTime())
+	}
+	manifestIndexLock.Lock()
+	if ref, ok := manifestIndex[path]; ok {
+		entry.Manifest = &ref
+	}
+	manifestIndexLock.Unlock()
+	return entry
+}
+
+// browseMediaDir lists a media directory; an empty path lists the media
+// directories themselves.
+func browseMediaDir(config Config, path string) (MediaBrowseResponse, error) {
+	if path == "" {
+		response := MediaBrowseResponse{Entries: []MediaFileEntry{}}
+		for _, root := range mediaDirs(config) {
+			info, err := os.Stat(root)
+			if err != nil {
+				continue
+			}
+			entry := mediaFileEntry(root, info)
+			entry.Name = root
+			response.Entries = append(response.Entries, entry)
+		}
+		return response, nil
+	}
+
+	path, err := resolveBrowsePath(config, path)
+	if err != nil {
+		return MediaBrowseResponse{}, err
+	}
+	dirEntries, err := os.ReadDir(path)
+	if err != nil {
+		return MediaBrowseResponse{}, err
+	}
+	response := MediaBrowseResponse{Path: path, Entries: make([]MediaFileEntry, 0, len(dirEntries))}
+	present := make(map[string]bool, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		child := filepath.Join(path, dirEntry.Name())
+		present[child] = true
+		response.Entries = append(response.Entries, mediaFileEntry(child, info))
+	}
+
+	manifestIndexLock.Lock()
+	for file, ref := range manifestIndex {
+		if filepath.Dir(file) == path && !present[file] {
+			response.Missing = append(response.Missing, ref)
+		}
+	}
+	manifestIndexLock.Unlock()
+	sort.Slice(response.Missing, func(i, j int) bool { return response.Missing[i].Filename < response.Missing[j].Filename })
+	return response, nil
+}
+
+// HandleMediaFiles lists the media directory tree with sizes, cached
+// hashes and manifest linkage. The path query parameter selects the
+// directory; without it the media directories are listed.
+func HandleMediaFiles(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	response, err := browseMediaDir(GetCurrentConfig(), r.URL.Query().Get("path"))
+	switch {
+	case errors.Is(err, errMediaPathNotAllowed):
+		JSONResponse(w, http.StatusForbidden, APIResponse{OK: false, ErrMsg: "Путь вне каталогов медиафайлов"})
+	case errors.Is(err, fs.ErrNotExist):
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Файл не найден"})
+	case err != nil:
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось прочитать каталог: %v", err)})
+	default:
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: response})
+	}
+}
+
+// HandleMediaFileDownload sends one regular file of the media directories.
+// Range requests are supported, so large videos can be fetched in parts.
+func HandleMediaFileDownload(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	path, err := resolveBrowsePath(GetCurrentConfig(), r.URL.Query().Get("path"))
+	switch {
+	case errors.Is(err, errMediaPathNotAllowed):
+		JSONResponse(w, http.StatusForbidden, APIResponse{OK: false, ErrMsg: "Путь вне каталогов медиафайлов"})
+		return
+	case err != nil:
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Файл не найден"})
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Файл не найден"})
+		return
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Можно скачать только обычный файл"})
+		return
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()}))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
@@ -0,0 +1,155 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setManifestIndexForTest(t *testing.T) {
+	t.Helper()
+	original, originalPath := manifestIndex, manifestIndexFilePath
+	manifestIndexFilePath = filepath.Join(t.TempDir(), "manifest-index.json")
+	t.Cleanup(func() {
+		manifestIndexLock.Lock()
+		manifestIndex = original
+		manifestIndexLock.Unlock()
+		manifestIndexFilePath = originalPath
+	})
+}
+
+func TestBrowseMediaDir(t *testing.T) {
+	setManifestIndexForTest(t)
+	mediaDir := t.TempDir()
+	config := Config{Playlist: PlaylistConfig{Destination: mediaDir}}
+	setCurrentConfigForTest(t, config)
+
+	clip := filepath.Join(mediaDir, "clip.mp4")
+	if err := os.WriteFile(clip, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(mediaDir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mediaDir, "sub", "a.jpg"), []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(clip)
+	verifyCacheLock.Lock()
+	originalCache := verifyCache
+	verifyCache = map[string]verifyCacheEntry{clip: {Size: info.Size(), ModTime: info.ModTime(), Algorithm: "sha256", Hash: "abc123", VerifiedAt: time.Now()}}
+	verifyCacheLock.Unlock()
+	t.Cleanup(func() {
+		verifyCacheLock.Lock()
+		verifyCache = originalCache
+		verifyCacheLock.Unlock()
+	})
+	setManifestIndex(map[string]ManifestItem{
+		clip:                                {ID: 1, Filename: "clip.mp4", FileSizeBytes: 5},
+		filepath.Join(mediaDir, "gone.mp4"): {ID: 2, Filename: "gone.mp4"},
+	})
+
+	w := httptest.NewRecorder()
+	HandleMediaFiles(w, httptest.NewRequest(http.MethodGet, "/api/media/files?path="+url.QueryEscape(mediaDir), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data MediaBrowseResponse `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string]MediaFileEntry{}
+	for _, entry := range resp.Data.Entries {
+		entries[entry.Name] = entry
+	}
+	if e := entries["clip.mp4"]; e.Hash != "abc123" || !e.HashCurrent || e.Manifest == nil || e.Manifest.ID != 1 || e.Manifest.Type != mediaKindVideo {
+		t.Fatalf("unexpected file entry %+v", e)
+	}
+	if e := entries["sub"]; !e.Dir || e.Size != 3 || e.Files != 1 {
+		t.Fatalf("unexpected directory entry %+v", e)
+	}
+	if len(resp.Data.Missing) != 1 || resp.Data.Missing[0].ID != 2 {
+		t.Fatalf("missing = %+v", resp.Data.Missing)
+	}
+
+	// A touched file no longer matches its cached hash.
+	later := info.ModTime().Add(time.Minute)
+	if err := os.Chtimes(clip, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if e := mediaFileEntry(clip, mustStat(t, clip)); e.HashCurrent {
+		t.Fatal("expected a modified file to have a stale hash")
+	}
+
+	manifestIndexLock.Lock()
+	manifestIndex = nil
+	manifestIndexLock.Unlock()
+	loadManifestIndex()
+	if manifestIndex[clip].ID != 1 {
+		t.Fatalf("manifest index was not persisted: %+v", manifestIndex)
+	}
+}
+
+func TestMediaBrowserRejectsPathsOutsideMediaDirs(t *testing.T) {
+	mediaDir := t.TempDir()
+	outside := t.TempDir()
+	setCurrentConfigForTest(t, Config{Playlist: PlaylistConfig{Destination: mediaDir}})
+	if err := os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(mediaDir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{outside, "relative", filepath.Join(mediaDir, ".."), filepath.Join(mediaDir, "escape")} {
+		w := httptest.NewRecorder()
+		HandleMediaFiles(w, httptest.NewRequest(http.MethodGet, "/api/media/files?path="+url.QueryEscape(path), nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want 403", path, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	HandleMediaFileDownload(w, httptest.NewRequest(http.MethodGet, "/api/media/files/download?path="+url.QueryEscape(filepath.Join(mediaDir, "escape", "secret")), nil))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("download through a symlink: status = %d, want 403", w.Code)
+	}
+}
+
+func TestHandleMediaFileDownload(t *testing.T) {
+	mediaDir := t.TempDir()
+	setCurrentConfigForTest(t, Config{Playlist: PlaylistConfig{Destination: mediaDir}})
+	clip := filepath.Join(mediaDir, "clip.mp4")
+	if err := os.WriteFile(clip, []byte("video data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	HandleMediaFileDownload(w, httptest.NewRequest(http.MethodGet, "/api/media/files/download?path="+url.QueryEscape(clip), nil))
+	if w.Code != http.StatusOK || w.Body.String() != "video data" {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=clip.mp4` {
+		t.Fatalf("Content-Disposition = %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	HandleMediaFileDownload(w, httptest.NewRequest(http.MethodGet, "/api/media/files/download?path="+url.QueryEscape(mediaDir), nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("directory download: status = %d, want 400", w.Code)
+	}
+	w = httptest.NewRecorder()
+	HandleMediaFileDownload(w, httptest.NewRequest(http.MethodGet, "/api/media/files/download?path="+url.QueryEscape(filepath.Join(mediaDir, "none")), nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("missing file: status = %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Manifest files are stored by content type: storage.videos, storage.images,
+// storage.playlists and storage.web may move a type to its own directory,
+// optionally with a quota. Types without a directory stay in the media
+// directory derived from playlist.destination.
+
+// Content types of manifest items (ManifestItem.Type).
+const (
+	mediaKindVideo    = "video"
+	mediaKindImage    = "image"
+	mediaKindPlaylist = "playlist"
+	mediaKindWeb      = "web"
+)
+
+// mediaKinds lists the content types in the order directories are reported.
+var mediaKinds = []string{mediaKindVideo, mediaKindImage, mediaKindPlaylist, mediaKindWeb}
+
+// MediaDirConfig places one content type in its own directory.
+type MediaDirConfig struct {
+	Dir string `yaml:"dir,omitempty"`
+	// QuotaMB limits the total size of the type's manifest files; files past
+	// it are not downloaded. 0 means no limit.
+	QuotaMB int64 `yaml:"quota_mb,omitempty"`
+}
+
+// MediaDirStatus reports the directory of a content type in GET /api/storage.
+type MediaDirStatus struct {
+	Kind       string `json:"kind"`
+	Dir        string `json:"dir"`
+	UsedBytes  int64  `json:"usedBytes"`
+	QuotaBytes int64  `json:"quotaBytes,omitempty"`
+}
+
+var playlistExtensions = map[string]bool{".m3u": true, ".m3u8": true, ".pls": true}
+
+// mediaKindOfPath guesses the content type from the file extension. Web
+// bundles are recognized by their HTML files only; the core marks the other
+// files of a bundle with ManifestItem.Type.
+func mediaKindOfPath(path string) string {
+	switch ext := strings.ToLower(filepath.Ext(path)); {
+	case imageExtensions[ext]:
+		return mediaKindImage
+	case playlistExtensions[ext]:
+		return mediaKindPlaylist
+	case isHTMLFile(path):
+		return mediaKindWeb
+	}
+	return mediaKindVideo
+}
+
+// mediaKindOf returns the content type of a manifest item.
+func mediaKindOf(item ManifestItem) string {
+	switch kind := strings.ToLower(strings.TrimSpace(item.Type)); kind {
+	case mediaKindVideo, mediaKindImage, mediaKindPlaylist, mediaKindWeb:
+		return kind
+	}
+	return mediaKindOfPath(item.Filename)
+}
+
+func mediaDirConfig(config Config, kind string) MediaDirConfig {
+	switch kind {
+	case mediaKindImage:
+		return config.Storage.Images
+	case mediaKindPlaylist:
+		return config.Storage.Playlists
+	case mediaKindWeb:
+		return config.Storage.Web
+	}
+	return config.Storage.Videos
+}
+
+// mediaKindDir returns the directory of a content type.
+func mediaKindDir(config Config, kind string) string {
+	if dir := strings.TrimSpace(mediaDirConfig(config, kind).Dir); dir != "" {
+		return filepath.Clean(dir)
+	}
+	return mediaDirFor(config)
+}
+
+// mediaKindQuota returns the quota of a content type in bytes, or 0.
+func mediaKindQuota(config Config, kind string) int64 {
+	return max(mediaDirConfig(config, kind).QuotaMB, 0) << 20
+}
+
+// mediaItemPath returns where a manifest item is stored.
+func mediaItemPath(config Config, item ManifestItem) string {
+	return filepath.Join(mediaKindDir(config, mediaKindOf(item)), item.Filename)
+}
+
+// mediaDirs lists the distinct media directories, the shared one first.
+func mediaDirs(config Config) []string {
+	dirs := []string{mediaDirFor(config)}
+	for _, kind := range mediaKinds {
+		if dir := mediaKindDir(config, kind); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// nestedMediaDirs returns the media directories below dir, which are
+// walked on their own.
+func nestedMediaDirs(config Config, dir string) []string {
+	var nested []string
+	for _, d := range mediaDirs(config) {
+		if d != dir && pathWithin(d, dir) {
+			nested = append(nested, d)
+		}
+	}
+	return nested
+}
+
+// resolveMediaPath finds a file given relative to the media directory: in
+// the directory of its content type, falling back to the shared directory.
+// ok is false when rel leaves the directories.
+func resolveMediaPath(config Config, rel string) (path string, ok bool) {
+	return resolveMediaKindPath(config, mediaKindOfPath(rel), rel)
+}
+
+// resolveMediaKindPath is resolveMediaPath for a file of a known type.
+func resolveMediaKindPath(config Config, kind, rel string) (path string, ok bool) {
+	rel = filepath.Clean(filepath.FromSlash(strings.TrimSpace(rel)))
+	if rel == "." || filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	shared := filepath.Join(mediaDirFor(config), rel)
+	dir := mediaKindDir(config, kind)
+	path = filepath.Join(dir, rel)
+	if !pathWithin(path, dir) {
+		return "", false
+	}
+	if _, err := os.Stat(path); err != nil {
+		if _, err := os.Stat(shared); err == nil {
+			return shared, true
+		}
+	}
+	return path, true
+}
+
+// validateMediaDirs checks storage.videos, images, playlists and web.
+func validateMediaDirs(config Config) error {
+	for _, kind := range mediaKinds {
+		dir := mediaDirConfig(config, kind)
+		name := "storage." + kind + "s"
+		if kind == mediaKindWeb {
+			name = "storage.web"
+		}
+		if d := strings.TrimSpace(dir.Dir); d != "" && !filepath.IsAbs(d) {
+			return fmt.Errorf("%s.dir must be an absolute path", name)
+		}
+		if dir.QuotaMB < 0 {
+			return fmt.Errorf("%s.quota_mb must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// rewritePlaylistMediaPaths makes relative playlist entries of content types
+// stored outside the shared media directory absolute, since players resolve
+// relative entries against the playlist directory.
+func rewritePlaylistMediaPaths(data []byte, config Config) []byte {
+	shared := mediaDirFor(config)
+	if len(mediaDirs(config)) == 1 {
+		return data
+	}
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		entry := strings.TrimSpace(line)
+		if entry != "" && !strings.HasPrefix(entry, "#") && !strings.Contains(entry, "://") && !filepath.IsAbs(filepath.FromSlash(entry)) {
+			path, ok := resolveMediaPath(config, entry)
+			if ok && path != filepath.Join(shared, filepath.FromSlash(entry)) {
+				line = path
+			}
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// mediaDirUsage sums the sizes of the files below dir, leaving out nested
+// media directories.
+func mediaDirUsage(dir string, skip []string) int64 {
+	var total int64
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if slices.Contains(skip, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// mediaDirStatuses reports the directory, usage and quota of every content
+// type.
+func mediaDirStatuses(config Config) []MediaDirStatus {
+	statuses := make([]MediaDirStatus, 0, len(mediaKinds))
+	for _, kind := range mediaKinds {
+		dir := mediaKindDir(config, kind)
+		statuses = append(statuses, MediaDirStatus{
+			Kind:       kind,
+			Dir:        dir,
+			UsedBytes:  mediaDirUsage(dir, nestedMediaDirs(config, dir)),
+			QuotaBytes: mediaKindQuota(config, kind),
+		})
+	}
+	return statuses
+}
+
+// mediaQuota tracks the manifest bytes of each content type against its
+// quota over all batches of one sync.
+type mediaQuota struct {
+	config Config
+	used   map[string]int64
+}
+
+func newMediaQuota(config Config) *mediaQuota {
+	return &mediaQuota{config: config, used: map[string]int64{}}
+}
+
+// admit reserves the size of item and reports whether it fits the quota of
+// its content type.
+func (q *mediaQuota) admit(item ManifestItem) error {
+	kind := mediaKindOf(item)
+	quota := mediaKindQuota(q.config, kind)
+	if quota == 0 {
+		return nil
+	}
+	if q.used[kind]+item.FileSizeBytes > quota {
+		return fmt.Errorf("%s quota of %d MB exceeded", kind, quota>>20)
+	}
+	q.used[kind] += item.FileSizeBytes
+	return nil
+}
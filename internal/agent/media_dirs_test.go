@@ -0,0 +1,212 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMediaKindOf(t *testing.T) {
+	for _, tc := range []struct {
+		item ManifestItem
+		want string
+	}{
+		{ManifestItem{Filename: "clip.mp4"}, mediaKindVideo},
+		{ManifestItem{Filename: "music/one.mp3"}, mediaKindVideo},
+		{ManifestItem{Filename: "posters/Spring.JPG"}, mediaKindImage},
+		{ManifestItem{Filename: "lobby.m3u8"}, mediaKindPlaylist},
+		{ManifestItem{Filename: "promo/index.html"}, mediaKindWeb},
+		{ManifestItem{Filename: "promo/logo.png", Type: "web"}, mediaKindWeb},
+		{ManifestItem{Filename: "clip.mp4", Type: "unknown"}, mediaKindVideo},
+	} {
+		if got := mediaKindOf(tc.item); got != tc.want {
+			t.Errorf("mediaKindOf(%+v) = %q, want %q", tc.item, got, tc.want)
+		}
+	}
+}
+
+func TestMediaDirs(t *testing.T) {
+	config := Config{
+		Playlist: PlaylistConfig{Destination: "/var/media-pi"},
+		Storage: StorageConfig{
+			Videos: MediaDirConfig{Dir: "/mnt/usb/videos/"},
+			Images: MediaDirConfig{Dir: "/var/media-pi/images"},
+			Web:    MediaDirConfig{Dir: "/var/media-pi"},
+		},
+	}
+	if got, want := mediaDirs(config), []string{"/var/media-pi", "/mnt/usb/videos", "/var/media-pi/images"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("mediaDirs = %v, want %v", got, want)
+	}
+	if got := nestedMediaDirs(config, "/var/media-pi"); !reflect.DeepEqual(got, []string{"/var/media-pi/images"}) {
+		t.Fatalf("nestedMediaDirs = %v", got)
+	}
+	if got := mediaItemPath(config, ManifestItem{Filename: "a/b.mp4"}); got != "/mnt/usb/videos/a/b.mp4" {
+		t.Fatalf("mediaItemPath = %q", got)
+	}
+}
+
+func TestValidateMediaDirs(t *testing.T) {
+	for name, storage := range map[string]StorageConfig{
+		"relative": {Images: MediaDirConfig{Dir: "images"}},
+		"quota":    {Web: MediaDirConfig{QuotaMB: -1}},
+	} {
+		if err := validateMediaDirs(Config{Storage: storage}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := validateMediaDirs(Config{Storage: StorageConfig{Videos: MediaDirConfig{Dir: "/mnt/usb", QuotaMB: 1000}}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRewritePlaylistMediaPaths(t *testing.T) {
+	shared, images := t.TempDir(), t.TempDir()
+	config := Config{
+		Playlist: PlaylistConfig{Destination: shared},
+		Storage:  StorageConfig{Images: MediaDirConfig{Dir: images}},
+	}
+	playlist := "#EXTM3U\n#EXTINF:10,Poster\nposters/a.jpg\nclip.mp4\nhttps://example.com/b.jpg\n/abs/c.png\n"
+	want := "#EXTM3U\n#EXTINF:10,Poster\n" + filepath.Join(images, "posters/a.jpg") + "\nclip.mp4\nhttps://example.com/b.jpg\n/abs/c.png\n"
+	if got := string(rewritePlaylistMediaPaths([]byte(playlist), config)); got != want {
+		t.Fatalf("rewritePlaylistMediaPaths = %q, want %q", got, want)
+	}
+
+	// Files left in the shared directory, e.g. before a migration, keep
+	// working.
+	if err := os.WriteFile(filepath.Join(shared, "old.png"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(rewritePlaylistMediaPaths([]byte("old.png\n"), config)); got != "old.png\n" {
+		t.Fatalf("rewritePlaylistMediaPaths = %q", got)
+	}
+
+	config.Storage = StorageConfig{}
+	if got := string(rewritePlaylistMediaPaths([]byte(playlist), config)); got != playlist {
+		t.Fatalf("a single media directory leaves the playlist unchanged, got %q", got)
+	}
+}
+
+func listFilesForTest(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && !strings.Contains(path, trashDirName) {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+func TestSyncFilesPerContentType(t *testing.T) {
+	resetDeletionGuardForTest(t)
+	shared := t.TempDir()
+	images := filepath.Join(shared, "images")
+	web := t.TempDir()
+	if err := os.MkdirAll(images, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeMediaFilesForTest(t, images, "stale.jpg", "kept.jpg")
+	writeMediaFilesForTest(t, web, "stale.html")
+
+	manifest := &Manifest{
+		{ID: 1, Filename: "clip.mp4", FileSizeBytes: 4, SHA256: sha256Hex("clip")},
+		{ID: 2, Filename: "kept.jpg", FileSizeBytes: 3, SHA256: sha256Hex("old")},
+		{ID: 3, Filename: "new.png", FileSizeBytes: 3, SHA256: sha256Hex("png")},
+		{ID: 4, Filename: "promo/index.html", FileSizeBytes: 4, SHA256: sha256Hex("html")},
+		{ID: 5, Filename: "promo/logo.png", FileSizeBytes: 4, SHA256: sha256Hex("logo"), Type: "web"},
+	}
+	content := map[string]string{"clip.mp4": "clip", "new.png": "png", "promo/index.html": "html", "promo/logo.png": "logo"}
+	fetch := func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		return os.WriteFile(destPath, []byte(content[item.Filename]), 0644)
+	}
+	config := Config{
+		Playlist: PlaylistConfig{Destination: shared},
+		Storage: StorageConfig{
+			Images: MediaDirConfig{Dir: images},
+			Web:    MediaDirConfig{Dir: web},
+		},
+	}
+	if err := syncFilesFrom(context.Background(), config, manifest, fetch); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := listFilesForTest(t, shared), []string{"clip.mp4", "images/kept.jpg", "images/new.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("shared directory = %v, want %v", got, want)
+	}
+	if got, want := listFilesForTest(t, web), []string{"promo/index.html", "promo/logo.png"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("web directory = %v, want %v", got, want)
+	}
+	// Garbage goes to the trash of its own directory.
+	if _, err := os.Stat(trashDir(images)); err != nil {
+		t.Errorf("expected a trash in the images directory: %v", err)
+	}
+	if _, err := os.Stat(trashDir(web)); err != nil {
+		t.Errorf("expected a trash in the web directory: %v", err)
+	}
+}
+
+func TestSyncFilesQuota(t *testing.T) {
+	resetDeletionGuardForTest(t)
+	shared, images := t.TempDir(), t.TempDir()
+	big := strings.Repeat("x", 600<<10)
+	manifest := &Manifest{
+		{ID: 1, Filename: "a.jpg", FileSizeBytes: int64(len(big)), SHA256: sha256Hex(big)},
+		{ID: 2, Filename: "b.jpg", FileSizeBytes: int64(len(big)), SHA256: sha256Hex(big)},
+		{ID: 3, Filename: "clip.mp4", FileSizeBytes: int64(len(big)), SHA256: sha256Hex(big)},
+	}
+	var fetched []string
+	fetch := func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		fetched = append(fetched, item.Filename)
+		return os.WriteFile(destPath, []byte(big), 0644)
+	}
+	config := Config{
+		Playlist: PlaylistConfig{Destination: shared},
+		Storage:  StorageConfig{Images: MediaDirConfig{Dir: images, QuotaMB: 1}},
+	}
+	err := syncFilesFrom(context.Background(), config, manifest, fetch)
+	if err == nil || !strings.Contains(err.Error(), "b.jpg: image quota of 1 MB exceeded") {
+		t.Fatalf("expected a quota error for b.jpg, got %v", err)
+	}
+	if want := []string{"a.jpg", "clip.mp4"}; !reflect.DeepEqual(fetched, want) {
+		t.Fatalf("fetched = %v, want %v", fetched, want)
+	}
+}
+
+func TestDeletionGuardPerDirectory(t *testing.T) {
+	resetDeletionGuardForTest(t)
+	shared, images := t.TempDir(), t.TempDir()
+	writeMediaFilesForTest(t, shared, "1.mp4", "2.mp4", "3.mp4", "4.mp4", "5.mp4", "6.mp4", "7.mp4", "8.mp4", "9.mp4", "10.mp4")
+	writeMediaFilesForTest(t, images, "a.jpg", "b.jpg", "c.jpg")
+
+	// Removing every image is 3 of 13 files overall but all of the images.
+	var manifest Manifest
+	for i := 1; i <= 10; i++ {
+		manifest = append(manifest, ManifestItem{ID: int64(i), Filename: strconv.Itoa(i) + ".mp4", FileSizeBytes: 3, SHA256: sha256Hex("old")})
+	}
+	config := Config{
+		Playlist: PlaylistConfig{Destination: shared},
+		Storage:  StorageConfig{Images: MediaDirConfig{Dir: images}},
+	}
+	fetch := func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		return errors.New("unexpected download")
+	}
+	err := syncFilesFrom(context.Background(), config, &manifest, fetch)
+	if !errors.Is(err, errDeletionBlocked) {
+		t.Fatalf("expected the deletion guard to block, got %v", err)
+	}
+	if got := listFilesForTest(t, images); len(got) != 3 {
+		t.Fatalf("expected images to be kept, got %v", got)
+	}
+}
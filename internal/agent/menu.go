@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -44,6 +45,9 @@ var (
 
 // realReboot performs a reboot via systemd's D-Bus API (org.freedesktop.login1.Manager.Reboot).
 func realReboot() error {
+	if socket := helperSocketPath(); socket != "" {
+		return callHelperOp(socket, helperRequest{Op: helperOpReboot})
+	}
 	// Fallback to invoking systemctl reboot. Tests should override RebootAction
 	// to avoid actually rebooting the test host.
 	cmd := exec.Command("systemctl", "reboot")
@@ -52,6 +56,9 @@ func realReboot() error {
 
 // realPowerOff performs a power-off via systemd's D-Bus API (org.freedesktop.login1.Manager.PowerOff).
 func realPowerOff() error {
+	if socket := helperSocketPath(); socket != "" {
+		return callHelperOp(socket, helperRequest{Op: helperOpPowerOff})
+	}
 	// Fallback to invoking systemctl poweroff. Tests should override PowerOffAction
 	// to avoid actually powering off the test host.
 	cmd := exec.Command("systemctl", "poweroff")
@@ -77,6 +84,8 @@ type MenuActionResponse struct {
 	Action  string `json:"action"`
 	Result  string `json:"result"`
 	Message string `json:"message,omitempty"`
+	// Warnings lists schedule conflicts of a configuration update.
+	Warnings []ScheduleConflict `json:"warnings,omitempty"`
 }
 
 // MenuListResponse contains available menu actions.
@@ -131,6 +140,27 @@ func GetMenuActions() []MenuAction {
 			Method:      "PUT",
 			Path:        "/api/menu/configuration/update",
 		},
+		{
+			ID:          "schedule-next",
+			Name:        "Ближайшие запуски",
+			Description: "Получить время ближайших синхронизаций, перерывов и перезагрузок",
+			Method:      "GET",
+			Path:        "/api/menu/schedule/next",
+		},
+		{
+			ID:          "schedule-pause",
+			Name:        "Приостановить расписание",
+			Description: "Не выполнять синхронизации по расписанию до возобновления",
+			Method:      "POST",
+			Path:        "/api/menu/schedule/pause",
+		},
+		{
+			ID:          "schedule-resume",
+			Name:        "Возобновить расписание",
+			Description: "Снова выполнять синхронизации по расписанию",
+			Method:      "POST",
+			Path:        "/api/menu/schedule/resume",
+		},
 		{
 			ID:          "playlist-start-upload",
 			Name:        "Начать загрузку плейлиста",
@@ -159,6 +189,13 @@ func GetMenuActions() []MenuAction {
 			Method:      "POST",
 			Path:        "/api/menu/video/stop-upload",
 		},
+		{
+			ID:          "sync-cancel",
+			Name:        "Отменить синхронизацию",
+			Description: "Прервать текущую синхронизацию и удалить недокачанные файлы",
+			Method:      "POST",
+			Path:        "/api/sync/cancel",
+		},
 		{
 			ID:          "take-screenshot",
 			Name:        "Сделать снимок",
@@ -166,6 +203,48 @@ func GetMenuActions() []MenuAction {
 			Method:      "GET",
 			Path:        "/api/menu/screenshot/take",
 		},
+		{
+			ID:          "display-list",
+			Name:        "Дисплеи",
+			Description: "Получить список выходов дисплея и их настройки",
+			Method:      "GET",
+			Path:        "/api/menu/display",
+		},
+		{
+			ID:          "display-outputs-update",
+			Name:        "Настроить дисплеи",
+			Description: "Назначить плейлисты, разрешение и поворот выходам дисплея",
+			Method:      "PUT",
+			Path:        "/api/menu/display/outputs",
+		},
+		{
+			ID:          "display-config-get",
+			Name:        "Режим дисплея",
+			Description: "Получить разрешение и поворот выходов дисплея",
+			Method:      "GET",
+			Path:        "/api/menu/display/config",
+		},
+		{
+			ID:          "display-config-update",
+			Name:        "Изменить режим дисплея",
+			Description: "Установить разрешение и поворот выхода дисплея",
+			Method:      "PUT",
+			Path:        "/api/menu/display/config",
+		},
+		{
+			ID:          "display-start",
+			Name:        "Запустить воспроизведение на дисплее",
+			Description: "Запустить воспроизведение на выбранном выходе",
+			Method:      "POST",
+			Path:        "/api/menu/display/start",
+		},
+		{
+			ID:          "display-stop",
+			Name:        "Остановить воспроизведение на дисплее",
+			Description: "Остановить воспроизведение на выбранном выходе",
+			Method:      "POST",
+			Path:        "/api/menu/display/stop",
+		},
 		{
 			ID:          "system-reload",
 			Name:        "Применить изменения",
@@ -220,14 +299,18 @@ type ConfigurationSettings struct {
 	Schedule   ScheduleSettings     `json:"schedule"`
 	Audio      AudioSettings        `json:"audio"`
 	Screenshot ScreenshotSettings   `json:"screenshot"`
+	// Revision is the configuration revision, see Config.Revision.
+	Revision int64 `json:"revision"`
 }
 
-// configurationUpdateRequest mirrors ConfigurationSettings.
+// configurationUpdateRequest mirrors ConfigurationSettings. Revision must be
+// the revision the update is based on.
 type configurationUpdateRequest struct {
 	Playlist   PlaylistUploadConfig `json:"playlist"`
 	Schedule   ScheduleSettings     `json:"schedule"`
 	Audio      AudioSettings        `json:"audio"`
 	Screenshot *ScreenshotSettings  `json:"screenshot"`
+	Revision   *int64               `json:"revision"`
 }
 
 // ServiceStatusResponse describes the service status returned by the
@@ -237,6 +320,9 @@ type ServiceStatusResponse struct {
 	PlaylistUploadServiceStatus bool                     `json:"playlistUploadServiceStatus"`
 	VideoUploadServiceStatus    bool                     `json:"videoUploadServiceStatus"`
 	PlaylistActivation          PlaylistActivationStatus `json:"playlistActivation"`
+	// Quarantined lists the manifest items video sync skips; see
+	// sync.quarantine_after.
+	Quarantined []DownloadFailure `json:"quarantined,omitempty"`
 }
 
 // HandleMenuList returns the list of available menu actions.
@@ -261,7 +347,7 @@ func HandlePlaybackStop(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("Stopping play.video.service on manual request")
 	requestCtx := r.Context()
-	connCtx, cancel := context.WithTimeout(requestCtx, dbusOperationTimeout)
+	connCtx, cancel := context.WithTimeout(requestCtx, dbusTimeout())
 	defer cancel()
 
 	conn, err := getDBusConnection(connCtx)
@@ -424,7 +510,7 @@ func getServiceStatus(parent context.Context) (ServiceStatusResponse, error) {
 	}
 	defer conn.Close()
 
-	ctx, cancel := context.WithTimeout(parent, dbusOperationTimeout)
+	ctx, cancel := context.WithTimeout(parent, dbusTimeout())
 	defer cancel()
 
 	return ServiceStatusResponse{
@@ -432,6 +518,7 @@ func getServiceStatus(parent context.Context) (ServiceStatusResponse, error) {
 		PlaylistUploadServiceStatus: IsPlaylistSyncRunning(),
 		VideoUploadServiceStatus:    IsVideoSyncRunning(),
 		PlaylistActivation:          getPlaylistActivationStatus(),
+		Quarantined:                 quarantinedDownloads(),
 	}, nil
 }
 
@@ -493,15 +580,10 @@ func readPlaylistUploadConfig(path string) (PlaylistUploadConfig, error) {
 	return PlaylistUploadConfig{}, fmt.Errorf("строка ExecStart не найдена")
 }
 
-// writePlaylistUploadConfig updates the ExecStart line in the playlist upload
-// service file, preserving other parts of the file intact while replacing the
-// source and destination paths.
-func writePlaylistUploadConfig(path, source, destination string) error {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return err
-	}
-
+// renderPlaylistUploadConfig updates the ExecStart line of the playlist
+// upload service file data, preserving other parts of the file intact while
+// replacing the source and destination paths.
+func renderPlaylistUploadConfig(data []byte, source, destination string) ([]byte, error) {
 	lines := strings.Split(string(data), "\n")
 	updated := false
 
@@ -513,7 +595,7 @@ func writePlaylistUploadConfig(path, source, destination string) error {
 
 		eqIdx := strings.Index(line, "=")
 		if eqIdx == -1 {
-			return fmt.Errorf("строка ExecStart не содержит '='")
+			return nil, fmt.Errorf("строка ExecStart не содержит '='")
 		}
 
 		commandWithComment := strings.TrimSpace(line[eqIdx+1:])
@@ -524,7 +606,7 @@ func writePlaylistUploadConfig(path, source, destination string) error {
 		}
 		fields := strings.Fields(commandWithComment)
 		if len(fields) < 2 {
-			return fmt.Errorf("строка ExecStart не содержит пути источника и назначения")
+			return nil, fmt.Errorf("строка ExecStart не содержит пути источника и назначения")
 		}
 
 		prefixFields := append([]string{}, fields[:len(fields)-2]...)
@@ -541,10 +623,10 @@ func writePlaylistUploadConfig(path, source, destination string) error {
 	}
 
 	if !updated {
-		return fmt.Errorf("строка ExecStart не найдена")
+		return nil, fmt.Errorf("строка ExecStart не найдена")
 	}
 
-	return os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+	return []byte(strings.Join(lines, "\n")), nil
 }
 
 func readAudioSettings() (AudioSettings, error) {
@@ -575,9 +657,10 @@ func validateAudioOutput(output string) error {
 	return nil
 }
 
-func writeAudioSettings(output string) error {
+// renderAudioSettings returns the asound.conf content selecting output.
+func renderAudioSettings(output string) (string, error) {
 	if err := validateAudioOutput(output); err != nil {
-		return err
+		return "", err
 	}
 
 	reqOutput := strings.ToLower(strings.TrimSpace(output))
@@ -589,7 +672,7 @@ func writeAudioSettings(output string) error {
 		config = "defaults.pcm.card 1\ndefaults.ctl.card 1\n"
 	}
 
-	return os.WriteFile(AudioConfigPath, []byte(config), 0644)
+	return config, nil
 }
 
 // HandleConfigurationGet aggregates playlist, schedule and audio configuration into a single response.
@@ -627,6 +710,7 @@ func HandleConfigurationGet(w http.ResponseWriter, r *http.Request) {
 		Screenshot: ScreenshotSettings{
 			Timers: photoTimers,
 		},
+		Revision: cfg.Revision,
 	}})
 }
 
@@ -667,6 +751,11 @@ func HandleConfigurationUpdate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if req.Revision == nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Поле revision обязательно"})
+		return
+	}
+
 	if hasInvalidTimes(req.Schedule.Playlist, req.Schedule.Video) {
 		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат времени. Используйте HH:MM"})
 		return
@@ -688,6 +777,14 @@ func HandleConfigurationUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Files are read for rollback and written under the locks, so a
+	// concurrent update cannot interleave with this one.
+	unlock := lockConfigResources(w, configResourceConfig, configResourceTimers, configResourceCrontab, configResourceAudio)
+	if unlock == nil {
+		return
+	}
+	defer unlock()
+
 	// Snapshot current config once to avoid inconsistency from concurrent reloads.
 	cfg := GetCurrentConfig()
 	photoTimers := append([]string{}, cfg.Screenshot.Timers...)
@@ -699,6 +796,13 @@ func HandleConfigurationUpdate(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Reject updates based on an older configuration, so the core and a
+	// local technician do not silently overwrite each other's changes.
+	if *req.Revision != cfg.Revision {
+		JSONResponse(w, http.StatusConflict, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Конфигурация уже изменена (ревизия %d), получите её заново", cfg.Revision)})
+		return
+	}
+
 	normalizedPlaylist, err := normalizeTimes(req.Schedule.Playlist)
 	if err != nil {
 		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Неправильный формат таймера загрузки плейлиста: %v", err)})
@@ -711,54 +815,88 @@ func HandleConfigurationUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := writePlaylistUploadConfig(PlaylistServicePath, playlistSource, cleanDestination); err != nil {
+	// Build every file in memory first, so a bad service file or crontab
+	// fails the request before anything on disk changes.
+	serviceData, err := os.ReadFile(PlaylistServicePath)
+	if err != nil {
 		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось обновить конфигурацию: %v", err)})
 		return
 	}
-
-	if err := writeTimerSchedule(PlaylistTimerPath, "Playlist upload timer", "playlist.upload.service", normalizedPlaylist); err != nil {
-		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось записать файл таймера плейлиста: %v", err)})
+	serviceData, err = renderPlaylistUploadConfig(serviceData, playlistSource, cleanDestination)
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось обновить конфигурацию: %v", err)})
 		return
 	}
 
-	if err := writeTimerSchedule(VideoTimerPath, "Video upload timer", "video.upload.service", normalizedVideo); err != nil {
-		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось записать файл таймера видео: %v", err)})
+	crontab, err := CrontabReadFunc()
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось обновить crontab: %v", err)})
 		return
 	}
-
-	if err := updateRestTimes(restPairs); err != nil {
+	updatedCrontab, err := renderRestCrontab(crontab, restPairs)
+	if err != nil {
 		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось обновить crontab: %v", err)})
 		return
 	}
 
-	if err := writeAudioSettings(req.Audio.Output); err != nil {
+	audioData, err := renderAudioSettings(req.Audio.Output)
+	if err != nil {
 		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: err.Error()})
 		return
 	}
 
+	files := []struct {
+		name string
+		path string
+		data []byte
+	}{
+		{"файл службы загрузки плейлиста", PlaylistServicePath, serviceData},
+		{"файл таймера плейлиста", PlaylistTimerPath, []byte(renderTimerSchedule("Playlist upload timer", "playlist.upload.service", normalizedPlaylist))},
+		{"файл таймера видео", VideoTimerPath, []byte(renderTimerSchedule("Video upload timer", "video.upload.service", normalizedVideo))},
+		{"настройки звука", AudioConfigPath, []byte(audioData)},
+	}
+	steps := make([]configStep, 0, len(files)+2)
+	for _, file := range files {
+		step, err := fileConfigStep(file.name, file.path, file.data)
+		if err != nil {
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось обновить конфигурацию: %v", err)})
+			return
+		}
+		steps = append(steps, step)
+	}
+	steps = append(steps, crontabConfigStep("crontab", crontab, updatedCrontab))
+
 	// Update configuration file with all settings. This also signals the scheduler
 	// to reload, which is required for photo report timer changes to take effect.
+	// It runs last, so nothing written after it could need rolling back.
 	restConfigPairs := make([]RestTimePairConfig, len(restPairs))
 	for i, p := range restPairs {
 		restConfigPairs[i] = RestTimePairConfig(p)
 	}
-
-	if err := UpdateConfigSettings(
-		PlaylistConfig{Source: playlistSource, Destination: cleanDestination},
-		ScheduleConfig{Playlist: normalizedPlaylist, Video: normalizedVideo, Rest: restConfigPairs},
-		AudioConfig{Output: req.Audio.Output},
-		ScreenshotConfig{
-			Timers:       photoTimers,
-			PathTemplate: cfg.Screenshot.PathTemplate,
-			Input:        cfg.Screenshot.Input,
-			ResendLimit:  cfg.Screenshot.ResendLimit,
+	steps = append(steps, configStep{
+		name: "конфигурация агента",
+		commit: func() error {
+			return UpdateConfigSettings(
+				PlaylistConfig{Source: playlistSource, Destination: cleanDestination, Variables: cfg.Playlist.Variables},
+				ScheduleConfig{Playlist: normalizedPlaylist, Video: normalizedVideo, Rest: restConfigPairs},
+				AudioConfig{Output: req.Audio.Output, Playback: cfg.Audio.Playback},
+				ScreenshotConfig{
+					Timers:       photoTimers,
+					PathTemplate: cfg.Screenshot.PathTemplate,
+					Input:        cfg.Screenshot.Input,
+					ResendLimit:  cfg.Screenshot.ResendLimit,
+				},
+			)
 		},
-	); err != nil {
-		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось сохранить конфигурацию: %v", err)})
+	})
+
+	if err := applyConfigSteps(steps); err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось применить конфигурацию, изменения отменены: %v", err)})
 		return
 	}
 
-	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: MenuActionResponse{Action: "configuration-update", Result: "success", Message: "Конфигурация обновлена"}})
+	warnings := scheduleConflicts(ScheduleConfig{Playlist: normalizedPlaylist, Video: normalizedVideo, Rest: restConfigPairs}, updatedCrontab, playbackTimeNow())
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: MenuActionResponse{Action: "configuration-update", Result: "success", Message: "Конфигурация обновлена", Warnings: warnings}})
 }
 
 // HandleSystemReload reloads systemd daemon configuration.
@@ -769,7 +907,7 @@ func HandleSystemReload(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("Reloading systemd daemon configuration")
 	requestCtx := r.Context()
-	connCtx, cancelConn := context.WithTimeout(requestCtx, dbusOperationTimeout)
+	connCtx, cancelConn := context.WithTimeout(requestCtx, dbusTimeout())
 	defer cancelConn()
 
 	conn, err := getDBusConnection(connCtx)
@@ -783,7 +921,7 @@ func HandleSystemReload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close()
 
-	ctx, cancel := context.WithTimeout(requestCtx, dbusOperationTimeout)
+	ctx, cancel := context.WithTimeout(requestCtx, dbusTimeout())
 	defer cancel()
 
 	err = conn.ReloadContext(ctx)
@@ -811,7 +949,7 @@ func HandleSystemReload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := RestartVideoPlayServiceWithLogs("systemd daemon reload"); err != nil {
+	if err := RestartVideoPlayServiceWithLogs(r.Context(), "systemd daemon reload"); err != nil {
 		JSONResponse(w, http.StatusInternalServerError, APIResponse{
 			OK:     false,
 			ErrMsg: fmt.Sprintf("Не удалось перезапустить воспроизведение: %v", err),
@@ -911,8 +1049,9 @@ func HandlePlaylistStartUpload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Trigger playlist-only sync with callback to restart play.video.service
+	// The restart outlives the request: it runs after the sync finishes.
 	err := TriggerPlaylistSync("manual", func() error {
-		return RestartVideoPlayServiceWithLogs("playlist sync")
+		return RestartVideoPlayServiceWithLogs(context.Background(), "playlist sync")
 	})
 
 	if err != nil {
@@ -961,13 +1100,25 @@ func HandlePlaylistStopUpload(w http.ResponseWriter, r *http.Request) {
 }
 
 // HandleVideoStartUpload triggers video sync (replaces old systemd upload service).
+// An optional SyncScopeRequest body narrows or widens the sync.
 func HandleVideoStartUpload(w http.ResponseWriter, r *http.Request) {
 	if !requireMethod(w, r, http.MethodPost) {
 		return
 	}
 
-	// Trigger video sync without callback (don't restart video.play service)
-	err := TriggerSync(nil)
+	var req SyncScopeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+		return
+	}
+	scope, err := parseSyncScope(req.Scope)
+	if err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Неверная область синхронизации: %v", err)})
+		return
+	}
+
+	// Video sync runs without callback (don't restart video.play service)
+	err = triggerScopedSync(scope)
 	if err != nil {
 		log.Printf("Failed to trigger video sync: %v", err)
 		JSONResponse(w, http.StatusInternalServerError, APIResponse{
@@ -1044,8 +1195,9 @@ func HandleTakeScreenshot(w http.ResponseWriter, r *http.Request) {
 
 // RestartVideoPlayService restarts the play.video.service via D-Bus.
 // This function waits for the restart operation to complete and verifies the result.
-func RestartVideoPlayService() error {
-	connCtx, cancel := context.WithTimeout(context.Background(), playbackServiceOperationTimeout+playbackServiceActiveCheckTimeout)
+// Canceling ctx, e.g. when the requesting client disconnects, stops waiting.
+func RestartVideoPlayService(ctx context.Context) error {
+	connCtx, cancel := context.WithTimeout(ctx, playbackOperationTimeout()+playbackServiceActiveCheckTimeout)
 	defer cancel()
 
 	conn, err := getDBusConnection(connCtx)
@@ -1054,7 +1206,7 @@ func RestartVideoPlayService() error {
 	}
 	defer conn.Close()
 
-	result, err := runDBusUnitOperation(context.Background(), conn, dbusUnitOperationRestart, playbackServiceUnit)
+	result, err := runDBusUnitOperation(ctx, conn, dbusUnitOperationRestart, playbackServiceUnit)
 	if err != nil {
 		if errors.Is(err, errDBusUnitOperationTimeout) {
 			return fmt.Errorf("restart timeout")
@@ -1069,9 +1221,9 @@ func RestartVideoPlayService() error {
 	return nil
 }
 
-func RestartVideoPlayServiceWithLogs(reason string) error {
+func RestartVideoPlayServiceWithLogs(ctx context.Context, reason string) error {
 	log.Printf("Restarting play.video.service after %s", reason)
-	if err := RestartVideoPlayService(); err != nil {
+	if err := RestartVideoPlayService(ctx); err != nil {
 		log.Printf("Failed to restart play.video.service after %s: %v", reason, err)
 		return err
 	}
@@ -1289,13 +1441,21 @@ func updateRestTimes(pairs []RestTimePair) error {
 	if err != nil {
 		return err
 	}
+	updated, err := renderRestCrontab(content, pairs)
+	if err != nil {
+		return err
+	}
+	return CrontabWriteFunc(updated)
+}
 
+// renderRestCrontab replaces the rest entries of crontab content with pairs.
+func renderRestCrontab(content string, pairs []RestTimePair) (string, error) {
 	lines := splitCrontabLines(content)
 	lines = filterOutRestEntries(lines)
 
 	restEntries, err := buildRestCronEntries(pairs)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if len(restEntries) > 0 {
@@ -1307,7 +1467,7 @@ func updateRestTimes(pairs []RestTimePair) error {
 		lines = trimTrailingEmptyLines(lines)
 	}
 
-	return CrontabWriteFunc(joinCrontabLines(lines))
+	return joinCrontabLines(lines), nil
 }
 
 func getRestTimes() ([]RestTimePair, error) {
@@ -1528,7 +1688,22 @@ func splitCronLine(line string) (string, string, error) {
 }
 
 func defaultCrontabRead() (string, error) {
-	cmd := exec.Command("crontab", "-u", MediaPiServiceUser, "-l")
+	if socket := helperSocketPath(); socket != "" {
+		resp, err := callHelper(context.Background(), socket, helperRequest{Op: helperOpCrontabRead})
+		return resp.Content, err
+	}
+	return execCrontabRead(MediaPiServiceUser)
+}
+
+func defaultCrontabWrite(content string) error {
+	if socket := helperSocketPath(); socket != "" {
+		return callHelperOp(socket, helperRequest{Op: helperOpCrontabWrite, Content: content})
+	}
+	return execCrontabWrite(MediaPiServiceUser, content)
+}
+
+func execCrontabRead(user string) (string, error) {
+	cmd := exec.Command("crontab", "-u", user, "-l")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		text := strings.ToLower(string(output))
@@ -1543,8 +1718,8 @@ func defaultCrontabRead() (string, error) {
 	return string(output), nil
 }
 
-func defaultCrontabWrite(content string) error {
-	cmd := exec.Command("crontab", "-u", MediaPiServiceUser, "-")
+func execCrontabWrite(user, content string) error {
+	cmd := exec.Command("crontab", "-u", user, "-")
 	cmd.Stdin = strings.NewReader(content)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("crontab %s: %w: %s", strings.Join(cmd.Args[1:], " "), err, string(output))
@@ -1695,11 +1870,7 @@ func SanitizeSystemdValue(value string) string {
 	return strings.TrimSpace(result)
 }
 
-func writeTimerSchedule(filePath, description, unit string, times []string) error {
-	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
-		return err
-	}
-
+func renderTimerSchedule(description, unit string, times []string) string {
 	// Sanitize description and unit to prevent injection attacks
 	sanitizedDescription := SanitizeSystemdValue(description)
 	sanitizedUnit := SanitizeSystemdValue(unit)
@@ -1715,8 +1886,7 @@ func writeTimerSchedule(filePath, description, unit string, times []string) erro
 	builder.WriteString("Persistent=true\n\n")
 	builder.WriteString("[Install]\n")
 	builder.WriteString("WantedBy=timers.target\n")
-
-	return os.WriteFile(filePath, []byte(builder.String()), 0644)
+	return builder.String()
 }
 
 // isValidTimeFormat checks if a string is in HH:MM format.
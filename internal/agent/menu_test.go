@@ -15,9 +15,12 @@ import (
 	"os/exec"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
 )
 
 func captureTestLogs(t *testing.T) *bytes.Buffer {
@@ -434,8 +437,8 @@ func TestRestartVideoPlayServiceSchedulesPhotoReportTimers(t *testing.T) {
 		cancelScheduledPlaylistPhotoCaptures()
 	})
 
-	if err := RestartVideoPlayService(); err != nil {
-		t.Fatalf("RestartVideoPlayService() error = %v", err)
+	if err := RestartVideoPlayService(context.Background()); err != nil {
+		t.Fatalf("RestartVideoPlayService(context.Background()) error = %v", err)
 	}
 
 	select {
@@ -459,8 +462,8 @@ func TestRestartVideoPlayServiceUsesTimeoutForDBusConnection(t *testing.T) {
 	})
 
 	startedAt := time.Now()
-	if err := RestartVideoPlayService(); err != nil {
-		t.Fatalf("RestartVideoPlayService() error = %v", err)
+	if err := RestartVideoPlayService(context.Background()); err != nil {
+		t.Fatalf("RestartVideoPlayService(context.Background()) error = %v", err)
 	}
 	if !factorySawDeadline {
 		t.Fatalf("expected D-Bus connection context to have a timeout deadline")
@@ -494,8 +497,8 @@ func TestRestartVideoPlayServiceConnectionOutlivesGenericTimeoutDuringPlaybackFa
 		cancelScheduledPlaylistPhotoCaptures()
 	})
 
-	if err := RestartVideoPlayService(); err != nil {
-		t.Fatalf("RestartVideoPlayService() error = %v", err)
+	if err := RestartVideoPlayService(context.Background()); err != nil {
+		t.Fatalf("RestartVideoPlayService(context.Background()) error = %v", err)
 	}
 	if !conn.unitPropertiesRequested {
 		t.Fatalf("expected active-state check after DBus restart timeout")
@@ -539,8 +542,8 @@ func TestRestartVideoPlayServiceAcceptsActiveServiceAfterDBusTimeoutAndSchedules
 		cancelScheduledPlaylistPhotoCaptures()
 	})
 
-	if err := RestartVideoPlayService(); err != nil {
-		t.Fatalf("RestartVideoPlayService() error = %v", err)
+	if err := RestartVideoPlayService(context.Background()); err != nil {
+		t.Fatalf("RestartVideoPlayService(context.Background()) error = %v", err)
 	}
 	if !reflect.DeepEqual(conn.restartedUnits, []string{"play.video.service"}) {
 		t.Fatalf("unexpected restarted units: %+v", conn.restartedUnits)
@@ -1072,7 +1075,7 @@ WantedBy = multi-user.target
 		CrontabWriteFunc = originalWrite
 	})
 
-	body := `{"playlist":{"source":"/mnt/ya.disk/playlist/test/","destination":"/mnt/usb/playlist/"},"schedule":{"playlist":["6:05","16:28"],"video":["22:22"],"rest":[{"start":"12:00","stop":"13:00"},{"start":"23:45","stop":"07:00"}]},"audio":{"output":"jack"},"screenshot":{"timers":["00:30:00","00:00:30","00:30:00"]}}`
+	body := `{"revision":0,"playlist":{"source":"/mnt/ya.disk/playlist/test/","destination":"/mnt/usb/playlist/"},"schedule":{"playlist":["6:05","16:28"],"video":["22:22"],"rest":[{"start":"12:00","stop":"13:00"},{"start":"23:45","stop":"07:00"}]},"audio":{"output":"jack"},"screenshot":{"timers":["00:30:00","00:00:30","00:30:00"]}}`
 	req := httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body))
 	req.Header.Set("Authorization", "Bearer test-key")
 	w := httptest.NewRecorder()
@@ -1147,18 +1150,8 @@ func TestNormalizePhotoTimersRejectsInvalidDurations(t *testing.T) {
 	}
 }
 
-func TestWriteTimerScheduleProducesValidUnit(t *testing.T) {
-	tmp := t.TempDir()
-	timerFile := filepath.Join(tmp, "test.timer")
-	times := []string{"06:05", "18:30"}
-	if err := writeTimerSchedule(timerFile, "Test timer", "test.service", times); err != nil {
-		t.Fatalf("writeTimerSchedule failed: %v", err)
-	}
-	content, err := os.ReadFile(timerFile)
-	if err != nil {
-		t.Fatalf("failed to read timer file: %v", err)
-	}
-	data := string(content)
+func TestRenderTimerScheduleProducesValidUnit(t *testing.T) {
+	data := renderTimerSchedule("Test timer", "test.service", []string{"06:05", "18:30"})
 	for _, expected := range []string{"OnCalendar=*-*-* 06:05:00", "OnCalendar=*-*-* 18:30:00"} {
 		if !strings.Contains(data, expected) {
 			t.Fatalf("expected %s in timer file, got %s", expected, data)
@@ -1193,7 +1186,7 @@ func TestHandleConfigurationUploadValidation(t *testing.T) {
 		t.Fatalf("failed to seed service file: %v", err)
 	}
 
-	body := `{"playlist":{"source":"","destination":"/mnt/usb"},"schedule":{"playlist":["25:00"],"video":["08:00"],"rest":[]},"audio":{"output":"invalid"}}`
+	body := `{"revision":0,"playlist":{"source":"","destination":"/mnt/usb"},"schedule":{"playlist":["25:00"],"video":["08:00"],"rest":[]},"audio":{"output":"invalid"}}`
 	req := httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body))
 	req.Header.Set("Authorization", "Bearer test-key")
 	w := httptest.NewRecorder()
@@ -1229,7 +1222,7 @@ func TestHandleConfigurationUploadValidationRejectsInvalidPhotoTimer(t *testing.
 		t.Fatalf("failed to seed service file: %v", err)
 	}
 
-	body := `{"playlist":{"source":"","destination":"/mnt/usb"},"schedule":{"playlist":["08:00"],"video":["08:00"],"rest":[]},"audio":{"output":"hdmi"},"screenshot":{"timers":["00:99:00"]}}`
+	body := `{"revision":0,"playlist":{"source":"","destination":"/mnt/usb"},"schedule":{"playlist":["08:00"],"video":["08:00"],"rest":[]},"audio":{"output":"hdmi"},"screenshot":{"timers":["00:99:00"]}}`
 	req := httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body))
 	req.Header.Set("Authorization", "Bearer test-key")
 	w := httptest.NewRecorder()
@@ -1289,7 +1282,7 @@ func TestHandleConfigurationUpdateEmptySourceUsesDefault(t *testing.T) {
 	})
 
 	// Test with empty source - should use default
-	body := `{"playlist":{"source":"","destination":"/mnt/usb/test/"},"schedule":{"playlist":["08:00"],"video":["12:00"],"rest":[]},"audio":{"output":"hdmi"},"screenshot":{"timers":["00:00:30","03:00:00","00:00:30"]}}`
+	body := `{"revision":0,"playlist":{"source":"","destination":"/mnt/usb/test/"},"schedule":{"playlist":["08:00"],"video":["12:00"],"rest":[]},"audio":{"output":"hdmi"},"screenshot":{"timers":["00:00:30","03:00:00","00:00:30"]}}`
 	req := httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body))
 	req.Header.Set("Authorization", "Bearer test-key")
 	w := httptest.NewRecorder()
@@ -1363,7 +1356,7 @@ func TestHandleConfigurationUpdatePreservesPhotoTimersWhenOmitted(t *testing.T)
 		CrontabWriteFunc = originalWrite
 	})
 
-	body := `{"playlist":{"source":"media-pi.core server","destination":"/mnt/usb/test/"},"schedule":{"playlist":["09:00"],"video":["13:00"],"rest":[]},"audio":{"output":"jack"}}`
+	body := `{"revision":0,"playlist":{"source":"media-pi.core server","destination":"/mnt/usb/test/"},"schedule":{"playlist":["09:00"],"video":["13:00"],"rest":[]},"audio":{"output":"jack"}}`
 	req := httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body))
 	req.Header.Set("Authorization", "Bearer test-key")
 	w := httptest.NewRecorder()
@@ -1427,7 +1420,7 @@ func TestHandleConfigurationUpdateClearsPhotoTimersWithExplicitEmptyList(t *test
 		CrontabWriteFunc = originalWrite
 	})
 
-	body := `{"playlist":{"source":"media-pi.core server","destination":"/mnt/usb/test/"},"schedule":{"playlist":["09:00"],"video":["13:00"],"rest":[]},"audio":{"output":"jack"},"screenshot":{"timers":[]}}`
+	body := `{"revision":0,"playlist":{"source":"media-pi.core server","destination":"/mnt/usb/test/"},"schedule":{"playlist":["09:00"],"video":["13:00"],"rest":[]},"audio":{"output":"jack"},"screenshot":{"timers":[]}}`
 	req := httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body))
 	req.Header.Set("Authorization", "Bearer test-key")
 	w := httptest.NewRecorder()
@@ -1812,7 +1805,7 @@ func TestHandleConfigurationUploadRejectsInvalidRestIntervals(t *testing.T) {
 		CrontabWriteFunc = originalWrite
 	})
 
-	body := `{"playlist":{"source":"/a","destination":"/b"},"schedule":{"playlist":["6:05"],"video":["22:22"],"rest":[{"start":"10:00","stop":"12:00"},{"start":"11:00","stop":"13:00"}]},"audio":{"output":"hdmi"}}`
+	body := `{"revision":0,"playlist":{"source":"/a","destination":"/b"},"schedule":{"playlist":["6:05"],"video":["22:22"],"rest":[{"start":"10:00","stop":"12:00"},{"start":"11:00","stop":"13:00"}]},"audio":{"output":"hdmi"}}`
 	req := httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body))
 	req.Header.Set("Authorization", "Bearer test-key")
 	w := httptest.NewRecorder()
@@ -1894,7 +1887,7 @@ func TestHandleConfigurationUpdateDestinationValidation(t *testing.T) {
 				CrontabWriteFunc = originalWrite
 			})
 
-			body := `{"playlist":{"source":"src","destination":"` + tc.destination + `"},"schedule":{"playlist":["08:00"],"video":["12:00"],"rest":[]},"audio":{"output":"hdmi"}}`
+			body := `{"revision":0,"playlist":{"source":"src","destination":"` + tc.destination + `"},"schedule":{"playlist":["08:00"],"video":["12:00"],"rest":[]},"audio":{"output":"hdmi"}}`
 			req := httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body))
 			req.Header.Set("Authorization", "Bearer test-key")
 			w := httptest.NewRecorder()
@@ -1969,7 +1962,7 @@ func TestHandleConfigurationUpdateDestinationNormalised(t *testing.T) {
 	})
 
 	// Destination has a trailing slash — it should be stored and written without it.
-	body := `{"playlist":{"source":"/src/","destination":"/mnt/usb/data/"},"schedule":{"playlist":["08:00"],"video":["12:00"],"rest":[]},"audio":{"output":"hdmi"}}`
+	body := `{"revision":0,"playlist":{"source":"/src/","destination":"/mnt/usb/data/"},"schedule":{"playlist":["08:00"],"video":["12:00"],"rest":[]},"audio":{"output":"hdmi"}}`
 	req := httptest.NewRequest(http.MethodPut, "/api/menu/configuration/update", strings.NewReader(body))
 	req.Header.Set("Authorization", "Bearer test-key")
 	w := httptest.NewRecorder()
@@ -2367,3 +2360,138 @@ func TestValidateRestTimePairsOverlap(t *testing.T) {
 		})
 	}
 }
+
+type settlingUnitConn struct {
+	noopDBusConnection
+	result string
+	states []string
+}
+
+func (c *settlingUnitConn) StartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	ch <- c.result
+	return 1, nil
+}
+
+func (c *settlingUnitConn) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error) {
+	state := c.states[0]
+	if len(c.states) > 1 {
+		c.states = c.states[1:]
+	}
+	return map[string]any{"ActiveState": state}, nil
+}
+
+func TestHandleUnitActionWaitsForFinalState(t *testing.T) {
+	originalFactory := dbusFactory
+	originalAllowedUnits := AllowedUnits
+	originalPoll := unitStatePollInterval
+	AllowedUnits = map[string]struct{}{"other.service": {}}
+	unitStatePollInterval = time.Millisecond
+	t.Cleanup(func() {
+		SetDBusConnectionFactory(originalFactory)
+		AllowedUnits = originalAllowedUnits
+		unitStatePollInterval = originalPoll
+	})
+
+	tests := []struct {
+		name   string
+		result string
+		states []string
+		code   int
+	}{
+		{"active", "done", []string{"activating", "activating", "active"}, http.StatusOK},
+		{"failed after start", "done", []string{"activating", "failed"}, http.StatusInternalServerError},
+		{"job failed", "failed", []string{"inactive"}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &settlingUnitConn{result: tt.result, states: tt.states}
+			SetDBusConnectionFactory(func(ctx context.Context) (DBusConnection, error) { return conn, nil })
+
+			w := httptest.NewRecorder()
+			HandleUnitAction("start")(w, httptest.NewRequest(http.MethodPost, "/api/units/start", strings.NewReader(`{"unit":"other.service","wait":true}`)))
+			if w.Code != tt.code {
+				t.Fatalf("expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+			var resp struct {
+				Data UnitActionResponse `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if want := tt.states[len(tt.states)-1]; resp.Data.ActiveState != want || resp.Data.Result != tt.result {
+				t.Fatalf("expected result %s and state %s, got %+v", tt.result, want, resp.Data)
+			}
+		})
+	}
+
+	// Without wait the job result is returned as before.
+	conn := &settlingUnitConn{result: "done", states: []string{"activating"}}
+	SetDBusConnectionFactory(func(ctx context.Context) (DBusConnection, error) { return conn, nil })
+	w := httptest.NewRecorder()
+	HandleUnitAction("start")(w, httptest.NewRequest(http.MethodPost, "/api/units/start", strings.NewReader(`{"unit":"other.service"}`)))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "activeState") {
+		t.Fatalf("expected plain job result, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+type maskingUnitConn struct {
+	noopDBusConnection
+	calls []string
+}
+
+func (c *maskingUnitConn) MaskUnitFilesContext(ctx context.Context, files []string, runtime, force bool) ([]dbus.MaskUnitFileChange, error) {
+	c.calls = append(c.calls, "mask "+strings.Join(files, " "))
+	return nil, nil
+}
+
+func (c *maskingUnitConn) UnmaskUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.UnmaskUnitFileChange, error) {
+	c.calls = append(c.calls, "unmask "+strings.Join(files, " "))
+	return nil, nil
+}
+
+func TestHandleUnitActionMaskAndUnmask(t *testing.T) {
+	originalFactory := dbusFactory
+	originalAllowedUnits := AllowedUnits
+	AllowedUnits = map[string]struct{}{"legacy-upload.service": {}}
+	t.Cleanup(func() {
+		SetDBusConnectionFactory(originalFactory)
+		AllowedUnits = originalAllowedUnits
+	})
+	conn := &maskingUnitConn{}
+	SetDBusConnectionFactory(func(ctx context.Context) (DBusConnection, error) { return conn, nil })
+
+	for action, result := range map[string]string{"mask": "masked", "unmask": "unmasked"} {
+		w := httptest.NewRecorder()
+		HandleUnitAction(action)(w, httptest.NewRequest(http.MethodPost, "/api/units/"+action, strings.NewReader(`{"unit":"legacy-upload.service"}`)))
+		var resp struct {
+			Data UnitActionResponse `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || resp.Data.Result != result {
+			t.Fatalf("%s: status %d, body %s", action, w.Code, w.Body.String())
+		}
+	}
+	w := httptest.NewRecorder()
+	HandleUnitAction("mask")(w, httptest.NewRequest(http.MethodPost, "/api/units/mask", strings.NewReader(`{"unit":"ssh.service"}`)))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("masking a unit outside allowed_units: status %d", w.Code)
+	}
+	if len(conn.calls) != 2 || !slices.Contains(conn.calls, "mask legacy-upload.service") || !slices.Contains(conn.calls, "unmask legacy-upload.service") {
+		t.Fatalf("calls = %v", conn.calls)
+	}
+}
+
+func TestWaitForUnitStateTimesOut(t *testing.T) {
+	originalTimeout := dbusOperationTimeout
+	originalPoll := unitStatePollInterval
+	dbusOperationTimeout = 20 * time.Millisecond
+	unitStatePollInterval = time.Millisecond
+	t.Cleanup(func() {
+		dbusOperationTimeout = originalTimeout
+		unitStatePollInterval = originalPoll
+	})
+
+	state, err := waitForUnitState(context.Background(), &settlingUnitConn{states: []string{"activating"}}, "other.service")
+	if !errors.Is(err, errDBusUnitOperationTimeout) || state != "activating" {
+		t.Fatalf("expected timeout in activating, got %q, %v", state, err)
+	}
+}
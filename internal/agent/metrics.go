@@ -0,0 +1,162 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetricsConfig controls the Prometheus-style /metrics endpoint. Metrics
+// are always collected in memory; the flag only exposes them.
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+}
+
+type metricKind string
+
+const (
+	metricCounter metricKind = "counter"
+	metricGauge   metricKind = "gauge"
+)
+
+type metricFamily struct {
+	kind   metricKind
+	help   string
+	values map[string]float64 // keyed by rendered label set
+}
+
+// metricsRegistry is a minimal in-process store for counters and gauges.
+type metricsRegistry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+var metrics = &metricsRegistry{families: make(map[string]*metricFamily)}
+
+// registerCounter declares a counter so it is exported even before the
+// first increment.
+func registerCounter(name, help string) {
+	metrics.register(name, metricCounter, help)
+}
+
+// registerGauge declares a gauge.
+func registerGauge(name, help string) {
+	metrics.register(name, metricGauge, help)
+}
+
+// metricAdd increments a counter. labels are key/value pairs.
+func metricAdd(name string, delta float64, labels ...string) {
+	metrics.update(name, labels, func(v float64) float64 { return v + delta })
+}
+
+// metricSet sets a gauge to value. labels are key/value pairs.
+func metricSet(name string, value float64, labels ...string) {
+	metrics.update(name, labels, func(float64) float64 { return value })
+}
+
+// metricValue returns the current value of a series, for tests and status
+// reporting.
+func metricValue(name string, labels ...string) float64 {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	family, ok := metrics.families[name]
+	if !ok {
+		return 0
+	}
+	return family.values[renderMetricLabels(labels)]
+}
+
+func (r *metricsRegistry) register(name string, kind metricKind, help string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if family, ok := r.families[name]; ok {
+		family.kind, family.help = kind, help
+		return
+	}
+	r.families[name] = &metricFamily{kind: kind, help: help, values: make(map[string]float64)}
+}
+
+func (r *metricsRegistry) update(name string, labels []string, fn func(float64) float64) {
+	key := renderMetricLabels(labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	family, ok := r.families[name]
+	if !ok {
+		family = &metricFamily{kind: metricGauge, values: make(map[string]float64)}
+		r.families[name] = family
+	}
+	family.values[key] = fn(family.values[key])
+}
+
+func renderMetricLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%s", labels[i], strconv.Quote(labels[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// writeMetrics renders all metrics in the Prometheus text format.
+func writeMetrics(w io.Writer) error {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	names := make([]string, 0, len(metrics.families))
+	for name := range metrics.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := metrics.families[name]
+		if family.help != "" {
+			if _, err := fmt.Fprintf(w, "# HELP %s %s\n", name, family.help); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", name, family.kind); err != nil {
+			return err
+		}
+		if len(family.values) == 0 {
+			if _, err := fmt.Fprintf(w, "%s 0\n", name); err != nil {
+				return err
+			}
+			continue
+		}
+		keys := make([]string, 0, len(family.values))
+		for key := range family.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := strconv.FormatFloat(family.values[key], 'g', -1, 64)
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", name, key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HandleMetrics exposes collected metrics when metrics.enabled is set.
+func HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	if !GetCurrentConfig().Metrics.Enabled {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Метрики отключены"})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = writeMetrics(w)
+}
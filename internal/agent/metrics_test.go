@@ -0,0 +1,50 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetricsRendersPrometheusText(t *testing.T) {
+	registerCounter("media_pi_test_events_total", "Test events.")
+	metricAdd("media_pi_test_events_total", 2, "kind", "a")
+	metricAdd("media_pi_test_events_total", 1, "kind", "a")
+	metricSet("media_pi_test_level", 7)
+
+	var b strings.Builder
+	if err := writeMetrics(&b); err != nil {
+		t.Fatalf("writeMetrics() error = %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# HELP media_pi_test_events_total Test events.\n",
+		"# TYPE media_pi_test_events_total counter\n",
+		"media_pi_test_events_total{kind=\"a\"} 3\n",
+		"media_pi_test_level 7\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHandleMetricsRequiresEnabled(t *testing.T) {
+	setCurrentConfigForTest(t, Config{})
+	rr := httptest.NewRecorder()
+	HandleMetrics(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when disabled, got %d", rr.Code)
+	}
+
+	setCurrentConfigForTest(t, Config{Metrics: MetricsConfig{Enabled: true}})
+	rr = httptest.NewRecorder()
+	HandleMetrics(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), metricCleanupRuns) {
+		t.Fatalf("expected metrics output, got %d %q", rr.Code, rr.Body.String())
+	}
+}
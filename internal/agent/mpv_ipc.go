@@ -0,0 +1,129 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const mpvIPCTimeout = 5 * time.Second
+
+// mpvConn is a connection to the JSON IPC socket of an mpv player.
+type mpvConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int
+}
+
+type mpvResponse struct {
+	RequestID *int            `json:"request_id"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func dialMPV(ctx context.Context, socket string) (*mpvConn, error) {
+	var dialer net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, mpvIPCTimeout)
+	defer cancel()
+	conn, err := dialer.DialContext(dialCtx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	return &mpvConn{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// command sends one command and waits for its reply, skipping the events
+// mpv interleaves with replies.
+func (c *mpvConn) command(args any) (json.RawMessage, error) {
+	c.nextID++
+	id := c.nextID
+	line, err := json.Marshal(map[string]any{"command": args, "request_id": id})
+	if err != nil {
+		return nil, err
+	}
+	_ = c.conn.SetDeadline(time.Now().Add(mpvIPCTimeout))
+	defer func() { _ = c.conn.SetDeadline(time.Time{}) }()
+	if _, err := c.conn.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	for {
+		reply, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		var resp mpvResponse
+		if err := json.Unmarshal(reply, &resp); err != nil || resp.RequestID == nil || *resp.RequestID != id {
+			continue
+		}
+		if resp.Error != "success" {
+			return nil, fmt.Errorf("mpv: %s", resp.Error)
+		}
+		return resp.Data, nil
+	}
+}
+
+// drain discards events until the connection is closed, so mpv never
+// blocks on a client that keeps the connection open.
+func (c *mpvConn) drain() {
+	_, _ = io.Copy(io.Discard, c.reader)
+}
+
+func (c *mpvConn) Close() error {
+	return c.conn.Close()
+}
+
+// mpvCommand runs a single command on socket.
+func mpvCommand(ctx context.Context, socket string, args any) (json.RawMessage, error) {
+	conn, err := dialMPV(ctx, socket)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	return conn.command(args)
+}
+
+// playerIPCSockets returns the mpv IPC sockets of all players: one per
+// display output when player.ipc_socket contains {output} and displays are
+// configured.
+func playerIPCSockets(config Config) []string {
+	players := playerIPCOutputs(config)
+	if players == nil {
+		return nil
+	}
+	sockets := make([]string, 0, len(players))
+	for _, player := range players {
+		sockets = append(sockets, player.Socket)
+	}
+	return sockets
+}
+
+// playerIPC is the IPC socket of the player of one display output; Output
+// is empty for a single player.
+type playerIPC struct {
+	Output string
+	Socket string
+}
+
+// playerIPCOutputs is playerIPCSockets with the output of each socket.
+func playerIPCOutputs(config Config) []playerIPC {
+	socket := strings.TrimSpace(config.Player.IPCSocket)
+	if socket == "" {
+		return nil
+	}
+	if !strings.Contains(socket, "{output}") || len(config.Displays) == 0 {
+		return []playerIPC{{Socket: socket}}
+	}
+	players := make([]playerIPC, 0, len(config.Displays))
+	for _, display := range config.Displays {
+		players = append(players, playerIPC{Output: display.Output, Socket: strings.ReplaceAll(socket, "{output}", display.Output)})
+	}
+	return players
+}
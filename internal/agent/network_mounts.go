@@ -0,0 +1,605 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NetworkMountConfig describes a network share mounted through a
+// generated systemd mount unit, e.g. the Yandex.Disk WebDAV share at
+// /mnt/ya.disk that playlist.source points to.
+type NetworkMountConfig struct {
+	MountPoint string `yaml:"mount_point" json:"mountPoint"`
+	// Type is cifs, nfs or davfs.
+	Type string `yaml:"type" json:"type"`
+	// Source is //server/share for cifs, server:/export for nfs and an
+	// http(s) URL for davfs.
+	Source string `yaml:"source" json:"source"`
+	// Options are added to the mount options the agent sets itself.
+	Options  string `yaml:"options,omitempty" json:"options,omitempty"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"-"`
+	// Automount mounts the share on first access instead of at boot, so
+	// an unreachable server does not delay startup.
+	Automount bool `yaml:"automount,omitempty" json:"automount,omitempty"`
+}
+
+// Network filesystem types.
+const (
+	networkMountCIFS  = "cifs"
+	networkMountNFS   = "nfs"
+	networkMountDavfs = "davfs"
+)
+
+// networkMountOptions are set on every network mount: the share waits for
+// the network and a missing server does not fail the boot.
+const networkMountOptions = "_netdev,nofail"
+
+// davfsSecretsMarker tags the davfs2 secrets lines written by the agent.
+const davfsSecretsMarker = "# media-pi mount"
+
+var (
+	// NetworkMountCredentialsDir holds the CIFS credential files.
+	NetworkMountCredentialsDir = "/etc/media-pi-agent/mounts"
+	// DavfsSecretsPath is the system-wide davfs2 secrets file.
+	DavfsSecretsPath = "/etc/davfs2/secrets"
+
+	// networkMountProbeTimeout bounds the health check of a share, which
+	// hangs on a dead server instead of failing.
+	networkMountProbeTimeout = 5 * time.Second
+
+	// probeNetworkMount checks that a mounted share answers. Tests may
+	// override it.
+	probeNetworkMount = func(path string) error {
+		_, err := os.ReadDir(path)
+		return err
+	}
+
+	networkMountLock sync.Mutex
+)
+
+// NetworkMountRequest is the body of POST /api/storage/network. An empty
+// password keeps the stored one.
+type NetworkMountRequest struct {
+	NetworkMountConfig
+	Password string `json:"password,omitempty"`
+}
+
+// NetworkMountTarget selects a share in mount, unmount and delete
+// requests.
+type NetworkMountTarget struct {
+	MountPoint string `json:"mountPoint"`
+}
+
+// NetworkMountStatus reports a share and its health.
+type NetworkMountStatus struct {
+	NetworkMountConfig
+	Unit    string `json:"unit"`
+	Mounted bool   `json:"mounted"`
+	// Healthy is set when the mounted share answered a directory listing
+	// within the probe timeout.
+	Healthy   bool  `json:"healthy"`
+	LatencyMs int64 `json:"latencyMs,omitempty"`
+	// HasPassword tells whether credentials are stored without revealing
+	// them.
+	HasPassword bool   `json:"hasPassword,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func validateNetworkMount(mount NetworkMountConfig) error {
+	if err := validateMountPoint(mount.MountPoint); err != nil {
+		return err
+	}
+	if mount.Source == "" || strings.ContainsAny(mount.Source, " \t\n#\\") {
+		return fmt.Errorf("недопустимое значение source")
+	}
+	switch mount.Type {
+	case networkMountCIFS:
+		if !strings.HasPrefix(mount.Source, "//") {
+			return fmt.Errorf("source для cifs должен иметь вид //server/share")
+		}
+	case networkMountNFS:
+		if host, path, ok := strings.Cut(mount.Source, ":"); !ok || host == "" || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("source для nfs должен иметь вид server:/export")
+		}
+		if mount.Username != "" || mount.Password != "" {
+			return fmt.Errorf("nfs не поддерживает имя пользователя и пароль")
+		}
+	case networkMountDavfs:
+		if !strings.HasPrefix(mount.Source, "http://") && !strings.HasPrefix(mount.Source, "https://") {
+			return fmt.Errorf("source для davfs должен быть адресом http:// или https://")
+		}
+	default:
+		return fmt.Errorf("неподдерживаемый тип сетевого монтирования: %s", mount.Type)
+	}
+	if strings.ContainsAny(mount.Options, " \t\n#\\") || strings.Contains(mount.Options, "credentials=") {
+		return fmt.Errorf("недопустимое значение options")
+	}
+	if strings.ContainsAny(mount.Username+mount.Password, "\n\r\x00") {
+		return fmt.Errorf("недопустимые учётные данные")
+	}
+	return nil
+}
+
+func validateNetworkMounts(mounts []NetworkMountConfig) error {
+	seen := make(map[string]bool, len(mounts))
+	for _, mount := range mounts {
+		if err := validateNetworkMount(mount); err != nil {
+			return fmt.Errorf("storage.network %s: %w", mount.MountPoint, err)
+		}
+		if seen[mount.MountPoint] {
+			return fmt.Errorf("storage.network: duplicate mount point %s", mount.MountPoint)
+		}
+		seen[mount.MountPoint] = true
+	}
+	return nil
+}
+
+func findNetworkMount(mounts []NetworkMountConfig, mountPoint string) (NetworkMountConfig, bool) {
+	for _, mount := range mounts {
+		if mount.MountPoint == mountPoint {
+			return mount, true
+		}
+	}
+	return NetworkMountConfig{}, false
+}
+
+func networkMountUnit(mountPoint string) string {
+	return systemdEscapePath(mountPoint) + ".mount"
+}
+
+func networkAutomountUnit(mountPoint string) string {
+	return systemdEscapePath(mountPoint) + ".automount"
+}
+
+func networkMountCredentialsPath(mountPoint string) string {
+	return filepath.Join(NetworkMountCredentialsDir, systemdEscapePath(mountPoint)+".cred")
+}
+
+// networkMountOptionsFor returns the mount options of the unit.
+func networkMountOptionsFor(mount NetworkMountConfig) string {
+	options := []string{networkMountOptions}
+	if mount.Type == networkMountCIFS {
+		if mount.Username != "" || mount.Password != "" {
+			options = append(options, "credentials="+networkMountCredentialsPath(mount.MountPoint))
+		} else {
+			options = append(options, "guest")
+		}
+	}
+	if mount.Options != "" {
+		options = append(options, mount.Options)
+	}
+	return strings.Join(options, ",")
+}
+
+func renderNetworkMountUnit(mount NetworkMountConfig) string {
+	install := "\n[Install]\nWantedBy=remote-fs.target\n"
+	if mount.Automount {
+		// The automount unit is enabled instead.
+		install = ""
+	}
+	return fmt.Sprintf(`[Unit]
+Description=Media Pi network share (%s)
+Wants=network-online.target
+After=network-online.target
+
+[Mount]
+What=%s
+Where=%s
+Type=%s
+Options=%s
+TimeoutSec=30
+%s`, mount.MountPoint, mount.Source, mount.MountPoint, mount.Type, networkMountOptionsFor(mount), install)
+}
+
+func renderNetworkAutomountUnit(mount NetworkMountConfig) string {
+	return fmt.Sprintf(`[Unit]
+Description=Media Pi network share automount (%s)
+
+[Automount]
+Where=%s
+
+[Install]
+WantedBy=remote-fs.target
+`, mount.MountPoint, mount.MountPoint)
+}
+
+// quoteDavfsSecret quotes a davfs2 secrets field.
+func quoteDavfsSecret(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
+
+// updateDavfsSecrets replaces the agent-managed line for mountPoint; a nil
+// mount only removes it.
+func updateDavfsSecrets(mountPoint string, mount *NetworkMountConfig) error {
+	data, err := os.ReadFile(DavfsSecretsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read davfs2 secrets: %w", err)
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == mountPoint && strings.HasSuffix(line, davfsSecretsMarker) {
+			continue
+		}
+		if line != "" || len(lines) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	if mount != nil && (mount.Username != "" || mount.Password != "") {
+		lines = append(lines, fmt.Sprintf("%s %s %s %s", mountPoint, quoteDavfsSecret(mount.Username), quoteDavfsSecret(mount.Password), davfsSecretsMarker))
+	}
+	if err := os.MkdirAll(filepath.Dir(DavfsSecretsPath), 0755); err != nil {
+		return err
+	}
+	content := ""
+	if len(lines) > 0 {
+		content = strings.Join(lines, "\n") + "\n"
+	}
+	// davfs2 refuses a secrets file readable by others.
+	tmpPath := DavfsSecretsPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write davfs2 secrets: %w", err)
+	}
+	if err := os.Rename(tmpPath, DavfsSecretsPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to rename davfs2 secrets: %w", err)
+	}
+	return nil
+}
+
+// writeNetworkMountCredentials stores the credentials where the mount
+// helper of the share type reads them, never in the unit file.
+func writeNetworkMountCredentials(mount NetworkMountConfig) error {
+	credentials := networkMountCredentialsPath(mount.MountPoint)
+	switch mount.Type {
+	case networkMountCIFS:
+		if mount.Username == "" && mount.Password == "" {
+			if err := os.Remove(credentials); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}
+		if err := os.MkdirAll(NetworkMountCredentialsDir, 0700); err != nil {
+			return err
+		}
+		return writeSecretFile(credentials, fmt.Sprintf("username=%s\npassword=%s\n", mount.Username, mount.Password))
+	case networkMountDavfs:
+		return updateDavfsSecrets(mount.MountPoint, &mount)
+	}
+	return nil
+}
+
+// writeSecretFile writes content to path with mode 0600 through a
+// temporary file.
+func writeSecretFile(path, content string) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// writeNetworkMountUnits writes the mount unit and, with automount, the
+// automount unit, removing a stale automount unit otherwise.
+func writeNetworkMountUnits(mount NetworkMountConfig) error {
+	if err := writeSystemFile(filepath.Join(SystemdUnitDir, networkMountUnit(mount.MountPoint)), renderNetworkMountUnit(mount)); err != nil {
+		return fmt.Errorf("failed to write mount unit: %w", err)
+	}
+	automount := filepath.Join(SystemdUnitDir, networkAutomountUnit(mount.MountPoint))
+	if !mount.Automount {
+		return removeSystemFile(automount)
+	}
+	if err := writeSystemFile(automount, renderNetworkAutomountUnit(mount)); err != nil {
+		return fmt.Errorf("failed to write automount unit: %w", err)
+	}
+	return nil
+}
+
+// activateNetworkMount reloads systemd, enables the share and mounts it,
+// or arms the automount.
+func activateNetworkMount(parent context.Context, mount NetworkMountConfig) error {
+	conn, err := getDBusConnection(parent)
+	if err != nil {
+		return fmt.Errorf("connect to D-Bus: %w", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(parent, dbusTimeout())
+	defer cancel()
+	if err := conn.ReloadContext(ctx); err != nil {
+		return fmt.Errorf("daemon reload: %w", err)
+	}
+	unit := networkMountUnit(mount.MountPoint)
+	if mount.Automount {
+		// A mount unit left active from before keeps serving until the
+		// automount takes over.
+		unit = networkAutomountUnit(mount.MountPoint)
+		_, _ = conn.DisableUnitFilesContext(ctx, []string{networkMountUnit(mount.MountPoint)}, false)
+	}
+	if _, _, err := conn.EnableUnitFilesContext(ctx, []string{unit}, false, true); err != nil {
+		return fmt.Errorf("enable %s: %w", unit, err)
+	}
+	if _, err := runDBusUnitOperation(parent, conn, dbusUnitOperationRestart, unit); err != nil {
+		return fmt.Errorf("start %s: %w", unit, err)
+	}
+	return nil
+}
+
+// runNetworkMountOperation mounts or unmounts a share through its unit.
+func runNetworkMountOperation(parent context.Context, mountPoint string, operation dbusUnitOperation) error {
+	conn, err := getDBusConnection(parent)
+	if err != nil {
+		return fmt.Errorf("connect to D-Bus: %w", err)
+	}
+	defer conn.Close()
+	result, err := runDBusUnitOperation(parent, conn, operation, networkMountUnit(mountPoint))
+	if err != nil {
+		return err
+	}
+	if result != "done" {
+		return fmt.Errorf("%s %s: %s", operation, networkMountUnit(mountPoint), result)
+	}
+	return nil
+}
+
+// updateNetworkMounts replaces the configured shares and saves the
+// configuration.
+func updateNetworkMounts(update func([]NetworkMountConfig) []NetworkMountConfig) error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	if currentConfig == nil {
+		return fmt.Errorf("configuration not loaded")
+	}
+	previous := currentConfig.Storage.Network
+	currentConfig.Storage.Network = update(slices.Clone(previous))
+	if err := saveCurrentConfig("storage"); err != nil {
+		currentConfig.Storage.Network = previous
+		return err
+	}
+	return nil
+}
+
+// defineNetworkMount creates or updates a share and mounts it.
+func defineNetworkMount(ctx context.Context, mount NetworkMountConfig) error {
+	networkMountLock.Lock()
+	defer networkMountLock.Unlock()
+
+	if existing, ok := findNetworkMount(GetCurrentConfig().Storage.Network, mount.MountPoint); ok && mount.Password == "" && mount.Username == existing.Username {
+		mount.Password = existing.Password
+	}
+	if err := validateNetworkMount(mount); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mount.MountPoint, 0755); err != nil {
+		return fmt.Errorf("create mount point: %w", err)
+	}
+	if err := writeNetworkMountCredentials(mount); err != nil {
+		return fmt.Errorf("write credentials: %w", err)
+	}
+	if err := writeNetworkMountUnits(mount); err != nil {
+		return err
+	}
+	if err := updateNetworkMounts(func(mounts []NetworkMountConfig) []NetworkMountConfig {
+		mounts = slices.DeleteFunc(mounts, func(m NetworkMountConfig) bool { return m.MountPoint == mount.MountPoint })
+		return append(mounts, mount)
+	}); err != nil {
+		return fmt.Errorf("save configuration: %w", err)
+	}
+	log.Printf("Configured network mount %s (%s %s)", mount.MountPoint, mount.Type, mount.Source)
+	return activateNetworkMount(ctx, mount)
+}
+
+// removeNetworkMount unmounts a share and removes its units, credentials
+// and configuration.
+func removeNetworkMount(ctx context.Context, mountPoint string) error {
+	networkMountLock.Lock()
+	defer networkMountLock.Unlock()
+
+	mount, ok := findNetworkMount(GetCurrentConfig().Storage.Network, mountPoint)
+	if !ok {
+		return errNetworkMountNotFound
+	}
+
+	conn, err := getDBusConnection(ctx)
+	if err != nil {
+		return fmt.Errorf("connect to D-Bus: %w", err)
+	}
+	defer conn.Close()
+	// The automount goes first, or it would mount the share again.
+	units := []string{networkAutomountUnit(mountPoint), networkMountUnit(mountPoint)}
+	if !mount.Automount {
+		units = units[1:]
+	}
+	for _, unit := range units {
+		if _, err := runDBusUnitOperation(ctx, conn, dbusUnitOperationStop, unit); err != nil {
+			log.Printf("Warning: failed to stop %s: %v", unit, err)
+		}
+	}
+	disableCtx, cancel := context.WithTimeout(ctx, dbusTimeout())
+	defer cancel()
+	if _, err := conn.DisableUnitFilesContext(disableCtx, units, false); err != nil {
+		log.Printf("Warning: failed to disable %s: %v", mountPoint, err)
+	}
+	for _, unit := range units {
+		if err := removeSystemFile(filepath.Join(SystemdUnitDir, unit)); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(networkMountCredentialsPath(mountPoint)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if mount.Type == networkMountDavfs {
+		if err := updateDavfsSecrets(mountPoint, nil); err != nil {
+			return err
+		}
+	}
+	if err := conn.ReloadContext(disableCtx); err != nil {
+		log.Printf("Warning: daemon reload failed: %v", err)
+	}
+	if err := updateNetworkMounts(func(mounts []NetworkMountConfig) []NetworkMountConfig {
+		return slices.DeleteFunc(mounts, func(m NetworkMountConfig) bool { return m.MountPoint == mountPoint })
+	}); err != nil {
+		return fmt.Errorf("save configuration: %w", err)
+	}
+	log.Printf("Removed network mount %s", mountPoint)
+	return nil
+}
+
+// errNetworkMountNotFound is returned for a mount point that is not a
+// configured share.
+var errNetworkMountNotFound = errors.New("network mount not found")
+
+// networkMountStatus checks whether a share is mounted and answers.
+func networkMountStatus(mount NetworkMountConfig) NetworkMountStatus {
+	status := NetworkMountStatus{NetworkMountConfig: mount, Unit: networkMountUnit(mount.MountPoint), HasPassword: mount.Password != ""}
+	mounted, err := isMounted(mount.MountPoint)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Mounted = mounted
+	if !mounted {
+		if !mount.Automount {
+			status.Error = "not mounted"
+		}
+		return status
+	}
+
+	// A hung server blocks the listing; the goroutine is left behind
+	// rather than the request.
+	start := time.Now()
+	done := make(chan error, 1)
+	probe := probeNetworkMount
+	go func() { done <- probe(mount.MountPoint) }()
+	select {
+	case err := <-done:
+		status.LatencyMs = time.Since(start).Milliseconds()
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Healthy = true
+		}
+	case <-time.After(networkMountProbeTimeout):
+		status.Error = fmt.Sprintf("no answer within %s", networkMountProbeTimeout)
+	}
+	return status
+}
+
+func listNetworkMounts() []NetworkMountStatus {
+	statuses := []NetworkMountStatus{}
+	for _, mount := range GetCurrentConfig().Storage.Network {
+		statuses = append(statuses, networkMountStatus(mount))
+	}
+	return statuses
+}
+
+// checkNetworkMounts is the self-test check of the configured shares. An
+// automount share that is not mounted yet counts as healthy.
+func checkNetworkMounts(config Config) HealthCheck {
+	var failed []string
+	for _, mount := range config.Storage.Network {
+		if status := networkMountStatus(mount); !status.Healthy && status.Error != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", mount.MountPoint, status.Error))
+		}
+	}
+	if len(failed) > 0 {
+		return HealthCheck{Name: "network_mounts", OK: false, Detail: strings.Join(failed, "; ")}
+	}
+	return HealthCheck{Name: "network_mounts", OK: true}
+}
+
+// HandleNetworkMounts lists the network shares with their health on GET
+// and creates or updates a share on POST.
+func HandleNetworkMounts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: listNetworkMounts()})
+	case http.MethodPost:
+		var req NetworkMountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный JSON в теле запроса"})
+			return
+		}
+		mount := req.NetworkMountConfig
+		mount.Password = req.Password
+		mount.Source = strings.TrimSpace(mount.Source)
+		mount.Type = strings.TrimSpace(mount.Type)
+		if err := validateNetworkMount(mount); err != nil {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: err.Error()})
+			return
+		}
+		if err := defineNetworkMount(r.Context(), mount); err != nil {
+			log.Printf("Failed to configure network mount %s: %v", mount.MountPoint, err)
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось настроить монтирование: %v", err)})
+			return
+		}
+		current, _ := findNetworkMount(GetCurrentConfig().Storage.Network, mount.MountPoint)
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: networkMountStatus(current)})
+	case http.MethodDelete:
+		var req NetworkMountTarget
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный JSON в теле запроса"})
+			return
+		}
+		if err := removeNetworkMount(r.Context(), req.MountPoint); err != nil {
+			if errors.Is(err, errNetworkMountNotFound) {
+				JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Сетевое монтирование не найдено: %v", req.MountPoint)})
+				return
+			}
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось удалить монтирование: %v", err)})
+			return
+		}
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true})
+	default:
+		JSONResponse(w, http.StatusMethodNotAllowed, APIResponse{OK: false, ErrMsg: "Метод не разрешён"})
+	}
+}
+
+// HandleNetworkMountAction returns a handler that mounts ("mount") or
+// unmounts ("unmount") a configured share.
+func HandleNetworkMountAction(action string) http.HandlerFunc {
+	operation := dbusUnitOperationStart
+	if action == "unmount" {
+		operation = dbusUnitOperationStop
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+		var req NetworkMountTarget
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный JSON в теле запроса"})
+			return
+		}
+		mount, ok := findNetworkMount(GetCurrentConfig().Storage.Network, req.MountPoint)
+		if !ok {
+			JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Сетевое монтирование не найдено: %v", req.MountPoint)})
+			return
+		}
+		if err := runNetworkMountOperation(r.Context(), mount.MountPoint, operation); err != nil {
+			log.Printf("Failed to %s %s: %v", action, mount.MountPoint, err)
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Выполнение действия завершилось с ошибкой: %v", err)})
+			return
+		}
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: networkMountStatus(mount)})
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateNetworkMount(t *testing.T) {
+	valid := []NetworkMountConfig{
+		{MountPoint: "/mnt/ya.disk", Type: "davfs", Source: "https://webdav.yandex.ru", Username: "user", Password: "secret"},
+		{MountPoint: "/mnt/share", Type: "cifs", Source: "//nas/media", Options: "vers=3.0,uid=1000"},
+		{MountPoint: "/media/nfs", Type: "nfs", Source: "nas:/export/media"},
+	}
+	for _, mount := range valid {
+		if err := validateNetworkMount(mount); err != nil {
+			t.Errorf("validateNetworkMount(%+v) error = %v", mount, err)
+		}
+	}
+	invalid := []NetworkMountConfig{
+		{MountPoint: "/etc", Type: "cifs", Source: "//nas/media"},
+		{MountPoint: "/mnt/share", Type: "smb", Source: "//nas/media"},
+		{MountPoint: "/mnt/share", Type: "cifs", Source: "nas/media"},
+		{MountPoint: "/mnt/share", Type: "nfs", Source: "nas:/export", Username: "user"},
+		{MountPoint: "/mnt/share", Type: "davfs", Source: "ftp://nas"},
+		{MountPoint: "/mnt/share", Type: "cifs", Source: "//nas/media", Options: "credentials=/root/x"},
+		{MountPoint: "/mnt/share", Type: "cifs", Source: "//nas/media", Password: "a\nb"},
+	}
+	for _, mount := range invalid {
+		if err := validateNetworkMount(mount); err == nil {
+			t.Errorf("expected %+v to be rejected", mount)
+		}
+	}
+	if err := validateNetworkMounts(append(valid, valid[0])); err == nil {
+		t.Error("expected a duplicate mount point to be rejected")
+	}
+}
+
+func TestWriteNetworkMountUnitsAndCredentials(t *testing.T) {
+	unitDir := setSystemdUnitDirForTest(t)
+	originalDir, originalSecrets := NetworkMountCredentialsDir, DavfsSecretsPath
+	NetworkMountCredentialsDir = filepath.Join(t.TempDir(), "mounts")
+	DavfsSecretsPath = filepath.Join(t.TempDir(), "davfs2", "secrets")
+	t.Cleanup(func() { NetworkMountCredentialsDir, DavfsSecretsPath = originalDir, originalSecrets })
+
+	cifs := NetworkMountConfig{MountPoint: "/mnt/share", Type: "cifs", Source: "//nas/media", Username: "user", Password: "p@ss"}
+	if err := writeNetworkMountCredentials(cifs); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeNetworkMountUnits(cifs); err != nil {
+		t.Fatal(err)
+	}
+	unit, _ := os.ReadFile(filepath.Join(unitDir, "mnt-share.mount"))
+	credentials := networkMountCredentialsPath(cifs.MountPoint)
+	for _, want := range []string{"What=//nas/media", "Type=cifs", "Options=_netdev,nofail,credentials=" + credentials, "WantedBy=remote-fs.target"} {
+		if !strings.Contains(string(unit), want) {
+			t.Errorf("mount unit missing %q:\n%s", want, unit)
+		}
+	}
+	if strings.Contains(string(unit), "p@ss") {
+		t.Error("the password leaked into the unit file")
+	}
+	info, err := os.Stat(credentials)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("credentials file: %v, %v", info, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(DavfsSecretsPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(DavfsSecretsPath, []byte("/mnt/other user pass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	davfs := NetworkMountConfig{MountPoint: "/mnt/ya.disk", Type: "davfs", Source: "https://webdav.yandex.ru", Username: "user", Password: `pa"ss`, Automount: true}
+	for range 2 {
+		if err := writeNetworkMountCredentials(davfs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secrets, _ := os.ReadFile(DavfsSecretsPath)
+	want := "/mnt/other user pass\n/mnt/ya.disk \"user\" \"pa\\\"ss\" " + davfsSecretsMarker + "\n"
+	if string(secrets) != want {
+		t.Fatalf("davfs2 secrets = %q, want %q", secrets, want)
+	}
+	if err := writeNetworkMountUnits(davfs); err != nil {
+		t.Fatal(err)
+	}
+	if unit, _ := os.ReadFile(filepath.Join(unitDir, "mnt-ya.disk.mount")); strings.Contains(string(unit), "[Install]") {
+		t.Errorf("an automounted share must not be wanted at boot:\n%s", unit)
+	}
+	if _, err := os.Stat(filepath.Join(unitDir, "mnt-ya.disk.automount")); err != nil {
+		t.Fatalf("automount unit: %v", err)
+	}
+
+	if err := updateDavfsSecrets(davfs.MountPoint, nil); err != nil {
+		t.Fatal(err)
+	}
+	if secrets, _ := os.ReadFile(DavfsSecretsPath); string(secrets) != "/mnt/other user pass\n" {
+		t.Fatalf("davfs2 secrets after removal = %q", secrets)
+	}
+}
+
+func TestNetworkMountStatus(t *testing.T) {
+	setMountsForTest(t, "https://webdav.yandex.ru /mnt/ya.disk fuse rw 0 0\n")
+	originalProbe, originalTimeout := probeNetworkMount, networkMountProbeTimeout
+	t.Cleanup(func() { probeNetworkMount, networkMountProbeTimeout = originalProbe, originalTimeout })
+	networkMountProbeTimeout = 20 * time.Millisecond
+
+	mount := NetworkMountConfig{MountPoint: "/mnt/ya.disk", Type: "davfs", Source: "https://webdav.yandex.ru", Password: "secret"}
+	probeNetworkMount = func(string) error { return nil }
+	if status := networkMountStatus(mount); !status.Mounted || !status.Healthy || !status.HasPassword {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	hang := make(chan struct{})
+	t.Cleanup(func() { close(hang) })
+	probeNetworkMount = func(string) error { <-hang; return nil }
+	if status := networkMountStatus(mount); status.Healthy || !strings.Contains(status.Error, "no answer") {
+		t.Fatalf("expected a hung share to be unhealthy, got %+v", status)
+	}
+
+	probeNetworkMount = func(string) error { return errors.New("stale file handle") }
+	check := checkNetworkMounts(Config{Storage: StorageConfig{Network: []NetworkMountConfig{mount, {MountPoint: "/mnt/nas", Type: "nfs", Source: "nas:/x", Automount: true}}}})
+	if check.OK || check.Detail != "/mnt/ya.disk: stale file handle" {
+		t.Fatalf("unexpected check %+v", check)
+	}
+}
+
+func TestConfigSecretsIncludeNetworkPasswords(t *testing.T) {
+	config := Config{Storage: StorageConfig{Network: []NetworkMountConfig{{MountPoint: "/mnt/share", Password: "secret"}}}}
+	masked := config
+	for _, secret := range configSecrets(&masked) {
+		*secret.value = maskedSecret
+	}
+	if masked.Storage.Network[0].Password != maskedSecret {
+		t.Fatal("the network password is not a secret")
+	}
+	if config.Storage.Network[0].Password != "secret" {
+		t.Fatal("masking a copy changed the original configuration")
+	}
+}
+
+func TestHandleNetworkMountActionUnknownMount(t *testing.T) {
+	setCurrentConfigForTest(t, Config{})
+	w := httptest.NewRecorder()
+	HandleNetworkMountAction("mount")(w, httptest.NewRequest(http.MethodPost, "/api/storage/network/mount", strings.NewReader(`{"mountPoint":"/mnt/none"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", w.Code)
+	}
+	w = httptest.NewRecorder()
+	HandleNetworkMounts(w, httptest.NewRequest(http.MethodPost, "/api/storage/network", strings.NewReader(`{"mountPoint":"/mnt/share","type":"smb","source":"//nas/x"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+}
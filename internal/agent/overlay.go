@@ -0,0 +1,375 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Overlay defaults and limits.
+const (
+	DefaultOverlayDuration = 30 * time.Second
+	maxOverlayDuration     = 24 * time.Hour
+	defaultOverlayFontSize = 56
+	defaultOverlayColor    = "#FFFFFF"
+	defaultOverlayPosition = "bottom"
+)
+
+// Text overlays are drawn in a fixed 1920x1080 space that mpv scales to the
+// output.
+const (
+	overlayResX = 1920
+	overlayResY = 1080
+	// overlayTextID and overlayImageID identify the agent's overlays in mpv.
+	overlayTextID  = 1
+	overlayImageID = 0
+)
+
+// OverlayImageDir receives the raw BGRA image handed to mpv. Tests may
+// override it.
+var OverlayImageDir = "/run/media-pi"
+
+var overlayColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+var errOverlayUnavailable = errors.New("player.ipc_socket is not set")
+
+// OverlayRequest is the body of POST /api/playback/overlay.
+type OverlayRequest struct {
+	Text string `json:"text"`
+	// Image is a media file relative to the media directory.
+	Image           string `json:"image"`
+	DurationSeconds int    `json:"durationSeconds"`
+	// Position of the text banner: top, center or bottom.
+	Position string `json:"position"`
+	FontSize int    `json:"fontSize"`
+	// Color and Background are #RRGGBB; no band is drawn without a
+	// background.
+	Color      string `json:"color"`
+	Background string `json:"background"`
+	// X and Y place the image's top left corner in output pixels.
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// OverlayStatus describes the overlay on screen.
+type OverlayStatus struct {
+	Active    bool   `json:"active"`
+	Text      string `json:"text,omitempty"`
+	Image     string `json:"image,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+}
+
+// osd-overlay overlays belong to the IPC client that created them, so the
+// connections showing text stay open until the overlay is cleared.
+var (
+	overlayLock       sync.Mutex
+	overlayStatus     OverlayStatus
+	overlayTextConns  []*mpvConn
+	overlayImagePath  string
+	overlayTimer      *time.Timer
+	overlayGeneration int
+)
+
+func normalizeOverlayRequest(req OverlayRequest) (OverlayRequest, error) {
+	req.Image = strings.TrimSpace(req.Image)
+	req.Position = strings.ToLower(strings.TrimSpace(req.Position))
+	if strings.TrimSpace(req.Text) == "" && req.Image == "" {
+		return req, errors.New("text or image is required")
+	}
+	if req.DurationSeconds < 0 || time.Duration(req.DurationSeconds)*time.Second > maxOverlayDuration {
+		return req, fmt.Errorf("durationSeconds must be between 0 and %d", int(maxOverlayDuration.Seconds()))
+	}
+	if req.Position == "" {
+		req.Position = defaultOverlayPosition
+	}
+	switch req.Position {
+	case "top", "center", "bottom":
+	default:
+		return req, fmt.Errorf("invalid position %q", req.Position)
+	}
+	if req.FontSize == 0 {
+		req.FontSize = defaultOverlayFontSize
+	}
+	if req.FontSize < 8 || req.FontSize > 300 {
+		return req, fmt.Errorf("fontSize must be between 8 and 300")
+	}
+	if req.Color == "" {
+		req.Color = defaultOverlayColor
+	}
+	if !overlayColorPattern.MatchString(req.Color) {
+		return req, fmt.Errorf("invalid color %q", req.Color)
+	}
+	if req.Background != "" && !overlayColorPattern.MatchString(req.Background) {
+		return req, fmt.Errorf("invalid background %q", req.Background)
+	}
+	if req.X < 0 || req.Y < 0 {
+		return req, errors.New("x and y must not be negative")
+	}
+	return req, nil
+}
+
+// assColor converts #RRGGBB into the BBGGRR order used by ASS.
+func assColor(color string) string {
+	return strings.ToUpper(color[5:7] + color[3:5] + color[1:3])
+}
+
+// assEscape keeps text from being parsed as ASS override tags.
+func assEscape(text string) string {
+	text = strings.ReplaceAll(text, `\`, "\\\uFEFF")
+	text = strings.ReplaceAll(text, "{", `\{`)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\n", `\N`)
+}
+
+// overlayASS renders the banner as ASS events: an optional background band
+// across the output and the centred text on top of it.
+func overlayASS(req OverlayRequest) string {
+	lines := strings.Count(strings.TrimSpace(req.Text), "\n") + 1
+	pad := req.FontSize / 2
+	height := req.FontSize*lines*5/4 + 2*pad
+	if height > overlayResY {
+		height = overlayResY
+	}
+	top := overlayResY - height
+	switch req.Position {
+	case "top":
+		top = 0
+	case "center":
+		top = (overlayResY - height) / 2
+	}
+
+	var events []string
+	if req.Background != "" {
+		events = append(events, fmt.Sprintf(`{\an7\pos(0,%d)\bord0\shad0\1c&H%s&\p1}m 0 0 l %d 0 %d %d 0 %d{\p0}`,
+			top, assColor(req.Background), overlayResX, overlayResX, height, height))
+	}
+	events = append(events, fmt.Sprintf(`{\an5\pos(%d,%d)\fs%d\1c&H%s&\bord2\shad0}%s`,
+		overlayResX/2, top+height/2, req.FontSize, assColor(req.Color), assEscape(strings.TrimSpace(req.Text))))
+	return strings.Join(events, "\n")
+}
+
+// writeOverlayImage decodes a PNG, JPEG or GIF image and writes it as the
+// premultiplied BGRA mpv's overlay-add expects. It returns the raw file and
+// the image size.
+func writeOverlayImage(src, dir string) (string, int, int, error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer func() { _ = file.Close() }()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("decode %s: %w", filepath.Base(src), err)
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	pix := rgba.Pix
+	for i := 0; i+3 < len(pix); i += 4 {
+		pix[i], pix[i+2] = pix[i+2], pix[i]
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, 0, err
+	}
+	path := filepath.Join(dir, "overlay.bgra")
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, pix, 0644); err != nil {
+		return "", 0, 0, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", 0, 0, err
+	}
+	return path, rgba.Rect.Dx(), rgba.Rect.Dy(), nil
+}
+
+// clearOverlayLocked removes the overlay from every player. Callers hold
+// overlayLock.
+func clearOverlayLocked(ctx context.Context, config Config) {
+	if overlayTimer != nil {
+		overlayTimer.Stop()
+		overlayTimer = nil
+	}
+	for _, conn := range overlayTextConns {
+		_ = conn.Close()
+	}
+	overlayTextConns = nil
+	if overlayImagePath != "" {
+		for _, socket := range playerIPCSockets(config) {
+			if _, err := mpvCommand(ctx, socket, []any{"overlay-remove", overlayImageID}); err != nil {
+				log.Printf("Warning: failed to remove overlay image on %s: %v", socket, err)
+			}
+		}
+		_ = os.Remove(overlayImagePath)
+		overlayImagePath = ""
+	}
+	overlayStatus = OverlayStatus{}
+}
+
+// showOverlay replaces the current overlay with req on every player and
+// schedules its removal.
+func showOverlay(ctx context.Context, config Config, req OverlayRequest) (OverlayStatus, error) {
+	sockets := playerIPCSockets(config)
+	if len(sockets) == 0 {
+		return OverlayStatus{}, errOverlayUnavailable
+	}
+
+	var src string
+	if req.Image != "" {
+		var ok bool
+		if src, ok = resolveMediaKindPath(config, mediaKindImage, req.Image); !ok {
+			return OverlayStatus{}, fmt.Errorf("image must be inside the media directory")
+		}
+	}
+
+	overlayLock.Lock()
+	defer overlayLock.Unlock()
+	clearOverlayLocked(ctx, config)
+
+	var imagePath string
+	var width, height int
+	if src != "" {
+		var err error
+		imagePath, width, height, err = writeOverlayImage(src, OverlayImageDir)
+		if err != nil {
+			return OverlayStatus{}, err
+		}
+	}
+
+	shown := 0
+	var lastErr error
+	for _, socket := range sockets {
+		if err := showOverlayOn(ctx, socket, req, imagePath, width, height); err != nil {
+			log.Printf("Warning: failed to show overlay on %s: %v", socket, err)
+			lastErr = err
+			continue
+		}
+		shown++
+	}
+	overlayImagePath = imagePath
+	if shown == 0 {
+		clearOverlayLocked(ctx, config)
+		return OverlayStatus{}, lastErr
+	}
+
+	duration := time.Duration(req.DurationSeconds) * time.Second
+	if duration == 0 {
+		duration = DefaultOverlayDuration
+	}
+	overlayGeneration++
+	generation := overlayGeneration
+	overlayTimer = time.AfterFunc(duration, func() {
+		overlayLock.Lock()
+		defer overlayLock.Unlock()
+		if overlayGeneration == generation {
+			log.Println("Overlay expired")
+			clearOverlayLocked(context.Background(), GetCurrentConfig())
+		}
+	})
+	overlayStatus = OverlayStatus{
+		Active:    true,
+		Text:      strings.TrimSpace(req.Text),
+		Image:     req.Image,
+		ExpiresAt: time.Now().Add(duration).UTC().Format(time.RFC3339),
+	}
+	return overlayStatus, nil
+}
+
+func showOverlayOn(ctx context.Context, socket string, req OverlayRequest, imagePath string, width, height int) error {
+	if imagePath != "" {
+		if _, err := mpvCommand(ctx, socket, []any{"overlay-add", overlayImageID, req.X, req.Y, imagePath, 0, "bgra", width, height, width * 4}); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		return nil
+	}
+	conn, err := dialMPV(ctx, socket)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.command(map[string]any{
+		"name":   "osd-overlay",
+		"id":     overlayTextID,
+		"format": "ass-events",
+		"data":   overlayASS(req),
+		"res_x":  overlayResX,
+		"res_y":  overlayResY,
+	}); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	go conn.drain()
+	overlayTextConns = append(overlayTextConns, conn)
+	return nil
+}
+
+func getOverlayStatus() OverlayStatus {
+	overlayLock.Lock()
+	defer overlayLock.Unlock()
+	return overlayStatus
+}
+
+// HandleOverlay shows (POST), reports (GET) or clears (DELETE) a text banner
+// or image overlay on top of the video.
+func HandleOverlay(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getOverlayStatus()})
+	case http.MethodPost:
+		var req OverlayRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+			return
+		}
+		req, err := normalizeOverlayRequest(req)
+		if err != nil {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Неверные параметры наложения: %v", err)})
+			return
+		}
+		status, err := showOverlay(r.Context(), GetCurrentConfig(), req)
+		if errors.Is(err, errOverlayUnavailable) {
+			JSONResponse(w, http.StatusServiceUnavailable, APIResponse{OK: false, ErrMsg: "Наложения требуют плеер mpv: задайте player.ipc_socket"})
+			return
+		}
+		if err != nil {
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось показать наложение: %v", err)})
+			return
+		}
+		log.Printf("Overlay shown until %s", status.ExpiresAt)
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: status})
+	case http.MethodDelete:
+		overlayLock.Lock()
+		clearOverlayLocked(r.Context(), GetCurrentConfig())
+		overlayLock.Unlock()
+		JSONResponse(w, http.StatusOK, APIResponse{
+			OK: true,
+			Data: MenuActionResponse{
+				Action:  "overlay-clear",
+				Result:  "success",
+				Message: "Наложение убрано",
+			},
+		})
+	default:
+		JSONResponse(w, http.StatusMethodNotAllowed, APIResponse{OK: false, ErrMsg: "Метод не разрешён"})
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMPV records commands received on an mpv-style JSON IPC socket.
+type fakeMPV struct {
+	socket   string
+	mu       sync.Mutex
+	commands []json.RawMessage
+	open     int
+	// properties answer get_property
+	properties map[string]any
+}
+
+func startFakeMPV(t *testing.T) *fakeMPV {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "mpv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	fake := &fakeMPV{socket: filepath.Join(dir, "mpv.sock")}
+	listener, err := net.Listen("unix", fake.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fake.serve(conn)
+		}
+	}()
+	return fake
+}
+
+func (f *fakeMPV) serve(conn net.Conn) {
+	f.mu.Lock()
+	f.open++
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.open--
+		f.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req struct {
+			Command   json.RawMessage `json:"command"`
+			RequestID int             `json:"request_id"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return
+		}
+		var args []any
+		_ = json.Unmarshal(req.Command, &args)
+		f.mu.Lock()
+		f.commands = append(f.commands, req.Command)
+		response := map[string]any{"request_id": req.RequestID, "error": "success"}
+		if len(args) == 2 && args[0] == "get_property" {
+			name, _ := args[1].(string)
+			if value, ok := f.properties[name]; ok {
+				response["data"] = value
+			}
+		}
+		f.mu.Unlock()
+		// Events are interleaved with replies.
+		_, _ = conn.Write([]byte(`{"event":"playback-restart"}` + "\n"))
+		reply, _ := json.Marshal(response)
+		_, _ = conn.Write(append(reply, '\n'))
+	}
+}
+
+func (f *fakeMPV) snapshot() ([]string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	commands := make([]string, len(f.commands))
+	for i, command := range f.commands {
+		commands[i] = string(command)
+	}
+	return commands, f.open
+}
+
+func waitForFakeMPV(t *testing.T, fake *fakeMPV, open int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		commands, current := fake.snapshot()
+		if current == open {
+			return commands
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d open connections, got %d", open, current)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func clearOverlayForTest(t *testing.T) {
+	t.Cleanup(func() {
+		overlayLock.Lock()
+		clearOverlayLocked(t.Context(), Config{})
+		overlayLock.Unlock()
+	})
+}
+
+func TestNormalizeOverlayRequest(t *testing.T) {
+	req, err := normalizeOverlayRequest(OverlayRequest{Text: "Эвакуация"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Position != "bottom" || req.FontSize != defaultOverlayFontSize || req.Color != defaultOverlayColor {
+		t.Fatalf("unexpected defaults: %+v", req)
+	}
+
+	invalid := []OverlayRequest{
+		{},
+		{Text: "x", Position: "left"},
+		{Text: "x", Color: "red"},
+		{Text: "x", Background: "#12345"},
+		{Text: "x", FontSize: 1000},
+		{Text: "x", DurationSeconds: -1},
+		{Image: "a.png", X: -5},
+	}
+	for _, req := range invalid {
+		if _, err := normalizeOverlayRequest(req); err == nil {
+			t.Errorf("expected error for %+v", req)
+		}
+	}
+}
+
+func TestOverlayASS(t *testing.T) {
+	ass := overlayASS(OverlayRequest{Text: "Line {1}\nLine 2", Position: "top", FontSize: 40, Color: "#FF8000", Background: "#000080"})
+	events := strings.Split(ass, "\n")
+	if len(events) != 2 {
+		t.Fatalf("expected background and text events, got %q", ass)
+	}
+	if !strings.Contains(events[0], `\pos(0,0)`) || !strings.Contains(events[0], `\1c&H800000&`) {
+		t.Errorf("unexpected background event: %s", events[0])
+	}
+	if !strings.Contains(events[1], `\1c&H0080FF&`) || !strings.Contains(events[1], `Line \{1}\NLine 2`) {
+		t.Errorf("unexpected text event: %s", events[1])
+	}
+}
+
+func TestHandleOverlayShowsAndClearsText(t *testing.T) {
+	fake := startFakeMPV(t)
+	setCurrentConfigForTest(t, Config{Player: PlayerConfig{IPCSocket: fake.socket}})
+	clearOverlayForTest(t)
+
+	w := httptest.NewRecorder()
+	HandleOverlay(w, httptest.NewRequest(http.MethodPost, "/api/playback/overlay", strings.NewReader(`{"text":"Внимание","durationSeconds":60}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	commands := waitForFakeMPV(t, fake, 1)
+	if len(commands) != 1 || !strings.Contains(commands[0], `"osd-overlay"`) || !strings.Contains(commands[0], "Внимание") {
+		t.Fatalf("unexpected commands: %v", commands)
+	}
+	if status := getOverlayStatus(); !status.Active || status.Text != "Внимание" || status.ExpiresAt == "" {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	w = httptest.NewRecorder()
+	HandleOverlay(w, httptest.NewRequest(http.MethodDelete, "/api/playback/overlay", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	// Closing the connection removes the osd-overlay in mpv.
+	waitForFakeMPV(t, fake, 0)
+	if getOverlayStatus().Active {
+		t.Fatal("expected overlay to be cleared")
+	}
+}
+
+func TestOverlayExpires(t *testing.T) {
+	fake := startFakeMPV(t)
+	config := Config{Player: PlayerConfig{IPCSocket: fake.socket}}
+	setCurrentConfigForTest(t, config)
+	clearOverlayForTest(t)
+
+	req, _ := normalizeOverlayRequest(OverlayRequest{Text: "Soon gone"})
+	if _, err := showOverlay(t.Context(), config, req); err != nil {
+		t.Fatal(err)
+	}
+	waitForFakeMPV(t, fake, 1)
+
+	overlayLock.Lock()
+	overlayTimer.Reset(10 * time.Millisecond)
+	overlayLock.Unlock()
+	waitForFakeMPV(t, fake, 0)
+	if getOverlayStatus().Active {
+		t.Fatal("expected overlay to expire")
+	}
+}
+
+func TestShowOverlayImage(t *testing.T) {
+	fake := startFakeMPV(t)
+	mediaDir := t.TempDir()
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	file, err := os.Create(filepath.Join(mediaDir, "logo.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+
+	original := OverlayImageDir
+	OverlayImageDir = t.TempDir()
+	t.Cleanup(func() { OverlayImageDir = original })
+	config := Config{Player: PlayerConfig{IPCSocket: fake.socket}, Playlist: PlaylistConfig{Destination: mediaDir}}
+	setCurrentConfigForTest(t, config)
+	clearOverlayForTest(t)
+
+	req, _ := normalizeOverlayRequest(OverlayRequest{Image: "logo.png", X: 10, Y: 20})
+	if _, err := showOverlay(t.Context(), config, req); err != nil {
+		t.Fatal(err)
+	}
+	commands := waitForFakeMPV(t, fake, 0)
+	rawPath := filepath.Join(OverlayImageDir, "overlay.bgra")
+	if len(commands) != 1 || commands[0] != `["overlay-add",0,10,20,"`+rawPath+`",0,"bgra",3,2,12]` {
+		t.Fatalf("unexpected commands: %v", commands)
+	}
+	raw, err := os.ReadFile(rawPath)
+	if err != nil || len(raw) != 24 || raw[0] != 0 || raw[2] != 255 || raw[3] != 255 {
+		t.Fatalf("unexpected BGRA data: %v, %v", raw, err)
+	}
+
+	if _, err := showOverlay(t.Context(), config, OverlayRequest{Image: "../secret.png"}); err == nil {
+		t.Fatal("expected error for image outside the media directory")
+	}
+}
+
+func TestHandleOverlayRequiresIPCSocket(t *testing.T) {
+	setCurrentConfigForTest(t, Config{})
+
+	w := httptest.NewRecorder()
+	HandleOverlay(w, httptest.NewRequest(http.MethodPost, "/api/playback/overlay", strings.NewReader(`{"text":"x"}`)))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", w.Code)
+	}
+}
+
+func TestPlayerIPCSocketsPerOutput(t *testing.T) {
+	config := Config{
+		Player:   PlayerConfig{IPCSocket: "/run/mpv-{output}.sock"},
+		Displays: []DisplayOutputConfig{{Output: "HDMI-A-1"}, {Output: "HDMI-A-2"}},
+	}
+	if got := strings.Join(playerIPCSockets(config), ","); got != "/run/mpv-HDMI-A-1.sock,/run/mpv-HDMI-A-2.sock" {
+		t.Fatalf("unexpected sockets: %s", got)
+	}
+	if got := playerIPCSockets(Config{}); got != nil {
+		t.Fatalf("expected no sockets, got %v", got)
+	}
+}
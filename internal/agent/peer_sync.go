@@ -0,0 +1,256 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PeerConfig describes optional LAN peer-to-peer media sharing. When
+// enabled the agent advertises verified files over mDNS and tries peers
+// before downloading a file from the core.
+type PeerConfig struct {
+	Enabled          bool          `yaml:"enabled,omitempty"`
+	DiscoveryTimeout time.Duration `yaml:"discovery_timeout,omitempty"`
+	FetchTimeout     time.Duration `yaml:"fetch_timeout,omitempty"`
+}
+
+// peerMDNSServiceType is the DNS-SD service type used between agents.
+const peerMDNSServiceType = "_mediapi-peer._tcp"
+
+// Defaults for LAN peer sharing.
+const (
+	DefaultPeerDiscoveryTimeout = 2 * time.Second
+	DefaultPeerFetchTimeout     = 5 * time.Minute
+)
+
+var (
+	// peerCacheTTL bounds how long discovered peers are reused between syncs.
+	peerCacheTTL = 5 * time.Minute
+
+	// browsePeers discovers peers on the LAN. Tests may override it.
+	browsePeers = browseMDNS
+
+	peerCache        []mdnsPeer
+	peerCacheExpires time.Time
+	peerCacheLock    sync.Mutex
+
+	// peerContentIndex maps lowercase SHA256 digests of verified files to
+	// their local path. Only indexed files are served to peers.
+	peerContentIndex     map[string]string
+	peerContentIndexLock sync.RWMutex
+)
+
+// deviceInstanceID returns a stable identifier for this device that is safe
+// to publish on the LAN. The server key itself is a secret, so only a
+// truncated digest of it is used.
+func deviceInstanceID(config Config) string {
+	sum := sha256.Sum256([]byte("media-pi-device:" + config.ServerKey))
+	return hex.EncodeToString(sum[:6])
+}
+
+// listenPort extracts the TCP port from a listen address.
+func listenPort(listenAddr string) (int, bool) {
+	if listenAddr == "" {
+		listenAddr = DefaultListenAddr
+	}
+	_, portStr, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return 0, false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, false
+	}
+	return port, true
+}
+
+func peerMDNSService(config Config) (mdnsService, bool) {
+	if !config.Peer.Enabled {
+		return mdnsService{}, false
+	}
+	port, ok := listenPort(config.ListenAddr)
+	if !ok {
+		return mdnsService{}, false
+	}
+	id := deviceInstanceID(config)
+	return mdnsService{
+		Instance: id,
+		Service:  peerMDNSServiceType,
+		Port:     port,
+		TXT:      []string{"id=" + id, "version=" + GetVersion()},
+	}, true
+}
+
+func setPeerContentIndex(index map[string]string) {
+	peerContentIndexLock.Lock()
+	defer peerContentIndexLock.Unlock()
+	peerContentIndex = index
+}
+
+func lookupPeerContent(sha string) (string, bool) {
+	peerContentIndexLock.RLock()
+	defer peerContentIndexLock.RUnlock()
+	path, ok := peerContentIndex[strings.ToLower(sha)]
+	return path, ok
+}
+
+// HandlePeerContent serves a verified media file to a LAN peer by its
+// SHA256 digest: GET /peer/content/{sha256}. It is unauthenticated because
+// peers do not share the server key; only content already listed in the
+// last synced manifest can be requested, and peers verify every byte.
+func HandlePeerContent(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	if !GetCurrentConfig().Peer.Enabled {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Обмен файлами с соседними устройствами отключён"})
+		return
+	}
+
+	sha := strings.TrimPrefix(r.URL.Path, "/peer/content/")
+	path, ok := lookupPeerContent(sha)
+	if !ok {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Файл не найден"})
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Файл не найден"})
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Файл не найден"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+// discoverPeers returns agents advertising peer sharing on the LAN, except
+// this device. Results are cached for peerCacheTTL.
+func discoverPeers(ctx context.Context, config Config) []mdnsPeer {
+	peerCacheLock.Lock()
+	defer peerCacheLock.Unlock()
+
+	if time.Now().Before(peerCacheExpires) {
+		return peerCache
+	}
+
+	timeout := config.Peer.DiscoveryTimeout
+	if timeout <= 0 {
+		timeout = DefaultPeerDiscoveryTimeout
+	}
+	found, err := browsePeers(ctx, peerMDNSServiceType, timeout)
+	if err != nil {
+		log.Printf("Warning: LAN peer discovery failed: %v", err)
+	}
+
+	self := deviceInstanceID(config)
+	peers := make([]mdnsPeer, 0, len(found))
+	for _, peer := range found {
+		if peer.TXT["id"] == self || peer.Instance == self {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	if len(peers) > 0 {
+		log.Printf("Discovered %d LAN peer(s) for media sync", len(peers))
+	}
+
+	peerCache = peers
+	peerCacheExpires = time.Now().Add(peerCacheTTL)
+	return peers
+}
+
+func resetPeerCache() {
+	peerCacheLock.Lock()
+	defer peerCacheLock.Unlock()
+	peerCache = nil
+	peerCacheExpires = time.Time{}
+}
+
+// fetchFromPeers tries to obtain item from LAN peers, applying the same size,
+// hash and atomic rename guarantees as a core download.
+func fetchFromPeers(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+	// Peers index their content by SHA256.
+	if item.SHA256 == "" {
+		return fmt.Errorf("item has no SHA256 for peer lookup")
+	}
+	peers := discoverPeers(ctx, config)
+	if len(peers) == 0 {
+		return fmt.Errorf("no LAN peers available")
+	}
+
+	timeout := config.Peer.FetchTimeout
+	if timeout <= 0 {
+		timeout = DefaultPeerFetchTimeout
+	}
+
+	var errs []string
+	for _, peer := range peers {
+		url := fmt.Sprintf("http://%s/peer/content/%s", peer.Addr, strings.ToLower(item.SHA256))
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		resp, err := getCoreClient().Do(ctx, req, timeout)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", peer.Addr, err))
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			errs = append(errs, fmt.Sprintf("%s: status %d", peer.Addr, resp.StatusCode))
+			continue
+		}
+		err = writeVerifiedDownload(resp, item, destPath)
+		_ = resp.Body.Close()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", peer.Addr, err))
+			continue
+		}
+		log.Printf("Fetched %s (ID: %d) from LAN peer %s", item.Filename, item.ID, peer.Addr)
+		return nil
+	}
+	return fmt.Errorf("peers failed: %s", strings.Join(errs, "; "))
+}
+
+// downloadItem fetches item into destPath, preferring LAN peers when peer
+// sharing is enabled and falling back to the core API.
+func downloadItem(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+	return fetchPreferringPeers(ctx, config, item, destPath, downloadFile)
+}
+
+// fetchPreferringPeers tries LAN peers first when peer sharing is enabled
+// and falls back to fetch.
+func fetchPreferringPeers(ctx context.Context, config Config, item ManifestItem, destPath string, fetch fetchItemFunc) error {
+	if config.Peer.Enabled {
+		err := fetchFromPeers(ctx, config, item, destPath)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("Falling back to source download for %s: %v", item.Filename, err)
+	}
+	return fetch(ctx, config, item, destPath)
+}
@@ -0,0 +1,146 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func stubPeers(t *testing.T, peers ...mdnsPeer) {
+	t.Helper()
+	original := browsePeers
+	browsePeers = func(ctx context.Context, service string, timeout time.Duration) ([]mdnsPeer, error) {
+		return peers, nil
+	}
+	resetPeerCache()
+	t.Cleanup(func() {
+		browsePeers = original
+		resetPeerCache()
+	})
+}
+
+func TestDownloadItemPrefersPeer(t *testing.T) {
+	content := "shared clip"
+	digest := sha256Hex(content)
+
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/peer/content/"+digest {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer peer.Close()
+
+	var coreCalls int32
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&coreCalls, 1)
+		_, _ = w.Write([]byte(content))
+	}))
+	defer core.Close()
+
+	stubPeers(t, mdnsPeer{Instance: "other", Addr: strings.TrimPrefix(peer.URL, "http://")})
+
+	config := Config{CoreAPIBase: core.URL, ServerKey: "key", Peer: PeerConfig{Enabled: true}}
+	item := ManifestItem{ID: 1, Filename: "clip.mp4", FileSizeBytes: int64(len(content)), SHA256: digest}
+	dest := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := downloadItem(context.Background(), config, item, dest); err != nil {
+		t.Fatalf("downloadItem() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&coreCalls); got != 0 {
+		t.Fatalf("expected no core downloads, got %d", got)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != content {
+		t.Fatalf("unexpected content %q", data)
+	}
+}
+
+func TestDownloadItemFallsBackToCoreOnBadPeerContent(t *testing.T) {
+	content := "real clip"
+	digest := sha256Hex(content)
+
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("fake clip"))
+	}))
+	defer peer.Close()
+
+	var coreCalls int32
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&coreCalls, 1)
+		_, _ = w.Write([]byte(content))
+	}))
+	defer core.Close()
+
+	stubPeers(t, mdnsPeer{Instance: "other", Addr: strings.TrimPrefix(peer.URL, "http://")})
+
+	config := Config{CoreAPIBase: core.URL, ServerKey: "key", Peer: PeerConfig{Enabled: true}}
+	item := ManifestItem{ID: 1, Filename: "clip.mp4", FileSizeBytes: int64(len(content)), SHA256: digest}
+	dest := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := downloadItem(context.Background(), config, item, dest); err != nil {
+		t.Fatalf("downloadItem() error = %v", err)
+	}
+	if got := atomic.LoadInt32(&coreCalls); got != 1 {
+		t.Fatalf("expected one core download, got %d", got)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != content {
+		t.Fatalf("unexpected content %q", data)
+	}
+}
+
+func TestDiscoverPeersExcludesSelf(t *testing.T) {
+	config := Config{ServerKey: "key", Peer: PeerConfig{Enabled: true}}
+	self := deviceInstanceID(config)
+	stubPeers(t,
+		mdnsPeer{Instance: self, Addr: "10.0.0.1:8081", TXT: map[string]string{"id": self}},
+		mdnsPeer{Instance: "other", Addr: "10.0.0.2:8081", TXT: map[string]string{"id": "other"}},
+	)
+
+	peers := discoverPeers(context.Background(), config)
+	if len(peers) != 1 || peers[0].Instance != "other" {
+		t.Fatalf("expected only the other peer, got %v", peers)
+	}
+	if strings.Contains(self, "key") || len(self) != 12 {
+		t.Errorf("unexpected instance id %q", self)
+	}
+}
+
+func TestHandlePeerContentServesOnlyIndexedFiles(t *testing.T) {
+	content := "indexed"
+	digest := sha256Hex(content)
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setPeerContentIndex(map[string]string{digest: path})
+	t.Cleanup(func() { setPeerContentIndex(nil) })
+
+	setCurrentConfigForTest(t, Config{Peer: PeerConfig{Enabled: true}})
+
+	rr := httptest.NewRecorder()
+	HandlePeerContent(rr, httptest.NewRequest(http.MethodGet, "/peer/content/"+strings.ToUpper(digest), nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != content {
+		t.Fatalf("expected indexed content, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	HandlePeerContent(rr, httptest.NewRequest(http.MethodGet, "/peer/content/"+sha256Hex("other"), nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unindexed digest, got %d", rr.Code)
+	}
+
+	setCurrentConfigForTest(t, Config{})
+	rr = httptest.NewRecorder()
+	HandlePeerContent(rr, httptest.NewRequest(http.MethodGet, "/peer/content/"+digest, nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 when peer sharing is disabled, got %d", rr.Code)
+	}
+}
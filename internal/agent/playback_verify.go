@@ -0,0 +1,222 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// playbackVerifyInterval is how long a file verified before playback is
+// trusted: a playlist that loops every few minutes does not rehash the
+// same files over and over.
+const playbackVerifyInterval = time.Hour
+
+const metricPlaybackSkipped = "media_pi_playback_skipped_total"
+
+func init() {
+	registerCounter(metricPlaybackSkipped, "Corrupt playlist files skipped before playback.")
+}
+
+var (
+	playbackVerifyLock   sync.Mutex
+	playbackVerifyCancel context.CancelFunc
+	playbackVerifyDone   chan struct{}
+)
+
+// verifyBeforePlayback checks path against the digest the verification
+// cache holds for it. A file the cache knows nothing about, e.g. one not
+// synced from a manifest, passes unchecked. The hash runs at the priority
+// of sync work so it does not starve the player.
+func verifyBeforePlayback(config Config, path string) (bool, error) {
+	verifyCacheLock.Lock()
+	entry, found := verifyCache[path]
+	verifyCacheLock.Unlock()
+	if !found {
+		return true, nil
+	}
+	item := ManifestItem{Filename: filepath.Base(path), FileSizeBytes: entry.Size, HashAlgorithm: entry.Algorithm, Hash: entry.Hash}
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	now := time.Now()
+	if cachedVerification(path, info, item, playbackVerifyInterval, now) {
+		return true, nil
+	}
+
+	type result struct {
+		ok  bool
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		lowerSyncPriority(config.Sync)
+		ok, err := verifyLocalFile(path, item)
+		done <- result{ok, err}
+	}()
+	res := <-done
+	if res.ok {
+		recordVerification(path, item, now)
+	}
+	return res.ok, res.err
+}
+
+// skipCorruptFile drops the cache entry of path, so the next sync
+// downloads the file again, and reports the skip.
+func skipCorruptFile(output, mediaDir, path string) {
+	verifyCacheLock.Lock()
+	delete(verifyCache, path)
+	verifyCacheLock.Unlock()
+	persistVerifyCache()
+
+	filename := playFilename(mediaDir, path)
+	log.Printf("Playback: skipping corrupt file %s", filename)
+	metricAdd(metricPlaybackSkipped, 1)
+	publishEvent(EventPlaybackSkipped, PlaybackSkipEvent{Output: output, Filename: filename, Reason: "checksum mismatch"})
+}
+
+// watchPlayerNext verifies the next playlist entry of one mpv player each
+// time a file starts, while the current one plays, and removes it from the
+// playlist when its content no longer matches the manifest. It returns when
+// ctx is done or the connection fails.
+func watchPlayerNext(ctx context.Context, config Config, socket, output, mediaDir string) error {
+	conn, err := dialMPV(ctx, socket)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.command([]any{"observe_property", 1, "playlist"}); err != nil {
+		return err
+	}
+
+	var entries []mpvPlaylistEntry
+	for {
+		line, err := conn.reader.ReadBytes('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		var event mpvEvent
+		if json.Unmarshal(line, &event) != nil {
+			continue
+		}
+		switch event.Event {
+		case "property-change":
+			if event.Name == "playlist" {
+				var current []mpvPlaylistEntry
+				if json.Unmarshal(event.Data, &current) == nil {
+					entries = current
+				}
+			}
+		case "start-file":
+			next := nextPlaylistEntry(entries, event.PlaylistEntryID)
+			if next < 0 {
+				continue
+			}
+			path := entries[next].Filename
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(mediaDir, path)
+			}
+			ok, err := verifyBeforePlayback(config, path)
+			if err != nil {
+				log.Printf("Warning: failed to verify %s before playback: %v", path, err)
+				continue
+			}
+			if ok {
+				continue
+			}
+			if _, err := conn.command([]any{"playlist-remove", next}); err != nil {
+				log.Printf("Warning: failed to remove %s from the playlist of %s: %v", path, socket, err)
+				continue
+			}
+			skipCorruptFile(output, mediaDir, path)
+		}
+	}
+}
+
+// nextPlaylistEntry returns the index of the entry played after the one
+// with id, wrapping around as a looping playlist does, or -1.
+func nextPlaylistEntry(entries []mpvPlaylistEntry, id int64) int {
+	if len(entries) < 2 {
+		return -1
+	}
+	for i, entry := range entries {
+		if entry.ID == id {
+			return (i + 1) % len(entries)
+		}
+	}
+	return -1
+}
+
+// StartPlaybackVerify verifies the next file of every mpv player before it
+// plays when player.verify_next is set.
+func StartPlaybackVerify() {
+	StopPlaybackVerify()
+	config := GetCurrentConfig()
+	if !config.Player.VerifyNext {
+		return
+	}
+	players := playerIPCOutputs(config)
+	if len(players) == 0 {
+		log.Println("Warning: player.verify_next needs player.ipc_socket of an mpv player")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	playbackVerifyLock.Lock()
+	playbackVerifyCancel = cancel
+	playbackVerifyDone = done
+	playbackVerifyLock.Unlock()
+
+	var wg sync.WaitGroup
+	mediaDir := mediaDirFor(config)
+	for _, player := range players {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if err := watchPlayerNext(ctx, config, player.Socket, player.Output, mediaDir); err != nil {
+					log.Printf("Playback verify: player %s: %v", player.Socket, err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(proofOfPlayReconnectDelay):
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+}
+
+// StopPlaybackVerify stops verifying files before playback.
+func StopPlaybackVerify() {
+	playbackVerifyLock.Lock()
+	cancel, done := playbackVerifyCancel, playbackVerifyDone
+	playbackVerifyCancel, playbackVerifyDone = nil, nil
+	playbackVerifyLock.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNextPlaylistEntry(t *testing.T) {
+	entries := []mpvPlaylistEntry{{ID: 4}, {ID: 5}, {ID: 6}}
+	for id, want := range map[int64]int{4: 1, 5: 2, 6: 0, 7: -1} {
+		if got := nextPlaylistEntry(entries, id); got != want {
+			t.Errorf("after %d: got %d, want %d", id, got, want)
+		}
+	}
+	if got := nextPlaylistEntry(entries[:1], 4); got != -1 {
+		t.Errorf("a single entry has no next one: %d", got)
+	}
+}
+
+func TestWatchPlayerNextSkipsCorruptFile(t *testing.T) {
+	originalPath, originalCache := verifyCacheFilePath, verifyCache
+	verifyCacheFilePath = filepath.Join(t.TempDir(), "verify-cache.json")
+	t.Cleanup(func() {
+		verifyCacheLock.Lock()
+		verifyCacheFilePath, verifyCache = originalPath, originalCache
+		verifyCacheLock.Unlock()
+	})
+	verifyCacheLock.Lock()
+	verifyCache = map[string]verifyCacheEntry{}
+	verifyCacheLock.Unlock()
+
+	mediaDir := t.TempDir()
+	for _, name := range []string{"good.mp4", "bad.mp4"} {
+		path := filepath.Join(mediaDir, name)
+		if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		recordVerification(path, ManifestItem{Filename: name, FileSizeBytes: 5, SHA256: sha256Hex("video")}, time.Now())
+	}
+	// A bad sector: same size, other content.
+	bad := filepath.Join(mediaDir, "bad.mp4")
+	if err := os.WriteFile(bad, []byte("vXdeo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(bad, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := os.MkdirTemp("", "mpv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "mpv.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	var mu sync.Mutex
+	var commands []string
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		scanner := bufio.NewScanner(conn)
+		for first := true; scanner.Scan(); first = false {
+			var req struct {
+				Command   json.RawMessage `json:"command"`
+				RequestID int             `json:"request_id"`
+			}
+			_ = json.Unmarshal(scanner.Bytes(), &req)
+			mu.Lock()
+			commands = append(commands, string(req.Command))
+			mu.Unlock()
+			reply, _ := json.Marshal(map[string]any{"request_id": req.RequestID, "error": "success"})
+			_, _ = conn.Write(append(reply, '\n'))
+			if first {
+				_, _ = conn.Write([]byte(`{"event":"property-change","id":1,"name":"playlist","data":[{"id":1,"filename":"bad.mp4"},{"id":2,"filename":"good.mp4"}]}` + "\n"))
+				// The good file is next: it comes from the cache.
+				_, _ = conn.Write([]byte(`{"event":"start-file","playlist_entry_id":1}` + "\n"))
+				_, _ = conn.Write([]byte(`{"event":"start-file","playlist_entry_id":2}` + "\n"))
+			}
+		}
+	}()
+
+	events := make(chan Event, 1)
+	unsubscribe := SubscribeEvents(func(event Event) { events <- event }, EventPlaybackSkipped)
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watchPlayerNext(ctx, Config{}, socket, "HDMI-A-1", mediaDir) }()
+
+	select {
+	case event := <-events:
+		if skip, ok := event.Data.(PlaybackSkipEvent); !ok || skip.Filename != "bad.mp4" || skip.Output != "HDMI-A-1" {
+			t.Fatalf("event %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the corrupt file to be skipped")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(commands) != 2 || commands[1] != `["playlist-remove",0]` {
+		t.Fatalf("commands = %v", commands)
+	}
+	verifyCacheLock.Lock()
+	_, cached := verifyCache[bad]
+	verifyCacheLock.Unlock()
+	if cached {
+		t.Fatal("the corrupt file must be dropped from the verification cache")
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// playlistPlaceholder matches {NAME} placeholders in a downloaded playlist.
+var playlistPlaceholder = regexp.MustCompile(`\{([A-Z][A-Z0-9_]*)\}`)
+
+// playlistVariableName is the form of playlist.variables names.
+var playlistVariableName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// validatePlaylistVariables checks playlist.variables.
+func validatePlaylistVariables(variables map[string]string) error {
+	for name, value := range variables {
+		if !playlistVariableName.MatchString(name) {
+			return fmt.Errorf("playlist.variables: invalid name %q, expected upper case letters, digits and _", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("playlist.variables.%s must be a single line", name)
+		}
+	}
+	return nil
+}
+
+// playlistVariables returns the values placeholders expand to: MEDIA_DIR,
+// PLAYLIST_DIR, DEVICE_NAME and LABEL_<KEY> for each label, overridden by
+// playlist.variables.
+func playlistVariables(config Config) map[string]string {
+	variables := map[string]string{
+		"MEDIA_DIR":    mediaDirFor(config),
+		"PLAYLIST_DIR": config.Playlist.Destination,
+		"DEVICE_NAME":  deviceName(config),
+	}
+	for key, value := range config.Labels {
+		name := "LABEL_" + strings.ToUpper(strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '_'
+		}, key))
+		variables[name] = value
+	}
+	for name, value := range config.Playlist.Variables {
+		variables[name] = value
+	}
+	// A value spanning lines would add playlist entries.
+	for name, value := range variables {
+		variables[name] = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	}
+	return variables
+}
+
+// expandPlaylistTemplate replaces {NAME} placeholders in a downloaded
+// playlist so one playlist can serve devices with different storage
+// layouts. Unknown placeholders are left as they are and logged.
+func expandPlaylistTemplate(data []byte, config Config) []byte {
+	if !playlistPlaceholder.Match(data) {
+		return data
+	}
+	variables := playlistVariables(config)
+	unknown := map[string]struct{}{}
+	expanded := playlistPlaceholder.ReplaceAllFunc(data, func(match []byte) []byte {
+		name := string(match[1 : len(match)-1])
+		if value, ok := variables[name]; ok {
+			return []byte(value)
+		}
+		unknown[name] = struct{}{}
+		return match
+	})
+	if len(unknown) > 0 {
+		names := make([]string, 0, len(unknown))
+		for name := range unknown {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		log.Printf("Warning: playlist has unknown placeholders: %s", strings.Join(names, ", "))
+	}
+	return expanded
+}
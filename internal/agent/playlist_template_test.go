@@ -0,0 +1,71 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandPlaylistTemplate(t *testing.T) {
+	config := Config{
+		DeviceName: "lobby-1",
+		Labels:     map[string]string{"store-id": "42"},
+		Playlist: PlaylistConfig{
+			Destination: "/mnt/media",
+			Variables:   map[string]string{"BRANCH": "north", "MEDIA_DIR": "/srv/media"},
+		},
+	}
+	template := "#EXTM3U\n{MEDIA_DIR}/promo.mp4\n{PLAYLIST_DIR}/{BRANCH}/{LABEL_STORE_ID}.mp4\n#EXTINF:-1,{DEVICE_NAME}\n{UNKNOWN}/x.mp4\n{lower}\n"
+	want := "#EXTM3U\n/srv/media/promo.mp4\n/mnt/media/north/42.mp4\n#EXTINF:-1,lobby-1\n{UNKNOWN}/x.mp4\n{lower}\n"
+	if got := string(expandPlaylistTemplate([]byte(template), config)); got != want {
+		t.Fatalf("expandPlaylistTemplate = %q, want %q", got, want)
+	}
+
+	// Label values cannot add playlist entries.
+	config.Labels = map[string]string{"zone": "a\n/etc/passwd"}
+	if got := string(expandPlaylistTemplate([]byte("{LABEL_ZONE}"), config)); got != "a/etc/passwd" {
+		t.Fatalf("expected newlines to be dropped, got %q", got)
+	}
+}
+
+func TestValidatePlaylistVariables(t *testing.T) {
+	if err := validatePlaylistVariables(map[string]string{"BRANCH_2": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []map[string]string{{"branch": "x"}, {"2X": "x"}, {"A": "x\ny"}} {
+		if err := validatePlaylistVariables(bad); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestPerformPlaylistSyncExpandsPlaceholders(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{MEDIA_DIR}/a.mp4\n{SCREEN}/b.mp4\n"))
+	}))
+	defer server.Close()
+	setCurrentConfigForTest(t, Config{
+		CoreAPIBase: server.URL,
+		ServerKey:   "key",
+		Playlist:    PlaylistConfig{Destination: dir, Variables: map[string]string{"SCREEN": "left"}},
+	})
+
+	if err := PerformPlaylistSync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, playlistFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := dir + "/a.mp4\nleft/b.mp4\n"; string(content) != want || strings.Contains(string(content), "{") {
+		t.Fatalf("playlist = %q, want %q", content, want)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PowerConfig controls polling for undervoltage and throttling events. Bad
+// power supplies are the usual cause of random crashes in the field.
+type PowerConfig struct {
+	// Disabled turns the monitor off, e.g. on hosts without vcgencmd.
+	Disabled bool          `yaml:"disabled,omitempty"`
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// PowerStatus reports the power supply and throttling state.
+type PowerStatus struct {
+	// Throttled is the raw vcgencmd get_throttled value, e.g. "0x50005".
+	Throttled       string `json:"throttled,omitempty"`
+	UnderVoltage    bool   `json:"underVoltage"`
+	FrequencyCapped bool   `json:"frequencyCapped"`
+	Throttling      bool   `json:"throttling"`
+	SoftTempLimit   bool   `json:"softTempLimit"`
+	// UnderVoltageSinceBoot and ThrottlingSinceBoot stay set after the
+	// condition is over, until the next reboot.
+	UnderVoltageSinceBoot bool         `json:"underVoltageSinceBoot"`
+	ThrottlingSinceBoot   bool         `json:"throttlingSinceBoot"`
+	Events                []PowerEvent `json:"events,omitempty"`
+	UpdatedAt             string       `json:"updatedAt,omitempty"`
+	Error                 string       `json:"error,omitempty"`
+}
+
+// PowerEvent is a single undervoltage or throttling occurrence.
+type PowerEvent struct {
+	Time string `json:"time"`
+	// Kind is undervoltage, frequency-capped, throttled or soft-temp-limit.
+	Kind string `json:"kind"`
+	// Source is vcgencmd or kernel.
+	Source  string `json:"source"`
+	Message string `json:"message,omitempty"`
+}
+
+// DefaultPowerInterval is how often power state is polled.
+const DefaultPowerInterval = time.Minute
+
+// Bits of vcgencmd get_throttled; the same bits shifted by
+// throttledSinceBootShift report conditions seen since boot.
+const (
+	throttledUnderVoltage    = 1 << 0
+	throttledFrequencyCapped = 1 << 1
+	throttledThrottling      = 1 << 2
+	throttledSoftTempLimit   = 1 << 3
+	throttledSinceBootShift  = 16
+
+	// maxPowerEvents bounds the events kept for the status response.
+	maxPowerEvents = 20
+
+	metricPowerThrottled = "media_pi_power_throttled_flags"
+	metricPowerEvents    = "media_pi_power_events_total"
+)
+
+var throttledKinds = []struct {
+	bit  uint64
+	kind string
+}{
+	{throttledUnderVoltage, "undervoltage"},
+	{throttledFrequencyCapped, "frequency-capped"},
+	{throttledThrottling, "throttled"},
+	{throttledSoftTempLimit, "soft-temp-limit"},
+}
+
+func init() {
+	registerGauge(metricPowerThrottled, "Raw vcgencmd get_throttled flags.")
+	registerCounter(metricPowerEvents, "Undervoltage and throttling events by kind.")
+}
+
+var (
+	// readThrottled returns the vcgencmd get_throttled flags. Tests may
+	// override it.
+	readThrottled = func(ctx context.Context) (uint64, error) {
+		out, err := exec.CommandContext(ctx, "vcgencmd", "get_throttled").Output()
+		if err != nil {
+			return 0, fmt.Errorf("vcgencmd get_throttled: %w", err)
+		}
+		return parseThrottled(string(out))
+	}
+
+	// readKernelLog returns kernel messages of the current boot logged
+	// after since (all of them when since is zero) in journalctl
+	// short-unix format. Tests may override it.
+	readKernelLog = func(ctx context.Context, since time.Time) (string, error) {
+		args := []string{"-k", "-b", "-o", "short-unix", "--no-pager", "-q"}
+		if !since.IsZero() {
+			args = append(args, fmt.Sprintf("--since=@%d", since.Unix()))
+		}
+		out, err := exec.CommandContext(ctx, "journalctl", args...).Output()
+		if err != nil {
+			return "", fmt.Errorf("journalctl -k: %w", err)
+		}
+		return string(out), nil
+	}
+
+	powerLock    sync.Mutex
+	powerCancel  context.CancelFunc
+	powerState   *PowerStatus
+	powerMonitor *powerPoller
+)
+
+// parseThrottled parses "throttled=0x50005".
+func parseThrottled(out string) (uint64, error) {
+	value, ok := strings.CutPrefix(strings.TrimSpace(out), "throttled=")
+	if !ok {
+		return 0, fmt.Errorf("unexpected vcgencmd output %q", strings.TrimSpace(out))
+	}
+	return strconv.ParseUint(value, 0, 64)
+}
+
+// isUndervoltageMessage matches the firmware ("Under-voltage detected!")
+// and hwmon ("Undervoltage detected!") kernel messages.
+func isUndervoltageMessage(message string) bool {
+	lower := strings.ToLower(message)
+	return strings.Contains(lower, "under-voltage detected") || strings.Contains(lower, "undervoltage detected")
+}
+
+// powerPoller turns successive power readings into events.
+type powerPoller struct {
+	flags      uint64
+	haveFlags  bool
+	kernelSeen time.Time
+	events     []PowerEvent
+}
+
+func (p *powerPoller) record(event PowerEvent) {
+	log.Printf("Warning: power event: %s from %s: %s", event.Kind, event.Source, event.Message)
+	metricAdd(metricPowerEvents, 1, "kind", event.Kind)
+	p.events = append(p.events, event)
+	if len(p.events) > maxPowerEvents {
+		p.events = p.events[len(p.events)-maxPowerEvents:]
+	}
+}
+
+// pollThrottled records a vcgencmd event for every condition that started
+// since the previous reading. The first reading also reports conditions
+// that happened since boot, before the agent started.
+func (p *powerPoller) pollThrottled(flags uint64, now time.Time) {
+	for _, k := range throttledKinds {
+		active := flags&k.bit != 0
+		wasActive := p.haveFlags && p.flags&k.bit != 0
+		sinceBoot := !p.haveFlags && flags&(k.bit<<throttledSinceBootShift) != 0
+		switch {
+		case active && !wasActive:
+			p.record(PowerEvent{Time: now.UTC().Format(time.RFC3339), Kind: k.kind, Source: "vcgencmd", Message: fmt.Sprintf("throttled=0x%x", flags)})
+		case sinceBoot:
+			p.record(PowerEvent{Time: now.UTC().Format(time.RFC3339), Kind: k.kind, Source: "vcgencmd", Message: fmt.Sprintf("occurred since boot, throttled=0x%x", flags)})
+		}
+	}
+	p.flags, p.haveFlags = flags, true
+}
+
+// pollKernelLog records an event for every undervoltage message logged
+// after the last line seen, so the next read starts where this one ended.
+func (p *powerPoller) pollKernelLog(out string) {
+	for _, line := range strings.Split(out, "\n") {
+		stamp, message, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.ParseFloat(stamp, 64)
+		if err != nil {
+			continue
+		}
+		at := time.Unix(0, int64(seconds*float64(time.Second)))
+		if !at.After(p.kernelSeen) {
+			continue
+		}
+		p.kernelSeen = at
+		if !isUndervoltageMessage(message) {
+			continue
+		}
+		if _, text, found := strings.Cut(message, "kernel: "); found {
+			message = text
+		}
+		p.record(PowerEvent{Time: at.UTC().Format(time.RFC3339), Kind: "undervoltage", Source: "kernel", Message: message})
+	}
+}
+
+// poll reads vcgencmd and the kernel log and returns the resulting status.
+func (p *powerPoller) poll(ctx context.Context, now time.Time) *PowerStatus {
+	status := &PowerStatus{UpdatedAt: now.UTC().Format(time.RFC3339)}
+	var errs []error
+	if flags, err := readThrottled(ctx); err != nil {
+		errs = append(errs, err)
+	} else {
+		p.pollThrottled(flags, now)
+		metricSet(metricPowerThrottled, float64(flags))
+		status.Throttled = fmt.Sprintf("0x%x", flags)
+		status.UnderVoltage = flags&throttledUnderVoltage != 0
+		status.FrequencyCapped = flags&throttledFrequencyCapped != 0
+		status.Throttling = flags&throttledThrottling != 0
+		status.SoftTempLimit = flags&throttledSoftTempLimit != 0
+		status.UnderVoltageSinceBoot = flags&(throttledUnderVoltage<<throttledSinceBootShift) != 0
+		status.ThrottlingSinceBoot = flags&(throttledThrottling<<throttledSinceBootShift) != 0
+	}
+	if out, err := readKernelLog(ctx, p.kernelSeen); err != nil {
+		errs = append(errs, err)
+	} else {
+		p.pollKernelLog(out)
+	}
+	if err := errors.Join(errs...); err != nil {
+		status.Error = err.Error()
+	}
+	status.Events = append([]PowerEvent(nil), p.events...)
+	return status
+}
+
+// StartPowerMonitor polls for undervoltage and throttling every
+// power.interval unless power.disabled is set.
+func StartPowerMonitor() {
+	StopPowerMonitor()
+	config := GetCurrentConfig().Power
+	if config.Disabled {
+		return
+	}
+	interval := config.Interval
+	if interval <= 0 {
+		interval = DefaultPowerInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	poller := &powerPoller{}
+	powerLock.Lock()
+	powerCancel = cancel
+	powerMonitor = poller
+	powerLock.Unlock()
+
+	go func() {
+		var previousErr string
+		for {
+			status := poller.poll(ctx, time.Now())
+			if status.Error != "" && status.Error != previousErr {
+				log.Printf("Warning: power monitor: %s", status.Error)
+			}
+			previousErr = status.Error
+			powerLock.Lock()
+			if powerMonitor == poller {
+				powerState = status
+			}
+			powerLock.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// StopPowerMonitor stops the power monitor loop.
+func StopPowerMonitor() {
+	powerLock.Lock()
+	defer powerLock.Unlock()
+	if powerCancel != nil {
+		powerCancel()
+		powerCancel = nil
+	}
+	powerMonitor = nil
+	powerState = nil
+}
+
+func getPowerStatus() *PowerStatus {
+	powerLock.Lock()
+	defer powerLock.Unlock()
+	if powerState == nil {
+		return nil
+	}
+	status := *powerState
+	return &status
+}
@@ -0,0 +1,100 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func stubPowerReaders(t *testing.T, flags *uint64, throttledErr error, kernelLog *string) {
+	t.Helper()
+	originalThrottled, originalKernel := readThrottled, readKernelLog
+	readThrottled = func(context.Context) (uint64, error) { return *flags, throttledErr }
+	readKernelLog = func(context.Context, time.Time) (string, error) { return *kernelLog, nil }
+	t.Cleanup(func() {
+		readThrottled, readKernelLog = originalThrottled, originalKernel
+	})
+}
+
+func TestParseThrottled(t *testing.T) {
+	flags, err := parseThrottled("throttled=0x50005\n")
+	if err != nil || flags != 0x50005 {
+		t.Fatalf("parseThrottled = %x, %v", flags, err)
+	}
+	if _, err := parseThrottled("error=1"); err == nil {
+		t.Fatal("expected error for unexpected output")
+	}
+}
+
+func TestPowerPollerReportsThrottledTransitions(t *testing.T) {
+	flags := uint64(0x10000) // undervoltage earlier in this boot
+	kernelLog := ""
+	stubPowerReaders(t, &flags, nil, &kernelLog)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	before := metricValue(metricPowerEvents, "kind", "undervoltage")
+
+	poller := &powerPoller{}
+	status := poller.poll(context.Background(), now)
+	if status.UnderVoltage || !status.UnderVoltageSinceBoot || len(status.Events) != 1 || !strings.Contains(status.Events[0].Message, "since boot") {
+		t.Fatalf("unexpected first status: %+v", status)
+	}
+
+	flags = 0x50005
+	status = poller.poll(context.Background(), now.Add(time.Minute))
+	if !status.UnderVoltage || !status.Throttling || status.Throttled != "0x50005" || len(status.Events) != 3 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	// A condition that persists is not reported again.
+	if status = poller.poll(context.Background(), now.Add(2*time.Minute)); len(status.Events) != 3 {
+		t.Fatalf("expected no new events, got %+v", status.Events)
+	}
+	if got := metricValue(metricPowerEvents, "kind", "undervoltage") - before; got != 2 {
+		t.Fatalf("undervoltage events = %v, want 2", got)
+	}
+	if metricValue(metricPowerThrottled) != 0x50005 {
+		t.Fatalf("unexpected throttled gauge: %v", metricValue(metricPowerThrottled))
+	}
+}
+
+func TestPowerPollerReadsKernelLog(t *testing.T) {
+	flags := uint64(0)
+	kernelLog := strings.Join([]string{
+		"1777636800.100000 raspberrypi kernel: Booting Linux on physical CPU 0x0",
+		"1777636900.250000 raspberrypi kernel: hwmon hwmon1: Undervoltage detected!",
+		"1777637000.000000 raspberrypi kernel: Under-voltage detected! (0x00050005)",
+	}, "\n")
+	stubPowerReaders(t, &flags, errors.New("vcgencmd get_throttled: not found"), &kernelLog)
+
+	poller := &powerPoller{}
+	status := poller.poll(context.Background(), time.Now())
+	if len(status.Events) != 2 || status.Events[0].Source != "kernel" || status.Events[0].Message != "hwmon hwmon1: Undervoltage detected!" {
+		t.Fatalf("unexpected events: %+v", status.Events)
+	}
+	if status.Throttled != "" || !strings.Contains(status.Error, "vcgencmd") {
+		t.Fatalf("expected vcgencmd error, got %+v", status)
+	}
+	if poller.kernelSeen.Unix() != 1777637000 {
+		t.Fatalf("unexpected kernel cursor: %v", poller.kernelSeen)
+	}
+
+	// Lines already seen are skipped when journalctl repeats them.
+	if status = poller.poll(context.Background(), time.Now()); len(status.Events) != 2 {
+		t.Fatalf("expected no duplicate events, got %+v", status.Events)
+	}
+}
+
+func TestSystemStatusIncludesPower(t *testing.T) {
+	powerLock.Lock()
+	powerState = &PowerStatus{Throttled: "0x0"}
+	powerLock.Unlock()
+	t.Cleanup(StopPowerMonitor)
+
+	if status := getSystemStatus(); status.Power == nil || status.Power.Throttled != "0x0" {
+		t.Fatalf("expected power status, got %+v", status.Power)
+	}
+}
@@ -0,0 +1,452 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PresenceConfig describes the optional presence sensor that pauses
+// playback and blanks the display while nobody is around.
+type PresenceConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Source is "gpio" (PIR sensor) or "camera" (frame difference).
+	Source string `yaml:"source,omitempty"`
+	// GPIOValuePath is the sysfs value file of the sensor pin, for example
+	// /sys/class/gpio/gpio17/value.
+	GPIOValuePath string `yaml:"gpio_value_path,omitempty"`
+	ActiveLow     bool   `yaml:"active_low,omitempty"`
+	// CameraInput is the V4L2 device; screenshot.input is used when empty.
+	CameraInput string `yaml:"camera_input,omitempty"`
+	// CameraThreshold is the mean per-pixel difference (0-255) between
+	// consecutive frames that counts as motion.
+	CameraThreshold float64       `yaml:"camera_threshold,omitempty"`
+	PollInterval    time.Duration `yaml:"poll_interval,omitempty"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout,omitempty"`
+	BlankCommand    string        `yaml:"blank_command,omitempty"`
+	UnblankCommand  string        `yaml:"unblank_command,omitempty"`
+	ReportInterval  time.Duration `yaml:"report_interval,omitempty"`
+}
+
+// Defaults for presence driven playback.
+const (
+	DefaultPresenceGPIOPollInterval   = time.Second
+	DefaultPresenceCameraPollInterval = 5 * time.Second
+	DefaultPresenceIdleTimeout        = 10 * time.Minute
+	DefaultPresenceReportInterval     = 15 * time.Minute
+	DefaultPresenceCameraThreshold    = 8
+	DefaultPresenceBlankCommand       = "vcgencmd display_power 0"
+	DefaultPresenceUnblankCommand     = "vcgencmd display_power 1"
+)
+
+const (
+	presenceSourceGPIO   = "gpio"
+	presenceSourceCamera = "camera"
+
+	// cameraFrameWidth and cameraFrameHeight size the grayscale frames
+	// compared for motion; small frames keep ffmpeg cheap and ignore noise.
+	cameraFrameWidth  = 64
+	cameraFrameHeight = 48
+
+	metricPresenceMotion = "media_pi_presence_motion_events_total"
+	metricPresenceIdle   = "media_pi_presence_idle"
+)
+
+func init() {
+	registerCounter(metricPresenceMotion, "Motion detections reported by the presence sensor.")
+	registerGauge(metricPresenceIdle, "1 while playback is paused for lack of presence.")
+}
+
+// Hooks used by the presence monitor. Tests may override them.
+var (
+	presenceStartPlayback = startPlaybackService
+	presenceStopPlayback  = stopPlaybackService
+	runDisplayCommand     = func(ctx context.Context, command string) error {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return nil
+		}
+		out, err := exec.CommandContext(ctx, fields[0], fields[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %w: %s", command, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	captureCameraFrame = func(ctx context.Context, input string) ([]byte, error) {
+		ffmpegPath, err := resolveFFmpegPath()
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.CommandContext(ctx, ffmpegPath, "-loglevel", "error", "-f", "v4l2", "-i", input,
+			"-frames:v", "1", "-vf", fmt.Sprintf("scale=%d:%d,format=gray", cameraFrameWidth, cameraFrameHeight),
+			"-f", "rawvideo", "-")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("ffmpeg frame capture failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return out, nil
+	}
+)
+
+var (
+	presenceLock    sync.Mutex
+	presenceCancel  context.CancelFunc
+	presenceMonitor *presenceState
+)
+
+// OccupancyStats summarizes presence since the last report to the core.
+type OccupancyStats struct {
+	Since           time.Time  `json:"since"`
+	Until           time.Time  `json:"until"`
+	MotionEvents    int        `json:"motionEvents"`
+	OccupiedSeconds float64    `json:"occupiedSeconds"`
+	IdleSeconds     float64    `json:"idleSeconds"`
+	Idle            bool       `json:"idle"`
+	LastMotion      *time.Time `json:"lastMotion,omitempty"`
+}
+
+// presenceDetector reports whether motion was seen since the last call.
+type presenceDetector interface {
+	Detect(ctx context.Context) (bool, error)
+}
+
+type gpioDetector struct {
+	path      string
+	activeLow bool
+}
+
+func (d *gpioDetector) Detect(ctx context.Context) (bool, error) {
+	data, err := os.ReadFile(d.path)
+	if err != nil {
+		return false, err
+	}
+	high := strings.TrimSpace(string(data)) == "1"
+	return high != d.activeLow, nil
+}
+
+type cameraDetector struct {
+	input     string
+	threshold float64
+	previous  []byte
+}
+
+func (d *cameraDetector) Detect(ctx context.Context) (bool, error) {
+	frame, err := captureCameraFrame(ctx, d.input)
+	if err != nil {
+		return false, err
+	}
+	previous := d.previous
+	d.previous = frame
+	if len(previous) == 0 || len(previous) != len(frame) {
+		return false, nil
+	}
+	return frameDifference(previous, frame) >= d.threshold, nil
+}
+
+// frameDifference returns the mean absolute difference of two equally
+// sized grayscale frames.
+func frameDifference(a, b []byte) float64 {
+	if len(a) == 0 {
+		return 0
+	}
+	var total int
+	for i := range a {
+		diff := int(a[i]) - int(b[i])
+		if diff < 0 {
+			diff = -diff
+		}
+		total += diff
+	}
+	return float64(total) / float64(len(a))
+}
+
+func newPresenceDetector(config Config) (presenceDetector, error) {
+	presence := config.Presence
+	switch presence.Source {
+	case "", presenceSourceGPIO:
+		if presence.GPIOValuePath == "" {
+			return nil, fmt.Errorf("presence.gpio_value_path is required for gpio source")
+		}
+		return &gpioDetector{path: presence.GPIOValuePath, activeLow: presence.ActiveLow}, nil
+	case presenceSourceCamera:
+		input := presence.CameraInput
+		if input == "" {
+			input = config.Screenshot.Input
+		}
+		if input == "" {
+			input = DefaultScreenshotInput
+		}
+		threshold := presence.CameraThreshold
+		if threshold <= 0 {
+			threshold = DefaultPresenceCameraThreshold
+		}
+		return &cameraDetector{input: input, threshold: threshold}, nil
+	default:
+		return nil, fmt.Errorf("unknown presence source %q", presence.Source)
+	}
+}
+
+// presenceState tracks motion and pauses playback after IdleTimeout
+// without it.
+type presenceState struct {
+	mu          sync.Mutex
+	idleTimeout time.Duration
+	blank       string
+	unblank     string
+	lastMotion  time.Time
+	lastTick    time.Time
+	idle        bool
+	stats       OccupancyStats
+}
+
+func newPresenceState(config Config, now time.Time) *presenceState {
+	presence := config.Presence
+	idleTimeout := presence.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultPresenceIdleTimeout
+	}
+	blank, unblank := presence.BlankCommand, presence.UnblankCommand
+	if blank == "" {
+		blank = DefaultPresenceBlankCommand
+	}
+	if unblank == "" {
+		unblank = DefaultPresenceUnblankCommand
+	}
+	// Startup counts as presence so the first idle period starts now.
+	return &presenceState{
+		idleTimeout: idleTimeout,
+		blank:       blank,
+		unblank:     unblank,
+		lastMotion:  now,
+		lastTick:    now,
+		stats:       OccupancyStats{Since: now},
+	}
+}
+
+// observe applies one sensor reading taken at now.
+func (p *presenceState) observe(ctx context.Context, now time.Time, motion bool, rest []RestTimePairConfig) {
+	p.mu.Lock()
+	elapsed := now.Sub(p.lastTick).Seconds()
+	if p.idle {
+		p.stats.IdleSeconds += elapsed
+	} else {
+		p.stats.OccupiedSeconds += elapsed
+	}
+	p.lastTick = now
+
+	var resume, pause bool
+	if motion {
+		p.lastMotion = now
+		p.stats.MotionEvents++
+		last := now
+		p.stats.LastMotion = &last
+		if p.idle {
+			p.idle = false
+			resume = true
+		}
+	} else if !p.idle && now.Sub(p.lastMotion) >= p.idleTimeout {
+		p.idle = true
+		pause = true
+	}
+	p.stats.Idle = p.idle
+	p.mu.Unlock()
+
+	if motion {
+		metricAdd(metricPresenceMotion, 1)
+	}
+	switch {
+	case pause:
+		metricSet(metricPresenceIdle, 1)
+		if IsTakeoverActive() {
+			log.Printf("No presence for %s, keeping emergency takeover on screen", p.idleTimeout)
+			return
+		}
+		log.Printf("No presence for %s, pausing playback", p.idleTimeout)
+		if err := presenceStopPlayback(ctx); err != nil {
+			log.Printf("Warning: failed to stop playback on idle: %v", err)
+		}
+		if err := runDisplayCommand(ctx, p.blank); err != nil {
+			log.Printf("Warning: failed to blank display: %v", err)
+		}
+	case resume:
+		metricSet(metricPresenceIdle, 0)
+		log.Println("Presence detected, resuming playback")
+		if err := runDisplayCommand(ctx, p.unblank); err != nil {
+			log.Printf("Warning: failed to unblank display: %v", err)
+		}
+		if isWithinConfiguredRestInterval(now, rest) {
+			log.Println("Not resuming playback within a rest interval")
+			return
+		}
+		if err := presenceStartPlayback(ctx); err != nil {
+			log.Printf("Warning: failed to start playback on presence: %v", err)
+		}
+	}
+}
+
+// snapshot returns the current stats; with reset it starts a new period.
+func (p *presenceState) snapshot(now time.Time, reset bool) OccupancyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Until = now
+	if reset {
+		p.stats = OccupancyStats{Since: now, Idle: p.idle}
+	}
+	return stats
+}
+
+func stopPlaybackService(parent context.Context) error {
+	conn, err := getDBusConnection(parent)
+	if err != nil {
+		return fmt.Errorf("подключиться к D-Bus: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := runDBusUnitOperation(parent, conn, dbusUnitOperationStop, playbackServiceUnit); err != nil {
+		return err
+	}
+	return nil
+}
+
+// reportOccupancy posts occupancy stats to the core.
+func reportOccupancy(ctx context.Context, config Config, stats OccupancyStats) error {
+	body, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(config.CoreAPIBase, "/") + "/api/devicesync/occupancy"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Device-Id", config.ServerKey)
+
+	resp, err := getCoreClient().Do(ctx, req, playlistTimeout())
+	if err != nil {
+		return fmt.Errorf("post occupancy: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// StartPresenceMonitor polls the presence sensor when presence.enabled is
+// set. Calling it again restarts the monitor with the current config.
+func StartPresenceMonitor() error {
+	StopPresenceMonitor()
+	config := GetCurrentConfig()
+	if !config.Presence.Enabled {
+		return nil
+	}
+	detector, err := newPresenceDetector(config)
+	if err != nil {
+		return err
+	}
+
+	poll := config.Presence.PollInterval
+	if poll <= 0 {
+		poll = DefaultPresenceGPIOPollInterval
+		if config.Presence.Source == presenceSourceCamera {
+			poll = DefaultPresenceCameraPollInterval
+		}
+	}
+	reportEvery := config.Presence.ReportInterval
+	if reportEvery <= 0 {
+		reportEvery = DefaultPresenceReportInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	state := newPresenceState(config, time.Now())
+	presenceLock.Lock()
+	presenceCancel = cancel
+	presenceMonitor = state
+	presenceLock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+		lastReport := time.Now()
+		var lastErr string
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				motion, err := detector.Detect(ctx)
+				if err != nil {
+					// Log each distinct error once to keep the journal quiet.
+					if err.Error() != lastErr {
+						log.Printf("Warning: presence sensor read failed: %v", err)
+						lastErr = err.Error()
+					}
+					continue
+				}
+				lastErr = ""
+				cfg := GetCurrentConfig()
+				state.observe(ctx, now, motion, cfg.Schedule.Rest)
+
+				if now.Sub(lastReport) >= reportEvery {
+					lastReport = now
+					if err := reportOccupancy(ctx, cfg, state.snapshot(now, true)); err != nil {
+						log.Printf("Warning: failed to report occupancy: %v", err)
+					}
+				}
+			}
+		}
+	}()
+	log.Printf("Presence monitor started (%s source)", detectorSourceName(config))
+	return nil
+}
+
+func detectorSourceName(config Config) string {
+	if config.Presence.Source == "" {
+		return presenceSourceGPIO
+	}
+	return config.Presence.Source
+}
+
+// StopPresenceMonitor stops the presence monitor.
+func StopPresenceMonitor() {
+	presenceLock.Lock()
+	defer presenceLock.Unlock()
+	if presenceCancel != nil {
+		presenceCancel()
+		presenceCancel = nil
+	}
+	presenceMonitor = nil
+}
+
+// HandlePresenceStatus returns occupancy stats of the current period.
+func HandlePresenceStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	presenceLock.Lock()
+	state := presenceMonitor
+	presenceLock.Unlock()
+	if state == nil {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Датчик присутствия не включен"})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: state.snapshot(time.Now(), false)})
+}
@@ -0,0 +1,152 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func stubPresenceActions(t *testing.T) *[]string {
+	t.Helper()
+	var actions []string
+	origStart, origStop, origDisplay := presenceStartPlayback, presenceStopPlayback, runDisplayCommand
+	presenceStartPlayback = func(ctx context.Context) error { actions = append(actions, "start"); return nil }
+	presenceStopPlayback = func(ctx context.Context) error { actions = append(actions, "stop"); return nil }
+	runDisplayCommand = func(ctx context.Context, command string) error { actions = append(actions, command); return nil }
+	t.Cleanup(func() {
+		presenceStartPlayback, presenceStopPlayback, runDisplayCommand = origStart, origStop, origDisplay
+	})
+	return &actions
+}
+
+func TestPresencePausesAndResumesPlayback(t *testing.T) {
+	actions := stubPresenceActions(t)
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.Local)
+	state := newPresenceState(Config{Presence: PresenceConfig{IdleTimeout: time.Minute, BlankCommand: "blank", UnblankCommand: "unblank"}}, start)
+
+	ctx := context.Background()
+	state.observe(ctx, start.Add(30*time.Second), false, nil)
+	if len(*actions) != 0 {
+		t.Fatalf("paused before idle timeout: %v", *actions)
+	}
+	state.observe(ctx, start.Add(61*time.Second), false, nil)
+	state.observe(ctx, start.Add(90*time.Second), false, nil)
+	if want := []string{"stop", "blank"}; !reflect.DeepEqual(*actions, want) {
+		t.Fatalf("actions = %v, want %v", *actions, want)
+	}
+
+	state.observe(ctx, start.Add(2*time.Minute), true, nil)
+	if want := []string{"stop", "blank", "unblank", "start"}; !reflect.DeepEqual(*actions, want) {
+		t.Fatalf("actions = %v, want %v", *actions, want)
+	}
+
+	stats := state.snapshot(start.Add(2*time.Minute), true)
+	if stats.MotionEvents != 1 || stats.Idle || stats.OccupiedSeconds != 61 || stats.IdleSeconds != 59 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if next := state.snapshot(start.Add(3*time.Minute), false); next.MotionEvents != 0 || !next.Since.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("expected stats reset, got %+v", next)
+	}
+}
+
+func TestPresenceDoesNotResumeDuringRest(t *testing.T) {
+	actions := stubPresenceActions(t)
+	start := time.Date(2026, 5, 1, 23, 0, 0, 0, time.Local)
+	rest := []RestTimePairConfig{{Start: "22:00", Stop: "07:00"}}
+	state := newPresenceState(Config{Presence: PresenceConfig{IdleTimeout: time.Minute}}, start)
+
+	ctx := context.Background()
+	state.observe(ctx, start.Add(2*time.Minute), false, rest)
+	state.observe(ctx, start.Add(3*time.Minute), true, rest)
+	want := []string{"stop", DefaultPresenceBlankCommand, DefaultPresenceUnblankCommand}
+	if !reflect.DeepEqual(*actions, want) {
+		t.Fatalf("actions = %v, want %v", *actions, want)
+	}
+}
+
+func TestGPIODetector(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "value")
+	if err := os.WriteFile(path, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	detector, err := newPresenceDetector(Config{Presence: PresenceConfig{GPIOValuePath: path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if motion, err := detector.Detect(context.Background()); err != nil || !motion {
+		t.Fatalf("Detect() = %v, %v; want motion", motion, err)
+	}
+
+	activeLow := &gpioDetector{path: path, activeLow: true}
+	if motion, _ := activeLow.Detect(context.Background()); motion {
+		t.Error("expected no motion for active low sensor at high level")
+	}
+	if _, err := newPresenceDetector(Config{Presence: PresenceConfig{Source: "gpio"}}); err == nil {
+		t.Error("expected error without gpio_value_path")
+	}
+}
+
+func TestCameraDetector(t *testing.T) {
+	frames := [][]byte{{10, 10, 10, 10}, {11, 10, 10, 10}, {60, 60, 60, 60}}
+	original := captureCameraFrame
+	captureCameraFrame = func(ctx context.Context, input string) ([]byte, error) {
+		frame := frames[0]
+		frames = frames[1:]
+		return frame, nil
+	}
+	t.Cleanup(func() { captureCameraFrame = original })
+
+	detector, err := newPresenceDetector(Config{Presence: PresenceConfig{Source: "camera"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []bool
+	for range 3 {
+		motion, err := detector.Detect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, motion)
+	}
+	if want := []bool{false, false, true}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("motion = %v, want %v", got, want)
+	}
+}
+
+func TestReportOccupancy(t *testing.T) {
+	var got OccupancyStats
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/devicesync/occupancy" || r.Header.Get("X-Device-Id") != "key" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	stats := OccupancyStats{MotionEvents: 3, OccupiedSeconds: 120}
+	if err := reportOccupancy(context.Background(), Config{CoreAPIBase: server.URL, ServerKey: "key"}, stats); err != nil {
+		t.Fatalf("reportOccupancy() error = %v", err)
+	}
+	if got.MotionEvents != 3 || got.OccupiedSeconds != 120 {
+		t.Errorf("core received %+v", got)
+	}
+}
+
+func TestHandlePresenceStatusDisabled(t *testing.T) {
+	StopPresenceMonitor()
+	w := httptest.NewRecorder()
+	HandlePresenceStatus(w, httptest.NewRequest(http.MethodGet, "/api/system/presence", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without presence monitor, got %d", w.Code)
+	}
+}
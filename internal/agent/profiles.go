@@ -0,0 +1,410 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProfileConfig is a named day part, e.g. "open-hours" or "overnight",
+// bundling the playlist, volume and brightness that apply together. A
+// profile becomes active at each of its Start times and stays active until
+// another profile starts.
+type ProfileConfig struct {
+	Name  string   `yaml:"name" json:"name"`
+	Start []string `yaml:"start,omitempty" json:"start,omitempty"`
+	// Playlist replaces the playlist of every output; it is relative to
+	// playlist.destination. Without it the regular playlist plays.
+	Playlist string `yaml:"playlist,omitempty" json:"playlist,omitempty"`
+	// Volume sets audio.playback.volume and Brightness the display
+	// brightness in percent, within brightness.min and brightness.max; a
+	// light sensor still takes precedence. Unset values are left as they
+	// are.
+	Volume     *int `yaml:"volume,omitempty" json:"volume,omitempty"`
+	Brightness *int `yaml:"brightness,omitempty" json:"brightness,omitempty"`
+}
+
+// profileDropInName overrides the playlist of the playback units while a
+// profile with a playlist is active. It sorts before the web content and
+// takeover drop-ins, which take precedence.
+const profileDropInName = "media-pi-content-profile.conf"
+
+var (
+	// profileStateFilePath persists a forced profile across restarts.
+	profileStateFilePath = filepath.Join(agentStateDir, "profile.json")
+
+	// profileCheckInterval is how often scheduled transitions are checked.
+	profileCheckInterval = 30 * time.Second
+
+	// profileNow is the clock of profile transitions. Tests may override it.
+	profileNow = time.Now
+
+	// profileApply applies a profile to the device. Tests may override it.
+	profileApply = applyProfile
+
+	profileLock   sync.Mutex
+	profileState  ProfileState
+	profileCancel context.CancelFunc
+)
+
+// errUnknownProfile is returned when activating a profile that is not
+// configured.
+var errUnknownProfile = errors.New("unknown profile")
+
+// ProfileState describes the active profile.
+type ProfileState struct {
+	Active string `json:"active,omitempty"`
+	// Forced is set while a profile activated through the API overrides
+	// the schedule: until Until, or the next scheduled transition.
+	Forced    bool       `json:"forced,omitempty"`
+	ForcedAt  *time.Time `json:"forcedAt,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// ProfilesResponse is returned by GET /api/profiles.
+type ProfilesResponse struct {
+	Profiles  []ProfileConfig `json:"profiles"`
+	Scheduled string          `json:"scheduled,omitempty"`
+	State     ProfileState    `json:"state"`
+}
+
+// ProfileActivateRequest is the body of POST /api/profiles/activate. An
+// empty Name returns to the scheduled profile.
+type ProfileActivateRequest struct {
+	Name            string `json:"name"`
+	DurationSeconds int    `json:"durationSeconds,omitempty"`
+}
+
+func validateProfiles(profiles []ProfileConfig) error {
+	seen := make(map[string]bool, len(profiles))
+	for _, profile := range profiles {
+		name := strings.TrimSpace(profile.Name)
+		if name == "" {
+			return errors.New("profiles: name is required")
+		}
+		if seen[name] {
+			return fmt.Errorf("profiles: duplicate name %q", name)
+		}
+		seen[name] = true
+		for _, start := range profile.Start {
+			if !isValidTimeFormat(strings.TrimSpace(start)) {
+				return fmt.Errorf("profiles.%s: invalid start %q, expected HH:MM", name, start)
+			}
+		}
+		if profile.Playlist != "" {
+			rel := filepath.Clean(filepath.FromSlash(profile.Playlist))
+			if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("profiles.%s: playlist must be relative to playlist.destination", name)
+			}
+		}
+		if profile.Volume != nil && (*profile.Volume < 0 || *profile.Volume > 100) {
+			return fmt.Errorf("profiles.%s: volume must be 0-100", name)
+		}
+		if profile.Brightness != nil && (*profile.Brightness < 0 || *profile.Brightness > 100) {
+			return fmt.Errorf("profiles.%s: brightness must be 0-100", name)
+		}
+	}
+	return nil
+}
+
+func findProfile(profiles []ProfileConfig, name string) (ProfileConfig, bool) {
+	for _, profile := range profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return ProfileConfig{}, false
+}
+
+// scheduledProfile returns the profile whose start time was the latest at
+// or before now, looking back across midnight, and when it started.
+func scheduledProfile(profiles []ProfileConfig, now time.Time) (string, time.Time) {
+	var name string
+	var since time.Time
+	for _, profile := range profiles {
+		for _, start := range profile.Start {
+			hour, minute, err := parseTimeValue(strings.TrimSpace(start))
+			if err != nil {
+				continue
+			}
+			at := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+			if at.After(now) {
+				at = at.AddDate(0, 0, -1)
+			}
+			if name == "" || at.After(since) {
+				name, since = profile.Name, at
+			}
+		}
+	}
+	return name, since
+}
+
+// profilePlaylistPath returns the absolute path of the profile playlist.
+func profilePlaylistPath(config Config, profile ProfileConfig) string {
+	return filepath.Join(strings.TrimRight(config.Playlist.Destination, "/"), filepath.FromSlash(profile.Playlist))
+}
+
+// profileDropIns renders one drop-in per playback unit playing playlist.
+func profileDropIns(config Config, playlist string) map[string]string {
+	render := func(args string) string {
+		command := playerCommand(config)
+		if args != "" {
+			command += " " + args
+		}
+		return fmt.Sprintf("[Service]\nExecStart=\nExecStart=%s %s\n", command, playlistArgs(config, playlist))
+	}
+	if len(config.Displays) == 0 {
+		return map[string]string{playbackServiceUnit: render("")}
+	}
+	dropIns := make(map[string]string, len(config.Displays))
+	for _, display := range config.Displays {
+		dropIns[playbackUnitForOutput(display.Output)] = render(displayPlayerArgs(display))
+	}
+	return dropIns
+}
+
+// updateProfileDropIns writes or removes the playlist drop-ins of profile
+// and reports whether anything changed.
+func updateProfileDropIns(config Config, profile ProfileConfig) (bool, error) {
+	existing, _ := filepath.Glob(filepath.Join(SystemdUnitDir, "play.video*.service.d", profileDropInName))
+	if profile.Playlist == "" {
+		if len(existing) == 0 {
+			return false, nil
+		}
+		return true, removePlaybackDropIns(profileDropInName)
+	}
+	dropIns := profileDropIns(config, profilePlaylistPath(config, profile))
+	changed := len(existing) != len(dropIns)
+	for unit, content := range dropIns {
+		path := filepath.Join(SystemdUnitDir, unit+".d", profileDropInName)
+		if current, err := os.ReadFile(path); err == nil && string(current) == content {
+			continue
+		}
+		if err := writePlaybackDropIn(unit, profileDropInName, content); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// applyProfile switches the playlist, volume and brightness to profile.
+// Running playback is restarted to pick up a new playlist; stopped
+// playback, e.g. during rest, picks it up when it starts.
+func applyProfile(ctx context.Context, config Config, profile ProfileConfig) error {
+	var errs []error
+	changed, err := updateProfileDropIns(config, profile)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("playlist: %w", err))
+	}
+	if changed {
+		if status, statusErr := getServiceStatus(ctx); statusErr == nil && status.PlaybackServiceStatus && !IsTakeoverActive() {
+			err = reloadAndRunPlayback(ctx, dbusUnitOperationRestart)
+		} else {
+			err = reloadSystemd(ctx)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("playlist: %w", err))
+		}
+	}
+	if profile.Volume != nil {
+		if err := SetAudioVolume(ctx, *profile.Volume); err != nil {
+			errs = append(errs, fmt.Errorf("volume: %w", err))
+		}
+	}
+	if profile.Brightness != nil {
+		minPercent, maxPercent := brightnessClamps(config.Brightness)
+		percent := clampPercent(*profile.Brightness, minPercent, maxPercent)
+		if err := applyBrightness(ctx, config.Brightness, percent); err != nil {
+			errs = append(errs, fmt.Errorf("brightness: %w", err))
+		} else {
+			metricSet(metricBrightnessPercent, float64(percent))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// activateProfileLocked applies the named profile and records the state.
+// Callers hold profileLock.
+func activateProfileLocked(ctx context.Context, config Config, name string, state ProfileState) ProfileState {
+	profile, _ := findProfile(config.Profiles, name)
+	now := profileNow().UTC()
+	state.Active = name
+	state.AppliedAt = &now
+	state.Error = ""
+	if err := profileApply(ctx, config, profile); err != nil {
+		state.Error = err.Error()
+		log.Printf("Warning: profile %s applied with errors: %v", name, err)
+	} else {
+		log.Printf("Profile %s is active", name)
+	}
+	profileState = state
+	if err := writeStateFile(profileStateFilePath, state); err != nil {
+		log.Printf("Warning: failed to persist profile state: %v", err)
+	}
+	return state
+}
+
+// reconcileProfile activates the scheduled profile unless a forced one is
+// still in effect.
+func reconcileProfile(ctx context.Context, now time.Time) ProfileState {
+	config := GetCurrentConfig()
+	profileLock.Lock()
+	defer profileLock.Unlock()
+
+	state := profileState
+	scheduled, since := scheduledProfile(config.Profiles, now)
+	want := scheduled
+	if state.Forced {
+		_, known := findProfile(config.Profiles, state.Active)
+		expired := !known ||
+			state.Until != nil && !now.Before(*state.Until) ||
+			state.Until == nil && state.ForcedAt != nil && since.After(*state.ForcedAt)
+		if expired {
+			log.Printf("Forced profile %s ended, returning to the schedule", state.Active)
+			state.Forced, state.ForcedAt, state.Until = false, nil, nil
+		} else {
+			want = state.Active
+		}
+	}
+	if want == "" || want == state.Active && state.AppliedAt != nil && state.Forced == profileState.Forced {
+		return profileState
+	}
+	return activateProfileLocked(ctx, config, want, state)
+}
+
+// ActivateProfile forces the named profile for duration, or until the next
+// scheduled transition when duration is zero. An empty name returns to the
+// schedule.
+func ActivateProfile(ctx context.Context, name string, duration time.Duration) (ProfileState, error) {
+	if name == "" {
+		profileLock.Lock()
+		profileState.Forced, profileState.ForcedAt, profileState.Until = false, nil, nil
+		profileState.AppliedAt = nil
+		profileLock.Unlock()
+		return reconcileProfile(ctx, profileNow()), nil
+	}
+
+	config := GetCurrentConfig()
+	if _, ok := findProfile(config.Profiles, name); !ok {
+		return ProfileState{}, fmt.Errorf("%w: %q", errUnknownProfile, name)
+	}
+	profileLock.Lock()
+	defer profileLock.Unlock()
+	now := profileNow()
+	state := ProfileState{Forced: true, ForcedAt: &now}
+	if duration > 0 {
+		until := now.Add(duration)
+		state.Until = &until
+	}
+	return activateProfileLocked(ctx, config, name, state), nil
+}
+
+// StartProfiles restores a forced profile and follows the profile
+// schedule when profiles are configured.
+func StartProfiles() {
+	StopProfiles()
+	if len(GetCurrentConfig().Profiles) == 0 {
+		return
+	}
+
+	var state ProfileState
+	if err := readStateFile(profileStateFilePath, &state); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Warning: ignoring profile state: %v", err)
+	}
+	// Brightness is not persistent, so the profile is applied again.
+	state.AppliedAt = nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	profileLock.Lock()
+	profileState = state
+	profileCancel = cancel
+	profileLock.Unlock()
+
+	go func() {
+		for {
+			reconcileProfile(ctx, profileNow())
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(profileCheckInterval):
+			}
+		}
+	}()
+}
+
+// StopProfiles stops following the profile schedule.
+func StopProfiles() {
+	profileLock.Lock()
+	defer profileLock.Unlock()
+	if profileCancel != nil {
+		profileCancel()
+		profileCancel = nil
+	}
+}
+
+func getProfileState() ProfileState {
+	profileLock.Lock()
+	defer profileLock.Unlock()
+	return profileState
+}
+
+// activeProfileBrightness returns the brightness of the active profile, if
+// it sets one.
+func activeProfileBrightness(config Config) (int, bool) {
+	profile, ok := findProfile(config.Profiles, getProfileState().Active)
+	if !ok || profile.Brightness == nil {
+		return 0, false
+	}
+	return *profile.Brightness, true
+}
+
+// HandleProfiles lists the configured profiles and the active one.
+func HandleProfiles(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	config := GetCurrentConfig()
+	profiles := config.Profiles
+	if profiles == nil {
+		profiles = []ProfileConfig{}
+	}
+	scheduled, _ := scheduledProfile(profiles, profileNow())
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: ProfilesResponse{Profiles: profiles, Scheduled: scheduled, State: getProfileState()}})
+}
+
+// HandleProfileActivate forces a profile regardless of the schedule.
+func HandleProfileActivate(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req ProfileActivateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+		return
+	}
+	if req.DurationSeconds < 0 {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "durationSeconds не может быть отрицательным"})
+		return
+	}
+	state, err := ActivateProfile(r.Context(), strings.TrimSpace(req.Name), time.Duration(req.DurationSeconds)*time.Second)
+	if errors.Is(err, errUnknownProfile) {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Профиль не найден: %v", req.Name)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: state})
+}
@@ -0,0 +1,230 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func intPtr(value int) *int { return &value }
+
+func testProfiles() []ProfileConfig {
+	return []ProfileConfig{
+		{Name: "open-hours", Start: []string{"09:00"}, Playlist: "day.m3u", Volume: intPtr(60), Brightness: intPtr(100)},
+		{Name: "overnight", Start: []string{"21:00"}, Volume: intPtr(20), Brightness: intPtr(30)},
+		{Name: "promo"},
+	}
+}
+
+// setProfilesForTest replaces the profile clock, state and apply hook and
+// returns the names of the applied profiles.
+func setProfilesForTest(t *testing.T, now *time.Time) *[]string {
+	t.Helper()
+	originalNow, originalApply, originalPath := profileNow, profileApply, profileStateFilePath
+	applied := &[]string{}
+	profileNow = func() time.Time { return *now }
+	profileApply = func(_ context.Context, _ Config, profile ProfileConfig) error {
+		*applied = append(*applied, profile.Name)
+		return nil
+	}
+	profileStateFilePath = filepath.Join(t.TempDir(), "profile.json")
+	profileLock.Lock()
+	profileState = ProfileState{}
+	profileLock.Unlock()
+	t.Cleanup(func() {
+		profileNow, profileApply, profileStateFilePath = originalNow, originalApply, originalPath
+		profileLock.Lock()
+		profileState = ProfileState{}
+		profileLock.Unlock()
+	})
+	return applied
+}
+
+func TestValidateProfiles(t *testing.T) {
+	if err := validateProfiles(testProfiles()); err != nil {
+		t.Fatalf("validateProfiles() error = %v", err)
+	}
+	for _, profiles := range [][]ProfileConfig{
+		{{Name: ""}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Start: []string{"25:00"}}},
+		{{Name: "a", Playlist: "../etc/passwd"}},
+		{{Name: "a", Playlist: "/etc/playlist.m3u"}},
+		{{Name: "a", Volume: intPtr(101)}},
+		{{Name: "a", Brightness: intPtr(-1)}},
+	} {
+		if err := validateProfiles(profiles); err == nil {
+			t.Errorf("expected an error for %+v", profiles)
+		}
+	}
+}
+
+func TestScheduledProfile(t *testing.T) {
+	profiles := testProfiles()
+	tests := []struct {
+		now   time.Time
+		name  string
+		since time.Time
+	}{
+		{time.Date(2026, 3, 2, 12, 0, 0, 0, time.Local), "open-hours", time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local)},
+		{time.Date(2026, 3, 2, 21, 0, 0, 0, time.Local), "overnight", time.Date(2026, 3, 2, 21, 0, 0, 0, time.Local)},
+		{time.Date(2026, 3, 2, 3, 0, 0, 0, time.Local), "overnight", time.Date(2026, 3, 1, 21, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		name, since := scheduledProfile(profiles, tt.now)
+		if name != tt.name || !since.Equal(tt.since) {
+			t.Errorf("scheduledProfile(%v) = %s %v, want %s %v", tt.now, name, since, tt.name, tt.since)
+		}
+	}
+	if name, _ := scheduledProfile([]ProfileConfig{{Name: "promo"}}, time.Now()); name != "" {
+		t.Errorf("expected no scheduled profile, got %q", name)
+	}
+}
+
+func TestReconcileProfileFollowsSchedule(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.Local)
+	applied := setProfilesForTest(t, &now)
+	setCurrentConfigForTest(t, Config{Profiles: testProfiles()})
+
+	reconcileProfile(context.Background(), now)
+	reconcileProfile(context.Background(), now)
+	now = now.Add(10 * time.Hour)
+	state := reconcileProfile(context.Background(), now)
+
+	if strings.Join(*applied, ",") != "open-hours,overnight" {
+		t.Fatalf("applied %v, want each profile once", *applied)
+	}
+	if state.Active != "overnight" || state.Forced {
+		t.Fatalf("unexpected state %+v", state)
+	}
+}
+
+func TestActivateProfileUntilNextTransition(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.Local)
+	applied := setProfilesForTest(t, &now)
+	setCurrentConfigForTest(t, Config{Profiles: testProfiles()})
+
+	if _, err := ActivateProfile(context.Background(), "missing", 0); err == nil {
+		t.Fatal("expected an error for an unknown profile")
+	}
+	state, err := ActivateProfile(context.Background(), "promo", 0)
+	if err != nil || state.Active != "promo" || !state.Forced {
+		t.Fatalf("ActivateProfile() = %+v, %v", state, err)
+	}
+
+	// The forced profile survives a restart and holds until overnight starts.
+	profileLock.Lock()
+	profileState = ProfileState{}
+	profileLock.Unlock()
+	var persisted ProfileState
+	if err := readStateFile(profileStateFilePath, &persisted); err != nil {
+		t.Fatal(err)
+	}
+	profileLock.Lock()
+	profileState = persisted
+	profileLock.Unlock()
+
+	now = now.Add(time.Hour)
+	if state := reconcileProfile(context.Background(), now); state.Active != "promo" {
+		t.Fatalf("expected the forced profile to hold, got %+v", state)
+	}
+	now = now.Add(9 * time.Hour)
+	if state := reconcileProfile(context.Background(), now); state.Active != "overnight" || state.Forced {
+		t.Fatalf("expected the schedule to resume, got %+v", state)
+	}
+	if strings.Join(*applied, ",") != "promo,overnight" {
+		t.Fatalf("applied %v", *applied)
+	}
+}
+
+func TestActivateProfileForDuration(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.Local)
+	setProfilesForTest(t, &now)
+	setCurrentConfigForTest(t, Config{Profiles: testProfiles()})
+
+	if _, err := ActivateProfile(context.Background(), "overnight", 30*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(29 * time.Minute)
+	if state := reconcileProfile(context.Background(), now); state.Active != "overnight" {
+		t.Fatalf("expected the forced profile to hold, got %+v", state)
+	}
+	now = now.Add(time.Minute)
+	if state := reconcileProfile(context.Background(), now); state.Active != "open-hours" || state.Forced {
+		t.Fatalf("expected the schedule to resume, got %+v", state)
+	}
+
+	if _, err := ActivateProfile(context.Background(), "promo", 0); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := ActivateProfile(context.Background(), "", 0); err != nil || state.Active != "open-hours" || state.Forced {
+		t.Fatalf("expected an empty name to return to the schedule, got %+v, %v", state, err)
+	}
+}
+
+func TestUpdateProfileDropIns(t *testing.T) {
+	unitDir := setSystemdUnitDirForTest(t)
+	config := Config{Playlist: PlaylistConfig{Destination: "/var/media-pi/playlist"}, Profiles: testProfiles()}
+	dropIn := filepath.Join(unitDir, playbackServiceUnit+".d", profileDropInName)
+
+	changed, err := updateProfileDropIns(config, config.Profiles[0])
+	if err != nil || !changed {
+		t.Fatalf("updateProfileDropIns() = %v, %v", changed, err)
+	}
+	content, err := os.ReadFile(dropIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "/var/media-pi/playlist/day.m3u") {
+		t.Fatalf("drop-in does not play the profile playlist:\n%s", content)
+	}
+	if changed, err := updateProfileDropIns(config, config.Profiles[0]); err != nil || changed {
+		t.Fatalf("expected no change for the same profile, got %v, %v", changed, err)
+	}
+	if changed, err := updateProfileDropIns(config, config.Profiles[1]); err != nil || !changed {
+		t.Fatalf("expected the drop-in to be removed, got %v, %v", changed, err)
+	}
+	if _, err := os.Stat(dropIn); !os.IsNotExist(err) {
+		t.Fatalf("drop-in still exists: %v", err)
+	}
+}
+
+func TestHandleProfileActivate(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.Local)
+	setProfilesForTest(t, &now)
+	setCurrentConfigForTest(t, Config{Profiles: testProfiles()})
+
+	rr := httptest.NewRecorder()
+	HandleProfileActivate(rr, httptest.NewRequest(http.MethodPost, "/api/profiles/activate", bytes.NewBufferString(`{"name":"missing"}`)))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	HandleProfileActivate(rr, httptest.NewRequest(http.MethodPost, "/api/profiles/activate", bytes.NewBufferString(`{"name":"promo","durationSeconds":600}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	HandleProfiles(rr, httptest.NewRequest(http.MethodGet, "/api/profiles", nil))
+	var resp struct {
+		Data ProfilesResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Scheduled != "open-hours" || resp.Data.State.Active != "promo" || resp.Data.State.Until == nil || len(resp.Data.Profiles) != 3 {
+		t.Fatalf("unexpected response %+v", resp.Data)
+	}
+}
@@ -0,0 +1,427 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProofOfPlayConfig controls playback statistics. Plays are read from the
+// mpv IPC socket (player.ipc_socket), aggregated per hour, file and display
+// output and reported to the core, so advertisers get evidence that their
+// campaigns aired.
+type ProofOfPlayConfig struct {
+	Enabled        bool          `yaml:"enabled,omitempty"`
+	UploadInterval time.Duration `yaml:"upload_interval,omitempty"`
+}
+
+// DefaultProofOfPlayUploadInterval is how often completed hours are
+// reported to the core.
+const DefaultProofOfPlayUploadInterval = time.Hour
+
+const (
+	// proofOfPlayFlushInterval bounds the plays lost on a power cut while
+	// keeping SD card writes rare.
+	proofOfPlayFlushInterval = 5 * time.Minute
+	// proofOfPlayReconnectDelay is the pause before reconnecting to a
+	// player that is not running.
+	proofOfPlayReconnectDelay = 10 * time.Second
+	proofOfPlayRequestTimeout = 30 * time.Second
+)
+
+const (
+	metricPlaybackPlays     = "media_pi_playback_plays_total"
+	metricProofOfPlayErrors = "media_pi_proof_of_play_upload_errors_total"
+)
+
+func init() {
+	registerCounter(metricPlaybackPlays, "Plays recorded for proof-of-play reports.")
+	registerCounter(metricProofOfPlayErrors, "Failed proof-of-play report uploads.")
+}
+
+// PlayRecord aggregates the plays of one file on one display output that
+// started within one UTC hour.
+type PlayRecord struct {
+	Hour            time.Time `json:"hour"`
+	Output          string    `json:"output,omitempty"`
+	Filename        string    `json:"filename"`
+	Plays           int       `json:"plays"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	FirstPlayedAt   time.Time `json:"firstPlayedAt"`
+	LastPlayedAt    time.Time `json:"lastPlayedAt"`
+}
+
+// ProofOfPlayReport is the body of POST /api/devicesync/proof-of-play.
+// Hours are reported after they are over; a play still running then is
+// sent later in another record for the same hour, which the core adds up.
+type ProofOfPlayReport struct {
+	Records []PlayRecord `json:"records"`
+}
+
+type playKey struct {
+	hour     time.Time
+	output   string
+	filename string
+}
+
+// playStats holds plays not yet reported to the core.
+type playStats struct {
+	mu      sync.Mutex
+	records map[playKey]*PlayRecord
+	dirty   bool
+}
+
+var (
+	// playStatsFilePath persists unreported plays across restarts.
+	playStatsFilePath = filepath.Join(agentStateDir, "proof-of-play.json")
+
+	pendingPlays = &playStats{records: map[playKey]*PlayRecord{}}
+
+	proofOfPlayLock   sync.Mutex
+	proofOfPlayCancel context.CancelFunc
+	proofOfPlayDone   chan struct{}
+
+	// playStatsNow returns the current time. Tests may override it.
+	playStatsNow = time.Now
+)
+
+// record adds one play of filename that ran from start to end.
+func (s *playStats) record(output, filename string, start, end time.Time) {
+	start, end = start.UTC(), end.UTC()
+	key := playKey{hour: start.Truncate(time.Hour), output: output, filename: filename}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[key]
+	if !ok {
+		rec = &PlayRecord{Hour: key.hour, Output: output, Filename: filename, FirstPlayedAt: start}
+		s.records[key] = rec
+	}
+	rec.Plays++
+	rec.DurationSeconds += end.Sub(start).Seconds()
+	rec.LastPlayedAt = start
+	s.dirty = true
+	metricAdd(metricPlaybackPlays, 1)
+}
+
+// snapshot returns the records of hours before until, or all of them for a
+// zero until, in a stable order.
+func (s *playStats) snapshot(until time.Time) []PlayRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]PlayRecord, 0, len(s.records))
+	for key, rec := range s.records {
+		if until.IsZero() || key.hour.Before(until) {
+			records = append(records, *rec)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if !a.Hour.Equal(b.Hour) {
+			return a.Hour.Before(b.Hour)
+		}
+		if a.Output != b.Output {
+			return a.Output < b.Output
+		}
+		return a.Filename < b.Filename
+	})
+	return records
+}
+
+// remove drops reported records. Plays added to them after the snapshot
+// are kept and reported with the next upload.
+func (s *playStats) remove(reported []PlayRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rec := range reported {
+		key := playKey{hour: rec.Hour, output: rec.Output, filename: rec.Filename}
+		current, ok := s.records[key]
+		if !ok {
+			continue
+		}
+		if current.Plays == rec.Plays {
+			delete(s.records, key)
+		} else {
+			current.Plays -= rec.Plays
+			current.DurationSeconds -= rec.DurationSeconds
+		}
+		s.dirty = true
+	}
+}
+
+func (s *playStats) load(records []PlayRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = make(map[playKey]*PlayRecord, len(records))
+	for _, rec := range records {
+		s.records[playKey{hour: rec.Hour, output: rec.Output, filename: rec.Filename}] = &rec
+	}
+	s.dirty = false
+}
+
+// persist writes the records when they changed since the last write.
+func (s *playStats) persist() {
+	s.mu.Lock()
+	dirty := s.dirty
+	s.dirty = false
+	s.mu.Unlock()
+	if !dirty {
+		return
+	}
+	if err := writeStateFile(playStatsFilePath, s.snapshot(time.Time{})); err != nil {
+		log.Printf("Warning: Failed to persist proof-of-play stats: %v", err)
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+}
+
+// mpvEvent is an event line of the mpv JSON IPC protocol.
+type mpvEvent struct {
+	Event           string          `json:"event"`
+	Name            string          `json:"name"`
+	Data            json.RawMessage `json:"data"`
+	PlaylistEntryID int64           `json:"playlist_entry_id"`
+	Reason          string          `json:"reason"`
+}
+
+type mpvPlaylistEntry struct {
+	ID       int64  `json:"id"`
+	Filename string `json:"filename"`
+}
+
+// playFilename names a played file relative to the media directory when it
+// lies inside it.
+func playFilename(mediaDir, filename string) string {
+	if filepath.IsAbs(filename) {
+		if rel, err := filepath.Rel(mediaDir, filename); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.ToSlash(filename)
+}
+
+// watchPlayerPlays records the plays of one mpv player until ctx is done or
+// the connection fails. A play runs from start-file to end-file of the same
+// playlist entry; plays that failed to load are not counted, and a play cut
+// short by a lost connection is dropped.
+func watchPlayerPlays(ctx context.Context, socket, output, mediaDir string, stats *playStats) error {
+	conn, err := dialMPV(ctx, socket)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.command([]any{"observe_property", 1, "playlist"}); err != nil {
+		return err
+	}
+
+	filenames := map[int64]string{}
+	var playing int64
+	var started time.Time
+	for {
+		line, err := conn.reader.ReadBytes('\n')
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		var event mpvEvent
+		if json.Unmarshal(line, &event) != nil {
+			continue
+		}
+		switch event.Event {
+		case "property-change":
+			if event.Name != "playlist" {
+				continue
+			}
+			var entries []mpvPlaylistEntry
+			if json.Unmarshal(event.Data, &entries) != nil {
+				continue
+			}
+			for _, entry := range entries {
+				filenames[entry.ID] = entry.Filename
+			}
+		case "start-file":
+			playing, started = event.PlaylistEntryID, playStatsNow()
+		case "end-file":
+			if playing == 0 || event.PlaylistEntryID != playing {
+				continue
+			}
+			if filename := filenames[playing]; filename != "" && event.Reason != "error" {
+				filename, ended := playFilename(mediaDir, filename), playStatsNow()
+				stats.record(output, filename, started, ended)
+				publishEvent(EventPlaybackPlay, PlaybackEvent{Output: output, Filename: filename, StartedAt: started.UTC(), DurationSeconds: ended.Sub(started).Seconds()})
+			}
+			playing = 0
+		}
+	}
+}
+
+// uploadProofOfPlay reports records to the core.
+func uploadProofOfPlay(ctx context.Context, config Config, records []PlayRecord) error {
+	if strings.TrimSpace(config.CoreAPIBase) == "" {
+		return fmt.Errorf("core_api_base not configured")
+	}
+	if strings.TrimSpace(config.ServerKey) == "" {
+		return fmt.Errorf("server_key not configured")
+	}
+	body, err := json.Marshal(ProofOfPlayReport{Records: records})
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimRight(config.CoreAPIBase, "/") + "/api/devicesync/proof-of-play"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Device-Id", config.ServerKey)
+
+	resp, err := getCoreClient().Do(ctx, req, proofOfPlayRequestTimeout)
+	if err != nil {
+		return fmt.Errorf("post proof-of-play report: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// reportCompletedHours uploads plays of hours that are over and drops them
+// once the core accepted them.
+func reportCompletedHours(ctx context.Context, config Config, stats *playStats) error {
+	records := stats.snapshot(playStatsNow().UTC().Truncate(time.Hour))
+	if len(records) == 0 {
+		return nil
+	}
+	if err := uploadProofOfPlay(ctx, config, records); err != nil {
+		metricAdd(metricProofOfPlayErrors, 1)
+		return err
+	}
+	log.Printf("Reported %d proof-of-play record(s)", len(records))
+	stats.remove(records)
+	stats.persist()
+	return nil
+}
+
+// StartProofOfPlay watches every mpv player and reports completed hours to
+// the core every proof_of_play.upload_interval when proof_of_play.enabled
+// is set. Plays not yet reported are restored from disk.
+func StartProofOfPlay() {
+	StopProofOfPlay()
+	config := GetCurrentConfig()
+	if !config.ProofOfPlay.Enabled {
+		return
+	}
+	sockets := playerIPCOutputs(config)
+	if len(sockets) == 0 {
+		log.Println("Warning: proof_of_play needs player.ipc_socket of an mpv player")
+		return
+	}
+
+	var records []PlayRecord
+	if err := readStateFile(playStatsFilePath, &records); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Warning: ignoring proof-of-play stats: %v", err)
+	}
+	pendingPlays.load(records)
+
+	interval := config.ProofOfPlay.UploadInterval
+	if interval <= 0 {
+		interval = DefaultProofOfPlayUploadInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	proofOfPlayLock.Lock()
+	proofOfPlayCancel = cancel
+	proofOfPlayDone = done
+	proofOfPlayLock.Unlock()
+
+	var wg sync.WaitGroup
+	mediaDir := mediaDirFor(config)
+	for _, player := range sockets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if err := watchPlayerPlays(ctx, player.Socket, player.Output, mediaDir, pendingPlays); err != nil {
+					log.Printf("Proof-of-play: player %s: %v", player.Socket, err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(proofOfPlayReconnectDelay):
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		flush := time.NewTicker(proofOfPlayFlushInterval)
+		defer flush.Stop()
+		upload := time.NewTicker(interval)
+		defer upload.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				pendingPlays.persist()
+				return
+			case <-flush.C:
+				pendingPlays.persist()
+			case <-upload.C:
+				if err := reportCompletedHours(ctx, GetCurrentConfig(), pendingPlays); err != nil {
+					log.Printf("Warning: proof-of-play upload failed: %v", err)
+				}
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+}
+
+// StopProofOfPlay stops watching players and saves unreported plays.
+func StopProofOfPlay() {
+	proofOfPlayLock.Lock()
+	cancel, done := proofOfPlayCancel, proofOfPlayDone
+	proofOfPlayCancel, proofOfPlayDone = nil, nil
+	proofOfPlayLock.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// HandlePlaybackStats returns the plays not yet reported to the core.
+func HandlePlaybackStats(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: pendingPlays.snapshot(time.Time{})})
+}
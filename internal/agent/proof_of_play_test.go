@@ -0,0 +1,142 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// setPlayStatsClockForTest makes playStatsNow advance by step on each call.
+func setPlayStatsClockForTest(t *testing.T, start time.Time, step time.Duration) {
+	t.Helper()
+	original := playStatsNow
+	now := start
+	playStatsNow = func() time.Time {
+		current := now
+		now = now.Add(step)
+		return current
+	}
+	t.Cleanup(func() { playStatsNow = original })
+}
+
+// serveMPVEvents answers the first command on a fresh socket and then
+// sends events before closing the connection.
+func serveMPVEvents(t *testing.T, events ...string) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "mpv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "mpv.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		scanner := bufio.NewScanner(conn)
+		if !scanner.Scan() {
+			return
+		}
+		var req struct {
+			RequestID int `json:"request_id"`
+		}
+		_ = json.Unmarshal(scanner.Bytes(), &req)
+		reply, _ := json.Marshal(map[string]any{"request_id": req.RequestID, "error": "success"})
+		_, _ = conn.Write(append(reply, '\n'))
+		for _, event := range events {
+			_, _ = conn.Write([]byte(event + "\n"))
+		}
+	}()
+	return socket
+}
+
+func TestWatchPlayerPlays(t *testing.T) {
+	setPlayStatsClockForTest(t, time.Date(2026, 3, 1, 10, 59, 0, 0, time.UTC), 30*time.Second)
+	socket := serveMPVEvents(t,
+		`{"event":"property-change","id":1,"name":"playlist","data":[{"id":1,"filename":"/var/media-pi/ads/a.mp4"},{"id":2,"filename":"b.mp4"}]}`,
+		`{"event":"start-file","playlist_entry_id":1}`,
+		`{"event":"end-file","reason":"eof","playlist_entry_id":1}`,
+		`{"event":"start-file","playlist_entry_id":2}`,
+		`{"event":"end-file","reason":"error","playlist_entry_id":2}`,
+		`{"event":"start-file","playlist_entry_id":1}`,
+		`{"event":"end-file","reason":"eof","playlist_entry_id":1}`,
+		`{"event":"start-file","playlist_entry_id":2}`,
+	)
+	stats := &playStats{records: map[playKey]*PlayRecord{}}
+	if err := watchPlayerPlays(context.Background(), socket, "HDMI-A-1", "/var/media-pi", stats); err == nil {
+		t.Fatal("expected the closed connection to be reported")
+	}
+
+	hour := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	want := []PlayRecord{
+		{Hour: hour, Output: "HDMI-A-1", Filename: "ads/a.mp4", Plays: 1, DurationSeconds: 30,
+			FirstPlayedAt: hour.Add(59 * time.Minute), LastPlayedAt: hour.Add(59 * time.Minute)},
+		{Hour: hour.Add(time.Hour), Output: "HDMI-A-1", Filename: "ads/a.mp4", Plays: 1, DurationSeconds: 30,
+			FirstPlayedAt: hour.Add(time.Hour + 30*time.Second), LastPlayedAt: hour.Add(time.Hour + 30*time.Second)},
+	}
+	if got := stats.snapshot(time.Time{}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("snapshot = %+v, want %+v", got, want)
+	}
+}
+
+func TestReportCompletedHours(t *testing.T) {
+	var reports []ProofOfPlayReport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/devicesync/proof-of-play" || r.Header.Get("X-Device-Id") != "key" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		var report ProofOfPlayReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Error(err)
+		}
+		reports = append(reports, report)
+	}))
+	defer server.Close()
+
+	originalPath := playStatsFilePath
+	playStatsFilePath = filepath.Join(t.TempDir(), "proof-of-play.json")
+	t.Cleanup(func() { playStatsFilePath = originalPath })
+	setPlayStatsClockForTest(t, time.Date(2026, 3, 1, 11, 30, 0, 0, time.UTC), 0)
+
+	stats := &playStats{records: map[playKey]*PlayRecord{}}
+	stats.record("", "a.mp4", time.Date(2026, 3, 1, 10, 15, 0, 0, time.UTC), time.Date(2026, 3, 1, 10, 15, 20, 0, time.UTC))
+	stats.record("", "a.mp4", time.Date(2026, 3, 1, 10, 45, 0, 0, time.UTC), time.Date(2026, 3, 1, 10, 45, 20, 0, time.UTC))
+	stats.record("", "a.mp4", time.Date(2026, 3, 1, 11, 5, 0, 0, time.UTC), time.Date(2026, 3, 1, 11, 5, 20, 0, time.UTC))
+
+	config := Config{CoreAPIBase: server.URL, ServerKey: "key"}
+	if err := reportCompletedHours(context.Background(), config, stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || len(reports[0].Records) != 1 || reports[0].Records[0].Plays != 2 || reports[0].Records[0].DurationSeconds != 40 {
+		t.Fatalf("expected the completed hour reported, got %+v", reports)
+	}
+	remaining := stats.snapshot(time.Time{})
+	if len(remaining) != 1 || !remaining[0].Hour.Equal(time.Date(2026, 3, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the current hour kept, got %+v", remaining)
+	}
+
+	// Unreported plays survive a restart.
+	var saved []PlayRecord
+	if err := readStateFile(playStatsFilePath, &saved); err != nil || !reflect.DeepEqual(saved, remaining) {
+		t.Fatalf("expected unreported plays saved, got %+v, %v", saved, err)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ExecConfig lists the diagnostic commands POST /api/system/exec may run
+// and the jobs POST /api/system/jobs may start. Nothing runs unless it is
+// listed here.
+type ExecConfig struct {
+	Commands []ExecCommandConfig `yaml:"commands,omitempty"`
+	Jobs     []ExecJobConfig     `yaml:"jobs,omitempty"`
+	// Timeout bounds a command that sets no timeout of its own.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// ExecCommandConfig is one allowed command.
+type ExecCommandConfig struct {
+	// Name identifies the command in requests, e.g. "ip addr".
+	Name string `yaml:"name"`
+	// Command is the executable followed by fixed arguments, e.g.
+	// ["/usr/sbin/ip", "addr"]. It defaults to Name as a single word.
+	Command []string `yaml:"command,omitempty"`
+	// Args are regular expressions; every argument of a request must match
+	// one of them in full. Without patterns no arguments are accepted.
+	Args    []string      `yaml:"args,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// Limits of remote command execution.
+const (
+	DefaultExecTimeout = 10 * time.Second
+	maxExecTimeout     = 2 * time.Minute
+	maxExecArgs        = 16
+	// maxExecOutputBytes bounds stdout and stderr each.
+	maxExecOutputBytes = 64 << 10
+	// maxExecAuditBytes is the size at which the audit log is rotated.
+	maxExecAuditBytes = 1 << 20
+)
+
+var (
+	// execAuditLogPath receives one JSON line per exec request.
+	execAuditLogPath = filepath.Join(agentStateDir, "exec-audit.jsonl")
+
+	execAuditLock sync.Mutex
+)
+
+// ExecRequest is the body of POST /api/system/exec.
+type ExecRequest struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// ExecResult is returned by POST /api/system/exec.
+type ExecResult struct {
+	Command         string   `json:"command"`
+	Args            []string `json:"args,omitempty"`
+	ExitCode        int      `json:"exitCode"`
+	Stdout          string   `json:"stdout"`
+	Stderr          string   `json:"stderr"`
+	DurationSeconds float64  `json:"durationSeconds"`
+	TimedOut        bool     `json:"timedOut,omitempty"`
+	Truncated       bool     `json:"truncated,omitempty"`
+}
+
+// execAuditRecord is one line of the exec audit log.
+type execAuditRecord struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Command    string    `json:"command"`
+	Args       []string  `json:"args,omitempty"`
+	// Job marks a job of exec.jobs rather than a command.
+	Job             bool    `json:"job,omitempty"`
+	Allowed         bool    `json:"allowed"`
+	Reason          string  `json:"reason,omitempty"`
+	ExitCode        *int    `json:"exitCode,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	TimedOut        bool    `json:"timedOut,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// errExecNotAllowed is returned for commands and arguments outside the
+// allow-list.
+var errExecNotAllowed = errors.New("command not allowed")
+
+// limitedBuffer keeps the first limit bytes written to it.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// resolveExecCommand finds the allowed command for req and returns its
+// argv with the request arguments appended.
+func resolveExecCommand(config ExecConfig, req ExecRequest) (ExecCommandConfig, []string, error) {
+	for _, command := range config.Commands {
+		if command.Name == req.Command {
+			argv, err := execArgv(command, req.Args)
+			return command, argv, err
+		}
+	}
+	return ExecCommandConfig{}, nil, fmt.Errorf("%w: %q", errExecNotAllowed, req.Command)
+}
+
+// execArgv checks args against the patterns of command and returns the
+// argv of command with args appended.
+func execArgv(command ExecCommandConfig, args []string) ([]string, error) {
+	if len(args) > maxExecArgs {
+		return nil, fmt.Errorf("%w: more than %d arguments", errExecNotAllowed, maxExecArgs)
+	}
+	patterns := make([]*regexp.Regexp, 0, len(command.Args))
+	for _, pattern := range command.Args {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid argument pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+	for _, arg := range args {
+		matched := false
+		for _, re := range patterns {
+			if re.MatchString(arg) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("%w: argument %q", errExecNotAllowed, arg)
+		}
+	}
+	argv := append([]string{}, command.Command...)
+	if len(argv) == 0 {
+		argv = []string{command.Name}
+	}
+	return append(argv, args...), nil
+}
+
+func execTimeout(config ExecConfig, command ExecCommandConfig) time.Duration {
+	timeout := command.Timeout
+	if timeout <= 0 {
+		timeout = config.Timeout
+	}
+	if timeout <= 0 {
+		timeout = DefaultExecTimeout
+	}
+	return min(timeout, maxExecTimeout)
+}
+
+// runExecCommand runs argv without a shell and collects its output.
+func runExecCommand(ctx context.Context, argv []string, timeout time.Duration) (ExecResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr limitedBuffer
+	stdout.limit, stderr.limit = maxExecOutputBytes, maxExecOutputBytes
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+
+	started := time.Now()
+	err := cmd.Run()
+	result := ExecResult{
+		ExitCode:        -1,
+		Stdout:          stdout.buf.String(),
+		Stderr:          stderr.buf.String(),
+		DurationSeconds: time.Since(started).Seconds(),
+		TimedOut:        errors.Is(ctx.Err(), context.DeadlineExceeded),
+		Truncated:       stdout.truncated || stderr.truncated,
+	}
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !result.TimedOut {
+		return result, err
+	}
+	return result, nil
+}
+
+// auditExec logs record to the journal and appends it to the audit log,
+// rotating the log to .1 once it exceeds maxExecAuditBytes.
+func auditExec(record execAuditRecord) {
+	kind := "exec"
+	if record.Job {
+		kind = "job"
+	}
+	log.Printf("Audit: %s %q %q from %s: allowed=%t exit=%v reason=%q error=%q",
+		kind, record.Command, record.Args, record.RemoteAddr, record.Allowed, exitCodeString(record.ExitCode), record.Reason, record.Error)
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	execAuditLock.Lock()
+	defer execAuditLock.Unlock()
+	if err := os.MkdirAll(filepath.Dir(execAuditLogPath), 0755); err != nil {
+		log.Printf("Warning: failed to write exec audit log: %v", err)
+		return
+	}
+	if info, err := os.Stat(execAuditLogPath); err == nil && info.Size() > maxExecAuditBytes {
+		_ = os.Rename(execAuditLogPath, execAuditLogPath+".1")
+	}
+	file, err := os.OpenFile(execAuditLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		log.Printf("Warning: failed to write exec audit log: %v", err)
+		return
+	}
+	defer func() { _ = file.Close() }()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		log.Printf("Warning: failed to write exec audit log: %v", err)
+	}
+}
+
+func exitCodeString(code *int) string {
+	if code == nil {
+		return "-"
+	}
+	return fmt.Sprint(*code)
+}
+
+// HandleExec runs a command from exec.commands for remote diagnostics.
+// Commands run without a shell, arguments are checked against the patterns
+// of the command, and every request is written to the audit log.
+func HandleExec(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req ExecRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+		return
+	}
+
+	record := execAuditRecord{Time: time.Now().UTC(), RemoteAddr: r.RemoteAddr, Command: req.Command, Args: req.Args}
+	config := GetCurrentConfig().Exec
+	command, argv, err := resolveExecCommand(config, req)
+	if err != nil {
+		record.Reason = err.Error()
+		auditExec(record)
+		if errors.Is(err, errExecNotAllowed) {
+			JSONResponse(w, http.StatusForbidden, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Команда не разрешена: %v", err)})
+			return
+		}
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Ошибка конфигурации exec: %v", err)})
+		return
+	}
+	record.Allowed = true
+
+	result, err := runExecCommand(r.Context(), argv, execTimeout(config, command))
+	result.Command, result.Args = req.Command, req.Args
+	record.DurationSeconds = result.DurationSeconds
+	record.TimedOut = result.TimedOut
+	if err != nil {
+		record.Error = err.Error()
+		auditExec(record)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось выполнить команду: %v", err)})
+		return
+	}
+	record.ExitCode = &result.ExitCode
+	auditExec(record)
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: result})
+}
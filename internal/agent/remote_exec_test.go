@@ -0,0 +1,105 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveExecCommand(t *testing.T) {
+	config := ExecConfig{Commands: []ExecCommandConfig{
+		{Name: "ip addr", Command: []string{"/usr/sbin/ip", "addr"}},
+		{Name: "ping", Args: []string{"-c", "[0-9]{1,2}", `[a-z0-9][a-z0-9.-]*`}},
+	}}
+
+	_, argv, err := resolveExecCommand(config, ExecRequest{Command: "ip addr"})
+	if err != nil || !reflect.DeepEqual(argv, []string{"/usr/sbin/ip", "addr"}) {
+		t.Fatalf("argv = %v, %v", argv, err)
+	}
+	_, argv, err = resolveExecCommand(config, ExecRequest{Command: "ping", Args: []string{"-c", "3", "core.example.com"}})
+	if err != nil || !reflect.DeepEqual(argv, []string{"ping", "-c", "3", "core.example.com"}) {
+		t.Fatalf("argv = %v, %v", argv, err)
+	}
+
+	for _, req := range []ExecRequest{
+		{Command: "rm"},
+		{Command: "ip addr", Args: []string{"flush"}},
+		{Command: "ping", Args: []string{"-f", "core"}},
+		{Command: "ping", Args: []string{"core; reboot"}},
+	} {
+		if _, _, err := resolveExecCommand(config, req); !errors.Is(err, errExecNotAllowed) {
+			t.Errorf("%+v: expected errExecNotAllowed, got %v", req, err)
+		}
+	}
+}
+
+func TestHandleExec(t *testing.T) {
+	original := execAuditLogPath
+	execAuditLogPath = filepath.Join(t.TempDir(), "exec-audit.jsonl")
+	t.Cleanup(func() { execAuditLogPath = original })
+	setCurrentConfigForTest(t, Config{Exec: ExecConfig{Commands: []ExecCommandConfig{
+		{Name: "echo", Args: []string{"[a-z]+"}},
+		{Name: "sleep", Args: []string{"[0-9]+"}, Timeout: 100 * time.Millisecond},
+	}}})
+
+	call := func(body string) (*httptest.ResponseRecorder, ExecResult) {
+		w := httptest.NewRecorder()
+		HandleExec(w, httptest.NewRequest(http.MethodPost, "/api/system/exec", strings.NewReader(body)))
+		var resp struct {
+			Data ExecResult `json:"data"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp.Data
+	}
+
+	w, result := call(`{"command":"echo","args":["hello"]}`)
+	if w.Code != http.StatusOK || result.ExitCode != 0 || result.Stdout != "hello\n" {
+		t.Fatalf("unexpected echo result %d %+v", w.Code, result)
+	}
+
+	w, result = call(`{"command":"sleep","args":["5"]}`)
+	if w.Code != http.StatusOK || !result.TimedOut || result.DurationSeconds > 3 {
+		t.Fatalf("expected a timeout, got %d %+v", w.Code, result)
+	}
+
+	if w, _ = call(`{"command":"echo","args":["$(reboot)"]}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", w.Code)
+	}
+
+	data, err := os.ReadFile(execAuditLogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected three audit records, got %q", lines)
+	}
+	var denied execAuditRecord
+	if err := json.Unmarshal([]byte(lines[2]), &denied); err != nil || denied.Allowed || denied.Reason == "" {
+		t.Fatalf("unexpected audit record %+v, %v", denied, err)
+	}
+}
+
+func TestGarbageCollectionKeepsExecAudit(t *testing.T) {
+	rootStatePaths(t)
+	auditExec(execAuditRecord{Command: "ping", Allowed: true})
+	rotated := execAuditLogPath + ".1"
+	if garbage := garbageNextTo(t, rotated); len(garbage) != 0 {
+		t.Fatalf("the exec audit log must not be garbage collected: %v", garbage)
+	}
+	for _, path := range []string{execAuditLogPath, rotated} {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("audit log %s: %v", path, err)
+		}
+	}
+}
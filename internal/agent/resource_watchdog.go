@@ -0,0 +1,254 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ResourceWatchdogConfig controls the self-monitor that samples goroutines,
+// heap size and open file descriptors of the agent to catch leaks on
+// long-running devices.
+type ResourceWatchdogConfig struct {
+	// Disabled turns the watchdog off.
+	Disabled bool          `yaml:"disabled,omitempty"`
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// MaxGoroutines, MaxHeapMB and MaxOpenFDs are the thresholds; 0 uses
+	// the defaults.
+	MaxGoroutines int `yaml:"max_goroutines,omitempty"`
+	MaxHeapMB     int `yaml:"max_heap_mb,omitempty"`
+	MaxOpenFDs    int `yaml:"max_open_fds,omitempty"`
+	// RestartInRest restarts the agent during a schedule.rest interval
+	// while a threshold is exceeded.
+	RestartInRest bool `yaml:"restart_in_rest,omitempty"`
+}
+
+// Defaults for the resource watchdog.
+const (
+	DefaultResourceWatchdogInterval = time.Minute
+	DefaultMaxGoroutines            = 1000
+	DefaultMaxHeapMB                = 256
+	DefaultMaxOpenFDs               = 512
+
+	// maxDiagnosticBundles bounds the bundles kept on disk.
+	maxDiagnosticBundles = 5
+
+	metricGoroutines = "media_pi_goroutines"
+	metricHeapBytes  = "media_pi_heap_bytes"
+	metricOpenFDs    = "media_pi_open_fds"
+)
+
+func init() {
+	registerGauge(metricGoroutines, "Goroutines of the agent.")
+	registerGauge(metricHeapBytes, "Heap bytes allocated by the agent.")
+	registerGauge(metricOpenFDs, "File descriptors open in the agent.")
+}
+
+var (
+	// procSelfFD lists the open descriptors of the process; tests may
+	// override it.
+	procSelfFD = "/proc/self/fd"
+
+	// watchdogRestart ends the agent the way systemd stop does, so the
+	// shutdown is clean and systemd starts it again. Tests may override it.
+	watchdogRestart = func() error {
+		return syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	}
+
+	watchdogLock   sync.Mutex
+	watchdogCancel context.CancelFunc
+)
+
+// resourceSample is one measurement of the agent process.
+type resourceSample struct {
+	Goroutines int
+	HeapBytes  uint64
+	OpenFDs    int
+}
+
+// resourceLimits are the effective thresholds.
+type resourceLimits struct {
+	Goroutines int
+	HeapBytes  uint64
+	OpenFDs    int
+}
+
+func resourceWatchdogLimits(config ResourceWatchdogConfig) resourceLimits {
+	limits := resourceLimits{Goroutines: DefaultMaxGoroutines, HeapBytes: DefaultMaxHeapMB << 20, OpenFDs: DefaultMaxOpenFDs}
+	if config.MaxGoroutines > 0 {
+		limits.Goroutines = config.MaxGoroutines
+	}
+	if config.MaxHeapMB > 0 {
+		limits.HeapBytes = uint64(config.MaxHeapMB) << 20
+	}
+	if config.MaxOpenFDs > 0 {
+		limits.OpenFDs = config.MaxOpenFDs
+	}
+	return limits
+}
+
+// sampleResources measures the agent process. OpenFDs is -1 when the
+// descriptors cannot be listed.
+func sampleResources() resourceSample {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	sample := resourceSample{Goroutines: runtime.NumGoroutine(), HeapBytes: mem.HeapAlloc, OpenFDs: -1}
+	if entries, err := os.ReadDir(procSelfFD); err == nil {
+		sample.OpenFDs = len(entries)
+	}
+	return sample
+}
+
+// exceeded describes the thresholds sample is over, or returns nil.
+func (limits resourceLimits) exceeded(sample resourceSample) []string {
+	var over []string
+	if sample.Goroutines > limits.Goroutines {
+		over = append(over, fmt.Sprintf("goroutines %d > %d", sample.Goroutines, limits.Goroutines))
+	}
+	if sample.HeapBytes > limits.HeapBytes {
+		over = append(over, fmt.Sprintf("heap %d MB > %d MB", sample.HeapBytes>>20, limits.HeapBytes>>20))
+	}
+	if sample.OpenFDs > limits.OpenFDs {
+		over = append(over, fmt.Sprintf("open fds %d > %d", sample.OpenFDs, limits.OpenFDs))
+	}
+	return over
+}
+
+// writeDiagnosticBundle saves goroutine stacks, a heap profile and the open
+// descriptors next to the crash reports and returns the file path. Only the
+// latest maxDiagnosticBundles bundles are kept.
+func writeDiagnosticBundle(sample resourceSample, over []string) (string, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Media Pi agent %s diagnostics at %s\n", GetVersion(), time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "goroutines: %d\nheap bytes: %d\nopen fds: %d\nexceeded: %v\n", sample.Goroutines, sample.HeapBytes, sample.OpenFDs, over)
+
+	b.WriteString("\n== open file descriptors ==\n")
+	if entries, err := os.ReadDir(procSelfFD); err == nil {
+		for _, entry := range entries {
+			target, _ := os.Readlink(filepath.Join(procSelfFD, entry.Name()))
+			fmt.Fprintf(&b, "%s -> %s\n", entry.Name(), target)
+		}
+	}
+	b.WriteString("\n== goroutines ==\n")
+	_ = pprof.Lookup("goroutine").WriteTo(&b, 1)
+	b.WriteString("\n== heap ==\n")
+	_ = pprof.Lookup("heap").WriteTo(&b, 1)
+
+	if err := os.MkdirAll(crashDir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(crashDir, fmt.Sprintf("diagnostics-%d.txt", time.Now().UnixNano()))
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	if bundles, err := filepath.Glob(filepath.Join(crashDir, "diagnostics-*.txt")); err == nil {
+		slices.Sort(bundles)
+		for len(bundles) > maxDiagnosticBundles {
+			_ = os.Remove(bundles[0])
+			bundles = bundles[1:]
+		}
+	}
+	return path, nil
+}
+
+// resourceWatchdog tracks threshold breaches between samples.
+type resourceWatchdog struct {
+	// breached is set while a threshold is exceeded, so a bundle is
+	// written once per breach.
+	breached bool
+}
+
+// check samples the agent and reacts to exceeded thresholds. It reports
+// whether the agent is being restarted.
+func (watchdog *resourceWatchdog) check(config Config, now time.Time) bool {
+	sample := sampleResources()
+	metricSet(metricGoroutines, float64(sample.Goroutines))
+	metricSet(metricHeapBytes, float64(sample.HeapBytes))
+	if sample.OpenFDs >= 0 {
+		metricSet(metricOpenFDs, float64(sample.OpenFDs))
+	}
+
+	over := resourceWatchdogLimits(config.ResourceWatchdog).exceeded(sample)
+	if len(over) == 0 {
+		if watchdog.breached {
+			log.Printf("Resource watchdog: usage back under the thresholds")
+		}
+		watchdog.breached = false
+		return false
+	}
+
+	if !watchdog.breached {
+		watchdog.breached = true
+		path, err := writeDiagnosticBundle(sample, over)
+		if err != nil {
+			log.Printf("Warning: resource watchdog: %v exceeded, failed to write diagnostics: %v", over, err)
+		} else {
+			log.Printf("Warning: resource watchdog: %v exceeded, diagnostics saved to %s", over, path)
+		}
+	}
+
+	if config.ResourceWatchdog.RestartInRest && isWithinConfiguredRestInterval(now, config.Schedule.Rest) {
+		log.Printf("Resource watchdog: restarting the agent during the rest interval")
+		if err := watchdogRestart(); err != nil {
+			log.Printf("Warning: resource watchdog failed to restart the agent: %v", err)
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// StartResourceWatchdog samples the agent every resource_watchdog.interval
+// unless resource_watchdog.disabled is set.
+func StartResourceWatchdog() {
+	StopResourceWatchdog()
+	config := GetCurrentConfig().ResourceWatchdog
+	if config.Disabled {
+		return
+	}
+	interval := config.Interval
+	if interval <= 0 {
+		interval = DefaultResourceWatchdogInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watchdogLock.Lock()
+	watchdogCancel = cancel
+	watchdogLock.Unlock()
+
+	go func() {
+		watchdog := &resourceWatchdog{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			if watchdog.check(GetCurrentConfig(), time.Now()) {
+				return
+			}
+		}
+	}()
+}
+
+// StopResourceWatchdog stops the resource watchdog loop.
+func StopResourceWatchdog() {
+	watchdogLock.Lock()
+	defer watchdogLock.Unlock()
+	if watchdogCancel != nil {
+		watchdogCancel()
+		watchdogCancel = nil
+	}
+}
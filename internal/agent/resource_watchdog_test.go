@@ -0,0 +1,68 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResourceLimitsExceeded(t *testing.T) {
+	limits := resourceWatchdogLimits(ResourceWatchdogConfig{MaxGoroutines: 10, MaxOpenFDs: 20})
+	if limits.HeapBytes != DefaultMaxHeapMB<<20 {
+		t.Fatalf("expected the default heap limit, got %d", limits.HeapBytes)
+	}
+	if over := limits.exceeded(resourceSample{Goroutines: 10, HeapBytes: 1 << 20, OpenFDs: 20}); over != nil {
+		t.Fatalf("expected no breach at the thresholds, got %v", over)
+	}
+	over := limits.exceeded(resourceSample{Goroutines: 11, HeapBytes: 1 << 20, OpenFDs: 21})
+	if len(over) != 2 || !strings.HasPrefix(over[0], "goroutines") || !strings.HasPrefix(over[1], "open fds") {
+		t.Fatalf("unexpected breaches %v", over)
+	}
+}
+
+func TestResourceWatchdogCheck(t *testing.T) {
+	originalDir, originalRestart := crashDir, watchdogRestart
+	t.Cleanup(func() { crashDir, watchdogRestart = originalDir, originalRestart })
+	crashDir = t.TempDir()
+	restarts := 0
+	watchdogRestart = func() error {
+		restarts++
+		return nil
+	}
+
+	config := Config{
+		ResourceWatchdog: ResourceWatchdogConfig{MaxGoroutines: 1, RestartInRest: true},
+		Schedule:         ScheduleConfig{Rest: []RestTimePairConfig{{Start: "23:00", Stop: "07:00"}}},
+	}
+	watchdog := &resourceWatchdog{}
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+
+	if watchdog.check(config, day) || restarts != 0 {
+		t.Fatal("expected no restart outside the rest interval")
+	}
+	if watchdog.check(config, day.Add(time.Minute)) {
+		t.Fatal("expected no restart outside the rest interval")
+	}
+	bundles, _ := filepath.Glob(filepath.Join(crashDir, "diagnostics-*.txt"))
+	if len(bundles) != 1 {
+		t.Fatalf("expected one diagnostic bundle per breach, got %v", bundles)
+	}
+	data, err := os.ReadFile(bundles[0])
+	if err != nil || !strings.Contains(string(data), "== goroutines ==") {
+		t.Fatalf("unexpected bundle %q, %v", data, err)
+	}
+
+	if !watchdog.check(config, day.Add(12*time.Hour)) || restarts != 1 {
+		t.Fatalf("expected a restart in the rest interval, got %d", restarts)
+	}
+
+	config.ResourceWatchdog.RestartInRest = false
+	if watchdog.check(config, day.Add(12*time.Hour)) || restarts != 1 {
+		t.Fatal("expected no restart without restart_in_rest")
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatusCacheConfig controls the cache of the status endpoints wrapped in
+// CachedResponse.
+type StatusCacheConfig struct {
+	// TTL is how long a status response is reused; see
+	// DefaultStatusCacheTTL. A negative value disables the cache.
+	TTL time.Duration `yaml:"ttl,omitempty"`
+}
+
+// DefaultStatusCacheTTL is used when status_cache.ttl is not set. It is
+// short enough for dashboards and keeps frequent polling off D-Bus.
+const DefaultStatusCacheTTL = 2 * time.Second
+
+const metricStatusCacheHits = "media_pi_status_cache_hits_total"
+
+func init() {
+	registerCounter(metricStatusCacheHits, "Status API responses served from the cache.")
+}
+
+func statusCacheTTL(config Config) time.Duration {
+	if config.StatusCache.TTL == 0 {
+		return DefaultStatusCacheTTL
+	}
+	return config.StatusCache.TTL
+}
+
+// cachedResponse is a stored successful response. mu is held while the
+// response is computed, so concurrent misses call the handler once.
+type cachedResponse struct {
+	mu          sync.Mutex
+	contentType string
+	body        []byte
+	storedAt    time.Time
+}
+
+var (
+	responseCache     = map[string]*cachedResponse{}
+	responseCacheLock sync.Mutex
+)
+
+// invalidateResponseCache drops every cached response. It is called when
+// units, the configuration or sync state change.
+func invalidateResponseCache() {
+	responseCacheLock.Lock()
+	responseCache = map[string]*cachedResponse{}
+	responseCacheLock.Unlock()
+}
+
+// bypassResponseCache reports whether the client asked for a fresh response
+// with Cache-Control: no-cache (or no-store).
+func bypassResponseCache(r *http.Request) bool {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache", "no-store":
+			return true
+		}
+	}
+	return false
+}
+
+// CachedResponse serves successful GET responses of next from a cache for
+// status_cache.ttl. Responses are kept per path, query and language; the
+// Age response header tells how old a cached one is.
+func CachedResponse(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ttl := statusCacheTTL(GetCurrentConfig())
+		if r.Method != http.MethodGet || ttl < 0 {
+			next(w, r)
+			return
+		}
+		key := r.URL.Path + "?" + r.URL.RawQuery + "#" + w.Header().Get("Content-Language")
+
+		responseCacheLock.Lock()
+		entry, ok := responseCache[key]
+		if !ok {
+			entry = &cachedResponse{}
+			responseCache[key] = entry
+		}
+		responseCacheLock.Unlock()
+
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		now := time.Now()
+		if entry.body != nil && now.Sub(entry.storedAt) < ttl && !bypassResponseCache(r) {
+			metricAdd(metricStatusCacheHits, 1)
+			w.Header().Set("Content-Type", entry.contentType)
+			w.Header().Set("Age", strconv.Itoa(int(now.Sub(entry.storedAt).Seconds())))
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(entry.body)
+			return
+		}
+
+		buffered := &bufferedResponse{header: w.Header()}
+		next(buffered, r)
+		if buffered.status == 0 {
+			buffered.status = http.StatusOK
+		}
+		// An entry dropped by invalidateResponseCache meanwhile is no
+		// longer reachable, so a response computed before a change is
+		// never served after it.
+		if buffered.status == http.StatusOK {
+			entry.contentType = w.Header().Get("Content-Type")
+			entry.body = append([]byte(nil), buffered.body.Bytes()...)
+			entry.storedAt = now
+		}
+		w.WriteHeader(buffered.status)
+		_, _ = w.Write(buffered.body.Bytes())
+	}
+}
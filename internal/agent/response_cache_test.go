@@ -0,0 +1,91 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCachedResponse(t *testing.T) {
+	invalidateResponseCache()
+	t.Cleanup(invalidateResponseCache)
+	setCurrentConfigForTest(t, Config{StatusCache: StatusCacheConfig{TTL: time.Minute}})
+
+	calls := 0
+	status := http.StatusOK
+	handler := CachedResponse(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		JSONResponse(w, status, APIResponse{OK: status == http.StatusOK, Data: calls})
+	})
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/units", nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	first, second := get(nil), get(nil)
+	if calls != 1 || first.Body.String() != second.Body.String() || second.Header().Get("Age") == "" {
+		t.Fatalf("calls = %d, bodies %q, %q, Age %q", calls, first.Body.String(), second.Body.String(), second.Header().Get("Age"))
+	}
+	if second.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Content-Type = %q", second.Header().Get("Content-Type"))
+	}
+
+	get(http.Header{"Cache-Control": {"no-cache"}})
+	if calls != 2 {
+		t.Fatalf("Cache-Control: no-cache must bypass the cache, calls = %d", calls)
+	}
+
+	publishEvent(EventUnitChanged, UnitEvent{Unit: "play.video.service", Action: "stop"})
+	get(nil)
+	if calls != 3 {
+		t.Fatalf("a unit change must invalidate the cache, calls = %d", calls)
+	}
+
+	invalidateResponseCache()
+	status = http.StatusInternalServerError
+	get(nil)
+	get(nil)
+	if calls != 5 {
+		t.Fatalf("errors must not be cached, calls = %d", calls)
+	}
+}
+
+func TestCachedResponseKeysAndDisable(t *testing.T) {
+	invalidateResponseCache()
+	t.Cleanup(invalidateResponseCache)
+	setCurrentConfigForTest(t, Config{})
+
+	calls := 0
+	handler := CachedResponse(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte(strconv.Itoa(calls)))
+	})
+	serve := func(target, locale string) {
+		w := httptest.NewRecorder()
+		w.Header().Set("Content-Language", locale)
+		handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+	}
+	serve("/api/system/status", LocaleRU)
+	serve("/api/system/status", "en")
+	serve("/api/system/status?x=1", LocaleRU)
+	serve("/api/system/status", LocaleRU)
+	if calls != 3 {
+		t.Fatalf("calls = %d, want one per path, query and language", calls)
+	}
+
+	setCurrentConfigForTest(t, Config{StatusCache: StatusCacheConfig{TTL: -1}})
+	serve("/api/system/status", LocaleRU)
+	if calls != 4 {
+		t.Fatalf("a negative ttl must disable the cache, calls = %d", calls)
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncSourceS3 is the sync.source value of an S3-compatible bucket.
+const SyncSourceS3 = "s3"
+
+// S3SourceConfig describes the bucket read by the S3 sync source. Every
+// object under Prefix becomes a manifest item named by the rest of its key.
+type S3SourceConfig struct {
+	// Endpoint is the base URL of the service, e.g. a MinIO server. The
+	// AWS endpoint of Region is used when it is empty.
+	Endpoint  string `yaml:"endpoint,omitempty"`
+	Region    string `yaml:"region,omitempty"`
+	Bucket    string `yaml:"bucket,omitempty"`
+	Prefix    string `yaml:"prefix,omitempty"`
+	AccessKey string `yaml:"access_key,omitempty"`
+	SecretKey string `yaml:"secret_key,omitempty"`
+	// PathStyle addresses the bucket as {endpoint}/{bucket} instead of
+	// {bucket}.{endpoint host}; MinIO usually needs it.
+	PathStyle bool `yaml:"path_style,omitempty"`
+}
+
+// DefaultS3Region is used when sync.s3.region is not set.
+const DefaultS3Region = "us-east-1"
+
+// s3SHA256MetaHeader carries the hex SHA256 of an object as user metadata.
+// The native x-amz-checksum-sha256 is used when it is missing.
+const s3SHA256MetaHeader = "X-Amz-Meta-Sha256"
+
+// s3EmptyPayloadHash is the SHA256 of an empty request body.
+const s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+var (
+	// s3ChecksumCache remembers object digests by source, key and ETag
+	// from the last listing, so objects are only inspected with HEAD when
+	// they change.
+	s3ChecksumCache     = map[string]string{}
+	s3ChecksumCacheLock sync.Mutex
+
+	// s3Now returns the signing time. Tests may override it.
+	s3Now = time.Now
+)
+
+// s3SyncSource derives the manifest from a bucket listing.
+type s3SyncSource struct {
+	config S3SourceConfig
+	base   *url.URL
+}
+
+func newS3SyncSource(config S3SourceConfig) (*s3SyncSource, error) {
+	if strings.TrimSpace(config.Bucket) == "" {
+		return nil, errors.New("sync.s3.bucket is required")
+	}
+	if (config.AccessKey == "") != (config.SecretKey == "") {
+		return nil, errors.New("sync.s3.access_key and sync.s3.secret_key must be set together")
+	}
+	if config.Region == "" {
+		config.Region = DefaultS3Region
+	}
+	endpoint := strings.TrimSpace(config.Endpoint)
+	if endpoint == "" {
+		endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	base, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid sync.s3.endpoint %q", config.Endpoint)
+	}
+	if config.PathStyle {
+		base.Path += "/" + config.Bucket
+	} else {
+		base.Host = config.Bucket + "." + base.Host
+	}
+	return &s3SyncSource{config: config, base: base}, nil
+}
+
+func (s *s3SyncSource) Key() string {
+	return "s3:" + s.base.String() + "/" + s.config.Prefix
+}
+
+// s3Object is one entry of a ListObjectsV2 response.
+type s3Object struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+	ETag string `xml:"ETag"`
+}
+
+type s3ListResult struct {
+	Contents              []s3Object `xml:"Contents"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+}
+
+// Manifest lists the prefix and reports errManifestNotModified when keys,
+// sizes and ETags are unchanged since previous.
+func (s *s3SyncSource) Manifest(ctx context.Context, previous manifestValidators, apply func([]ManifestItem) error) (manifestValidators, error) {
+	objects, err := s.listObjects(ctx)
+	if err != nil {
+		return manifestValidators{}, err
+	}
+
+	// S3 lists keys in order; sort anyway so the listing digest is stable.
+	slices.SortFunc(objects, func(a, b s3Object) int { return strings.Compare(a.Key, b.Key) })
+	listing := sha256.New()
+	for _, object := range objects {
+		_, _ = fmt.Fprintf(listing, "%s\x00%d\x00%s\n", object.Key, object.Size, object.ETag)
+	}
+	validators := manifestValidators{ETag: `"s3-` + hex.EncodeToString(listing.Sum(nil)) + `"`}
+	if previous.ETag == validators.ETag {
+		return previous, errManifestNotModified
+	}
+
+	s3ChecksumCacheLock.Lock()
+	known := s3ChecksumCache
+	s3ChecksumCacheLock.Unlock()
+	checksums := make(map[string]string, len(objects))
+
+	items := make([]ManifestItem, 0, len(objects))
+	for _, object := range objects {
+		filename := strings.TrimPrefix(object.Key, s.config.Prefix)
+		if filename == "" || strings.HasSuffix(filename, "/") {
+			continue
+		}
+		cacheKey := s.Key() + "\x00" + object.Key + "\x00" + object.ETag
+		digest, ok := known[cacheKey]
+		if !ok {
+			if digest, err = s.objectSHA256(ctx, object.Key); err != nil {
+				return manifestValidators{}, err
+			}
+		}
+		checksums[cacheKey] = digest
+		if digest == "" {
+			log.Printf("Warning: S3 object %s has no SHA256 checksum, skipping", object.Key)
+			continue
+		}
+		items = append(items, ManifestItem{
+			ID:            s3ObjectID(object.Key),
+			Filename:      filename,
+			FileSizeBytes: object.Size,
+			SHA256:        digest,
+		})
+	}
+
+	// Keep only digests of objects still listed.
+	s3ChecksumCacheLock.Lock()
+	s3ChecksumCache = checksums
+	s3ChecksumCacheLock.Unlock()
+
+	log.Printf("S3 manifest listed: %d objects, %d items", len(objects), len(items))
+	return validators, apply(items)
+}
+
+// Fetch downloads the object of item and verifies it like a core download.
+func (s *s3SyncSource) Fetch(ctx context.Context, item ManifestItem, destPath string) error {
+	resp, err := s.do(ctx, http.MethodGet, s.config.Prefix+item.Filename, nil, downloadTimeout())
+	if err != nil {
+		return fmt.Errorf("failed to download object: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return s3StatusError(resp)
+	}
+	return writeVerifiedContent(resp.Body, item, destPath)
+}
+
+func (s *s3SyncSource) listObjects(ctx context.Context) ([]s3Object, error) {
+	var objects []s3Object
+	token := ""
+	for page := 0; page < maxManifestPages; page++ {
+		query := url.Values{"list-type": {"2"}}
+		if s.config.Prefix != "" {
+			query.Set("prefix", s.config.Prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "", query, manifestTimeout())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list bucket: %w", err)
+		}
+		var result s3ListResult
+		if resp.StatusCode != http.StatusOK {
+			err = s3StatusError(resp)
+		} else if decodeErr := xml.NewDecoder(resp.Body).Decode(&result); decodeErr != nil {
+			err = fmt.Errorf("failed to decode bucket listing: %w", decodeErr)
+		}
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+	return nil, fmt.Errorf("bucket listing exceeds %d pages", maxManifestPages)
+}
+
+// objectSHA256 reads the checksum of key with HEAD. It returns "" when
+// the object carries no usable checksum.
+func (s *s3SyncSource) objectSHA256(ctx context.Context, key string) (string, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, manifestTimeout())
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect %s: %w", key, err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to inspect %s: unexpected status code %d", key, resp.StatusCode)
+	}
+	return s3DigestFromHeaders(resp.Header), nil
+}
+
+// s3DigestFromHeaders reads the SHA256 from x-amz-meta-sha256 (hex) or a
+// full-object x-amz-checksum-sha256 (base64). Checksums of multipart
+// uploads cover the parts, not the object, and are ignored.
+func s3DigestFromHeaders(header http.Header) string {
+	if value := strings.ToLower(strings.TrimSpace(header.Get(s3SHA256MetaHeader))); len(value) == sha256.Size*2 {
+		if _, err := hex.DecodeString(value); err == nil {
+			return value
+		}
+	}
+	if value := header.Get("X-Amz-Checksum-Sha256"); value != "" && !strings.Contains(value, "-") {
+		if sum, err := base64.StdEncoding.DecodeString(value); err == nil && len(sum) == sha256.Size {
+			return hex.EncodeToString(sum)
+		}
+	}
+	return ""
+}
+
+// s3ObjectID derives a stable positive manifest ID from an object key.
+func s3ObjectID(key string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return int64(h.Sum64() >> 1)
+}
+
+// do sends a signed request for key, or for the bucket when key is empty.
+func (s *s3SyncSource) do(ctx context.Context, method, key string, query url.Values, timeout time.Duration) (*http.Response, error) {
+	target := *s.base
+	if key != "" {
+		target.Path += "/" + key
+	} else if target.Path == "" {
+		target.Path = "/"
+	}
+	target.RawPath = s3EscapePath(target.Path)
+	target.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if method == http.MethodHead {
+		req.Header.Set("X-Amz-Checksum-Mode", "ENABLED")
+	}
+	signS3Request(req, s.config, s3Now())
+	return getCoreClient().Do(ctx, req, timeout)
+}
+
+func s3StatusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+}
+
+// signS3Request adds AWS Signature Version 4 headers to req. Requests
+// without credentials stay anonymous, for public buckets.
+func signS3Request(req *http.Request, config S3SourceConfig, now time.Time) {
+	req.Header.Set("X-Amz-Content-Sha256", s3EmptyPayloadHash)
+	if config.AccessKey == "" {
+		return
+	}
+	region := config.Region
+	if region == "" {
+		region = DefaultS3Region
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" || name == "content-type" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := slices.Sorted(maps.Keys(headers))
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + config.SecretKey)
+	for _, part := range []string{day, region, "s3", "aws4_request"} {
+		key = s3HMAC(key, part)
+	}
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+config.AccessKey+"/"+scope+
+		",SignedHeaders="+signedHeaders+",Signature="+signature)
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath percent-encodes every path segment as SigV4 requires.
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3CanonicalQuery encodes query sorted by key with SigV4 escaping.
+func s3CanonicalQuery(query url.Values) string {
+	var parts []string
+	for _, key := range slices.Sorted(maps.Keys(query)) {
+		for _, value := range query[key] {
+			parts = append(parts, s3Escape(key)+"="+s3Escape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything except RFC 3986 unreserved characters.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
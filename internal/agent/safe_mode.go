@@ -0,0 +1,272 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SafeModeConfig controls the safe mode the agent falls back to when it
+// keeps failing during startup.
+type SafeModeConfig struct {
+	// Disabled turns startup failure tracking off.
+	Disabled bool `yaml:"disabled,omitempty"`
+	// MaxStartupFailures is how many startups in a row may end before
+	// StableAfter until the next one starts in safe mode.
+	MaxStartupFailures int `yaml:"max_startup_failures,omitempty"`
+	// StableAfter is how long the agent must run for a startup to count
+	// as successful.
+	StableAfter time.Duration `yaml:"stable_after,omitempty"`
+}
+
+// Defaults for safe mode.
+const (
+	DefaultSafeModeMaxStartupFailures = 5
+	DefaultSafeModeStableAfter        = 2 * time.Minute
+)
+
+const metricSafeMode = "media_pi_safe_mode"
+
+func init() {
+	registerGauge(metricSafeMode, "1 while the agent runs in safe mode.")
+}
+
+// safeModePaths lists the routes served in safe mode: health, system,
+// configuration and diagnostics endpoints, enough to repair the device
+// remotely.
+var safeModePaths = []string{
+	"/health",
+	"/debug/",
+	"/internal/reload",
+	"/api/system/",
+	"/api/menu/configuration/",
+	"/api/configuration/",
+}
+
+var (
+	// startupStateFilePath persists the count of failed startups.
+	startupStateFilePath = filepath.Join(agentStateDir, "startup.json")
+
+	// safeModeExit ends the process so systemd restarts the agent in normal
+	// mode. Tests may override it.
+	safeModeExit = func() {
+		EndCrashCapture()
+		os.Exit(0)
+	}
+
+	safeMode      atomic.Bool
+	startupLock   sync.Mutex
+	startupState  startupFailures
+	startupStable *time.Timer
+	// startupCounted is set while this startup counts as failed.
+	startupCounted bool
+)
+
+// startupFailures is the persisted startup state. Failures counts the
+// startups in a row that did not run for stable_after.
+type startupFailures struct {
+	Failures int `json:"failures"`
+}
+
+// SafeModeStatus is returned by /api/system/safe-mode.
+type SafeModeStatus struct {
+	Active             bool `json:"active"`
+	StartupFailures    int  `json:"startupFailures"`
+	MaxStartupFailures int  `json:"maxStartupFailures"`
+}
+
+func safeModeMaxStartupFailures(config SafeModeConfig) int {
+	if config.MaxStartupFailures > 0 {
+		return config.MaxStartupFailures
+	}
+	return DefaultSafeModeMaxStartupFailures
+}
+
+func safeModeStableAfter(config SafeModeConfig) time.Duration {
+	if config.StableAfter > 0 {
+		return config.StableAfter
+	}
+	return DefaultSafeModeStableAfter
+}
+
+// IsSafeMode reports whether the agent runs in safe mode.
+func IsSafeMode() bool {
+	return safeMode.Load()
+}
+
+// BeginStartup records a startup and reports whether the agent must run in
+// safe mode because the previous safe_mode.max_startup_failures startups
+// failed. In normal mode the startup counts as failed until the agent has
+// run for safe_mode.stable_after; see StartStartupWatch.
+func BeginStartup() bool {
+	config := GetCurrentConfig().SafeMode
+	if config.Disabled {
+		return false
+	}
+
+	startupLock.Lock()
+	defer startupLock.Unlock()
+
+	var state startupFailures
+	if err := readStateFile(startupStateFilePath, &state); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Warning: ignoring startup state: %v", err)
+	}
+	startupState = state
+
+	if state.Failures >= safeModeMaxStartupFailures(config) {
+		log.Printf("Starting in safe mode after %d failed startups", state.Failures)
+		safeMode.Store(true)
+		metricSet(metricSafeMode, 1)
+		return true
+	}
+
+	state.Failures++
+	if err := writeStateFile(startupStateFilePath, state); err != nil {
+		log.Printf("Warning: failed to persist startup state: %v", err)
+	}
+	startupState = state
+	startupCounted = true
+	return false
+}
+
+// EndStartup is called when the agent is stopped on purpose (SIGTERM,
+// SIGINT). A restart or reboot before safe_mode.stable_after is not a
+// failed startup, so the count BeginStartup added is taken back.
+func EndStartup() {
+	startupLock.Lock()
+	defer startupLock.Unlock()
+	if startupStable != nil {
+		startupStable.Stop()
+	}
+	if !startupCounted {
+		return
+	}
+	state := startupFailures{Failures: max(startupState.Failures-1, 0)}
+	if err := writeStateFile(startupStateFilePath, state); err != nil {
+		log.Printf("Warning: failed to persist startup state: %v", err)
+		return
+	}
+	startupState = state
+	startupCounted = false
+}
+
+// StartStartupWatch resets the failed startup count once the agent has run
+// for safe_mode.stable_after. It does nothing in safe mode, which lasts
+// until it is left through the API.
+func StartStartupWatch() {
+	config := GetCurrentConfig().SafeMode
+	if config.Disabled || IsSafeMode() {
+		return
+	}
+	startupLock.Lock()
+	defer startupLock.Unlock()
+	if startupStable != nil {
+		startupStable.Stop()
+	}
+	startupStable = time.AfterFunc(safeModeStableAfter(config), func() {
+		if err := resetStartupFailures(); err != nil {
+			log.Printf("Warning: failed to reset startup state: %v", err)
+		}
+	})
+}
+
+func resetStartupFailures() error {
+	startupLock.Lock()
+	defer startupLock.Unlock()
+	if err := writeStateFile(startupStateFilePath, startupFailures{}); err != nil {
+		return err
+	}
+	startupState = startupFailures{}
+	startupCounted = false
+	return nil
+}
+
+func getSafeModeStatus() SafeModeStatus {
+	startupLock.Lock()
+	defer startupLock.Unlock()
+	return SafeModeStatus{
+		Active:             IsSafeMode(),
+		StartupFailures:    startupState.Failures,
+		MaxStartupFailures: safeModeMaxStartupFailures(GetCurrentConfig().SafeMode),
+	}
+}
+
+// isSafeModePath reports whether path is served in safe mode. /api/v2
+// routes are matched as their v1 counterparts.
+func isSafeModePath(path string) bool {
+	if rest, ok := strings.CutPrefix(path, "/api/v2/"); ok {
+		path = "/api/" + rest
+	}
+	for _, allowed := range safeModePaths {
+		if strings.HasSuffix(allowed, "/") {
+			if strings.HasPrefix(path, allowed) {
+				return true
+			}
+		} else if path == allowed || strings.HasPrefix(path, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// SafeModeMiddleware answers 503 to every route not served in safe mode.
+func SafeModeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if IsSafeMode() && !isSafeModePath(r.URL.Path) {
+			JSONResponse(w, http.StatusServiceUnavailable, APIResponse{OK: false, ErrMsg: "Агент работает в безопасном режиме"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func checkSafeMode() HealthCheck {
+	if IsSafeMode() {
+		return HealthCheck{Name: "safe_mode", OK: false, Detail: "agent runs in safe mode after repeated startup failures"}
+	}
+	return HealthCheck{Name: "safe_mode", OK: true}
+}
+
+// HandleSafeMode returns the safe mode status.
+func HandleSafeMode(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getSafeModeStatus()})
+}
+
+// HandleSafeModeExit clears the failed startup count and restarts the agent
+// so it starts in normal mode.
+func HandleSafeModeExit(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	if !IsSafeMode() {
+		JSONResponse(w, http.StatusConflict, APIResponse{OK: false, ErrMsg: "Агент не в безопасном режиме"})
+		return
+	}
+	if err := resetStartupFailures(); err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось выйти из безопасного режима: %v", err)})
+		return
+	}
+	log.Println("Leaving safe mode on request, restarting")
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: MenuActionResponse{Action: "safe-mode-exit", Result: "success", Message: "Агент перезапускается в обычном режиме"}})
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	exit := safeModeExit
+	go func() {
+		time.Sleep(time.Second)
+		exit()
+	}()
+}
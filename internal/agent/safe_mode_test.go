@@ -0,0 +1,129 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupSafeModeTest(t *testing.T, config SafeModeConfig) {
+	t.Helper()
+	originalPath, originalExit := startupStateFilePath, safeModeExit
+	startupStateFilePath = filepath.Join(t.TempDir(), "startup.json")
+	safeModeExit = func() {}
+	t.Cleanup(func() {
+		startupStateFilePath, safeModeExit = originalPath, originalExit
+		safeMode.Store(false)
+		startupLock.Lock()
+		startupState = startupFailures{}
+		startupCounted = false
+		if startupStable != nil {
+			startupStable.Stop()
+			startupStable = nil
+		}
+		startupLock.Unlock()
+	})
+	setCurrentConfigForTest(t, Config{ServerKey: "key", SafeMode: config})
+}
+
+func TestBeginStartupEntersSafeModeAfterFailures(t *testing.T) {
+	setupSafeModeTest(t, SafeModeConfig{MaxStartupFailures: 2})
+
+	for i := 1; i <= 2; i++ {
+		if BeginStartup() {
+			t.Fatalf("startup %d must run in normal mode", i)
+		}
+		if status := getSafeModeStatus(); status.StartupFailures != i {
+			t.Fatalf("startup %d: failures = %d", i, status.StartupFailures)
+		}
+	}
+	if !BeginStartup() || !IsSafeMode() {
+		t.Fatal("third startup must run in safe mode")
+	}
+
+	w := httptest.NewRecorder()
+	HandleSafeModeExit(w, httptest.NewRequest(http.MethodPost, "/api/system/safe-mode/exit", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("exit status = %d: %s", w.Code, w.Body.String())
+	}
+	var state startupFailures
+	if err := readStateFile(startupStateFilePath, &state); err != nil || state.Failures != 0 {
+		t.Fatalf("startup state = %+v, %v", state, err)
+	}
+}
+
+func TestStartStartupWatchResetsFailures(t *testing.T) {
+	setupSafeModeTest(t, SafeModeConfig{StableAfter: 10 * time.Millisecond})
+
+	BeginStartup()
+	StartStartupWatch()
+	deadline := time.Now().Add(time.Second)
+	for getSafeModeStatus().StartupFailures != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("failures were not reset")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEndStartupUndoesFailureOnShutdown(t *testing.T) {
+	setupSafeModeTest(t, SafeModeConfig{MaxStartupFailures: 2})
+
+	// Crash, then restarts and reboots: only the crash counts.
+	BeginStartup()
+	for i := 0; i < 5; i++ {
+		if BeginStartup() {
+			t.Fatalf("restart %d must not enter safe mode", i)
+		}
+		StartStartupWatch()
+		EndStartup()
+	}
+	var state startupFailures
+	if err := readStateFile(startupStateFilePath, &state); err != nil || state.Failures != 1 {
+		t.Fatalf("startup state = %+v, %v", state, err)
+	}
+	// A second shutdown of the same run changes nothing.
+	EndStartup()
+	if status := getSafeModeStatus(); status.StartupFailures != 1 {
+		t.Fatalf("failures = %d", status.StartupFailures)
+	}
+}
+
+func TestSafeModeMiddleware(t *testing.T) {
+	setupSafeModeTest(t, SafeModeConfig{})
+	handler := SafeModeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	if code := serve("/api/units"); code != http.StatusNoContent {
+		t.Fatalf("normal mode status = %d", code)
+	}
+
+	safeMode.Store(true)
+	for path, want := range map[string]int{
+		"/health":                         http.StatusNoContent,
+		"/health/ready":                   http.StatusNoContent,
+		"/api/system/status":              http.StatusNoContent,
+		"/api/v2/system/safe-mode":        http.StatusNoContent,
+		"/api/menu/configuration/get":     http.StatusNoContent,
+		"/api/configuration/effective":    http.StatusNoContent,
+		"/api/units":                      http.StatusServiceUnavailable,
+		"/api/menu/playback/start":        http.StatusServiceUnavailable,
+		"/healthz":                        http.StatusServiceUnavailable,
+		"/api/v2/menu/video/start-upload": http.StatusServiceUnavailable,
+	} {
+		if code := serve(path); code != want {
+			t.Errorf("%s: status = %d, want %d", path, code, want)
+		}
+	}
+}
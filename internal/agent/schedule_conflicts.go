@@ -0,0 +1,151 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of schedule conflicts.
+const (
+	// A scheduled playlist sync restarts playback, which turns the screen
+	// back on inside a rest interval.
+	scheduleConflictPlaylistInRest = "playlist-in-rest"
+	// A video sync inside a rest interval does not run on devices whose
+	// power is cut for the rest.
+	scheduleConflictVideoInRest = "video-in-rest"
+	// A reboot shortly after a sync may interrupt the download.
+	scheduleConflictRebootDuringSync = "reboot-during-sync"
+	// A reboot outside rest intervals interrupts playback.
+	scheduleConflictRebootDuringPlayback = "reboot-during-playback"
+)
+
+// Severities of schedule conflicts.
+const (
+	scheduleConflictWarning = "warning"
+	scheduleConflictInfo    = "info"
+)
+
+// rebootSyncGuard is how long after a sync starts a reboot is considered to
+// interrupt it.
+const rebootSyncGuard = 30 * time.Minute
+
+// ScheduleConflict is a combination of schedules that work against each
+// other. Conflicts are reported, not rejected: some are intended, e.g. a
+// nightly video sync on a device that stays powered during rest.
+type ScheduleConflict struct {
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// minuteOfDay parses HH:MM into minutes since midnight.
+func minuteOfDay(value string) (int, bool) {
+	hour, minute, err := parseTimeValue(strings.TrimSpace(value))
+	if err != nil {
+		return 0, false
+	}
+	return hour*60 + minute, true
+}
+
+// restPairAt returns the rest interval containing minute, if any.
+func restPairAt(minute int, pairs []RestTimePairConfig) (RestTimePairConfig, bool) {
+	for _, pair := range pairs {
+		start, okStart := minuteOfDay(pair.Start)
+		stop, okStop := minuteOfDay(pair.Stop)
+		if !okStart || !okStop || start == stop {
+			continue
+		}
+		if start < stop && minute >= start && minute < stop || start > stop && (minute >= start || minute < stop) {
+			return pair, true
+		}
+	}
+	return RestTimePairConfig{}, false
+}
+
+// rebootMinutes returns the distinct times of day of the crontab reboots
+// during the week after now.
+func rebootMinutes(crontab string, now time.Time) []int {
+	seen := map[int]bool{}
+	for _, line := range splitCrontabLines(crontab) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		expr, command, err := splitCronLine(line)
+		if err != nil || !isRebootCommand(command) {
+			continue
+		}
+		schedule, err := cronParser.Parse(expr)
+		if err != nil {
+			continue
+		}
+		// Bounded, as an every-minute expression has 10080 runs a week.
+		end := now.AddDate(0, 0, 7)
+		for next, runs := schedule.Next(now), 0; !next.IsZero() && next.Before(end) && runs < 24*60; next, runs = schedule.Next(next), runs+1 {
+			seen[next.Hour()*60+next.Minute()] = true
+		}
+	}
+	minutes := make([]int, 0, len(seen))
+	for minute := range seen {
+		minutes = append(minutes, minute)
+	}
+	sort.Ints(minutes)
+	return minutes
+}
+
+func formatMinuteOfDay(minute int) string {
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+// scheduleConflicts checks sync times, rest intervals and the reboots of
+// crontab against each other.
+func scheduleConflicts(schedule ScheduleConfig, crontab string, now time.Time) []ScheduleConflict {
+	var conflicts []ScheduleConflict
+	for _, value := range schedule.Playlist {
+		minute, ok := minuteOfDay(value)
+		if !ok {
+			continue
+		}
+		if pair, ok := restPairAt(minute, schedule.Rest); ok {
+			conflicts = append(conflicts, ScheduleConflict{Kind: scheduleConflictPlaylistInRest, Severity: scheduleConflictWarning,
+				Message: fmt.Sprintf("Обновление плейлиста в %v попадает в нерабочее время %v: воспроизведение будет запущено до его окончания", formatMinuteOfDay(minute), pair.Start+"-"+pair.Stop)})
+		}
+	}
+	for _, value := range schedule.Video {
+		minute, ok := minuteOfDay(value)
+		if !ok {
+			continue
+		}
+		if pair, ok := restPairAt(minute, schedule.Rest); ok {
+			conflicts = append(conflicts, ScheduleConflict{Kind: scheduleConflictVideoInRest, Severity: scheduleConflictInfo,
+				Message: fmt.Sprintf("Синхронизация видео в %v попадает в нерабочее время %v: она не выполнится, если на это время отключается питание", formatMinuteOfDay(minute), pair.Start+"-"+pair.Stop)})
+		}
+	}
+
+	syncs := append(append([]string{}, schedule.Playlist...), schedule.Video...)
+	for _, reboot := range rebootMinutes(crontab, now) {
+		for _, value := range syncs {
+			start, ok := minuteOfDay(value)
+			if !ok {
+				continue
+			}
+			// Minutes from the sync start to the reboot, across midnight.
+			if delta := (reboot - start + 24*60) % (24 * 60); delta < int(rebootSyncGuard.Minutes()) {
+				conflicts = append(conflicts, ScheduleConflict{Kind: scheduleConflictRebootDuringSync, Severity: scheduleConflictWarning,
+					Message: fmt.Sprintf("Перезагрузка в %v может прервать синхронизацию, начатую в %v", formatMinuteOfDay(reboot), formatMinuteOfDay(start))})
+			}
+		}
+		if len(schedule.Rest) > 0 {
+			if _, ok := restPairAt(reboot, schedule.Rest); !ok {
+				conflicts = append(conflicts, ScheduleConflict{Kind: scheduleConflictRebootDuringPlayback, Severity: scheduleConflictWarning,
+					Message: fmt.Sprintf("Перезагрузка в %v прервёт воспроизведение: она не попадает в нерабочее время", formatMinuteOfDay(reboot))})
+			}
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,66 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleConflicts(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.Local)
+	schedule := ScheduleConfig{
+		Playlist: []string{"23:00", "09:00"},
+		Video:    []string{"02:45", "12:00"},
+		Rest:     []RestTimePairConfig{{Start: "22:30", Stop: "07:00"}},
+	}
+	crontab := "15 4 * * 1 /usr/bin/systemctl reboot\n0 3 * * * /sbin/shutdown -r now\n30 13 * * * reboot\n"
+
+	conflicts := scheduleConflicts(schedule, crontab, now)
+	var kinds []string
+	for _, conflict := range conflicts {
+		kinds = append(kinds, conflict.Kind+" "+conflict.Message)
+	}
+	got := strings.Join(kinds, "\n")
+	for _, want := range []string{
+		scheduleConflictPlaylistInRest + " Обновление плейлиста в 23:00 попадает в нерабочее время 22:30-07:00",
+		scheduleConflictVideoInRest + " Синхронизация видео в 02:45",
+		scheduleConflictRebootDuringSync + " Перезагрузка в 03:00 может прервать синхронизацию, начатую в 02:45",
+		scheduleConflictRebootDuringPlayback + " Перезагрузка в 13:30",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+	if len(conflicts) != 4 {
+		t.Errorf("expected 4 conflicts, got\n%s", got)
+	}
+	if strings.Contains(got, "04:15 прервёт") || strings.Contains(got, "09:00") {
+		t.Errorf("unexpected conflicts\n%s", got)
+	}
+
+	if conflicts := scheduleConflicts(ScheduleConfig{Video: []string{"23:50"}}, "10 0 * * * reboot\n", now); len(conflicts) != 1 || conflicts[0].Kind != scheduleConflictRebootDuringSync {
+		t.Errorf("expected a reboot after midnight to conflict with a sync before it, got %+v", conflicts)
+	}
+}
+
+func TestRebootMinutesBounded(t *testing.T) {
+	minutes := rebootMinutes("* * * * * reboot\n", time.Date(2026, 3, 2, 0, 0, 0, 0, time.Local))
+	if len(minutes) != 24*60 || !slices.IsSorted(minutes) {
+		t.Fatalf("expected every minute of the day once, got %d", len(minutes))
+	}
+}
+
+func TestLocalizeScheduleConflicts(t *testing.T) {
+	conflicts := []ScheduleConflict{{Kind: scheduleConflictRebootDuringPlayback, Message: "Перезагрузка в 13:30 прервёт воспроизведение: она не попадает в нерабочее время"}}
+	translated := translateConflicts(LocaleEN, conflicts)
+	if translated[0].Message != "Reboot at 13:30 interrupts playback: it is outside rest time" {
+		t.Fatalf("unexpected translation %q", translated[0].Message)
+	}
+	if conflicts[0].Message == translated[0].Message {
+		t.Fatal("the original conflicts must not change")
+	}
+}
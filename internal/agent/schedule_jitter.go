@@ -0,0 +1,74 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// DefaultScheduleJitter bounds the per-device offset of scheduled syncs
+// when sync.schedule_jitter is not set, so a fleet sharing one HH:MM
+// schedule does not hit the core in the same second.
+const DefaultScheduleJitter = 5 * time.Minute
+
+// scheduleJitter returns sync.schedule_jitter, DefaultScheduleJitter when
+// it is not set and 0 when it is negative.
+func scheduleJitter(config SyncConfig) time.Duration {
+	switch {
+	case config.ScheduleJitter == 0:
+		return DefaultScheduleJitter
+	case config.ScheduleJitter < 0:
+		return 0
+	}
+	return config.ScheduleJitter
+}
+
+// scheduleDeviceID identifies the device for the schedule offset: the
+// server key the core knows the device by, or the hardware serial when the
+// key is not set.
+func scheduleDeviceID(config Config) string {
+	if config.ServerKey != "" {
+		return config.ServerKey
+	}
+	serial, _ := readHardwareSerial()
+	return serial
+}
+
+// scheduleOffset returns the delay of this device's scheduled syncs: a
+// whole number of seconds below the jitter, derived from deviceID so it
+// stays the same across restarts.
+func scheduleOffset(config SyncConfig, deviceID string) time.Duration {
+	jitter := scheduleJitter(config)
+	if jitter < time.Second || deviceID == "" {
+		return 0
+	}
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(deviceID))
+	return time.Duration(hash.Sum64()%uint64(jitter/time.Second)) * time.Second
+}
+
+// offsetSchedule is an HH:MM schedule moved by a device offset. The cron
+// entry runs at the shifted minute and the job waits the remaining seconds.
+type offsetSchedule struct {
+	spec      string
+	delay     time.Duration
+	effective string
+}
+
+// shiftSchedule moves timeStr (HH:MM) by offset, wrapping past midnight.
+func shiftSchedule(timeStr string, offset time.Duration) (offsetSchedule, error) {
+	hour, minute, err := parseTimeValue(timeStr)
+	if err != nil {
+		return offsetSchedule{}, err
+	}
+	seconds := (hour*3600 + minute*60 + int(offset/time.Second)) % (24 * 3600)
+	hour, minute, second := seconds/3600, seconds/60%60, seconds%60
+	return offsetSchedule{
+		spec:      fmt.Sprintf("%d %d * * *", minute, hour),
+		delay:     time.Duration(second) * time.Second,
+		effective: fmt.Sprintf("%02d:%02d:%02d", hour, minute, second),
+	}, nil
+}
@@ -0,0 +1,58 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleOffset(t *testing.T) {
+	offset := scheduleOffset(SyncConfig{}, "device-a")
+	if offset < 0 || offset >= DefaultScheduleJitter || offset%time.Second != 0 {
+		t.Fatalf("default offset %s", offset)
+	}
+	if again := scheduleOffset(SyncConfig{}, "device-a"); again != offset {
+		t.Fatalf("the offset must be stable: %s, then %s", offset, again)
+	}
+	if got := scheduleOffset(SyncConfig{ScheduleJitter: time.Minute}, "device-a"); got >= time.Minute {
+		t.Fatalf("configured offset %s", got)
+	}
+	if got := scheduleOffset(SyncConfig{ScheduleJitter: -1}, "device-a"); got != 0 {
+		t.Fatalf("a negative jitter must disable the offset, got %s", got)
+	}
+	if got := scheduleOffset(SyncConfig{}, ""); got != 0 {
+		t.Fatalf("no device id, got %s", got)
+	}
+
+	distinct := map[time.Duration]bool{}
+	for _, id := range []string{"store-1", "store-2", "store-3", "store-4", "store-5"} {
+		distinct[scheduleOffset(SyncConfig{}, id)] = true
+	}
+	if len(distinct) < 2 {
+		t.Fatalf("devices must be spread, got %v", distinct)
+	}
+}
+
+func TestShiftSchedule(t *testing.T) {
+	for _, tc := range []struct {
+		time      string
+		offset    time.Duration
+		spec      string
+		delay     time.Duration
+		effective string
+	}{
+		{"03:00", 0, "0 3 * * *", 0, "03:00:00"},
+		{"03:00", 137 * time.Second, "2 3 * * *", 17 * time.Second, "03:02:17"},
+		{"23:58", 4 * time.Minute, "2 0 * * *", 0, "00:02:00"},
+	} {
+		got, err := shiftSchedule(tc.time, tc.offset)
+		if err != nil || got.spec != tc.spec || got.delay != tc.delay || got.effective != tc.effective {
+			t.Errorf("%s + %s = %+v, %v", tc.time, tc.offset, got, err)
+		}
+	}
+	if _, err := shiftSchedule("3", time.Minute); err == nil {
+		t.Error("expected an error for an invalid time")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of schedule entries read from the crontab of the service user.
+const (
+	scheduleKindRestStart = "rest-start"
+	scheduleKindRestStop  = "rest-stop"
+	scheduleKindReboot    = "reboot"
+)
+
+// ScheduleNextResponse is returned by GET /api/menu/schedule/next. The
+// summary fields hold the earliest next run of each kind. While Paused the
+// scheduled playlist and video syncs are skipped. Conflicts lists schedules
+// that work against each other.
+type ScheduleNextResponse struct {
+	Now       time.Time          `json:"now"`
+	Paused    bool               `json:"paused"`
+	Playlist  *time.Time         `json:"playlist,omitempty"`
+	Video     *time.Time         `json:"video,omitempty"`
+	RestStart *time.Time         `json:"restStart,omitempty"`
+	RestStop  *time.Time         `json:"restStop,omitempty"`
+	Reboot    *time.Time         `json:"reboot,omitempty"`
+	Jobs      []ScheduledJob     `json:"jobs"`
+	Conflicts []ScheduleConflict `json:"conflicts,omitempty"`
+}
+
+// isRebootCommand reports whether a crontab command reboots the device.
+func isRebootCommand(command string) bool {
+	fields := strings.Fields(command)
+	for i, field := range fields {
+		switch {
+		case field == "reboot" || strings.HasSuffix(field, "/reboot"):
+			return true
+		case field == "shutdown" || strings.HasSuffix(field, "/shutdown"):
+			for _, arg := range fields[i+1:] {
+				if arg == "-r" || arg == "--reboot" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// crontabSchedules lists the rest and reboot entries of crontab content
+// with their next run after now.
+func crontabSchedules(content string, now time.Time) []ScheduledJob {
+	var jobs []ScheduledJob
+	for _, pair := range parseRestTimes(content) {
+		for _, entry := range []struct{ kind, time string }{
+			{scheduleKindRestStart, pair.Start},
+			{scheduleKindRestStop, pair.Stop},
+		} {
+			hour, minute, err := parseTimeValue(entry.time)
+			if err != nil {
+				continue
+			}
+			schedule, err := cronParser.Parse(fmt.Sprintf("%d %d * * *", minute, hour))
+			if err != nil {
+				continue
+			}
+			next := schedule.Next(now)
+			jobs = append(jobs, ScheduledJob{Kind: entry.kind, Time: entry.time, Next: &next})
+		}
+	}
+	for _, line := range splitCrontabLines(content) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		expr, command, err := splitCronLine(line)
+		if err != nil || !isRebootCommand(command) {
+			continue
+		}
+		schedule, err := cronParser.Parse(expr)
+		if err != nil {
+			continue
+		}
+		next := schedule.Next(now)
+		jobs = append(jobs, ScheduledJob{Kind: scheduleKindReboot, Time: expr, Next: &next})
+	}
+	return jobs
+}
+
+// nextSchedules combines the entries of the running sync scheduler with
+// the crontab, earliest first.
+func nextSchedules(crontab string, now time.Time) ScheduleNextResponse {
+	jobs := append(loadedSchedules(), crontabSchedules(crontab, now)...)
+	sort.SliceStable(jobs, func(i, j int) bool {
+		a, b := jobs[i].Next, jobs[j].Next
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return a.Before(*b)
+	})
+
+	resp := ScheduleNextResponse{Now: now, Paused: IsSyncSchedulerPaused(), Jobs: jobs,
+		Conflicts: scheduleConflicts(GetCurrentConfig().Schedule, crontab, now)}
+	for i := range jobs {
+		var summary **time.Time
+		switch jobs[i].Kind {
+		case "playlist":
+			summary = &resp.Playlist
+		case "video":
+			summary = &resp.Video
+		case scheduleKindRestStart:
+			summary = &resp.RestStart
+		case scheduleKindRestStop:
+			summary = &resp.RestStop
+		case scheduleKindReboot:
+			summary = &resp.Reboot
+		default:
+			continue
+		}
+		if *summary == nil && jobs[i].Next != nil {
+			*summary = jobs[i].Next
+		}
+	}
+	return resp
+}
+
+// HandleScheduleNext reports when scheduled syncs, rest periods and reboots
+// run next, so operators can check a schedule before it fires.
+func HandleScheduleNext(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	crontab, err := CrontabReadFunc()
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось прочитать crontab: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: nextSchedules(crontab, playbackTimeNow())})
+}
@@ -0,0 +1,118 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const scheduleNextCrontab = `# MEDIA_PI_REST STOP
+30 22 * * * sudo systemctl stop play.video.service
+# MEDIA_PI_REST START
+0 7 * * * sudo systemctl start play.video.service
+15 4 * * 1 /usr/bin/systemctl reboot
+0 3 * * * /sbin/shutdown -r now
+0 5 * * * /sbin/shutdown -h now
+@reboot /usr/local/bin/setup.sh
+`
+
+func TestIsRebootCommand(t *testing.T) {
+	for command, want := range map[string]bool{
+		"/sbin/reboot":               true,
+		"sudo systemctl reboot":      true,
+		"shutdown -r +1":             true,
+		"/sbin/shutdown --reboot":    true,
+		"/sbin/shutdown -h now":      false,
+		"/usr/local/bin/reboot-note": false,
+	} {
+		if got := isRebootCommand(command); got != want {
+			t.Errorf("isRebootCommand(%q) = %v, want %v", command, got, want)
+		}
+	}
+}
+
+func TestCrontabSchedules(t *testing.T) {
+	// Monday 2026-03-02 23:00
+	now := time.Date(2026, 3, 2, 23, 0, 0, 0, time.Local)
+	jobs := crontabSchedules(scheduleNextCrontab, now)
+	want := []struct {
+		kind string
+		next time.Time
+	}{
+		{scheduleKindRestStart, time.Date(2026, 3, 3, 22, 30, 0, 0, time.Local)},
+		{scheduleKindRestStop, time.Date(2026, 3, 3, 7, 0, 0, 0, time.Local)},
+		{scheduleKindReboot, time.Date(2026, 3, 9, 4, 15, 0, 0, time.Local)},
+		{scheduleKindReboot, time.Date(2026, 3, 3, 3, 0, 0, 0, time.Local)},
+	}
+	if len(jobs) != len(want) {
+		t.Fatalf("crontabSchedules = %+v", jobs)
+	}
+	for i, w := range want {
+		if jobs[i].Kind != w.kind || jobs[i].Next == nil || !jobs[i].Next.Equal(w.next) {
+			t.Errorf("job %d = %s %v, want %s %v", i, jobs[i].Kind, jobs[i].Next, w.kind, w.next)
+		}
+	}
+}
+
+func TestHandleScheduleNext(t *testing.T) {
+	cronSchedulerLock.Lock()
+	originalScheduler, originalJobs := cronScheduler, cronJobs
+	cronScheduler = cron.New()
+	playlistID, _ := cronScheduler.AddFunc("0 6 * * *", func() {})
+	videoID, _ := cronScheduler.AddFunc("30 1 * * *", func() {})
+	cronScheduler.Start()
+	cronJobs = []cronJob{{kind: "playlist", time: "06:00", id: playlistID}, {kind: "video", time: "01:30", id: videoID}}
+	cronSchedulerLock.Unlock()
+	originalRead, originalNow := CrontabReadFunc, playbackTimeNow
+	CrontabReadFunc = func() (string, error) { return scheduleNextCrontab, nil }
+	playbackTimeNow = func() time.Time { return time.Date(2026, 3, 2, 23, 0, 0, 0, time.Local) }
+	t.Cleanup(func() {
+		cronSchedulerLock.Lock()
+		cronScheduler.Stop()
+		cronScheduler, cronJobs = originalScheduler, originalJobs
+		cronSchedulerLock.Unlock()
+		CrontabReadFunc, playbackTimeNow = originalRead, originalNow
+	})
+
+	w := httptest.NewRecorder()
+	HandleScheduleNext(w, httptest.NewRequest(http.MethodGet, "/api/menu/schedule/next", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data ScheduleNextResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	got := resp.Data
+	if got.Playlist == nil || got.Video == nil || got.RestStart == nil || got.RestStop == nil || got.Reboot == nil {
+		t.Fatalf("expected every summary to be set: %+v", got)
+	}
+	if want := time.Date(2026, 3, 3, 3, 0, 0, 0, time.Local); !got.Reboot.Equal(want) {
+		t.Errorf("reboot = %v, want the earliest reboot %v", got.Reboot, want)
+	}
+	if len(got.Jobs) != 6 {
+		t.Fatalf("jobs = %+v", got.Jobs)
+	}
+	for i := 1; i < len(got.Jobs); i++ {
+		if got.Jobs[i].Next.Before(*got.Jobs[i-1].Next) {
+			t.Fatalf("jobs are not sorted by next run: %+v", got.Jobs)
+		}
+	}
+
+	CrontabReadFunc = func() (string, error) { return "", errors.New("denied") }
+	w = httptest.NewRecorder()
+	HandleScheduleNext(w, httptest.NewRequest(http.MethodGet, "/api/menu/schedule/next", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500 when the crontab cannot be read, got %d", w.Code)
+	}
+}
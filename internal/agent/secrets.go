@@ -0,0 +1,195 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// sealedSecretPrefix marks a secret encrypted with the device key in
+// agent.yaml.
+const sealedSecretPrefix = "enc:v1:"
+
+var (
+	// DeviceTreeSerialPath, CPUInfoPath and ProductUUIDPath are tried in
+	// order for a hardware serial. The Raspberry Pi serial lives in SoC OTP
+	// memory, so it does not travel with the SD card. Tests may override
+	// them.
+	DeviceTreeSerialPath = "/sys/firmware/devicetree/base/serial-number"
+	CPUInfoPath          = "/proc/cpuinfo"
+	ProductUUIDPath      = "/sys/class/dmi/id/product_uuid"
+
+	// MachineIDPath is mixed into the device key so cloned images on the
+	// same board model still get different keys.
+	MachineIDPath = "/etc/machine-id"
+)
+
+// readHardwareSerial returns the first hardware serial available.
+func readHardwareSerial() (string, error) {
+	if data, err := os.ReadFile(DeviceTreeSerialPath); err == nil {
+		if serial := strings.Trim(string(data), "\x00 \n"); serial != "" {
+			return serial, nil
+		}
+	}
+	if file, err := os.Open(CPUInfoPath); err == nil {
+		defer func() { _ = file.Close() }()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), ":")
+			if ok && strings.TrimSpace(key) == "Serial" {
+				if serial := strings.TrimSpace(value); strings.Trim(serial, "0") != "" {
+					return serial, nil
+				}
+			}
+		}
+	}
+	if data, err := os.ReadFile(ProductUUIDPath); err == nil {
+		if serial := strings.TrimSpace(string(data)); serial != "" {
+			return serial, nil
+		}
+	}
+	return "", errors.New("no hardware serial found")
+}
+
+// deviceSecretKey derives the AES-256 key that seals secrets at rest from
+// the hardware serial and the machine id.
+func deviceSecretKey() ([]byte, error) {
+	serial, err := readHardwareSerial()
+	if err != nil {
+		return nil, err
+	}
+	machineID, _ := os.ReadFile(MachineIDPath)
+	secret := serial + "\n" + strings.TrimSpace(string(machineID))
+	return hkdf.Key(sha256.New, []byte(secret), nil, "media-pi-agent secrets v1", 32)
+}
+
+func deviceSecretAEAD() (cipher.AEAD, error) {
+	key, err := deviceSecretKey()
+	if err != nil {
+		return nil, fmt.Errorf("derive device key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// isSealedSecret reports whether value was produced by sealSecret.
+func isSealedSecret(value string) bool {
+	return strings.HasPrefix(value, sealedSecretPrefix)
+}
+
+// sealSecret encrypts value with the device key.
+func sealSecret(value string) (string, error) {
+	aead, err := deviceSecretAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return sealedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openSecret decrypts a value produced by sealSecret. It fails on another
+// device, e.g. when the SD card was moved to a different board.
+func openSecret(value string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	aead, err := deviceSecretAEAD()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("cannot decrypt with this device's key")
+	}
+	return string(plain), nil
+}
+
+// configSecret is a secret field of Config named by its config key.
+type configSecret struct {
+	name  string
+	value *string
+}
+
+// configSecrets lists the secret fields of c that encrypt_secrets covers.
+func configSecrets(c *Config) []configSecret {
+	secrets := []configSecret{
+		{name: "server_key", value: &c.ServerKey},
+		{name: "sync.s3.secret_key", value: &c.Sync.S3.SecretKey},
+		{name: "config_bundle.private_key", value: &c.ConfigBundle.PrivateKey},
+		{name: "wireguard.private_key", value: &c.WireGuard.PrivateKey},
+	}
+	// Callers change secrets on copies of Config; the copies share the
+	// slice, so it is detached first.
+	c.Storage.Network = slices.Clone(c.Storage.Network)
+	for i := range c.Storage.Network {
+		secrets = append(secrets, configSecret{name: fmt.Sprintf("storage.network[%d].password", i), value: &c.Storage.Network[i].Password})
+	}
+	return secrets
+}
+
+// hasPlainSecrets reports whether c holds a secret that is not sealed.
+func hasPlainSecrets(c *Config) bool {
+	for _, secret := range configSecrets(c) {
+		if *secret.value != "" && !isSealedSecret(*secret.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// openConfigSecrets decrypts the sealed secrets of c in place.
+func openConfigSecrets(c *Config) error {
+	for _, secret := range configSecrets(c) {
+		if !isSealedSecret(*secret.value) {
+			continue
+		}
+		plain, err := openSecret(*secret.value)
+		if err != nil {
+			return fmt.Errorf("decrypt %s: %w", secret.name, err)
+		}
+		*secret.value = plain
+	}
+	return nil
+}
+
+// configForDisk returns the copy of c written to agent.yaml, with secrets
+// sealed when encrypt_secrets is set.
+func configForDisk(c Config) (Config, error) {
+	if !c.EncryptSecrets {
+		return c, nil
+	}
+	for _, secret := range configSecrets(&c) {
+		if *secret.value == "" || isSealedSecret(*secret.value) {
+			continue
+		}
+		sealed, err := sealSecret(*secret.value)
+		if err != nil {
+			return c, fmt.Errorf("encrypt %s: %w", secret.name, err)
+		}
+		*secret.value = sealed
+	}
+	return c, nil
+}
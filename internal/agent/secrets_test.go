@@ -0,0 +1,120 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setHardwareSerialForTest makes the device key derive from serial.
+func setHardwareSerialForTest(t *testing.T, serial string) {
+	t.Helper()
+	dir := t.TempDir()
+	originals := []string{DeviceTreeSerialPath, CPUInfoPath, ProductUUIDPath, MachineIDPath}
+	DeviceTreeSerialPath = filepath.Join(dir, "serial-number")
+	CPUInfoPath = filepath.Join(dir, "cpuinfo")
+	ProductUUIDPath = filepath.Join(dir, "product_uuid")
+	MachineIDPath = filepath.Join(dir, "machine-id")
+	t.Cleanup(func() {
+		DeviceTreeSerialPath, CPUInfoPath, ProductUUIDPath, MachineIDPath = originals[0], originals[1], originals[2], originals[3]
+	})
+	if err := os.WriteFile(CPUInfoPath, []byte("Hardware\t: BCM2835\nSerial\t\t: "+serial+"\nModel\t\t: Raspberry Pi 4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(MachineIDPath, []byte("0123456789abcdef\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSealAndOpenSecret(t *testing.T) {
+	setHardwareSerialForTest(t, "10000000abcdef01")
+
+	sealed, err := sealSecret("server-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSealedSecret(sealed) || strings.Contains(sealed, "server-key") {
+		t.Fatalf("unexpected sealed value %q", sealed)
+	}
+	if plain, err := openSecret(sealed); err != nil || plain != "server-key" {
+		t.Fatalf("openSecret = %q, %v", plain, err)
+	}
+
+	// The SD card moved to another board.
+	setHardwareSerialForTest(t, "10000000fedcba98")
+	if _, err := openSecret(sealed); err == nil {
+		t.Fatal("expected decryption to fail with another serial")
+	}
+}
+
+func TestReadHardwareSerialPrefersDeviceTree(t *testing.T) {
+	setHardwareSerialForTest(t, "10000000abcdef01")
+	if serial, err := readHardwareSerial(); err != nil || serial != "10000000abcdef01" {
+		t.Fatalf("serial from cpuinfo = %q, %v", serial, err)
+	}
+	if err := os.WriteFile(DeviceTreeSerialPath, []byte("100000002222\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if serial, _ := readHardwareSerial(); serial != "100000002222" {
+		t.Fatalf("serial from device tree = %q", serial)
+	}
+
+	_ = os.Remove(DeviceTreeSerialPath)
+	if err := os.WriteFile(CPUInfoPath, []byte("Serial\t: 0000000000000000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readHardwareSerial(); err == nil {
+		t.Fatal("expected error without a usable serial")
+	}
+}
+
+func TestLoadConfigEncryptsServerKey(t *testing.T) {
+	setHardwareSerialForTest(t, "10000000abcdef01")
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	if err := os.WriteFile(path, []byte("allowed_units: []\nserver_key: plain-key\nencrypt_secrets: true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ServerKey != "plain-key" || ServerKey != "plain-key" {
+		t.Fatalf("expected plain key in memory, got %q", config.ServerKey)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "plain-key") || !strings.Contains(string(data), sealedSecretPrefix) {
+		t.Fatalf("expected server_key encrypted on disk:\n%s", data)
+	}
+
+	// The sealed file loads again and passes the self-test.
+	if config, err = LoadConfigFrom(path); err != nil || config.ServerKey != "plain-key" {
+		t.Fatalf("reload = %+v, %v", config, err)
+	}
+	if err := validateConfigFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	setHardwareSerialForTest(t, "10000000fedcba98")
+	if _, err := LoadConfigFrom(path); err == nil || !strings.Contains(err.Error(), "decrypt server_key") {
+		t.Fatalf("expected decryption error on another device, got %v", err)
+	}
+}
+
+func TestSaveConfigKeepsPlainKeyWithoutEncryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	if err := saveConfigToFile(path, &Config{ServerKey: "plain-key"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "server_key: plain-key") {
+		t.Fatalf("expected plain server_key, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// selfTestCoreTimeout bounds the core reachability probe.
+var selfTestCoreTimeout = 10 * time.Second
+
+// SelfTestReport is the result of RunSelfTest.
+type SelfTestReport struct {
+	Passed  bool          `json:"passed"`
+	Version string        `json:"version"`
+	Time    string        `json:"time"`
+	Checks  []HealthCheck `json:"checks"`
+}
+
+// validateConfigFile parses the config at path without touching agent state.
+func validateConfigFile(path string) error {
+	if path == "" {
+		return fmt.Errorf("config path is not set")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var c Config
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return err
+	}
+	if c.ServerKey == "" {
+		return fmt.Errorf("server_key is required in configuration")
+	}
+	if err := openConfigSecrets(&c); err != nil {
+		return err
+	}
+	if _, err := parseAllowedClients(c.AllowedClients); err != nil {
+		return err
+	}
+	if _, err := newSyncSource(c); err != nil {
+		return fmt.Errorf("invalid sync configuration: %w", err)
+	}
+	applyHTTPClientDefaults(&c.HTTPClient)
+	if _, err := NewCoreClient(c.HTTPClient); err != nil {
+		return fmt.Errorf("invalid http_client configuration: %w", err)
+	}
+	return nil
+}
+
+func checkConfigValid() HealthCheck {
+	if err := validateConfigFile(ConfigPath); err != nil {
+		return HealthCheck{Name: "config", OK: false, Detail: err.Error()}
+	}
+	return HealthCheck{Name: "config", OK: true, Detail: ConfigPath}
+}
+
+// requiredUnits returns the allowed units plus the playback unit, sorted.
+func requiredUnits(config Config) []string {
+	set := map[string]struct{}{playbackServiceUnit: {}}
+	for _, unit := range config.AllowedUnits {
+		set[unit] = struct{}{}
+	}
+	units := make([]string, 0, len(set))
+	for unit := range set {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+	return units
+}
+
+func checkUnitsAndPlayer(ctx context.Context, config Config) []HealthCheck {
+	conn, err := getDBusConnection(ctx)
+	if err != nil {
+		detail := fmt.Sprintf("D-Bus unavailable: %v", err)
+		return []HealthCheck{
+			{Name: "units", OK: false, Detail: detail},
+			{Name: "player", OK: false, Detail: detail},
+		}
+	}
+	defer conn.Close()
+
+	opCtx, cancel := context.WithTimeout(ctx, dbusTimeout())
+	defer cancel()
+
+	var missing []string
+	var playerState string
+	for _, unit := range requiredUnits(config) {
+		props, err := conn.GetUnitPropertiesContext(opCtx, unit)
+		if err != nil {
+			missing = append(missing, fmt.Sprintf("%s (%v)", unit, err))
+			continue
+		}
+		if state, _ := props["LoadState"].(string); state == "not-found" {
+			missing = append(missing, unit)
+		}
+		if unit == playbackServiceUnit {
+			playerState, _ = props["ActiveState"].(string)
+		}
+	}
+
+	units := HealthCheck{Name: "units", OK: true}
+	if len(missing) > 0 {
+		units = HealthCheck{Name: "units", OK: false, Detail: fmt.Sprintf("missing units: %v", missing)}
+	}
+
+	// The player is not started here: doing so would interrupt rest time.
+	player := HealthCheck{Name: "player", OK: true, Detail: playerState}
+	switch playerState {
+	case "":
+		player = HealthCheck{Name: "player", OK: false, Detail: fmt.Sprintf("%s state unknown", playbackServiceUnit)}
+	case "failed":
+		player = HealthCheck{Name: "player", OK: false, Detail: fmt.Sprintf("%s failed", playbackServiceUnit)}
+	}
+	return []HealthCheck{units, player}
+}
+
+// checkCoreReachable asks the core for the device manifest headers. Any
+// response below 500 proves the core is reachable.
+func checkCoreReachable(ctx context.Context, config Config) HealthCheck {
+	if config.CoreAPIBase == "" {
+		return HealthCheck{Name: "core", OK: false, Detail: "core_api_base is not set"}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, config.CoreAPIBase+"/api/devicesync", nil)
+	if err != nil {
+		return HealthCheck{Name: "core", OK: false, Detail: err.Error()}
+	}
+	req.Header.Set("X-Device-Id", config.ServerKey)
+	resp, err := getCoreClient().Do(ctx, req, selfTestCoreTimeout)
+	if err != nil {
+		return HealthCheck{Name: "core", OK: false, Detail: err.Error()}
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return HealthCheck{Name: "core", OK: false, Detail: fmt.Sprintf("status %d", resp.StatusCode)}
+	}
+	return HealthCheck{Name: "core", OK: true, Detail: fmt.Sprintf("status %d", resp.StatusCode)}
+}
+
+// RunSelfTest runs the device self-test battery and reports each check.
+func RunSelfTest(ctx context.Context) SelfTestReport {
+	config := GetCurrentConfig()
+	now := time.Now()
+
+	checks := []HealthCheck{checkConfigValid(), checkDBus(ctx)}
+	checks = append(checks, checkUnitsAndPlayer(ctx, config)...)
+	checks = append(checks,
+		checkMediaDirWritable(config),
+		checkClock(config, now),
+		checkCoreReachable(ctx, config),
+	)
+	if len(config.Storage.Network) > 0 {
+		checks = append(checks, checkNetworkMounts(config))
+	}
+
+	passed := true
+	for _, check := range checks {
+		passed = passed && check.OK
+	}
+	return SelfTestReport{
+		Passed:  passed,
+		Version: GetVersion(),
+		Time:    now.UTC().Format(time.RFC3339),
+		Checks:  checks,
+	}
+}
+
+// HandleSelfTest runs the self-test and returns the per-check report.
+func HandleSelfTest(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	report := RunSelfTest(r.Context())
+	if !report.Passed {
+		JSONResponse(w, http.StatusOK, APIResponse{OK: false, ErrMsg: "Самопроверка не пройдена", Data: report})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: report})
+}
@@ -0,0 +1,96 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func setConfigPathForTest(t *testing.T, path string) {
+	t.Helper()
+	original := ConfigPath
+	ConfigPath = path
+	t.Cleanup(func() { ConfigPath = original })
+}
+
+func TestRunSelfTestPasses(t *testing.T) {
+	t.Setenv("MEDIA_PI_AGENT_MOCK_DBUS", "1")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.Header.Get("X-Device-Id") != "key" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	if err := os.WriteFile(configPath, []byte("server_key: key\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setConfigPathForTest(t, configPath)
+	setCurrentConfigForTest(t, Config{
+		ServerKey:    "key",
+		CoreAPIBase:  server.URL,
+		AllowedUnits: []string{"a.service"},
+		Playlist:     PlaylistConfig{Destination: t.TempDir()},
+	})
+
+	report := RunSelfTest(context.Background())
+	if !report.Passed {
+		t.Fatalf("expected self-test to pass: %+v", report.Checks)
+	}
+	names := map[string]bool{}
+	for _, check := range report.Checks {
+		names[check.Name] = true
+	}
+	for _, name := range []string{"config", "dbus", "units", "player", "media_dir", "clock", "core"} {
+		if !names[name] {
+			t.Errorf("missing %s check in %+v", name, report.Checks)
+		}
+	}
+}
+
+func TestHandleSelfTestReportsFailures(t *testing.T) {
+	t.Setenv("MEDIA_PI_AGENT_MOCK_DBUS", "1")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	setConfigPathForTest(t, filepath.Join(t.TempDir(), "missing.yaml"))
+	setCurrentConfigForTest(t, Config{
+		CoreAPIBase: server.URL,
+		Playlist:    PlaylistConfig{Destination: t.TempDir()},
+	})
+
+	w := httptest.NewRecorder()
+	HandleSelfTest(w, httptest.NewRequest(http.MethodPost, "/api/system/selftest", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp struct {
+		OK   bool           `json:"ok"`
+		Data SelfTestReport `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.OK || resp.Data.Passed {
+		t.Fatalf("expected failing report, got %+v", resp)
+	}
+	failed := map[string]bool{}
+	for _, check := range resp.Data.Checks {
+		if !check.OK {
+			failed[check.Name] = true
+		}
+	}
+	if !failed["config"] || !failed["core"] || failed["media_dir"] {
+		t.Errorf("unexpected failed checks: %+v", resp.Data.Checks)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SyncSourceSFTP is the sync.source value of an SFTP server, for venues
+// whose firewall blocks HTTPS to the core but lets SSH through.
+const SyncSourceSFTP = "sftp"
+
+// SFTPSourceConfig describes the server read by the SFTP sync source. The
+// manifest is a JSON file in the /api/devicesync format and files are
+// stored under Root by their manifest filename.
+type SFTPSourceConfig struct {
+	Host string `yaml:"host,omitempty"`
+	Port int    `yaml:"port,omitempty"`
+	User string `yaml:"user,omitempty"`
+	// IdentityFile is the private key used to log in; ssh defaults apply
+	// when it is empty.
+	IdentityFile string `yaml:"identity_file,omitempty"`
+	// KnownHostsFile pins the server host key. Unknown host keys are
+	// always rejected.
+	KnownHostsFile string `yaml:"known_hosts_file,omitempty"`
+	Root           string `yaml:"root,omitempty"`
+	Manifest       string `yaml:"manifest,omitempty"`
+}
+
+// Defaults for the SFTP sync source.
+const (
+	DefaultSFTPPort     = 22
+	DefaultSFTPManifest = "manifest.json"
+)
+
+// runSFTPBatch runs sftp batch commands against the server. Tests may
+// override it.
+var runSFTPBatch = func(ctx context.Context, config SFTPSourceConfig, commands string) error {
+	args := []string{"-b", "-", "-q",
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=yes",
+		"-P", strconv.Itoa(config.Port),
+	}
+	if config.IdentityFile != "" {
+		args = append(args, "-i", config.IdentityFile)
+	}
+	if config.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+config.KnownHostsFile)
+	}
+	target := config.Host
+	if config.User != "" {
+		target = config.User + "@" + config.Host
+	}
+	cmd := exec.CommandContext(ctx, "sftp", append(args, target)...)
+	cmd.Stdin = strings.NewReader(commands)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sftp: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// sftpSyncSource reads the manifest and files with the OpenSSH sftp client.
+type sftpSyncSource struct {
+	config SFTPSourceConfig
+}
+
+func newSFTPSyncSource(config SFTPSourceConfig) (*sftpSyncSource, error) {
+	if strings.TrimSpace(config.Host) == "" {
+		return nil, errors.New("sync.sftp.host is required")
+	}
+	if config.Port == 0 {
+		config.Port = DefaultSFTPPort
+	}
+	if config.Port < 0 || config.Port > 65535 {
+		return nil, fmt.Errorf("invalid sync.sftp.port %d", config.Port)
+	}
+	if config.Manifest == "" {
+		config.Manifest = DefaultSFTPManifest
+	}
+	return &sftpSyncSource{config: config}, nil
+}
+
+func (s *sftpSyncSource) Key() string {
+	return fmt.Sprintf("sftp://%s@%s:%d/%s", s.config.User, s.config.Host, s.config.Port, s.config.Root)
+}
+
+// remotePath resolves name against the configured root.
+func (s *sftpSyncSource) remotePath(name string) string {
+	if s.config.Root == "" || path.IsAbs(name) {
+		return name
+	}
+	return path.Join(s.config.Root, name)
+}
+
+// get downloads remote to local in one sftp session.
+func (s *sftpSyncSource) get(ctx context.Context, remote, local string) error {
+	return runSFTPBatch(ctx, s.config, fmt.Sprintf("get %s %s\n", sftpQuote(remote), sftpQuote(local)))
+}
+
+// Manifest downloads the manifest file. Its SHA256 stands in for an ETag,
+// so an unchanged file skips the pass.
+func (s *sftpSyncSource) Manifest(ctx context.Context, previous manifestValidators, apply func([]ManifestItem) error) (manifestValidators, error) {
+	tmpDir, err := os.MkdirTemp("", "media-pi-sftp-")
+	if err != nil {
+		return manifestValidators{}, err
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	local := filepath.Join(tmpDir, "manifest.json")
+	fetchCtx, cancel := context.WithTimeout(ctx, manifestTimeout())
+	defer cancel()
+	if err := s.get(fetchCtx, s.remotePath(s.config.Manifest), local); err != nil {
+		return manifestValidators{}, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	data, err := os.ReadFile(local)
+	if err != nil {
+		return manifestValidators{}, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	validators := manifestValidators{ETag: `"sftp-` + hex.EncodeToString(sum[:]) + `"`}
+	if previous.ETag == validators.ETag {
+		return previous, errManifestNotModified
+	}
+
+	body, err := sniffManifestBody(bytes.NewReader(data), "")
+	if err != nil {
+		return manifestValidators{}, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	manifest := Manifest{}
+	if _, err := decodeManifestItems(body, func(item ManifestItem) error {
+		manifest = append(manifest, item)
+		return nil
+	}); err != nil {
+		return manifestValidators{}, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	log.Printf("SFTP manifest fetched: %d items", len(manifest))
+	return validators, apply(manifest)
+}
+
+// Fetch downloads item next to destPath and renames it into place only
+// after size and SHA256 match, like a core download.
+func (s *sftpSyncSource) Fetch(ctx context.Context, item ManifestItem, destPath string) error {
+	tmpPath := destPath + ".tmp"
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	fetchCtx, cancel := context.WithTimeout(ctx, downloadTimeout())
+	defer cancel()
+	if err := s.get(fetchCtx, s.remotePath(item.Filename), tmpPath); err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	info, err := os.Stat(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	if info.Size() != item.FileSizeBytes {
+		return contentMismatchf("file size mismatch: expected %d, got %d", item.FileSizeBytes, info.Size())
+	}
+	valid, err := verifyLocalFile(tmpPath, item)
+	if err != nil {
+		return fmt.Errorf("failed to verify file: %w", err)
+	}
+	if !valid {
+		return contentMismatchf("digest mismatch for %s", item.Filename)
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	return nil
+}
+
+// sftpQuote quotes a path for an sftp batch command.
+func sftpQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,109 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// stubSFTPServer serves "get" batch commands from a local directory that
+// stands in for the server file system.
+func stubSFTPServer(t *testing.T, serverRoot string) *[]string {
+	t.Helper()
+	var commands []string
+	original := runSFTPBatch
+	runSFTPBatch = func(ctx context.Context, config SFTPSourceConfig, batch string) error {
+		commands = append(commands, strings.TrimSpace(batch))
+		fields := strings.SplitN(strings.TrimSpace(batch), `" "`, 2)
+		remote, err := strconv.Unquote(strings.TrimPrefix(fields[0], "get ") + `"`)
+		if err != nil {
+			return err
+		}
+		local, err := strconv.Unquote(`"` + fields[1])
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Join(serverRoot, filepath.FromSlash(remote)))
+		if err != nil {
+			return errors.New("sftp: File not found")
+		}
+		return os.WriteFile(local, data, 0644)
+	}
+	t.Cleanup(func() { runSFTPBatch = original })
+	return &commands
+}
+
+func TestSFTPSyncSource(t *testing.T) {
+	serverRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(serverRoot, "srv", "media"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(filepath.Join(serverRoot, "srv", "media", "one.mp4"), []byte("one"), 0644)
+	_ = os.WriteFile(filepath.Join(serverRoot, "srv", "media", "bad.mp4"), []byte("tampered"), 0644)
+	manifest, _ := json.Marshal(Manifest{
+		{ID: 1, Filename: "one.mp4", FileSizeBytes: 3, SHA256: sha256Hex("one")},
+		{ID: 2, Filename: "bad.mp4", FileSizeBytes: 3, SHA256: sha256Hex("bad")},
+	})
+	_ = os.WriteFile(filepath.Join(serverRoot, "srv", "media", DefaultSFTPManifest), manifest, 0644)
+	commands := stubSFTPServer(t, serverRoot)
+
+	source, err := newSFTPSyncSource(SFTPSourceConfig{Host: "files.example", User: "media", Root: "srv/media"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaDir := t.TempDir()
+	config := Config{Playlist: PlaylistConfig{Destination: mediaDir}}
+	_, validators, err := syncFromSource(context.Background(), config, source, manifestValidators{})
+	if err == nil || !strings.Contains(err.Error(), "bad.mp4") {
+		t.Fatalf("expected a verification error for bad.mp4, got %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(mediaDir, "one.mp4")); err != nil || string(data) != "one" {
+		t.Fatalf("expected one.mp4 synced, got %q, %v", data, err)
+	}
+	for _, name := range []string{"bad.mp4", "bad.mp4.tmp"} {
+		if _, err := os.Stat(filepath.Join(mediaDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected no %s after a failed check, stat err = %v", name, err)
+		}
+	}
+	if !strings.HasPrefix((*commands)[0], `get "srv/media/manifest.json" "`) {
+		t.Errorf("unexpected manifest command %q", (*commands)[0])
+	}
+
+	// An unchanged manifest file skips the pass.
+	_ = os.WriteFile(filepath.Join(serverRoot, "srv", "media", "bad.mp4"), []byte("bad"), 0644)
+	_, validators, err = syncFromSource(context.Background(), config, source, manifestValidators{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	*commands = nil
+	if _, _, err := syncFromSource(context.Background(), config, source, validators); !errors.Is(err, errManifestNotModified) || len(*commands) != 1 {
+		t.Fatalf("expected errManifestNotModified after one get, got %v, %v", err, *commands)
+	}
+}
+
+func TestNewSFTPSyncSource(t *testing.T) {
+	if _, err := newSFTPSyncSource(SFTPSourceConfig{}); err == nil {
+		t.Fatal("expected missing host to be rejected")
+	}
+	if _, err := newSFTPSyncSource(SFTPSourceConfig{Host: "h", Port: 70000}); err == nil {
+		t.Fatal("expected invalid port to be rejected")
+	}
+	source, err := defaultSyncSource(Config{Sync: SyncConfig{Source: "sftp", SFTP: SFTPSourceConfig{Host: "h"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := source.Key(); got != "sftp://@h:22/" {
+		t.Errorf("Key() = %q", got)
+	}
+	if got := sftpQuote(`a "b"\c`); got != `"a \"b\"\\c"` {
+		t.Errorf("sftpQuote = %s", got)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"image"
+	"image/jpeg"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+// simulated is set by EnableSimulation.
+var simulated bool
+
+// IsSimulated reports whether the agent runs in simulation mode.
+func IsSimulated() bool {
+	return simulated
+}
+
+// EnableSimulation replaces D-Bus, reboot, power-off, crontab, brightness,
+// display and screenshot interactions with in-memory fakes. The HTTP API
+// and the sync logic stay live, so a fleet of simulated agents can run in
+// containers against a real core. It must be called before services start.
+func EnableSimulation() {
+	simulated = true
+	system := &simulatedSystem{units: map[string]string{}}
+	SetDBusConnectionFactory(func(ctx context.Context) (DBusConnection, error) {
+		return system, nil
+	})
+	RebootAction = func() error {
+		log.Println("Simulation: reboot requested")
+		system.reset()
+		return nil
+	}
+	PowerOffAction = func() error {
+		log.Println("Simulation: power-off requested")
+		system.reset()
+		return nil
+	}
+	CrontabReadFunc = system.readCrontab
+	CrontabWriteFunc = system.writeCrontab
+	runBrightnessCommand = func(ctx context.Context, command string) error {
+		log.Printf("Simulation: brightness command %q", command)
+		return nil
+	}
+	runWlrRandr = func(ctx context.Context, username string, args []string) error {
+		log.Printf("Simulation: wlr-randr %v", args)
+		return nil
+	}
+	runScreenshotCommand = func(inputPath, outputPath string) error {
+		return writeSimulatedScreenshot(outputPath)
+	}
+	log.Println("Simulation mode: system interactions are faked")
+}
+
+// writeSimulatedScreenshot stores a small black JPEG in place of a frame
+// grabbed from the display.
+func writeSimulatedScreenshot(outputPath string) error {
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(f, image.NewGray(image.Rect(0, 0, 16, 9)), nil); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// simulatedSystem is a DBusConnection that keeps unit states in memory,
+// together with the crontab of the simulated device.
+type simulatedSystem struct {
+	mu      sync.Mutex
+	units   map[string]string
+	crontab string
+}
+
+func (s *simulatedSystem) setState(name, state string, ch chan<- string) (int, error) {
+	s.mu.Lock()
+	s.units[name] = state
+	s.mu.Unlock()
+	if ch != nil {
+		select {
+		case ch <- "done":
+		default:
+		}
+	}
+	return 1, nil
+}
+
+// reset stops every unit, as a reboot of the simulated device would.
+func (s *simulatedSystem) reset() {
+	s.mu.Lock()
+	s.units = map[string]string{}
+	s.mu.Unlock()
+}
+
+func (s *simulatedSystem) readCrontab() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.crontab, nil
+}
+
+func (s *simulatedSystem) writeCrontab(content string) error {
+	s.mu.Lock()
+	s.crontab = content
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *simulatedSystem) Close() {}
+
+func (s *simulatedSystem) ReloadContext(ctx context.Context) error {
+	return nil
+}
+
+func (s *simulatedSystem) StartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	return s.setState(name, "active", ch)
+}
+
+func (s *simulatedSystem) StopUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	return s.setState(name, "inactive", ch)
+}
+
+func (s *simulatedSystem) RestartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	return s.setState(name, "active", ch)
+}
+
+func (s *simulatedSystem) EnableUnitFilesContext(ctx context.Context, files []string, runtime, force bool) (bool, []dbus.EnableUnitFileChange, error) {
+	return true, nil, nil
+}
+
+func (s *simulatedSystem) DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.DisableUnitFileChange, error) {
+	return nil, nil
+}
+
+func (s *simulatedSystem) MaskUnitFilesContext(ctx context.Context, files []string, runtime, force bool) ([]dbus.MaskUnitFileChange, error) {
+	return nil, nil
+}
+
+func (s *simulatedSystem) UnmaskUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.UnmaskUnitFileChange, error) {
+	return nil, nil
+}
+
+func (s *simulatedSystem) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error) {
+	s.mu.Lock()
+	state := s.units[unit]
+	s.mu.Unlock()
+	if state == "active" {
+		return map[string]any{"ActiveState": "active", "SubState": "running"}, nil
+	}
+	return map[string]any{"ActiveState": "inactive", "SubState": "dead"}, nil
+}
+
+func (s *simulatedSystem) GetUnitTypePropertiesContext(ctx context.Context, unit, unitType string) (map[string]any, error) {
+	return map[string]any{}, nil
+}
+
+func (s *simulatedSystem) StartTransientUnitContext(ctx context.Context, name, mode string, properties []dbus.Property, ch chan<- string) (int, error) {
+	return 1, nil
+}
+
+func (s *simulatedSystem) ResetFailedUnitContext(ctx context.Context, name string) error {
+	return nil
+}
+
+func (s *simulatedSystem) RebootContext(ctx context.Context) error {
+	return RebootAction()
+}
+
+func (s *simulatedSystem) PowerOffContext(ctx context.Context) error {
+	return PowerOffAction()
+}
@@ -0,0 +1,70 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnableSimulation(t *testing.T) {
+	reboot, powerOff := RebootAction, PowerOffAction
+	crontabRead, crontabWrite := CrontabReadFunc, CrontabWriteFunc
+	brightness, randr, screenshot := runBrightnessCommand, runWlrRandr, runScreenshotCommand
+	t.Cleanup(func() {
+		simulated = false
+		SetDBusConnectionFactory(nil)
+		RebootAction, PowerOffAction = reboot, powerOff
+		CrontabReadFunc, CrontabWriteFunc = crontabRead, crontabWrite
+		runBrightnessCommand, runWlrRandr, runScreenshotCommand = brightness, randr, screenshot
+	})
+	EnableSimulation()
+	if !IsSimulated() {
+		t.Fatal("simulation must be reported as enabled")
+	}
+
+	ctx := context.Background()
+	conn, err := getDBusConnection(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan string, 1)
+	if _, err := conn.StartUnitContext(ctx, "play.video.service", "replace", ch); err != nil || <-ch != "done" {
+		t.Fatalf("start: %v", err)
+	}
+	props, _ := conn.GetUnitPropertiesContext(ctx, "play.video.service")
+	if props["ActiveState"] != "active" {
+		t.Fatalf("ActiveState = %v after start", props["ActiveState"])
+	}
+	if err := RebootAction(); err != nil {
+		t.Fatal(err)
+	}
+	props, _ = conn.GetUnitPropertiesContext(ctx, "play.video.service")
+	if props["ActiveState"] != "inactive" {
+		t.Fatalf("ActiveState = %v after reboot", props["ActiveState"])
+	}
+
+	if err := CrontabWriteFunc("0 7 * * * true\n"); err != nil {
+		t.Fatal(err)
+	}
+	if crontab, _ := CrontabReadFunc(); crontab != "0 7 * * * true\n" {
+		t.Fatalf("crontab = %q", crontab)
+	}
+
+	output := filepath.Join(t.TempDir(), "screen.jpg")
+	if err := runScreenshotCommand("/dev/dri/card0", output); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := jpeg.Decode(f); err != nil {
+		t.Fatalf("simulated screenshot is not a JPEG: %v", err)
+	}
+}
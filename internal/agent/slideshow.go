@@ -0,0 +1,247 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Slideshow support: with player.image_duration set, every playlist gets a
+// sidecar that tells the player how long to show each image. A duration in
+// the #EXTINF line before an image entry overrides the default.
+
+// Players whose slideshow configuration the agent generates.
+const (
+	playerKindMPV = "mpv"
+	playerKindFeh = "feh"
+)
+
+const (
+	// fehSlideshowTick is the feh --slideshow-delay. feh has no per-image
+	// delay, so an image is listed once per tick of its duration.
+	fehSlideshowTick = time.Second
+	// maxImageDuration bounds per-image durations and so the feh list.
+	maxImageDuration = time.Hour
+)
+
+var imageExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".bmp": true, ".webp": true,
+}
+
+func isImageFile(path string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// slideshowEnabled reports whether player.image_duration asks for slideshow
+// configuration.
+func slideshowEnabled(config Config) bool {
+	return config.Player.ImageDuration > 0
+}
+
+// playerKind returns playerKindMPV or playerKindFeh for player.command, or
+// "" for players without slideshow configuration.
+func playerKind(config Config) string {
+	fields := strings.Fields(playerCommand(config))
+	if len(fields) == 0 {
+		return ""
+	}
+	switch filepath.Base(fields[0]) {
+	case "mpv":
+		return playerKindMPV
+	case "feh":
+		return playerKindFeh
+	}
+	return ""
+}
+
+// slideshowConfigPath returns the sidecar of playlistPath for the player,
+// or "" when none is generated.
+func slideshowConfigPath(config Config, playlistPath string) string {
+	if !slideshowEnabled(config) {
+		return ""
+	}
+	switch playerKind(config) {
+	case playerKindMPV:
+		return playlistPath + ".mpv.conf"
+	case playerKindFeh:
+		return playlistPath + ".feh"
+	}
+	return ""
+}
+
+// playlistArgs returns what play.video units append to the player command:
+// the playlist, preceded by the slideshow configuration mpv includes, or the
+// image list feh shows instead of the playlist.
+func playlistArgs(config Config, playlistPath string) string {
+	playlist := SanitizeSystemdValue(playlistPath)
+	sidecar := SanitizeSystemdValue(slideshowConfigPath(config, playlistPath))
+	switch {
+	case sidecar == "":
+		return playlist
+	case playerKind(config) == playerKindFeh:
+		return fmt.Sprintf("--slideshow-delay %g --filelist %s", fehSlideshowTick.Seconds(), sidecar)
+	default:
+		return "--include=" + sidecar + " " + playlist
+	}
+}
+
+// slideshowImage is an image entry of a playlist with its display time.
+type slideshowImage struct {
+	Entry    string
+	Path     string
+	Duration time.Duration
+}
+
+// parseExtinfDuration returns the duration of an #EXTINF:<seconds>,<title>
+// line, or 0 when it has none (-1 means unknown in M3U).
+func parseExtinfDuration(line string) time.Duration {
+	value := strings.TrimPrefix(line, "#EXTINF:")
+	if i := strings.IndexAny(value, ", \t"); i >= 0 {
+		value = value[:i]
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 || math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return 0
+	}
+	if seconds > maxImageDuration.Seconds() {
+		return maxImageDuration
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// playlistImages lists the image entries of an M3U playlist in order.
+// Relative entries are resolved against the playlist directory like the
+// players do.
+func playlistImages(data []byte, playlistPath string, defaultDuration time.Duration) []slideshowImage {
+	var images []slideshowImage
+	var duration time.Duration
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXTINF:"):
+			duration = parseExtinfDuration(line)
+			continue
+		case strings.HasPrefix(line, "#"):
+			continue
+		}
+		if isImageFile(line) && !strings.Contains(line, "://") {
+			path := line
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(playlistPath), filepath.FromSlash(path))
+			}
+			image := slideshowImage{Entry: line, Path: path, Duration: duration}
+			if image.Duration == 0 {
+				image.Duration = defaultDuration
+			}
+			images = append(images, image)
+		}
+		duration = 0
+	}
+	return images
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// renderMPVSlideshow sets image-display-duration to the default and adds a
+// conditional auto profile for every image shown longer or shorter.
+func renderMPVSlideshow(playlistPath string, images []slideshowImage, defaultDuration time.Duration) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by media-pi-agent from %s\n", playlistPath)
+	fmt.Fprintf(&b, "image-display-duration=%s\n", formatSeconds(defaultDuration))
+	n := 0
+	for _, image := range images {
+		if image.Duration == defaultDuration {
+			continue
+		}
+		n++
+		cond := "path == " + strconv.Quote(image.Path)
+		if image.Entry != image.Path {
+			cond += " or path == " + strconv.Quote(image.Entry)
+		}
+		fmt.Fprintf(&b, "\n[media-pi-image-%d]\nprofile-cond=%s\nprofile-restore=copy\nimage-display-duration=%s\n", n, cond, formatSeconds(image.Duration))
+	}
+	return b.String()
+}
+
+// renderFehSlideshow lists every image once per fehSlideshowTick of its
+// duration. Videos are left out, feh shows images only.
+func renderFehSlideshow(images []slideshowImage) string {
+	var b strings.Builder
+	for _, image := range images {
+		ticks := int(math.Ceil(image.Duration.Seconds() / fehSlideshowTick.Seconds()))
+		for i := 0; i < max(ticks, 1); i++ {
+			b.WriteString(image.Path)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// playbackPlaylistPaths lists the playlist of every playback unit.
+func playbackPlaylistPaths(config Config) []string {
+	if len(config.Displays) == 0 {
+		return []string{displayPlaylistPath(config, DisplayOutputConfig{})}
+	}
+	paths := make([]string, 0, len(config.Displays))
+	for _, display := range config.Displays {
+		paths = append(paths, displayPlaylistPath(config, display))
+	}
+	return paths
+}
+
+// writeSlideshowConfig renders the sidecar of playlistPath. A missing
+// playlist gets a sidecar without images, so the player still starts.
+func writeSlideshowConfig(config Config, playlistPath string) error {
+	sidecar := slideshowConfigPath(config, playlistPath)
+	if sidecar == "" {
+		return nil
+	}
+	data, err := os.ReadFile(playlistPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	defaultDuration := min(config.Player.ImageDuration, maxImageDuration)
+	images := playlistImages(data, playlistPath, defaultDuration)
+	content := renderMPVSlideshow(playlistPath, images, defaultDuration)
+	if playerKind(config) == playerKindFeh {
+		content = renderFehSlideshow(images)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(sidecar), 0755); err != nil {
+		return err
+	}
+	tmpPath := sidecar + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(content), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, sidecar); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// writeSlideshowConfigs renders the sidecars of every playback playlist.
+// Failures are logged: the player still runs with its own defaults.
+func writeSlideshowConfigs(config Config) {
+	for _, path := range playbackPlaylistPaths(config) {
+		if err := writeSlideshowConfig(config, path); err != nil {
+			log.Printf("Warning: failed to write slideshow configuration for %s: %v", path, err)
+		}
+	}
+}
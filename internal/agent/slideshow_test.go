@@ -0,0 +1,135 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const slideshowPlaylist = `#EXTM3U
+#EXTINF:15,Spring poster
+posters/spring.jpg
+#EXTINF:-1,Trailer
+trailer.mp4
+logo.PNG
+#EXTINF:2.5 tvg-id="x",Quick
+/var/media-pi/quick.webp
+https://example.com/remote.jpg
+`
+
+func TestPlaylistImages(t *testing.T) {
+	images := playlistImages([]byte(slideshowPlaylist), "/var/media-pi/playlist.m3u", 10*time.Second)
+	want := []slideshowImage{
+		{Entry: "posters/spring.jpg", Path: "/var/media-pi/posters/spring.jpg", Duration: 15 * time.Second},
+		{Entry: "logo.PNG", Path: "/var/media-pi/logo.PNG", Duration: 10 * time.Second},
+		{Entry: "/var/media-pi/quick.webp", Path: "/var/media-pi/quick.webp", Duration: 2500 * time.Millisecond},
+	}
+	if len(images) != len(want) {
+		t.Fatalf("playlistImages = %+v, want %+v", images, want)
+	}
+	for i := range want {
+		if images[i] != want[i] {
+			t.Errorf("image %d = %+v, want %+v", i, images[i], want[i])
+		}
+	}
+	if d := parseExtinfDuration("#EXTINF:99999,Long"); d != maxImageDuration {
+		t.Errorf("expected duration to be capped, got %v", d)
+	}
+}
+
+func TestWriteSlideshowConfigMPV(t *testing.T) {
+	dir := t.TempDir()
+	playlist := filepath.Join(dir, playlistFileName)
+	if err := os.WriteFile(playlist, []byte(slideshowPlaylist), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{
+		Playlist: PlaylistConfig{Destination: dir},
+		Player:   PlayerConfig{Command: "/usr/bin/mpv --fs", ImageDuration: 10 * time.Second},
+	}
+	writeSlideshowConfigs(config)
+
+	data, err := os.ReadFile(playlist + ".mpv.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := string(data)
+	for _, want := range []string{
+		"image-display-duration=10\n",
+		"[media-pi-image-1]\nprofile-cond=path == \"" + filepath.Join(dir, "posters/spring.jpg") + "\" or path == \"posters/spring.jpg\"\nprofile-restore=copy\nimage-display-duration=15\n",
+		"image-display-duration=2.5\n",
+	} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("missing %q in:\n%s", want, conf)
+		}
+	}
+	if strings.Contains(conf, "logo.PNG") {
+		t.Errorf("images with the default duration need no profile:\n%s", conf)
+	}
+
+	units, err := renderPlaybackUnits(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ExecStart=/usr/bin/mpv --fs --include=" + playlist + ".mpv.conf " + playlist + "\n"; !strings.Contains(units[0].Content, want) {
+		t.Errorf("unexpected unit:\n%s", units[0].Content)
+	}
+}
+
+func TestWriteSlideshowConfigFeh(t *testing.T) {
+	dir := t.TempDir()
+	playlist := filepath.Join(dir, playlistFileName)
+	if err := os.WriteFile(playlist, []byte("#EXTINF:3,A\na.jpg\nclip.mp4\nb.png\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{
+		Playlist: PlaylistConfig{Destination: dir},
+		Player:   PlayerConfig{Command: "/usr/bin/feh --fullscreen --hide-pointer", ImageDuration: 2 * time.Second},
+	}
+	if err := writeSlideshowConfig(config, playlist); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(playlist + ".feh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.png")
+	if want := strings.Join([]string{a, a, a, b, b}, "\n") + "\n"; string(data) != want {
+		t.Fatalf("feh list = %q, want %q", data, want)
+	}
+	if got := playlistArgs(config, playlist); got != "--slideshow-delay 1 --filelist "+playlist+".feh" {
+		t.Fatalf("playlistArgs = %q", got)
+	}
+}
+
+func TestSlideshowDisabledByDefault(t *testing.T) {
+	config := Config{Player: PlayerConfig{Command: "/usr/bin/mpv --fs"}}
+	if got := playlistArgs(config, "/var/media-pi/playlist.m3u"); got != "/var/media-pi/playlist.m3u" {
+		t.Fatalf("playlistArgs = %q", got)
+	}
+	config = Config{Player: PlayerConfig{ImageDuration: time.Second}}
+	if slideshowConfigPath(config, "/var/media-pi/playlist.m3u") != "" {
+		t.Fatal("cvlc gets no slideshow configuration")
+	}
+}
+
+func TestGarbageCollectionKeepsSlideshowConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := Config{
+		Playlist: PlaylistConfig{Destination: dir},
+		Player:   PlayerConfig{Command: "/usr/bin/mpv", ImageDuration: 5 * time.Second},
+	}
+	writeSlideshowConfigs(config)
+	s := fileSyncerFor(config, nil)
+	if err := s.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, playlistFileName+".mpv.conf")); err != nil {
+		t.Fatalf("expected slideshow configuration to be kept: %v", err)
+	}
+}
@@ -43,10 +43,30 @@ func (s *startupPlaybackConn) DisableUnitFilesContext(ctx context.Context, files
 	return nil, nil
 }
 
+func (s *startupPlaybackConn) MaskUnitFilesContext(ctx context.Context, files []string, runtime, force bool) ([]dbus.MaskUnitFileChange, error) {
+	return nil, nil
+}
+
+func (s *startupPlaybackConn) UnmaskUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]dbus.UnmaskUnitFileChange, error) {
+	return nil, nil
+}
+
 func (s *startupPlaybackConn) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error) {
 	return map[string]any{}, nil
 }
 
+func (s *startupPlaybackConn) GetUnitTypePropertiesContext(ctx context.Context, unit, unitType string) (map[string]any, error) {
+	return map[string]any{}, nil
+}
+
+func (s *startupPlaybackConn) StartTransientUnitContext(ctx context.Context, name, mode string, properties []dbus.Property, ch chan<- string) (int, error) {
+	return 1, nil
+}
+
+func (s *startupPlaybackConn) ResetFailedUnitContext(ctx context.Context, name string) error {
+	return nil
+}
+
 func (s *startupPlaybackConn) RebootContext(ctx context.Context) error { return nil }
 
 func (s *startupPlaybackConn) PowerOffContext(ctx context.Context) error { return nil }
@@ -0,0 +1,312 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// stateBackupExt marks the previous good generation of a state file.
+const stateBackupExt = ".bak"
+
+// stateEnvelope wraps persisted agent state with a checksum so a file
+// truncated by a power cut is detected instead of parsed.
+type stateEnvelope struct {
+	SHA256  string          `json:"sha256"`
+	SavedAt time.Time       `json:"savedAt"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// errStateCorrupt is returned when neither generation of a state file
+// passes verification.
+var errStateCorrupt = errors.New("state file is corrupt")
+
+var (
+	// agentStateDir holds the state files of the agent. It lies outside
+	// the media directories, so sync garbage collection never walks it.
+	agentStateDir = "/var/lib/media-pi-agent"
+	// legacyStateDir is where earlier versions kept state, inside the
+	// default media directory; see MigrateLegacyState.
+	legacyStateDir = "/var/media-pi/sync"
+
+	// manifestCacheFilePath persists the validators of the last applied
+	// manifest across restarts.
+	manifestCacheFilePath = filepath.Join(agentStateDir, "manifest-cache.json")
+
+	// stateWriteLock serializes state writes so generations do not interleave.
+	stateWriteLock sync.Mutex
+
+	syncStatusPersistLock    sync.Mutex
+	manifestCachePersistLock sync.Mutex
+
+	// statePersists tracks the background writes of the sync status and
+	// manifest cache, which tests wait for before moving the state paths.
+	statePersists sync.WaitGroup
+)
+
+// agentStateFiles are the state files kept in agentStateDir.
+var agentStateFiles = []*string{
+	&syncStatusFilePath,
+	&manifestCacheFilePath,
+	&verifyCacheFilePath,
+	&manifestIndexFilePath,
+	&downloadQuarantineFilePath,
+	&uploadStateFilePath,
+	&profileStateFilePath,
+	&playStatsFilePath,
+	&syncPauseStateFilePath,
+	&takeoverStateFilePath,
+	&webStateFilePath,
+	&calendarStateFilePath,
+	&restoredFilesPath,
+	&startupStateFilePath,
+	&execAuditLogPath,
+}
+
+// MigrateLegacyState moves state files left in legacyStateDir by an
+// earlier version to agentStateDir, unless a newer file already exists.
+// It must be called before the state is restored.
+func MigrateLegacyState() {
+	for _, path := range agentStateFiles {
+		for _, ext := range []string{"", stateBackupExt} {
+			target := *path + ext
+			legacy := filepath.Join(legacyStateDir, filepath.Base(target))
+			if legacy == target {
+				continue
+			}
+			if _, err := os.Stat(legacy); err != nil {
+				continue
+			}
+			if _, err := os.Stat(target); err == nil {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				log.Printf("Warning: failed to create state directory: %v", err)
+				return
+			}
+			// The media directory may be on another drive.
+			if err := os.Rename(legacy, target); err != nil {
+				if err := copyFileAtomic(context.Background(), legacy, target, func(int64) {}); err != nil {
+					log.Printf("Warning: failed to move %s to %s: %v", legacy, target, err)
+					continue
+				}
+				_ = os.Remove(legacy)
+			}
+			log.Printf("Moved state file %s to %s", legacy, target)
+		}
+	}
+}
+
+func stateChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeStateFile durably replaces path with v. The new generation is
+// written and fsynced next to path first; the current file is kept as
+// path.bak, so a power cut at any point leaves one verifiable generation.
+func writeStateFile(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	envelope, err := json.Marshal(stateEnvelope{SHA256: stateChecksum(data), SavedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return err
+	}
+
+	stateWriteLock.Lock()
+	defer stateWriteLock.Unlock()
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := writeFileSync(tmpPath, envelope, 0644); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if _, err := readStateGeneration(path); err == nil {
+		if err := os.Rename(path, path+stateBackupExt); err != nil {
+			_ = os.Remove(tmpPath)
+			return err
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// writeFileSync writes data to path and flushes it to stable storage.
+func writeFileSync(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// syncDir flushes directory entries so renames survive a power cut.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
+
+// readStateGeneration returns the verified payload of one state file.
+// Plain JSON written before the envelope was introduced is accepted.
+func readStateGeneration(path string) (json.RawMessage, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var envelope stateEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", errStateCorrupt, err)
+	}
+	if envelope.SHA256 == "" && envelope.Data == nil {
+		return raw, nil
+	}
+	if stateChecksum(envelope.Data) != envelope.SHA256 {
+		return nil, fmt.Errorf("%w: checksum mismatch", errStateCorrupt)
+	}
+	return envelope.Data, nil
+}
+
+// readStateFile loads path into v. When the current generation is
+// missing or corrupt, the previous one is used and written back. It
+// returns os.ErrNotExist when no state was ever saved.
+func readStateFile(path string, v any) error {
+	data, err := readStateGeneration(path)
+	if err == nil {
+		return json.Unmarshal(data, v)
+	}
+	current := err
+
+	backup, err := readStateGeneration(path + stateBackupExt)
+	if err != nil {
+		if errors.Is(current, os.ErrNotExist) && errors.Is(err, os.ErrNotExist) {
+			return os.ErrNotExist
+		}
+		return fmt.Errorf("%s: %w", path, errStateCorrupt)
+	}
+	if err := json.Unmarshal(backup, v); err != nil {
+		return fmt.Errorf("%s: %w: %v", path, errStateCorrupt, err)
+	}
+
+	log.Printf("Warning: recovered %s from previous generation: %v", path, current)
+	if err := restoreStateBackup(path); err != nil {
+		log.Printf("Warning: failed to restore %s: %v", path, err)
+	}
+	return nil
+}
+
+// restoreStateBackup replaces path with a copy of its previous generation,
+// keeping the backup in place.
+func restoreStateBackup(path string) error {
+	raw, err := os.ReadFile(path + stateBackupExt)
+	if err != nil {
+		return err
+	}
+
+	stateWriteLock.Lock()
+	defer stateWriteLock.Unlock()
+	tmpPath := path + ".tmp"
+	if err := writeFileSync(tmpPath, raw, 0644); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// persistedManifestCache is the on-disk form of the applied manifest cache.
+type persistedManifestCache struct {
+	Key          string `json:"key"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// persistSyncStatus writes the current sync status. Reading and writing
+// under one lock lets concurrent callers leave the latest status on disk.
+func persistSyncStatus() {
+	syncStatusPersistLock.Lock()
+	defer syncStatusPersistLock.Unlock()
+	if err := writeStateFile(syncStatusFilePath, GetSyncStatus()); err != nil {
+		log.Printf("Warning: Failed to persist sync status: %v", err)
+	}
+}
+
+func persistAppliedManifest() {
+	manifestCachePersistLock.Lock()
+	defer manifestCachePersistLock.Unlock()
+	appliedManifestLock.Lock()
+	cache := persistedManifestCache{
+		Key:          appliedManifestKey,
+		ETag:         appliedManifestValidators.ETag,
+		LastModified: appliedManifestValidators.LastModified,
+	}
+	appliedManifestLock.Unlock()
+	if err := writeStateFile(manifestCacheFilePath, cache); err != nil {
+		log.Printf("Warning: Failed to persist manifest cache: %v", err)
+	}
+}
+
+// LoadPersistedState restores the sync status, manifest cache and
+// verification cache saved by a previous run. Unreadable state is logged and ignored so a corrupt
+// file never prevents startup.
+func LoadPersistedState() {
+	var status SyncStatus
+	switch err := readStateFile(syncStatusFilePath, &status); {
+	case err == nil:
+		syncStatusLock.Lock()
+		syncStatus = status
+		syncStatusLock.Unlock()
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("Warning: ignoring sync status: %v", err)
+	}
+
+	var cache persistedManifestCache
+	switch err := readStateFile(manifestCacheFilePath, &cache); {
+	case err == nil:
+		appliedManifestLock.Lock()
+		appliedManifestKey = cache.Key
+		appliedManifestValidators = manifestValidators{ETag: cache.ETag, LastModified: cache.LastModified}
+		appliedManifestLock.Unlock()
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("Warning: ignoring manifest cache: %v", err)
+	}
+
+	loadVerifyCache()
+	loadManifestIndex()
+	loadDownloadFailures()
+	loadRestoredFiles()
+}
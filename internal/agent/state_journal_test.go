@@ -0,0 +1,238 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type journalTestState struct {
+	Value string `json:"value"`
+}
+
+func TestStateFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "value.json")
+	if err := writeStateFile(path, journalTestState{Value: "one"}); err != nil {
+		t.Fatalf("writeStateFile() error = %v", err)
+	}
+	if err := writeStateFile(path, journalTestState{Value: "two"}); err != nil {
+		t.Fatalf("writeStateFile() error = %v", err)
+	}
+
+	var got journalTestState
+	if err := readStateFile(path, &got); err != nil {
+		t.Fatalf("readStateFile() error = %v", err)
+	}
+	if got.Value != "two" {
+		t.Fatalf("value = %q, want two", got.Value)
+	}
+	if _, err := readStateGeneration(path + stateBackupExt); err != nil {
+		t.Errorf("expected previous generation to be kept: %v", err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind: %v", err)
+	}
+}
+
+func TestReadStateFileRecoversTruncatedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "value.json")
+	if err := writeStateFile(path, journalTestState{Value: "good"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStateFile(path, journalTestState{Value: "newer"}); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a power cut that truncated the current generation.
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, raw[:len(raw)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var got journalTestState
+	if err := readStateFile(path, &got); err != nil {
+		t.Fatalf("readStateFile() error = %v", err)
+	}
+	if got.Value != "good" {
+		t.Fatalf("value = %q, want good", got.Value)
+	}
+	if _, err := readStateGeneration(path); err != nil {
+		t.Errorf("expected recovered generation to be written back: %v", err)
+	}
+
+	// A corrupt current generation must not replace the good backup.
+	if err := os.WriteFile(path, []byte(`{"sha256":"00","data":{"value":"bad"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := readStateFile(path, &got); err != nil || got.Value != "good" {
+		t.Fatalf("expected checksum mismatch to fall back, got %q, %v", got.Value, err)
+	}
+}
+
+func TestReadStateFileMissingAndCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	var got journalTestState
+	if err := readStateFile(filepath.Join(dir, "missing.json"), &got); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist, got %v", err)
+	}
+
+	path := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(path, []byte(`{"value":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := readStateFile(path, &got); !errors.Is(err, errStateCorrupt) {
+		t.Fatalf("expected errStateCorrupt, got %v", err)
+	}
+}
+
+func TestReadStateFileAcceptsLegacyJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.json")
+	if err := os.WriteFile(path, []byte(`{"value":"legacy"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var got journalTestState
+	if err := readStateFile(path, &got); err != nil || got.Value != "legacy" {
+		t.Fatalf("expected legacy state, got %q, %v", got.Value, err)
+	}
+}
+
+func TestLoadPersistedState(t *testing.T) {
+	dir := t.TempDir()
+	originalStatus, originalCache := syncStatusFilePath, manifestCacheFilePath
+	syncStatusFilePath = filepath.Join(dir, "sync-status.json")
+	manifestCacheFilePath = filepath.Join(dir, "manifest-cache.json")
+	originalSyncStatus := GetSyncStatus()
+	t.Cleanup(func() {
+		syncStatusLock.Lock()
+		syncStatus = originalSyncStatus
+		syncStatusLock.Unlock()
+		setAppliedManifestValidators(Config{}, manifestValidators{})
+		statePersists.Wait()
+		syncStatusFilePath, manifestCacheFilePath = originalStatus, originalCache
+	})
+
+	config := Config{CoreAPIBase: "http://core", Playlist: PlaylistConfig{Destination: dir}}
+	status := SyncStatus{LastSyncTime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), OK: true}
+	if err := writeStateFile(syncStatusFilePath, status); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStateFile(manifestCacheFilePath, persistedManifestCache{Key: manifestCacheKey(config), ETag: `"v1"`}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(syncStatusFilePath, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	LoadPersistedState()
+
+	// The only generation of the status is corrupt: it is ignored.
+	if got := GetSyncStatus(); got.LastSyncTime.Equal(status.LastSyncTime) {
+		t.Errorf("expected corrupt sync status to be ignored, got %+v", got)
+	}
+	if got := getAppliedManifestValidators(config); got.ETag != `"v1"` {
+		t.Errorf("manifest cache ETag = %q, want \"v1\"", got.ETag)
+	}
+
+	if err := writeStateFile(syncStatusFilePath, status); err != nil {
+		t.Fatal(err)
+	}
+	LoadPersistedState()
+	if got := GetSyncStatus(); !got.LastSyncTime.Equal(status.LastSyncTime) || !got.OK {
+		t.Errorf("sync status = %+v, want %+v", got, status)
+	}
+}
+
+// rootStatePaths moves every rooted path under a temporary state root, as
+// SetStateRoot does, and restores them after the test.
+func rootStatePaths(t *testing.T) string {
+	t.Helper()
+	// Cleanups run last first: the paths are restored before the root is
+	// removed.
+	root := t.TempDir()
+	saved := make([]string, len(rootedPaths))
+	for i, path := range rootedPaths {
+		saved[i] = *path
+	}
+	t.Cleanup(func() {
+		statePersists.Wait()
+		for i, path := range rootedPaths {
+			*path = saved[i]
+		}
+	})
+	statePersists.Wait()
+	for _, path := range rootedPaths {
+		*path = filepath.Join(root, *path)
+	}
+	return root
+}
+
+// garbageNextTo writes files at paths and returns what sync garbage
+// collection of the default media directory would remove.
+func garbageNextTo(t *testing.T, paths ...string) []string {
+	t.Helper()
+	for _, path := range paths {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	syncer := fileSyncerFor(Config{Playlist: PlaylistConfig{Destination: DefaultMediaDir}}, nil)
+	_, garbage, _, _ := syncer.collectGarbage()
+	var files []string
+	for _, dir := range garbage {
+		files = append(files, dir...)
+	}
+	return files
+}
+
+func TestGarbageCollectionKeepsAgentState(t *testing.T) {
+	rootStatePaths(t)
+	var paths []string
+	for _, path := range agentStateFiles {
+		paths = append(paths, *path, *path+stateBackupExt)
+	}
+	media := filepath.Join(DefaultMediaDir, "stale.mp4")
+	garbage := garbageNextTo(t, append(paths, media)...)
+	if len(garbage) != 1 || garbage[0] != media {
+		t.Fatalf("garbage = %v, want only %s", garbage, media)
+	}
+}
+
+func TestMigrateLegacyState(t *testing.T) {
+	rootStatePaths(t)
+	legacy := filepath.Join(legacyStateDir, "sync-pause.json")
+	kept := filepath.Join(legacyStateDir, "calendar.json")
+	for _, path := range []string{legacy, kept} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeStateFile(path, journalTestState{Value: "legacy"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeStateFile(calendarStateFilePath, journalTestState{Value: "current"}); err != nil {
+		t.Fatal(err)
+	}
+
+	MigrateLegacyState()
+
+	var got journalTestState
+	if err := readStateFile(syncPauseStateFilePath, &got); err != nil || got.Value != "legacy" {
+		t.Fatalf("migrated state = %q, %v", got.Value, err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Fatalf("legacy file must be moved, stat err = %v", err)
+	}
+	if err := readStateFile(calendarStateFilePath, &got); err != nil || got.Value != "current" {
+		t.Fatalf("a newer state file must not be replaced, got %q, %v", got.Value, err)
+	}
+}
@@ -0,0 +1,730 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// StorageConfig describes the storage that backs the media directory.
+// When MountPoint is set, media sync refuses to write unless it is mounted,
+// so a detached USB drive never silently fills the SD card.
+type StorageConfig struct {
+	MountPoint string `yaml:"mount_point,omitempty"`
+	// Videos, Images, Playlists and Web store manifest files of one content
+	// type in their own directory; see mediaKindDir.
+	Videos    MediaDirConfig `yaml:"videos,omitempty"`
+	Images    MediaDirConfig `yaml:"images,omitempty"`
+	Playlists MediaDirConfig `yaml:"playlists,omitempty"`
+	Web       MediaDirConfig `yaml:"web,omitempty"`
+	// Network lists the network shares managed through
+	// /api/storage/network.
+	Network []NetworkMountConfig `yaml:"network,omitempty"`
+}
+
+// Configurable system paths. Tests may override these to point to
+// temporary locations.
+var (
+	MountsPath     = "/proc/mounts"
+	FstabPath      = "/etc/fstab"
+	SystemdUnitDir = "/etc/systemd/system"
+)
+
+// storageMountRoots are the only places where mounts may be generated.
+var storageMountRoots = []string{"/mnt/", "/media/"}
+
+// storageFilesystems lists filesystem types accepted for generated mounts.
+var storageFilesystems = map[string]struct{}{
+	"ext4": {}, "ext3": {}, "ext2": {}, "btrfs": {}, "xfs": {}, "f2fs": {},
+	"vfat": {}, "exfat": {}, "ntfs": {}, "ntfs3": {},
+}
+
+const storageMountOptions = "defaults,nofail,noatime"
+
+// fstabMarker tags fstab lines written by the agent.
+const fstabMarker = "# media-pi storage"
+
+// mountEntry is a single line of /proc/mounts.
+type mountEntry struct {
+	Device     string
+	MountPoint string
+	FSType     string
+}
+
+// StorageDevice describes a mounted block device filesystem.
+type StorageDevice struct {
+	Device     string `json:"device"`
+	MountPoint string `json:"mountPoint"`
+	FSType     string `json:"fsType"`
+	TotalBytes uint64 `json:"totalBytes"`
+	FreeBytes  uint64 `json:"freeBytes"`
+	Current    bool   `json:"current"`
+}
+
+// StorageStatusResponse is returned by GET /api/storage.
+type StorageStatusResponse struct {
+	MediaDir   string          `json:"mediaDir"`
+	MountPoint string          `json:"mountPoint,omitempty"`
+	Mounted    bool            `json:"mounted"`
+	Devices    []StorageDevice `json:"devices"`
+	// Directories reports the directory of each content type.
+	Directories []MediaDirStatus `json:"directories"`
+}
+
+// StorageMountRequest is the body of POST /api/storage/mount.
+type StorageMountRequest struct {
+	Device     string `json:"device"`
+	MountPoint string `json:"mountPoint"`
+	FSType     string `json:"fsType"`
+	Mode       string `json:"mode,omitempty"` // "systemd" (default) or "fstab"
+}
+
+// StorageMountResponse reports the generated mount configuration.
+type StorageMountResponse struct {
+	Mode      string `json:"mode"`
+	Unit      string `json:"unit,omitempty"`
+	FstabLine string `json:"fstabLine,omitempty"`
+	Mounted   bool   `json:"mounted"`
+}
+
+// StorageMigrateRequest is the body of POST /api/storage/migrate.
+type StorageMigrateRequest struct {
+	Destination  string `json:"destination"`
+	MountPoint   string `json:"mountPoint,omitempty"`
+	RemoveSource bool   `json:"removeSource,omitempty"`
+}
+
+// StorageMigrationStatus reports progress of a media directory migration.
+type StorageMigrationStatus struct {
+	State       string    `json:"state"` // idle, running, succeeded, failed
+	Source      string    `json:"source,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	TotalFiles  int       `json:"totalFiles"`
+	CopiedFiles int       `json:"copiedFiles"`
+	TotalBytes  int64     `json:"totalBytes"`
+	CopiedBytes int64     `json:"copiedBytes"`
+	StartedAt   time.Time `json:"startedAt,omitempty"`
+	FinishedAt  time.Time `json:"finishedAt,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+var (
+	storageMigration     = StorageMigrationStatus{State: "idle"}
+	storageMigrationLock sync.RWMutex
+)
+
+// mediaDirFor returns the media directory for config, matching syncFiles.
+func mediaDirFor(config Config) string {
+	mediaDir := config.Playlist.Destination
+	if mediaDir == "" || mediaDir == "." {
+		mediaDir = DefaultMediaDir
+	}
+	return mediaDir
+}
+
+// unescapeMountField decodes the octal escapes used in /proc/mounts.
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func readMounts() ([]mountEntry, error) {
+	data, err := os.ReadFile(MountsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mounts: %w", err)
+	}
+	var mounts []mountEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		mounts = append(mounts, mountEntry{
+			Device:     unescapeMountField(fields[0]),
+			MountPoint: unescapeMountField(fields[1]),
+			FSType:     fields[2],
+		})
+	}
+	return mounts, nil
+}
+
+// isMounted reports whether mountPoint is an active mount.
+func isMounted(mountPoint string) (bool, error) {
+	mounts, err := readMounts()
+	if err != nil {
+		return false, err
+	}
+	clean := filepath.Clean(mountPoint)
+	for _, m := range mounts {
+		if m.MountPoint == clean {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// pathWithin reports whether path is dir or lies below it.
+func pathWithin(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	if path == dir || dir == "/" {
+		return true
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// checkMediaStorage fails when the configured storage mount is missing.
+func checkMediaStorage(config Config) error {
+	mountPoint := strings.TrimSpace(config.Storage.MountPoint)
+	if mountPoint == "" {
+		return nil
+	}
+	mounted, err := isMounted(mountPoint)
+	if err != nil {
+		return err
+	}
+	if !mounted {
+		return fmt.Errorf("media storage %s is not mounted", mountPoint)
+	}
+	return nil
+}
+
+func listStorageDevices(mediaDir string) ([]StorageDevice, error) {
+	mounts, err := readMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	// The device holding the media directory is the longest matching mount.
+	current := ""
+	for _, m := range mounts {
+		if pathWithin(mediaDir, m.MountPoint) && len(m.MountPoint) > len(current) {
+			current = m.MountPoint
+		}
+	}
+
+	devices := []StorageDevice{}
+	for _, m := range mounts {
+		if !strings.HasPrefix(m.Device, "/dev/") {
+			continue
+		}
+		device := StorageDevice{
+			Device:     m.Device,
+			MountPoint: m.MountPoint,
+			FSType:     m.FSType,
+			Current:    m.MountPoint == current,
+		}
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(m.MountPoint, &st); err == nil {
+			device.TotalBytes = st.Blocks * uint64(st.Bsize)
+			device.FreeBytes = st.Bavail * uint64(st.Bsize)
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+// systemdEscapePath converts an absolute path to a systemd unit name
+// prefix, as done by `systemd-escape --path`.
+func systemdEscapePath(path string) string {
+	path = strings.Trim(filepath.Clean(path), "/")
+	if path == "" {
+		return "-"
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '/':
+			b.WriteByte('-')
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == ':':
+			b.WriteByte(c)
+		case c == '.' && i > 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
+
+// validateMountPoint accepts clean paths below storageMountRoots.
+func validateMountPoint(mountPoint string) error {
+	if mountPoint == "" || filepath.Clean(mountPoint) != mountPoint || strings.ContainsAny(mountPoint, " \t\n#\\") {
+		return fmt.Errorf("недопустимый путь mountPoint")
+	}
+	for _, root := range storageMountRoots {
+		if strings.HasPrefix(mountPoint, root) && len(mountPoint) > len(root) {
+			return nil
+		}
+	}
+	return fmt.Errorf("mountPoint должен находиться в /mnt или /media")
+}
+
+func validateStorageMountRequest(req StorageMountRequest) error {
+	device := strings.TrimSpace(req.Device)
+	switch {
+	case device == "":
+		return fmt.Errorf("поле device обязательно")
+	case strings.ContainsAny(device, " \t\n#"):
+		return fmt.Errorf("недопустимое значение device")
+	case !strings.HasPrefix(device, "/dev/") && !strings.HasPrefix(device, "UUID=") &&
+		!strings.HasPrefix(device, "LABEL=") && !strings.HasPrefix(device, "PARTUUID="):
+		return fmt.Errorf("device должен быть путём /dev/... или UUID=, LABEL=, PARTUUID=")
+	}
+
+	if err := validateMountPoint(req.MountPoint); err != nil {
+		return err
+	}
+
+	if _, ok := storageFilesystems[req.FSType]; !ok {
+		return fmt.Errorf("неподдерживаемая файловая система: %s", req.FSType)
+	}
+	return nil
+}
+
+func renderMountUnit(req StorageMountRequest) string {
+	return fmt.Sprintf(`[Unit]
+Description=Media Pi media storage (%s)
+Before=media-pi-agent.service
+
+[Mount]
+What=%s
+Where=%s
+Type=%s
+Options=%s
+
+[Install]
+WantedBy=multi-user.target
+`, req.MountPoint, req.Device, req.MountPoint, req.FSType, storageMountOptions)
+}
+
+// writeMountUnit creates the systemd mount unit and returns its name.
+func writeMountUnit(req StorageMountRequest) (string, error) {
+	unit := systemdEscapePath(req.MountPoint) + ".mount"
+	path := filepath.Join(SystemdUnitDir, unit)
+	if err := writeSystemFile(path, renderMountUnit(req)); err != nil {
+		return "", fmt.Errorf("failed to write mount unit: %w", err)
+	}
+	return unit, nil
+}
+
+// writeFstabEntry replaces any agent-managed entry for the mount point and
+// returns the line written.
+func writeFstabEntry(req StorageMountRequest) (string, error) {
+	line := fmt.Sprintf("%s %s %s %s 0 2 %s", req.Device, req.MountPoint, req.FSType, storageMountOptions, fstabMarker)
+
+	data, err := os.ReadFile(FstabPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read fstab: %w", err)
+	}
+
+	var lines []string
+	for _, existing := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		fields := strings.Fields(existing)
+		if len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") && fields[1] == req.MountPoint {
+			if !strings.Contains(existing, fstabMarker) {
+				return "", fmt.Errorf("fstab already contains an entry for %s", req.MountPoint)
+			}
+			continue
+		}
+		if existing != "" || len(lines) > 0 {
+			lines = append(lines, existing)
+		}
+	}
+	lines = append(lines, line)
+
+	tmpPath := FstabPath + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write fstab: %w", err)
+	}
+	if err := os.Rename(tmpPath, FstabPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to rename fstab: %w", err)
+	}
+	return line, nil
+}
+
+// activateMountUnit reloads systemd, then enables and starts unit.
+func activateMountUnit(parent context.Context, unit string, enable bool) error {
+	connCtx, cancelConn := context.WithTimeout(parent, dbusTimeout())
+	defer cancelConn()
+	conn, err := getDBusConnection(connCtx)
+	if err != nil {
+		return fmt.Errorf("connect to D-Bus: %w", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(parent, dbusTimeout())
+	defer cancel()
+	if err := conn.ReloadContext(ctx); err != nil {
+		return fmt.Errorf("daemon reload: %w", err)
+	}
+	if enable {
+		if _, _, err := conn.EnableUnitFilesContext(ctx, []string{unit}, false, true); err != nil {
+			return fmt.Errorf("enable %s: %w", unit, err)
+		}
+	}
+	if _, err := conn.StartUnitContext(ctx, unit, "replace", nil); err != nil {
+		return fmt.Errorf("start %s: %w", unit, err)
+	}
+	return nil
+}
+
+func getStorageMigrationStatus() StorageMigrationStatus {
+	storageMigrationLock.RLock()
+	defer storageMigrationLock.RUnlock()
+	return storageMigration
+}
+
+func updateStorageMigration(update func(*StorageMigrationStatus)) {
+	storageMigrationLock.Lock()
+	defer storageMigrationLock.Unlock()
+	update(&storageMigration)
+}
+
+// updateMediaStorage switches the media directory and storage mount in the
+// current configuration and saves it.
+func updateMediaStorage(destination, mountPoint string) error {
+	configMutex.Lock()
+	defer configMutex.Unlock()
+
+	if currentConfig == nil {
+		return fmt.Errorf("configuration not loaded")
+	}
+	currentConfig.Playlist.Destination = destination
+	currentConfig.Storage.MountPoint = mountPoint
+
+	return saveCurrentConfig("storage")
+}
+
+// migrationFiles lists regular files to move, relative to source. The
+// content store is skipped: its entries are links of the named files and are
+// rebuilt by the next sync. The trash stays behind with the old storage.
+func migrationFiles(source string) ([]string, int64, error) {
+	var files []string
+	var total int64
+	err := filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == contentStoreDir(source) || path == trashDir(source) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || filepath.Ext(path) == ".tmp" {
+			return nil
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		total += info.Size()
+		return nil
+	})
+	return files, total, err
+}
+
+// copyFileAtomic copies src to dest through a temp file, reporting copied
+// bytes to progress.
+func copyFileAtomic(ctx context.Context, src, dest string, progress func(int64)) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmpPath := dest + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = out.Close()
+		_ = os.Remove(tmpPath)
+	}()
+
+	buf := make([]byte, 1<<20)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, rerr := in.Read(buf)
+		if n > 0 {
+			if _, werr := out.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			progress(int64(n))
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, dest)
+}
+
+// migrateMediaDir copies every media file from source to destination,
+// switches the configuration and optionally removes the source files.
+func migrateMediaDir(ctx context.Context, source, destination, mountPoint string, removeSource bool) (err error) {
+	defer func() {
+		updateStorageMigration(func(s *StorageMigrationStatus) {
+			s.FinishedAt = time.Now()
+			if err != nil {
+				s.State = "failed"
+				s.Error = err.Error()
+				return
+			}
+			s.State = "succeeded"
+		})
+		if err != nil {
+			log.Printf("Media storage migration failed: %v", err)
+			return
+		}
+		log.Printf("Media storage migrated from %s to %s", source, destination)
+	}()
+
+	files, total, err := migrationFiles(source)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to list media files: %w", err)
+	}
+	updateStorageMigration(func(s *StorageMigrationStatus) {
+		s.TotalFiles = len(files)
+		s.TotalBytes = total
+	})
+
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return fmt.Errorf("failed to create destination: %w", err)
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(destination, &st); err == nil && uint64(total) > st.Bavail*uint64(st.Bsize) {
+		return fmt.Errorf("not enough free space on destination: need %d bytes", total)
+	}
+
+	for _, rel := range files {
+		progress := func(n int64) {
+			updateStorageMigration(func(s *StorageMigrationStatus) { s.CopiedBytes += n })
+		}
+		if err := copyFileAtomic(ctx, filepath.Join(source, rel), filepath.Join(destination, rel), progress); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", rel, err)
+		}
+		updateStorageMigration(func(s *StorageMigrationStatus) { s.CopiedFiles++ })
+	}
+
+	if err := updateMediaStorage(destination, mountPoint); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+	// Files now live elsewhere; the next sync must verify them again.
+	setAppliedManifestValidators(GetCurrentConfig(), manifestValidators{})
+
+	if removeSource {
+		for _, rel := range files {
+			if err := os.Remove(filepath.Join(source, rel)); err != nil {
+				log.Printf("Warning: failed to remove migrated file %s: %v", rel, err)
+			}
+		}
+		_ = os.RemoveAll(contentStoreDir(source))
+	}
+	return nil
+}
+
+// StartStorageMigration validates the destination and starts copying the
+// media directory there in the background. Any running sync is cancelled.
+func StartStorageMigration(req StorageMigrateRequest) error {
+	destination := req.Destination
+	if destination == "" || !filepath.IsAbs(destination) || filepath.Clean(destination) != destination {
+		return fmt.Errorf("недопустимый путь destination")
+	}
+	mountPoint := req.MountPoint
+	if mountPoint != "" {
+		if !filepath.IsAbs(mountPoint) || filepath.Clean(mountPoint) != mountPoint || !pathWithin(destination, mountPoint) {
+			return fmt.Errorf("destination должен находиться внутри mountPoint")
+		}
+		mounted, err := isMounted(mountPoint)
+		if err != nil {
+			return err
+		}
+		if !mounted {
+			return fmt.Errorf("%s не смонтирован", mountPoint)
+		}
+	}
+
+	source := mediaDirFor(GetCurrentConfig())
+	if pathWithin(destination, source) || pathWithin(source, destination) {
+		return fmt.Errorf("destination не может совпадать с текущим каталогом медиафайлов или содержать его")
+	}
+
+	storageMigrationLock.Lock()
+	if storageMigration.State == "running" {
+		storageMigrationLock.Unlock()
+		return fmt.Errorf("перенос уже выполняется")
+	}
+	storageMigration = StorageMigrationStatus{
+		State:       "running",
+		Source:      source,
+		Destination: destination,
+		StartedAt:   time.Now(),
+	}
+	storageMigrationLock.Unlock()
+
+	syncLock.Lock()
+	if syncCancel != nil {
+		syncCancel()
+	}
+	syncContext, syncCancel = context.WithCancel(context.Background())
+	ctx := syncContext
+	syncLock.Unlock()
+
+	go func() {
+		setVideoSyncRunning(true)
+		defer setVideoSyncRunning(false)
+		_ = migrateMediaDir(ctx, source, destination, mountPoint, req.RemoveSource)
+	}()
+	return nil
+}
+
+// HandleStorageStatus lists mounted storage and the media directory state.
+func HandleStorageStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	config := GetCurrentConfig()
+	mediaDir := mediaDirFor(config)
+	devices, err := listStorageDevices(mediaDir)
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось получить список устройств: %v", err)})
+		return
+	}
+
+	resp := StorageStatusResponse{
+		MediaDir:   mediaDir,
+		MountPoint: config.Storage.MountPoint,
+		Mounted:    checkMediaStorage(config) == nil,
+		Devices:    devices,
+
+		Directories: mediaDirStatuses(config),
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: resp})
+}
+
+// HandleStorageMount generates a systemd mount unit (or an fstab entry) for
+// an external drive and mounts it.
+func HandleStorageMount(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req StorageMountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный JSON в теле запроса"})
+		return
+	}
+	req.Device = strings.TrimSpace(req.Device)
+	req.FSType = strings.TrimSpace(req.FSType)
+	if err := validateStorageMountRequest(req); err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: err.Error()})
+		return
+	}
+	if err := os.MkdirAll(req.MountPoint, 0755); err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось создать точку монтирования: %v", err)})
+		return
+	}
+
+	resp := StorageMountResponse{Mode: req.Mode, Unit: systemdEscapePath(req.MountPoint) + ".mount"}
+	var err error
+	switch req.Mode {
+	case "", "systemd":
+		resp.Mode = "systemd"
+		if _, err = writeMountUnit(req); err == nil {
+			err = activateMountUnit(r.Context(), resp.Unit, true)
+		}
+	case "fstab":
+		// systemd-fstab-generator turns the entry into the same mount unit.
+		if resp.FstabLine, err = writeFstabEntry(req); err == nil {
+			err = activateMountUnit(r.Context(), resp.Unit, false)
+		}
+	default:
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Поле mode должно быть systemd или fstab"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to configure storage mount %s: %v", req.MountPoint, err)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось настроить монтирование: %v", err)})
+		return
+	}
+
+	resp.Mounted, _ = isMounted(req.MountPoint)
+	log.Printf("Configured storage mount %s (%s)", req.MountPoint, resp.Mode)
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: resp})
+}
+
+// HandleStorageMigrate starts moving the media directory to new storage.
+func HandleStorageMigrate(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req StorageMigrateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный JSON в теле запроса"})
+		return
+	}
+	if err := StartStorageMigration(req); err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: err.Error()})
+		return
+	}
+
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getStorageMigrationStatus()})
+}
+
+// HandleStorageMigrateStatus reports progress of the last migration.
+func HandleStorageMigrateStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getStorageMigrationStatus()})
+}
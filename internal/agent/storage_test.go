@@ -0,0 +1,211 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setMountsForTest(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mounts")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	original := MountsPath
+	MountsPath = path
+	t.Cleanup(func() { MountsPath = original })
+}
+
+func TestSystemdEscapePath(t *testing.T) {
+	tests := map[string]string{
+		"/mnt/usb":       "mnt-usb",
+		"/mnt/ya.disk":   "mnt-ya.disk",
+		"/media/my-disk": `media-my\x2ddisk`,
+		"/mnt/a b":       `mnt-a\x20b`,
+	}
+	for path, want := range tests {
+		if got := systemdEscapePath(path); got != want {
+			t.Errorf("systemdEscapePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestReadMountsUnescapesFields(t *testing.T) {
+	setMountsForTest(t, "/dev/sda1 /media/My\\040Disk vfat rw 0 0\n/dev/root / ext4 rw 0 0\n")
+	mounted, err := isMounted("/media/My Disk")
+	if err != nil || !mounted {
+		t.Fatalf("expected escaped mount point to be found, got %v %v", mounted, err)
+	}
+	if mounted, _ := isMounted("/mnt/usb"); mounted {
+		t.Fatal("unexpected mount reported")
+	}
+}
+
+func TestSyncFilesRefusesMissingStorageMount(t *testing.T) {
+	setMountsForTest(t, "/dev/root / ext4 rw 0 0\n")
+	mediaDir := filepath.Join(t.TempDir(), "media")
+	config := Config{Playlist: PlaylistConfig{Destination: mediaDir}, Storage: StorageConfig{MountPoint: "/mnt/usb"}}
+
+	err := syncFiles(context.Background(), config, &Manifest{})
+	if err == nil || !strings.Contains(err.Error(), "not mounted") {
+		t.Fatalf("expected not mounted error, got %v", err)
+	}
+	if _, err := os.Stat(mediaDir); !os.IsNotExist(err) {
+		t.Fatalf("expected media dir not to be created, stat err = %v", err)
+	}
+}
+
+func TestValidateStorageMountRequest(t *testing.T) {
+	valid := StorageMountRequest{Device: "UUID=1234-ABCD", MountPoint: "/mnt/media", FSType: "exfat"}
+	if err := validateStorageMountRequest(valid); err != nil {
+		t.Fatalf("expected valid request, got %v", err)
+	}
+
+	invalid := []StorageMountRequest{
+		{Device: "", MountPoint: "/mnt/media", FSType: "ext4"},
+		{Device: "sda1", MountPoint: "/mnt/media", FSType: "ext4"},
+		{Device: "/dev/sda1 rw", MountPoint: "/mnt/media", FSType: "ext4"},
+		{Device: "/dev/sda1", MountPoint: "/etc", FSType: "ext4"},
+		{Device: "/dev/sda1", MountPoint: "/mnt/", FSType: "ext4"},
+		{Device: "/dev/sda1", MountPoint: "/mnt/../etc", FSType: "ext4"},
+		{Device: "/dev/sda1", MountPoint: "/mnt/media", FSType: "nfs"},
+	}
+	for _, req := range invalid {
+		if err := validateStorageMountRequest(req); err == nil {
+			t.Errorf("expected %+v to be rejected", req)
+		}
+	}
+}
+
+func TestWriteMountUnit(t *testing.T) {
+	original := SystemdUnitDir
+	SystemdUnitDir = t.TempDir()
+	t.Cleanup(func() { SystemdUnitDir = original })
+
+	unit, err := writeMountUnit(StorageMountRequest{Device: "/dev/sda1", MountPoint: "/mnt/media", FSType: "ext4"})
+	if err != nil {
+		t.Fatalf("writeMountUnit() error = %v", err)
+	}
+	if unit != "mnt-media.mount" {
+		t.Fatalf("unexpected unit name %q", unit)
+	}
+	data, err := os.ReadFile(filepath.Join(SystemdUnitDir, unit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"What=/dev/sda1", "Where=/mnt/media", "Type=ext4", "Options=" + storageMountOptions} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("mount unit missing %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestWriteFstabEntryReplacesOwnLine(t *testing.T) {
+	original := FstabPath
+	FstabPath = filepath.Join(t.TempDir(), "fstab")
+	t.Cleanup(func() { FstabPath = original })
+	if err := os.WriteFile(FstabPath, []byte("proc /proc proc defaults 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req := StorageMountRequest{Device: "/dev/sda1", MountPoint: "/mnt/media", FSType: "ext4"}
+	if _, err := writeFstabEntry(req); err != nil {
+		t.Fatalf("first writeFstabEntry() error = %v", err)
+	}
+	req.Device = "UUID=abcd"
+	line, err := writeFstabEntry(req)
+	if err != nil {
+		t.Fatalf("second writeFstabEntry() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(FstabPath)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || lines[0] != "proc /proc proc defaults 0 0" || lines[1] != line {
+		t.Fatalf("unexpected fstab:\n%s", data)
+	}
+
+	if err := os.WriteFile(FstabPath, []byte("/dev/sdb1 /mnt/media ext4 defaults 0 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeFstabEntry(req); err == nil {
+		t.Fatal("expected foreign fstab entry to be preserved and reported")
+	}
+}
+
+func TestStorageMigrationCopiesFilesAndSwitchesConfig(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "media")
+	destination := filepath.Join(t.TempDir(), "ssd", "media")
+	for name, content := range map[string]string{"a.mp4": "aaa", "sub/b.mp4": "bb", "playlist.m3u": "a.mp4\n"} {
+		path := filepath.Join(source, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configPath := filepath.Join(t.TempDir(), "agent.yaml")
+	originalPath := ConfigPath
+	ConfigPath = configPath
+	t.Cleanup(func() { ConfigPath = originalPath })
+	setCurrentConfigForTest(t, Config{ServerKey: "key", Playlist: PlaylistConfig{Destination: source}})
+	t.Cleanup(func() {
+		storageMigrationLock.Lock()
+		storageMigration = StorageMigrationStatus{State: "idle"}
+		storageMigrationLock.Unlock()
+	})
+
+	if err := StartStorageMigration(StorageMigrateRequest{Destination: destination, RemoveSource: true}); err != nil {
+		t.Fatalf("StartStorageMigration() error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for getStorageMigrationStatus().State == "running" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := getStorageMigrationStatus()
+	if status.State != "succeeded" {
+		t.Fatalf("expected succeeded migration, got %+v", status)
+	}
+	if status.TotalFiles != 3 || status.CopiedFiles != 3 || status.CopiedBytes != status.TotalBytes {
+		t.Fatalf("unexpected progress %+v", status)
+	}
+	if data, err := os.ReadFile(filepath.Join(destination, "sub", "b.mp4")); err != nil || string(data) != "bb" {
+		t.Fatalf("file not migrated: %v %q", err, data)
+	}
+	if _, err := os.Stat(filepath.Join(source, "a.mp4")); !os.IsNotExist(err) {
+		t.Fatalf("expected source file to be removed, stat err = %v", err)
+	}
+	if got := GetCurrentConfig().Playlist.Destination; got != destination {
+		t.Fatalf("config destination = %q, want %q", got, destination)
+	}
+	saved, err := os.ReadFile(configPath)
+	if err != nil || !strings.Contains(string(saved), destination) {
+		t.Fatalf("expected saved config to reference destination: %v\n%s", err, saved)
+	}
+}
+
+func TestStartStorageMigrationValidatesDestination(t *testing.T) {
+	setMountsForTest(t, "/dev/root / ext4 rw 0 0\n")
+	source := t.TempDir()
+	setCurrentConfigForTest(t, Config{Playlist: PlaylistConfig{Destination: source}})
+
+	for _, req := range []StorageMigrateRequest{
+		{Destination: "relative/path"},
+		{Destination: filepath.Join(source, "nested")},
+		{Destination: "/mnt/usb/media", MountPoint: "/mnt/usb"},
+		{Destination: "/srv/media", MountPoint: "/mnt/usb"},
+	} {
+		if err := StartStorageMigration(req); err == nil {
+			t.Errorf("expected %+v to be rejected", req)
+		}
+	}
+}
@@ -5,29 +5,30 @@ package agent
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/robfig/cron/v3"
 )
 
 var (
-	syncStatusFilePath   = "/var/media-pi/sync/sync-status.json"
+	syncStatusFilePath   = filepath.Join(agentStateDir, "sync-status.json")
 	runScreenshotCapture = captureScreenshot
 	runScreenshotCommand = func(inputPath, outputPath string) error {
 		ffmpegPath, err := resolveFFmpegPath()
@@ -70,6 +71,19 @@ type ManifestItem struct {
 	Filename      string `json:"filename"`
 	FileSizeBytes int64  `json:"fileSizeBytes"`
 	SHA256        string `json:"sha256"`
+	// HashAlgorithm and Hash optionally give the digest in another
+	// algorithm (sha512, blake3); see newItemVerifier.
+	HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+	Hash          string `json:"hash,omitempty"`
+	// Priority and Order are optional download ordering hints: higher
+	// priority first, then ascending order.
+	Priority int `json:"priority,omitempty"`
+	Order    int `json:"order,omitempty"`
+	// Tags lists the groups an item belongs to; see sync.tags.
+	Tags []string `json:"tags,omitempty"`
+	// Type is the content type (video, image, playlist or web) that picks
+	// the storage directory; without it the type follows the extension.
+	Type string `json:"type,omitempty"`
 }
 
 // Manifest represents the response from /api/devicesync endpoint.
@@ -79,9 +93,15 @@ type Manifest []ManifestItem
 
 // SyncStatus represents the last sync operation status.
 type SyncStatus struct {
+	// SessionID identifies the sync run; see newSyncSessionID.
+	SessionID    string    `json:"sessionId,omitempty"`
 	LastSyncTime time.Time `json:"lastSyncTime"`
 	OK           bool      `json:"ok"`
+	Canceled     bool      `json:"canceled,omitempty"`
 	Error        string    `json:"error,omitempty"`
+	// Quarantined lists the items sync skips after repeated verification
+	// failures.
+	Quarantined []DownloadFailure `json:"quarantined,omitempty"`
 }
 
 var (
@@ -97,13 +117,12 @@ var (
 	// syncReloadChan is used to signal the scheduler to reload the schedule
 	syncReloadChan chan struct{}
 
-	// scheduledSyncCallback is called after a successful scheduled sync
-	scheduledSyncCallback     func() error
-	scheduledSyncCallbackLock sync.RWMutex
-
 	// cronScheduler manages scheduled sync operations
 	cronScheduler     *cron.Cron
 	cronSchedulerLock sync.Mutex
+	// cronJobs lists the entries added to cronScheduler, guarded by
+	// cronSchedulerLock.
+	cronJobs []cronJob
 
 	// Tracking for running sync processes
 	videoSyncRunning        bool
@@ -232,65 +251,156 @@ func startPlaylistSyncRunning() func() {
 
 // setSyncStatus updates the sync status in memory and optionally persists to file.
 func setSyncStatus(status SyncStatus) {
+	status.Quarantined = quarantinedDownloads()
 	syncStatusLock.Lock()
 	syncStatus = status
 	syncStatusLock.Unlock()
 
 	// Try to persist to file (best effort)
-	go func() {
-		data, err := json.Marshal(status)
-		if err != nil {
-			log.Printf("Warning: Failed to marshal sync status: %v", err)
-			return
-		}
+	statePersists.Go(persistSyncStatus)
+}
 
-		dir := filepath.Dir(syncStatusFilePath)
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			log.Printf("Warning: Failed to create sync status directory: %v", err)
-			return
-		}
+// manifestValidators holds the cache validators returned with the last
+// manifest that was fully applied to the media directory.
+type manifestValidators struct {
+	ETag         string
+	LastModified string
+	// ForceDelete is not a validator: it carries the force flag of the
+	// response to the deletion guard and is cleared before caching.
+	ForceDelete bool
+}
 
-		tmpPath := syncStatusFilePath + ".tmp"
-		if err := os.WriteFile(tmpPath, data, 0644); err != nil {
-			log.Printf("Warning: Failed to write sync status: %v", err)
-			return
-		}
-		if err := os.Rename(tmpPath, syncStatusFilePath); err != nil {
-			_ = os.Remove(tmpPath)
-			log.Printf("Warning: Failed to rename sync status file: %v", err)
+// errManifestNotModified is returned by fetchManifestConditional when the
+// core answers 304 Not Modified.
+var errManifestNotModified = errors.New("manifest not modified")
+
+var (
+	// appliedManifest remembers the validators of the last successfully
+	// synced manifest together with the source and item selection they
+	// belong to, so a change of core_api_base, sync.tags or media
+	// directories forces a full pass.
+	appliedManifestKey        string
+	appliedManifestValidators manifestValidators
+	// appliedManifestPassAt is when the validators were last stored by a
+	// full pass. It is not persisted, so the first sync after startup
+	// verifies the files again.
+	appliedManifestPassAt time.Time
+	appliedManifestLock   sync.Mutex
+)
+
+func manifestCacheKey(config Config) string {
+	key := config.CoreAPIBase
+	if source, err := newSyncSource(config); err == nil {
+		key = source.Key()
+	}
+	key += "|" + config.Playlist.Destination
+	// sync.tags and storage media directories decide which items are
+	// admitted and where they go, so validators of a manifest applied
+	// under other values must not skip the file pass.
+	if tags := slices.Sorted(maps.Keys(syncTagSet(config))); len(tags) > 0 {
+		key += "|tags=" + strings.Join(tags, ",")
+	}
+	for _, kind := range mediaKinds {
+		if dir := mediaDirConfig(config, kind); strings.TrimSpace(dir.Dir) != "" || dir.QuotaMB > 0 {
+			key += fmt.Sprintf("|%s=%s:%d", kind, mediaKindDir(config, kind), max(dir.QuotaMB, 0))
 		}
-	}()
+	}
+	return key
+}
+
+func getAppliedManifestValidators(config Config) manifestValidators {
+	appliedManifestLock.Lock()
+	defer appliedManifestLock.Unlock()
+	if appliedManifestKey != manifestCacheKey(config) {
+		return manifestValidators{}
+	}
+	return appliedManifestValidators
+}
+
+func setAppliedManifestValidators(config Config, validators manifestValidators) {
+	appliedManifestLock.Lock()
+	defer appliedManifestLock.Unlock()
+	appliedManifestKey = manifestCacheKey(config)
+	appliedManifestValidators = validators
+	appliedManifestPassAt = time.Now()
+	statePersists.Go(persistAppliedManifest)
+}
+
+// syncManifestValidators returns the validators PerformSync sends. None are
+// sent once sync.full_verify_interval has passed since the last full pass,
+// so a 304 cannot postpone the periodic re-verification of local files.
+func syncManifestValidators(config Config, now time.Time) manifestValidators {
+	appliedManifestLock.Lock()
+	passAt := appliedManifestPassAt
+	appliedManifestLock.Unlock()
+	if passAt.IsZero() || now.Sub(passAt) >= fullVerifyInterval(config.Sync) {
+		return manifestValidators{}
+	}
+	return getAppliedManifestValidators(config)
 }
 
 // fetchManifest fetches the manifest from the core API.
 func fetchManifest(ctx context.Context, config Config) (*Manifest, error) {
+	manifest, _, err := fetchManifestConditional(ctx, config, manifestValidators{})
+	return manifest, err
+}
+
+// fetchManifestConditional fetches the manifest, sending the given validators
+// as If-None-Match/If-Modified-Since. It returns errManifestNotModified when
+// the core reports the manifest is unchanged, and the validators of the new
+// response otherwise.
+func fetchManifestConditional(ctx context.Context, config Config, previous manifestValidators) (*Manifest, manifestValidators, error) {
 	url := config.CoreAPIBase + "/api/devicesync"
+	if query := syncTagsQuery(config); len(query) > 0 {
+		url += "?" + query.Encode()
+	}
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, manifestValidators{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Add device authentication header
 	req.Header.Set("X-Device-Id", config.ServerKey)
+	req.Header.Set(hashAlgorithmsHeader, strings.Join(supportedHashAlgorithms, ", "))
+	if previous.ETag != "" {
+		req.Header.Set("If-None-Match", previous.ETag)
+	}
+	if previous.LastModified != "" {
+		req.Header.Set("If-Modified-Since", previous.LastModified)
+	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := getCoreClient().Do(ctx, req, manifestTimeout())
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch manifest: %w", err)
+		return nil, manifestValidators{}, fmt.Errorf("failed to fetch manifest: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, previous, errManifestNotModified
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+		return nil, manifestValidators{}, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
 	}
 
-	var manifest Manifest
-	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
-		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	body, err := sniffManifestBody(resp.Body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, manifestValidators{}, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	manifest := Manifest{}
+	if _, err := decodeManifestItems(body, func(item ManifestItem) error {
+		manifest = append(manifest, item)
+		return nil
+	}); err != nil {
+		return nil, manifestValidators{}, fmt.Errorf("failed to decode manifest: %w", err)
 	}
 
-	return &manifest, nil
+	return &manifest, manifestValidators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ForceDelete:  forceDeleteRequested(resp),
+	}, nil
 }
 
 // downloadFile downloads a file from the core API and verifies its integrity.
@@ -303,9 +413,9 @@ func downloadFile(ctx context.Context, config Config, item ManifestItem, destPat
 
 	// Add device authentication header
 	req.Header.Set("X-Device-Id", config.ServerKey)
+	req.Header.Set("Accept-Encoding", acceptedDownloadEncodings)
 
-	client := &http.Client{Timeout: 5 * time.Minute}
-	resp, err := client.Do(req)
+	resp, err := getCoreClient().Do(ctx, req, downloadTimeout())
 	if err != nil {
 		return fmt.Errorf("failed to download file: %w", err)
 	}
@@ -316,6 +426,30 @@ func downloadFile(ctx context.Context, config Config, item ManifestItem, destPat
 		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
 	}
 
+	return writeVerifiedDownload(resp, item, destPath)
+}
+
+// writeVerifiedDownload stores a successful download response at destPath.
+// The content is written to a temp file, checked against the manifest size
+// and SHA256, and only then atomically renamed into place.
+func writeVerifiedDownload(resp *http.Response, item ManifestItem, destPath string) error {
+	body, closeBody, err := decodeContentEncoding(resp)
+	if err != nil {
+		return err
+	}
+	defer closeBody()
+
+	return writeVerifiedContent(body, item, destPath)
+}
+
+// writeVerifiedContent copies body to destPath through a temp file and
+// renames it into place only when size and digest match the manifest item.
+func writeVerifiedContent(body io.Reader, item ManifestItem, destPath string) error {
+	verifier, err := newItemVerifier(item)
+	if err != nil {
+		return err
+	}
+
 	// Create temp file
 	tmpPath := destPath + ".tmp"
 	tmpFile, err := os.Create(tmpPath)
@@ -327,22 +461,22 @@ func downloadFile(ctx context.Context, config Config, item ManifestItem, destPat
 		_ = os.Remove(tmpPath)
 	}()
 
-	// Download file while computing SHA256
-	hasher := sha256.New()
-	written, err := io.Copy(io.MultiWriter(tmpFile, hasher), resp.Body)
+	// Download file while computing the digest of the decoded content. Reading
+	// one byte past the expected size is enough to detect a mismatch and keeps
+	// a malicious compressed stream from filling the disk.
+	written, err := copyWithHashBuffer(io.MultiWriter(tmpFile, verifier), io.LimitReader(body, item.FileSizeBytes+1))
 	if err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
 	// Verify file size
 	if written != item.FileSizeBytes {
-		return fmt.Errorf("file size mismatch: expected %d, got %d", item.FileSizeBytes, written)
+		return contentMismatchf("file size mismatch: expected %d, got %d", item.FileSizeBytes, written)
 	}
 
-	// Verify SHA256
-	actualHash := hex.EncodeToString(hasher.Sum(nil))
-	if actualHash != item.SHA256 {
-		return fmt.Errorf("SHA256 mismatch: expected %s, got %s", item.SHA256, actualHash)
+	// Verify digest
+	if !verifier.matches() {
+		return verifier.mismatchError()
 	}
 
 	// Close temp file before rename
@@ -358,6 +492,35 @@ func downloadFile(ctx context.Context, config Config, item ManifestItem, destPat
 	return nil
 }
 
+// acceptedDownloadEncodings is advertised on file downloads. Setting it
+// explicitly disables the transport's transparent gzip handling, so
+// decodeContentEncoding must handle every listed encoding.
+const acceptedDownloadEncodings = "zstd, gzip"
+
+// decodeContentEncoding wraps the response body in a decompressor matching
+// its Content-Encoding. The returned function releases decoder resources.
+func decodeContentEncoding(resp *http.Response) (io.Reader, func(), error) {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return resp.Body, func() {}, nil
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		return reader, func() { _ = reader.Close() }, nil
+	case "zstd":
+		decoder, err := zstd.NewReader(resp.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open zstd stream: %w", err)
+		}
+		return decoder, decoder.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
 // verifyLocalFile checks if a local file matches the manifest item.
 func verifyLocalFile(path string, item ManifestItem) (bool, error) {
 	info, err := os.Stat(path)
@@ -373,135 +536,420 @@ func verifyLocalFile(path string, item ManifestItem) (bool, error) {
 		return false, nil
 	}
 
-	// Compute SHA256
+	verifier, err := newItemVerifier(item)
+	if err != nil {
+		return false, err
+	}
 	file, err := os.Open(path)
 	if err != nil {
 		return false, err
 	}
 	defer func() { _ = file.Close() }()
 
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, file); err != nil {
+	if err := hashFile(verifier, file, info.Size(), verifyMmapEnabled()); err != nil {
 		return false, err
 	}
-
-	actualHash := hex.EncodeToString(hasher.Sum(nil))
-	return actualHash == item.SHA256, nil
+	metricAdd(metricSyncVerifiedFiles, 1)
+	metricAdd(metricSyncVerifiedBytes, float64(info.Size()))
+	return verifier.matches(), nil
 }
 
+// fetchItemFunc materializes a single manifest item at destPath. It must
+// verify size and digest before the file appears under its final name.
+type fetchItemFunc func(ctx context.Context, config Config, item ManifestItem, destPath string) error
+
 // syncFiles synchronizes files from the manifest to the local media directory.
 func syncFiles(ctx context.Context, config Config, manifest *Manifest) error {
-	// Get media directory from playlist destination (destination is a folder)
-	mediaDir := config.Playlist.Destination
-	if mediaDir == "" || mediaDir == "." {
-		mediaDir = "/var/media-pi"
-	}
+	return syncFilesFrom(ctx, config, manifest, downloadItem)
+}
 
-	// Ensure media directory exists
-	if err := os.MkdirAll(mediaDir, 0755); err != nil {
-		return fmt.Errorf("failed to create media directory: %w", err)
+// syncFilesFrom is syncFiles with a pluggable source for missing files.
+func syncFilesFrom(ctx context.Context, config Config, manifest *Manifest, fetch fetchItemFunc) error {
+	syncer, err := newFileSyncer(config, fetch)
+	if err != nil {
+		return err
+	}
+	defer syncer.restorePlaybackAfterSync()
+	if err := syncer.syncItems(ctx, *manifest); err != nil {
+		return err
 	}
+	return syncer.finish()
+}
 
-	// Track expected files for garbage collection
-	expectedFiles := make(map[string]struct{})
+// fileSyncer applies manifest items to the media directory. Items may be fed
+// in several batches (e.g. manifest pages); garbage collection and store
+// pruning run once in finish, after every item has been seen.
+type fileSyncer struct {
+	config   Config
+	mediaDir string
+	fetch    fetchItemFunc
+	tags     map[string]struct{}
+
+	// expectedFiles tracks manifest paths for garbage collection
+	expectedFiles map[string]struct{}
+	// manifestFiles maps the paths of admitted items to the items
+	manifestFiles map[string]ManifestItem
+	// referencedContent tracks manifest digests for content store pruning
+	referencedContent map[string]struct{}
+	// verifiedContent maps digests of verified files to their path
+	verifiedContent map[string]string
+	downloadErrors  []string
+	// forceDelete lets finish remove files past sync.max_delete_percent
+	forceDelete bool
+	// verifyDuration sums the time spent verifying local files
+	verifyDuration time.Duration
+	// quota tracks manifest bytes per content type; see mediaQuota
+	quota *mediaQuota
+	// report collects what the sync changed; see SyncReport
+	report *SyncReport
+	// pendingBytes sums the downloads of the sync; past
+	// sync.large_sync_bytes playback is degraded once and restorePlayback
+	// undoes it
+	pendingBytes     int64
+	playbackDegraded bool
+	restorePlayback  func()
+}
 
-	// Validate all filenames first to prevent path traversal and build expected files map
-	for _, item := range *manifest {
-		// Validate filename - prevent path traversal
-		if item.Filename == "" || item.Filename[0] == '/' || item.Filename[0] == '\\' {
-			log.Printf("Warning: Invalid filename '%s' for item %d, skipping", item.Filename, item.ID)
-			continue
-		}
-		// Check for path traversal attempts
-		if strings.Contains(item.Filename, "..") {
-			log.Printf("Warning: Suspicious filename '%s' for item %d, skipping", item.Filename, item.ID)
-			continue
-		}
-		// Normalize path separators for cross-platform compatibility (server uses forward slashes)
-		normalizedPath := filepath.FromSlash(item.Filename)
-		cleanPath := filepath.Clean(normalizedPath)
-		if cleanPath != normalizedPath || filepath.IsAbs(cleanPath) {
-			log.Printf("Warning: Suspicious filename '%s' for item %d, skipping", item.Filename, item.ID)
-			continue
+func newFileSyncer(config Config, fetch fetchItemFunc) (*fileSyncer, error) {
+	// Never write to the SD card when the external media drive is missing
+	if err := checkMediaStorage(config); err != nil {
+		return nil, err
+	}
+
+	// Ensure media directories exist
+	for _, dir := range mediaDirs(config) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create media directory: %w", err)
 		}
+	}
 
-		// Mark as expected
-		fullPath := filepath.Join(mediaDir, item.Filename)
-		expectedFiles[fullPath] = struct{}{}
+	return fileSyncerFor(config, fetch), nil
+}
+
+// fileSyncerFor returns a file syncer without preparing the media
+// directories.
+func fileSyncerFor(config Config, fetch fetchItemFunc) *fileSyncer {
+	return &fileSyncer{
+		config:            config,
+		mediaDir:          mediaDirFor(config),
+		fetch:             injectFetchFaults(fetch),
+		tags:              syncTagSet(config),
+		expectedFiles:     make(map[string]struct{}),
+		manifestFiles:     make(map[string]ManifestItem),
+		referencedContent: make(map[string]struct{}),
+		verifiedContent:   make(map[string]string),
+		quota:             newMediaQuota(config),
+		report:            newSyncReport(config.Sync.Source, time.Now()),
 	}
+}
+
+// validManifestFilename rejects absolute paths and path traversal.
+func validManifestFilename(item ManifestItem) bool {
+	// Validate filename - prevent path traversal
+	if item.Filename == "" || item.Filename[0] == '/' || item.Filename[0] == '\\' {
+		log.Printf("Warning: Invalid filename '%s' for item %d, skipping", item.Filename, item.ID)
+		return false
+	}
+	// Check for path traversal attempts
+	if strings.Contains(item.Filename, "..") {
+		log.Printf("Warning: Suspicious filename '%s' for item %d, skipping", item.Filename, item.ID)
+		return false
+	}
+	// Normalize path separators for cross-platform compatibility (server uses forward slashes)
+	normalizedPath := filepath.FromSlash(item.Filename)
+	cleanPath := filepath.Clean(normalizedPath)
+	if cleanPath != normalizedPath || filepath.IsAbs(cleanPath) {
+		log.Printf("Warning: Suspicious filename '%s' for item %d, skipping", item.Filename, item.ID)
+		return false
+	}
+	return true
+}
+
+// syncItems downloads missing or outdated files of one batch of items.
+func (s *fileSyncer) syncItems(ctx context.Context, items []ManifestItem) error {
+	valid := s.admitItems(items)
 
 	// Download missing or outdated files
-	var downloadErrors []string
-	for _, item := range *manifest {
-		// Skip invalid filenames (already validated above)
-		if item.Filename == "" || item.Filename[0] == '/' || item.Filename[0] == '\\' || strings.Contains(item.Filename, "..") {
-			continue
-		}
-		// Normalize path separators for cross-platform compatibility
-		normalizedPath := filepath.FromSlash(item.Filename)
-		cleanPath := filepath.Clean(normalizedPath)
-		if cleanPath != normalizedPath || filepath.IsAbs(cleanPath) {
-			continue
+	paths := make([]string, len(valid))
+	for i, item := range valid {
+		paths[i] = mediaItemPath(s.config, item)
+	}
+	upToDate, elapsed := verifyLocalPaths(ctx, s.config.Sync, paths, valid)
+	s.verifyDuration += elapsed
+	var pending int64
+	for i, item := range valid {
+		if !upToDate[i] {
+			pending += item.FileSizeBytes
 		}
-
+	}
+	s.notePendingDownload(ctx, pending)
+	for i, item := range valid {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
+		needsUpdate := !upToDate[i]
+		if !needsUpdate {
+			clearDownloadFailures(item)
+			s.report.Unchanged++
+		} else if downloadQuarantined(s.config.Sync, item) {
+			log.Printf("Skipping quarantined %s (ID: %d)", item.Filename, item.ID)
+			s.report.skip(item, errors.New("quarantined"))
+			continue
+		}
+		if needsUpdate {
+			if err := waitForThermalHeadroom(ctx, s.config.Sync); err != nil {
+				return err
+			}
+		}
 
-		fullPath := filepath.Join(mediaDir, item.Filename)
+		fullPath := paths[i]
+		itemDir := mediaKindDir(s.config, mediaKindOf(item))
 
 		// Ensure subdirectories exist
 		dir := filepath.Dir(fullPath)
 		if err := os.MkdirAll(dir, 0755); err != nil {
-			downloadErrors = append(downloadErrors, fmt.Sprintf("%s: %v", item.Filename, err))
+			s.downloadErrors = append(s.downloadErrors, fmt.Sprintf("%s: %v", item.Filename, err))
 			continue
 		}
 
-		// Check if file needs update
-		needsUpdate := true
-		if valid, err := verifyLocalFile(fullPath, item); err == nil && valid {
-			needsUpdate = false
+		fileEvent := SyncFileEvent{SessionID: syncSessionFrom(ctx), ID: item.ID, Filename: item.Filename, SizeBytes: item.FileSizeBytes}
+		started := time.Now()
+		existed := false
+		if needsUpdate {
+			_, statErr := os.Lstat(fullPath)
+			existed = statErr == nil
+			publishEvent(EventSyncFileStarted, fileEvent)
 		}
 
-		if needsUpdate {
+		var itemErr error
+		switch {
+		case !needsUpdate:
+			if s.config.Sync.ContentStore {
+				adoptIntoContentStore(itemDir, item, fullPath)
+			}
+		case s.config.Sync.ContentStore:
+			itemErr = syncItemViaContentStore(ctx, s.config, itemDir, item, fullPath, s.fetch)
+		default:
 			log.Printf("Downloading %s (ID: %d, size: %d bytes)", item.Filename, item.ID, item.FileSizeBytes)
-			if err := downloadFile(ctx, config, item, fullPath); err != nil {
-				downloadErrors = append(downloadErrors, fmt.Sprintf("%s: %v", item.Filename, err))
+			itemErr = s.fetch(ctx, s.config, item, fullPath)
+		}
+		if needsUpdate {
+			fileEvent.DurationSeconds = time.Since(started).Seconds()
+			reportItem := SyncReportItem{ID: item.ID, Filename: item.Filename, SizeBytes: item.FileSizeBytes, DurationSeconds: fileEvent.DurationSeconds}
+			switch {
+			case itemErr != nil:
+				fileEvent.Error = itemErr.Error()
+				publishEvent(EventSyncFileFailed, fileEvent)
+				reportItem.Error = fileEvent.Error
+				s.report.Failed = append(s.report.Failed, reportItem)
+			case existed:
+				publishEvent(EventSyncFileFinished, fileEvent)
+				s.report.Updated = append(s.report.Updated, reportItem)
+			default:
+				publishEvent(EventSyncFileFinished, fileEvent)
+				s.report.Added = append(s.report.Added, reportItem)
 			}
+			if itemErr == nil {
+				s.report.DownloadedBytes += item.FileSizeBytes
+			}
+		}
+		if itemErr != nil {
+			recordDownloadFailure(s.config.Sync, item, itemErr)
+			s.downloadErrors = append(s.downloadErrors, fmt.Sprintf("%s: %v", item.Filename, itemErr))
+			continue
+		}
+		if needsUpdate {
+			clearDownloadFailures(item)
+		}
+		if needsUpdate && fullVerifyInterval(s.config.Sync) >= 0 {
+			recordVerification(fullPath, item, time.Now())
+		}
+		if item.SHA256 != "" {
+			s.verifiedContent[strings.ToLower(item.SHA256)] = fullPath
 		}
 	}
+	return nil
+}
+
+// admitItems validates one batch of items, records the files and content
+// they keep and returns the items to verify and download.
+func (s *fileSyncer) admitItems(items []ManifestItem) []ManifestItem {
+	// Validate all filenames first to prevent path traversal and build expected files map
+	valid := make([]ManifestItem, 0, len(items))
+	for _, item := range items {
+		if !validManifestFilename(item) || !matchesSyncTags(item, s.tags) {
+			continue
+		}
+		// An item this agent cannot verify keeps its local file but is not
+		// downloaded.
+		if _, err := newItemVerifier(item); err != nil {
+			s.expectedFiles[mediaItemPath(s.config, item)] = struct{}{}
+			s.manifestFiles[mediaItemPath(s.config, item)] = item
+			if item.SHA256 != "" {
+				s.referencedContent[strings.ToLower(item.SHA256)] = struct{}{}
+			}
+			s.downloadErrors = append(s.downloadErrors, fmt.Sprintf("%s: %v", item.Filename, err))
+			s.report.skip(item, err)
+			continue
+		}
+		valid = append(valid, item)
+	}
+
+	// Files of the active playlist come first, also when filling quotas.
+	// Items past the quota of their content type are neither downloaded nor
+	// kept.
+	orderForDownload(valid, activePlaylistFiles(s.config.Playlist.Destination, mediaDirs(s.config)...))
+	admitted := valid[:0]
+	for _, item := range valid {
+		if err := s.quota.admit(item); err != nil {
+			s.downloadErrors = append(s.downloadErrors, fmt.Sprintf("%s: %v", item.Filename, err))
+			s.report.skip(item, err)
+			continue
+		}
+		s.expectedFiles[mediaItemPath(s.config, item)] = struct{}{}
+		s.manifestFiles[mediaItemPath(s.config, item)] = item
+		if item.SHA256 != "" {
+			s.referencedContent[strings.ToLower(item.SHA256)] = struct{}{}
+		}
+		admitted = append(admitted, item)
+	}
+	return admitted
+}
+
+// finish publishes verified content, removes files no item referenced and
+// reports accumulated download errors.
+func (s *fileSyncer) finish() error {
+	metricSet(metricSyncVerifyDuration, s.verifyDuration.Seconds())
+	s.report.VerifySeconds = s.verifyDuration.Seconds()
+	log.Printf("Verified local media files in %v", s.verifyDuration.Round(time.Millisecond))
+
+	// Publish verified files so LAN peers can fetch them from this device.
+	setPeerContentIndex(s.verifiedContent)
+	startThumbnails(s.config, s.manifestFiles)
 
 	// Garbage collect files not in manifest
-	// Protect playlist file from deletion by adding it to expectedFiles
-	if config.Playlist.Destination != "" {
-		playlistPath := filepath.Join(config.Playlist.Destination, "playlist.m3u")
-		expectedFiles[playlistPath] = struct{}{}
+	dirs, garbage, guardFiles, guardTotal := s.collectGarbage()
+	// A manifest that removes most files is more likely a backend bug than
+	// an intended change: keep everything, including the content store.
+	if err := checkDeletionGuard(s.config, guardFiles, guardTotal, s.forceDelete); err != nil {
+		s.report.DeletionBlocked = true
+		return err
+	}
+	for i, dir := range dirs {
+		for _, path := range garbage[i] {
+			file := SyncReportFile{Path: path}
+			if info, err := os.Lstat(path); err == nil {
+				file.SizeBytes = info.Size()
+			}
+			s.report.Removed = append(s.report.Removed, file)
+			s.report.RemovedBytes += file.SizeBytes
+		}
+		if err := trashGarbage(dir, garbage[i]); err != nil {
+			log.Printf("Warning: Garbage collection errors: %v", err)
+		}
 	}
+	pruneVerifyCache(s.expectedFiles)
+	persistVerifyCache()
+	setManifestIndex(s.manifestFiles)
+	pruneDownloadFailures(s.manifestFiles)
 
-	if err := garbageCollect(mediaDir, expectedFiles); err != nil {
-		log.Printf("Warning: Garbage collection errors: %v", err)
+	// Drop store entries no manifest item references any more. With the store
+	// disabled nothing is referenced, so a leftover store is released entirely.
+	referencedContent := s.referencedContent
+	if !s.config.Sync.ContentStore {
+		referencedContent = map[string]struct{}{}
+	}
+	for _, dir := range dirs {
+		if err := pruneContentStore(dir, referencedContent); err != nil {
+			log.Printf("Warning: Content store pruning errors: %v", err)
+		}
 	}
 
-	if len(downloadErrors) > 0 {
-		return fmt.Errorf("download errors: %v", downloadErrors)
+	if len(s.downloadErrors) > 0 {
+		return fmt.Errorf("download errors: %v", s.downloadErrors)
 	}
 
 	return nil
 }
 
-// garbageCollect removes files from the media directory that are not in the manifest.
+// collectGarbage lists the files of every media directory that no item
+// referenced, together with the counts the deletion guard checks.
+func (s *fileSyncer) collectGarbage() (dirs []string, garbage [][]string, guardFiles, guardTotal int) {
+	keepRestoredFiles(s.expectedFiles)
+	// Protect playlist files from deletion by adding them to expectedFiles
+	if s.config.Playlist.Destination != "" {
+		playlistPath := filepath.Join(s.config.Playlist.Destination, playlistFileName)
+		s.expectedFiles[playlistPath] = struct{}{}
+		for _, display := range s.config.Displays {
+			s.expectedFiles[displayPlaylistPath(s.config, display)] = struct{}{}
+		}
+		if s.config.Audio.Playback.Enabled {
+			s.expectedFiles[audioPlaylistPath(s.config)] = struct{}{}
+		}
+		for _, path := range storedCalendarPlaylists(s.config) {
+			s.expectedFiles[path] = struct{}{}
+		}
+		for _, path := range playbackPlaylistPaths(s.config) {
+			if sidecar := slideshowConfigPath(s.config, path); sidecar != "" {
+				s.expectedFiles[sidecar] = struct{}{}
+			}
+		}
+	}
+
+	// Every media directory is collected on its own; nested ones are left
+	// to their own pass.
+	dirs = mediaDirs(s.config)
+	garbage = make([][]string, len(dirs))
+	files, total := 0, 0
+	guardFiles = -1
+	for i, dir := range dirs {
+		var dirTotal int
+		var err error
+		garbage[i], dirTotal, err = findGarbage(dir, s.expectedFiles, nestedMediaDirs(s.config, dir)...)
+		if err != nil {
+			log.Printf("Warning: Garbage collection errors: %v", err)
+		}
+		files += len(garbage[i])
+		total += dirTotal
+		// A directory emptied by mistake must not hide behind a large one.
+		if guardFiles < 0 && deletionExceeds(s.config, len(garbage[i]), dirTotal) {
+			guardFiles, guardTotal = len(garbage[i]), dirTotal
+		}
+	}
+	if guardFiles < 0 {
+		guardFiles, guardTotal = files, total
+	}
+	return dirs, garbage, guardFiles, guardTotal
+}
+
+// garbageCollect moves files that are not in the manifest from the media
+// directory to the trash, where they are kept for sync.trash_retention.
 func garbageCollect(mediaDir string, expectedFiles map[string]struct{}) error {
-	var errors []string
+	garbage, _, walkErr := findGarbage(mediaDir, expectedFiles)
+	err := trashGarbage(mediaDir, garbage)
+	if walkErr != nil {
+		return walkErr
+	}
+	return err
+}
 
+// findGarbage lists media files that are not in expectedFiles, together
+// with the number of media files found. Directories in skip are not walked.
+func findGarbage(mediaDir string, expectedFiles map[string]struct{}, skip ...string) ([]string, int, error) {
+	var garbage []string
+	total := 0
 	err := filepath.Walk(mediaDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip directories
+		// Skip directories; the content store is pruned separately
 		if info.IsDir() {
+			if path == contentStoreDir(mediaDir) || path == trashDir(mediaDir) || slices.Contains(skip, path) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -510,19 +958,29 @@ func garbageCollect(mediaDir string, expectedFiles map[string]struct{}) error {
 			return nil
 		}
 
+		total++
 		// Check if file is expected
 		if _, expected := expectedFiles[path]; !expected {
-			log.Printf("Garbage collecting: %s", path)
-			if err := os.Remove(path); err != nil {
-				errors = append(errors, fmt.Sprintf("%s: %v", path, err))
-			}
+			garbage = append(garbage, path)
 		}
 
 		return nil
 	})
-
 	if err != nil {
-		errors = append(errors, fmt.Sprintf("walk error: %v", err))
+		return garbage, total, fmt.Errorf("walk error: %v", err)
+	}
+	return garbage, total, nil
+}
+
+// trashGarbage moves the files found by findGarbage into one trash batch.
+func trashGarbage(mediaDir string, garbage []string) error {
+	var errors []string
+	batchDir := newTrashBatch(mediaDir, time.Now())
+	for _, path := range garbage {
+		log.Printf("Garbage collecting: %s", path)
+		if err := moveToTrash(mediaDir, batchDir, path); err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", path, err))
+		}
 	}
 
 	if len(errors) > 0 {
@@ -535,40 +993,71 @@ func garbageCollect(mediaDir string, expectedFiles map[string]struct{}) error {
 // PerformSync performs a video sync operation.
 func PerformSync(ctx context.Context) (err error) {
 	config := GetCurrentConfig()
+	session := newSyncSessionID()
+	ctx = withSyncSession(ctx, session)
 
-	log.Println("Starting video sync")
+	log.Printf("Starting video sync (session %s)", session)
+	publishEvent(EventSyncStarted, SyncEvent{Kind: "video", SessionID: session})
 	startTime := time.Now()
+	total := 0
+	report := newSyncReport(config.Sync.Source, startTime)
+	report.SessionID = session
 	defer func() {
+		report.Items = total
+		report.finish(err)
+		publishSyncReport(config, report)
+
+		event := SyncEvent{Kind: "video", SessionID: session, Items: total}
 		if err != nil {
-			log.Printf("Video sync failed: %v", err)
+			event.Error = err.Error()
+		}
+		publishEvent(EventSyncFinished, event)
+		if err != nil {
+			log.Printf("Video sync failed (session %s): %v", session, err)
 			return
 		}
-		log.Println("Video sync completed successfully")
+		log.Printf("Video sync completed successfully (session %s)", session)
 	}()
 
-	manifest, err := fetchManifest(ctx, config)
+	source, err := newSyncSource(config)
 	if err != nil {
 		setSyncStatus(SyncStatus{
 			LastSyncTime: startTime,
+			SessionID:    session,
 			OK:           false,
 			Error:        err.Error(),
 		})
-		return fmt.Errorf("failed to fetch manifest: %w", err)
+		return err
 	}
 
-	log.Printf("Manifest fetched: %d items", len(*manifest))
-
-	if err := syncFiles(ctx, config, manifest); err != nil {
+	var validators manifestValidators
+	total, validators, err = syncFromSourceReporting(ctx, config, source, syncManifestValidators(config, startTime), report)
+	if errors.Is(err, errManifestNotModified) {
+		log.Println("Manifest not modified since last successful sync, skipping file pass")
+		report.NotModified = true
 		setSyncStatus(SyncStatus{
 			LastSyncTime: startTime,
+			SessionID:    session,
+			OK:           true,
+		})
+		return nil
+	}
+	if err != nil {
+		setSyncStatus(SyncStatus{
+			LastSyncTime: startTime,
+			SessionID:    session,
 			OK:           false,
+			Canceled:     errors.Is(err, context.Canceled),
 			Error:        err.Error(),
 		})
-		return fmt.Errorf("failed to sync files: %w", err)
+		return err
 	}
+	log.Printf("Manifest applied: %d items", total)
+	setAppliedManifestValidators(config, validators)
 
 	setSyncStatus(SyncStatus{
 		LastSyncTime: startTime,
+		SessionID:    session,
 		OK:           true,
 		Error:        "",
 	})
@@ -576,12 +1065,43 @@ func PerformSync(ctx context.Context) (err error) {
 	return nil
 }
 
-// TriggerSync triggers an immediate sync operation.
-// If callback is provided, it will be called after successful sync.
-// Returns an error if prerequisites are not met (e.g., missing configuration).
-func TriggerSync(callback func()) error {
-	// Validate prerequisites before spawning async task
-	config := GetCurrentConfig()
+// syncFromSource applies the manifest of source to the media directory.
+// Garbage collection runs only after every batch was applied, so an
+// incomplete manifest never removes files.
+func syncFromSource(ctx context.Context, config Config, source SyncSource, previous manifestValidators) (int, manifestValidators, error) {
+	return syncFromSourceReporting(ctx, config, source, previous, newSyncReport(config.Sync.Source, time.Now()))
+}
+
+// syncFromSourceReporting is syncFromSource that records the changes in
+// report.
+func syncFromSourceReporting(ctx context.Context, config Config, source SyncSource, previous manifestValidators, report *SyncReport) (int, manifestValidators, error) {
+	syncer, err := newFileSyncer(config, itemFetcherFor(source))
+	if err != nil {
+		return 0, manifestValidators{}, err
+	}
+	syncer.report = report
+	defer syncer.restorePlaybackAfterSync()
+	total := 0
+	validators, err := source.Manifest(ctx, previous, func(items []ManifestItem) error {
+		total += len(items)
+		return syncer.syncItems(ctx, items)
+	})
+	if errors.Is(err, errManifestNotModified) {
+		return 0, validators, err
+	}
+	if err != nil {
+		return total, manifestValidators{}, err
+	}
+	syncer.forceDelete = validators.ForceDelete
+	validators.ForceDelete = false
+	if err := syncer.finish(); err != nil {
+		return total, manifestValidators{}, fmt.Errorf("failed to sync files: %w", err)
+	}
+	return total, validators, nil
+}
+
+// checkSyncPrerequisites reports configuration a sync cannot run without.
+func checkSyncPrerequisites(config Config) error {
 	if config.CoreAPIBase == "" {
 		return fmt.Errorf("core_api_base not configured")
 	}
@@ -591,6 +1111,17 @@ func TriggerSync(callback func()) error {
 	if config.Playlist.Destination == "" {
 		return fmt.Errorf("playlist destination not configured")
 	}
+	return nil
+}
+
+// TriggerSync triggers an immediate sync operation.
+// If callback is provided, it will be called after successful sync.
+// Returns an error if prerequisites are not met (e.g., missing configuration).
+func TriggerSync(callback func()) error {
+	// Validate prerequisites before spawning async task
+	if err := checkSyncPrerequisites(GetCurrentConfig()); err != nil {
+		return err
+	}
 
 	syncLock.Lock()
 	defer syncLock.Unlock()
@@ -608,6 +1139,7 @@ func TriggerSync(callback func()) error {
 
 	// Perform sync in background
 	go func() {
+		lowerSyncPriority(GetCurrentConfig().Sync)
 		setVideoSyncRunning(true)
 		defer setVideoSyncRunning(false)
 		if err := PerformSync(ctx); err == nil && callback != nil {
@@ -623,15 +1155,8 @@ func TriggerSync(callback func()) error {
 // Returns an error if prerequisites are not met (e.g., missing configuration).
 func TriggerPlaylistSync(trigger string, callback func() error) error {
 	// Validate prerequisites before spawning async task
-	config := GetCurrentConfig()
-	if config.CoreAPIBase == "" {
-		return fmt.Errorf("core_api_base not configured")
-	}
-	if config.ServerKey == "" {
-		return fmt.Errorf("server_key not configured")
-	}
-	if config.Playlist.Destination == "" {
-		return fmt.Errorf("playlist destination not configured")
+	if err := checkSyncPrerequisites(GetCurrentConfig()); err != nil {
+		return err
 	}
 
 	syncLock.Lock()
@@ -691,7 +1216,12 @@ func StopSync() error {
 
 // downloadPlaylist downloads the current playlist from the core API.
 func downloadPlaylist(ctx context.Context, config Config) ([]byte, error) {
-	url := config.CoreAPIBase + "/api/devicesync/playlist"
+	return fetchPlaylist(ctx, config, config.CoreAPIBase+"/api/devicesync/playlist")
+}
+
+// fetchPlaylist downloads a playlist from url. It returns nil without an
+// error when the core has no playlist to activate (HTTP 204).
+func fetchPlaylist(ctx context.Context, config Config, url string) ([]byte, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -700,8 +1230,7 @@ func downloadPlaylist(ctx context.Context, config Config) ([]byte, error) {
 	// Add device authentication header
 	req.Header.Set("X-Device-Id", config.ServerKey)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := getCoreClient().Do(ctx, req, playlistTimeout())
 	if err != nil {
 		return nil, fmt.Errorf("failed to download playlist: %w", err)
 	}
@@ -728,16 +1257,44 @@ func downloadPlaylist(ctx context.Context, config Config) ([]byte, error) {
 // PerformPlaylistSync downloads the playlist and optionally saves it.
 func PerformPlaylistSync(ctx context.Context) (err error) {
 	config := GetCurrentConfig()
+	session := newSyncSessionID()
+	ctx = withSyncSession(ctx, session)
 
-	log.Println("Starting playlist sync")
+	log.Printf("Starting playlist sync (session %s)", session)
+	publishEvent(EventSyncStarted, SyncEvent{Kind: "playlist", SessionID: session})
 	defer func() {
+		event := SyncEvent{Kind: "playlist", SessionID: session}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		publishEvent(EventSyncFinished, event)
 		if err != nil {
-			log.Printf("Playlist sync failed: %v", err)
+			log.Printf("Playlist sync failed (session %s): %v", session, err)
 			return
 		}
-		log.Println("Playlist sync completed successfully")
+		log.Printf("Playlist sync completed successfully (session %s)", session)
 	}()
 
+	if config.Audio.Playback.Enabled {
+		if err := syncAudioPlaylist(ctx, config); err != nil {
+			log.Printf("Warning: audio playlist sync failed: %v", err)
+		}
+	}
+
+	if config.Playlist.Destination != "" {
+		if err := syncCalendar(ctx, config); err != nil {
+			log.Printf("Warning: content calendar sync failed: %v", err)
+		}
+		if len(getCalendarState().Slots) > 0 {
+			// The content calendar decides what playlist.m3u plays.
+			log.Println("Content calendar is active, playlist.m3u follows it")
+			if err := applyPlaylistWebContent(ctx, config); err != nil {
+				return fmt.Errorf("failed to apply playlist web content: %w", err)
+			}
+			return nil
+		}
+	}
+
 	data, err := downloadPlaylist(ctx, config)
 	if err != nil {
 		return fmt.Errorf("failed to download playlist: %w", err)
@@ -747,10 +1304,11 @@ func PerformPlaylistSync(ctx context.Context) (err error) {
 		log.Println("No playlist to activate (HTTP 204)")
 		return nil
 	}
+	data = rewritePlaylistMediaPaths(expandPlaylistTemplate(data, config), config)
 
 	// Save playlist to destination (destination is a folder, append filename)
 	if config.Playlist.Destination != "" {
-		destPath := filepath.Join(config.Playlist.Destination, "playlist.m3u")
+		destPath := filepath.Join(config.Playlist.Destination, playlistFileName)
 		if err := os.MkdirAll(config.Playlist.Destination, 0755); err != nil {
 			return fmt.Errorf("failed to create playlist directory: %w", err)
 		}
@@ -767,6 +1325,11 @@ func PerformPlaylistSync(ctx context.Context) (err error) {
 		}
 
 		log.Printf("Playlist saved to %s", destPath)
+		writeSlideshowConfigs(config)
+
+		if err := applyPlaylistWebContent(ctx, config); err != nil {
+			return fmt.Errorf("failed to apply playlist web content: %w", err)
+		}
 	}
 
 	return nil
@@ -780,7 +1343,15 @@ func StartScheduler() error {
 	cronScheduler = cron.New()
 	cronSchedulerLock.Unlock()
 
-	// Start scheduler goroutine
+	// Start scheduler goroutine, optionally once the clock is trusted so
+	// schedules do not misfire after booting with a wrong time.
+	if GetCurrentConfig().Clock.WaitForTrustedTime {
+		go func() {
+			waitForTrustedTime(context.Background(), GetCurrentConfig())
+			schedulerLoop()
+		}()
+		return nil
+	}
 	go schedulerLoop()
 
 	return nil
@@ -801,27 +1372,38 @@ func schedulerLoop() {
 			cronScheduler.Stop()
 			cronScheduler = cron.New()
 		}
+		cronJobs = nil
 		cronSchedulerLock.Unlock()
 
+		// Syncs run at a fixed per-device offset from the configured time,
+		// so a fleet sharing one schedule reaches the core spread out.
+		offset := scheduleOffset(config.Sync, scheduleDeviceID(config))
+
 		// Add scheduled playlist sync tasks (playlist only + restart service)
 		for _, timeStr := range config.Schedule.Playlist {
 			timeStr := timeStr // capture loop variable
-			parts := strings.Split(timeStr, ":")
-			if len(parts) != 2 {
+			shifted, err := shiftSchedule(timeStr, offset)
+			if err != nil {
 				log.Printf("Warning: Invalid playlist time format '%s', expected HH:MM", timeStr)
 				continue
 			}
-			cronSpec := fmt.Sprintf("%s %s * * *", parts[1], parts[0])
 			cronSchedulerLock.Lock()
-			_, err := cronScheduler.AddFunc(cronSpec, func() {
+			id, err := cronScheduler.AddFunc(shifted.spec, func() {
+				time.Sleep(shifted.delay)
+				if IsSyncSchedulerPaused() {
+					log.Printf("Skipping scheduled playlist sync at %s: scheduled syncs are paused", timeStr)
+					return
+				}
 				log.Printf("Running scheduled playlist sync at %s", timeStr)
 
 				// Route through shared sync trigger to serialize with manual sync operations.
-				callback := getScheduledSyncCallback()
-				if err := TriggerPlaylistSync("scheduled", callback); err != nil {
+				if err := TriggerPlaylistSync("scheduled", restartAfterScheduledPlaylistSync); err != nil {
 					log.Printf("Failed to trigger scheduled playlist sync: %v", err)
 				}
 			})
+			if err == nil {
+				cronJobs = append(cronJobs, cronJob{kind: "playlist", time: timeStr, effective: shifted.effective, delay: shifted.delay, id: id})
+			}
 			cronSchedulerLock.Unlock()
 			if err != nil {
 				log.Printf("Warning: Failed to schedule playlist sync at %s: %v", timeStr, err)
@@ -831,14 +1413,18 @@ func schedulerLoop() {
 		// Add scheduled video sync tasks (video files only, no restart)
 		for _, timeStr := range config.Schedule.Video {
 			timeStr := timeStr // capture loop variable
-			parts := strings.Split(timeStr, ":")
-			if len(parts) != 2 {
+			shifted, err := shiftSchedule(timeStr, offset)
+			if err != nil {
 				log.Printf("Warning: Invalid video time format '%s', expected HH:MM", timeStr)
 				continue
 			}
-			cronSpec := fmt.Sprintf("%s %s * * *", parts[1], parts[0])
 			cronSchedulerLock.Lock()
-			_, err := cronScheduler.AddFunc(cronSpec, func() {
+			id, err := cronScheduler.AddFunc(shifted.spec, func() {
+				time.Sleep(shifted.delay)
+				if IsSyncSchedulerPaused() {
+					log.Printf("Skipping scheduled video sync at %s: scheduled syncs are paused", timeStr)
+					return
+				}
 				log.Printf("Running scheduled video sync at %s", timeStr)
 
 				// Route through shared sync trigger to serialize with other sync operations.
@@ -847,6 +1433,9 @@ func schedulerLoop() {
 				}
 				// Note: No restart after video sync - only playlist sync restarts service
 			})
+			if err == nil {
+				cronJobs = append(cronJobs, cronJob{kind: "video", time: timeStr, effective: shifted.effective, delay: shifted.delay, id: id})
+			}
 			cronSchedulerLock.Unlock()
 			if err != nil {
 				log.Printf("Warning: Failed to schedule video sync at %s: %v", timeStr, err)
@@ -863,15 +1452,25 @@ func schedulerLoop() {
 			scheduledStopTime := stopTime
 			cronSpec := fmt.Sprintf("%s %s * * *", parts[1], parts[0])
 			cronSchedulerLock.Lock()
-			_, err := cronScheduler.AddFunc(cronSpec, func() {
+			id, err := cronScheduler.AddFunc(cronSpec, func() {
 				scheduleRestEndPhotoReports(scheduledStopTime)
 			})
+			if err == nil {
+				cronJobs = append(cronJobs, cronJob{kind: "rest-end", time: scheduledStopTime, id: id})
+			}
 			cronSchedulerLock.Unlock()
 			if err != nil {
 				log.Printf("Warning: Failed to schedule rest-end photo reports at %s: %v", scheduledStopTime, err)
 			}
 		}
 
+		cronSchedulerLock.Lock()
+		addAudioScheduleJobs(config)
+		addCalendarJobs(config)
+		cronSchedulerLock.Unlock()
+		go reconcileAudioSchedule(context.Background(), config)
+		go reconcileCalendar(context.Background(), config)
+
 		// Start scheduler with lock protection
 		cronSchedulerLock.Lock()
 		cronScheduler.Start()
@@ -1090,6 +1689,14 @@ func uploadScreenshot(ctx context.Context, config Config, screenshotPath string)
 		return fmt.Errorf("server_key not configured")
 	}
 
+	if info, err := os.Stat(screenshotPath); err == nil && useChunkedUpload(config.Upload, info.Size()) {
+		err := uploadArtifact(ctx, config, "screenshot", screenshotPath)
+		if !errors.Is(err, errChunkedUploadUnsupported) {
+			return err
+		}
+		log.Printf("Core does not support chunked uploads, sending %s in one request", filepath.Base(screenshotPath))
+	}
+
 	file, err := os.Open(screenshotPath)
 	if err != nil {
 		return fmt.Errorf("open screenshot: %w", err)
@@ -1117,8 +1724,7 @@ func uploadScreenshot(ctx context.Context, config Config, screenshotPath string)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	req.Header.Set("X-Device-Id", config.ServerKey)
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := getCoreClient().Do(ctx, req, screenshotTimeout())
 	if err != nil {
 		return fmt.Errorf("post screenshot: %w", err)
 	}
@@ -1156,18 +1762,10 @@ func uniqueOutputPath(path string) string {
 	}
 }
 
-// SetScheduledSyncCallback sets the callback to be called after successful scheduled syncs.
-func SetScheduledSyncCallback(callback func() error) {
-	scheduledSyncCallbackLock.Lock()
-	defer scheduledSyncCallbackLock.Unlock()
-	scheduledSyncCallback = callback
-}
-
-// getScheduledSyncCallback returns the current scheduled sync callback.
-func getScheduledSyncCallback() func() error {
-	scheduledSyncCallbackLock.RLock()
-	defer scheduledSyncCallbackLock.RUnlock()
-	return scheduledSyncCallback
+// restartAfterScheduledPlaylistSync restarts playback so a scheduled
+// playlist sync takes effect. Tests may override it.
+var restartAfterScheduledPlaylistSync = func() error {
+	return RestartVideoPlayServiceWithLogs(context.Background(), "scheduled playlist sync")
 }
 
 // SignalSchedulerReload signals the scheduler to reload its configuration.
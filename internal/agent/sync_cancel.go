@@ -0,0 +1,69 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+var (
+	// syncCancelWait bounds how long CancelSync waits for the canceled sync
+	// to stop before removing its temp files.
+	syncCancelWait = 10 * time.Second
+	// syncCancelPoll is how often CancelSync checks whether it stopped.
+	syncCancelPoll = 50 * time.Millisecond
+)
+
+// SyncCancelResponse is returned by POST /api/sync/cancel.
+type SyncCancelResponse struct {
+	// Canceled reports whether a sync was running.
+	Canceled bool `json:"canceled"`
+	Video    bool `json:"video,omitempty"`
+	Playlist bool `json:"playlist,omitempty"`
+	// TempFiles counts the partial downloads removed.
+	TempFiles int `json:"tempFiles"`
+}
+
+// CancelSync cancels the running video or playlist sync, waits for it to
+// stop and removes its partial downloads. A canceled video sync is recorded
+// in the sync status.
+func CancelSync() SyncCancelResponse {
+	resp := SyncCancelResponse{Video: IsVideoSyncRunning(), Playlist: IsPlaylistSyncRunning()}
+	resp.Canceled = resp.Video || resp.Playlist
+	_ = StopSync()
+	if !resp.Canceled {
+		return resp
+	}
+
+	deadline := time.Now().Add(syncCancelWait)
+	for (IsVideoSyncRunning() || IsPlaylistSyncRunning()) && time.Now().Before(deadline) {
+		time.Sleep(syncCancelPoll)
+	}
+
+	config := GetCurrentConfig()
+	now := time.Now()
+	for _, dir := range mediaDirs(config) {
+		result, err := cleanupMediaDir(dir, 0, now, nestedMediaDirs(config, dir)...)
+		if err != nil {
+			log.Printf("Warning: failed to remove temp files of the canceled sync in %s: %v", dir, err)
+		}
+		resp.TempFiles += result.TempFiles
+	}
+
+	if resp.Video {
+		setSyncStatus(SyncStatus{LastSyncTime: now, OK: false, Canceled: true, Error: "sync canceled"})
+	}
+	log.Printf("Sync canceled (video: %v, playlist: %v), %d temp files removed", resp.Video, resp.Playlist, resp.TempFiles)
+	return resp
+}
+
+// HandleSyncCancel cancels the running sync.
+func HandleSyncCancel(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: CancelSync()})
+}
@@ -0,0 +1,87 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCancelSyncStopsRunningSync(t *testing.T) {
+	mediaDir := t.TempDir()
+	setCurrentConfigForTest(t, Config{Playlist: PlaylistConfig{Destination: mediaDir}})
+	partial := filepath.Join(mediaDir, "clip.mp4.tmp")
+	if err := os.WriteFile(partial, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeMediaFilesForTest(t, mediaDir, "kept.mp4")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	syncLock.Lock()
+	syncContext, syncCancel = ctx, cancel
+	syncLock.Unlock()
+	setVideoSyncRunning(true)
+	stopped := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		setVideoSyncRunning(false)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		setSyncStatus(SyncStatus{})
+	})
+
+	w := httptest.NewRecorder()
+	HandleSyncCancel(w, httptest.NewRequest(http.MethodPost, "/api/sync/cancel", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data SyncCancelResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Data.Canceled || !resp.Data.Video || resp.Data.Playlist || resp.Data.TempFiles != 1 {
+		t.Fatalf("unexpected response: %+v", resp.Data)
+	}
+	<-stopped
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Fatalf("expected the partial download removed, stat err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "kept.mp4")); err != nil {
+		t.Fatalf("expected media files kept: %v", err)
+	}
+	if status := GetSyncStatus(); !status.Canceled || status.OK {
+		t.Fatalf("expected a canceled sync status, got %+v", status)
+	}
+}
+
+func TestCancelSyncWithoutRunningSync(t *testing.T) {
+	mediaDir := t.TempDir()
+	setCurrentConfigForTest(t, Config{Playlist: PlaylistConfig{Destination: mediaDir}})
+	partial := filepath.Join(mediaDir, "clip.mp4.tmp")
+	if err := os.WriteFile(partial, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp := CancelSync(); resp.Canceled || resp.TempFiles != 0 {
+		t.Fatalf("expected nothing to cancel, got %+v", resp)
+	}
+	if _, err := os.Stat(partial); err != nil {
+		t.Fatalf("expected temp files left alone without a running sync: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	HandleSyncCancel(w, httptest.NewRequest(http.MethodGet, "/api/sync/cancel", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", w.Code)
+	}
+}
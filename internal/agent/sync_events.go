@@ -0,0 +1,81 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// syncEventsKeepAlive is how often an idle event stream sends a comment so
+// proxies keep the connection open.
+var syncEventsKeepAlive = 15 * time.Second
+
+// syncEventTypes are streamed by /api/sync/events.
+var syncEventTypes = []string{
+	EventSyncStarted,
+	EventSyncFinished,
+	EventSyncFileStarted,
+	EventSyncFileFinished,
+	EventSyncFileFailed,
+}
+
+// HandleSyncEvents streams sync runs and per-file downloads as Server-Sent
+// Events until the client disconnects. Each event is named after its type
+// and carries the Event as JSON.
+func HandleSyncEvents(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: "Потоковая передача не поддерживается"})
+		return
+	}
+	// The stream outlives the server write timeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	ctx := r.Context()
+	events := make(chan Event)
+	unsubscribe := SubscribeEvents(func(event Event) {
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}, syncEventTypes...)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(syncEventsKeepAlive)
+	defer keepAlive.Stop()
+
+	var id uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			id++
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncFilesPublishesFileEvents(t *testing.T) {
+	events := make(chan Event, 10)
+	unsubscribe := SubscribeEvents(func(event Event) { events <- event }, EventSyncFileStarted, EventSyncFileFinished, EventSyncFileFailed)
+	defer unsubscribe()
+
+	content := "data"
+	manifest := &Manifest{
+		{ID: 1, Filename: "ok.mp4", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content)},
+		{ID: 2, Filename: "broken.mp4", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content)},
+	}
+	fetch := func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		if item.ID == 2 {
+			return errors.New("connection reset")
+		}
+		return writeVerifiedContent(strings.NewReader(content), item, destPath)
+	}
+	config := Config{Playlist: PlaylistConfig{Destination: t.TempDir()}}
+	_ = syncFilesFrom(context.Background(), config, manifest, fetch)
+
+	got := map[string]string{}
+	for range 4 {
+		select {
+		case event := <-events:
+			file := event.Data.(SyncFileEvent)
+			got[file.Filename+" "+event.Type] = file.Error
+		case <-time.After(time.Second):
+			t.Fatalf("missing events, got %v", got)
+		}
+	}
+	for _, key := range []string{"ok.mp4 sync.file.started", "ok.mp4 sync.file.finished", "broken.mp4 sync.file.started", "broken.mp4 sync.file.failed"} {
+		if _, ok := got[key]; !ok {
+			t.Fatalf("missing %q in %v", key, got)
+		}
+	}
+	if got["broken.mp4 sync.file.failed"] != "connection reset" {
+		t.Fatalf("unexpected failure %q", got["broken.mp4 sync.file.failed"])
+	}
+}
+
+func TestHandleSyncEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(HandleSyncEvents))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	if line, err := reader.ReadString('\n'); err != nil || line != ": connected\n" {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+	_, _ = reader.ReadString('\n')
+
+	publishEvent(EventUnitChanged, UnitEvent{Unit: "play.video.service", Action: "start"})
+	publishEvent(EventSyncFileFinished, SyncFileEvent{ID: 7, Filename: "a.mp4", SizeBytes: 4})
+
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	if lines[0] != "id: 1" || lines[1] != "event: sync.file.finished" || !strings.Contains(lines[2], `"filename":"a.mp4"`) {
+		t.Fatalf("unexpected event %q", lines)
+	}
+}
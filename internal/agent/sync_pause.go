@@ -0,0 +1,170 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metricSyncPaused = "media_pi_sync_paused"
+
+func init() {
+	registerGauge(metricSyncPaused, "1 while scheduled syncs are paused.")
+}
+
+var (
+	// syncPauseStateFilePath persists the pause across restarts.
+	syncPauseStateFilePath = filepath.Join(agentStateDir, "sync-pause.json")
+
+	syncPauseLock  sync.Mutex
+	syncPauseState SyncPauseState
+)
+
+// SyncPauseState describes whether scheduled syncs are paused. While paused
+// the scheduler skips playlist and video syncs, so content stays as it is
+// during maintenance windows even if the core publishes updates. Manual
+// syncs from the menu still run.
+type SyncPauseState struct {
+	Paused   bool   `json:"paused"`
+	Reason   string `json:"reason,omitempty"`
+	PausedAt string `json:"pausedAt,omitempty"`
+}
+
+// SyncPauseRequest is the optional body of POST /api/menu/schedule/pause.
+type SyncPauseRequest struct {
+	Reason string `json:"reason"`
+}
+
+func setSyncPauseStateLocked(state SyncPauseState) error {
+	if err := writeStateFile(syncPauseStateFilePath, state); err != nil {
+		return err
+	}
+	syncPauseState = state
+	if state.Paused {
+		metricSet(metricSyncPaused, 1)
+	} else {
+		metricSet(metricSyncPaused, 0)
+	}
+	return nil
+}
+
+// PauseSyncScheduler stops scheduled syncs from running until
+// ResumeSyncScheduler. Pausing again only updates the reason.
+func PauseSyncScheduler(reason string) (SyncPauseState, error) {
+	syncPauseLock.Lock()
+	defer syncPauseLock.Unlock()
+
+	state := SyncPauseState{Paused: true, Reason: strings.TrimSpace(reason), PausedAt: syncPauseState.PausedAt}
+	if !syncPauseState.Paused {
+		state.PausedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if err := setSyncPauseStateLocked(state); err != nil {
+		return syncPauseState, err
+	}
+	log.Printf("Scheduled syncs paused (reason: %q)", state.Reason)
+	return state, nil
+}
+
+// ResumeSyncScheduler lets scheduled syncs run again. Syncs skipped while
+// paused are not caught up; the next scheduled run picks up all changes.
+func ResumeSyncScheduler() (SyncPauseState, error) {
+	syncPauseLock.Lock()
+	defer syncPauseLock.Unlock()
+
+	if !syncPauseState.Paused {
+		return syncPauseState, nil
+	}
+	if err := setSyncPauseStateLocked(SyncPauseState{}); err != nil {
+		return syncPauseState, err
+	}
+	log.Println("Scheduled syncs resumed")
+	return SyncPauseState{}, nil
+}
+
+// IsSyncSchedulerPaused reports whether scheduled syncs are paused.
+func IsSyncSchedulerPaused() bool {
+	syncPauseLock.Lock()
+	defer syncPauseLock.Unlock()
+	return syncPauseState.Paused
+}
+
+func getSyncPauseState() SyncPauseState {
+	syncPauseLock.Lock()
+	defer syncPauseLock.Unlock()
+	return syncPauseState
+}
+
+// RestoreSyncPause restores a pause persisted by a previous run.
+func RestoreSyncPause() {
+	var state SyncPauseState
+	if err := readStateFile(syncPauseStateFilePath, &state); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: ignoring sync pause state: %v", err)
+		}
+		return
+	}
+	if !state.Paused {
+		return
+	}
+	syncPauseLock.Lock()
+	defer syncPauseLock.Unlock()
+	syncPauseState = state
+	metricSet(metricSyncPaused, 1)
+	log.Printf("Scheduled syncs remain paused since %s", state.PausedAt)
+}
+
+// HandleSchedulePause reports (GET) or sets (POST) the pause of scheduled
+// syncs.
+func HandleSchedulePause(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getSyncPauseState()})
+	case http.MethodPost:
+		var req SyncPauseRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+			return
+		}
+		state, err := PauseSyncScheduler(req.Reason)
+		if err != nil {
+			log.Printf("Failed to pause scheduled syncs: %v", err)
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось приостановить синхронизацию по расписанию: %v", err)})
+			return
+		}
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: state})
+	default:
+		JSONResponse(w, http.StatusMethodNotAllowed, APIResponse{OK: false, ErrMsg: "Метод не разрешён"})
+	}
+}
+
+// HandleScheduleResume resumes scheduled syncs.
+func HandleScheduleResume(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	if _, err := ResumeSyncScheduler(); err != nil {
+		log.Printf("Failed to resume scheduled syncs: %v", err)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось возобновить синхронизацию по расписанию: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: MenuActionResponse{
+			Action:  "schedule-resume",
+			Result:  "success",
+			Message: "Синхронизация по расписанию возобновлена",
+		},
+	})
+}
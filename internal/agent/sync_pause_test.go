@@ -0,0 +1,116 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupSyncPauseForTest(t *testing.T) {
+	t.Helper()
+	originalPath := syncPauseStateFilePath
+	syncPauseStateFilePath = filepath.Join(t.TempDir(), "sync-pause.json")
+	t.Cleanup(func() {
+		syncPauseStateFilePath = originalPath
+		syncPauseLock.Lock()
+		syncPauseState = SyncPauseState{}
+		syncPauseLock.Unlock()
+		metricSet(metricSyncPaused, 0)
+	})
+}
+
+func TestPauseAndResumeSyncScheduler(t *testing.T) {
+	setupSyncPauseForTest(t)
+
+	state, err := PauseSyncScheduler(" maintenance ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Paused || state.Reason != "maintenance" || state.PausedAt == "" {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+	if !IsSyncSchedulerPaused() || metricValue(metricSyncPaused) != 1 {
+		t.Fatal("expected scheduled syncs to be paused")
+	}
+
+	// Pausing again keeps the start of the pause.
+	again, err := PauseSyncScheduler("longer maintenance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.PausedAt != state.PausedAt || again.Reason != "longer maintenance" {
+		t.Fatalf("unexpected state after pausing again: %+v", again)
+	}
+
+	if _, err := ResumeSyncScheduler(); err != nil {
+		t.Fatal(err)
+	}
+	if IsSyncSchedulerPaused() || metricValue(metricSyncPaused) != 0 {
+		t.Fatal("expected scheduled syncs to be resumed")
+	}
+	var persisted SyncPauseState
+	if err := readStateFile(syncPauseStateFilePath, &persisted); err != nil || persisted.Paused {
+		t.Fatalf("expected the resume to be persisted, got %+v, %v", persisted, err)
+	}
+}
+
+func TestRestoreSyncPause(t *testing.T) {
+	setupSyncPauseForTest(t)
+	if _, err := PauseSyncScheduler("maintenance"); err != nil {
+		t.Fatal(err)
+	}
+	syncPauseLock.Lock()
+	syncPauseState = SyncPauseState{}
+	syncPauseLock.Unlock()
+
+	RestoreSyncPause()
+	if state := getSyncPauseState(); !state.Paused || state.Reason != "maintenance" {
+		t.Fatalf("unexpected restored state: %+v", state)
+	}
+}
+
+func TestHandleSchedulePauseAndResume(t *testing.T) {
+	setupSyncPauseForTest(t)
+
+	w := httptest.NewRecorder()
+	HandleSchedulePause(w, httptest.NewRequest(http.MethodPost, "/api/menu/schedule/pause", strings.NewReader(`{"reason":"exhibition setup"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	HandleSchedulePause(w, httptest.NewRequest(http.MethodGet, "/api/menu/schedule/pause", nil))
+	var resp struct {
+		Data SyncPauseState `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Data.Paused || resp.Data.Reason != "exhibition setup" {
+		t.Fatalf("unexpected state: %+v", resp.Data)
+	}
+
+	w = httptest.NewRecorder()
+	HandleSchedulePause(w, httptest.NewRequest(http.MethodPost, "/api/menu/schedule/pause", strings.NewReader("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a malformed body, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	HandleScheduleResume(w, httptest.NewRequest(http.MethodPost, "/api/menu/schedule/resume", nil))
+	if w.Code != http.StatusOK || IsSyncSchedulerPaused() {
+		t.Fatalf("expected scheduled syncs to be resumed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	HandleScheduleResume(w, httptest.NewRequest(http.MethodGet, "/api/menu/schedule/resume", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// SyncPlanItem is a manifest item a sync would download.
+type SyncPlanItem struct {
+	ID       int64  `json:"id"`
+	Filename string `json:"filename"`
+	Kind     string `json:"kind"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// SyncPlanFile is a local file a sync would move to the trash.
+type SyncPlanFile struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// SyncPlanResponse is returned by GET /api/sync/plan.
+type SyncPlanResponse struct {
+	// Download lists items without a local file, Redownload items whose
+	// local file does not match the manifest.
+	Download        []SyncPlanItem `json:"download"`
+	DownloadBytes   int64          `json:"downloadBytes"`
+	Redownload      []SyncPlanItem `json:"redownload"`
+	RedownloadBytes int64          `json:"redownloadBytes"`
+	Delete          []SyncPlanFile `json:"delete"`
+	DeleteBytes     int64          `json:"deleteBytes"`
+	Unchanged       int            `json:"unchanged"`
+	// DeletionBlocked reports that sync.max_delete_percent would keep the
+	// deletions until they are confirmed.
+	DeletionBlocked bool `json:"deletionBlocked"`
+	// Skipped lists items that would not be downloaded, e.g. past a quota.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// planSync compares the manifest of source with the local files and
+// reports what a sync would change. It writes nothing.
+func planSync(ctx context.Context, config Config, source SyncSource) (SyncPlanResponse, error) {
+	plan := SyncPlanResponse{Download: []SyncPlanItem{}, Redownload: []SyncPlanItem{}, Delete: []SyncPlanFile{}}
+	if err := checkMediaStorage(config); err != nil {
+		return plan, err
+	}
+
+	syncer := fileSyncerFor(config, nil)
+	if _, err := source.Manifest(ctx, manifestValidators{}, func(items []ManifestItem) error {
+		valid := syncer.admitItems(items)
+		paths := make([]string, len(valid))
+		for i, item := range valid {
+			paths[i] = mediaItemPath(config, item)
+		}
+		upToDate, _ := verifyLocalPaths(ctx, config.Sync, paths, valid)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for i, item := range valid {
+			entry := SyncPlanItem{ID: item.ID, Filename: item.Filename, Kind: mediaKindOf(item), Bytes: item.FileSizeBytes}
+			switch _, err := os.Stat(paths[i]); {
+			case upToDate[i]:
+				plan.Unchanged++
+			case err != nil:
+				plan.Download = append(plan.Download, entry)
+				plan.DownloadBytes += entry.Bytes
+			default:
+				plan.Redownload = append(plan.Redownload, entry)
+				plan.RedownloadBytes += entry.Bytes
+			}
+		}
+		return nil
+	}); err != nil {
+		return plan, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	plan.Skipped = syncer.downloadErrors
+
+	_, garbage, guardFiles, guardTotal := syncer.collectGarbage()
+	for _, paths := range garbage {
+		for _, path := range paths {
+			file := SyncPlanFile{Path: path}
+			if info, err := os.Stat(path); err == nil {
+				file.Bytes = info.Size()
+			}
+			plan.Delete = append(plan.Delete, file)
+			plan.DeleteBytes += file.Bytes
+		}
+	}
+	plan.DeletionBlocked = deletionExceeds(config, guardFiles, guardTotal)
+	return plan, nil
+}
+
+// HandleSyncPlan previews the next video sync: what it would download,
+// download again and delete, so the core can show the impact of a publish.
+func HandleSyncPlan(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	config := GetCurrentConfig()
+	source, err := newSyncSource(config)
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось построить план синхронизации: %v", err)})
+		return
+	}
+	plan, err := planSync(r.Context(), config, source)
+	if err != nil {
+		log.Printf("Failed to plan sync: %v", err)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось построить план синхронизации: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: plan})
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHandleSyncPlan(t *testing.T) {
+	resetDeletionGuardForTest(t)
+	mediaDir := t.TempDir()
+	for name, content := range map[string]string{"kept.mp4": "kept", "corrupt.mp4": "oops", "stale.mp4": "stale!"} {
+		if err := os.WriteFile(filepath.Join(mediaDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := &fakeSyncSource{
+		batches: [][]ManifestItem{
+			{{ID: 1, Filename: "kept.mp4", FileSizeBytes: 4, SHA256: sha256Hex("kept")}},
+			{
+				{ID: 2, Filename: "corrupt.mp4", FileSizeBytes: 4, SHA256: sha256Hex("good")},
+				{ID: 3, Filename: "posters/new.jpg", FileSizeBytes: 5, SHA256: sha256Hex("image")},
+			},
+		},
+	}
+	setSyncSourceForTest(t, source)
+	setCurrentConfigForTest(t, Config{Playlist: PlaylistConfig{Destination: mediaDir}})
+
+	w := httptest.NewRecorder()
+	HandleSyncPlan(w, httptest.NewRequest(http.MethodGet, "/api/sync/plan", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data SyncPlanResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	plan := resp.Data
+	if want := []SyncPlanItem{{ID: 3, Filename: "posters/new.jpg", Kind: mediaKindImage, Bytes: 5}}; !reflect.DeepEqual(plan.Download, want) || plan.DownloadBytes != 5 {
+		t.Errorf("download = %+v (%d bytes)", plan.Download, plan.DownloadBytes)
+	}
+	if want := []SyncPlanItem{{ID: 2, Filename: "corrupt.mp4", Kind: mediaKindVideo, Bytes: 4}}; !reflect.DeepEqual(plan.Redownload, want) || plan.RedownloadBytes != 4 {
+		t.Errorf("redownload = %+v (%d bytes)", plan.Redownload, plan.RedownloadBytes)
+	}
+	if want := []SyncPlanFile{{Path: filepath.Join(mediaDir, "stale.mp4"), Bytes: 6}}; !reflect.DeepEqual(plan.Delete, want) || plan.DeleteBytes != 6 {
+		t.Errorf("delete = %+v (%d bytes)", plan.Delete, plan.DeleteBytes)
+	}
+	if plan.Unchanged != 1 || plan.DeletionBlocked {
+		t.Errorf("unexpected plan: %+v", plan)
+	}
+
+	// Nothing was written.
+	if len(source.fetched) != 0 {
+		t.Fatalf("expected no downloads, got %v", source.fetched)
+	}
+	entries, err := os.ReadDir(mediaDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected the media directory unchanged, got %v", entries)
+	}
+	if status := getDeletionGuardStatus(); status.Blocked {
+		t.Fatalf("expected the deletion guard untouched, got %+v", status)
+	}
+}
+
+func TestSyncPlanReportsBlockedDeletion(t *testing.T) {
+	resetDeletionGuardForTest(t)
+	mediaDir := t.TempDir()
+	writeMediaFilesForTest(t, mediaDir, "a.mp4", "b.mp4", "c.mp4", "d.mp4")
+	source := &fakeSyncSource{}
+
+	plan, err := planSync(t.Context(), Config{Playlist: PlaylistConfig{Destination: mediaDir}}, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Delete) != 4 || plan.DeleteBytes != 12 || !plan.DeletionBlocked {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+}
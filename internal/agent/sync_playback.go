@@ -0,0 +1,187 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Values of sync.playback_during_sync. Without a value playback is left
+// alone during syncs.
+const (
+	// PlaybackDuringSyncPause pauses the players.
+	PlaybackDuringSyncPause = "pause"
+	// PlaybackDuringSyncLower makes the players drop late frames and skip
+	// the deblocking filter.
+	PlaybackDuringSyncLower = "lower"
+)
+
+// DefaultLargeSyncBytes is the download size from which a sync is large
+// when sync.large_sync_bytes is not set.
+const DefaultLargeSyncBytes = 200 << 20
+
+const metricSyncPlaybackDegraded = "media_pi_sync_playback_degraded"
+
+func init() {
+	registerGauge(metricSyncPlaybackDegraded, "1 while playback is paused or lowered for a large sync.")
+}
+
+// LoadAvgPath reports the system load average. Tests may override it.
+var LoadAvgPath = "/proc/loadavg"
+
+// lowQualityProperties are the mpv properties set by
+// PlaybackDuringSyncLower. Together they roughly halve the decode cost of
+// 1080p H.264, which a Zero-class CPU cannot afford next to hashing.
+var lowQualityProperties = []mpvProperty{
+	{"framedrop", "decoder+vo"},
+	{"vd-lavc-skiploopfilter", "all"},
+}
+
+// mpvProperty is a player property and its value.
+type mpvProperty struct {
+	name  string
+	value any
+}
+
+// validatePlaybackDuringSync checks sync.playback_during_sync.
+func validatePlaybackDuringSync(config SyncConfig) error {
+	switch config.PlaybackDuringSync {
+	case "", PlaybackDuringSyncPause, PlaybackDuringSyncLower:
+		return nil
+	}
+	return fmt.Errorf("sync.playback_during_sync: unknown value %q, expected %s or %s",
+		config.PlaybackDuringSync, PlaybackDuringSyncPause, PlaybackDuringSyncLower)
+}
+
+// largeSyncBytes returns sync.large_sync_bytes or DefaultLargeSyncBytes.
+func largeSyncBytes(config SyncConfig) int64 {
+	if config.LargeSyncBytes > 0 {
+		return config.LargeSyncBytes
+	}
+	return DefaultLargeSyncBytes
+}
+
+// loadAverage returns the 1-minute load average, or -1 when it cannot be
+// read.
+func loadAverage() float64 {
+	data, err := os.ReadFile(LoadAvgPath)
+	if err != nil {
+		return -1
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return -1
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return -1
+	}
+	return load
+}
+
+// constrainedForSync reports whether a sync would make playback stutter:
+// on a Zero 2 or a Pi 3, or while the load average is at least the number
+// of CPUs. Tests may override it.
+var constrainedForSync = func() bool {
+	switch currentBoard().Board {
+	case BoardZero2, BoardPi3:
+		return true
+	}
+	return loadAverage() >= float64(runtime.NumCPU())
+}
+
+// degradePlaybackForSync pauses or lowers the players as set by
+// sync.playback_during_sync and returns the function that restores them,
+// or nil when nothing changed. It needs player.ipc_socket.
+func degradePlaybackForSync(ctx context.Context, config Config) func() {
+	var properties []mpvProperty
+	switch config.Sync.PlaybackDuringSync {
+	case PlaybackDuringSyncPause:
+		properties = []mpvProperty{{"pause", true}}
+	case PlaybackDuringSyncLower:
+		properties = lowQualityProperties
+	default:
+		return nil
+	}
+	sockets := playerIPCSockets(config)
+	if len(sockets) == 0 {
+		log.Printf("Warning: sync.playback_during_sync needs player.ipc_socket, playback is left as is")
+		return nil
+	}
+
+	type previousValue struct {
+		socket string
+		mpvProperty
+	}
+	var previous []previousValue
+	for _, socket := range sockets {
+		for _, property := range properties {
+			raw, err := mpvCommand(ctx, socket, []any{"get_property", property.name})
+			if err != nil {
+				log.Printf("Warning: failed to read %s of the player at %s: %v", property.name, socket, err)
+				continue
+			}
+			var value any
+			if err := json.Unmarshal(raw, &value); err != nil {
+				continue
+			}
+			if _, err := mpvCommand(ctx, socket, []any{"set_property", property.name, property.value}); err != nil {
+				log.Printf("Warning: failed to set %s of the player at %s: %v", property.name, socket, err)
+				continue
+			}
+			previous = append(previous, previousValue{socket, mpvProperty{property.name, value}})
+		}
+	}
+	if len(previous) == 0 {
+		return nil
+	}
+	metricSet(metricSyncPlaybackDegraded, 1)
+	log.Printf("Large sync on a constrained device: playback set to %s", config.Sync.PlaybackDuringSync)
+
+	return func() {
+		// The sync context may be canceled by now.
+		ctx, cancel := context.WithTimeout(context.Background(), mpvIPCTimeout)
+		defer cancel()
+		for i := len(previous) - 1; i >= 0; i-- {
+			value := previous[i]
+			if _, err := mpvCommand(ctx, value.socket, []any{"set_property", value.name, value.value}); err != nil {
+				log.Printf("Warning: failed to restore %s of the player at %s: %v", value.name, value.socket, err)
+			}
+		}
+		metricSet(metricSyncPlaybackDegraded, 0)
+		log.Println("Playback restored after the sync")
+	}
+}
+
+// notePendingDownload adds bytes to the downloads of the sync and degrades
+// playback once the sync turns out large on a constrained device.
+func (s *fileSyncer) notePendingDownload(ctx context.Context, bytes int64) {
+	s.pendingBytes += bytes
+	if s.playbackDegraded || s.config.Sync.PlaybackDuringSync == "" || s.pendingBytes < largeSyncBytes(s.config.Sync) {
+		return
+	}
+	s.playbackDegraded = true
+	if !constrainedForSync() {
+		return
+	}
+	s.restorePlayback = degradePlaybackForSync(ctx, s.config)
+	if s.restorePlayback != nil {
+		s.report.PlaybackDuringSync = s.config.Sync.PlaybackDuringSync
+	}
+}
+
+// restorePlaybackAfterSync undoes notePendingDownload.
+func (s *fileSyncer) restorePlaybackAfterSync() {
+	if s.restorePlayback != nil {
+		s.restorePlayback()
+		s.restorePlayback = nil
+	}
+}
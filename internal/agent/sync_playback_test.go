@@ -0,0 +1,95 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidatePlaybackDuringSync(t *testing.T) {
+	for _, value := range []string{"", PlaybackDuringSyncPause, PlaybackDuringSyncLower} {
+		if err := validatePlaybackDuringSync(SyncConfig{PlaybackDuringSync: value}); err != nil {
+			t.Errorf("%q: %v", value, err)
+		}
+	}
+	if err := validatePlaybackDuringSync(SyncConfig{PlaybackDuringSync: "stop"}); err == nil {
+		t.Error("expected an error for an unknown value")
+	}
+}
+
+func TestLoadAverage(t *testing.T) {
+	original := LoadAvgPath
+	t.Cleanup(func() { LoadAvgPath = original })
+	LoadAvgPath = filepath.Join(t.TempDir(), "loadavg")
+	if load := loadAverage(); load != -1 {
+		t.Fatalf("missing file: %v", load)
+	}
+	if err := os.WriteFile(LoadAvgPath, []byte("3.52 2.10 1.05 2/311 12345\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if load := loadAverage(); load != 3.52 {
+		t.Fatalf("load = %v", load)
+	}
+}
+
+func TestLargeSyncPausesPlaybackOnConstrainedDevice(t *testing.T) {
+	original := constrainedForSync
+	t.Cleanup(func() { constrainedForSync = original })
+	constrained := true
+	constrainedForSync = func() bool { return constrained }
+
+	player := startFakeMPV(t)
+	player.properties = map[string]any{"pause": false}
+	content := "data"
+	manifest := &Manifest{
+		{ID: 1, Filename: "one.mp4", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content)},
+		{ID: 2, Filename: "two.mp4", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content)},
+	}
+	var commandsDuringSync []string
+	fetch := func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		commandsDuringSync, _ = player.snapshot()
+		return os.WriteFile(destPath, []byte(content), 0644)
+	}
+	config := Config{
+		Playlist: PlaylistConfig{Destination: t.TempDir()},
+		Player:   PlayerConfig{IPCSocket: player.socket},
+		Sync:     SyncConfig{PlaybackDuringSync: PlaybackDuringSyncPause, LargeSyncBytes: 8},
+	}
+	if err := syncFilesFrom(context.Background(), config, manifest, fetch); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`["get_property","pause"]`, `["set_property","pause",true]`}
+	if !reflect.DeepEqual(commandsDuringSync, want) {
+		t.Fatalf("commands during sync = %v, want %v", commandsDuringSync, want)
+	}
+	commands := waitForFakeMPV(t, player, 0)
+	if last := commands[len(commands)-1]; last != `["set_property","pause",false]` {
+		t.Fatalf("playback must be restored after the sync, commands %v", commands)
+	}
+
+	// A small sync and an unconstrained device leave playback alone.
+	for _, tc := range []struct {
+		name        string
+		constrained bool
+		largeBytes  int64
+	}{
+		{"small sync", true, 100},
+		{"unconstrained", false, 8},
+	} {
+		before, _ := player.snapshot()
+		constrained = tc.constrained
+		config.Playlist.Destination = t.TempDir()
+		config.Sync.LargeSyncBytes = tc.largeBytes
+		if err := syncFilesFrom(context.Background(), config, manifest, fetch); err != nil {
+			t.Fatal(err)
+		}
+		if after, _ := player.snapshot(); len(after) != len(before) {
+			t.Fatalf("%s: playback changed: %v", tc.name, after[len(before):])
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// DefaultSyncNice is the nice value of sync work when sync.nice is not
+// set, so hashing and downloads yield the CPU to the player.
+const DefaultSyncNice = 10
+
+// Values of sync.io_priority.
+const (
+	// SyncIOPriorityIdle does sync disk IO only when no other process
+	// needs the disk.
+	SyncIOPriorityIdle = "idle"
+	// SyncIOPriorityLow is the lowest best-effort level, the default.
+	SyncIOPriorityLow = "low"
+	// SyncIOPriorityNormal leaves the IO priority as it is.
+	SyncIOPriorityNormal = "normal"
+)
+
+// ioprio_set(2) constants.
+const (
+	ioprioWhoProcess    = 1
+	ioprioClassShift    = 13
+	ioprioClassBestEff  = 2
+	ioprioClassIdle     = 3
+	ioprioLowestBestEff = 7
+)
+
+// SyncCgroupConfig limits the agent through a systemd slice rendered by
+// install-units. The slice holds the whole media-pi-agent.service, so the
+// limits also apply to the REST API, playback control and every other
+// part of the agent, not only to sync. Empty values leave the limit unset.
+type SyncCgroupConfig struct {
+	// CPUQuota is a systemd CPUQuota, e.g. 50%.
+	CPUQuota string `yaml:"cpu_quota,omitempty"`
+	// IOWeight is a systemd IOWeight, 1-10000 (100 is the default of
+	// other units).
+	IOWeight int `yaml:"io_weight,omitempty"`
+	// MemoryMax is a systemd MemoryMax, e.g. 256M.
+	MemoryMax string `yaml:"memory_max,omitempty"`
+}
+
+// syncSliceName is the slice the whole agent runs in when sync.cgroup is
+// set.
+const syncSliceName = "media-pi-sync.slice"
+
+// enabled reports whether any limit is set.
+func (c SyncCgroupConfig) enabled() bool {
+	return c.CPUQuota != "" || c.IOWeight != 0 || c.MemoryMax != ""
+}
+
+// syncNice returns sync.nice, DefaultSyncNice when it is not set.
+func syncNice(config SyncConfig) int {
+	if config.Nice == nil {
+		return DefaultSyncNice
+	}
+	return *config.Nice
+}
+
+// validateSyncPriority checks sync.nice, sync.io_priority and sync.cgroup.
+func validateSyncPriority(config SyncConfig) error {
+	if nice := syncNice(config); nice < 0 || nice > 19 {
+		return fmt.Errorf("sync.nice must be between 0 and 19")
+	}
+	switch config.IOPriority {
+	case "", SyncIOPriorityIdle, SyncIOPriorityLow, SyncIOPriorityNormal:
+	default:
+		return fmt.Errorf("sync.io_priority: unknown value %q, expected %s, %s or %s",
+			config.IOPriority, SyncIOPriorityIdle, SyncIOPriorityLow, SyncIOPriorityNormal)
+	}
+	cgroup := config.Cgroup
+	if cgroup.IOWeight < 0 || cgroup.IOWeight > 10000 {
+		return fmt.Errorf("sync.cgroup.io_weight must be between 1 and 10000")
+	}
+	for name, value := range map[string]string{"cpu_quota": cgroup.CPUQuota, "memory_max": cgroup.MemoryMax} {
+		if value != SanitizeSystemdValue(value) || strings.ContainsAny(value, " \t") {
+			return fmt.Errorf("sync.cgroup.%s: invalid value %q", name, value)
+		}
+	}
+	return nil
+}
+
+// lowerSyncPriority locks the calling goroutine to its thread and lowers
+// the CPU and IO priority of that thread as set by sync.nice and
+// sync.io_priority. Call it only first thing in a goroutine dedicated to
+// sync work: the thread stays locked and is discarded when the goroutine
+// exits, so the lowered priority never leaks into other goroutines. It
+// does not reach goroutines the sync goroutine starts either, such as
+// those of the HTTP transport, which must call it themselves.
+func lowerSyncPriority(config SyncConfig) {
+	nice := syncNice(config)
+	ioprio := 0
+	switch config.IOPriority {
+	case "", SyncIOPriorityLow:
+		ioprio = ioprioClassBestEff<<ioprioClassShift | ioprioLowestBestEff
+	case SyncIOPriorityIdle:
+		ioprio = ioprioClassIdle << ioprioClassShift
+	}
+	if nice == 0 && ioprio == 0 {
+		return
+	}
+
+	runtime.LockOSThread()
+	tid := syscall.Gettid()
+	if nice > 0 {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice); err != nil {
+			log.Printf("Warning: failed to lower the CPU priority of sync work: %v", err)
+		}
+	}
+	if ioprio != 0 {
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(ioprio)); errno != 0 {
+			log.Printf("Warning: failed to lower the IO priority of sync work: %v", errno)
+		}
+	}
+}
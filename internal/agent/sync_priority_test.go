@@ -0,0 +1,51 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestValidateSyncPriority(t *testing.T) {
+	zero, high := 0, 20
+	for _, config := range []SyncConfig{
+		{},
+		{Nice: &zero, IOPriority: SyncIOPriorityNormal},
+		{IOPriority: SyncIOPriorityIdle, Cgroup: SyncCgroupConfig{CPUQuota: "50%", IOWeight: 50, MemoryMax: "256M"}},
+	} {
+		if err := validateSyncPriority(config); err != nil {
+			t.Errorf("%+v: %v", config, err)
+		}
+	}
+	for _, config := range []SyncConfig{
+		{Nice: &high},
+		{IOPriority: "realtime"},
+		{Cgroup: SyncCgroupConfig{IOWeight: 20000}},
+		{Cgroup: SyncCgroupConfig{CPUQuota: "50%\nExecStart=/bin/sh"}},
+	} {
+		if err := validateSyncPriority(config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
+
+func TestLowerSyncPriority(t *testing.T) {
+	// Getpriority returns 20 - nice.
+	if prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, 0); err != nil || 20-prio >= DefaultSyncNice {
+		t.Skipf("the test already runs at nice %d", 20-prio)
+	}
+	nice := make(chan int)
+	go func() {
+		lowerSyncPriority(SyncConfig{})
+		prio, _ := syscall.Getpriority(syscall.PRIO_PROCESS, syscall.Gettid())
+		nice <- 20 - prio
+	}()
+	if got := <-nice; got != DefaultSyncNice {
+		t.Fatalf("sync thread nice = %d, want %d", got, DefaultSyncNice)
+	}
+	if prio, _ := syscall.Getpriority(syscall.PRIO_PROCESS, syscall.Gettid()); 20-prio >= DefaultSyncNice {
+		t.Fatalf("the priority leaked to another thread: nice %d", 20-prio)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncReportItem is one manifest item a sync downloaded, failed or skipped.
+type SyncReportItem struct {
+	ID              int64   `json:"id"`
+	Filename        string  `json:"filename"`
+	SizeBytes       int64   `json:"sizeBytes"`
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// SyncReportFile is a media file a sync moved to the trash.
+type SyncReportFile struct {
+	Path      string `json:"path"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+// SyncReport is the detailed result of one video sync. It is posted to
+// {core_api_base}/api/devicesync/sync-report and returned by
+// GET /api/sync/report.
+type SyncReport struct {
+	SessionID       string    `json:"sessionId"`
+	StartedAt       time.Time `json:"startedAt"`
+	FinishedAt      time.Time `json:"finishedAt"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	VerifySeconds   float64   `json:"verifySeconds"`
+	OK              bool      `json:"ok"`
+	Canceled        bool      `json:"canceled,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	// NotModified is set when the core answered 304 and no file was
+	// checked.
+	NotModified bool   `json:"notModified,omitempty"`
+	Source      string `json:"source"`
+	Items       int    `json:"items"`
+	Unchanged   int    `json:"unchanged"`
+	// Added items had no local file, Updated ones replaced a file that did
+	// not match the manifest.
+	Added   []SyncReportItem `json:"added"`
+	Updated []SyncReportItem `json:"updated"`
+	Failed  []SyncReportItem `json:"failed"`
+	// Skipped items were not downloaded: unsupported digest, over quota or
+	// quarantined.
+	Skipped         []SyncReportItem `json:"skipped"`
+	Removed         []SyncReportFile `json:"removed"`
+	DownloadedBytes int64            `json:"downloadedBytes"`
+	RemovedBytes    int64            `json:"removedBytes"`
+	DeletionBlocked bool             `json:"deletionBlocked,omitempty"`
+	// PlaybackDuringSync is set when playback was paused or lowered for
+	// the sync; see sync.playback_during_sync.
+	PlaybackDuringSync string `json:"playbackDuringSync,omitempty"`
+}
+
+// newSyncReport returns an empty report; the lists encode as [] rather
+// than null.
+func newSyncReport(source string, started time.Time) *SyncReport {
+	if source == "" {
+		source = SyncSourceCore
+	}
+	return &SyncReport{
+		StartedAt: started,
+		Source:    source,
+		Added:     []SyncReportItem{},
+		Updated:   []SyncReportItem{},
+		Failed:    []SyncReportItem{},
+		Skipped:   []SyncReportItem{},
+		Removed:   []SyncReportFile{},
+	}
+}
+
+func (r *SyncReport) skip(item ManifestItem, err error) {
+	r.Skipped = append(r.Skipped, SyncReportItem{ID: item.ID, Filename: item.Filename, SizeBytes: item.FileSizeBytes, Error: err.Error()})
+}
+
+// finish completes the report with the outcome of the sync.
+func (r *SyncReport) finish(err error) {
+	r.FinishedAt = time.Now()
+	r.DurationSeconds = r.FinishedAt.Sub(r.StartedAt).Seconds()
+	r.OK = err == nil
+	if err != nil {
+		r.Error = err.Error()
+		r.Canceled = errors.Is(err, context.Canceled)
+	}
+}
+
+var (
+	lastSyncReport     *SyncReport
+	lastSyncReportLock sync.Mutex
+)
+
+// postSyncReport delivers a report to the core. Tests may override it.
+var postSyncReport = func(config Config, report *SyncReport) {
+	ctx, cancel := context.WithTimeout(context.Background(), playlistTimeout())
+	defer cancel()
+	if err := sendSyncReport(ctx, config, report); err != nil {
+		log.Printf("Warning: failed to report sync result: %v", err)
+	}
+}
+
+// publishSyncReport keeps report for GET /api/sync/report and posts it to
+// the core unless sync.report_disabled is set.
+func publishSyncReport(config Config, report *SyncReport) {
+	lastSyncReportLock.Lock()
+	lastSyncReport = report
+	lastSyncReportLock.Unlock()
+
+	if config.Sync.ReportDisabled || config.CoreAPIBase == "" || config.ServerKey == "" {
+		return
+	}
+	go postSyncReport(config, report)
+}
+
+// sendSyncReport posts report to the core.
+func sendSyncReport(ctx context.Context, config Config, report *SyncReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(config.CoreAPIBase, "/") + "/api/devicesync/sync-report"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Device-Id", config.ServerKey)
+	req.Header.Set(syncSessionHeader, report.SessionID)
+
+	resp, err := getCoreClient().Do(ctx, req, playlistTimeout())
+	if err != nil {
+		return fmt.Errorf("post sync report: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// HandleSyncReport returns the report of the last video sync.
+func HandleSyncReport(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	lastSyncReportLock.Lock()
+	report := lastSyncReport
+	lastSyncReportLock.Unlock()
+	if report == nil {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Синхронизация ещё не выполнялась"})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: report})
+}
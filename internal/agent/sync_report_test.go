@@ -0,0 +1,91 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPerformSyncReportsResult(t *testing.T) {
+	setDownloadFailuresForTest(t)
+	mediaDir := t.TempDir()
+	for name, content := range map[string]string{"stale.mp4": "old", "kept.mp4": "kept", "changed.mp4": "xxx"} {
+		if err := os.WriteFile(filepath.Join(mediaDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := &fakeSyncSource{
+		batches: [][]ManifestItem{{
+			{ID: 1, Filename: "kept.mp4", FileSizeBytes: 4, SHA256: sha256Hex("kept")},
+			{ID: 2, Filename: "changed.mp4", FileSizeBytes: 3, SHA256: sha256Hex("new")},
+			{ID: 3, Filename: "added.mp4", FileSizeBytes: 5, SHA256: sha256Hex("added")},
+			{ID: 4, Filename: "broken.mp4", FileSizeBytes: 6, SHA256: sha256Hex("broken")},
+		}},
+		files: map[string]string{"changed.mp4": "new", "added.mp4": "added", "broken.mp4": "garble"},
+	}
+	setSyncSourceForTest(t, source)
+
+	reports := make(chan *SyncReport, 1)
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/devicesync/sync-report" || r.Header.Get("X-Device-Id") != "key" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var report SyncReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Error(err)
+		}
+		if r.Header.Get(syncSessionHeader) != report.SessionID {
+			t.Errorf("%s = %q, report session %q", syncSessionHeader, r.Header.Get(syncSessionHeader), report.SessionID)
+		}
+		reports <- &report
+	}))
+	defer core.Close()
+	setCurrentConfigForTest(t, Config{CoreAPIBase: core.URL, ServerKey: "key", Playlist: PlaylistConfig{Destination: mediaDir}})
+	setAppliedManifestValidators(GetCurrentConfig(), manifestValidators{})
+
+	if err := PerformSync(context.Background()); err == nil {
+		t.Fatal("expected the broken item to fail the sync")
+	}
+	report := <-reports
+	if report.SessionID == "" || GetSyncStatus().SessionID != report.SessionID {
+		t.Fatalf("report session %q, status session %q", report.SessionID, GetSyncStatus().SessionID)
+	}
+	if report.OK || report.Error == "" || report.Items != 4 || report.Unchanged != 1 || report.Source != SyncSourceCore {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if len(report.Added) != 1 || report.Added[0].ID != 3 || len(report.Updated) != 1 || report.Updated[0].ID != 2 {
+		t.Fatalf("added = %+v, updated = %+v", report.Added, report.Updated)
+	}
+	if len(report.Failed) != 1 || report.Failed[0].ID != 4 || report.Failed[0].Error == "" {
+		t.Fatalf("failed = %+v", report.Failed)
+	}
+	if report.DownloadedBytes != 8 || len(report.Removed) != 1 || report.Removed[0].Path != filepath.Join(mediaDir, "stale.mp4") || report.RemovedBytes != 3 {
+		t.Fatalf("unexpected bytes or removals %+v", report)
+	}
+
+	w := httptest.NewRecorder()
+	HandleSyncReport(w, httptest.NewRequest(http.MethodGet, "/api/sync/report", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+}
+
+func TestSyncReportDisabled(t *testing.T) {
+	original := postSyncReport
+	t.Cleanup(func() { postSyncReport = original })
+	posted := false
+	postSyncReport = func(Config, *SyncReport) { posted = true }
+
+	publishSyncReport(Config{CoreAPIBase: "https://core", ServerKey: "key", Sync: SyncConfig{ReportDisabled: true}}, newSyncReport("", time.Now()))
+	if posted {
+		t.Fatal("sync.report_disabled must stop the report")
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scopes of a manual sync, see SyncScopeRequest.
+const (
+	syncScopeVideos   = "videos"
+	syncScopePlaylist = "playlist"
+	syncScopeAll      = "all"
+	syncScopeItems    = "items"
+)
+
+// SyncScopeRequest is the optional body of POST /api/menu/video/start-upload.
+// Scope is "videos" (the default), "playlist", "all" or a list of manifest
+// IDs to download again.
+type SyncScopeRequest struct {
+	Scope json.RawMessage `json:"scope"`
+}
+
+type syncScope struct {
+	kind string
+	ids  []int64
+}
+
+// parseSyncScope decodes the scope of SyncScopeRequest.
+func parseSyncScope(raw json.RawMessage) (syncScope, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return syncScope{kind: syncScopeVideos}, nil
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		switch kind := strings.ToLower(strings.TrimSpace(name)); kind {
+		case "":
+			return syncScope{kind: syncScopeVideos}, nil
+		case syncScopeVideos, syncScopePlaylist, syncScopeAll:
+			return syncScope{kind: kind}, nil
+		}
+		return syncScope{}, fmt.Errorf("unknown scope %q", name)
+	}
+	var ids []int64
+	if err := json.Unmarshal(raw, &ids); err != nil || len(ids) == 0 {
+		return syncScope{}, errors.New("scope must be videos, playlist, all or a list of manifest IDs")
+	}
+	return syncScope{kind: syncScopeItems, ids: ids}, nil
+}
+
+// triggerScopedSync starts the sync of scope. Tests may override it.
+var triggerScopedSync = defaultTriggerScopedSync
+
+func defaultTriggerScopedSync(scope syncScope) error {
+	restart := func() error {
+		return RestartVideoPlayServiceWithLogs(context.Background(), "playlist sync")
+	}
+	switch scope.kind {
+	case syncScopePlaylist:
+		return TriggerPlaylistSync("manual", restart)
+	case syncScopeAll:
+		// Files first, so the new playlist finds everything it references.
+		return TriggerSync(func() {
+			if err := TriggerPlaylistSync("manual", restart); err != nil {
+				log.Printf("Failed to trigger playlist sync after video sync: %v", err)
+			}
+		})
+	case syncScopeItems:
+		return TriggerItemsSync(scope.ids)
+	}
+	return TriggerSync(nil)
+}
+
+// TriggerItemsSync downloads the manifest items ids again in the background,
+// whatever the state of their local files.
+func TriggerItemsSync(ids []int64) error {
+	if err := checkSyncPrerequisites(GetCurrentConfig()); err != nil {
+		return err
+	}
+
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	if syncCancel != nil {
+		syncCancel()
+	}
+	syncContext, syncCancel = context.WithCancel(context.Background())
+	ctx := syncContext
+
+	go func() {
+		lowerSyncPriority(GetCurrentConfig().Sync)
+		setVideoSyncRunning(true)
+		defer setVideoSyncRunning(false)
+		_ = PerformItemsSync(ctx, ids)
+	}()
+
+	return nil
+}
+
+// PerformItemsSync downloads the manifest items ids again. Unlike PerformSync
+// it neither verifies the rest of the library nor removes files, so support
+// can replace a corrupted file quickly.
+func PerformItemsSync(ctx context.Context, ids []int64) (err error) {
+	config := GetCurrentConfig()
+	session := newSyncSessionID()
+	ctx = withSyncSession(ctx, session)
+
+	log.Printf("Starting sync of manifest items %v (session %s)", ids, session)
+	publishEvent(EventSyncStarted, SyncEvent{Kind: "video", SessionID: session})
+	synced := 0
+	defer func() {
+		event := SyncEvent{Kind: "video", SessionID: session, Items: synced}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		publishEvent(EventSyncFinished, event)
+		if err != nil {
+			log.Printf("Sync of manifest items failed (session %s): %v", session, err)
+			return
+		}
+		log.Printf("Sync of manifest items completed (session %s): %d items", session, synced)
+	}()
+
+	source, err := newSyncSource(config)
+	if err != nil {
+		return err
+	}
+	if err := checkMediaStorage(config); err != nil {
+		return err
+	}
+
+	var items []ManifestItem
+	if _, err := source.Manifest(ctx, manifestValidators{}, func(batch []ManifestItem) error {
+		for _, item := range batch {
+			if slices.Contains(ids, item.ID) {
+				items = append(items, item)
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+
+	var downloadErrors []string
+	for _, id := range ids {
+		if !slices.ContainsFunc(items, func(item ManifestItem) bool { return item.ID == id }) {
+			downloadErrors = append(downloadErrors, fmt.Sprintf("item %d: not in the manifest", id))
+		}
+	}
+	fetch := itemFetcherFor(source)
+	tags := syncTagSet(config)
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !validManifestFilename(item) || !matchesSyncTags(item, tags) {
+			downloadErrors = append(downloadErrors, fmt.Sprintf("%s: not synced to this device", item.Filename))
+			continue
+		}
+		if err := redownloadItem(ctx, config, item, fetch); err != nil {
+			downloadErrors = append(downloadErrors, fmt.Sprintf("%s: %v", item.Filename, err))
+			continue
+		}
+		synced++
+	}
+	persistVerifyCache()
+
+	if len(downloadErrors) > 0 {
+		return fmt.Errorf("download errors: %v", downloadErrors)
+	}
+	return nil
+}
+
+// redownloadItem replaces the local file of item with a fresh download.
+func redownloadItem(ctx context.Context, config Config, item ManifestItem, fetch fetchItemFunc) error {
+	if _, err := newItemVerifier(item); err != nil {
+		return err
+	}
+	if err := waitForThermalHeadroom(ctx, config.Sync); err != nil {
+		return err
+	}
+	fullPath := mediaItemPath(config, item)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+
+	var err error
+	if config.Sync.ContentStore {
+		// A stored copy is reused only after full verification.
+		err = syncItemViaContentStore(ctx, config, mediaKindDir(config, mediaKindOf(item)), item, fullPath, fetch)
+	} else {
+		log.Printf("Downloading %s again (ID: %d, size: %d bytes)", item.Filename, item.ID, item.FileSizeBytes)
+		err = fetch(ctx, config, item, fullPath)
+	}
+	if err != nil {
+		return err
+	}
+	if fullVerifyInterval(config.Sync) >= 0 {
+		recordVerification(fullPath, item, time.Now())
+	}
+	return nil
+}
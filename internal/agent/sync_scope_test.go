@@ -0,0 +1,125 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSyncScope(t *testing.T) {
+	for raw, want := range map[string]syncScope{
+		``:           {kind: syncScopeVideos},
+		`null`:       {kind: syncScopeVideos},
+		`"Playlist"`: {kind: syncScopePlaylist},
+		`"all"`:      {kind: syncScopeAll},
+		`[12, 34]`:   {kind: syncScopeItems, ids: []int64{12, 34}},
+	} {
+		got, err := parseSyncScope(json.RawMessage(raw))
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("parseSyncScope(%s) = %+v, %v, want %+v", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{`"images"`, `[]`, `["12"]`, `{}`} {
+		if _, err := parseSyncScope(json.RawMessage(raw)); err == nil {
+			t.Errorf("parseSyncScope(%s): expected an error", raw)
+		}
+	}
+}
+
+func TestPerformItemsSyncRedownloadsOnlyRequestedItems(t *testing.T) {
+	resetDeletionGuardForTest(t)
+	mediaDir := t.TempDir()
+	// one.mp4 is corrupted with the right size, two.mp4 and an unrelated
+	// file stay as they are.
+	if err := os.WriteFile(filepath.Join(mediaDir, "one.mp4"), []byte("bad"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeMediaFilesForTest(t, mediaDir, "two.mp4", "stale.mp4")
+	source := &fakeSyncSource{
+		batches: [][]ManifestItem{
+			{{ID: 1, Filename: "one.mp4", FileSizeBytes: 3, SHA256: sha256Hex("one")}},
+			{{ID: 2, Filename: "two.mp4", FileSizeBytes: 3, SHA256: sha256Hex("two")}},
+		},
+		files: map[string]string{"one.mp4": "one", "two.mp4": "two"},
+	}
+	setSyncSourceForTest(t, source)
+	setCurrentConfigForTest(t, Config{ServerKey: "key", Playlist: PlaylistConfig{Destination: mediaDir}})
+
+	err := PerformItemsSync(context.Background(), []int64{1, 7})
+	if err == nil || !strings.Contains(err.Error(), "item 7: not in the manifest") {
+		t.Fatalf("expected an error for the unknown item, got %v", err)
+	}
+	if !reflect.DeepEqual(source.fetched, []string{"one.mp4"}) {
+		t.Fatalf("fetched = %v", source.fetched)
+	}
+	if data, _ := os.ReadFile(filepath.Join(mediaDir, "one.mp4")); string(data) != "one" {
+		t.Fatalf("expected one.mp4 replaced, got %q", data)
+	}
+	for _, name := range []string{"two.mp4", "stale.mp4"} {
+		if data, _ := os.ReadFile(filepath.Join(mediaDir, name)); string(data) != "old" {
+			t.Errorf("expected %s untouched, got %q", name, data)
+		}
+	}
+}
+
+func TestPerformItemsSyncSendsSyncSession(t *testing.T) {
+	mediaDir := t.TempDir()
+	var sessions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sessions = append(sessions, r.Header.Get(syncSessionHeader))
+		switch r.URL.Path {
+		case "/api/devicesync":
+			_, _ = w.Write([]byte(`[{"id": 1, "filename": "one.mp4", "fileSizeBytes": 3, "sha256": "` + sha256Hex("one") + `"}]`))
+		default:
+			_, _ = w.Write([]byte("one"))
+		}
+	}))
+	defer server.Close()
+	setCurrentConfigForTest(t, Config{
+		CoreAPIBase: server.URL,
+		ServerKey:   "key",
+		Playlist:    PlaylistConfig{Destination: mediaDir},
+	})
+
+	if err := PerformItemsSync(context.Background(), []int64{1}); err != nil {
+		t.Fatal(err)
+	}
+	// The manifest and the download belong to one session.
+	if len(sessions) != 2 || sessions[0] == "" || sessions[1] != sessions[0] {
+		t.Fatalf("%s of the requests = %q", syncSessionHeader, sessions)
+	}
+}
+
+func TestHandleVideoStartUploadScope(t *testing.T) {
+	var got []syncScope
+	original := triggerScopedSync
+	triggerScopedSync = func(scope syncScope) error { got = append(got, scope); return nil }
+	t.Cleanup(func() { triggerScopedSync = original })
+
+	for _, body := range []string{"", `{"scope":"all"}`, `{"scope":[5]}`} {
+		w := httptest.NewRecorder()
+		HandleVideoStartUpload(w, httptest.NewRequest(http.MethodPost, "/api/menu/video/start-upload", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("body %q: expected status 200, got %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+	want := []syncScope{{kind: syncScopeVideos}, {kind: syncScopeAll}, {kind: syncScopeItems, ids: []int64{5}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("scopes = %+v, want %+v", got, want)
+	}
+
+	w := httptest.NewRecorder()
+	HandleVideoStartUpload(w, httptest.NewRequest(http.MethodPost, "/api/menu/video/start-upload", strings.NewReader(`{"scope":"everything"}`)))
+	if w.Code != http.StatusBadRequest || len(got) != 3 {
+		t.Fatalf("expected status 400 for an unknown scope, got %d", w.Code)
+	}
+}
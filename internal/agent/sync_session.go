@@ -0,0 +1,36 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+// syncSessionHeader carries the session ID of a sync run on every request
+// to the core, so core logs can be matched with device reports.
+const syncSessionHeader = "X-Sync-Session-Id"
+
+type syncSessionKey struct{}
+
+// newSyncSessionID returns a random (version 4) UUID.
+func newSyncSessionID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:]) // never fails since Go 1.24
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// withSyncSession tags ctx with the session ID of a sync run.
+func withSyncSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, syncSessionKey{}, id)
+}
+
+// syncSessionFrom returns the session ID ctx was tagged with, if any.
+func syncSessionFrom(ctx context.Context) string {
+	id, _ := ctx.Value(syncSessionKey{}).(string)
+	return id
+}
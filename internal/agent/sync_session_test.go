@@ -0,0 +1,43 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestNewSyncSessionID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first, second := newSyncSessionID(), newSyncSessionID()
+	if !uuid.MatchString(first) || first == second {
+		t.Fatalf("session ids %q, %q", first, second)
+	}
+}
+
+func TestCoreClientSendsSyncSession(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(syncSessionHeader)
+	}))
+	defer server.Close()
+	client, err := NewCoreClient(HTTPClientConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := withSyncSession(context.Background(), "session-1")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := client.Do(ctx, req, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if got != "session-1" {
+		t.Fatalf("%s = %q", syncSessionHeader, got)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// SyncSource supplies the manifest and the file content of video sync.
+// The core API is the default source; sync.source selects another one.
+type SyncSource interface {
+	// Key identifies where content comes from. Cached manifest validators
+	// are only reused while the key stays the same.
+	Key() string
+
+	// Manifest passes the manifest to apply in one or more batches. It
+	// sends previous as cache validators and returns errManifestNotModified
+	// when nothing changed since then.
+	Manifest(ctx context.Context, previous manifestValidators, apply func([]ManifestItem) error) (manifestValidators, error)
+
+	// Fetch writes item to destPath. It must verify size and SHA256 before
+	// the file appears under its final name.
+	Fetch(ctx context.Context, item ManifestItem, destPath string) error
+}
+
+// SyncSourceCore is the sync.source value of the core API, also used when
+// sync.source is empty.
+const SyncSourceCore = "core"
+
+// newSyncSource builds the source selected by sync.source. Tests may
+// override it.
+var newSyncSource = defaultSyncSource
+
+func defaultSyncSource(config Config) (SyncSource, error) {
+	switch strings.ToLower(strings.TrimSpace(config.Sync.Source)) {
+	case "", SyncSourceCore:
+		return coreSyncSource{config: config}, nil
+	case SyncSourceS3:
+		return newS3SyncSource(config.Sync.S3)
+	case SyncSourceSFTP:
+		return newSFTPSyncSource(config.Sync.SFTP)
+	default:
+		return nil, fmt.Errorf("unknown sync source %q", config.Sync.Source)
+	}
+}
+
+// itemFetcherFor adapts source to the file syncer. LAN peers are still
+// tried first when peer sharing is enabled.
+func itemFetcherFor(source SyncSource) fetchItemFunc {
+	fetch := func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		return source.Fetch(ctx, item, destPath)
+	}
+	return func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		return fetchPreferringPeers(ctx, config, item, destPath, fetch)
+	}
+}
+
+// coreSyncSource reads the manifest from /api/devicesync and downloads
+// files from /api/devicesync/{id}.
+type coreSyncSource struct {
+	config Config
+}
+
+func (s coreSyncSource) Key() string {
+	return s.config.CoreAPIBase
+}
+
+func (s coreSyncSource) Manifest(ctx context.Context, previous manifestValidators, apply func([]ManifestItem) error) (manifestValidators, error) {
+	if s.config.Sync.ManifestPageSize > 0 {
+		return fetchPagedManifest(ctx, s.config, previous, apply)
+	}
+	manifest, validators, err := fetchManifestConditional(ctx, s.config, previous)
+	if err != nil {
+		return validators, err
+	}
+	log.Printf("Manifest fetched: %d items", len(*manifest))
+	return validators, apply(*manifest)
+}
+
+func (s coreSyncSource) Fetch(ctx context.Context, item ManifestItem, destPath string) error {
+	return downloadFile(ctx, s.config, item, destPath)
+}
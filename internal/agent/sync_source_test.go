@@ -0,0 +1,129 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSyncSource serves batches of items with content from files.
+type fakeSyncSource struct {
+	batches    [][]ManifestItem
+	files      map[string]string
+	validators manifestValidators
+	fetched    []string
+}
+
+func (s *fakeSyncSource) Key() string { return "fake" }
+
+func (s *fakeSyncSource) Manifest(ctx context.Context, previous manifestValidators, apply func([]ManifestItem) error) (manifestValidators, error) {
+	if previous.ETag != "" && previous == s.validators {
+		return previous, errManifestNotModified
+	}
+	for _, batch := range s.batches {
+		if err := apply(batch); err != nil {
+			return manifestValidators{}, err
+		}
+	}
+	return s.validators, nil
+}
+
+func (s *fakeSyncSource) Fetch(ctx context.Context, item ManifestItem, destPath string) error {
+	s.fetched = append(s.fetched, item.Filename)
+	return writeVerifiedContent(strings.NewReader(s.files[item.Filename]), item, destPath)
+}
+
+func setSyncSourceForTest(t *testing.T, source SyncSource) {
+	t.Helper()
+	original := newSyncSource
+	newSyncSource = func(Config) (SyncSource, error) { return source, nil }
+	t.Cleanup(func() { newSyncSource = original })
+}
+
+func TestPerformSyncUsesConfiguredSource(t *testing.T) {
+	mediaDir := t.TempDir()
+	stale := filepath.Join(mediaDir, "stale.mp4")
+	if err := os.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := &fakeSyncSource{
+		batches: [][]ManifestItem{
+			{{ID: 1, Filename: "one.mp4", FileSizeBytes: 3, SHA256: sha256Hex("one")}},
+			{{ID: 2, Filename: "two.mp4", FileSizeBytes: 3, SHA256: sha256Hex("two")}},
+		},
+		files:      map[string]string{"one.mp4": "one", "two.mp4": "two"},
+		validators: manifestValidators{ETag: `"v1"`},
+	}
+	setSyncSourceForTest(t, source)
+	setCurrentConfigForTest(t, Config{ServerKey: "key", Playlist: PlaylistConfig{Destination: mediaDir}})
+	setAppliedManifestValidators(GetCurrentConfig(), manifestValidators{})
+
+	if err := PerformSync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"one.mp4", "two.mp4"} {
+		if data, err := os.ReadFile(filepath.Join(mediaDir, name)); err != nil || string(data) != strings.TrimSuffix(name, ".mp4") {
+			t.Errorf("expected %s from the source, got %q, %v", name, data, err)
+		}
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected stale file collected, stat err = %v", err)
+	}
+	if got := getAppliedManifestValidators(GetCurrentConfig()); got != source.validators {
+		t.Fatalf("applied validators = %+v", got)
+	}
+
+	// The source reports no change: nothing is fetched again.
+	source.fetched = nil
+	if err := PerformSync(context.Background()); err != nil || len(source.fetched) != 0 {
+		t.Fatalf("expected unchanged manifest to skip the pass, fetched %v, %v", source.fetched, err)
+	}
+}
+
+func TestDefaultSyncSource(t *testing.T) {
+	for _, name := range []string{"", "core", " Core "} {
+		source, err := defaultSyncSource(Config{CoreAPIBase: "https://core", Sync: SyncConfig{Source: name}})
+		if err != nil {
+			t.Fatalf("source %q: %v", name, err)
+		}
+		if _, ok := source.(coreSyncSource); !ok || source.Key() != "https://core" {
+			t.Fatalf("source %q = %#v", name, source)
+		}
+	}
+	if _, err := defaultSyncSource(Config{Sync: SyncConfig{Source: "ftp"}}); err == nil {
+		t.Fatal("expected unknown source to be rejected")
+	}
+
+	// The cache key of the core source is unchanged, so validators
+	// persisted by earlier versions stay valid.
+	config := Config{CoreAPIBase: "https://core", Playlist: PlaylistConfig{Destination: "/var/media-pi"}}
+	if key := manifestCacheKey(config); key != "https://core|/var/media-pi" {
+		t.Fatalf("manifestCacheKey = %q", key)
+	}
+	// Tags and media directories change which items are admitted.
+	tagged := config
+	tagged.Sync.Tags = []string{" Lobby", "hall", "lobby"}
+	if key := manifestCacheKey(tagged); key != "https://core|/var/media-pi|tags=hall,lobby" {
+		t.Fatalf("manifestCacheKey with tags = %q", key)
+	}
+	split := config
+	split.Storage.Images = MediaDirConfig{Dir: "/mnt/images", QuotaMB: 100}
+	if key := manifestCacheKey(split); key != "https://core|/var/media-pi|image=/mnt/images:100" {
+		t.Fatalf("manifestCacheKey with media dirs = %q", key)
+	}
+}
+
+func TestLoadConfigRejectsUnknownSyncSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	if err := os.WriteFile(path, []byte("server_key: key\nsync:\n  source: ftp\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfigFrom(path); err == nil || !strings.Contains(err.Error(), "unknown sync source") {
+		t.Fatalf("expected unknown sync source error, got %v", err)
+	}
+}
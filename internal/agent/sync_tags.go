@@ -0,0 +1,53 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"net/url"
+	"strings"
+)
+
+// syncTagSet returns the normalized sync.tags of config, or nil when the
+// device syncs the whole group library.
+func syncTagSet(config Config) map[string]struct{} {
+	var tags map[string]struct{}
+	for _, tag := range config.Sync.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if tags == nil {
+			tags = make(map[string]struct{})
+		}
+		tags[tag] = struct{}{}
+	}
+	return tags
+}
+
+// syncTagsQuery returns the manifest query carrying sync.tags so the core
+// can return only the relevant part of the catalog.
+func syncTagsQuery(config Config) url.Values {
+	query := url.Values{}
+	for _, tag := range config.Sync.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			query.Add("tag", tag)
+		}
+	}
+	return query
+}
+
+// matchesSyncTags reports whether item belongs to the configured subset.
+// Items without tags are shared by all devices; filtering also applies
+// locally in case the core ignores the query.
+func matchesSyncTags(item ManifestItem, tags map[string]struct{}) bool {
+	if len(tags) == 0 || len(item.Tags) == 0 {
+		return true
+	}
+	for _, tag := range item.Tags {
+		if _, ok := tags[strings.ToLower(strings.TrimSpace(tag))]; ok {
+			return true
+		}
+	}
+	return false
+}
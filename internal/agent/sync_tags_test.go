@@ -0,0 +1,70 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFetchManifestSendsSyncTags(t *testing.T) {
+	var gotTags []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTags = r.URL.Query()["tag"]
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	config := Config{
+		CoreAPIBase: server.URL,
+		ServerKey:   "test-key",
+		Sync:        SyncConfig{Tags: []string{"moscow", " lobby ", ""}},
+	}
+	if _, _, err := fetchManifestConditional(context.Background(), config, manifestValidators{}); err != nil {
+		t.Fatalf("fetchManifestConditional() error = %v", err)
+	}
+	if want := []string{"moscow", "lobby"}; !reflect.DeepEqual(gotTags, want) {
+		t.Fatalf("tag query = %v, want %v", gotTags, want)
+	}
+}
+
+func TestSyncFilesSkipsItemsOutsideSyncTags(t *testing.T) {
+	tmpDir := t.TempDir()
+	stale := filepath.Join(tmpDir, "other.mp4")
+	if err := os.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "data"
+	manifest := &Manifest{
+		{ID: 1, Filename: "shared.mp4", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content)},
+		{ID: 2, Filename: "lobby.mp4", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content), Tags: []string{"Lobby"}},
+		{ID: 3, Filename: "other.mp4", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content), Tags: []string{"hall"}},
+	}
+
+	var fetched []string
+	fetch := func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		fetched = append(fetched, item.Filename)
+		return os.WriteFile(destPath, []byte(content), 0644)
+	}
+	config := Config{
+		Playlist: PlaylistConfig{Destination: tmpDir},
+		Sync:     SyncConfig{Tags: []string{"lobby"}},
+	}
+	if err := syncFilesFrom(context.Background(), config, manifest, fetch); err != nil {
+		t.Fatalf("syncFilesFrom() error = %v", err)
+	}
+
+	if want := []string{"shared.mp4", "lobby.mp4"}; !reflect.DeepEqual(fetched, want) {
+		t.Fatalf("fetched = %v, want %v", fetched, want)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected file outside tags to be garbage collected, stat err = %v", err)
+	}
+}
@@ -4,7 +4,10 @@
 package agent
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,8 +16,11 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestFetchManifest(t *testing.T) {
@@ -685,6 +691,10 @@ func TestTriggerPlaylistSyncMarksStoppedBeforeCallback(t *testing.T) {
 	resetPlaylistActivationForTest(t)
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/devicesync/calendar" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
 		if r.URL.Path != "/api/devicesync/playlist" {
 			t.Errorf("unexpected path: %s", r.URL.Path)
 		}
@@ -1588,3 +1598,241 @@ func TestUniqueOutputPath(t *testing.T) {
 		t.Errorf("expected %q, got %q", want2, got)
 	}
 }
+
+func setCurrentConfigForTest(t *testing.T, cfg Config) {
+	t.Helper()
+	configMutex.Lock()
+	original := currentConfig
+	currentConfig = &cfg
+	configMutex.Unlock()
+	t.Cleanup(func() {
+		configMutex.Lock()
+		currentConfig = original
+		configMutex.Unlock()
+	})
+}
+
+func TestPerformSyncSkipsFilePassWhenManifestNotModified(t *testing.T) {
+	t.Cleanup(func() { setAppliedManifestValidators(Config{}, manifestValidators{}) })
+	mediaDir := t.TempDir()
+
+	var conditionalRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/devicesync" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditionalRequests++
+			if r.Header.Get("If-Modified-Since") != "Fri, 02 Jan 2026 10:00:00 GMT" {
+				t.Errorf("unexpected If-Modified-Since: %q", r.Header.Get("If-Modified-Since"))
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Fri, 02 Jan 2026 10:00:00 GMT")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	setCurrentConfigForTest(t, Config{
+		CoreAPIBase: server.URL,
+		ServerKey:   "test-key",
+		Playlist:    PlaylistConfig{Destination: mediaDir},
+		Sync:        SyncConfig{ReportDisabled: true},
+	})
+
+	if err := PerformSync(context.Background()); err != nil {
+		t.Fatalf("first PerformSync() error = %v", err)
+	}
+
+	// A stray file would be garbage collected by a full pass; a 304 must leave it alone.
+	stray := filepath.Join(mediaDir, "stray.mp4")
+	if err := os.WriteFile(stray, []byte("x"), 0644); err != nil {
+		t.Fatalf("write stray: %v", err)
+	}
+
+	if err := PerformSync(context.Background()); err != nil {
+		t.Fatalf("second PerformSync() error = %v", err)
+	}
+	if conditionalRequests != 1 {
+		t.Fatalf("expected one conditional request, got %d", conditionalRequests)
+	}
+	if _, err := os.Stat(stray); err != nil {
+		t.Fatalf("expected file pass to be skipped, stray file missing: %v", err)
+	}
+	if !GetSyncStatus().OK {
+		t.Fatalf("expected sync status OK after 304")
+	}
+}
+
+func TestPerformSyncVerifiesFilesWhenFullVerifyIsDue(t *testing.T) {
+	t.Cleanup(func() { setAppliedManifestValidators(Config{}, manifestValidators{}) })
+	mediaDir := t.TempDir()
+	sum := sha256.Sum256([]byte("abc"))
+
+	var conditionalRequests, unconditionalRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/devicesync":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				conditionalRequests++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			unconditionalRequests++
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = fmt.Fprintf(w, `[{"id": 1, "filename": "a.mp4", "fileSizeBytes": 3, "sha256": "%x"}]`, sum)
+		default:
+			_, _ = w.Write([]byte("abc"))
+		}
+	}))
+	defer server.Close()
+
+	setCurrentConfigForTest(t, Config{
+		CoreAPIBase: server.URL,
+		ServerKey:   "test-key",
+		Playlist:    PlaylistConfig{Destination: mediaDir},
+		Sync:        SyncConfig{ReportDisabled: true},
+	})
+
+	if err := PerformSync(context.Background()); err != nil {
+		t.Fatalf("first PerformSync() error = %v", err)
+	}
+	local := filepath.Join(mediaDir, "a.mp4")
+	if err := os.WriteFile(local, []byte("corrupted"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within full_verify_interval the core answers 304 and the corrupted
+	// file is not noticed.
+	if err := PerformSync(context.Background()); err != nil {
+		t.Fatalf("second PerformSync() error = %v", err)
+	}
+	if conditionalRequests != 1 {
+		t.Fatalf("expected one conditional request, got %d", conditionalRequests)
+	}
+
+	// Once the interval has passed the manifest is fetched without
+	// validators and the file is verified and repaired.
+	appliedManifestLock.Lock()
+	appliedManifestPassAt = time.Now().Add(-DefaultFullVerifyInterval)
+	appliedManifestLock.Unlock()
+	if err := PerformSync(context.Background()); err != nil {
+		t.Fatalf("third PerformSync() error = %v", err)
+	}
+	if conditionalRequests != 1 || unconditionalRequests != 2 {
+		t.Fatalf("requests: %d conditional, %d unconditional", conditionalRequests, unconditionalRequests)
+	}
+	if data, err := os.ReadFile(local); err != nil || string(data) != "abc" {
+		t.Fatalf("expected the corrupted file to be repaired, got %q, %v", data, err)
+	}
+
+	// The first sync after startup has no full pass yet and sends no
+	// validators either.
+	appliedManifestLock.Lock()
+	appliedManifestPassAt = time.Time{}
+	appliedManifestLock.Unlock()
+	if err := PerformSync(context.Background()); err != nil {
+		t.Fatalf("fourth PerformSync() error = %v", err)
+	}
+	if unconditionalRequests != 3 {
+		t.Fatalf("expected an unconditional request after startup, got %d", unconditionalRequests)
+	}
+}
+
+func TestPerformSyncDoesNotReuseValidatorsAfterFailure(t *testing.T) {
+	t.Cleanup(func() { setAppliedManifestValidators(Config{}, manifestValidators{}) })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/devicesync":
+			if r.Header.Get("If-None-Match") != "" {
+				t.Errorf("validators must not be sent after a failed sync")
+			}
+			w.Header().Set("ETag", `"v2"`)
+			_, _ = w.Write([]byte(`[{"id": 1, "filename": "a.mp4", "fileSizeBytes": 3, "sha256": "bad"}]`))
+		default:
+			_, _ = w.Write([]byte("abc"))
+		}
+	}))
+	defer server.Close()
+
+	setCurrentConfigForTest(t, Config{
+		CoreAPIBase: server.URL,
+		ServerKey:   "test-key",
+		Playlist:    PlaylistConfig{Destination: t.TempDir()},
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := PerformSync(context.Background()); err == nil {
+			t.Fatalf("expected sync %d to fail on hash mismatch", i)
+		}
+	}
+}
+
+func TestDownloadFileDecodesContentEncoding(t *testing.T) {
+	content := strings.Repeat("compressible overlay html ", 64)
+	encoders := map[string]func(string) []byte{
+		"gzip": func(data string) []byte {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			_, _ = zw.Write([]byte(data))
+			_ = zw.Close()
+			return buf.Bytes()
+		},
+		"zstd": func(data string) []byte {
+			enc, _ := zstd.NewWriter(nil)
+			defer func() { _ = enc.Close() }()
+			return enc.EncodeAll([]byte(data), nil)
+		},
+		"identity": func(data string) []byte { return []byte(data) },
+	}
+
+	for encoding, encode := range encoders {
+		t.Run(encoding, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Accept-Encoding"); got != acceptedDownloadEncodings {
+					t.Errorf("Accept-Encoding = %q, want %q", got, acceptedDownloadEncodings)
+				}
+				w.Header().Set("Content-Encoding", encoding)
+				_, _ = w.Write(encode(content))
+			}))
+			defer server.Close()
+
+			item := ManifestItem{ID: 3, Filename: "overlay.html", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content)}
+			destPath := filepath.Join(t.TempDir(), "overlay.html")
+			config := Config{CoreAPIBase: server.URL, ServerKey: "test-key"}
+			if err := downloadFile(context.Background(), config, item, destPath); err != nil {
+				t.Fatalf("downloadFile() error = %v", err)
+			}
+			data, err := os.ReadFile(destPath)
+			if err != nil || string(data) != content {
+				t.Fatalf("decoded content mismatch: %v", err)
+			}
+		})
+	}
+}
+
+func TestDownloadFileRejectsUnsupportedEncodingAndOversizedStreams(t *testing.T) {
+	content := "payload"
+	var encoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", encoding)
+		_, _ = w.Write([]byte(content + content))
+	}))
+	defer server.Close()
+
+	config := Config{CoreAPIBase: server.URL, ServerKey: "test-key"}
+	item := ManifestItem{ID: 1, Filename: "a.bin", FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content)}
+
+	encoding = "br"
+	if err := downloadFile(context.Background(), config, item, filepath.Join(t.TempDir(), "a.bin")); err == nil || !strings.Contains(err.Error(), "unsupported content encoding") {
+		t.Fatalf("expected unsupported encoding error, got %v", err)
+	}
+
+	encoding = ""
+	if err := downloadFile(context.Background(), config, item, filepath.Join(t.TempDir(), "a.bin")); err == nil || !strings.Contains(err.Error(), "file size mismatch") {
+		t.Fatalf("expected size mismatch for oversized body, got %v", err)
+	}
+}
@@ -0,0 +1,681 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sync-play keeps the players of a video wall in step. The master answers
+// NTP-style timestamp exchanges over UDP with its playback position;
+// followers estimate the clock offset to the master from the exchanges and
+// nudge their mpv player (speed, then seek) until the position is within
+// sync_play.tolerance of the master's.
+
+// Roles of sync_play.role.
+const (
+	SyncPlayRoleMaster   = "master"
+	SyncPlayRoleFollower = "follower"
+)
+
+// Defaults for synchronized playback.
+const (
+	DefaultSyncPlayPort      = 47800
+	DefaultSyncPlayTolerance = 40 * time.Millisecond
+	DefaultSyncPlayInterval  = time.Second
+)
+
+const (
+	// syncPlayMDNSServiceType advertises masters so followers find the
+	// master of their group without a configured address.
+	syncPlayMDNSServiceType = "_mediapi-wall._udp"
+
+	// syncPlaySeekThreshold is the drift corrected by seeking; smaller
+	// drift is corrected by playing slightly faster or slower.
+	syncPlaySeekThreshold = time.Second
+	// syncPlayMaxSpeedChange bounds the speed correction, which stays
+	// unnoticeable to viewers.
+	syncPlayMaxSpeedChange = 0.05
+	// syncPlayCatchUp is how long a speed correction takes to absorb drift.
+	syncPlayCatchUp = 2 * time.Second
+	// syncPlaySamples is how many exchanges the offset is estimated from;
+	// the one with the shortest round trip is used.
+	syncPlaySamples = 8
+	// syncPlayReplyTimeout bounds the wait for the master.
+	syncPlayReplyTimeout = 500 * time.Millisecond
+	// syncPlayFollowerTTL is how long a follower counts as connected after
+	// its last exchange.
+	syncPlayFollowerTTL = 10 * time.Second
+)
+
+const (
+	metricSyncPlayOffset      = "media_pi_syncplay_offset_seconds"
+	metricSyncPlayDrift       = "media_pi_syncplay_drift_seconds"
+	metricSyncPlayCorrections = "media_pi_syncplay_corrections_total"
+)
+
+func init() {
+	registerGauge(metricSyncPlayOffset, "Estimated clock offset of the video wall master relative to this device, in seconds.")
+	registerGauge(metricSyncPlayDrift, "Playback position of this follower minus the master's, in seconds.")
+	registerCounter(metricSyncPlayCorrections, "Seeks and speed changes made to follow the video wall master.")
+}
+
+// SyncPlayConfig configures synchronized playback across devices.
+type SyncPlayConfig struct {
+	Enabled bool   `yaml:"enabled,omitempty"`
+	Role    string `yaml:"role,omitempty"`
+	// Group names the video wall; a master only answers its own group.
+	Group string `yaml:"group,omitempty"`
+	// Master is the host:port of the master. Without it followers find the
+	// master of their group over mDNS.
+	Master    string        `yaml:"master,omitempty"`
+	Port      int           `yaml:"port,omitempty"`
+	Tolerance time.Duration `yaml:"tolerance,omitempty"`
+	Interval  time.Duration `yaml:"interval,omitempty"`
+}
+
+// syncPlayPosition is a sample of the player position. SampledAt is in
+// Unix nanoseconds of the clock of the device that took it.
+type syncPlayPosition struct {
+	PlaylistPos int     `json:"playlistPos"`
+	TimePos     float64 `json:"timePos"`
+	Paused      bool    `json:"paused"`
+	SampledAt   int64   `json:"sampledAt"`
+}
+
+// syncPlayPacket is a request from a follower (T1 set) or the master's
+// reply (T2, T3 and Position set). Times are Unix nanoseconds.
+type syncPlayPacket struct {
+	Group    string            `json:"group"`
+	T1       int64             `json:"t1"`
+	T2       int64             `json:"t2,omitempty"`
+	T3       int64             `json:"t3,omitempty"`
+	Position *syncPlayPosition `json:"position,omitempty"`
+}
+
+// SyncPlayStatus is returned by GET /api/playback/sync.
+type SyncPlayStatus struct {
+	Role   string `json:"role"`
+	Group  string `json:"group"`
+	Master string `json:"master,omitempty"`
+	// Followers counts followers seen recently by a master.
+	Followers     int     `json:"followers,omitempty"`
+	OffsetSeconds float64 `json:"offsetSeconds"`
+	DelaySeconds  float64 `json:"delaySeconds"`
+	DriftSeconds  float64 `json:"driftSeconds"`
+	Speed         float64 `json:"speed,omitempty"`
+	Corrections   int64   `json:"corrections"`
+	LastSync      string  `json:"lastSync,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// syncPlayPlayer controls the local player.
+type syncPlayPlayer interface {
+	position(ctx context.Context) (syncPlayPosition, error)
+	seek(ctx context.Context, playlistPos int, timePos float64) error
+	setSpeed(ctx context.Context, speed float64) error
+	setPause(ctx context.Context, paused bool) error
+}
+
+var (
+	// syncPlayNow is the clock used for timestamps. Tests may override it.
+	syncPlayNow = time.Now
+
+	// newSyncPlayPlayer returns the player of socket. Tests may override it.
+	newSyncPlayPlayer = func(socket string) syncPlayPlayer { return mpvSyncPlayPlayer{socket: socket} }
+
+	syncPlayLock   sync.Mutex
+	syncPlayCancel context.CancelFunc
+	syncPlayStatus *SyncPlayStatus
+)
+
+func syncPlayPort(config SyncPlayConfig) int {
+	if config.Port > 0 {
+		return config.Port
+	}
+	return DefaultSyncPlayPort
+}
+
+func syncPlayTolerance(config SyncPlayConfig) time.Duration {
+	if config.Tolerance > 0 {
+		return config.Tolerance
+	}
+	return DefaultSyncPlayTolerance
+}
+
+func syncPlayInterval(config SyncPlayConfig) time.Duration {
+	if config.Interval > 0 {
+		return config.Interval
+	}
+	return DefaultSyncPlayInterval
+}
+
+// validateSyncPlay checks sync_play.
+func validateSyncPlay(config SyncPlayConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	if config.Role != SyncPlayRoleMaster && config.Role != SyncPlayRoleFollower {
+		return fmt.Errorf("sync_play.role: unknown role %q, expected %s or %s", config.Role, SyncPlayRoleMaster, SyncPlayRoleFollower)
+	}
+	if strings.TrimSpace(config.Group) == "" {
+		return errors.New("sync_play.group is required")
+	}
+	if config.Port < 0 || config.Port > 65535 {
+		return fmt.Errorf("sync_play.port %d is out of range", config.Port)
+	}
+	if config.Master != "" {
+		if _, _, err := net.SplitHostPort(config.Master); err != nil {
+			return fmt.Errorf("sync_play.master: %w", err)
+		}
+	}
+	return nil
+}
+
+// syncPlayMDNSService advertises a master of its group.
+func syncPlayMDNSService(config Config) (mdnsService, bool) {
+	if !config.SyncPlay.Enabled || config.SyncPlay.Role != SyncPlayRoleMaster {
+		return mdnsService{}, false
+	}
+	id := deviceInstanceID(config)
+	return mdnsService{
+		Instance: id,
+		Service:  syncPlayMDNSServiceType,
+		Port:     syncPlayPort(config.SyncPlay),
+		TXT:      []string{"id=" + id, "group=" + config.SyncPlay.Group},
+	}, true
+}
+
+// ntpOffset returns the offset of the master clock relative to the local
+// one and the network round trip of an exchange sent at t1, received by the
+// master at t2, answered at t3 and received back at t4.
+func ntpOffset(t1, t2, t3, t4 int64) (offset, delay time.Duration) {
+	offset = time.Duration(((t2 - t1) + (t3 - t4)) / 2)
+	delay = time.Duration((t4 - t1) - (t3 - t2))
+	return offset, delay
+}
+
+// syncPlayCorrection decides how a follower corrects drift, its position
+// minus the master's: nothing within tolerance, a seek beyond
+// syncPlaySeekThreshold, otherwise a speed that absorbs the drift in about
+// syncPlayCatchUp.
+func syncPlayCorrection(drift, tolerance time.Duration) (seek bool, speed float64) {
+	abs := drift
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs <= tolerance:
+		return false, 1
+	case abs >= syncPlaySeekThreshold:
+		return true, 1
+	}
+	change := drift.Seconds() / syncPlayCatchUp.Seconds()
+	change = math.Max(-syncPlayMaxSpeedChange, math.Min(syncPlayMaxSpeedChange, change))
+	return false, 1 - change
+}
+
+// expectedPosition returns where the master is at local time now, given
+// the clock offset.
+func expectedPosition(master syncPlayPosition, offset time.Duration, now time.Time) float64 {
+	if master.Paused {
+		return master.TimePos
+	}
+	elapsed := time.Duration(now.Add(offset).UnixNano() - master.SampledAt)
+	return master.TimePos + elapsed.Seconds()
+}
+
+// syncPlayMaster answers followers with the latest position of its player.
+type syncPlayMaster struct {
+	group  string
+	player syncPlayPlayer
+
+	mu        sync.Mutex
+	latest    *syncPlayPosition
+	followers map[string]time.Time
+}
+
+// sample records the current position of the player.
+func (m *syncPlayMaster) sample(ctx context.Context) error {
+	pos, err := m.player.position(ctx)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.latest = nil
+		return err
+	}
+	m.latest = &pos
+	return nil
+}
+
+// reply builds the answer to a follower request received at recv, or nil
+// for packets of other groups or without a position to share.
+func (m *syncPlayMaster) reply(request []byte, from string, recv time.Time) []byte {
+	var packet syncPlayPacket
+	if err := json.Unmarshal(request, &packet); err != nil || packet.Group != m.group || packet.T1 == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	if m.followers == nil {
+		m.followers = map[string]time.Time{}
+	}
+	m.followers[from] = recv
+	latest := m.latest
+	m.mu.Unlock()
+	if latest == nil {
+		return nil
+	}
+	packet.T2 = recv.UnixNano()
+	packet.Position = latest
+	packet.T3 = syncPlayNow().UnixNano()
+	data, _ := json.Marshal(packet)
+	return data
+}
+
+func (m *syncPlayMaster) followerCount(now time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for addr, seen := range m.followers {
+		if now.Sub(seen) > syncPlayFollowerTTL {
+			delete(m.followers, addr)
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// serve answers requests on conn until ctx is done.
+func (m *syncPlayMaster) serve(ctx context.Context, conn net.PacketConn) {
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	buf := make([]byte, 2048)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		recv := syncPlayNow()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Warning: sync-play master stopped: %v", err)
+			}
+			return
+		}
+		if data := m.reply(buf[:n], addr.String(), recv); data != nil {
+			_, _ = conn.WriteTo(data, addr)
+		}
+	}
+}
+
+// syncPlayOffsetSample is the result of one timestamp exchange.
+type syncPlayOffsetSample struct {
+	offset, delay time.Duration
+}
+
+// syncPlayFollower follows the master of its group.
+type syncPlayFollower struct {
+	group     string
+	tolerance time.Duration
+	player    syncPlayPlayer
+	// master resolves the address of the master.
+	master func(ctx context.Context) (string, error)
+
+	samples []syncPlayOffsetSample
+	speed   float64
+}
+
+// exchange sends one request to addr and returns the master's reply and
+// the local receive time.
+func (f *syncPlayFollower) exchange(ctx context.Context, addr string) (syncPlayPacket, time.Time, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return syncPlayPacket{}, time.Time{}, err
+	}
+	defer func() { _ = conn.Close() }()
+	sent := syncPlayPacket{Group: f.group, T1: syncPlayNow().UnixNano()}
+	request, _ := json.Marshal(sent)
+	_ = conn.SetDeadline(time.Now().Add(syncPlayReplyTimeout))
+	if _, err := conn.Write(request); err != nil {
+		return syncPlayPacket{}, time.Time{}, err
+	}
+	buf := make([]byte, 2048)
+	for {
+		n, err := conn.Read(buf)
+		recv := syncPlayNow()
+		if err != nil {
+			return syncPlayPacket{}, time.Time{}, fmt.Errorf("no reply from master %s: %w", addr, err)
+		}
+		var reply syncPlayPacket
+		if json.Unmarshal(buf[:n], &reply) == nil && reply.T1 == sent.T1 && reply.Position != nil {
+			return reply, recv, nil
+		}
+	}
+}
+
+// offset records a sample and returns the one of the last
+// syncPlaySamples with the shortest round trip, whose offset is the most
+// accurate.
+func (f *syncPlayFollower) offset(sample syncPlayOffsetSample) syncPlayOffsetSample {
+	f.samples = append(f.samples, sample)
+	if len(f.samples) > syncPlaySamples {
+		f.samples = f.samples[len(f.samples)-syncPlaySamples:]
+	}
+	best := f.samples[0]
+	for _, s := range f.samples[1:] {
+		if s.delay < best.delay {
+			best = s
+		}
+	}
+	return best
+}
+
+// step runs one exchange with the master and corrects the local player.
+func (f *syncPlayFollower) step(ctx context.Context, status *SyncPlayStatus) error {
+	addr, err := f.master(ctx)
+	if err != nil {
+		return err
+	}
+	status.Master = addr
+	reply, recv, err := f.exchange(ctx, addr)
+	if err != nil {
+		return err
+	}
+	offset, delay := ntpOffset(reply.T1, reply.T2, reply.T3, recv.UnixNano())
+	best := f.offset(syncPlayOffsetSample{offset: offset, delay: delay})
+	status.OffsetSeconds = best.offset.Seconds()
+	status.DelaySeconds = best.delay.Seconds()
+	metricSet(metricSyncPlayOffset, status.OffsetSeconds)
+
+	local, err := f.player.position(ctx)
+	if err != nil {
+		return fmt.Errorf("player position: %w", err)
+	}
+	master := *reply.Position
+	if local.Paused != master.Paused {
+		if err := f.player.setPause(ctx, master.Paused); err != nil {
+			return err
+		}
+		metricAdd(metricSyncPlayCorrections, 1)
+		status.Corrections++
+	}
+	expected := expectedPosition(master, best.offset, time.Unix(0, local.SampledAt))
+	if local.PlaylistPos != master.PlaylistPos {
+		// Another file: the position difference is meaningless.
+		return f.seek(ctx, status, master.PlaylistPos, expected+best.delay.Seconds()/2)
+	}
+	drift := time.Duration((local.TimePos - expected) * float64(time.Second))
+	status.DriftSeconds = drift.Seconds()
+	metricSet(metricSyncPlayDrift, status.DriftSeconds)
+
+	seek, speed := syncPlayCorrection(drift, f.tolerance)
+	if seek {
+		return f.seek(ctx, status, master.PlaylistPos, expected)
+	}
+	return f.setSpeed(ctx, status, speed)
+}
+
+func (f *syncPlayFollower) seek(ctx context.Context, status *SyncPlayStatus, playlistPos int, timePos float64) error {
+	if err := f.player.seek(ctx, playlistPos, math.Max(timePos, 0)); err != nil {
+		return fmt.Errorf("seek: %w", err)
+	}
+	metricAdd(metricSyncPlayCorrections, 1)
+	status.Corrections++
+	return f.setSpeed(ctx, status, 1)
+}
+
+func (f *syncPlayFollower) setSpeed(ctx context.Context, status *SyncPlayStatus, speed float64) error {
+	if f.speed == 0 {
+		f.speed = 1
+	}
+	status.Speed = speed
+	if speed == f.speed {
+		return nil
+	}
+	if err := f.player.setSpeed(ctx, speed); err != nil {
+		return fmt.Errorf("set speed: %w", err)
+	}
+	if speed != 1 {
+		metricAdd(metricSyncPlayCorrections, 1)
+		status.Corrections++
+	}
+	f.speed = speed
+	return nil
+}
+
+// syncPlayMasterResolver returns sync_play.master or discovers the master
+// of the group over mDNS.
+func syncPlayMasterResolver(config Config) func(ctx context.Context) (string, error) {
+	if addr := strings.TrimSpace(config.SyncPlay.Master); addr != "" {
+		return func(context.Context) (string, error) { return addr, nil }
+	}
+	var cached string
+	return func(ctx context.Context) (string, error) {
+		if cached != "" {
+			return cached, nil
+		}
+		timeout := config.Peer.DiscoveryTimeout
+		if timeout <= 0 {
+			timeout = DefaultPeerDiscoveryTimeout
+		}
+		found, err := browsePeers(ctx, syncPlayMDNSServiceType, timeout)
+		if err != nil {
+			return "", fmt.Errorf("discover master: %w", err)
+		}
+		var masters []string
+		for _, peer := range found {
+			if peer.TXT["group"] == config.SyncPlay.Group {
+				masters = append(masters, peer.Addr)
+			}
+		}
+		if len(masters) == 0 {
+			return "", fmt.Errorf("no master of group %q found", config.SyncPlay.Group)
+		}
+		sort.Strings(masters)
+		if len(masters) > 1 {
+			log.Printf("Warning: %d masters of group %q, following %s", len(masters), config.SyncPlay.Group, masters[0])
+		}
+		cached = masters[0]
+		return cached, nil
+	}
+}
+
+// updateSyncPlayStatus changes status unless StopSyncPlay replaced it.
+func updateSyncPlayStatus(status *SyncPlayStatus, update func(status *SyncPlayStatus)) {
+	syncPlayLock.Lock()
+	defer syncPlayLock.Unlock()
+	if syncPlayStatus == status {
+		update(status)
+	}
+}
+
+// StartSyncPlay runs the master or follower of sync_play when enabled. The
+// player needs player.ipc_socket; with several outputs the first one is
+// synchronized.
+func StartSyncPlay() error {
+	StopSyncPlay()
+	config := GetCurrentConfig()
+	if !config.SyncPlay.Enabled {
+		return nil
+	}
+	sockets := playerIPCSockets(config)
+	if len(sockets) == 0 {
+		return errors.New("sync_play needs player.ipc_socket of an mpv player")
+	}
+	player := newSyncPlayPlayer(sockets[0])
+	interval := syncPlayInterval(config.SyncPlay)
+	status := &SyncPlayStatus{Role: config.SyncPlay.Role, Group: config.SyncPlay.Group}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var run func()
+	switch config.SyncPlay.Role {
+	case SyncPlayRoleMaster:
+		conn, err := net.ListenPacket("udp", ":"+strconv.Itoa(syncPlayPort(config.SyncPlay)))
+		if err != nil {
+			cancel()
+			return fmt.Errorf("listen for sync-play followers: %w", err)
+		}
+		master := &syncPlayMaster{group: config.SyncPlay.Group, player: player}
+		go master.serve(ctx, conn)
+		run = func() {
+			err := master.sample(ctx)
+			updateSyncPlayStatus(status, func(s *SyncPlayStatus) {
+				s.Followers = master.followerCount(syncPlayNow())
+				s.Error = ""
+				if err != nil {
+					s.Error = err.Error()
+				} else {
+					s.LastSync = syncPlayNow().UTC().Format(time.RFC3339)
+				}
+			})
+		}
+	default:
+		follower := &syncPlayFollower{
+			group:     config.SyncPlay.Group,
+			tolerance: syncPlayTolerance(config.SyncPlay),
+			player:    player,
+			master:    syncPlayMasterResolver(config),
+		}
+		run = func() {
+			var snapshot SyncPlayStatus
+			updateSyncPlayStatus(status, func(s *SyncPlayStatus) { snapshot = *s })
+			err := follower.step(ctx, &snapshot)
+			snapshot.Error = ""
+			if err != nil {
+				snapshot.Error = err.Error()
+			} else {
+				snapshot.LastSync = syncPlayNow().UTC().Format(time.RFC3339)
+			}
+			updateSyncPlayStatus(status, func(s *SyncPlayStatus) { *s = snapshot })
+		}
+	}
+
+	syncPlayLock.Lock()
+	syncPlayCancel = cancel
+	syncPlayStatus = status
+	syncPlayLock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			run()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Printf("Sync-play %s of group %q started", config.SyncPlay.Role, config.SyncPlay.Group)
+	return nil
+}
+
+// StopSyncPlay stops synchronized playback.
+func StopSyncPlay() {
+	syncPlayLock.Lock()
+	defer syncPlayLock.Unlock()
+	if syncPlayCancel != nil {
+		syncPlayCancel()
+		syncPlayCancel = nil
+	}
+	syncPlayStatus = nil
+}
+
+// HandleSyncPlayStatus reports synchronized playback (GET).
+func HandleSyncPlayStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	syncPlayLock.Lock()
+	var status *SyncPlayStatus
+	if syncPlayStatus != nil {
+		snapshot := *syncPlayStatus
+		status = &snapshot
+	}
+	syncPlayLock.Unlock()
+	if status == nil {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Синхронное воспроизведение не включено"})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: status})
+}
+
+// mpvSyncPlayPlayer controls mpv through its JSON IPC socket.
+type mpvSyncPlayPlayer struct {
+	socket string
+}
+
+func (p mpvSyncPlayPlayer) position(ctx context.Context) (syncPlayPosition, error) {
+	conn, err := dialMPV(ctx, p.socket)
+	if err != nil {
+		return syncPlayPosition{}, err
+	}
+	defer func() { _ = conn.Close() }()
+	var pos syncPlayPosition
+	for _, property := range []struct {
+		name string
+		dest any
+	}{
+		{"playlist-pos", &pos.PlaylistPos},
+		{"pause", &pos.Paused},
+		{"time-pos", &pos.TimePos},
+	} {
+		data, err := conn.command([]any{"get_property", property.name})
+		if err != nil {
+			return syncPlayPosition{}, fmt.Errorf("%s: %w", property.name, err)
+		}
+		if err := json.Unmarshal(data, property.dest); err != nil {
+			return syncPlayPosition{}, fmt.Errorf("%s: %w", property.name, err)
+		}
+	}
+	// time-pos is read last, so the sample time belongs to it.
+	pos.SampledAt = syncPlayNow().UnixNano()
+	return pos, nil
+}
+
+func (p mpvSyncPlayPlayer) seek(ctx context.Context, playlistPos int, timePos float64) error {
+	conn, err := dialMPV(ctx, p.socket)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	current, err := conn.command([]any{"get_property", "playlist-pos"})
+	if err != nil {
+		return err
+	}
+	if string(current) != strconv.Itoa(playlistPos) {
+		if _, err := conn.command([]any{"set_property", "playlist-pos", playlistPos}); err != nil {
+			return err
+		}
+		// Seek once the file is loaded.
+		_, err = conn.command([]any{"set_property", "start", strconv.FormatFloat(timePos, 'f', 3, 64)})
+		return err
+	}
+	_, err = conn.command([]any{"seek", timePos, "absolute+exact"})
+	return err
+}
+
+func (p mpvSyncPlayPlayer) setSpeed(ctx context.Context, speed float64) error {
+	_, err := mpvCommand(ctx, p.socket, []any{"set_property", "speed", speed})
+	return err
+}
+
+func (p mpvSyncPlayPlayer) setPause(ctx context.Context, paused bool) error {
+	_, err := mpvCommand(ctx, p.socket, []any{"set_property", "pause", paused})
+	return err
+}
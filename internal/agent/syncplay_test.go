@@ -0,0 +1,256 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeSyncPlayPlayer struct {
+	mu    sync.Mutex
+	pos   syncPlayPosition
+	speed float64
+	ops   []string
+}
+
+func (p *fakeSyncPlayPlayer) position(context.Context) (syncPlayPosition, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pos := p.pos
+	pos.SampledAt = syncPlayNow().UnixNano()
+	return pos, nil
+}
+
+func (p *fakeSyncPlayPlayer) seek(_ context.Context, playlistPos int, timePos float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pos.PlaylistPos, p.pos.TimePos = playlistPos, timePos
+	p.ops = append(p.ops, fmt.Sprintf("seek %d %.2f", playlistPos, timePos))
+	return nil
+}
+
+func (p *fakeSyncPlayPlayer) setSpeed(_ context.Context, speed float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.speed = speed
+	p.ops = append(p.ops, fmt.Sprintf("speed %.3f", speed))
+	return nil
+}
+
+func (p *fakeSyncPlayPlayer) setPause(_ context.Context, paused bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pos.Paused = paused
+	p.ops = append(p.ops, fmt.Sprintf("pause %v", paused))
+	return nil
+}
+
+func (p *fakeSyncPlayPlayer) operations() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.ops...)
+}
+
+func TestNTPOffset(t *testing.T) {
+	// The master clock is 5s ahead; each direction takes 10ms and the
+	// master answers after 2ms.
+	t1 := int64(1_000_000_000)
+	t2 := t1 + int64(5*time.Second+10*time.Millisecond)
+	t3 := t2 + int64(2*time.Millisecond)
+	t4 := t1 + int64(22*time.Millisecond)
+	offset, delay := ntpOffset(t1, t2, t3, t4)
+	if offset != 5*time.Second || delay != 20*time.Millisecond {
+		t.Fatalf("ntpOffset = %v, %v", offset, delay)
+	}
+}
+
+func TestSyncPlayCorrection(t *testing.T) {
+	for _, tc := range []struct {
+		drift time.Duration
+		seek  bool
+		speed float64
+	}{
+		{30 * time.Millisecond, false, 1},
+		{-40 * time.Millisecond, false, 1},
+		{60 * time.Millisecond, false, 0.97},
+		{-60 * time.Millisecond, false, 1.03},
+		{500 * time.Millisecond, false, 0.95},
+		{-2 * time.Second, true, 1},
+	} {
+		seek, speed := syncPlayCorrection(tc.drift, 40*time.Millisecond)
+		if seek != tc.seek || fmt.Sprintf("%.3f", speed) != fmt.Sprintf("%.3f", tc.speed) {
+			t.Errorf("syncPlayCorrection(%v) = %v, %v, want %v, %v", tc.drift, seek, speed, tc.seek, tc.speed)
+		}
+	}
+}
+
+func TestFollowerOffsetUsesShortestRoundTrip(t *testing.T) {
+	f := &syncPlayFollower{}
+	f.offset(syncPlayOffsetSample{offset: 3 * time.Millisecond, delay: 2 * time.Millisecond})
+	if best := f.offset(syncPlayOffsetSample{offset: 50 * time.Millisecond, delay: 90 * time.Millisecond}); best.offset != 3*time.Millisecond {
+		t.Fatalf("expected the sample with the shortest round trip, got %+v", best)
+	}
+	for range syncPlaySamples {
+		f.offset(syncPlayOffsetSample{offset: time.Millisecond, delay: 5 * time.Millisecond})
+	}
+	if len(f.samples) != syncPlaySamples || f.samples[0].delay != 5*time.Millisecond {
+		t.Fatalf("expected old samples to be dropped, got %+v", f.samples)
+	}
+}
+
+func TestValidateSyncPlay(t *testing.T) {
+	for name, config := range map[string]SyncPlayConfig{
+		"role":   {Enabled: true, Role: "leader", Group: "wall"},
+		"group":  {Enabled: true, Role: SyncPlayRoleMaster},
+		"port":   {Enabled: true, Role: SyncPlayRoleMaster, Group: "wall", Port: 70000},
+		"master": {Enabled: true, Role: SyncPlayRoleFollower, Group: "wall", Master: "10.0.0.5"},
+	} {
+		if err := validateSyncPlay(config); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if err := validateSyncPlay(SyncPlayConfig{Enabled: true, Role: SyncPlayRoleFollower, Group: "wall", Master: "10.0.0.5:47800"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateSyncPlay(SyncPlayConfig{Role: "leader"}); err != nil {
+		t.Fatalf("disabled sync_play is not validated: %v", err)
+	}
+}
+
+func TestSyncPlayMDNSService(t *testing.T) {
+	config := Config{ServerKey: "key", SyncPlay: SyncPlayConfig{Enabled: true, Role: SyncPlayRoleMaster, Group: "lobby"}}
+	svc, ok := syncPlayMDNSService(config)
+	if !ok || svc.Service != syncPlayMDNSServiceType || svc.Port != DefaultSyncPlayPort || !strings.Contains(strings.Join(svc.TXT, " "), "group=lobby") {
+		t.Fatalf("unexpected service %+v, %v", svc, ok)
+	}
+	config.SyncPlay.Role = SyncPlayRoleFollower
+	if _, ok := syncPlayMDNSService(config); ok {
+		t.Fatal("followers are not advertised")
+	}
+}
+
+func startSyncPlayMasterForTest(t *testing.T, player syncPlayPlayer) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	master := &syncPlayMaster{group: "wall", player: player}
+	if err := master.sample(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go master.serve(ctx, conn)
+	return conn.LocalAddr().String()
+}
+
+func TestSyncPlayFollowerStep(t *testing.T) {
+	masterPlayer := &fakeSyncPlayPlayer{pos: syncPlayPosition{PlaylistPos: 2, TimePos: 100}}
+	addr := startSyncPlayMasterForTest(t, masterPlayer)
+
+	// Far behind: seek to the master position.
+	local := &fakeSyncPlayPlayer{pos: syncPlayPosition{PlaylistPos: 2, TimePos: 90}}
+	f := &syncPlayFollower{
+		group:     "wall",
+		tolerance: 40 * time.Millisecond,
+		player:    local,
+		master:    func(context.Context) (string, error) { return addr, nil },
+	}
+	var status SyncPlayStatus
+	if err := f.step(t.Context(), &status); err != nil {
+		t.Fatal(err)
+	}
+	ops := local.operations()
+	if len(ops) != 1 || !strings.HasPrefix(ops[0], "seek 2 100.") || status.Corrections != 1 || status.Master != addr {
+		t.Fatalf("operations = %v, status = %+v", ops, status)
+	}
+	if status.DriftSeconds > -9 {
+		t.Fatalf("expected drift of about -10s, got %v", status.DriftSeconds)
+	}
+
+	// Another file: follow the master to it.
+	local.pos = syncPlayPosition{PlaylistPos: 0, TimePos: 5}
+	if err := f.step(t.Context(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if ops := local.operations(); !strings.HasPrefix(ops[len(ops)-1], "seek 2 100.") {
+		t.Fatalf("operations = %v", ops)
+	}
+
+	// The master pauses: pause too.
+	masterPlayer.pos.Paused = true
+	addr = startSyncPlayMasterForTest(t, masterPlayer)
+	local.pos = syncPlayPosition{PlaylistPos: 2, TimePos: 100}
+	if err := f.step(t.Context(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if ops := local.operations(); ops[len(ops)-1] != "pause true" {
+		t.Fatalf("operations = %v", ops)
+	}
+}
+
+func TestSyncPlayMasterIgnoresOtherGroups(t *testing.T) {
+	master := &syncPlayMaster{group: "wall", player: &fakeSyncPlayPlayer{}}
+	if err := master.sample(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if reply := master.reply([]byte(`{"group":"other","t1":1}`), "10.0.0.2:1", now); reply != nil {
+		t.Fatalf("unexpected reply %s", reply)
+	}
+	if reply := master.reply([]byte(`{"group":"wall","t1":1}`), "10.0.0.3:1", now); reply == nil {
+		t.Fatal("expected a reply to the group")
+	}
+	if n := master.followerCount(now); n != 1 {
+		t.Fatalf("followerCount = %d, want 1", n)
+	}
+	if n := master.followerCount(now.Add(syncPlayFollowerTTL + time.Second)); n != 0 {
+		t.Fatalf("followerCount = %d after the TTL, want 0", n)
+	}
+}
+
+func TestHandleSyncPlayStatus(t *testing.T) {
+	StopSyncPlay()
+	w := httptest.NewRecorder()
+	HandleSyncPlayStatus(w, httptest.NewRequest(http.MethodGet, "/api/playback/sync", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 while disabled, got %d", w.Code)
+	}
+
+	original := newSyncPlayPlayer
+	newSyncPlayPlayer = func(string) syncPlayPlayer { return &fakeSyncPlayPlayer{} }
+	t.Cleanup(func() {
+		newSyncPlayPlayer = original
+		StopSyncPlay()
+	})
+	setCurrentConfigForTest(t, Config{
+		Player:   PlayerConfig{IPCSocket: "/run/media-pi/mpv.sock"},
+		SyncPlay: SyncPlayConfig{Enabled: true, Role: SyncPlayRoleFollower, Group: "wall", Master: "127.0.0.1:9", Interval: time.Hour},
+	})
+	if err := StartSyncPlay(); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	HandleSyncPlayStatus(w, httptest.NewRequest(http.MethodGet, "/api/playback/sync", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"role":"follower"`) || !strings.Contains(w.Body.String(), `"group":"wall"`) {
+		t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStartSyncPlayNeedsIPCSocket(t *testing.T) {
+	setCurrentConfigForTest(t, Config{SyncPlay: SyncPlayConfig{Enabled: true, Role: SyncPlayRoleMaster, Group: "wall"}})
+	if err := StartSyncPlay(); err == nil {
+		StopSyncPlay()
+		t.Fatal("expected an error without player.ipc_socket")
+	}
+}
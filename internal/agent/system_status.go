@@ -0,0 +1,40 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"net/http"
+	"time"
+)
+
+// SystemStatusResponse describes the device state returned by
+// /api/system/status.
+type SystemStatusResponse struct {
+	Version    string            `json:"version"`
+	Time       string            `json:"time"`
+	Clock      ClockStatus       `json:"clock"`
+	Brightness *BrightnessStatus `json:"brightness,omitempty"`
+	Power      *PowerStatus      `json:"power,omitempty"`
+	WireGuard  *WireGuardStatus  `json:"wireguard,omitempty"`
+}
+
+// getSystemStatus collects the device state.
+func getSystemStatus() SystemStatusResponse {
+	return SystemStatusResponse{
+		Version:    GetVersion(),
+		Time:       time.Now().UTC().Format(time.RFC3339),
+		Clock:      getClockStatus(GetCurrentConfig()),
+		Brightness: getBrightnessStatus(),
+		Power:      getPowerStatus(),
+		WireGuard:  getWireGuardStatus(),
+	}
+}
+
+// HandleSystemStatus returns the device state.
+func HandleSystemStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getSystemStatus()})
+}
@@ -0,0 +1,343 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// takeoverDropInName overrides ExecStart of the playback units while a
+// takeover is active, so whatever starts play.video.service during the
+// takeover (schedule, playlist sync, API) plays the emergency asset.
+const takeoverDropInName = "media-pi-takeover.conf"
+
+const metricTakeoverActive = "media_pi_takeover_active"
+
+func init() {
+	registerGauge(metricTakeoverActive, "1 while an emergency takeover preempts the playlist.")
+}
+
+var (
+	// takeoverStateFilePath persists the takeover across restarts.
+	takeoverStateFilePath = filepath.Join(agentStateDir, "takeover.json")
+
+	// takeoverWatchInterval is how often a running takeover makes sure
+	// playback is on, e.g. after a rest schedule stopped it.
+	takeoverWatchInterval = 30 * time.Second
+
+	takeoverLock        sync.Mutex
+	takeoverState       TakeoverState
+	takeoverWatchCancel context.CancelFunc
+)
+
+// TakeoverState describes the emergency takeover.
+type TakeoverState struct {
+	Active    bool   `json:"active"`
+	Asset     string `json:"asset,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	StartedAt string `json:"startedAt,omitempty"`
+	// PlaybackWasActive is restored when the takeover is cleared.
+	PlaybackWasActive bool `json:"playbackWasActive,omitempty"`
+}
+
+// TakeoverRequest is the body of POST /api/playback/takeover.
+type TakeoverRequest struct {
+	// Asset is an already synced media file relative to the media
+	// directory.
+	Asset  string `json:"asset"`
+	Reason string `json:"reason"`
+}
+
+// takeoverAssetPath validates asset and returns its absolute path.
+func takeoverAssetPath(config Config, asset string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(strings.TrimSpace(asset)))
+	if rel == "." || filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid asset %q", asset)
+	}
+	path, ok := resolveMediaPath(config, rel)
+	if !ok {
+		return "", fmt.Errorf("invalid asset %q", asset)
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", fmt.Errorf("asset %s is not synced to this device", filepath.ToSlash(rel))
+	}
+	return path, nil
+}
+
+// takeoverDropIns renders one drop-in per playback unit playing path.
+func takeoverDropIns(config Config, path string) map[string]string {
+	render := func(args string) string {
+		command := playerCommand(config)
+		if args != "" {
+			command += " " + args
+		}
+		return fmt.Sprintf("[Service]\nExecStart=\nExecStart=%s %s\n", command, SanitizeSystemdValue(path))
+	}
+	if len(config.Displays) == 0 {
+		return map[string]string{playbackServiceUnit: render("")}
+	}
+	dropIns := make(map[string]string, len(config.Displays))
+	for _, display := range config.Displays {
+		dropIns[playbackUnitForOutput(display.Output)] = render(displayPlayerArgs(display))
+	}
+	return dropIns
+}
+
+func takeoverDropInPath(unit string) string {
+	return filepath.Join(SystemdUnitDir, unit+".d", takeoverDropInName)
+}
+
+func writeTakeoverDropIns(config Config, path string) error {
+	for unit, content := range takeoverDropIns(config, path) {
+		if err := writePlaybackDropIn(unit, takeoverDropInName, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTakeoverDropIns removes the drop-ins of every playback unit,
+// including outputs configured since the takeover started.
+func removeTakeoverDropIns() error {
+	return removePlaybackDropIns(takeoverDropInName)
+}
+
+// writePlaybackDropIn atomically writes the drop-in name of unit.
+func writePlaybackDropIn(unit, name, content string) error {
+	return writeSystemFile(filepath.Join(SystemdUnitDir, unit+".d", name), content)
+}
+
+// removePlaybackDropIns removes the drop-in name from every playback unit.
+func removePlaybackDropIns(name string) error {
+	paths, _ := filepath.Glob(filepath.Join(SystemdUnitDir, "play.video*.service.d", name))
+	for _, path := range paths {
+		if err := removeSystemFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reloadAndRunPlayback reloads systemd and runs operation on
+// play.video.service.
+func reloadAndRunPlayback(parent context.Context, operation dbusUnitOperation) error {
+	connCtx, cancelConn := context.WithTimeout(parent, dbusTimeout())
+	defer cancelConn()
+	conn, err := getDBusConnection(connCtx)
+	if err != nil {
+		return fmt.Errorf("connect to D-Bus: %w", err)
+	}
+	defer conn.Close()
+
+	reloadCtx, cancel := context.WithTimeout(parent, dbusTimeout())
+	defer cancel()
+	if err := conn.ReloadContext(reloadCtx); err != nil {
+		return fmt.Errorf("daemon reload: %w", err)
+	}
+	if _, err := runDBusUnitOperation(parent, conn, operation, playbackServiceUnit); err != nil {
+		return fmt.Errorf("%s %s: %w", operation, playbackServiceUnit, err)
+	}
+	return nil
+}
+
+func setTakeoverStateLocked(state TakeoverState) {
+	takeoverState = state
+	if state.Active {
+		metricSet(metricTakeoverActive, 1)
+	} else {
+		metricSet(metricTakeoverActive, 0)
+	}
+	if err := writeStateFile(takeoverStateFilePath, state); err != nil {
+		log.Printf("Warning: failed to persist takeover state: %v", err)
+	}
+}
+
+// StartTakeover preempts the playlist with asset on every output and loops
+// it until ClearTakeover. Starting a takeover during another one replaces
+// the asset but keeps the playback state to restore.
+func StartTakeover(ctx context.Context, config Config, req TakeoverRequest) (TakeoverState, error) {
+	path, err := takeoverAssetPath(config, req.Asset)
+	if err != nil {
+		return TakeoverState{}, err
+	}
+
+	takeoverLock.Lock()
+	defer takeoverLock.Unlock()
+
+	state := TakeoverState{
+		Active:            true,
+		Asset:             filepath.ToSlash(filepath.Clean(filepath.FromSlash(strings.TrimSpace(req.Asset)))),
+		Reason:            strings.TrimSpace(req.Reason),
+		StartedAt:         time.Now().UTC().Format(time.RFC3339),
+		PlaybackWasActive: takeoverState.PlaybackWasActive,
+	}
+	if !takeoverState.Active {
+		if status, err := getServiceStatus(ctx); err == nil {
+			state.PlaybackWasActive = status.PlaybackServiceStatus
+		}
+	}
+
+	if err := writeTakeoverDropIns(config, path); err != nil {
+		return TakeoverState{}, fmt.Errorf("write takeover drop-ins: %w", err)
+	}
+	if err := reloadAndRunPlayback(ctx, dbusUnitOperationRestart); err != nil {
+		_ = removeTakeoverDropIns()
+		return TakeoverState{}, err
+	}
+	setTakeoverStateLocked(state)
+	startTakeoverWatchLocked()
+	log.Printf("Emergency takeover started with %s (reason: %q)", state.Asset, state.Reason)
+	return state, nil
+}
+
+// ClearTakeover ends the takeover and restores playback as it was before.
+func ClearTakeover(ctx context.Context) (TakeoverState, error) {
+	takeoverLock.Lock()
+	defer takeoverLock.Unlock()
+
+	previous := takeoverState
+	if !previous.Active {
+		return previous, nil
+	}
+	stopTakeoverWatchLocked()
+	if err := removeTakeoverDropIns(); err != nil {
+		return previous, fmt.Errorf("remove takeover drop-ins: %w", err)
+	}
+	operation := dbusUnitOperationStop
+	if previous.PlaybackWasActive {
+		operation = dbusUnitOperationRestart
+	}
+	err := reloadAndRunPlayback(ctx, operation)
+	setTakeoverStateLocked(TakeoverState{})
+	if err != nil {
+		return previous, err
+	}
+	log.Printf("Emergency takeover with %s cleared", previous.Asset)
+	return previous, nil
+}
+
+// IsTakeoverActive reports whether an emergency takeover is on screen.
+func IsTakeoverActive() bool {
+	takeoverLock.Lock()
+	defer takeoverLock.Unlock()
+	return takeoverState.Active
+}
+
+func getTakeoverState() TakeoverState {
+	takeoverLock.Lock()
+	defer takeoverLock.Unlock()
+	return takeoverState
+}
+
+// startTakeoverWatchLocked keeps playback running while the takeover is
+// active. Callers hold takeoverLock.
+func startTakeoverWatchLocked() {
+	if takeoverWatchCancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	takeoverWatchCancel = cancel
+	interval := takeoverWatchInterval
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			status, err := getServiceStatus(ctx)
+			if err != nil || status.PlaybackServiceStatus || ctx.Err() != nil {
+				continue
+			}
+			log.Println("Playback stopped during emergency takeover, starting it again")
+			if err := startPlaybackService(ctx); err != nil {
+				log.Printf("Warning: failed to restart takeover playback: %v", err)
+			}
+		}
+	}()
+}
+
+func stopTakeoverWatchLocked() {
+	if takeoverWatchCancel != nil {
+		takeoverWatchCancel()
+		takeoverWatchCancel = nil
+	}
+}
+
+// ResumeTakeover restores a takeover persisted by a previous run. Its
+// drop-ins survive restarts, so only the state and the watch are restored.
+func ResumeTakeover() {
+	var state TakeoverState
+	if err := readStateFile(takeoverStateFilePath, &state); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: ignoring takeover state: %v", err)
+		}
+		return
+	}
+	if !state.Active {
+		return
+	}
+	takeoverLock.Lock()
+	defer takeoverLock.Unlock()
+	takeoverState = state
+	metricSet(metricTakeoverActive, 1)
+	startTakeoverWatchLocked()
+	log.Printf("Resumed emergency takeover with %s", state.Asset)
+}
+
+// HandleTakeover starts (POST), reports (GET) or clears (DELETE) the
+// emergency takeover. The core pushes takeovers through this endpoint.
+func HandleTakeover(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getTakeoverState()})
+	case http.MethodPost:
+		var req TakeoverRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Asset) == "" {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Поле asset обязательно"})
+			return
+		}
+		config := GetCurrentConfig()
+		if _, err := takeoverAssetPath(config, req.Asset); err != nil {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Неверный файл для экстренного показа: %v", err)})
+			return
+		}
+		state, err := StartTakeover(r.Context(), config, req)
+		if err != nil {
+			log.Printf("Failed to start emergency takeover: %v", err)
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось запустить экстренный показ: %v", err)})
+			return
+		}
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: state})
+	case http.MethodDelete:
+		if _, err := ClearTakeover(r.Context()); err != nil {
+			log.Printf("Failed to clear emergency takeover: %v", err)
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось завершить экстренный показ: %v", err)})
+			return
+		}
+		JSONResponse(w, http.StatusOK, APIResponse{
+			OK: true,
+			Data: MenuActionResponse{
+				Action:  "takeover-clear",
+				Result:  "success",
+				Message: "Экстренный показ завершён, воспроизведение восстановлено",
+			},
+		})
+	default:
+		JSONResponse(w, http.StatusMethodNotAllowed, APIResponse{OK: false, ErrMsg: "Метод не разрешён"})
+	}
+}
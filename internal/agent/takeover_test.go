@@ -0,0 +1,245 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// playbackDBusConn records unit operations and reports play.video.service
+// as active or inactive.
+type playbackDBusConn struct {
+	noopDBusConnection
+	mu     sync.Mutex
+	active bool
+	ops    []string
+}
+
+func (c *playbackDBusConn) record(op, unit string, ch chan<- string) (int, error) {
+	c.mu.Lock()
+	c.ops = append(c.ops, op+" "+unit)
+	c.mu.Unlock()
+	if ch != nil {
+		ch <- "done"
+	}
+	return 1, nil
+}
+
+func (c *playbackDBusConn) StartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	return c.record("start", name, ch)
+}
+
+func (c *playbackDBusConn) StopUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	return c.record("stop", name, ch)
+}
+
+func (c *playbackDBusConn) RestartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	return c.record("restart", name, ch)
+}
+
+func (c *playbackDBusConn) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state := "inactive"
+	if c.active {
+		state = "active"
+	}
+	return map[string]any{"ActiveState": state}, nil
+}
+
+func (c *playbackDBusConn) operations() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.ops...)
+}
+
+func setupTakeoverForTest(t *testing.T, active bool) (*playbackDBusConn, Config) {
+	t.Helper()
+	conn := &playbackDBusConn{active: active}
+	SetDBusConnectionFactory(func(ctx context.Context) (DBusConnection, error) { return conn, nil })
+	setSystemdUnitDirForTest(t)
+
+	originalState := takeoverStateFilePath
+	takeoverStateFilePath = filepath.Join(t.TempDir(), "takeover.json")
+	t.Cleanup(func() {
+		SetDBusConnectionFactory(nil)
+		takeoverStateFilePath = originalState
+		takeoverLock.Lock()
+		stopTakeoverWatchLocked()
+		takeoverState = TakeoverState{}
+		takeoverLock.Unlock()
+	})
+
+	mediaDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(mediaDir, "emergency"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mediaDir, "emergency", "fire.mp4"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Playlist: PlaylistConfig{Destination: mediaDir}}
+	setCurrentConfigForTest(t, config)
+	return conn, config
+}
+
+func TestTakeoverPreemptsAndRestoresPlayback(t *testing.T) {
+	conn, config := setupTakeoverForTest(t, true)
+
+	state, err := StartTakeover(t.Context(), config, TakeoverRequest{Asset: "emergency/fire.mp4", Reason: "fire drill"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Active || !state.PlaybackWasActive || state.Asset != "emergency/fire.mp4" {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+	dropIn, err := os.ReadFile(takeoverDropInPath(playbackServiceUnit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ExecStart=\nExecStart=" + DefaultPlayerCommand + " " + filepath.Join(config.Playlist.Destination, "emergency", "fire.mp4") + "\n"
+	if !strings.Contains(string(dropIn), want) {
+		t.Fatalf("unexpected drop-in:\n%s", dropIn)
+	}
+	if !IsTakeoverActive() || metricValue(metricTakeoverActive) != 1 {
+		t.Fatal("expected takeover to be active")
+	}
+
+	var persisted TakeoverState
+	if err := readStateFile(takeoverStateFilePath, &persisted); err != nil || !persisted.Active {
+		t.Fatalf("expected persisted takeover, got %+v, %v", persisted, err)
+	}
+
+	if _, err := ClearTakeover(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(takeoverDropInPath(playbackServiceUnit)); !os.IsNotExist(err) {
+		t.Fatalf("expected drop-in to be removed, got %v", err)
+	}
+	if want := []string{"restart play.video.service", "restart play.video.service"}; !reflect.DeepEqual(conn.operations(), want) {
+		t.Fatalf("operations = %v, want %v", conn.operations(), want)
+	}
+	if IsTakeoverActive() {
+		t.Fatal("expected takeover to be cleared")
+	}
+}
+
+func TestTakeoverStopsPlaybackThatWasOff(t *testing.T) {
+	conn, config := setupTakeoverForTest(t, false)
+
+	if _, err := StartTakeover(t.Context(), config, TakeoverRequest{Asset: "emergency/fire.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	// A second takeover keeps the state to restore.
+	conn.mu.Lock()
+	conn.active = true
+	conn.mu.Unlock()
+	state, err := StartTakeover(t.Context(), config, TakeoverRequest{Asset: "emergency/fire.mp4"})
+	if err != nil || state.PlaybackWasActive {
+		t.Fatalf("unexpected state: %+v, %v", state, err)
+	}
+
+	if _, err := ClearTakeover(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	ops := conn.operations()
+	if ops[len(ops)-1] != "stop play.video.service" {
+		t.Fatalf("expected playback to be stopped on clear, got %v", ops)
+	}
+}
+
+func TestTakeoverDropInsPerOutput(t *testing.T) {
+	config := Config{Displays: []DisplayOutputConfig{{Output: "HDMI-A-1"}, {Output: "HDMI-A-2", PlayerArgs: "--screen {output}"}}}
+	dropIns := takeoverDropIns(config, "/var/media-pi/alert.mp4")
+	if len(dropIns) != 2 {
+		t.Fatalf("expected a drop-in per output, got %v", dropIns)
+	}
+	if !strings.Contains(dropIns["play.video@HDMI-A-2.service"], "--screen HDMI-A-2 /var/media-pi/alert.mp4") {
+		t.Fatalf("unexpected drop-in: %s", dropIns["play.video@HDMI-A-2.service"])
+	}
+}
+
+func TestHandleTakeoverRejectsMissingAsset(t *testing.T) {
+	setupTakeoverForTest(t, true)
+
+	for _, body := range []string{`{}`, `{"asset":"missing.mp4"}`, `{"asset":"../etc/passwd"}`} {
+		w := httptest.NewRecorder()
+		HandleTakeover(w, httptest.NewRequest(http.MethodPost, "/api/playback/takeover", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	HandleTakeover(w, httptest.NewRequest(http.MethodPost, "/api/playback/takeover", strings.NewReader(`{"asset":"emergency/fire.mp4"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"active":true`) {
+		t.Fatalf("expected takeover to start, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	HandleTakeover(w, httptest.NewRequest(http.MethodDelete, "/api/playback/takeover", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+}
+
+func TestTakeoverWatchRestartsStoppedPlayback(t *testing.T) {
+	conn, config := setupTakeoverForTest(t, false)
+	original := takeoverWatchInterval
+	takeoverWatchInterval = 10 * time.Millisecond
+	t.Cleanup(func() { takeoverWatchInterval = original })
+
+	if _, err := StartTakeover(t.Context(), config, TakeoverRequest{Asset: "emergency/fire.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		ops := conn.operations()
+		if len(ops) > 1 && ops[len(ops)-1] == "start play.video.service" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected watch to start playback, got %v", ops)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestResumeTakeover(t *testing.T) {
+	setupTakeoverForTest(t, true)
+	if err := writeStateFile(takeoverStateFilePath, TakeoverState{Active: true, Asset: "emergency/fire.mp4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ResumeTakeover()
+	if state := getTakeoverState(); !state.Active || state.Asset != "emergency/fire.mp4" {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+}
+
+func TestPresenceKeepsTakeoverOnIdle(t *testing.T) {
+	actions := stubPresenceActions(t)
+	takeoverLock.Lock()
+	takeoverState = TakeoverState{Active: true}
+	takeoverLock.Unlock()
+	t.Cleanup(func() {
+		takeoverLock.Lock()
+		takeoverState = TakeoverState{}
+		takeoverLock.Unlock()
+	})
+
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.Local)
+	state := newPresenceState(Config{Presence: PresenceConfig{IdleTimeout: time.Minute, BlankCommand: "blank"}}, start)
+	state.observe(context.Background(), start.Add(2*time.Minute), false, nil)
+	if len(*actions) != 0 {
+		t.Fatalf("expected takeover to stay on screen, got %v", *actions)
+	}
+}
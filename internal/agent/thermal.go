@@ -0,0 +1,106 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for thermal-aware sync; see sync.thermal_limit.
+const (
+	DefaultThermalResumeMargin  = 5.0
+	DefaultThermalCheckInterval = 15 * time.Second
+	DefaultThermalMaxDelay      = 30 * time.Minute
+)
+
+const (
+	metricSoCTemperature    = "media_pi_soc_temperature_celsius"
+	metricSyncThermalPauses = "media_pi_sync_thermal_pauses_total"
+)
+
+func init() {
+	registerGauge(metricSoCTemperature, "SoC temperature last read by the sync, in degrees Celsius.")
+	registerCounter(metricSyncThermalPauses, "Syncs paused because the SoC was over sync.thermal_limit.")
+}
+
+var (
+	// ThermalZonePath reports the SoC temperature in millidegrees. Tests may
+	// override it.
+	ThermalZonePath = "/sys/class/thermal/thermal_zone0/temp"
+
+	// readSoCTemperature returns the SoC temperature in degrees Celsius.
+	// Tests may override it.
+	readSoCTemperature = func() (float64, error) {
+		data, err := os.ReadFile(ThermalZonePath)
+		if err != nil {
+			return 0, err
+		}
+		milli, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid temperature %q: %w", strings.TrimSpace(string(data)), err)
+		}
+		return milli / 1000, nil
+	}
+)
+
+// thermalResumeAt returns the temperature at which a paused sync resumes.
+func thermalResumeAt(config SyncConfig) float64 {
+	if config.ThermalResume > 0 && config.ThermalResume < config.ThermalLimit {
+		return config.ThermalResume
+	}
+	return config.ThermalLimit - DefaultThermalResumeMargin
+}
+
+// waitForThermalHeadroom blocks while the SoC is hotter than
+// sync.thermal_limit, so hashing and downloads don't push playback into
+// thermal throttling. The sync resumes once the SoC cooled to
+// sync.thermal_resume, or after DefaultThermalMaxDelay so it can't be
+// deferred forever.
+func waitForThermalHeadroom(ctx context.Context, config SyncConfig) error {
+	if config.ThermalLimit <= 0 {
+		return nil
+	}
+	temperature, err := readSoCTemperature()
+	if err != nil {
+		return nil
+	}
+	metricSet(metricSoCTemperature, temperature)
+	if temperature <= config.ThermalLimit {
+		return nil
+	}
+
+	interval := config.ThermalCheckInterval
+	if interval <= 0 {
+		interval = DefaultThermalCheckInterval
+	}
+	resumeAt := thermalResumeAt(config)
+	log.Printf("Thermal event: SoC at %.1f°C is over sync.thermal_limit %.1f°C, pausing sync until it cools to %.1f°C", temperature, config.ThermalLimit, resumeAt)
+	metricAdd(metricSyncThermalPauses, 1)
+	started := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+		if temperature, err = readSoCTemperature(); err != nil {
+			return nil
+		}
+		metricSet(metricSoCTemperature, temperature)
+		if temperature <= resumeAt {
+			log.Printf("Thermal event: SoC cooled to %.1f°C after %s, resuming sync", temperature, time.Since(started).Round(time.Second))
+			return nil
+		}
+		if time.Since(started) >= DefaultThermalMaxDelay {
+			log.Printf("Warning: SoC still at %.1f°C after %s, resuming sync anyway", temperature, DefaultThermalMaxDelay)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubSoCTemperature returns readings in order, repeating the last one.
+func stubSoCTemperature(t *testing.T, readings ...float64) *int {
+	t.Helper()
+	var mu sync.Mutex
+	reads := 0
+	original := readSoCTemperature
+	readSoCTemperature = func() (float64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reading := readings[min(reads, len(readings)-1)]
+		reads++
+		return reading, nil
+	}
+	t.Cleanup(func() { readSoCTemperature = original })
+	return &reads
+}
+
+func TestReadSoCTemperature(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "temp")
+	if err := os.WriteFile(path, []byte("61234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	original := ThermalZonePath
+	ThermalZonePath = path
+	t.Cleanup(func() { ThermalZonePath = original })
+
+	if got, err := readSoCTemperature(); err != nil || got != 61.234 {
+		t.Fatalf("readSoCTemperature = %v, %v", got, err)
+	}
+}
+
+func TestWaitForThermalHeadroomPausesUntilCooled(t *testing.T) {
+	reads := stubSoCTemperature(t, 82, 78, 74)
+	before := metricValue(metricSyncThermalPauses)
+
+	config := SyncConfig{ThermalLimit: 80, ThermalCheckInterval: time.Millisecond}
+	if err := waitForThermalHeadroom(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	// 78°C is below the limit but above the default resume point of 75°C.
+	if *reads != 3 {
+		t.Fatalf("expected to wait for 75°C, got %d reads", *reads)
+	}
+	if metricValue(metricSyncThermalPauses)-before != 1 || metricValue(metricSoCTemperature) != 74 {
+		t.Fatal("expected thermal pause to be recorded")
+	}
+}
+
+func TestWaitForThermalHeadroomSkipsWhenCoolOrDisabled(t *testing.T) {
+	reads := stubSoCTemperature(t, 90)
+	if err := waitForThermalHeadroom(context.Background(), SyncConfig{}); err != nil || *reads != 0 {
+		t.Fatalf("expected no check when disabled, got %d reads, %v", *reads, err)
+	}
+
+	stubSoCTemperature(t, 60)
+	if err := waitForThermalHeadroom(context.Background(), SyncConfig{ThermalLimit: 80}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForThermalHeadroomHonorsCancel(t *testing.T) {
+	stubSoCTemperature(t, 90)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := waitForThermalHeadroom(ctx, SyncConfig{ThermalLimit: 80, ThermalCheckInterval: time.Hour})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation, got %v", err)
+	}
+}
+
+func TestSyncPausesWhileHot(t *testing.T) {
+	reads := stubSoCTemperature(t, 85, 70)
+	mediaDir := t.TempDir()
+	config := Config{
+		Playlist: PlaylistConfig{Destination: mediaDir},
+		Sync:     SyncConfig{ThermalLimit: 80, ThermalCheckInterval: time.Millisecond},
+	}
+	fetched := 0
+	fetch := func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		fetched++
+		return os.WriteFile(destPath, []byte("video"), 0644)
+	}
+	manifest := Manifest{{ID: 1, Filename: "a.mp4", FileSizeBytes: 5}}
+	if err := syncFilesFrom(context.Background(), config, &manifest, fetch); err != nil {
+		t.Fatal(err)
+	}
+	if *reads < 2 || fetched != 1 {
+		t.Fatalf("expected sync to wait for cooling before fetching, got %d reads, %d fetches", *reads, fetched)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultThumbnailWidth is the width of generated thumbnails in pixels.
+const DefaultThumbnailWidth = 320
+
+// thumbnailTimeout bounds one ffmpeg frame grab.
+const thumbnailTimeout = time.Minute
+
+// SyncThumbnailConfig enables preview images of synced videos for the core
+// UI.
+type SyncThumbnailConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Width of the thumbnail; the height keeps the aspect ratio. See
+	// DefaultThumbnailWidth.
+	Width int `yaml:"width,omitempty"`
+}
+
+var (
+	// thumbnailDir holds one <manifest id>.jpg per synced video. It is
+	// kept out of the media directories, which sync garbage collection
+	// walks.
+	thumbnailDir = filepath.Join(agentStateDir, "thumbnails")
+
+	// runThumbnailCommand grabs one frame of input into output. Tests may
+	// override it.
+	runThumbnailCommand = func(ctx context.Context, input, output string, width int) error {
+		ffmpegPath, err := resolveFFmpegPath()
+		if err != nil {
+			return err
+		}
+		// A frame one second in skips black intro frames; a shorter video
+		// has none there, so the first frame is taken instead.
+		var out []byte
+		for _, seek := range []string{"1", "0"} {
+			cmd := exec.CommandContext(ctx, ffmpegPath, "-loglevel", "error", "-y", "-threads", "1", "-ss", seek, "-i", input,
+				"-frames:v", "1", "-vf", fmt.Sprintf("scale=%d:-2", width), "-q:v", "5", "-f", "image2", output)
+			if out, err = cmd.CombinedOutput(); err == nil {
+				if info, statErr := os.Stat(output); statErr == nil && info.Size() > 0 {
+					return nil
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("ffmpeg command failed: %w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return errors.New("ffmpeg produced no frame")
+	}
+
+	// thumbnailsLock serializes thumbnail generation of consecutive syncs.
+	thumbnailsLock sync.Mutex
+)
+
+// thumbnailWidth returns the configured thumbnail width.
+func thumbnailWidth(config SyncThumbnailConfig) int {
+	if config.Width > 0 {
+		return config.Width
+	}
+	return DefaultThumbnailWidth
+}
+
+// thumbnailPath is the thumbnail of the manifest item id.
+func thumbnailPath(id int64) string {
+	return filepath.Join(thumbnailDir, strconv.FormatInt(id, 10)+".jpg")
+}
+
+// startThumbnails generates the missing thumbnails of the videos of a sync
+// in the background, so sync itself does not wait for ffmpeg.
+func startThumbnails(config Config, items map[string]ManifestItem) {
+	if !config.Sync.Thumbnails.Enabled {
+		return
+	}
+	go func() {
+		lowerSyncPriority(config.Sync)
+		updateThumbnails(context.Background(), config.Sync.Thumbnails, items)
+	}()
+}
+
+// updateThumbnails grabs a frame of every video in items whose thumbnail
+// is missing or older than the file, and removes thumbnails of videos no
+// longer synced.
+func updateThumbnails(ctx context.Context, config SyncThumbnailConfig, items map[string]ManifestItem) {
+	thumbnailsLock.Lock()
+	defer thumbnailsLock.Unlock()
+
+	if err := os.MkdirAll(thumbnailDir, 0o755); err != nil {
+		log.Printf("Warning: failed to create thumbnail directory: %v", err)
+		return
+	}
+	keep := make(map[string]struct{}, len(items))
+	created := 0
+	for path, item := range items {
+		if mediaKindOf(item) != mediaKindVideo {
+			continue
+		}
+		output := thumbnailPath(item.ID)
+		keep[filepath.Base(output)] = struct{}{}
+		info, err := os.Stat(path)
+		if err != nil {
+			// Not downloaded (yet); the next sync retries.
+			continue
+		}
+		if thumb, err := os.Stat(output); err == nil && !thumb.ModTime().Before(info.ModTime()) {
+			continue
+		}
+
+		tmp := output + ".tmp.jpg"
+		grabCtx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+		err = runThumbnailCommand(grabCtx, path, tmp, thumbnailWidth(config))
+		cancel()
+		if err == nil {
+			err = os.Rename(tmp, output)
+		}
+		if err != nil {
+			_ = os.Remove(tmp)
+			log.Printf("Warning: failed to create thumbnail of %s (ID: %d): %v", item.Filename, item.ID, err)
+			continue
+		}
+		created++
+	}
+
+	entries, err := os.ReadDir(thumbnailDir)
+	if err != nil {
+		log.Printf("Warning: failed to list thumbnails: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		if _, ok := keep[entry.Name()]; ok || entry.IsDir() {
+			continue
+		}
+		if err := os.Remove(filepath.Join(thumbnailDir, entry.Name())); err != nil {
+			log.Printf("Warning: failed to remove thumbnail %s: %v", entry.Name(), err)
+		}
+	}
+	if created > 0 {
+		log.Printf("Created %d video thumbnails", created)
+	}
+}
+
+// HandleMediaThumbnail sends the JPEG thumbnail of the video with the
+// manifest id given in the path, /api/media/thumbnails/{id}.
+func HandleMediaThumbnail(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{
+			OK:     false,
+			ErrMsg: "Некорректный идентификатор медиафайла",
+		})
+		return
+	}
+	file, err := os.Open(thumbnailPath(id))
+	if err != nil {
+		JSONResponse(w, http.StatusNotFound, APIResponse{
+			OK:     false,
+			ErrMsg: fmt.Sprintf("Миниатюра не найдена: %d", id),
+		})
+		return
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{
+			OK:     false,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
@@ -0,0 +1,121 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUpdateThumbnails(t *testing.T) {
+	originalDir, originalCommand := thumbnailDir, runThumbnailCommand
+	t.Cleanup(func() { thumbnailDir, runThumbnailCommand = originalDir, originalCommand })
+	thumbnailDir = filepath.Join(t.TempDir(), "thumbnails")
+	var grabbed []string
+	runThumbnailCommand = func(ctx context.Context, input, output string, width int) error {
+		if width != DefaultThumbnailWidth {
+			t.Errorf("width = %d", width)
+		}
+		grabbed = append(grabbed, filepath.Base(input))
+		return os.WriteFile(output, []byte("jpeg"), 0644)
+	}
+
+	mediaDir := t.TempDir()
+	items := map[string]ManifestItem{}
+	for id, name := range map[int64]string{1: "new.mp4", 2: "known.mp4", 3: "logo.png", 4: "missing.mp4"} {
+		path := filepath.Join(mediaDir, name)
+		if name != "missing.mp4" {
+			if err := os.WriteFile(path, []byte("media"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		items[path] = ManifestItem{ID: id, Filename: name}
+	}
+	if err := os.MkdirAll(thumbnailDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"2.jpg", "9.jpg"} {
+		if err := os.WriteFile(filepath.Join(thumbnailDir, name), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(thumbnailPath(2), later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	updateThumbnails(context.Background(), SyncThumbnailConfig{}, items)
+	if len(grabbed) != 1 || grabbed[0] != "new.mp4" {
+		t.Fatalf("grabbed %v", grabbed)
+	}
+	entries, err := os.ReadDir(thumbnailDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != 2 || names[0] != "1.jpg" || names[1] != "2.jpg" {
+		t.Fatalf("thumbnails = %v", names)
+	}
+}
+
+func TestHandleMediaThumbnail(t *testing.T) {
+	original := thumbnailDir
+	t.Cleanup(func() { thumbnailDir = original })
+	thumbnailDir = t.TempDir()
+	if err := os.WriteFile(thumbnailPath(7), []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/media/thumbnails/"+id, nil)
+		r.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		HandleMediaThumbnail(w, r)
+		return w
+	}
+	if w := get("7"); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/jpeg" || w.Body.String() != "jpeg" {
+		t.Fatalf("status %d, %s", w.Code, w.Body.String())
+	}
+	for id, status := range map[string]int{"8": http.StatusNotFound, "../7": http.StatusBadRequest} {
+		if w := get(id); w.Code != status {
+			t.Errorf("%s: status %d, want %d", id, w.Code, status)
+		}
+	}
+}
+
+func TestGarbageCollectionKeepsThumbnails(t *testing.T) {
+	rootStatePaths(t)
+	original := runThumbnailCommand
+	t.Cleanup(func() { runThumbnailCommand = original })
+	grabs := 0
+	runThumbnailCommand = func(ctx context.Context, input, output string, width int) error {
+		grabs++
+		return os.WriteFile(output, []byte("jpeg"), 0644)
+	}
+
+	video := filepath.Join(DefaultMediaDir, "clip.mp4")
+	items := map[string]ManifestItem{video: {ID: 5, Filename: "clip.mp4"}}
+	garbageNextTo(t, video)
+	for i := 0; i < 2; i++ {
+		updateThumbnails(context.Background(), SyncThumbnailConfig{}, items)
+		// Only the video is unexpected to this bare collection.
+		if garbage := garbageNextTo(t); len(garbage) != 1 || garbage[0] != video {
+			t.Fatalf("garbage = %v", garbage)
+		}
+	}
+	if _, err := os.Stat(thumbnailPath(5)); err != nil {
+		t.Fatalf("thumbnail: %v", err)
+	}
+	if grabs != 1 {
+		t.Fatalf("an unchanged video must be grabbed once, got %d", grabs)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeoutsConfig overrides the per-operation timeouts of core API requests
+// and systemd calls. Zero values keep the built-in defaults; slow cellular
+// links usually need a longer download timeout for large files.
+type TimeoutsConfig struct {
+	Manifest          time.Duration `yaml:"manifest,omitempty"`
+	Download          time.Duration `yaml:"download,omitempty"`
+	Playlist          time.Duration `yaml:"playlist,omitempty"`
+	Screenshot        time.Duration `yaml:"screenshot,omitempty"`
+	DBusOperation     time.Duration `yaml:"dbus_operation,omitempty"`
+	PlaybackOperation time.Duration `yaml:"playback_operation,omitempty"`
+}
+
+// validateTimeouts rejects negative timeouts, which would fail every
+// request immediately.
+func validateTimeouts(cfg TimeoutsConfig) error {
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"manifest", cfg.Manifest},
+		{"download", cfg.Download},
+		{"playlist", cfg.Playlist},
+		{"screenshot", cfg.Screenshot},
+		{"dbus_operation", cfg.DBusOperation},
+		{"playback_operation", cfg.PlaybackOperation},
+	} {
+		if timeout.value < 0 {
+			return fmt.Errorf("timeouts.%s must not be negative, got %s", timeout.name, timeout.value)
+		}
+	}
+	return nil
+}
+
+// currentTimeouts returns the timeouts of the loaded configuration.
+func currentTimeouts() TimeoutsConfig {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	if currentConfig == nil {
+		return TimeoutsConfig{}
+	}
+	return currentConfig.Timeouts
+}
+
+func timeoutOr(configured, fallback time.Duration) time.Duration {
+	if configured > 0 {
+		return configured
+	}
+	return fallback
+}
+
+func manifestTimeout() time.Duration {
+	return timeoutOr(currentTimeouts().Manifest, manifestRequestTimeout)
+}
+
+func downloadTimeout() time.Duration {
+	return timeoutOr(currentTimeouts().Download, downloadRequestTimeout)
+}
+
+func playlistTimeout() time.Duration {
+	return timeoutOr(currentTimeouts().Playlist, playlistRequestTimeout)
+}
+
+func screenshotTimeout() time.Duration {
+	return timeoutOr(currentTimeouts().Screenshot, screenshotRequestTimeout)
+}
+
+func dbusTimeout() time.Duration {
+	return timeoutOr(currentTimeouts().DBusOperation, dbusOperationTimeout)
+}
+
+func playbackOperationTimeout() time.Duration {
+	return timeoutOr(currentTimeouts().PlaybackOperation, playbackServiceOperationTimeout)
+}
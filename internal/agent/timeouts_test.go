@@ -0,0 +1,53 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfiguredTimeouts(t *testing.T) {
+	setCurrentConfigForTest(t, Config{ServerKey: "key"})
+	if manifestTimeout() != manifestRequestTimeout || downloadTimeout() != downloadRequestTimeout || dbusTimeout() != dbusOperationTimeout {
+		t.Fatal("expected built-in defaults without timeouts configured")
+	}
+
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	yaml := "server_key: key\ntimeouts:\n  download: 30m\n  manifest: 1m\n  dbus_operation: 20s\n  playback_operation: 45s\n"
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfigFrom(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := downloadTimeout(); got != 30*time.Minute {
+		t.Errorf("downloadTimeout = %s", got)
+	}
+	if got := manifestTimeout(); got != time.Minute {
+		t.Errorf("manifestTimeout = %s", got)
+	}
+	if got := playlistTimeout(); got != playlistRequestTimeout {
+		t.Errorf("expected unset playlist timeout to keep the default, got %s", got)
+	}
+	if got := dbusTimeout(); got != 20*time.Second {
+		t.Errorf("dbusTimeout = %s", got)
+	}
+	if got := playbackOperationTimeout(); got != 45*time.Second {
+		t.Errorf("playbackOperationTimeout = %s", got)
+	}
+}
+
+func TestLoadConfigRejectsNegativeTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	if err := os.WriteFile(path, []byte("server_key: key\ntimeouts:\n  download: -1m\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfigFrom(path); err == nil || !strings.Contains(err.Error(), "timeouts.download") {
+		t.Fatalf("expected negative download timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+const metricTLSPinFailures = "media_pi_tls_pin_failures_total"
+
+func init() {
+	registerCounter(metricTLSPinFailures, "Core API connections rejected because no certificate matched http_client.tls_pins.")
+}
+
+// errTLSPinMismatch is returned for core API connections whose certificate
+// chain matches none of the pins.
+var errTLSPinMismatch = errors.New("core API certificate does not match tls_pins")
+
+// parseTLSPins decodes pins given as "sha256/<base64>" (the form printed by
+// openssl and used by HPKP) or as bare base64 of the SHA-256 digest of a
+// SubjectPublicKeyInfo.
+func parseTLSPins(entries []string) ([][sha256.Size]byte, error) {
+	var pins [][sha256.Size]byte
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(entry, "sha256/"))
+		if err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("invalid tls_pins entry %q: want sha256/<base64 of a 32-byte digest>", entry)
+		}
+		pins = append(pins, [sha256.Size]byte(raw))
+	}
+	return pins, nil
+}
+
+// spkiPin returns the pin of cert.
+func spkiPin(cert *x509.Certificate) [sha256.Size]byte {
+	return sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+}
+
+// isCoreTLSHost reports whether a TLS connection with serverName leads to
+// the core_api_base host. No server name is sent to IP addresses, so every
+// such connection is treated as a core connection when the core is
+// addressed by IP.
+func isCoreTLSHost(serverName string) bool {
+	base, err := url.Parse(GetCurrentConfig().CoreAPIBase)
+	if err != nil || base.Hostname() == "" {
+		return false
+	}
+	if serverName == "" {
+		_, err := netip.ParseAddr(base.Hostname())
+		return err == nil
+	}
+	return strings.EqualFold(base.Hostname(), serverName)
+}
+
+// verifyCorePins accepts connections to the core API host only when a
+// certificate of the chain matches one of pins. Any certificate may match,
+// so pinning the intermediate CA survives leaf renewals; several pins allow
+// rotating keys without locking devices out. Other hosts served by the
+// shared client, e.g. S3 or LAN peers, are not pinned.
+func verifyCorePins(pins [][sha256.Size]byte) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		if !isCoreTLSHost(cs.ServerName) {
+			return nil
+		}
+		// Only verified chains count: extra certificates sent by the server
+		// prove nothing. Without verification (tls_insecure_skip_verify) only
+		// the leaf, whose key signed the handshake, is checked.
+		var certs []*x509.Certificate
+		for _, chain := range cs.VerifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+			certs = cs.PeerCertificates[:1]
+		}
+		for _, cert := range certs {
+			pin := spkiPin(cert)
+			for _, want := range pins {
+				if pin == want {
+					return nil
+				}
+			}
+		}
+		metricAdd(metricTLSPinFailures, 1)
+		var got []string
+		for _, cert := range cs.PeerCertificates {
+			pin := spkiPin(cert)
+			got = append(got, "sha256/"+base64.StdEncoding.EncodeToString(pin[:]))
+		}
+		log.Printf("Warning: rejected the certificate of %s: pins %s match none of tls_pins", cs.ServerName, strings.Join(got, ", "))
+		return errTLSPinMismatch
+	}
+}
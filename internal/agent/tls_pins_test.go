@@ -0,0 +1,82 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTLSPins(t *testing.T) {
+	digest := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	pins, err := parseTLSPins([]string{"sha256/" + digest, digest, " "})
+	if err != nil || len(pins) != 2 {
+		t.Fatalf("parseTLSPins() = %d pins, %v", len(pins), err)
+	}
+	for _, bad := range []string{"sha256/not-base64!", "sha256/" + base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := parseTLSPins([]string{bad}); err == nil {
+			t.Errorf("expected %q rejected", bad)
+		}
+	}
+}
+
+func TestCoreClientEnforcesTLSPins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	// The test certificate is valid for example.com; connections to it go
+	// to the test server.
+	coreURL := strings.Replace(server.URL, "127.0.0.1", "example.com", 1)
+	setCurrentConfigForTest(t, Config{CoreAPIBase: coreURL})
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pin := spkiPin(server.Certificate())
+	serverPin := "sha256/" + base64.StdEncoding.EncodeToString(pin[:])
+	otherPin := "sha256/" + base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	get := func(url string, pins ...string) error {
+		client, err := NewCoreClient(HTTPClientConfig{TLSCAFile: caPath, TLSPins: pins})
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport := client.client.Transport.(*http.Transport)
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		}
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		resp, err := client.Do(context.Background(), req, 0)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(coreURL, otherPin); !errors.Is(err, errTLSPinMismatch) {
+		t.Fatalf("expected errTLSPinMismatch, got %v", err)
+	}
+	// During a rotation the old and the new pin are both configured.
+	if err := get(coreURL, otherPin, serverPin); err != nil {
+		t.Fatalf("expected the pinned certificate accepted, got %v", err)
+	}
+	// Hosts other than the core are not pinned.
+	if err := get(server.URL, otherPin); err != nil {
+		t.Fatalf("expected other hosts unaffected, got %v", err)
+	}
+	// A core addressed by IP is pinned too.
+	setCurrentConfigForTest(t, Config{CoreAPIBase: server.URL})
+	if err := get(server.URL, otherPin); !errors.Is(err, errTLSPinMismatch) {
+		t.Fatalf("expected errTLSPinMismatch for an IP core, got %v", err)
+	}
+}
@@ -0,0 +1,516 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	godbus "github.com/godbus/dbus/v5"
+)
+
+// ExecJobConfig is a command POST /api/system/jobs may run as a transient
+// systemd unit, like systemd-run, e.g. fsck of the media partition. The
+// limits are set on the unit; empty values leave them unset.
+type ExecJobConfig struct {
+	ExecCommandConfig `yaml:",inline"`
+	// CPUQuota is a systemd CPUQuota, e.g. 50%.
+	CPUQuota string `yaml:"cpu_quota,omitempty"`
+	// MemoryMax is a systemd MemoryMax in bytes or with a K, M or G
+	// suffix, e.g. 256M.
+	MemoryMax string `yaml:"memory_max,omitempty"`
+	// IOWeight is a systemd IOWeight, 1-10000.
+	IOWeight int `yaml:"io_weight,omitempty"`
+	// Nice is the nice value of the job, -20 to 19.
+	Nice int `yaml:"nice,omitempty"`
+}
+
+// Job states.
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobTimedOut  = "timeout"
+)
+
+// Limits of transient jobs.
+const (
+	DefaultJobTimeout = 30 * time.Minute
+	maxJobTimeout     = 6 * time.Hour
+	// maxJobs is how many jobs and outputs are kept.
+	maxJobs = 20
+	// jobUnitPrefix names the transient units of jobs, which the helper
+	// accepts besides the units the agent manages.
+	jobUnitPrefix = "media-pi-job-"
+)
+
+var (
+	// jobOutputDir holds the stdout and stderr of jobs, one file per job.
+	jobOutputDir = filepath.Join(agentStateDir, "jobs")
+
+	// jobPollInterval is how often a running job is checked. Tests may
+	// override it.
+	jobPollInterval = 2 * time.Second
+
+	// jobs are the started jobs, oldest first.
+	jobs     []*TransientJob
+	jobsLock sync.Mutex
+)
+
+// TransientJob is a job started by POST /api/system/jobs.
+type TransientJob struct {
+	ID         string     `json:"id"`
+	Command    string     `json:"command"`
+	Args       []string   `json:"args,omitempty"`
+	Unit       string     `json:"unit"`
+	State      string     `json:"state"`
+	ExitCode   *int       `json:"exitCode,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	// Output is the end of stdout and stderr, returned for a single job.
+	Output    string `json:"output,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// newJobID returns a random job ID usable in a unit name.
+func newJobID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:]) // never fails since Go 1.24
+	return hex.EncodeToString(b[:])
+}
+
+// isJobUnit reports whether unit is the transient unit of a job.
+func isJobUnit(unit string) bool {
+	id, ok := strings.CutPrefix(unit, jobUnitPrefix)
+	if !ok {
+		return false
+	}
+	id, ok = strings.CutSuffix(id, ".service")
+	if !ok || id == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// jobOutputPath is the output file of the job run as unit.
+func jobOutputPath(unit string) string {
+	return filepath.Join(jobOutputDir, strings.TrimSuffix(unit, ".service")+".log")
+}
+
+// resolveExecJob finds the allowed job for req and returns its argv with
+// the request arguments appended.
+func resolveExecJob(config ExecConfig, req ExecRequest) (ExecJobConfig, []string, error) {
+	for _, job := range config.Jobs {
+		if job.Name == req.Command {
+			argv, err := execArgv(job.ExecCommandConfig, req.Args)
+			return job, argv, err
+		}
+	}
+	return ExecJobConfig{}, nil, fmt.Errorf("%w: %q", errExecNotAllowed, req.Command)
+}
+
+func jobTimeout(job ExecJobConfig) time.Duration {
+	if job.Timeout <= 0 {
+		return DefaultJobTimeout
+	}
+	return min(job.Timeout, maxJobTimeout)
+}
+
+// parseCPUQuota converts a CPUQuota such as 50% to CPU time per second.
+func parseCPUQuota(value string) (time.Duration, error) {
+	percent, ok := strings.CutSuffix(value, "%")
+	if !ok {
+		return 0, fmt.Errorf("expected a percentage, e.g. 50%%")
+	}
+	n, err := strconv.ParseFloat(percent, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("expected a positive percentage, e.g. 50%%")
+	}
+	return time.Duration(n / 100 * float64(time.Second)), nil
+}
+
+// parseMemorySize converts a size in bytes or with a K, M, G or T suffix
+// (powers of 1024) to bytes.
+func parseMemorySize(value string) (uint64, error) {
+	multiplier := uint64(1)
+	if n := len(value); n > 0 {
+		if shift := strings.IndexByte("KMGT", value[n-1]); shift >= 0 {
+			multiplier = 1 << (10 * (shift + 1))
+			value = value[:n-1]
+		}
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("expected a size such as 256M")
+	}
+	return n * multiplier, nil
+}
+
+// validateExecJobs checks the limits of exec.jobs.
+func validateExecJobs(config ExecConfig) error {
+	names := make(map[string]struct{}, len(config.Jobs))
+	for _, job := range config.Jobs {
+		if job.Name == "" {
+			return fmt.Errorf("exec.jobs: name is required")
+		}
+		if _, ok := names[job.Name]; ok {
+			return fmt.Errorf("exec.jobs: duplicate job %q", job.Name)
+		}
+		names[job.Name] = struct{}{}
+		if job.CPUQuota != "" {
+			if _, err := parseCPUQuota(job.CPUQuota); err != nil {
+				return fmt.Errorf("exec.jobs %q: cpu_quota: %w", job.Name, err)
+			}
+		}
+		if job.MemoryMax != "" {
+			if _, err := parseMemorySize(job.MemoryMax); err != nil {
+				return fmt.Errorf("exec.jobs %q: memory_max: %w", job.Name, err)
+			}
+		}
+		if job.IOWeight < 0 || job.IOWeight > 10000 {
+			return fmt.Errorf("exec.jobs %q: io_weight must be between 1 and 10000", job.Name)
+		}
+		if job.Nice < -20 || job.Nice > 19 {
+			return fmt.Errorf("exec.jobs %q: nice must be between -20 and 19", job.Name)
+		}
+	}
+	return nil
+}
+
+// jobUnitProperties describes the transient unit of a job: a oneshot
+// service, so systemd keeps it activating until the command exits, with
+// its output appended to output.
+func jobUnitProperties(job ExecJobConfig, argv []string, output string) []dbus.Property {
+	props := []dbus.Property{
+		dbus.PropDescription("Media Pi job " + job.Name),
+		dbus.PropType("oneshot"),
+		dbus.PropExecStart(argv, false),
+		{Name: "TimeoutStartUSec", Value: godbus.MakeVariant(uint64(jobTimeout(job) / time.Microsecond))},
+		{Name: "StandardOutputFileToAppend", Value: godbus.MakeVariant(output)},
+		{Name: "StandardErrorFileToAppend", Value: godbus.MakeVariant(output)},
+	}
+	if quota, err := parseCPUQuota(job.CPUQuota); err == nil {
+		props = append(props, dbus.Property{Name: "CPUQuotaPerSecUSec", Value: godbus.MakeVariant(uint64(quota / time.Microsecond))})
+	}
+	if memory, err := parseMemorySize(job.MemoryMax); err == nil {
+		props = append(props, dbus.Property{Name: "MemoryMax", Value: godbus.MakeVariant(memory)})
+	}
+	if job.IOWeight > 0 {
+		props = append(props, dbus.Property{Name: "IOWeight", Value: godbus.MakeVariant(uint64(job.IOWeight))})
+	}
+	if job.Nice != 0 {
+		props = append(props, dbus.Property{Name: "Nice", Value: godbus.MakeVariant(int32(job.Nice))})
+	}
+	return props
+}
+
+// startJobUnit starts req from config as the transient unit. The agent
+// calls it directly when it runs as root, the helper on its behalf.
+func startJobUnit(ctx context.Context, conn DBusConnection, config ExecConfig, unit string, req ExecRequest) error {
+	if !isJobUnit(unit) {
+		return fmt.Errorf("invalid job unit %q", unit)
+	}
+	job, argv, err := resolveExecJob(config, req)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(jobOutputDir, 0755); err != nil {
+		return err
+	}
+	pruneJobOutputs()
+	_, err = conn.StartTransientUnitContext(ctx, unit, "fail", jobUnitProperties(job, argv, jobOutputPath(unit)), nil)
+	return err
+}
+
+// startJob starts req as unit, through the helper when the agent is
+// unprivileged: the helper resolves the job from its own configuration,
+// so the agent never hands it a command line.
+func startJob(ctx context.Context, conn DBusConnection, unit string, req ExecRequest) error {
+	if helper, ok := conn.(*helperDBusConnection); ok {
+		return helper.runJob(ctx, unit, req)
+	}
+	return startJobUnit(ctx, conn, GetCurrentConfig().Exec, unit, req)
+}
+
+// pruneJobOutputs removes the oldest job outputs beyond maxJobs.
+func pruneJobOutputs() {
+	entries, err := os.ReadDir(jobOutputDir)
+	if err != nil {
+		return
+	}
+	type output struct {
+		path    string
+		modTime time.Time
+	}
+	var outputs []output
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), jobUnitPrefix) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			outputs = append(outputs, output{filepath.Join(jobOutputDir, entry.Name()), info.ModTime()})
+		}
+	}
+	sort.Slice(outputs, func(i, j int) bool { return outputs[i].modTime.After(outputs[j].modTime) })
+	for i := maxJobs - 1; i < len(outputs); i++ {
+		_ = os.Remove(outputs[i].path)
+	}
+}
+
+// unitPropertyInt reads a signed integer property. D-Bus returns int32;
+// the helper passes it as a decimal string.
+func unitPropertyInt(value any) int {
+	switch value := value.(type) {
+	case int32:
+		return int(value)
+	case string:
+		n, _ := strconv.Atoi(value)
+		return n
+	}
+	return 0
+}
+
+// checkJob returns the state of the job run as unit. A finished oneshot
+// unit is unloaded on success; a failed one stays loaded until its result
+// is read, then it is reset so it is garbage collected too.
+func checkJob(ctx context.Context, conn DBusConnection, unit string) (string, *int, error) {
+	props, err := conn.GetUnitPropertiesContext(ctx, unit)
+	if err != nil {
+		return "", nil, err
+	}
+	switch props["ActiveState"] {
+	case "activating", "active", "deactivating", "reloading":
+		return JobRunning, nil, nil
+	case "failed":
+		service, err := conn.GetUnitTypePropertiesContext(ctx, unit, "Service")
+		if err != nil {
+			return "", nil, err
+		}
+		if err := conn.ResetFailedUnitContext(ctx, unit); err != nil {
+			log.Printf("Warning: failed to reset job unit %s: %v", unit, err)
+		}
+		if service["Result"] == "timeout" {
+			return JobTimedOut, nil, nil
+		}
+		code := unitPropertyInt(service["ExecMainStatus"])
+		return JobFailed, &code, nil
+	}
+	code := 0
+	return JobSucceeded, &code, nil
+}
+
+// watchJob polls job until its unit finishes or, when systemd no longer
+// answers, until well past its timeout.
+func watchJob(job *TransientJob, timeout time.Duration, record execAuditRecord) {
+	deadline := job.StartedAt.Add(timeout + time.Minute)
+	for {
+		time.Sleep(jobPollInterval)
+		ctx, cancel := context.WithTimeout(context.Background(), dbusTimeout())
+		var state string
+		var code *int
+		conn, err := getDBusConnection(ctx)
+		if err == nil {
+			state, code, err = checkJob(ctx, conn, job.Unit)
+			conn.Close()
+		}
+		cancel()
+		if err != nil {
+			log.Printf("Warning: failed to check job %s: %v", job.Unit, err)
+		}
+		if (err == nil && state != JobRunning) || time.Now().After(deadline) {
+			finishJob(job, state, code, err, record)
+			return
+		}
+	}
+}
+
+// finishJob records the result of job.
+func finishJob(job *TransientJob, state string, code *int, err error, record execAuditRecord) {
+	now := time.Now().UTC()
+	jobsLock.Lock()
+	switch {
+	case err != nil:
+		job.State, job.Error = JobFailed, err.Error()
+	case state == JobRunning:
+		job.State, job.Error = JobFailed, "no result from systemd"
+	default:
+		job.State = state
+	}
+	job.ExitCode = code
+	job.FinishedAt = &now
+	result := job.State
+	jobsLock.Unlock()
+
+	record.Time = now
+	record.ExitCode = code
+	record.DurationSeconds = now.Sub(job.StartedAt).Seconds()
+	record.TimedOut = state == JobTimedOut
+	if err != nil {
+		record.Error = err.Error()
+	}
+	auditExec(record)
+	publishEvent(EventUnitChanged, UnitEvent{Unit: job.Unit, Action: "run", Result: result})
+}
+
+// addJob keeps job, dropping the oldest finished jobs beyond maxJobs.
+func addJob(job *TransientJob) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	jobs = append(jobs, job)
+	for i := 0; len(jobs) > maxJobs && i < len(jobs); {
+		if jobs[i].State != JobRunning {
+			jobs = append(jobs[:i], jobs[i+1:]...)
+			continue
+		}
+		i++
+	}
+}
+
+// runningJob reports whether a job of command is running.
+func runningJob(command string) bool {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	for _, job := range jobs {
+		if job.Command == command && job.State == JobRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// findJob returns a copy of the job with id.
+func findJob(id string) (TransientJob, bool) {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	for _, job := range jobs {
+		if job.ID == id {
+			return *job, true
+		}
+	}
+	return TransientJob{}, false
+}
+
+func listJobs() []TransientJob {
+	jobsLock.Lock()
+	defer jobsLock.Unlock()
+	list := make([]TransientJob, 0, len(jobs))
+	for _, job := range jobs {
+		list = append(list, *job)
+	}
+	return list
+}
+
+// readJobOutput returns the last maxExecOutputBytes of path and whether
+// earlier output was cut.
+func readJobOutput(path string) (string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return "", false
+	}
+	truncated := info.Size() > maxExecOutputBytes
+	if truncated {
+		if _, err := file.Seek(-maxExecOutputBytes, io.SeekEnd); err != nil {
+			return "", false
+		}
+	}
+	data, _ := io.ReadAll(io.LimitReader(file, maxExecOutputBytes))
+	return string(data), truncated
+}
+
+// HandleJobs starts a job from exec.jobs as a transient systemd unit
+// (POST) or reports the started jobs (GET), a single one with its output
+// when id is given. Jobs are audited like exec commands.
+func HandleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: listJobs()})
+			return
+		}
+		job, ok := findJob(id)
+		if !ok {
+			JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Задание не найдено: %s", id)})
+			return
+		}
+		job.Output, job.Truncated = readJobOutput(jobOutputPath(job.Unit))
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: job})
+	case http.MethodPost:
+		startJobRequest(w, r)
+	default:
+		JSONResponse(w, http.StatusMethodNotAllowed, APIResponse{OK: false, ErrMsg: "Метод не разрешён"})
+	}
+}
+
+func startJobRequest(w http.ResponseWriter, r *http.Request) {
+	var req ExecRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+		return
+	}
+
+	record := execAuditRecord{Time: time.Now().UTC(), RemoteAddr: r.RemoteAddr, Command: req.Command, Args: req.Args, Job: true}
+	job, _, err := resolveExecJob(GetCurrentConfig().Exec, req)
+	if err != nil {
+		record.Reason = err.Error()
+		auditExec(record)
+		if errors.Is(err, errExecNotAllowed) {
+			JSONResponse(w, http.StatusForbidden, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Команда не разрешена: %v", err)})
+			return
+		}
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Ошибка конфигурации exec: %v", err)})
+		return
+	}
+	if runningJob(req.Command) {
+		JSONResponse(w, http.StatusConflict, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Задание %s уже выполняется", req.Command)})
+		return
+	}
+	record.Allowed = true
+
+	conn, err := getDBusConnection(r.Context())
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось подключиться к D-Bus: %v", err)})
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), dbusTimeout())
+	defer cancel()
+
+	started := &TransientJob{ID: newJobID(), Command: req.Command, Args: req.Args, State: JobRunning, StartedAt: time.Now().UTC()}
+	started.Unit = jobUnitPrefix + started.ID + ".service"
+	if err := startJob(ctx, conn, started.Unit, req); err != nil {
+		record.Error = err.Error()
+		auditExec(record)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось запустить задание: %v", err)})
+		return
+	}
+	log.Printf("Started job %s (%s) as %s", started.ID, req.Command, started.Unit)
+	response := *started
+	addJob(started)
+	go watchJob(started, jobTimeout(job), record)
+
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: response})
+}
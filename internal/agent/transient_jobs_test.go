@@ -0,0 +1,203 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+)
+
+func TestJobLimits(t *testing.T) {
+	if quota, err := parseCPUQuota("50%"); err != nil || quota != 500*time.Millisecond {
+		t.Fatalf("cpu quota = %v, %v", quota, err)
+	}
+	if size, err := parseMemorySize("256M"); err != nil || size != 256<<20 {
+		t.Fatalf("memory = %v, %v", size, err)
+	}
+	if size, err := parseMemorySize("4096"); err != nil || size != 4096 {
+		t.Fatalf("memory = %v, %v", size, err)
+	}
+	for _, job := range []ExecJobConfig{
+		{ExecCommandConfig: ExecCommandConfig{Name: "fsck"}, CPUQuota: "50"},
+		{ExecCommandConfig: ExecCommandConfig{Name: "fsck"}, MemoryMax: "lots"},
+		{ExecCommandConfig: ExecCommandConfig{Name: "fsck"}, IOWeight: 20000},
+		{ExecCommandConfig: ExecCommandConfig{Name: "fsck"}, Nice: 30},
+		{},
+	} {
+		if err := validateExecJobs(ExecConfig{Jobs: []ExecJobConfig{job}}); err == nil {
+			t.Errorf("expected an error for %+v", job)
+		}
+	}
+
+	job := ExecJobConfig{ExecCommandConfig: ExecCommandConfig{Name: "fsck", Timeout: time.Hour}, CPUQuota: "25%", MemoryMax: "64M", IOWeight: 10, Nice: 5}
+	props := map[string]any{}
+	for _, prop := range jobUnitProperties(job, []string{"/sbin/fsck", "-n"}, "/tmp/out.log") {
+		props[prop.Name] = prop.Value.Value()
+	}
+	for name, want := range map[string]any{
+		"Type":                       "oneshot",
+		"TimeoutStartUSec":           uint64(time.Hour / time.Microsecond),
+		"StandardOutputFileToAppend": "/tmp/out.log",
+		"CPUQuotaPerSecUSec":         uint64(250000),
+		"MemoryMax":                  uint64(64 << 20),
+		"IOWeight":                   uint64(10),
+		"Nice":                       int32(5),
+	} {
+		if props[name] != want {
+			t.Errorf("%s = %v, want %v", name, props[name], want)
+		}
+	}
+
+	if !isJobUnit("media-pi-job-0a1b.service") || isJobUnit("media-pi-job-../x.service") || isJobUnit("ssh.service") {
+		t.Fatal("isJobUnit")
+	}
+}
+
+type jobUnitConn struct {
+	noopDBusConnection
+	mu      sync.Mutex
+	started string
+	argv    []string
+	states  []string
+	reset   bool
+}
+
+func (c *jobUnitConn) StartTransientUnitContext(ctx context.Context, name, mode string, properties []dbus.Property, ch chan<- string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.started = name
+	for _, prop := range properties {
+		if prop.Name == "ExecStart" {
+			c.argv = append(c.argv, fmt.Sprint(prop.Value.Value()))
+		}
+	}
+	return 1, nil
+}
+
+func (c *jobUnitConn) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state := c.states[0]
+	if len(c.states) > 1 {
+		c.states = c.states[1:]
+	}
+	return map[string]any{"ActiveState": state}, nil
+}
+
+func (c *jobUnitConn) GetUnitTypePropertiesContext(ctx context.Context, unit, unitType string) (map[string]any, error) {
+	return map[string]any{"Result": "exit-code", "ExecMainStatus": int32(4)}, nil
+}
+
+func (c *jobUnitConn) ResetFailedUnitContext(ctx context.Context, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reset = true
+	return nil
+}
+
+func TestHandleJobsRunsTransientUnit(t *testing.T) {
+	originalFactory, originalDir, originalPoll, originalAudit := dbusFactory, jobOutputDir, jobPollInterval, execAuditLogPath
+	t.Cleanup(func() {
+		SetDBusConnectionFactory(originalFactory)
+		jobOutputDir, jobPollInterval, execAuditLogPath = originalDir, originalPoll, originalAudit
+		jobsLock.Lock()
+		jobs = nil
+		jobsLock.Unlock()
+	})
+	jobOutputDir = t.TempDir()
+	jobPollInterval = time.Millisecond
+	execAuditLogPath = filepath.Join(t.TempDir(), "exec-audit.jsonl")
+	conn := &jobUnitConn{states: []string{"activating", "failed"}}
+	SetDBusConnectionFactory(func(ctx context.Context) (DBusConnection, error) { return conn, nil })
+	setCurrentConfigForTest(t, Config{Exec: ExecConfig{Jobs: []ExecJobConfig{
+		{ExecCommandConfig: ExecCommandConfig{Name: "fsck", Command: []string{"/sbin/fsck", "-n"}, Args: []string{"/dev/mmcblk0p[0-9]"}}},
+	}}})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		HandleJobs(w, httptest.NewRequest(http.MethodPost, "/api/system/jobs", strings.NewReader(body)))
+		return w
+	}
+	if w := post(`{"command":"fsck","args":["/dev/sda1"]}`); w.Code != http.StatusForbidden {
+		t.Fatalf("argument outside the patterns: status %d", w.Code)
+	}
+	finished := make(chan Event, 1)
+	unsubscribe := SubscribeEvents(func(event Event) { finished <- event }, EventUnitChanged)
+	defer unsubscribe()
+	w := post(`{"command":"fsck","args":["/dev/mmcblk0p3"]}`)
+	var resp struct {
+		Data TransientJob `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK || resp.Data.State != JobRunning {
+		t.Fatalf("status %d, body %s", w.Code, w.Body.String())
+	}
+	started := resp.Data
+	conn.mu.Lock()
+	if conn.started != started.Unit || !isJobUnit(started.Unit) || len(conn.argv) != 1 || !strings.Contains(conn.argv[0], "/dev/mmcblk0p3") {
+		t.Fatalf("started %s with %v", conn.started, conn.argv)
+	}
+	conn.mu.Unlock()
+	if err := os.WriteFile(jobOutputPath(started.Unit), []byte("fsck: errors found\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the job did not finish")
+	}
+
+	w = httptest.NewRecorder()
+	HandleJobs(w, httptest.NewRequest(http.MethodGet, "/api/system/jobs?id="+started.ID, nil))
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s", w.Code, w.Body.String())
+	}
+	if resp.Data.State != JobFailed || resp.Data.ExitCode == nil || *resp.Data.ExitCode != 4 || resp.Data.Output != "fsck: errors found\n" {
+		t.Fatalf("job = %+v", resp.Data)
+	}
+	conn.mu.Lock()
+	if !conn.reset {
+		t.Error("the failed unit must be reset")
+	}
+	conn.mu.Unlock()
+
+	w = httptest.NewRecorder()
+	HandleJobs(w, httptest.NewRequest(http.MethodGet, "/api/system/jobs?id=missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown job: status %d", w.Code)
+	}
+}
+
+func TestHelperRunsOnlyJobUnits(t *testing.T) {
+	for _, req := range []helperRequest{
+		{Op: helperOpRunJob, Unit: "ssh.service", Command: "fsck"},
+		{Op: helperOpResetFailed, Unit: "ssh.service"},
+	} {
+		if err := authorizeHelperRequest(t.Context(), &HelperPolicy{}, syscall.Ucred{}, req); err == nil {
+			t.Errorf("%s of %s must be rejected", req.Op, req.Unit)
+		}
+	}
+	if err := authorizeHelperRequest(t.Context(), &HelperPolicy{}, syscall.Ucred{}, helperRequest{Op: helperOpRunJob, Unit: "media-pi-job-0a1b.service"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGarbageCollectionKeepsJobOutput(t *testing.T) {
+	rootStatePaths(t)
+	if garbage := garbageNextTo(t, jobOutputPath("media-pi-job-0a1b.service")); len(garbage) != 0 {
+		t.Fatalf("job output must not be garbage collected: %v", garbage)
+	}
+}
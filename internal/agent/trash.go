@@ -0,0 +1,290 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trashDirName is the directory inside the media directory that receives
+// files removed by garbage collection. Each collection run moves files
+// into its own batch directory named after the time of the run.
+const trashDirName = ".trash"
+
+// trashBatchLayout names batch directories; it sorts chronologically.
+const trashBatchLayout = "20060102T150405.000000000Z"
+
+// DefaultTrashRetention is how long garbage collected files are kept.
+const DefaultTrashRetention = 7 * 24 * time.Hour
+
+const metricTrashPurged = "media_pi_trash_files_purged_total"
+
+func init() {
+	registerCounter(metricTrashPurged, "Files permanently deleted from the media trash.")
+}
+
+// restoredFilesPath persists the files restored from the trash, which
+// garbage collection keeps until a manifest lists them.
+var restoredFilesPath = filepath.Join(agentStateDir, "restored.json")
+
+var (
+	restoredFiles     = map[string]struct{}{}
+	restoredFilesLock sync.Mutex
+)
+
+// TrashEntry describes one file in the media trash.
+type TrashEntry struct {
+	ID        string    `json:"id"`   // batch/relative path, used to restore
+	Path      string    `json:"path"` // original path relative to the media directory
+	SizeBytes int64     `json:"sizeBytes"`
+	TrashedAt time.Time `json:"trashedAt"`
+}
+
+// TrashRestoreRequest is the body of POST /api/media/trash/restore.
+type TrashRestoreRequest struct {
+	ID string `json:"id"`
+}
+
+func trashDir(mediaDir string) string {
+	return filepath.Join(mediaDir, trashDirName)
+}
+
+// newTrashBatch returns the batch directory for one garbage collection run.
+func newTrashBatch(mediaDir string, now time.Time) string {
+	return filepath.Join(trashDir(mediaDir), now.UTC().Format(trashBatchLayout))
+}
+
+// moveToTrash moves path, which lies inside mediaDir, into batchDir while
+// keeping its relative location so it can be restored.
+func moveToTrash(mediaDir, batchDir, path string) error {
+	rel, err := filepath.Rel(mediaDir, path)
+	if err != nil {
+		return err
+	}
+	dest := filepath.Join(batchDir, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.Rename(path, dest)
+}
+
+// listTrash returns all files in the media trash, newest batch first.
+func listTrash(mediaDir string) ([]TrashEntry, error) {
+	root := trashDir(mediaDir)
+	batches, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return []TrashEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []TrashEntry{}
+	for i := len(batches) - 1; i >= 0; i-- {
+		batch := batches[i]
+		trashedAt, err := time.Parse(trashBatchLayout, batch.Name())
+		if !batch.IsDir() || err != nil {
+			continue
+		}
+		batchDir := filepath.Join(root, batch.Name())
+		_ = filepath.Walk(batchDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(batchDir, path)
+			if err != nil {
+				return nil
+			}
+			entries = append(entries, TrashEntry{
+				ID:        batch.Name() + "/" + filepath.ToSlash(rel),
+				Path:      filepath.ToSlash(rel),
+				SizeBytes: info.Size(),
+				TrashedAt: trashedAt,
+			})
+			return nil
+		})
+	}
+	return entries, nil
+}
+
+// restoreFromTrash moves a trashed file back to its original location. It
+// refuses to overwrite a file that has been synced there since.
+func restoreFromTrash(mediaDir, id string) (string, error) {
+	batch, rel, ok := strings.Cut(id, "/")
+	if !ok || rel == "" {
+		return "", fmt.Errorf("invalid trash id")
+	}
+	if _, err := time.Parse(trashBatchLayout, batch); err != nil {
+		return "", fmt.Errorf("invalid trash id")
+	}
+	relPath := filepath.FromSlash(rel)
+	if filepath.IsAbs(relPath) || filepath.Clean(relPath) != relPath || strings.HasPrefix(relPath, "..") {
+		return "", fmt.Errorf("invalid trash id")
+	}
+
+	src := filepath.Join(trashDir(mediaDir), batch, relPath)
+	if info, err := os.Stat(src); err != nil || info.IsDir() {
+		return "", fmt.Errorf("trash entry not found")
+	}
+	dest := filepath.Join(mediaDir, relPath)
+	if _, err := os.Lstat(dest); err == nil {
+		return "", fmt.Errorf("file %s already exists", rel)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(src, dest); err != nil {
+		return "", err
+	}
+	log.Printf("Restored %s from trash", dest)
+	restoredFilesLock.Lock()
+	restoredFiles[dest] = struct{}{}
+	restoredFilesLock.Unlock()
+	persistRestoredFiles()
+	return filepath.ToSlash(relPath), nil
+}
+
+// keepRestoredFiles adds the restored files to expected, so garbage
+// collection leaves them alone. A file the manifest lists (already in
+// expected) or that is gone is forgotten: from then on the manifest
+// decides about it.
+func keepRestoredFiles(expected map[string]struct{}) {
+	restoredFilesLock.Lock()
+	changed := false
+	for path := range restoredFiles {
+		_, listed := expected[path]
+		if _, err := os.Lstat(path); listed || err != nil {
+			delete(restoredFiles, path)
+			changed = true
+			continue
+		}
+		expected[path] = struct{}{}
+	}
+	restoredFilesLock.Unlock()
+	if changed {
+		persistRestoredFiles()
+	}
+}
+
+func persistRestoredFiles() {
+	restoredFilesLock.Lock()
+	paths := slices.Sorted(maps.Keys(restoredFiles))
+	restoredFilesLock.Unlock()
+	if err := writeStateFile(restoredFilesPath, paths); err != nil {
+		log.Printf("Warning: Failed to persist restored files: %v", err)
+	}
+}
+
+func loadRestoredFiles() {
+	var paths []string
+	switch err := readStateFile(restoredFilesPath, &paths); {
+	case err == nil:
+		restoredFilesLock.Lock()
+		restoredFiles = make(map[string]struct{}, len(paths))
+		for _, path := range paths {
+			restoredFiles[path] = struct{}{}
+		}
+		restoredFilesLock.Unlock()
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("Warning: ignoring restored files: %v", err)
+	}
+}
+
+// purgeTrash permanently deletes trash batches older than retention and
+// returns the number of files removed.
+func purgeTrash(mediaDir string, retention time.Duration, now time.Time) (int, error) {
+	root := trashDir(mediaDir)
+	batches, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	var errs []string
+	for _, batch := range batches {
+		trashedAt, err := time.Parse(trashBatchLayout, batch.Name())
+		if !batch.IsDir() || err != nil || now.Sub(trashedAt) < retention {
+			continue
+		}
+		batchDir := filepath.Join(root, batch.Name())
+		_ = filepath.Walk(batchDir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				purged++
+			}
+			return nil
+		})
+		log.Printf("Purging media trash batch %s", batch.Name())
+		if err := os.RemoveAll(batchDir); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", batchDir, err))
+		}
+	}
+	metricAdd(metricTrashPurged, float64(purged))
+	if len(errs) > 0 {
+		return purged, fmt.Errorf("%v", errs)
+	}
+	return purged, nil
+}
+
+func trashRetention(config Config) time.Duration {
+	if config.Sync.TrashRetention > 0 {
+		return config.Sync.TrashRetention
+	}
+	return DefaultTrashRetention
+}
+
+// HandleTrashList lists files removed by garbage collection.
+func HandleTrashList(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	entries, err := listTrash(mediaDirFor(GetCurrentConfig()))
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось прочитать корзину: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: entries})
+}
+
+// HandleTrashRestore moves a file from the trash back into the media
+// directory.
+func HandleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req TrashRestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.ID) == "" {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Поле id обязательно"})
+		return
+	}
+
+	restored, err := restoreFromTrash(mediaDirFor(GetCurrentConfig()), strings.TrimSpace(req.ID))
+	if err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось восстановить файл: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: MenuActionResponse{
+			Action:  "trash-restore",
+			Result:  "success",
+			Message: fmt.Sprintf("Файл %s восстановлен", restored),
+		},
+	})
+}
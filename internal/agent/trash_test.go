@@ -0,0 +1,150 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func resetRestoredFilesForTest(t *testing.T) {
+	t.Helper()
+	rootStatePaths(t)
+	reset := func() {
+		restoredFilesLock.Lock()
+		restoredFiles = map[string]struct{}{}
+		restoredFilesLock.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestGarbageCollectMovesFilesToTrashAndRestores(t *testing.T) {
+	resetRestoredFilesForTest(t)
+	mediaDir := t.TempDir()
+	manual := filepath.Join(mediaDir, "manual", "promo.mp4")
+	if err := os.MkdirAll(filepath.Dir(manual), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(manual, []byte("promo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := garbageCollect(mediaDir, map[string]struct{}{}); err != nil {
+		t.Fatalf("garbageCollect() error = %v", err)
+	}
+	if _, err := os.Stat(manual); !os.IsNotExist(err) {
+		t.Fatalf("expected file to leave the media dir, stat err = %v", err)
+	}
+
+	entries, err := listTrash(mediaDir)
+	if err != nil {
+		t.Fatalf("listTrash() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != "manual/promo.mp4" || entries[0].SizeBytes != 5 {
+		t.Fatalf("unexpected trash entries %+v", entries)
+	}
+
+	// A second collection must not sweep the trash itself.
+	if err := garbageCollect(mediaDir, map[string]struct{}{}); err != nil {
+		t.Fatalf("second garbageCollect() error = %v", err)
+	}
+	if entries, _ := listTrash(mediaDir); len(entries) != 1 {
+		t.Fatalf("expected trash to be left alone, got %+v", entries)
+	}
+
+	restored, err := restoreFromTrash(mediaDir, entries[0].ID)
+	if err != nil {
+		t.Fatalf("restoreFromTrash() error = %v", err)
+	}
+	if restored != "manual/promo.mp4" {
+		t.Errorf("restored = %q", restored)
+	}
+	if data, err := os.ReadFile(manual); err != nil || string(data) != "promo" {
+		t.Fatalf("file not restored: %v %q", err, data)
+	}
+}
+
+func TestSyncKeepsRestoredFileUntilManifestListsIt(t *testing.T) {
+	resetRestoredFilesForTest(t)
+	mediaDir := t.TempDir()
+	config := Config{Playlist: PlaylistConfig{Destination: mediaDir}}
+	promo := filepath.Join(mediaDir, "promo.mp4")
+	writeMediaFilesForTest(t, mediaDir, "promo.mp4")
+	if err := fileSyncerFor(config, nil).finish(); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := listTrash(mediaDir)
+	if len(entries) != 1 {
+		t.Fatalf("expected promo.mp4 in the trash, got %+v", entries)
+	}
+	if _, err := restoreFromTrash(mediaDir, entries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The restored file survives syncs of a manifest without it, also
+	// after a restart.
+	loadRestoredFiles()
+	for i := 0; i < 2; i++ {
+		if err := fileSyncerFor(config, nil).finish(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(promo); err != nil {
+			t.Fatalf("sync %d collected the restored file: %v", i, err)
+		}
+	}
+
+	// Once a manifest lists the file, the manifest decides about it.
+	listed := fileSyncerFor(config, nil)
+	listed.expectedFiles[promo] = struct{}{}
+	if err := listed.finish(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileSyncerFor(config, nil).finish(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(promo); !os.IsNotExist(err) {
+		t.Fatalf("expected the file to be collected after the manifest dropped it, got %v", err)
+	}
+}
+
+func TestRestoreFromTrashRejectsInvalidIDs(t *testing.T) {
+	mediaDir := t.TempDir()
+	for _, id := range []string{"", "nobatch", "20260101T000000.000000000Z/../../etc/passwd", "bad/a.mp4", "20260101T000000.000000000Z/missing.mp4"} {
+		if _, err := restoreFromTrash(mediaDir, id); err == nil {
+			t.Errorf("expected %q to be rejected", id)
+		}
+	}
+}
+
+func TestPurgeTrashRemovesExpiredBatches(t *testing.T) {
+	mediaDir := t.TempDir()
+	now := time.Now()
+	oldBatch := newTrashBatch(mediaDir, now.Add(-48*time.Hour))
+	newBatch := newTrashBatch(mediaDir, now.Add(-time.Hour))
+	for _, dir := range []string{oldBatch, newBatch} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "a.mp4"), []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := purgeTrash(mediaDir, 24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("purgeTrash() error = %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("purged = %d, want 1", purged)
+	}
+	if _, err := os.Stat(oldBatch); !os.IsNotExist(err) {
+		t.Errorf("expected expired batch removed, stat err = %v", err)
+	}
+	if _, err := os.Stat(newBatch); err != nil {
+		t.Errorf("expected recent batch kept: %v", err)
+	}
+}
@@ -0,0 +1,276 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TunnelConfig describes the jump host of on-demand reverse SSH tunnels,
+// which let support reach devices behind carrier-grade NAT. The tunnel
+// forwards RemotePort on the jump host to LocalAddr on the device.
+type TunnelConfig struct {
+	Host string `yaml:"host,omitempty"`
+	Port int    `yaml:"port,omitempty"`
+	User string `yaml:"user,omitempty"`
+	// IdentityFile and KnownHostsFile are used as for sync.sftp; unknown
+	// host keys are always rejected.
+	IdentityFile   string `yaml:"identity_file,omitempty"`
+	KnownHostsFile string `yaml:"known_hosts_file,omitempty"`
+	// RemotePort is the port opened on the jump host; 0 lets the jump host
+	// allocate one, which is reported in the tunnel status.
+	RemotePort int `yaml:"remote_port,omitempty"`
+	// LocalAddr is the device address the tunnel leads to.
+	LocalAddr string `yaml:"local_addr,omitempty"`
+	// MaxDuration bounds how long a tunnel stays open.
+	MaxDuration time.Duration `yaml:"max_duration,omitempty"`
+}
+
+// Defaults for reverse tunnels.
+const (
+	DefaultTunnelPort        = 22
+	DefaultTunnelLocalAddr   = "localhost:22"
+	DefaultTunnelDuration    = 30 * time.Minute
+	DefaultTunnelMaxDuration = 4 * time.Hour
+
+	metricTunnelActive = "media_pi_tunnel_active"
+)
+
+func init() {
+	registerGauge(metricTunnelActive, "1 while a reverse SSH tunnel is open.")
+}
+
+var (
+	// tunnelCommand builds the ssh process of a tunnel. Tests may override
+	// it.
+	tunnelCommand = func(ctx context.Context, args ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, "ssh", args...)
+	}
+
+	tunnelLock   sync.Mutex
+	tunnelCancel context.CancelFunc
+	tunnelState  TunnelStatus
+
+	allocatedPortPattern = regexp.MustCompile(`Allocated port (\d+)`)
+)
+
+// errTunnelActive is returned when a tunnel is already open.
+var errTunnelActive = errors.New("tunnel is already open")
+
+// TunnelStatus is returned by the tunnel endpoints.
+type TunnelStatus struct {
+	Active     bool       `json:"active"`
+	Host       string     `json:"host,omitempty"`
+	RemotePort int        `json:"remotePort,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	// LastError is the reason the previous tunnel ended early.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// TunnelStartRequest is the body of POST /api/system/tunnel/start.
+type TunnelStartRequest struct {
+	DurationSeconds int `json:"durationSeconds,omitempty"`
+}
+
+// tunnelArgs returns the ssh arguments of a tunnel to config.
+func tunnelArgs(config TunnelConfig) []string {
+	port := config.Port
+	if port == 0 {
+		port = DefaultTunnelPort
+	}
+	localAddr := config.LocalAddr
+	if localAddr == "" {
+		localAddr = DefaultTunnelLocalAddr
+	}
+	args := []string{"-N", "-T",
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=30",
+		"-o", "ServerAliveCountMax=3",
+		"-p", strconv.Itoa(port),
+		"-R", fmt.Sprintf("%d:%s", config.RemotePort, localAddr),
+	}
+	if config.IdentityFile != "" {
+		args = append(args, "-i", config.IdentityFile)
+	}
+	if config.KnownHostsFile != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+config.KnownHostsFile)
+	}
+	target := config.Host
+	if config.User != "" {
+		target = config.User + "@" + config.Host
+	}
+	return append(args, target)
+}
+
+func tunnelDuration(config TunnelConfig, requested time.Duration) time.Duration {
+	if requested <= 0 {
+		requested = DefaultTunnelDuration
+	}
+	limit := config.MaxDuration
+	if limit <= 0 {
+		limit = DefaultTunnelMaxDuration
+	}
+	return min(requested, limit)
+}
+
+func getTunnelStatus() TunnelStatus {
+	tunnelLock.Lock()
+	defer tunnelLock.Unlock()
+	return tunnelState
+}
+
+// StartTunnel opens a reverse tunnel to the jump host for duration; it is
+// torn down automatically when the duration is over.
+func StartTunnel(duration time.Duration) (TunnelStatus, error) {
+	config := GetCurrentConfig().Tunnel
+	if strings.TrimSpace(config.Host) == "" {
+		return TunnelStatus{}, errors.New("tunnel.host is required")
+	}
+
+	tunnelLock.Lock()
+	defer tunnelLock.Unlock()
+	if tunnelState.Active {
+		return tunnelState, errTunnelActive
+	}
+
+	duration = tunnelDuration(config, duration)
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+	cmd := tunnelCommand(ctx, tunnelArgs(config)...)
+	// A pipe of our own rather than StderrPipe, so a child keeping stderr
+	// open cannot hold the teardown beyond WaitDelay.
+	stderr, stderrWriter := io.Pipe()
+	cmd.Stderr = stderrWriter
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return TunnelStatus{}, fmt.Errorf("start ssh: %w", err)
+	}
+
+	started := time.Now().UTC()
+	expires := started.Add(duration)
+	tunnelCancel = cancel
+	tunnelState = TunnelStatus{Active: true, Host: config.Host, RemotePort: config.RemotePort, StartedAt: &started, ExpiresAt: &expires}
+	metricSet(metricTunnelActive, 1)
+	log.Printf("Reverse tunnel to %s opened until %s", config.Host, expires.Format(time.RFC3339))
+
+	go watchTunnel(ctx, cmd, stderr, stderrWriter, cancel)
+	return tunnelState, nil
+}
+
+// watchTunnel follows the ssh output for the allocated port and records
+// how the tunnel ended.
+func watchTunnel(ctx context.Context, cmd *exec.Cmd, stderr *io.PipeReader, stderrWriter *io.PipeWriter, cancel context.CancelFunc) {
+	defer cancel()
+	lastLine := make(chan string, 1)
+	go func() {
+		var last string
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			last = line
+			if match := allocatedPortPattern.FindStringSubmatch(line); match != nil {
+				port, _ := strconv.Atoi(match[1])
+				tunnelLock.Lock()
+				tunnelState.RemotePort = port
+				tunnelLock.Unlock()
+				log.Printf("Reverse tunnel listens on port %d of the jump host", port)
+			}
+		}
+		_, _ = io.Copy(io.Discard, stderr)
+		lastLine <- last
+	}()
+	err := cmd.Wait()
+	_ = stderrWriter.Close()
+	last := <-lastLine
+
+	tunnelLock.Lock()
+	defer tunnelLock.Unlock()
+	state := TunnelStatus{Host: tunnelState.Host}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		log.Printf("Reverse tunnel to %s closed: time is up", state.Host)
+	case errors.Is(ctx.Err(), context.Canceled):
+		log.Printf("Reverse tunnel to %s closed on request", state.Host)
+	default:
+		state.LastError = fmt.Sprintf("ssh exited: %v", err)
+		if last != "" {
+			state.LastError += ": " + last
+		}
+		log.Printf("Reverse tunnel to %s failed: %s", state.Host, state.LastError)
+	}
+	tunnelState = state
+	tunnelCancel = nil
+	metricSet(metricTunnelActive, 0)
+}
+
+// StopTunnel closes the open tunnel, if any.
+func StopTunnel() {
+	tunnelLock.Lock()
+	cancel := tunnelCancel
+	tunnelLock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// HandleTunnelStatus returns the reverse tunnel status.
+func HandleTunnelStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: getTunnelStatus()})
+}
+
+// HandleTunnelStart opens a time-limited reverse tunnel to tunnel.host.
+func HandleTunnelStart(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req TunnelStartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+		return
+	}
+	if req.DurationSeconds < 0 {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "durationSeconds не может быть отрицательным"})
+		return
+	}
+	status, err := StartTunnel(time.Duration(req.DurationSeconds) * time.Second)
+	switch {
+	case errors.Is(err, errTunnelActive):
+		JSONResponse(w, http.StatusConflict, APIResponse{OK: false, ErrMsg: "Туннель уже открыт", Data: status})
+	case err != nil:
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось открыть туннель: %v", err)})
+	default:
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: status})
+	}
+}
+
+// HandleTunnelStop closes the reverse tunnel.
+func HandleTunnelStop(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	StopTunnel()
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: MenuActionResponse{Action: "tunnel-stop", Result: "success", Message: "Туннель закрыт"}})
+}
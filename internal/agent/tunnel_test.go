@@ -0,0 +1,105 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setTunnelCommandForTest runs script with sh instead of ssh.
+func setTunnelCommandForTest(t *testing.T, script string) {
+	t.Helper()
+	original := tunnelCommand
+	tunnelCommand = func(ctx context.Context, args ...string) *exec.Cmd {
+		return exec.CommandContext(ctx, "sh", "-c", script)
+	}
+	t.Cleanup(func() {
+		StopTunnel()
+		waitForTunnel(t, func(status TunnelStatus) bool { return !status.Active })
+		tunnelCommand = original
+	})
+}
+
+func waitForTunnel(t *testing.T, done func(TunnelStatus) bool) TunnelStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := getTunnelStatus()
+		if done(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected tunnel status %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTunnelArgs(t *testing.T) {
+	args := tunnelArgs(TunnelConfig{Host: "jump.example.com", User: "support", RemotePort: 2201, IdentityFile: "/etc/media-pi-agent/tunnel_key"})
+	for _, want := range []string{"ExitOnForwardFailure=yes", "StrictHostKeyChecking=yes", "2201:localhost:22", "/etc/media-pi-agent/tunnel_key"} {
+		if !slices.Contains(args, want) {
+			t.Errorf("missing %q in %v", want, args)
+		}
+	}
+	if args[len(args)-1] != "support@jump.example.com" {
+		t.Errorf("target = %q", args[len(args)-1])
+	}
+	if got := tunnelDuration(TunnelConfig{MaxDuration: time.Hour}, 24*time.Hour); got != time.Hour {
+		t.Errorf("duration = %v, want capped at max_duration", got)
+	}
+}
+
+func TestStartTunnel(t *testing.T) {
+	setCurrentConfigForTest(t, Config{Tunnel: TunnelConfig{Host: "jump.example.com"}})
+	setTunnelCommandForTest(t, `echo "Allocated port 40123 for remote forward to localhost:22" >&2; sleep 10`)
+
+	status, err := StartTunnel(time.Minute)
+	if err != nil || !status.Active || status.ExpiresAt == nil {
+		t.Fatalf("StartTunnel() = %+v, %v", status, err)
+	}
+	waitForTunnel(t, func(status TunnelStatus) bool { return status.RemotePort == 40123 })
+
+	if _, err := StartTunnel(time.Minute); !errors.Is(err, errTunnelActive) {
+		t.Fatalf("expected errTunnelActive, got %v", err)
+	}
+
+	StopTunnel()
+	status = waitForTunnel(t, func(status TunnelStatus) bool { return !status.Active })
+	if status.LastError != "" {
+		t.Fatalf("expected a clean stop, got %q", status.LastError)
+	}
+}
+
+func TestStartTunnelExpires(t *testing.T) {
+	setCurrentConfigForTest(t, Config{Tunnel: TunnelConfig{Host: "jump.example.com", MaxDuration: 200 * time.Millisecond}})
+	setTunnelCommandForTest(t, `sleep 10`)
+
+	if _, err := StartTunnel(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	status := waitForTunnel(t, func(status TunnelStatus) bool { return !status.Active })
+	if status.LastError != "" {
+		t.Fatalf("expected the tunnel closed on time, got %q", status.LastError)
+	}
+}
+
+func TestStartTunnelFailure(t *testing.T) {
+	setCurrentConfigForTest(t, Config{Tunnel: TunnelConfig{Host: "jump.example.com"}})
+	setTunnelCommandForTest(t, `echo "support@jump.example.com: Permission denied (publickey)." >&2; exit 255`)
+
+	if _, err := StartTunnel(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	status := waitForTunnel(t, func(status TunnelStatus) bool { return !status.Active })
+	if !strings.Contains(status.LastError, "Permission denied") {
+		t.Fatalf("expected the ssh error reported, got %q", status.LastError)
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultPlayerCommand plays the playlist when player.command is not set.
+const DefaultPlayerCommand = "/usr/bin/cvlc --fullscreen --loop --no-video-title-show"
+
+// PlayerConfig describes how play.video.service runs the player.
+type PlayerConfig struct {
+	// Command is the player executable with its options; the playlist
+	// path is appended.
+	Command string `yaml:"command,omitempty"`
+	// IPCSocket is the JSON IPC socket of an mpv player, i.e. the value of
+	// its --input-ipc-server option; {output} is replaced with the display
+	// output name. Overlays need it.
+	IPCSocket string `yaml:"ipc_socket,omitempty"`
+	// ImageDuration is how long mpv or feh shows a playlist image without
+	// its own #EXTINF duration. Setting it enables slideshow configuration.
+	ImageDuration time.Duration `yaml:"image_duration,omitempty"`
+	// VerifyNext verifies the next playlist file against its cached digest
+	// while the current one plays and skips it when it is corrupt. It needs
+	// IPCSocket.
+	VerifyNext bool `yaml:"verify_next,omitempty"`
+}
+
+// AgentBinaryPath is where packaging installs the agent binary.
+var AgentBinaryPath = "/usr/local/bin/media-pi-agent"
+
+//go:embed units/*.tmpl
+var unitTemplateFS embed.FS
+
+var unitTemplates = template.Must(template.ParseFS(unitTemplateFS, "units/*.tmpl"))
+
+// UnitFile is a rendered systemd unit.
+type UnitFile struct {
+	Name    string
+	Content string
+	// Enable marks units enabled on install; timers are left to the admin
+	// because the agent schedules syncs itself.
+	Enable bool
+}
+
+func renderUnitTemplate(name string, data any) (string, error) {
+	var buf bytes.Buffer
+	if err := unitTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// RenderUnitFiles renders the agent, playback and upload units for config.
+// Playlist upload units are rendered only when playlist.source is set.
+func RenderUnitFiles(config Config) ([]UnitFile, error) {
+	destination := strings.TrimRight(config.Playlist.Destination, "/")
+
+	agentData := map[string]string{
+		"AgentBinary": SanitizeSystemdValue(AgentBinaryPath),
+		"User":        "root",
+		"Group":       "root",
+	}
+	// With the privileged helper the agent drops root.
+	helper := strings.TrimSpace(config.Helper.Socket) != ""
+	if helper {
+		user := SanitizeSystemdValue(config.MediaPiServiceUser)
+		if user == "" {
+			// An empty User= would run the agent as root.
+			return nil, fmt.Errorf("helper.socket is set but media_pi_service_user is empty")
+		}
+		agentData["Helper"] = "yes"
+		agentData["User"] = user
+		agentData["Group"] = DefaultHelperGroup
+		if group := strings.TrimSpace(config.Helper.Group); group != "" {
+			agentData["Group"] = SanitizeSystemdValue(group)
+		}
+	}
+	var sliceUnit *UnitFile
+	if cgroup := config.Sync.Cgroup; cgroup.enabled() {
+		content, err := renderUnitTemplate("media-pi-sync.slice.tmpl", map[string]string{
+			"CPUQuota":  SanitizeSystemdValue(cgroup.CPUQuota),
+			"IOWeight":  strconv.Itoa(cgroup.IOWeight),
+			"MemoryMax": SanitizeSystemdValue(cgroup.MemoryMax),
+		})
+		if err != nil {
+			return nil, err
+		}
+		sliceUnit = &UnitFile{Name: syncSliceName, Content: content}
+		agentData["Slice"] = syncSliceName
+	}
+	agentUnit, err := renderUnitTemplate("media-pi-agent.service.tmpl", agentData)
+	if err != nil {
+		return nil, err
+	}
+	playUnits, err := renderPlaybackUnits(config)
+	if err != nil {
+		return nil, err
+	}
+	units := append([]UnitFile{{Name: "media-pi-agent.service", Content: agentUnit, Enable: true}}, playUnits...)
+	if sliceUnit != nil {
+		units = append(units, *sliceUnit)
+	}
+	if config.Audio.Playback.Enabled {
+		audioUnit, err := renderAudioPlaybackUnit(config)
+		if err != nil {
+			return nil, err
+		}
+		units = append(units, audioUnit)
+	}
+	if helper {
+		helperUnit, err := renderUnitTemplate("media-pi-helper.service.tmpl", agentData)
+		if err != nil {
+			return nil, err
+		}
+		units = append(units, UnitFile{Name: "media-pi-helper.service", Content: helperUnit, Enable: true})
+	}
+
+	if source := strings.TrimRight(config.Playlist.Source, "/"); source != "" {
+		// Keep the rsync form parsed by readPlaylistUploadConfig.
+		playlistUnit, err := renderUnitTemplate("upload.service.tmpl", map[string]string{
+			"Description": "Playlist upload",
+			"Command":     SanitizeSystemdValue(fmt.Sprintf("/usr/bin/rsync -czavP %s/ %s/", source, destination)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		playlistTimes, err := normalizeTimes(config.Schedule.Playlist)
+		if err != nil {
+			return nil, fmt.Errorf("invalid playlist schedule: %w", err)
+		}
+		units = append(units,
+			UnitFile{Name: "playlist.upload.service", Content: playlistUnit},
+			UnitFile{Name: "playlist.upload.timer", Content: renderTimerSchedule("Playlist upload timer", "playlist.upload.service", playlistTimes)},
+		)
+	}
+
+	// SIGUSR1 asks the running agent for a video sync.
+	videoUnit, err := renderUnitTemplate("upload.service.tmpl", map[string]string{
+		"Description": "Video upload",
+		"Command":     "/bin/systemctl kill --signal=USR1 --kill-whom=main media-pi-agent.service",
+	})
+	if err != nil {
+		return nil, err
+	}
+	videoTimes, err := normalizeTimes(config.Schedule.Video)
+	if err != nil {
+		return nil, fmt.Errorf("invalid video schedule: %w", err)
+	}
+	units = append(units,
+		UnitFile{Name: "video.upload.service", Content: videoUnit},
+		UnitFile{Name: "video.upload.timer", Content: renderTimerSchedule("Video upload timer", "video.upload.service", videoTimes)},
+	)
+	return units, nil
+}
+
+// playerCommand returns player.command or the default player with the
+// flags of the board.
+func playerCommand(config Config) string {
+	if player := SanitizeSystemdValue(config.Player.Command); player != "" {
+		return player
+	}
+	if flags := currentBoard().PlayerFlags; flags != "" {
+		return DefaultPlayerCommand + " " + flags
+	}
+	return DefaultPlayerCommand
+}
+
+// displayPlayerArgs returns the player arguments selecting display's output.
+func displayPlayerArgs(display DisplayOutputConfig) string {
+	args := display.PlayerArgs
+	if args == "" {
+		args = DefaultDisplayPlayerArgs
+	}
+	return SanitizeSystemdValue(strings.ReplaceAll(args, "{output}", display.Output))
+}
+
+// renderPlaybackUnits renders play.video.service. With displays configured
+// it only groups one play.video@<output>.service per output; those units are
+// PartOf it, so starting, stopping and restarting it drives every output.
+func renderPlaybackUnits(config Config) ([]UnitFile, error) {
+	user := SanitizeSystemdValue(config.MediaPiServiceUser)
+	if user == "" {
+		user = "pi"
+	}
+	player := playerCommand(config)
+
+	if len(config.Displays) == 0 {
+		playUnit, err := renderUnitTemplate("play.video.service.tmpl", map[string]string{
+			"User":          user,
+			"PlayerCommand": player,
+			"Playlist":      playlistArgs(config, displayPlaylistPath(config, DisplayOutputConfig{})),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []UnitFile{{Name: playbackServiceUnit, Content: playUnit, Enable: true}}, nil
+	}
+
+	displays, err := normalizeDisplays(config.Displays)
+	if err != nil {
+		return nil, err
+	}
+	var units []UnitFile
+	var names []string
+	for _, display := range displays {
+		content, err := renderUnitTemplate("play.video.output.service.tmpl", map[string]string{
+			"Output":        display.Output,
+			"User":          user,
+			"PlayerCommand": player,
+			"PlayerArgs":    displayPlayerArgs(display),
+			"Playlist":      playlistArgs(config, displayPlaylistPath(config, display)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		name := playbackUnitForOutput(display.Output)
+		names = append(names, name)
+		units = append(units, UnitFile{Name: name, Content: content})
+	}
+	group, err := renderUnitTemplate("play.video.group.service.tmpl", map[string]string{
+		"Units": strings.Join(names, " "),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]UnitFile{{Name: playbackServiceUnit, Content: group, Enable: true}}, units...), nil
+}
+
+// InstallUnitFiles writes the rendered units into dir and, when enable is
+// set, reloads systemd and enables the units marked Enable. It returns the
+// written paths.
+func InstallUnitFiles(ctx context.Context, config Config, dir string, enable bool) ([]string, error) {
+	units, err := RenderUnitFiles(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	var written, toEnable []string
+	for _, unit := range units {
+		path := filepath.Join(dir, unit.Name)
+		tmpPath := path + ".tmp"
+		if err := os.WriteFile(tmpPath, []byte(unit.Content), 0644); err != nil {
+			return written, err
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			_ = os.Remove(tmpPath)
+			return written, err
+		}
+		written = append(written, path)
+		if unit.Enable {
+			toEnable = append(toEnable, unit.Name)
+		}
+	}
+	writeSlideshowConfigs(config)
+	if !enable {
+		return written, nil
+	}
+
+	conn, err := getDBusConnection(ctx)
+	if err != nil {
+		return written, fmt.Errorf("failed to connect to D-Bus: %w", err)
+	}
+	defer conn.Close()
+	opCtx, cancel := context.WithTimeout(ctx, dbusTimeout())
+	defer cancel()
+	if err := conn.ReloadContext(opCtx); err != nil {
+		return written, fmt.Errorf("daemon-reload failed: %w", err)
+	}
+	if _, _, err := conn.EnableUnitFilesContext(opCtx, toEnable, false, true); err != nil {
+		return written, fmt.Errorf("failed to enable units: %w", err)
+	}
+	return written, nil
+}
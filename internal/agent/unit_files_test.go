@@ -0,0 +1,136 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderUnitFiles(t *testing.T) {
+	config := Config{
+		MediaPiServiceUser: "pi",
+		Playlist:           PlaylistConfig{Source: "/mnt/src/playlist/", Destination: "/var/media-pi/"},
+		Schedule:           ScheduleConfig{Playlist: []string{"6:30"}, Video: []string{"02:00", "14:15"}},
+		Player:             PlayerConfig{Command: "/usr/bin/mpv --fs"},
+	}
+	units, err := RenderUnitFiles(config)
+	if err != nil {
+		t.Fatalf("RenderUnitFiles() error = %v", err)
+	}
+
+	byName := map[string]UnitFile{}
+	for _, unit := range units {
+		byName[unit.Name] = unit
+	}
+	for _, name := range []string{"media-pi-agent.service", "play.video.service", "playlist.upload.service", "playlist.upload.timer", "video.upload.service", "video.upload.timer"} {
+		if _, ok := byName[name]; !ok {
+			t.Fatalf("missing unit %s", name)
+		}
+	}
+
+	if !strings.Contains(byName["media-pi-agent.service"].Content, "ExecStart=/usr/local/bin/media-pi-agent\n") {
+		t.Errorf("agent unit has wrong ExecStart:\n%s", byName["media-pi-agent.service"].Content)
+	}
+	play := byName["play.video.service"].Content
+	if !strings.Contains(play, "ExecStart=/usr/bin/mpv --fs /var/media-pi/playlist.m3u\n") || !strings.Contains(play, "User=pi\n") {
+		t.Errorf("unexpected play.video.service:\n%s", play)
+	}
+	if !strings.Contains(byName["playlist.upload.timer"].Content, "OnCalendar=*-*-* 06:30:00\n") {
+		t.Errorf("unexpected playlist timer:\n%s", byName["playlist.upload.timer"].Content)
+	}
+	if !byName["play.video.service"].Enable || byName["video.upload.timer"].Enable {
+		t.Errorf("unexpected enable flags: %+v", units)
+	}
+
+	// The playlist upload unit keeps the format the agent parses and updates.
+	dir := t.TempDir()
+	path := filepath.Join(dir, "playlist.upload.service")
+	if err := os.WriteFile(path, []byte(byName["playlist.upload.service"].Content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := readPlaylistUploadConfig(path)
+	if err != nil {
+		t.Fatalf("readPlaylistUploadConfig() error = %v", err)
+	}
+	if parsed.Source != "/mnt/src/playlist/" || parsed.Destination != "/var/media-pi/" {
+		t.Errorf("parsed playlist upload config = %+v", parsed)
+	}
+}
+
+func TestRenderUnitFilesWithoutPlaylistSource(t *testing.T) {
+	units, err := RenderUnitFiles(Config{Playlist: PlaylistConfig{Destination: "/var/media-pi"}})
+	if err != nil {
+		t.Fatalf("RenderUnitFiles() error = %v", err)
+	}
+	for _, unit := range units {
+		if strings.HasPrefix(unit.Name, "playlist.upload") {
+			t.Errorf("unexpected %s without playlist source", unit.Name)
+		}
+		if unit.Name == playbackServiceUnit && !strings.Contains(unit.Content, DefaultPlayerCommand+" /var/media-pi/playlist.m3u") {
+			t.Errorf("expected default player command:\n%s", unit.Content)
+		}
+	}
+}
+
+func TestRenderUnitFilesRejectsInvalidSchedule(t *testing.T) {
+	if _, err := RenderUnitFiles(Config{Schedule: ScheduleConfig{Video: []string{"25:99"}}}); err == nil {
+		t.Fatal("expected invalid schedule error")
+	}
+}
+
+func TestInstallUnitFiles(t *testing.T) {
+	t.Setenv("MEDIA_PI_AGENT_MOCK_DBUS", "1")
+	dir := filepath.Join(t.TempDir(), "system")
+	written, err := InstallUnitFiles(context.Background(), Config{Playlist: PlaylistConfig{Destination: "/var/media-pi"}}, dir, true)
+	if err != nil {
+		t.Fatalf("InstallUnitFiles() error = %v", err)
+	}
+	if len(written) != 4 {
+		t.Fatalf("expected 4 unit files, got %v", written)
+	}
+	for _, path := range written {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("unit not written: %v", err)
+		}
+	}
+}
+
+func TestAgentUnitTemplateMatchesPackaging(t *testing.T) {
+	packaged, err := os.ReadFile(filepath.Join("..", "..", "packaging", "media-pi-agent.service"))
+	if err != nil {
+		t.Fatalf("read packaged unit: %v", err)
+	}
+	units, err := RenderUnitFiles(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if units[0].Name != "media-pi-agent.service" || units[0].Content != string(packaged) {
+		t.Errorf("embedded agent unit differs from packaging/media-pi-agent.service")
+	}
+}
+
+func TestRenderUnitFilesWithSyncCgroup(t *testing.T) {
+	units, err := RenderUnitFiles(Config{
+		Playlist: PlaylistConfig{Destination: "/var/media-pi"},
+		Sync:     SyncConfig{Cgroup: SyncCgroupConfig{CPUQuota: "50%", IOWeight: 50}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]string{}
+	for _, unit := range units {
+		byName[unit.Name] = unit.Content
+	}
+	if !strings.Contains(byName["media-pi-agent.service"], "\nSlice="+syncSliceName+"\n") {
+		t.Errorf("agent unit without the slice:\n%s", byName["media-pi-agent.service"])
+	}
+	slice := byName[syncSliceName]
+	if !strings.Contains(slice, "\nCPUQuota=50%\n") || !strings.Contains(slice, "\nIOWeight=50\n") || strings.Contains(slice, "MemoryMax") {
+		t.Errorf("unexpected slice:\n%s", slice)
+	}
+}
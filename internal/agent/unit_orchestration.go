@@ -0,0 +1,230 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// OrchestrationConfig is a named stack of units that depend on each other,
+// e.g. a mount, the player and an overlay. Units are listed in start order
+// and stopped in reverse, so one request replaces several round trips from
+// the core that could interleave with other requests.
+type OrchestrationConfig struct {
+	Name  string   `yaml:"name" json:"name"`
+	Units []string `yaml:"units" json:"units"`
+}
+
+// Orchestration actions.
+const (
+	orchestrationStart   = "start"
+	orchestrationStop    = "stop"
+	orchestrationRestart = "restart"
+)
+
+// orchestrationLock serializes orchestrations, which would otherwise undo
+// each other halfway.
+var orchestrationLock sync.Mutex
+
+// OrchestrationRequest is the body of POST /api/units/orchestrate.
+type OrchestrationRequest struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+}
+
+// OrchestrationStep is one verified unit operation.
+type OrchestrationStep struct {
+	Unit        string `json:"unit"`
+	Operation   string `json:"operation"`
+	Result      string `json:"result,omitempty"`
+	ActiveState string `json:"activeState,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// OrchestrationResponse reports the steps of an orchestration and, when a
+// step failed, the steps that restored the units touched before it.
+type OrchestrationResponse struct {
+	Name     string              `json:"name"`
+	Action   string              `json:"action"`
+	Steps    []OrchestrationStep `json:"steps"`
+	Rollback []OrchestrationStep `json:"rollback,omitempty"`
+}
+
+func validateOrchestrations(orchestrations []OrchestrationConfig, allowedUnits []string) error {
+	seen := make(map[string]bool, len(orchestrations))
+	for _, orchestration := range orchestrations {
+		name := strings.TrimSpace(orchestration.Name)
+		if name == "" {
+			return errors.New("orchestrations: name is required")
+		}
+		if seen[name] {
+			return fmt.Errorf("orchestrations: duplicate name %q", name)
+		}
+		seen[name] = true
+		if len(orchestration.Units) == 0 {
+			return fmt.Errorf("orchestrations.%s: units are required", name)
+		}
+		units := make(map[string]bool, len(orchestration.Units))
+		for _, unit := range orchestration.Units {
+			if !slices.Contains(allowedUnits, unit) {
+				return fmt.Errorf("orchestrations.%s: unit %q is not in allowed_units", name, unit)
+			}
+			if units[unit] {
+				return fmt.Errorf("orchestrations.%s: duplicate unit %q", name, unit)
+			}
+			units[unit] = true
+		}
+	}
+	return nil
+}
+
+func findOrchestration(orchestrations []OrchestrationConfig, name string) (OrchestrationConfig, bool) {
+	for _, orchestration := range orchestrations {
+		if orchestration.Name == name {
+			return orchestration, true
+		}
+	}
+	return OrchestrationConfig{}, false
+}
+
+// orchestrationPlan returns the unit operations of action in order: start
+// follows the configured order, stop the reverse, and restart stops the
+// whole stack before starting it again.
+func orchestrationPlan(units []string, action string) []OrchestrationStep {
+	reversed := slices.Clone(units)
+	slices.Reverse(reversed)
+	var steps []OrchestrationStep
+	if action == orchestrationStop || action == orchestrationRestart {
+		for _, unit := range reversed {
+			steps = append(steps, OrchestrationStep{Unit: unit, Operation: string(dbusUnitOperationStop)})
+		}
+	}
+	if action == orchestrationStart || action == orchestrationRestart {
+		for _, unit := range units {
+			steps = append(steps, OrchestrationStep{Unit: unit, Operation: string(dbusUnitOperationStart)})
+		}
+	}
+	return steps
+}
+
+// runOrchestrationStep runs one operation and waits until the unit
+// settles in the requested state.
+func runOrchestrationStep(ctx context.Context, conn DBusConnection, step OrchestrationStep) (OrchestrationStep, error) {
+	operation := dbusUnitOperation(step.Operation)
+	result, err := runDBusUnitOperation(ctx, conn, operation, step.Unit)
+	step.Result = result
+	if err == nil {
+		step.ActiveState, err = waitForUnitState(ctx, conn, step.Unit)
+	}
+	if err == nil && !unitReachedTarget(operation, result, step.ActiveState) {
+		err = fmt.Errorf("result %s, state %s", result, step.ActiveState)
+	}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	return step, err
+}
+
+// runOrchestration runs action on the units of orchestration. When a step
+// fails, the units changed so far are returned to the state they were in
+// before, in reverse order.
+func runOrchestration(ctx context.Context, conn DBusConnection, orchestration OrchestrationConfig, action string) (OrchestrationResponse, error) {
+	response := OrchestrationResponse{Name: orchestration.Name, Action: action}
+	initial := make(map[string]bool, len(orchestration.Units))
+	for _, unit := range orchestration.Units {
+		initial[unit] = isUnitActive(ctx, conn, unit)
+	}
+
+	var touched []string
+	for _, step := range orchestrationPlan(orchestration.Units, action) {
+		step, err := runOrchestrationStep(ctx, conn, step)
+		response.Steps = append(response.Steps, step)
+		if !slices.Contains(touched, step.Unit) {
+			touched = append(touched, step.Unit)
+		}
+		if err == nil {
+			continue
+		}
+
+		log.Printf("Orchestration %s %s failed at %s %s: %v, rolling back", orchestration.Name, action, step.Operation, step.Unit, err)
+		for i := len(touched) - 1; i >= 0; i-- {
+			unit := touched[i]
+			operation := dbusUnitOperationStop
+			if initial[unit] {
+				operation = dbusUnitOperationStart
+			}
+			restored, restoreErr := runOrchestrationStep(ctx, conn, OrchestrationStep{Unit: unit, Operation: string(operation)})
+			if restoreErr != nil {
+				log.Printf("Warning: orchestration %s rollback of %s failed: %v", orchestration.Name, unit, restoreErr)
+			}
+			response.Rollback = append(response.Rollback, restored)
+		}
+		return response, fmt.Errorf("%s %s: %w", step.Operation, step.Unit, err)
+	}
+	return response, nil
+}
+
+// HandleOrchestrations lists the configured unit orchestrations.
+func HandleOrchestrations(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	orchestrations := GetCurrentConfig().Orchestrations
+	if orchestrations == nil {
+		orchestrations = []OrchestrationConfig{}
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: orchestrations})
+}
+
+// HandleOrchestrate runs start, stop or restart on a configured unit stack
+// with per-step verification and rollback.
+func HandleOrchestrate(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req OrchestrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный JSON в теле запроса"})
+		return
+	}
+	switch req.Action {
+	case orchestrationStart, orchestrationStop, orchestrationRestart:
+	default:
+		JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Неизвестное действие: %s", req.Action)})
+		return
+	}
+	orchestration, ok := findOrchestration(GetCurrentConfig().Orchestrations, req.Name)
+	if !ok {
+		JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Оркестрация не найдена: %v", req.Name)})
+		return
+	}
+	if !orchestrationLock.TryLock() {
+		JSONResponse(w, http.StatusConflict, APIResponse{OK: false, ErrMsg: "Оркестрация уже выполняется"})
+		return
+	}
+	defer orchestrationLock.Unlock()
+
+	conn, err := getDBusConnection(r.Context())
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось подключиться к D-Bus: %v", err)})
+		return
+	}
+	defer conn.Close()
+
+	response, err := runOrchestration(r.Context(), conn, orchestration, req.Action)
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false,
+			ErrMsg: fmt.Sprintf("Оркестрация прервана, изменения отменены: %v", err), Data: response})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: response})
+}
@@ -0,0 +1,144 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// stackConn keeps the ActiveState of units; units in failing do not come
+// up when started.
+type stackConn struct {
+	noopDBusConnection
+	states  map[string]string
+	failing map[string]bool
+	ops     []string
+}
+
+func (c *stackConn) StartUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	c.ops = append(c.ops, "start "+name)
+	if c.failing[name] {
+		c.states[name] = "failed"
+		ch <- "failed"
+	} else {
+		c.states[name] = "active"
+		ch <- "done"
+	}
+	return 1, nil
+}
+
+func (c *stackConn) StopUnitContext(ctx context.Context, name, mode string, ch chan<- string) (int, error) {
+	c.ops = append(c.ops, "stop "+name)
+	c.states[name] = "inactive"
+	ch <- "done"
+	return 1, nil
+}
+
+func (c *stackConn) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error) {
+	return map[string]any{"ActiveState": c.states[unit]}, nil
+}
+
+func playbackStack() OrchestrationConfig {
+	return OrchestrationConfig{Name: "playback", Units: []string{"media.mount", "play.video.service", "overlay.service"}}
+}
+
+func TestValidateOrchestrations(t *testing.T) {
+	allowed := []string{"media.mount", "play.video.service", "overlay.service"}
+	if err := validateOrchestrations([]OrchestrationConfig{playbackStack()}, allowed); err != nil {
+		t.Fatalf("validateOrchestrations() error = %v", err)
+	}
+	for _, orchestrations := range [][]OrchestrationConfig{
+		{{Name: "", Units: allowed}},
+		{{Name: "a", Units: allowed}, {Name: "a", Units: allowed}},
+		{{Name: "a"}},
+		{{Name: "a", Units: []string{"ssh.service"}}},
+		{{Name: "a", Units: []string{"media.mount", "media.mount"}}},
+	} {
+		if err := validateOrchestrations(orchestrations, allowed); err == nil {
+			t.Errorf("expected an error for %+v", orchestrations)
+		}
+	}
+}
+
+func TestRunOrchestrationRestartsInDependencyOrder(t *testing.T) {
+	conn := &stackConn{states: map[string]string{"media.mount": "active", "play.video.service": "active", "overlay.service": "active"}}
+	response, err := runOrchestration(context.Background(), conn, playbackStack(), orchestrationRestart)
+	if err != nil {
+		t.Fatalf("runOrchestration() error = %v", err)
+	}
+	want := "stop overlay.service,stop play.video.service,stop media.mount,start media.mount,start play.video.service,start overlay.service"
+	if got := strings.Join(conn.ops, ","); got != want {
+		t.Fatalf("operations = %s, want %s", got, want)
+	}
+	if len(response.Steps) != 6 || response.Steps[5].ActiveState != "active" || response.Rollback != nil {
+		t.Fatalf("unexpected response %+v", response)
+	}
+}
+
+func TestRunOrchestrationRollsBack(t *testing.T) {
+	conn := &stackConn{
+		states:  map[string]string{"media.mount": "inactive", "play.video.service": "inactive", "overlay.service": "inactive"},
+		failing: map[string]bool{"play.video.service": true},
+	}
+	response, err := runOrchestration(context.Background(), conn, playbackStack(), orchestrationStart)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	want := "start media.mount,start play.video.service,stop play.video.service,stop media.mount"
+	if got := strings.Join(conn.ops, ","); got != want {
+		t.Fatalf("operations = %s, want %s", got, want)
+	}
+	if len(response.Steps) != 2 || response.Steps[1].Error == "" || len(response.Rollback) != 2 {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	if conn.states["media.mount"] != "inactive" {
+		t.Fatalf("media.mount was not rolled back: %s", conn.states["media.mount"])
+	}
+}
+
+func TestHandleOrchestrate(t *testing.T) {
+	originalFactory := dbusFactory
+	t.Cleanup(func() { SetDBusConnectionFactory(originalFactory) })
+	conn := &stackConn{states: map[string]string{}}
+	SetDBusConnectionFactory(func(ctx context.Context) (DBusConnection, error) { return conn, nil })
+	setCurrentConfigForTest(t, Config{Orchestrations: []OrchestrationConfig{playbackStack()}})
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"name":"playback","action":"reload"}`, http.StatusBadRequest},
+		{`{"name":"missing","action":"start"}`, http.StatusNotFound},
+		{`{"name":"playback","action":"start"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		HandleOrchestrate(w, httptest.NewRequest(http.MethodPost, "/api/units/orchestrate", strings.NewReader(tt.body)))
+		if w.Code != tt.code {
+			t.Fatalf("%s: status = %d, want %d: %s", tt.body, w.Code, tt.code, w.Body.String())
+		}
+	}
+
+	orchestrationLock.Lock()
+	w := httptest.NewRecorder()
+	HandleOrchestrate(w, httptest.NewRequest(http.MethodPost, "/api/units/orchestrate", strings.NewReader(`{"name":"playback","action":"stop"}`)))
+	orchestrationLock.Unlock()
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while another orchestration runs, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	HandleOrchestrations(w, httptest.NewRequest(http.MethodGet, "/api/units/orchestrations", nil))
+	var resp struct {
+		Data []OrchestrationConfig `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || len(resp.Data) != 1 {
+		t.Fatalf("unexpected orchestrations %+v, %v", resp.Data, err)
+	}
+}
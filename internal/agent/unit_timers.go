@@ -0,0 +1,150 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// clockMonotonic is CLOCK_MONOTONIC of clock_gettime(2), the clock of
+// systemd's monotonic timer properties.
+const clockMonotonic = 1
+
+// TimerInfo reports whether a systemd timer will elapse again. A masked or
+// stopped timer has no next elapse, which is how the core spots devices
+// that no longer upload on schedule.
+type TimerInfo struct {
+	Unit          string      `json:"unit"`
+	Active        interface{} `json:"active,omitempty"`
+	UnitFileState interface{} `json:"unitFileState,omitempty"`
+	Scheduled     bool        `json:"scheduled"`
+	NextElapse    *time.Time  `json:"nextElapse,omitempty"`
+	LastTrigger   *time.Time  `json:"lastTrigger,omitempty"`
+}
+
+// monotonicNow returns CLOCK_MONOTONIC. Tests may override it.
+var monotonicNow = func() time.Duration {
+	var ts syscall.Timespec
+	if _, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clockMonotonic, uintptr(unsafe.Pointer(&ts)), 0); errno != 0 {
+		return 0
+	}
+	return time.Duration(ts.Nano())
+}
+
+// unitPropertyUSec reads a microsecond property. D-Bus returns uint64; the
+// helper passes it as a decimal string.
+func unitPropertyUSec(value any) uint64 {
+	switch value := value.(type) {
+	case uint64:
+		return value
+	case string:
+		usec, _ := strconv.ParseUint(value, 10, 64)
+		return usec
+	}
+	return 0
+}
+
+// usecTime converts a realtime microsecond property; zero and the
+// "infinity" value of systemd mean unset.
+func usecTime(usec uint64) *time.Time {
+	if usec == 0 || usec == ^uint64(0) {
+		return nil
+	}
+	t := time.UnixMicro(int64(usec)).UTC()
+	return &t
+}
+
+// timerInfo builds the TimerInfo of unit from its unit and Timer
+// properties. A timer scheduled on the monotonic clock (OnBootSec,
+// OnUnitActiveSec) elapses at the earlier of both clocks.
+func timerInfo(unit string, props, timerProps map[string]any, now time.Time) TimerInfo {
+	info := TimerInfo{
+		Unit:          unit,
+		Active:        props["ActiveState"],
+		UnitFileState: props["UnitFileState"],
+		NextElapse:    usecTime(unitPropertyUSec(timerProps["NextElapseUSecRealtime"])),
+		LastTrigger:   usecTime(unitPropertyUSec(timerProps["LastTriggerUSec"])),
+	}
+	if monotonic := unitPropertyUSec(timerProps["NextElapseUSecMonotonic"]); monotonic != 0 && monotonic != ^uint64(0) {
+		next := now.Add(time.Duration(monotonic)*time.Microsecond - monotonicNow()).UTC()
+		if info.NextElapse == nil || next.Before(*info.NextElapse) {
+			info.NextElapse = &next
+		}
+	}
+	info.Scheduled = info.NextElapse != nil
+	return info
+}
+
+// HandleTimerStatus reports the next elapse of an allowed timer. It
+// requires a GET request and the "unit" query parameter naming a .timer.
+func HandleTimerStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	unit := r.URL.Query().Get("unit")
+	if unit == "" {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{
+			OK:     false,
+			ErrMsg: "Требуется параметр unit",
+		})
+		return
+	}
+	if !strings.HasSuffix(unit, ".timer") {
+		JSONResponse(w, http.StatusBadRequest, APIResponse{
+			OK:     false,
+			ErrMsg: fmt.Sprintf("Юнит %s не является таймером", unit),
+		})
+		return
+	}
+	if err := IsAllowed(unit); err != nil {
+		JSONResponse(w, http.StatusForbidden, APIResponse{
+			OK:     false,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+
+	conn, err := getDBusConnection(r.Context())
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{
+			OK:     false,
+			ErrMsg: fmt.Sprintf("Не удалось подключиться к D-Bus: %v", err),
+		})
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), dbusTimeout())
+	defer cancel()
+
+	props, err := conn.GetUnitPropertiesContext(ctx, unit)
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{
+			OK:     false,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	timerProps, err := conn.GetUnitTypePropertiesContext(ctx, unit, "Timer")
+	if err != nil {
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{
+			OK:     false,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK:   true,
+		Data: timerInfo(unit, props, timerProps, time.Now()),
+	})
+}
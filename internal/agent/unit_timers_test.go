@@ -0,0 +1,105 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type timerPropsConn struct {
+	noopDBusConnection
+	props      map[string]any
+	timerProps map[string]any
+}
+
+func (c *timerPropsConn) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]any, error) {
+	return c.props, nil
+}
+
+func (c *timerPropsConn) GetUnitTypePropertiesContext(ctx context.Context, unit, unitType string) (map[string]any, error) {
+	if unitType != "Timer" {
+		return map[string]any{}, nil
+	}
+	return c.timerProps, nil
+}
+
+func TestTimerInfo(t *testing.T) {
+	original := monotonicNow
+	t.Cleanup(func() { monotonicNow = original })
+	monotonicNow = func() time.Duration { return time.Hour }
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	realtime := uint64(now.Add(2 * time.Hour).UnixMicro())
+
+	info := timerInfo("upload.timer", map[string]any{"ActiveState": "active", "UnitFileState": "enabled"},
+		map[string]any{"NextElapseUSecRealtime": realtime, "NextElapseUSecMonotonic": uint64(0)}, now)
+	if !info.Scheduled || !info.NextElapse.Equal(now.Add(2*time.Hour)) || info.LastTrigger != nil {
+		t.Fatalf("realtime timer: %+v", info)
+	}
+
+	// The helper passes values as strings; the monotonic elapse is earlier.
+	monotonic := uint64((time.Hour + 30*time.Minute) / time.Microsecond)
+	info = timerInfo("upload.timer", map[string]any{}, map[string]any{
+		"NextElapseUSecRealtime":  "18446744073709551615",
+		"NextElapseUSecMonotonic": strconv.FormatUint(monotonic, 10),
+	}, now)
+	if !info.Scheduled || !info.NextElapse.Equal(now.Add(30*time.Minute)) {
+		t.Fatalf("monotonic timer: %+v", info)
+	}
+
+	info = timerInfo("upload.timer", map[string]any{"ActiveState": "inactive", "UnitFileState": "masked"}, map[string]any{}, now)
+	if info.Scheduled || info.NextElapse != nil || info.UnitFileState != "masked" {
+		t.Fatalf("masked timer: %+v", info)
+	}
+}
+
+func TestHandleTimerStatus(t *testing.T) {
+	originalFactory := dbusFactory
+	originalUnits := AllowedUnits
+	t.Cleanup(func() {
+		SetDBusConnectionFactory(originalFactory)
+		AllowedUnits = originalUnits
+	})
+	AllowedUnits = map[string]struct{}{"upload.timer": {}, "upload.service": {}}
+	SetDBusConnectionFactory(func(ctx context.Context) (DBusConnection, error) {
+		return &timerPropsConn{
+			props:      map[string]any{"ActiveState": "inactive", "UnitFileState": "masked", "UnitFilePreset": "enabled"},
+			timerProps: map[string]any{"NextElapseUSecRealtime": uint64(0), "LastTriggerUSec": uint64(1772445600000000)},
+		}, nil
+	})
+
+	w := httptest.NewRecorder()
+	HandleTimerStatus(w, httptest.NewRequest(http.MethodGet, "/api/units/timer?unit=upload.timer", nil))
+	var resp struct {
+		Data TimerInfo `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d, body %s, err %v", w.Code, w.Body.String(), err)
+	}
+	if resp.Data.Scheduled || resp.Data.UnitFileState != "masked" || resp.Data.LastTrigger == nil {
+		t.Fatalf("data = %+v", resp.Data)
+	}
+
+	for target, status := range map[string]int{"upload.service": http.StatusBadRequest, "other.timer": http.StatusForbidden, "": http.StatusBadRequest} {
+		w = httptest.NewRecorder()
+		HandleTimerStatus(w, httptest.NewRequest(http.MethodGet, "/api/units/timer?unit="+target, nil))
+		if w.Code != status {
+			t.Errorf("%q: status %d, want %d", target, w.Code, status)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	HandleUnitStatus(w, httptest.NewRequest(http.MethodGet, "/api/units/status?unit=upload.timer", nil))
+	var unit struct {
+		Data UnitInfo `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &unit); err != nil || unit.Data.UnitFileState != "masked" || unit.Data.Preset != "enabled" {
+		t.Fatalf("unit status: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// USBImportConfig describes offline media import from removable storage.
+// A bundle is a "media-pi-bundle" directory holding manifest.json (the same
+// JSON as /api/devicesync), manifest.json.sig (base64 Ed25519 signature of
+// manifest.json) and the media files under files/.
+type USBImportConfig struct {
+	Enabled      bool          `yaml:"enabled,omitempty"`
+	PublicKey    string        `yaml:"public_key,omitempty"`
+	MountRoots   []string      `yaml:"mount_roots,omitempty"`
+	ScanInterval time.Duration `yaml:"scan_interval,omitempty"`
+}
+
+// Media bundle layout.
+const (
+	mediaBundleDirName      = "media-pi-bundle"
+	mediaBundleManifestName = "manifest.json"
+	mediaBundleSignatureExt = ".sig"
+	mediaBundleFilesDirName = "files"
+)
+
+// DefaultUSBImportScanInterval is how often mount roots are checked for
+// newly inserted bundles.
+const DefaultUSBImportScanInterval = 10 * time.Second
+
+// DefaultUSBImportMountRoots lists where removable media is usually mounted.
+var DefaultUSBImportMountRoots = []string{"/media", "/run/media", "/mnt"}
+
+// maxMediaBundleManifestSize bounds how much of manifest.json is read.
+const maxMediaBundleManifestSize = 16 << 20
+
+var (
+	usbImportWatcherLock   sync.Mutex
+	usbImportWatcherCancel context.CancelFunc
+)
+
+// MediaImportRequest is the optional body of POST /api/media/import.
+type MediaImportRequest struct {
+	Path string `json:"path,omitempty"`
+}
+
+// MediaImportResponse reports the bundle picked for import.
+type MediaImportResponse struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func usbImportMountRoots(config Config) []string {
+	if len(config.USBImport.MountRoots) > 0 {
+		return config.USBImport.MountRoots
+	}
+	return DefaultUSBImportMountRoots
+}
+
+// findMediaBundles returns bundle directories found at mount roots, one or
+// two levels deep (e.g. /media/usb0 and /media/pi/STICK).
+func findMediaBundles(roots []string) []string {
+	var bundles []string
+	seen := make(map[string]struct{})
+	for _, root := range roots {
+		for _, pattern := range []string{
+			filepath.Join(root, "*", mediaBundleDirName),
+			filepath.Join(root, "*", "*", mediaBundleDirName),
+		} {
+			matches, _ := filepath.Glob(pattern)
+			for _, dir := range matches {
+				if _, ok := seen[dir]; ok {
+					continue
+				}
+				if info, err := os.Stat(filepath.Join(dir, mediaBundleManifestName)); err != nil || info.IsDir() {
+					continue
+				}
+				seen[dir] = struct{}{}
+				bundles = append(bundles, dir)
+			}
+		}
+	}
+	return bundles
+}
+
+func parseBundlePublicKey(value string) (ed25519.PublicKey, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("usb_import.public_key not configured")
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid usb_import.public_key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid usb_import.public_key: expected %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// loadMediaBundle reads and authenticates the bundle manifest. It returns
+// the manifest and a digest of its bytes identifying this bundle version.
+func loadMediaBundle(bundleDir string, publicKey ed25519.PublicKey) (*Manifest, string, error) {
+	manifestPath := filepath.Join(bundleDir, mediaBundleManifestName)
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open bundle manifest: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxMediaBundleManifestSize+1))
+	_ = file.Close()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read bundle manifest: %w", err)
+	}
+	if len(data) > maxMediaBundleManifestSize {
+		return nil, "", fmt.Errorf("bundle manifest exceeds %d bytes", maxMediaBundleManifestSize)
+	}
+
+	sigData, err := os.ReadFile(manifestPath + mediaBundleSignatureExt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read bundle signature: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigData)))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid bundle signature encoding: %w", err)
+	}
+	if !ed25519.Verify(publicKey, data, signature) {
+		return nil, "", fmt.Errorf("bundle signature verification failed")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, "", fmt.Errorf("failed to decode bundle manifest: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return &manifest, hex.EncodeToString(sum[:]), nil
+}
+
+// bundleFetcher copies manifest items from a bundle's files directory. The
+// filename has already been validated by syncFilesFrom.
+func bundleFetcher(bundleDir string) fetchItemFunc {
+	return func(ctx context.Context, config Config, item ManifestItem, destPath string) error {
+		src, err := os.Open(filepath.Join(bundleDir, mediaBundleFilesDirName, filepath.FromSlash(item.Filename)))
+		if err != nil {
+			return fmt.Errorf("failed to open bundle file: %w", err)
+		}
+		defer func() { _ = src.Close() }()
+		log.Printf("Importing %s (ID: %d, size: %d bytes) from %s", item.Filename, item.ID, item.FileSizeBytes, bundleDir)
+		return writeVerifiedContent(src, item, destPath)
+	}
+}
+
+// ImportMediaBundle verifies the bundle at bundleDir and applies it to the
+// media directory exactly like a core sync, including garbage collection.
+func ImportMediaBundle(ctx context.Context, bundleDir string) (err error) {
+	config := GetCurrentConfig()
+
+	log.Printf("Starting media import from %s", bundleDir)
+	startTime := time.Now()
+	defer func() {
+		if err != nil {
+			log.Printf("Media import failed: %v", err)
+			setSyncStatus(SyncStatus{
+				LastSyncTime: startTime,
+				OK:           false,
+				Error:        err.Error(),
+			})
+			return
+		}
+		log.Println("Media import completed successfully")
+		setSyncStatus(SyncStatus{
+			LastSyncTime: startTime,
+			OK:           true,
+		})
+	}()
+
+	publicKey, err := parseBundlePublicKey(config.USBImport.PublicKey)
+	if err != nil {
+		return err
+	}
+	manifest, _, err := loadMediaBundle(bundleDir, publicKey)
+	if err != nil {
+		return err
+	}
+	log.Printf("Bundle manifest verified: %d items", len(*manifest))
+
+	// The media directory no longer matches the core manifest, so the next
+	// core sync must not be short-circuited by a 304.
+	setAppliedManifestValidators(config, manifestValidators{})
+
+	if err := syncFilesFrom(ctx, config, manifest, bundleFetcher(bundleDir)); err != nil {
+		return fmt.Errorf("failed to import files: %w", err)
+	}
+	return nil
+}
+
+// TriggerMediaImport starts importing the bundle at bundleDir in the
+// background, cancelling any ongoing sync first.
+func TriggerMediaImport(bundleDir string) error {
+	if _, err := parseBundlePublicKey(GetCurrentConfig().USBImport.PublicKey); err != nil {
+		return err
+	}
+	if info, err := os.Stat(filepath.Join(bundleDir, mediaBundleManifestName)); err != nil || info.IsDir() {
+		return fmt.Errorf("no media bundle at %s", bundleDir)
+	}
+
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	if syncCancel != nil {
+		syncCancel()
+	}
+	syncContext, syncCancel = context.WithCancel(context.Background())
+	ctx := syncContext
+
+	go func() {
+		setVideoSyncRunning(true)
+		defer setVideoSyncRunning(false)
+		_ = ImportMediaBundle(ctx, bundleDir)
+	}()
+
+	return nil
+}
+
+// StartUSBImportWatcher polls the configured mount roots and imports each
+// newly inserted bundle once. Calling it again restarts the watcher.
+func StartUSBImportWatcher() {
+	ctx, cancel := context.WithCancel(context.Background())
+	usbImportWatcherLock.Lock()
+	if usbImportWatcherCancel != nil {
+		usbImportWatcherCancel()
+	}
+	usbImportWatcherCancel = cancel
+	usbImportWatcherLock.Unlock()
+
+	go usbImportWatchLoop(ctx)
+}
+
+// StopUSBImportWatcher stops a running watcher.
+func StopUSBImportWatcher() {
+	usbImportWatcherLock.Lock()
+	defer usbImportWatcherLock.Unlock()
+	if usbImportWatcherCancel != nil {
+		usbImportWatcherCancel()
+		usbImportWatcherCancel = nil
+	}
+}
+
+func usbImportWatchLoop(ctx context.Context) {
+	// imported maps bundle directories to the manifest digest last imported,
+	// so a stick stays imported while inserted and is picked up again after
+	// it is removed and reinserted or its content changes.
+	imported := make(map[string]string)
+	for {
+		config := GetCurrentConfig()
+		interval := config.USBImport.ScanInterval
+		if interval <= 0 {
+			interval = DefaultUSBImportScanInterval
+		}
+		if config.USBImport.Enabled {
+			scanUSBBundles(config, imported)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func scanUSBBundles(config Config, imported map[string]string) {
+	present := make(map[string]struct{})
+	for _, dir := range findMediaBundles(usbImportMountRoots(config)) {
+		present[dir] = struct{}{}
+		digest, err := mediaBundleDigest(dir)
+		if err != nil || imported[dir] == digest {
+			continue
+		}
+		log.Printf("Detected media bundle at %s", dir)
+		if err := TriggerMediaImport(dir); err != nil {
+			log.Printf("Warning: failed to start media import from %s: %v", dir, err)
+			continue
+		}
+		imported[dir] = digest
+	}
+	for dir := range imported {
+		if _, ok := present[dir]; !ok {
+			delete(imported, dir)
+		}
+	}
+}
+
+// mediaBundleDigest identifies a bundle version without verifying it.
+func mediaBundleDigest(bundleDir string) (string, error) {
+	file, err := os.Open(filepath.Join(bundleDir, mediaBundleManifestName))
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, io.LimitReader(file, maxMediaBundleManifestSize+1)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// HandleMediaImport starts importing a media bundle. The optional JSON body
+// {"path": "..."} selects the bundle directory; without it the first
+// bundle found under the configured mount roots is used.
+func HandleMediaImport(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req MediaImportRequest
+	if r.Body != nil {
+		if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Неверный формат запроса"})
+			return
+		}
+	}
+
+	bundleDir := strings.TrimSpace(req.Path)
+	if bundleDir == "" {
+		bundles := findMediaBundles(usbImportMountRoots(GetCurrentConfig()))
+		if len(bundles) == 0 {
+			JSONResponse(w, http.StatusNotFound, APIResponse{OK: false, ErrMsg: "Пакет медиафайлов не найден"})
+			return
+		}
+		bundleDir = bundles[0]
+	}
+
+	if err := TriggerMediaImport(bundleDir); err != nil {
+		log.Printf("Failed to trigger media import: %v", err)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{
+			OK:     false,
+			ErrMsg: fmt.Sprintf("Не удалось запустить импорт медиафайлов: %v", err),
+		})
+		return
+	}
+
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: MediaImportResponse{
+			Path:    bundleDir,
+			Message: "Импорт медиафайлов запущен",
+		},
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestBundle creates a signed bundle under root/stick and returns its
+// directory and the base64 public key that verifies it.
+func writeTestBundle(t *testing.T, root string, files map[string]string) (string, string) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundleDir := filepath.Join(root, "stick", mediaBundleDirName)
+	var manifest Manifest
+	id := int64(1)
+	for name, content := range files {
+		path := filepath.Join(bundleDir, mediaBundleFilesDirName, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		manifest = append(manifest, ManifestItem{ID: id, Filename: name, FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content)})
+		id++
+	}
+	signTestBundle(t, bundleDir, manifest, privateKey)
+	return bundleDir, base64.StdEncoding.EncodeToString(publicKey)
+}
+
+func signTestBundle(t *testing.T, bundleDir string, manifest Manifest, privateKey ed25519.PrivateKey) {
+	t.Helper()
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := filepath.Join(bundleDir, mediaBundleManifestName)
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, data))
+	if err := os.WriteFile(manifestPath+mediaBundleSignatureExt, []byte(sig+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportMediaBundleCopiesVerifiedFiles(t *testing.T) {
+	root := t.TempDir()
+	bundleDir, publicKey := writeTestBundle(t, root, map[string]string{"a.mp4": "first", "sub/b.mp4": "second"})
+
+	mediaDir := t.TempDir()
+	stale := filepath.Join(mediaDir, "stale.mp4")
+	if err := os.WriteFile(stale, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	setCurrentConfigForTest(t, Config{
+		Playlist:  PlaylistConfig{Destination: mediaDir},
+		USBImport: USBImportConfig{PublicKey: publicKey},
+	})
+
+	if err := ImportMediaBundle(context.Background(), bundleDir); err != nil {
+		t.Fatalf("ImportMediaBundle() error = %v", err)
+	}
+	for name, want := range map[string]string{"a.mp4": "first", "sub/b.mp4": "second"} {
+		data, err := os.ReadFile(filepath.Join(mediaDir, filepath.FromSlash(name)))
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v", name, data, err)
+		}
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected file missing from bundle to be garbage collected, stat err = %v", err)
+	}
+	if status := GetSyncStatus(); !status.OK {
+		t.Errorf("expected successful sync status, got %+v", status)
+	}
+}
+
+func TestImportMediaBundleRejectsBadSignature(t *testing.T) {
+	root := t.TempDir()
+	bundleDir, _ := writeTestBundle(t, root, map[string]string{"a.mp4": "first"})
+	otherKey, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	mediaDir := t.TempDir()
+	setCurrentConfigForTest(t, Config{
+		Playlist:  PlaylistConfig{Destination: mediaDir},
+		USBImport: USBImportConfig{PublicKey: base64.StdEncoding.EncodeToString(otherKey)},
+	})
+
+	err := ImportMediaBundle(context.Background(), bundleDir)
+	if err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "a.mp4")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be imported, stat err = %v", err)
+	}
+}
+
+func TestImportMediaBundleRejectsTamperedFile(t *testing.T) {
+	root := t.TempDir()
+	bundleDir, publicKey := writeTestBundle(t, root, map[string]string{"a.mp4": "first"})
+	if err := os.WriteFile(filepath.Join(bundleDir, mediaBundleFilesDirName, "a.mp4"), []byte("forged"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaDir := t.TempDir()
+	setCurrentConfigForTest(t, Config{
+		Playlist:  PlaylistConfig{Destination: mediaDir},
+		USBImport: USBImportConfig{PublicKey: publicKey},
+	})
+
+	if err := ImportMediaBundle(context.Background(), bundleDir); err == nil {
+		t.Fatal("expected error for tampered bundle file")
+	}
+	if _, err := os.Stat(filepath.Join(mediaDir, "a.mp4")); !os.IsNotExist(err) {
+		t.Errorf("expected tampered file not to be imported, stat err = %v", err)
+	}
+}
+
+func TestFindMediaBundles(t *testing.T) {
+	root := t.TempDir()
+	shallow, _ := writeTestBundle(t, root, map[string]string{"a.mp4": "a"})
+	deepRoot := filepath.Join(root, "user")
+	deep, _ := writeTestBundle(t, deepRoot, map[string]string{"b.mp4": "b"})
+	if err := os.MkdirAll(filepath.Join(root, "empty", mediaBundleDirName), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	bundles := findMediaBundles([]string{root})
+	if len(bundles) != 2 {
+		t.Fatalf("expected 2 bundles, got %v", bundles)
+	}
+	found := map[string]bool{}
+	for _, dir := range bundles {
+		found[dir] = true
+	}
+	if !found[shallow] || !found[deep] {
+		t.Errorf("expected %s and %s, got %v", shallow, deep, bundles)
+	}
+}
+
+func TestHandleMediaImportRequiresBundle(t *testing.T) {
+	setCurrentConfigForTest(t, Config{
+		USBImport: USBImportConfig{
+			PublicKey:  base64.StdEncoding.EncodeToString(make([]byte, ed25519.PublicKeySize)),
+			MountRoots: []string{t.TempDir()},
+		},
+	})
+
+	rr := httptest.NewRecorder()
+	HandleMediaImport(rr, httptest.NewRequest(http.MethodPost, "/api/media/import", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without bundle, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	HandleMediaImport(rr, httptest.NewRequest(http.MethodGet, "/api/media/import", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for GET, got %d", rr.Code)
+	}
+}
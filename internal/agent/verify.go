@@ -0,0 +1,147 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// hashBufferSize is the read size used when hashing media files. Large
+// reads cut the per-call overhead of io.Copy's 32 KB buffer on SD cards and
+// USB drives.
+const hashBufferSize = 1 << 20
+
+var hashBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, hashBufferSize)
+		return &buf
+	},
+}
+
+const (
+	metricSyncVerifyDuration = "media_pi_sync_verify_duration_seconds"
+	metricSyncVerifiedFiles  = "media_pi_sync_verified_files_total"
+	metricSyncVerifiedBytes  = "media_pi_sync_verified_bytes_total"
+)
+
+func init() {
+	registerGauge(metricSyncVerifyDuration, "Time the last sync spent verifying local media files, in seconds.")
+	registerCounter(metricSyncVerifiedFiles, "Local media files hashed to check them against the manifest.")
+	registerCounter(metricSyncVerifiedBytes, "Bytes of local media files hashed to check them against the manifest.")
+}
+
+// onlyReader hides io.WriterTo, so io.CopyBuffer uses the given buffer
+// instead of os.File's WriteTo, which copies 32 KB at a time.
+type onlyReader struct {
+	io.Reader
+}
+
+// copyWithHashBuffer copies src to dst through a pooled hashBufferSize
+// buffer.
+func copyWithHashBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	buf := hashBufferPool.Get().(*[]byte)
+	defer hashBufferPool.Put(buf)
+	return io.CopyBuffer(dst, onlyReader{src}, *buf)
+}
+
+// hashFile writes size bytes of file to h. With mmap the file is mapped and
+// hashed without copying it through a buffer; when mapping fails, for
+// example on a file system that does not support it, the file is read
+// normally.
+func hashFile(h io.Writer, file *os.File, size int64, mmap bool) error {
+	if mmap && size > 0 && int64(int(size)) == size {
+		data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err == nil {
+			defer func() { _ = syscall.Munmap(data) }()
+			_ = syscall.Madvise(data, syscall.MADV_SEQUENTIAL)
+			_, err = h.Write(data)
+			return err
+		}
+	}
+	_, err := copyWithHashBuffer(h, file)
+	return err
+}
+
+// verifyMmapEnabled reports sync.verify_mmap of the current configuration.
+func verifyMmapEnabled() bool {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return currentConfig != nil && currentConfig.Sync.VerifyMmap
+}
+
+// verifyWorkers returns how many files are verified in parallel:
+// sync.verify_workers capped at the number of CPUs. By default all CPUs
+// are used, unless the board limits it.
+func verifyWorkers(config SyncConfig) int {
+	cpus := runtime.NumCPU()
+	workers := config.VerifyWorkers
+	if workers <= 0 {
+		workers = currentBoard().VerifyWorkers
+	}
+	if workers <= 0 || workers > cpus {
+		return cpus
+	}
+	return workers
+}
+
+// verifyLocalFiles checks the local copies of items in parallel and
+// reports for each item whether it is already up to date. Files whose size
+// and modification time match the verification cache are not hashed. It
+// stops early when ctx is done or the thermal limit wait fails; unchecked
+// items are reported as outdated.
+func verifyLocalFiles(ctx context.Context, config SyncConfig, mediaDir string, items []ManifestItem) ([]bool, time.Duration) {
+	paths := make([]string, len(items))
+	for i, item := range items {
+		paths[i] = filepath.Join(mediaDir, item.Filename)
+	}
+	return verifyLocalPaths(ctx, config, paths, items)
+}
+
+// verifyLocalPaths is verifyLocalFiles for items stored at paths.
+func verifyLocalPaths(ctx context.Context, config SyncConfig, paths []string, items []ManifestItem) ([]bool, time.Duration) {
+	start := time.Now()
+	interval := fullVerifyInterval(config)
+	valid := make([]bool, len(items))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < verifyWorkers(config) && w < len(items); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lowerSyncPriority(config)
+			for i := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				path := paths[i]
+				if info, err := os.Stat(path); err == nil && cachedVerification(path, info, items[i], interval, start) {
+					metricAdd(metricSyncVerifyCacheHits, 1)
+					valid[i] = true
+					continue
+				}
+				if waitForThermalHeadroom(ctx, config) != nil {
+					continue
+				}
+				ok, err := verifyLocalFile(path, items[i])
+				valid[i] = err == nil && ok
+				if valid[i] && interval >= 0 {
+					recordVerification(path, items[i], time.Now())
+				}
+			}
+		}()
+	}
+	for i := range items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return valid, time.Since(start)
+}
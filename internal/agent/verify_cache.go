@@ -0,0 +1,147 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFullVerifyInterval is how long a cached verification is trusted
+// before the file is hashed again even though its size and modification
+// time did not change.
+const DefaultFullVerifyInterval = 7 * 24 * time.Hour
+
+const metricSyncVerifyCacheHits = "media_pi_sync_verify_cache_hits_total"
+
+func init() {
+	registerCounter(metricSyncVerifyCacheHits, "Local media files accepted from the verification cache without hashing.")
+}
+
+// verifyCacheFilePath persists the verification cache across restarts.
+var verifyCacheFilePath = filepath.Join(agentStateDir, "verify-cache.json")
+
+// verifyCacheEntry records that a media file had the manifest digest when
+// it had this size and modification time.
+type verifyCacheEntry struct {
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mtime"`
+	Algorithm  string    `json:"algorithm"`
+	Hash       string    `json:"hash"`
+	VerifiedAt time.Time `json:"verifiedAt"`
+}
+
+var (
+	// verifyCache maps media file paths to their last verification.
+	verifyCache     = map[string]verifyCacheEntry{}
+	verifyCacheLock sync.Mutex
+
+	verifyCachePersistLock sync.Mutex
+)
+
+// fullVerifyInterval returns sync.full_verify_interval, defaulting to
+// DefaultFullVerifyInterval. A negative value disables the cache.
+func fullVerifyInterval(config SyncConfig) time.Duration {
+	if config.FullVerifyInterval == 0 {
+		return DefaultFullVerifyInterval
+	}
+	return config.FullVerifyInterval
+}
+
+// itemDigest returns the algorithm and lowercase digest item is verified
+// with, or false when the item cannot be verified.
+func itemDigest(item ManifestItem) (string, string, bool) {
+	verifier, err := newItemVerifier(item)
+	if err != nil {
+		return "", "", false
+	}
+	return verifier.algorithm, strings.ToLower(strings.TrimSpace(verifier.expected)), true
+}
+
+// cachedVerification reports whether path was verified against item's
+// digest less than interval ago and its size and modification time are
+// unchanged since.
+func cachedVerification(path string, info os.FileInfo, item ManifestItem, interval time.Duration, now time.Time) bool {
+	if interval < 0 {
+		return false
+	}
+	algorithm, digest, ok := itemDigest(item)
+	if !ok {
+		return false
+	}
+	verifyCacheLock.Lock()
+	entry, found := verifyCache[path]
+	verifyCacheLock.Unlock()
+	return found &&
+		entry.Size == info.Size() && entry.Size == item.FileSizeBytes &&
+		entry.ModTime.Equal(info.ModTime()) &&
+		entry.Algorithm == algorithm && entry.Hash == digest &&
+		now.Sub(entry.VerifiedAt) < interval
+}
+
+// recordVerification caches that path currently holds item's content.
+func recordVerification(path string, item ManifestItem, now time.Time) {
+	algorithm, digest, ok := itemDigest(item)
+	if !ok {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	verifyCacheLock.Lock()
+	verifyCache[path] = verifyCacheEntry{
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+		Algorithm:  algorithm,
+		Hash:       digest,
+		VerifiedAt: now,
+	}
+	verifyCacheLock.Unlock()
+}
+
+// pruneVerifyCache drops the entries of paths not in keep.
+func pruneVerifyCache(keep map[string]struct{}) {
+	verifyCacheLock.Lock()
+	defer verifyCacheLock.Unlock()
+	for path := range verifyCache {
+		if _, ok := keep[path]; !ok {
+			delete(verifyCache, path)
+		}
+	}
+}
+
+func persistVerifyCache() {
+	verifyCachePersistLock.Lock()
+	defer verifyCachePersistLock.Unlock()
+	verifyCacheLock.Lock()
+	entries := make(map[string]verifyCacheEntry, len(verifyCache))
+	for path, entry := range verifyCache {
+		entries[path] = entry
+	}
+	verifyCacheLock.Unlock()
+	if err := writeStateFile(verifyCacheFilePath, entries); err != nil {
+		log.Printf("Warning: Failed to persist verification cache: %v", err)
+	}
+}
+
+func loadVerifyCache() {
+	var entries map[string]verifyCacheEntry
+	switch err := readStateFile(verifyCacheFilePath, &entries); {
+	case err == nil:
+		if entries == nil {
+			entries = map[string]verifyCacheEntry{}
+		}
+		verifyCacheLock.Lock()
+		verifyCache = entries
+		verifyCacheLock.Unlock()
+	case !errors.Is(err, os.ErrNotExist):
+		log.Printf("Warning: ignoring verification cache: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyLocalFilesUsesVerificationCache(t *testing.T) {
+	mediaDir := t.TempDir()
+	path := filepath.Join(mediaDir, "video.mp4")
+	if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	items := []ManifestItem{{Filename: "video.mp4", FileSizeBytes: 5, SHA256: sha256Hex("video")}}
+
+	pass := func(config SyncConfig) (hashed, hits float64) {
+		t.Helper()
+		files, cached := metricValue(metricSyncVerifiedFiles), metricValue(metricSyncVerifyCacheHits)
+		valid, _ := verifyLocalFiles(context.Background(), config, mediaDir, items)
+		if !valid[0] {
+			t.Fatal("expected the file to be valid")
+		}
+		return metricValue(metricSyncVerifiedFiles) - files, metricValue(metricSyncVerifyCacheHits) - cached
+	}
+
+	if hashed, hits := pass(SyncConfig{}); hashed != 1 || hits != 0 {
+		t.Fatalf("first pass: hashed %v, hits %v", hashed, hits)
+	}
+	if hashed, hits := pass(SyncConfig{}); hashed != 0 || hits != 1 {
+		t.Fatalf("unchanged file must come from the cache: hashed %v, hits %v", hashed, hits)
+	}
+
+	// A changed modification time forces hashing.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if hashed, _ := pass(SyncConfig{}); hashed != 1 {
+		t.Fatalf("expected a changed file to be hashed, hashed %v", hashed)
+	}
+
+	// Entries older than full_verify_interval are verified again.
+	verifyCacheLock.Lock()
+	entry := verifyCache[path]
+	entry.VerifiedAt = time.Now().Add(-2 * time.Hour)
+	verifyCache[path] = entry
+	verifyCacheLock.Unlock()
+	if hashed, _ := pass(SyncConfig{FullVerifyInterval: time.Hour}); hashed != 1 {
+		t.Fatalf("expected a periodic re-verify, hashed %v", hashed)
+	}
+
+	// A different manifest digest never matches the cached one.
+	if cachedVerification(path, mustStat(t, path), ManifestItem{FileSizeBytes: 5, SHA256: sha256Hex("other")}, time.Hour, time.Now()) {
+		t.Fatal("a cached entry must not match another digest")
+	}
+	// A negative interval disables the cache.
+	if hashed, hits := pass(SyncConfig{FullVerifyInterval: -1}); hashed != 1 || hits != 0 {
+		t.Fatalf("disabled cache: hashed %v, hits %v", hashed, hits)
+	}
+}
+
+func TestVerifyCachePersists(t *testing.T) {
+	original := verifyCacheFilePath
+	verifyCacheFilePath = filepath.Join(t.TempDir(), "verify-cache.json")
+	t.Cleanup(func() { verifyCacheFilePath = original })
+
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	item := ManifestItem{Filename: "video.mp4", FileSizeBytes: 5, SHA256: sha256Hex("video")}
+	recordVerification(path, item, time.Now())
+	pruneVerifyCache(map[string]struct{}{path: {}})
+	persistVerifyCache()
+
+	verifyCacheLock.Lock()
+	verifyCache = map[string]verifyCacheEntry{}
+	verifyCacheLock.Unlock()
+	loadVerifyCache()
+	if !cachedVerification(path, mustStat(t, path), item, time.Hour, time.Now()) {
+		t.Fatal("expected the verification to survive a restart")
+	}
+
+	pruneVerifyCache(map[string]struct{}{})
+	if cachedVerification(path, mustStat(t, path), item, time.Hour, time.Now()) {
+		t.Fatal("expected pruned entries to be dropped")
+	}
+}
+
+func mustStat(t *testing.T, path string) os.FileInfo {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
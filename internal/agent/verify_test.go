@@ -0,0 +1,90 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestHashFileWithAndWithoutMmap(t *testing.T) {
+	content := strings.Repeat("media-pi ", hashBufferSize/4)
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, mmap := range []bool{false, true} {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := sha256.New()
+		err = hashFile(h, file, int64(len(content)), mmap)
+		_ = file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != sha256Hex(content) {
+			t.Fatalf("hashFile(mmap=%v) = %s, want %s", mmap, got, sha256Hex(content))
+		}
+	}
+}
+
+func TestVerifyLocalFilesInParallel(t *testing.T) {
+	setCurrentConfigForTest(t, Config{ServerKey: "key", Sync: SyncConfig{VerifyMmap: true}})
+	mediaDir := t.TempDir()
+	var items []ManifestItem
+	for i, name := range []string{"a.mp4", "b.mp4", "c.mp4", "d.mp4"} {
+		content := strings.Repeat(name, i+1)
+		if err := os.WriteFile(filepath.Join(mediaDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		item := ManifestItem{Filename: name, FileSizeBytes: int64(len(content)), SHA256: sha256Hex(content)}
+		if name == "c.mp4" {
+			item.SHA256 = sha256Hex("changed")
+		}
+		items = append(items, item)
+	}
+	items = append(items, ManifestItem{Filename: "missing.mp4", FileSizeBytes: 1, SHA256: sha256Hex("x")})
+
+	files := metricValue(metricSyncVerifiedFiles)
+	valid, elapsed := verifyLocalFiles(context.Background(), SyncConfig{VerifyWorkers: 2}, mediaDir, items)
+	want := []bool{true, true, false, true, false}
+	for i := range want {
+		if valid[i] != want[i] {
+			t.Fatalf("verifyLocalFiles = %v, want %v", valid, want)
+		}
+	}
+	if elapsed <= 0 {
+		t.Fatalf("expected a verification duration, got %v", elapsed)
+	}
+	// The missing file is not hashed.
+	if got := metricValue(metricSyncVerifiedFiles) - files; got != 4 {
+		t.Fatalf("expected 4 hashed files, got %v", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	valid, _ = verifyLocalFiles(ctx, SyncConfig{}, mediaDir, items)
+	for i, ok := range valid {
+		if ok {
+			t.Fatalf("item %d verified after cancellation", i)
+		}
+	}
+}
+
+func TestVerifyWorkers(t *testing.T) {
+	cpus := runtime.NumCPU()
+	for workers, want := range map[int]int{0: cpus, -1: cpus, 1: 1, cpus + 8: cpus} {
+		if got := verifyWorkers(SyncConfig{VerifyWorkers: workers}); got != want {
+			t.Errorf("verifyWorkers(%d) = %d, want %d", workers, got, want)
+		}
+	}
+}
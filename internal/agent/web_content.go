@@ -0,0 +1,607 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webDropInName replaces ExecStart of play.video.service with the kiosk
+// browser while web content is on screen. It sorts before
+// takeoverDropInName, so an emergency takeover still wins.
+const webDropInName = "media-pi-content-web.conf"
+
+const (
+	// DefaultWebBrowserCommand runs Chromium in the cage Wayland kiosk
+	// compositor; {cache_dir} is replaced with web.cache_dir.
+	DefaultWebBrowserCommand = "/usr/bin/cage -s -- /usr/bin/chromium --kiosk --noerrdialogs --disable-infobars --no-first-run --user-data-dir={cache_dir}"
+	// DefaultWebCacheDir is created by systemd for the playback user.
+	DefaultWebCacheDir = "/var/cache/media-pi-web"
+	// DefaultWebCheckInterval is how often a shown URL is probed.
+	DefaultWebCheckInterval = 30 * time.Second
+
+	webProbeTimeout = 10 * time.Second
+)
+
+const (
+	metricWebContentActive  = "media_pi_web_content_active"
+	metricWebContentOffline = "media_pi_web_content_offline"
+)
+
+func init() {
+	registerGauge(metricWebContentActive, "1 while the kiosk browser shows web content instead of the playlist.")
+	registerGauge(metricWebContentOffline, "1 while the web content URL is unreachable and the fallback is shown.")
+}
+
+// WebContentConfig configures the web content channel, which shows a URL
+// or a local HTML bundle in a kiosk browser instead of the video playlist.
+type WebContentConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// BrowserCommand starts the kiosk browser; the page URL is appended.
+	BrowserCommand string `yaml:"browser_command,omitempty"`
+	// CacheDir holds the browser profile and cache.
+	CacheDir string `yaml:"cache_dir,omitempty"`
+	// Fallback is shown while a URL is unreachable: an HTML file or bundle
+	// directory opens in the browser, any other media file is played by the
+	// player. It is relative to the media directory.
+	Fallback      string        `yaml:"fallback,omitempty"`
+	CheckInterval time.Duration `yaml:"check_interval,omitempty"`
+}
+
+// WebContentRequest is the body of POST /api/playback/web. Exactly one of
+// the fields is set.
+type WebContentRequest struct {
+	URL string `json:"url,omitempty"`
+	// Bundle is an HTML file or a directory with index.html relative to
+	// the media directory.
+	Bundle string `json:"bundle,omitempty"`
+}
+
+// WebContentState describes the web content channel.
+type WebContentState struct {
+	Active bool   `json:"active"`
+	URL    string `json:"url,omitempty"`
+	Bundle string `json:"bundle,omitempty"`
+	// FromPlaylist marks content started by a playlist entry; a playlist
+	// without web entries ends it.
+	FromPlaylist bool `json:"fromPlaylist,omitempty"`
+	// Offline reports that the URL is unreachable and web.fallback is shown.
+	Offline   bool   `json:"offline,omitempty"`
+	StartedAt string `json:"startedAt,omitempty"`
+	// PlaybackWasActive is restored when the web content is stopped.
+	PlaybackWasActive bool `json:"playbackWasActive,omitempty"`
+}
+
+// WebContentStatus is returned by GET /api/playback/web.
+type WebContentStatus struct {
+	WebContentState
+	CacheBytes int64 `json:"cacheBytes"`
+}
+
+var (
+	// webStateFilePath persists the web content channel across restarts.
+	webStateFilePath = filepath.Join(agentStateDir, "web-content.json")
+
+	// webProbe checks that a URL is reachable. Tests may override it.
+	webProbe = probeWebURL
+
+	webLock        sync.Mutex
+	webState       WebContentState
+	webWatchCancel context.CancelFunc
+)
+
+func webCacheDir(config Config) string {
+	if dir := strings.TrimSpace(config.Web.CacheDir); dir != "" {
+		return filepath.Clean(dir)
+	}
+	return DefaultWebCacheDir
+}
+
+func webCheckInterval(config Config) time.Duration {
+	if config.Web.CheckInterval > 0 {
+		return config.Web.CheckInterval
+	}
+	return DefaultWebCheckInterval
+}
+
+func webBrowserCommand(config Config) string {
+	command := strings.TrimSpace(config.Web.BrowserCommand)
+	if command == "" {
+		command = DefaultWebBrowserCommand
+	}
+	return SanitizeSystemdValue(strings.ReplaceAll(command, "{cache_dir}", webCacheDir(config)))
+}
+
+// webBundlePath validates a bundle relative to the media directory and
+// returns the HTML file to open.
+func webBundlePath(config Config, bundle string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(strings.TrimSpace(bundle)))
+	if rel == "." || filepath.IsAbs(rel) || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid bundle %q", bundle)
+	}
+	path, ok := resolveMediaKindPath(config, mediaKindWeb, rel)
+	if !ok {
+		return "", fmt.Errorf("invalid bundle %q", bundle)
+	}
+	info, err := os.Stat(path)
+	if err == nil && info.IsDir() {
+		path = filepath.Join(path, "index.html")
+		info, err = os.Stat(path)
+	}
+	if err != nil || !info.Mode().IsRegular() {
+		return "", fmt.Errorf("bundle %s is not synced to this device", filepath.ToSlash(rel))
+	}
+	if !isHTMLFile(path) {
+		return "", fmt.Errorf("bundle %s is not an HTML file", filepath.ToSlash(rel))
+	}
+	return path, nil
+}
+
+func isHTMLFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".html" || ext == ".htm"
+}
+
+func fileURL(path string) string {
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// validateWebURL accepts absolute http and https URLs.
+func validateWebURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid URL %q, expected http or https", raw)
+	}
+	return u.String(), nil
+}
+
+// webContentCommand returns the ExecStart for state: the browser with the
+// URL or bundle, or the fallback while the URL is offline.
+func webContentCommand(config Config, state WebContentState) (string, error) {
+	if state.Offline {
+		if fallback := strings.TrimSpace(config.Web.Fallback); fallback != "" {
+			if path, err := webBundlePath(config, fallback); err == nil {
+				return webBrowserCommand(config) + " " + SanitizeSystemdValue(fileURL(path)), nil
+			}
+			path, err := takeoverAssetPath(config, fallback)
+			if err != nil {
+				return "", fmt.Errorf("web fallback: %w", err)
+			}
+			return playerCommand(config) + " " + SanitizeSystemdValue(path), nil
+		}
+	}
+	if state.Bundle != "" {
+		path, err := webBundlePath(config, state.Bundle)
+		if err != nil {
+			return "", err
+		}
+		return webBrowserCommand(config) + " " + SanitizeSystemdValue(fileURL(path)), nil
+	}
+	return webBrowserCommand(config) + " " + SanitizeSystemdValue(state.URL), nil
+}
+
+// webDropIn renders the play.video.service drop-in for command. A cache
+// directory under /var/cache is created by systemd for the playback user.
+func webDropIn(config Config, command string) string {
+	content := fmt.Sprintf("[Service]\nExecStart=\nExecStart=%s\n", command)
+	if rel, ok := strings.CutPrefix(webCacheDir(config), "/var/cache/"); ok && rel != "" {
+		content += "CacheDirectory=" + SanitizeSystemdValue(rel) + "\n"
+	}
+	return content
+}
+
+func writeWebDropIn(config Config, state WebContentState) error {
+	command, err := webContentCommand(config, state)
+	if err != nil {
+		return err
+	}
+	return writePlaybackDropIn(playbackServiceUnit, webDropInName, webDropIn(config, command))
+}
+
+// probeWebURL reports an error when rawURL cannot be fetched or the server
+// fails.
+func probeWebURL(ctx context.Context, rawURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, webProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webURLOffline probes the URL of state; bundles are always available.
+func webURLOffline(ctx context.Context, state WebContentState) bool {
+	if state.URL == "" {
+		return false
+	}
+	if err := webProbe(ctx, state.URL); err != nil {
+		log.Printf("Web content %s is unreachable: %v", state.URL, err)
+		return true
+	}
+	return false
+}
+
+func setWebStateLocked(state WebContentState) {
+	webState = state
+	active, offline := 0.0, 0.0
+	if state.Active {
+		active = 1
+	}
+	if state.Offline {
+		offline = 1
+	}
+	metricSet(metricWebContentActive, active)
+	metricSet(metricWebContentOffline, offline)
+	if err := writeStateFile(webStateFilePath, state); err != nil {
+		log.Printf("Warning: failed to persist web content state: %v", err)
+	}
+}
+
+// StartWebContent shows req in the kiosk browser instead of the playlist
+// until StopWebContent.
+func StartWebContent(ctx context.Context, config Config, req WebContentRequest, fromPlaylist bool) (WebContentState, error) {
+	if !config.Web.Enabled {
+		return WebContentState{}, errors.New("web content is disabled, set web.enabled")
+	}
+	if len(config.Displays) > 0 {
+		return WebContentState{}, errors.New("web content supports a single display only")
+	}
+	state := WebContentState{Active: true, FromPlaylist: fromPlaylist, StartedAt: time.Now().UTC().Format(time.RFC3339)}
+	switch {
+	case req.URL != "" && req.Bundle != "":
+		return WebContentState{}, errors.New("set either url or bundle")
+	case req.URL != "":
+		u, err := validateWebURL(req.URL)
+		if err != nil {
+			return WebContentState{}, err
+		}
+		state.URL = u
+	case req.Bundle != "":
+		if _, err := webBundlePath(config, req.Bundle); err != nil {
+			return WebContentState{}, err
+		}
+		state.Bundle = filepath.ToSlash(filepath.Clean(filepath.FromSlash(strings.TrimSpace(req.Bundle))))
+	default:
+		return WebContentState{}, errors.New("url or bundle is required")
+	}
+	state.Offline = webURLOffline(ctx, state)
+
+	webLock.Lock()
+	defer webLock.Unlock()
+	state.PlaybackWasActive = webState.PlaybackWasActive
+	if !webState.Active {
+		if status, err := getServiceStatus(ctx); err == nil {
+			state.PlaybackWasActive = status.PlaybackServiceStatus
+		}
+	}
+
+	if err := writeWebDropIn(config, state); err != nil {
+		return WebContentState{}, fmt.Errorf("write web content drop-in: %w", err)
+	}
+	if err := reloadAndRunPlayback(ctx, dbusUnitOperationRestart); err != nil {
+		_ = removePlaybackDropIns(webDropInName)
+		return WebContentState{}, err
+	}
+	setWebStateLocked(state)
+	startWebWatchLocked(config)
+	log.Printf("Web content started: %s%s", state.URL, state.Bundle)
+	return state, nil
+}
+
+// StopWebContent returns to the playlist and restores playback as it was
+// before the web content started.
+func StopWebContent(ctx context.Context) (WebContentState, error) {
+	webLock.Lock()
+	defer webLock.Unlock()
+
+	previous := webState
+	if !previous.Active {
+		return previous, nil
+	}
+	stopWebWatchLocked()
+	if err := removePlaybackDropIns(webDropInName); err != nil {
+		return previous, fmt.Errorf("remove web content drop-in: %w", err)
+	}
+	operation := dbusUnitOperationStop
+	if previous.PlaybackWasActive {
+		operation = dbusUnitOperationRestart
+	}
+	err := reloadAndRunPlayback(ctx, operation)
+	setWebStateLocked(WebContentState{})
+	if err != nil {
+		return previous, err
+	}
+	log.Printf("Web content %s%s stopped", previous.URL, previous.Bundle)
+	return previous, nil
+}
+
+func getWebState() WebContentState {
+	webLock.Lock()
+	defer webLock.Unlock()
+	return webState
+}
+
+// checkWebContent switches between the URL and the fallback when the
+// reachability of the URL changed.
+func checkWebContent(ctx context.Context, config Config) {
+	webLock.Lock()
+	state := webState
+	webLock.Unlock()
+	if !state.Active || state.URL == "" || strings.TrimSpace(config.Web.Fallback) == "" {
+		return
+	}
+	offline := webURLOffline(ctx, state)
+	if offline == state.Offline || ctx.Err() != nil {
+		return
+	}
+
+	webLock.Lock()
+	defer webLock.Unlock()
+	if webState.URL != state.URL {
+		return
+	}
+	state = webState
+	state.Offline = offline
+	if err := writeWebDropIn(config, state); err != nil {
+		log.Printf("Warning: failed to switch web content: %v", err)
+		return
+	}
+	operation := dbusUnitOperationRestart
+	if status, err := getServiceStatus(ctx); err != nil || !status.PlaybackServiceStatus {
+		// Apply on the next start, e.g. after a rest period.
+		operation = ""
+	}
+	if operation != "" {
+		if err := reloadAndRunPlayback(ctx, operation); err != nil {
+			log.Printf("Warning: failed to switch web content: %v", err)
+			return
+		}
+	}
+	setWebStateLocked(state)
+	if offline {
+		log.Printf("Web content %s is offline, showing %s", state.URL, config.Web.Fallback)
+	} else {
+		log.Printf("Web content %s is back online", state.URL)
+	}
+}
+
+// startWebWatchLocked probes the URL while web content is active. Callers
+// hold webLock.
+func startWebWatchLocked(config Config) {
+	if webWatchCancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	webWatchCancel = cancel
+	interval := webCheckInterval(config)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			checkWebContent(ctx, GetCurrentConfig())
+		}
+	}()
+}
+
+func stopWebWatchLocked() {
+	if webWatchCancel != nil {
+		webWatchCancel()
+		webWatchCancel = nil
+	}
+}
+
+// ResumeWebContent restores web content persisted by a previous run. Its
+// drop-in survives restarts, so only the state and the watch are restored.
+func ResumeWebContent() {
+	var state WebContentState
+	if err := readStateFile(webStateFilePath, &state); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: ignoring web content state: %v", err)
+		}
+		return
+	}
+	if !state.Active {
+		return
+	}
+	webLock.Lock()
+	defer webLock.Unlock()
+	webState = state
+	metricSet(metricWebContentActive, 1)
+	startWebWatchLocked(GetCurrentConfig())
+	log.Printf("Resumed web content %s%s", state.URL, state.Bundle)
+}
+
+// playlistWebEntry reports the web entry a playlist starts with: an http
+// or https URL, or an HTML file or bundle directory in the media
+// directory. Such a playlist is shown in the kiosk browser.
+func playlistWebEntry(config Config) (WebContentRequest, bool) {
+	file, err := os.Open(displayPlaylistPath(config, DisplayOutputConfig{}))
+	if err != nil {
+		return WebContentRequest{}, false
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if strings.HasPrefix(entry, "http://") || strings.HasPrefix(entry, "https://") {
+			return WebContentRequest{URL: entry}, true
+		}
+		mediaDir := mediaDirFor(config)
+		if filepath.IsAbs(entry) {
+			rel, err := filepath.Rel(mediaDir, entry)
+			if err != nil {
+				return WebContentRequest{}, false
+			}
+			entry = rel
+		}
+		if isHTMLFile(entry) {
+			return WebContentRequest{Bundle: filepath.ToSlash(entry)}, true
+		}
+		if info, err := os.Stat(filepath.Join(mediaDir, entry)); err == nil && info.IsDir() {
+			return WebContentRequest{Bundle: filepath.ToSlash(entry)}, true
+		}
+		return WebContentRequest{}, false
+	}
+	return WebContentRequest{}, false
+}
+
+// applyPlaylistWebContent starts web content for a playlist that begins
+// with a web entry and ends playlist web content when the new playlist has
+// none. Content started through the API is left alone.
+func applyPlaylistWebContent(ctx context.Context, config Config) error {
+	if !config.Web.Enabled {
+		return nil
+	}
+	state := getWebState()
+	entry, ok := playlistWebEntry(config)
+	switch {
+	case ok && (!state.Active || state.FromPlaylist) && (state.URL != entry.URL || state.Bundle != entry.Bundle):
+		_, err := StartWebContent(ctx, config, entry, true)
+		return err
+	case !ok && state.Active && state.FromPlaylist:
+		_, err := StopWebContent(ctx)
+		return err
+	}
+	return nil
+}
+
+// webCacheSize returns the bytes used by the browser cache.
+func webCacheSize(config Config) int64 {
+	var size int64
+	_ = filepath.WalkDir(webCacheDir(config), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// ClearWebCache removes the browser profile and cache. A running browser
+// is restarted so it does not keep deleted files open.
+func ClearWebCache(ctx context.Context, config Config) (int64, error) {
+	dir := webCacheDir(config)
+	freed := webCacheSize(config)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return 0, err
+		}
+	}
+	if getWebState().Active {
+		if status, err := getServiceStatus(ctx); err == nil && status.PlaybackServiceStatus {
+			if err := reloadAndRunPlayback(ctx, dbusUnitOperationRestart); err != nil {
+				return freed, err
+			}
+		}
+	}
+	log.Printf("Web content cache cleared, %d bytes freed", freed)
+	return freed, nil
+}
+
+// HandleWebContent starts (POST), reports (GET) or stops (DELETE) web
+// content.
+func HandleWebContent(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: WebContentStatus{
+			WebContentState: getWebState(),
+			CacheBytes:      webCacheSize(GetCurrentConfig()),
+		}})
+	case http.MethodPost:
+		var req WebContentRequest
+		if err := json.NewDecoder(io.LimitReader(r.Body, 8192)).Decode(&req); err != nil || (req.URL == "" && req.Bundle == "") {
+			JSONResponse(w, http.StatusBadRequest, APIResponse{OK: false, ErrMsg: "Укажите поле url или bundle"})
+			return
+		}
+		config := GetCurrentConfig()
+		if !config.Web.Enabled {
+			JSONResponse(w, http.StatusConflict, APIResponse{OK: false, ErrMsg: "Показ веб-содержимого не включен"})
+			return
+		}
+		state, err := StartWebContent(r.Context(), config, req, false)
+		if err != nil {
+			log.Printf("Failed to start web content: %v", err)
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось показать веб-содержимое: %v", err)})
+			return
+		}
+		JSONResponse(w, http.StatusOK, APIResponse{OK: true, Data: state})
+	case http.MethodDelete:
+		if _, err := StopWebContent(r.Context()); err != nil {
+			log.Printf("Failed to stop web content: %v", err)
+			JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось остановить веб-содержимое: %v", err)})
+			return
+		}
+		JSONResponse(w, http.StatusOK, APIResponse{
+			OK: true,
+			Data: MenuActionResponse{
+				Action:  "web-stop",
+				Result:  "success",
+				Message: "Показ веб-содержимого остановлен, воспроизведение восстановлено",
+			},
+		})
+	default:
+		JSONResponse(w, http.StatusMethodNotAllowed, APIResponse{OK: false, ErrMsg: "Метод не разрешён"})
+	}
+}
+
+// HandleWebCache clears the kiosk browser cache (DELETE).
+func HandleWebCache(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodDelete) {
+		return
+	}
+	freed, err := ClearWebCache(r.Context(), GetCurrentConfig())
+	if err != nil {
+		log.Printf("Failed to clear web content cache: %v", err)
+		JSONResponse(w, http.StatusInternalServerError, APIResponse{OK: false, ErrMsg: fmt.Sprintf("Не удалось очистить кэш браузера: %v", err)})
+		return
+	}
+	JSONResponse(w, http.StatusOK, APIResponse{
+		OK: true,
+		Data: MenuActionResponse{
+			Action:  "web-cache-clear",
+			Result:  "success",
+			Message: fmt.Sprintf("Кэш браузера очищен, освобождено %d байт", freed),
+		},
+	})
+}
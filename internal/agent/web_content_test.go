@@ -0,0 +1,289 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func setupWebContentForTest(t *testing.T, active bool) (*playbackDBusConn, Config) {
+	t.Helper()
+	conn := &playbackDBusConn{active: active}
+	SetDBusConnectionFactory(func(ctx context.Context) (DBusConnection, error) { return conn, nil })
+	setSystemdUnitDirForTest(t)
+
+	originalState, originalProbe := webStateFilePath, webProbe
+	webStateFilePath = filepath.Join(t.TempDir(), "web-content.json")
+	webProbe = func(ctx context.Context, rawURL string) error { return nil }
+	t.Cleanup(func() {
+		SetDBusConnectionFactory(nil)
+		webStateFilePath, webProbe = originalState, originalProbe
+		webLock.Lock()
+		stopWebWatchLocked()
+		webState = WebContentState{}
+		webLock.Unlock()
+	})
+
+	mediaDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(mediaDir, "menu"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"menu/index.html": "<html></html>", "offline.mp4": "video"} {
+		if err := os.WriteFile(filepath.Join(mediaDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := Config{
+		Playlist: PlaylistConfig{Destination: mediaDir},
+		Web: WebContentConfig{
+			Enabled:        true,
+			BrowserCommand: "/usr/bin/kiosk --cache {cache_dir}",
+			CacheDir:       t.TempDir(),
+			Fallback:       "offline.mp4",
+		},
+	}
+	setCurrentConfigForTest(t, config)
+	return conn, config
+}
+
+func readWebDropIn(t *testing.T) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(SystemdUnitDir, playbackServiceUnit+".d", webDropInName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWebContentShowsURLAndRestoresPlayback(t *testing.T) {
+	conn, config := setupWebContentForTest(t, true)
+
+	state, err := StartWebContent(t.Context(), config, WebContentRequest{URL: "https://example.com/board"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Active || !state.PlaybackWasActive || state.Offline {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+	want := "ExecStart=\nExecStart=/usr/bin/kiosk --cache " + config.Web.CacheDir + " https://example.com/board\n"
+	if dropIn := readWebDropIn(t); !strings.Contains(dropIn, want) || strings.Contains(dropIn, "CacheDirectory") {
+		t.Fatalf("unexpected drop-in:\n%s", dropIn)
+	}
+	if metricValue(metricWebContentActive) != 1 {
+		t.Fatal("expected web content metric to be set")
+	}
+	var persisted WebContentState
+	if err := readStateFile(webStateFilePath, &persisted); err != nil || persisted.URL != "https://example.com/board" {
+		t.Fatalf("expected persisted web content, got %+v, %v", persisted, err)
+	}
+
+	if _, err := StopWebContent(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(SystemdUnitDir, playbackServiceUnit+".d", webDropInName)); !os.IsNotExist(err) {
+		t.Fatalf("expected drop-in to be removed, got %v", err)
+	}
+	if want := []string{"restart play.video.service", "restart play.video.service"}; !reflect.DeepEqual(conn.operations(), want) {
+		t.Fatalf("operations = %v, want %v", conn.operations(), want)
+	}
+	if getWebState().Active || metricValue(metricWebContentActive) != 0 {
+		t.Fatal("expected web content to be stopped")
+	}
+}
+
+func TestWebContentFallsBackWhileOffline(t *testing.T) {
+	conn, config := setupWebContentForTest(t, true)
+	webProbe = func(ctx context.Context, rawURL string) error { return errors.New("no route to host") }
+
+	state, err := StartWebContent(t.Context(), config, WebContentRequest{URL: "https://example.com/board"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Offline {
+		t.Fatalf("expected offline state, got %+v", state)
+	}
+	want := "ExecStart=" + DefaultPlayerCommand + " " + filepath.Join(config.Playlist.Destination, "offline.mp4") + "\n"
+	if dropIn := readWebDropIn(t); !strings.Contains(dropIn, want) {
+		t.Fatalf("expected fallback drop-in, got:\n%s", dropIn)
+	}
+
+	webProbe = func(ctx context.Context, rawURL string) error { return nil }
+	checkWebContent(t.Context(), config)
+	if getWebState().Offline || metricValue(metricWebContentOffline) != 0 {
+		t.Fatalf("expected web content to be back online, got %+v", getWebState())
+	}
+	if dropIn := readWebDropIn(t); !strings.Contains(dropIn, "https://example.com/board") {
+		t.Fatalf("expected URL drop-in, got:\n%s", dropIn)
+	}
+	if ops := conn.operations(); len(ops) != 2 || ops[1] != "restart play.video.service" {
+		t.Fatalf("expected playback to restart on the URL, got %v", ops)
+	}
+}
+
+func TestWebContentBundleFallback(t *testing.T) {
+	_, config := setupWebContentForTest(t, true)
+	config.Web.Fallback = "menu"
+
+	command, err := webContentCommand(config, WebContentState{URL: "https://example.com", Offline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "file://" + filepath.Join(config.Playlist.Destination, "menu", "index.html"); !strings.HasSuffix(command, want) {
+		t.Fatalf("expected bundle fallback %s, got %s", want, command)
+	}
+}
+
+func TestStartWebContentValidatesRequest(t *testing.T) {
+	_, config := setupWebContentForTest(t, true)
+
+	for name, req := range map[string]WebContentRequest{
+		"empty":          {},
+		"both":           {URL: "https://example.com", Bundle: "menu"},
+		"scheme":         {URL: "ftp://example.com"},
+		"missing bundle": {Bundle: "missing"},
+		"outside":        {Bundle: "../etc"},
+		"not html":       {Bundle: "offline.mp4"},
+	} {
+		if _, err := StartWebContent(t.Context(), config, req, false); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	multi := config
+	multi.Displays = []DisplayOutputConfig{{Output: "HDMI-A-1"}}
+	if _, err := StartWebContent(t.Context(), multi, WebContentRequest{URL: "https://example.com"}, false); err == nil {
+		t.Error("expected multi-display config to be rejected")
+	}
+
+	state, err := StartWebContent(t.Context(), config, WebContentRequest{Bundle: "menu"}, false)
+	if err != nil || state.Bundle != "menu" {
+		t.Fatalf("unexpected state: %+v, %v", state, err)
+	}
+	if dropIn := readWebDropIn(t); !strings.Contains(dropIn, "file://"+filepath.Join(config.Playlist.Destination, "menu", "index.html")) {
+		t.Fatalf("unexpected drop-in:\n%s", dropIn)
+	}
+}
+
+func TestWebDropInCacheDirectory(t *testing.T) {
+	dropIn := webDropIn(Config{}, webBrowserCommand(Config{}))
+	if !strings.Contains(dropIn, "--user-data-dir="+DefaultWebCacheDir) || !strings.Contains(dropIn, "CacheDirectory=media-pi-web\n") {
+		t.Fatalf("unexpected drop-in:\n%s", dropIn)
+	}
+}
+
+func TestPlaylistWebEntryControlsWebContent(t *testing.T) {
+	conn, config := setupWebContentForTest(t, false)
+	playlist := filepath.Join(config.Playlist.Destination, playlistFileName)
+
+	if err := os.WriteFile(playlist, []byte("# lobby\nhttps://example.com/menu\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyPlaylistWebContent(t.Context(), config); err != nil {
+		t.Fatal(err)
+	}
+	state := getWebState()
+	if !state.Active || !state.FromPlaylist || state.URL != "https://example.com/menu" {
+		t.Fatalf("expected playlist web content, got %+v", state)
+	}
+
+	if err := os.WriteFile(playlist, []byte(filepath.Join(config.Playlist.Destination, "menu")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyPlaylistWebContent(t.Context(), config); err != nil {
+		t.Fatal(err)
+	}
+	if state := getWebState(); state.Bundle != "menu" || state.URL != "" {
+		t.Fatalf("expected bundle playlist web content, got %+v", state)
+	}
+
+	if err := os.WriteFile(playlist, []byte("offline.mp4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyPlaylistWebContent(t.Context(), config); err != nil {
+		t.Fatal(err)
+	}
+	if getWebState().Active {
+		t.Fatal("expected a video playlist to end playlist web content")
+	}
+	ops := conn.operations()
+	if ops[len(ops)-1] != "stop play.video.service" {
+		t.Fatalf("expected playback to be stopped as before, got %v", ops)
+	}
+}
+
+func TestPlaylistKeepsAPIWebContent(t *testing.T) {
+	_, config := setupWebContentForTest(t, true)
+	if _, err := StartWebContent(t.Context(), config, WebContentRequest{URL: "https://example.com/notice"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config.Playlist.Destination, playlistFileName), []byte("offline.mp4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyPlaylistWebContent(t.Context(), config); err != nil {
+		t.Fatal(err)
+	}
+	if state := getWebState(); !state.Active || state.URL != "https://example.com/notice" {
+		t.Fatalf("expected API web content to stay, got %+v", state)
+	}
+}
+
+func TestClearWebCache(t *testing.T) {
+	_, config := setupWebContentForTest(t, true)
+	if err := os.MkdirAll(filepath.Join(config.Web.CacheDir, "profile", "Cache"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config.Web.CacheDir, "profile", "Cache", "data_0"), make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	freed, err := ClearWebCache(t.Context(), config)
+	if err != nil || freed != 1000 {
+		t.Fatalf("expected 1000 bytes freed, got %d, %v", freed, err)
+	}
+	if entries, _ := os.ReadDir(config.Web.CacheDir); len(entries) != 0 {
+		t.Fatalf("expected empty cache directory, got %v", entries)
+	}
+}
+
+func TestHandleWebContent(t *testing.T) {
+	_, config := setupWebContentForTest(t, true)
+
+	w := httptest.NewRecorder()
+	HandleWebContent(w, httptest.NewRequest(http.MethodPost, "/api/playback/web", strings.NewReader(`{}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	HandleWebContent(w, httptest.NewRequest(http.MethodPost, "/api/playback/web", strings.NewReader(`{"url":"https://example.com"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"active":true`) {
+		t.Fatalf("expected web content to start, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	HandleWebContent(w, httptest.NewRequest(http.MethodGet, "/api/playback/web", nil))
+	if !strings.Contains(w.Body.String(), `"url":"https://example.com"`) || !strings.Contains(w.Body.String(), `"cacheBytes":0`) {
+		t.Fatalf("unexpected status: %s", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	HandleWebContent(w, httptest.NewRequest(http.MethodDelete, "/api/playback/web", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	config.Web.Enabled = false
+	setCurrentConfigForTest(t, config)
+	w = httptest.NewRecorder()
+	HandleWebContent(w, httptest.NewRequest(http.MethodPost, "/api/playback/web", strings.NewReader(`{"url":"https://example.com"}`)))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 when disabled, got %d", w.Code)
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WireGuardConfig describes an optional WireGuard interface the agent
+// brings up to reach the management network.
+type WireGuardConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Interface is the WireGuard interface name; see
+	// DefaultWireGuardInterface.
+	Interface string `yaml:"interface,omitempty"`
+	// PrivateKey is the base64 key of the device; it is sealed with the
+	// other secrets when encrypt_secrets is set. Without it the key is read
+	// from PrivateKeyFile, or generated there on the first start.
+	PrivateKey     string `yaml:"private_key,omitempty"`
+	PrivateKeyFile string `yaml:"private_key_file,omitempty"`
+	// Address is the tunnel address of the device in CIDR form, e.g.
+	// "10.8.0.12/24".
+	Address    string `yaml:"address,omitempty"`
+	ListenPort int    `yaml:"listen_port,omitempty"`
+	// PeerPublicKey, Endpoint and AllowedIPs describe the concentrator.
+	PeerPublicKey string   `yaml:"peer_public_key,omitempty"`
+	Endpoint      string   `yaml:"endpoint,omitempty"`
+	AllowedIPs    []string `yaml:"allowed_ips,omitempty"`
+	// PersistentKeepalive keeps NAT mappings open; see
+	// DefaultWireGuardKeepalive.
+	PersistentKeepalive time.Duration `yaml:"persistent_keepalive,omitempty"`
+	// Interval is how often the tunnel health is checked.
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// RestrictAPI binds the API listener to the WireGuard interface, as
+	// listen_interface does, unless listen_interface is set explicitly.
+	RestrictAPI bool `yaml:"restrict_api,omitempty"`
+}
+
+// Defaults for the WireGuard interface.
+const (
+	DefaultWireGuardInterface = "wg0"
+	DefaultWireGuardKeyFile   = "/etc/media-pi-agent/wireguard.key"
+	DefaultWireGuardKeepalive = 25 * time.Second
+	DefaultWireGuardInterval  = 30 * time.Second
+	// wireGuardHandshakeTimeout is how old the latest handshake may be
+	// before the tunnel is considered down. WireGuard renews sessions
+	// every two minutes while there is traffic or a keepalive.
+	wireGuardHandshakeTimeout = 3 * time.Minute
+
+	metricWireGuardUp            = "media_pi_wireguard_up"
+	metricWireGuardHandshakeAge  = "media_pi_wireguard_handshake_age_seconds"
+	metricWireGuardProvisionings = "media_pi_wireguard_provisionings_total"
+)
+
+func init() {
+	registerGauge(metricWireGuardUp, "1 while the WireGuard peer has a recent handshake.")
+	registerGauge(metricWireGuardHandshakeAge, "Seconds since the latest WireGuard handshake.")
+	registerCounter(metricWireGuardProvisionings, "Times the WireGuard interface was (re)configured.")
+}
+
+// WireGuardStatus is reported as wireguard in /api/system/status.
+type WireGuardStatus struct {
+	Interface string `json:"interface"`
+	// PublicKey identifies the device to the concentrator.
+	PublicKey string `json:"publicKey,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	// Up is set while the latest handshake is recent.
+	Up              bool    `json:"up"`
+	LatestHandshake string  `json:"latestHandshake,omitempty"`
+	HandshakeAge    float64 `json:"handshakeAgeSeconds,omitempty"`
+	RxBytes         int64   `json:"rxBytes"`
+	TxBytes         int64   `json:"txBytes"`
+	UpdatedAt       string  `json:"updatedAt,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+var (
+	// wireGuardCommand runs ip and wg. Tests may override it.
+	wireGuardCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+		if err != nil {
+			return out, fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		}
+		return out, nil
+	}
+
+	wireGuardLock   sync.Mutex
+	wireGuardCancel context.CancelFunc
+	wireGuardState  *WireGuardStatus
+)
+
+func wireGuardInterface(config WireGuardConfig) string {
+	if iface := strings.TrimSpace(config.Interface); iface != "" {
+		return iface
+	}
+	return DefaultWireGuardInterface
+}
+
+// apiInterface returns the interface the API listener is bound to, if any.
+func apiInterface(config Config) string {
+	if iface := strings.TrimSpace(config.ListenInterface); iface != "" {
+		return iface
+	}
+	if config.WireGuard.Enabled && config.WireGuard.RestrictAPI {
+		return wireGuardInterface(config.WireGuard)
+	}
+	return ""
+}
+
+func validateWireGuardConfig(config WireGuardConfig) error {
+	if config.PeerPublicKey == "" {
+		return errors.New("wireguard.peer_public_key is required")
+	}
+	if _, err := netip.ParsePrefix(config.Address); err != nil {
+		return fmt.Errorf("invalid wireguard.address %q: %w", config.Address, err)
+	}
+	for _, allowed := range config.AllowedIPs {
+		if _, err := netip.ParsePrefix(allowed); err != nil {
+			return fmt.Errorf("invalid wireguard.allowed_ips entry %q: %w", allowed, err)
+		}
+	}
+	return nil
+}
+
+// wireGuardKeyFile makes sure the private key file exists and returns its
+// path: private_key is written there, otherwise an existing file is kept
+// and a missing one is generated with wg genkey.
+func wireGuardKeyFile(ctx context.Context, config WireGuardConfig) (string, error) {
+	path := config.PrivateKeyFile
+	if path == "" {
+		path = DefaultWireGuardKeyFile
+	}
+	key := strings.TrimSpace(config.PrivateKey)
+	if key == "" {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		out, err := wireGuardCommand(ctx, "wg", "genkey")
+		if err != nil {
+			return "", err
+		}
+		key = strings.TrimSpace(string(out))
+		log.Printf("Generated WireGuard private key in %s", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if current, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(current)) == key {
+		return path, nil
+	}
+	if err := writeFileSync(path, []byte(key+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("write WireGuard private key: %w", err)
+	}
+	return path, nil
+}
+
+// provisionWireGuard creates the interface if needed and applies the
+// configuration, the way wg-quick up does.
+func provisionWireGuard(ctx context.Context, config WireGuardConfig) error {
+	if err := validateWireGuardConfig(config); err != nil {
+		return err
+	}
+	iface := wireGuardInterface(config)
+	keyFile, err := wireGuardKeyFile(ctx, config)
+	if err != nil {
+		return err
+	}
+	if _, err := wireGuardCommand(ctx, "ip", "link", "show", "dev", iface); err != nil {
+		if _, err := wireGuardCommand(ctx, "ip", "link", "add", "dev", iface, "type", "wireguard"); err != nil {
+			return err
+		}
+	}
+
+	keepalive := config.PersistentKeepalive
+	if keepalive <= 0 {
+		keepalive = DefaultWireGuardKeepalive
+	}
+	args := []string{"set", iface, "private-key", keyFile}
+	if config.ListenPort > 0 {
+		args = append(args, "listen-port", strconv.Itoa(config.ListenPort))
+	}
+	args = append(args, "peer", config.PeerPublicKey,
+		"persistent-keepalive", strconv.Itoa(int(keepalive.Seconds())),
+		"allowed-ips", strings.Join(config.AllowedIPs, ","))
+	if config.Endpoint != "" {
+		args = append(args, "endpoint", config.Endpoint)
+	}
+	steps := [][]string{
+		append([]string{"wg"}, args...),
+		{"ip", "address", "replace", config.Address, "dev", iface},
+		{"ip", "link", "set", "up", "dev", iface},
+	}
+	for _, allowed := range config.AllowedIPs {
+		// Default routes are left to the administrator, as they would
+		// take over all traffic of the device.
+		if prefix := netip.MustParsePrefix(allowed); prefix.Bits() > 0 {
+			steps = append(steps, []string{"ip", "route", "replace", prefix.Masked().String(), "dev", iface})
+		}
+	}
+	for _, step := range steps {
+		if _, err := wireGuardCommand(ctx, step[0], step[1:]...); err != nil {
+			return err
+		}
+	}
+	metricAdd(metricWireGuardProvisionings, 1)
+	log.Printf("WireGuard interface %s configured with address %s", iface, config.Address)
+	return nil
+}
+
+// parseWireGuardDump fills status from wg show <iface> dump for the peer
+// peer: the first line describes the interface, every other line
+// a peer.
+func parseWireGuardDump(out string, peer string, now time.Time, status *WireGuardStatus) error {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if fields := strings.Split(lines[0], "\t"); len(fields) >= 2 {
+		status.PublicKey = fields[1]
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 8 || fields[0] != peer {
+			continue
+		}
+		if fields[2] != "(none)" {
+			status.Endpoint = fields[2]
+		}
+		status.RxBytes, _ = strconv.ParseInt(fields[5], 10, 64)
+		status.TxBytes, _ = strconv.ParseInt(fields[6], 10, 64)
+		handshake, _ := strconv.ParseInt(fields[4], 10, 64)
+		if handshake > 0 {
+			at := time.Unix(handshake, 0)
+			status.LatestHandshake = at.UTC().Format(time.RFC3339)
+			status.HandshakeAge = now.Sub(at).Seconds()
+			status.Up = now.Sub(at) < wireGuardHandshakeTimeout
+		}
+		return nil
+	}
+	return errors.New("peer is not configured")
+}
+
+// checkWireGuard reads the tunnel state and reprovisions the interface
+// when it is missing or lost its peer, e.g. after it was deleted by hand.
+func checkWireGuard(ctx context.Context, config WireGuardConfig, now time.Time) *WireGuardStatus {
+	iface := wireGuardInterface(config)
+	status := &WireGuardStatus{Interface: iface, UpdatedAt: now.UTC().Format(time.RFC3339)}
+	out, err := wireGuardCommand(ctx, "wg", "show", iface, "dump")
+	if err == nil {
+		err = parseWireGuardDump(string(out), config.PeerPublicKey, now, status)
+	}
+	if err != nil {
+		log.Printf("Warning: WireGuard interface %s is not ready (%v), configuring it", iface, err)
+		if err := provisionWireGuard(ctx, config); err != nil {
+			status.Error = err.Error()
+		}
+	}
+	up := 0.0
+	if status.Up {
+		up = 1
+	}
+	metricSet(metricWireGuardUp, up)
+	metricSet(metricWireGuardHandshakeAge, status.HandshakeAge)
+	return status
+}
+
+// StartWireGuard configures the WireGuard interface and keeps checking its
+// health while wireguard.enabled is set. The first configuration runs
+// before it returns, so the API can be bound to the interface.
+func StartWireGuard() {
+	StopWireGuard()
+	config := GetCurrentConfig().WireGuard
+	if !config.Enabled {
+		return
+	}
+	interval := config.Interval
+	if interval <= 0 {
+		interval = DefaultWireGuardInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	status := &WireGuardStatus{Interface: wireGuardInterface(config)}
+	if err := provisionWireGuard(ctx, config); err != nil {
+		log.Printf("Warning: failed to configure WireGuard: %v", err)
+		status.Error = err.Error()
+	}
+	wireGuardLock.Lock()
+	wireGuardCancel = cancel
+	wireGuardState = status
+	wireGuardLock.Unlock()
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			status := checkWireGuard(ctx, config, time.Now())
+			wireGuardLock.Lock()
+			if ctx.Err() == nil {
+				wireGuardState = status
+			}
+			wireGuardLock.Unlock()
+		}
+	}()
+}
+
+// StopWireGuard stops the health checks. The interface is left up.
+func StopWireGuard() {
+	wireGuardLock.Lock()
+	defer wireGuardLock.Unlock()
+	if wireGuardCancel != nil {
+		wireGuardCancel()
+		wireGuardCancel = nil
+	}
+	wireGuardState = nil
+}
+
+func getWireGuardStatus() *WireGuardStatus {
+	wireGuardLock.Lock()
+	defer wireGuardLock.Unlock()
+	if wireGuardState == nil {
+		return nil
+	}
+	status := *wireGuardState
+	return &status
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeWireGuard records ip and wg invocations and answers wg show dump.
+type fakeWireGuard struct {
+	commands []string
+	linkUp   bool
+	dump     string
+}
+
+func setWireGuardCommandForTest(t *testing.T, fake *fakeWireGuard) {
+	t.Helper()
+	original := wireGuardCommand
+	wireGuardCommand = func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		command := name + " " + strings.Join(args, " ")
+		fake.commands = append(fake.commands, command)
+		switch {
+		case command == "wg genkey":
+			return []byte("generated-key\n"), nil
+		case strings.HasPrefix(command, "ip link show"):
+			if !fake.linkUp {
+				return nil, errors.New("device does not exist")
+			}
+		case strings.HasPrefix(command, "ip link add"):
+			fake.linkUp = true
+		case strings.HasPrefix(command, "wg show"):
+			if !fake.linkUp {
+				return nil, errors.New("no such device")
+			}
+			return []byte(fake.dump), nil
+		}
+		return nil, nil
+	}
+	t.Cleanup(func() { wireGuardCommand = original })
+}
+
+func testWireGuardConfig(t *testing.T) WireGuardConfig {
+	return WireGuardConfig{
+		Enabled:        true,
+		PrivateKeyFile: filepath.Join(t.TempDir(), "wireguard.key"),
+		Address:        "10.8.0.12/24",
+		PeerPublicKey:  "peer-key",
+		Endpoint:       "vpn.example.com:51820",
+		AllowedIPs:     []string{"10.8.0.0/24", "0.0.0.0/0"},
+	}
+}
+
+func TestProvisionWireGuard(t *testing.T) {
+	fake := &fakeWireGuard{}
+	setWireGuardCommandForTest(t, fake)
+	config := testWireGuardConfig(t)
+
+	if err := provisionWireGuard(context.Background(), config); err != nil {
+		t.Fatalf("provisionWireGuard() error = %v", err)
+	}
+	key, err := os.ReadFile(config.PrivateKeyFile)
+	if err != nil || string(key) != "generated-key\n" {
+		t.Fatalf("expected a generated key, got %q, %v", key, err)
+	}
+	if info, _ := os.Stat(config.PrivateKeyFile); info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v", info.Mode().Perm())
+	}
+	got := strings.Join(fake.commands, "\n")
+	for _, want := range []string{
+		"ip link add dev wg0 type wireguard",
+		"wg set wg0 private-key " + config.PrivateKeyFile + " peer peer-key persistent-keepalive 25 allowed-ips 10.8.0.0/24,0.0.0.0/0 endpoint vpn.example.com:51820",
+		"ip address replace 10.8.0.12/24 dev wg0",
+		"ip route replace 10.8.0.0/24 dev wg0",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "0.0.0.0/0 dev") {
+		t.Errorf("default route must not be added:\n%s", got)
+	}
+
+	// A configured key replaces the generated one without wg genkey.
+	fake.commands = nil
+	config.PrivateKey = "configured-key"
+	if err := provisionWireGuard(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := os.ReadFile(config.PrivateKeyFile); string(key) != "configured-key\n" {
+		t.Fatalf("key file = %q", key)
+	}
+	if strings.Contains(strings.Join(fake.commands, "\n"), "genkey") || strings.Contains(strings.Join(fake.commands, "\n"), "link add") {
+		t.Fatalf("unexpected commands %q", fake.commands)
+	}
+
+	if err := provisionWireGuard(context.Background(), WireGuardConfig{Address: "10.8.0.12"}); err == nil {
+		t.Fatal("expected an invalid configuration rejected")
+	}
+}
+
+func TestCheckWireGuard(t *testing.T) {
+	now := time.Unix(1760000000, 0)
+	fake := &fakeWireGuard{linkUp: true, dump: "device-private\tdevice-public\t0\toff\n" +
+		"peer-key\t(none)\t203.0.113.5:51820\t10.8.0.0/24\t1759999940\t1024\t2048\t25\n"}
+	setWireGuardCommandForTest(t, fake)
+	config := testWireGuardConfig(t)
+
+	status := checkWireGuard(context.Background(), config, now)
+	if !status.Up || status.PublicKey != "device-public" || status.Endpoint != "203.0.113.5:51820" ||
+		status.RxBytes != 1024 || status.TxBytes != 2048 || status.HandshakeAge != 60 || status.Error != "" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	status = checkWireGuard(context.Background(), config, now.Add(10*time.Minute))
+	if status.Up {
+		t.Fatalf("expected a stale handshake reported down, got %+v", status)
+	}
+
+	// A deleted interface is configured again.
+	fake.linkUp = false
+	fake.commands = nil
+	checkWireGuard(context.Background(), config, now)
+	if !strings.Contains(strings.Join(fake.commands, "\n"), "ip link add dev wg0 type wireguard") {
+		t.Fatalf("expected the interface recreated, got %q", fake.commands)
+	}
+}
+
+func TestAPIInterface(t *testing.T) {
+	config := Config{WireGuard: WireGuardConfig{Enabled: true, RestrictAPI: true, Interface: "wg1"}}
+	if got := apiInterface(config); got != "wg1" {
+		t.Errorf("apiInterface() = %q, want wg1", got)
+	}
+	config.ListenInterface = "eth0"
+	if got := apiInterface(config); got != "eth0" {
+		t.Errorf("apiInterface() = %q, want listen_interface to win", got)
+	}
+	if got := apiInterface(Config{WireGuard: WireGuardConfig{Enabled: true}}); got != "" {
+		t.Errorf("apiInterface() = %q, want no restriction", got)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+// Package coretest implements a fake media-pi.core DeviceSyncController for
+// end-to-end tests of the agent: the manifest, file downloads, playlists,
+// device authentication and the reports devices post, with injectable
+// faults such as slow responses, error statuses and corrupt bodies.
+package coretest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File is a media file served by the fake core.
+type File struct {
+	ID       int64
+	Filename string
+	Content  []byte
+	// Type is the optional manifest content type (video, image, ...).
+	Type string
+}
+
+// Fault changes the responses of one path.
+type Fault struct {
+	// Delay is waited before the response is written.
+	Delay time.Duration
+	// Status replaces the response with an empty one of this status.
+	Status int
+	// Corrupt flips the first byte of the response body.
+	Corrupt bool
+	// Times limits the fault to that many requests; 0 applies it to all.
+	Times int
+}
+
+// Request is a request the fake core received.
+type Request struct {
+	Method    string
+	Path      string
+	DeviceID  string
+	SessionID string
+	Body      []byte
+}
+
+// Server is a fake core. It only answers requests carrying DeviceKey in
+// X-Device-Id.
+type Server struct {
+	*httptest.Server
+	DeviceKey string
+
+	mu       sync.Mutex
+	files    []File
+	playlist []byte
+	faults   map[string]*Fault
+	requests []Request
+}
+
+// New starts a fake core accepting deviceKey. Close it when done.
+func New(deviceKey string) *Server {
+	s := &Server{DeviceKey: deviceKey, faults: map[string]*Fault{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// SetFiles replaces the manifest.
+func (s *Server) SetFiles(files ...File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files = append([]File(nil), files...)
+}
+
+// SetPlaylist sets the playlist; nil makes the core answer 204.
+func (s *Server) SetPlaylist(playlist []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playlist = playlist
+}
+
+// Inject applies fault to requests for path, e.g. "/api/devicesync" or
+// "/api/devicesync/1". A zero Fault removes it.
+func (s *Server) Inject(path string, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fault == (Fault{}) {
+		delete(s.faults, path)
+		return
+	}
+	s.faults[path] = &fault
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Posted returns the bodies posted to path, e.g.
+// "/api/devicesync/sync-report".
+func (s *Server) Posted(path string) [][]byte {
+	var bodies [][]byte
+	for _, r := range s.Requests() {
+		if r.Method == http.MethodPost && r.Path == path {
+			bodies = append(bodies, r.Body)
+		}
+	}
+	return bodies
+}
+
+// takeFault returns the fault for path and counts its use.
+func (s *Server) takeFault(path string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fault, ok := s.faults[path]
+	if !ok {
+		return nil
+	}
+	applied := *fault
+	if fault.Times > 0 {
+		if fault.Times--; fault.Times == 0 {
+			delete(s.faults, path)
+		}
+	}
+	return &applied
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		DeviceID:  r.Header.Get("X-Device-Id"),
+		SessionID: r.Header.Get("X-Sync-Session-Id"),
+		Body:      body,
+	})
+	s.mu.Unlock()
+
+	if r.Header.Get("X-Device-Id") != s.DeviceKey {
+		http.Error(w, "unknown device", http.StatusUnauthorized)
+		return
+	}
+	if fault := s.takeFault(r.URL.Path); fault != nil {
+		select {
+		case <-time.After(fault.Delay):
+		case <-r.Context().Done():
+			return
+		}
+		if fault.Status != 0 {
+			w.WriteHeader(fault.Status)
+			return
+		}
+		if fault.Corrupt {
+			w = &corruptWriter{ResponseWriter: w}
+		}
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == "/api/devicesync" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		s.serveManifest(w, r)
+	case path == "/api/devicesync/playlist" && r.Method == http.MethodGet:
+		s.servePlaylist(w, r)
+	case strings.HasPrefix(path, "/api/devicesync/") && r.Method == http.MethodGet:
+		s.serveFile(w, strings.TrimPrefix(path, "/api/devicesync/"))
+	case strings.HasPrefix(path, "/api/devicesync/") && r.Method == http.MethodPost:
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type manifestItem struct {
+	ID            int64  `json:"id"`
+	Filename      string `json:"filename"`
+	FileSizeBytes int64  `json:"fileSizeBytes"`
+	SHA256        string `json:"sha256"`
+	Type          string `json:"type,omitempty"`
+}
+
+// serveManifest answers with the manifest, honouring If-None-Match and the
+// limit/cursor paging of the agent.
+func (s *Server) serveManifest(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	items := make([]manifestItem, 0, len(s.files))
+	for _, f := range s.files {
+		sum := sha256.Sum256(f.Content)
+		items = append(items, manifestItem{ID: f.ID, Filename: f.Filename, FileSizeBytes: int64(len(f.Content)), SHA256: hex.EncodeToString(sum[:]), Type: f.Type})
+	}
+	s.mu.Unlock()
+
+	all, _ := json.Marshal(items)
+	sum := sha256.Sum256(all)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+	query := r.URL.Query()
+	if query.Get("cursor") == "" && r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if limit, _ := strconv.Atoi(query.Get("limit")); limit > 0 {
+		start, _ := strconv.Atoi(query.Get("cursor"))
+		start = min(max(start, 0), len(items))
+		end := min(start+limit, len(items))
+		if end < len(items) {
+			w.Header().Set("X-Next-Cursor", strconv.Itoa(end))
+		}
+		items = items[start:end]
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+func (s *Server) servePlaylist(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	playlist := s.playlist
+	s.mu.Unlock()
+	if r.URL.Query().Get("type") != "" || playlist == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	_, _ = w.Write(playlist)
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.files {
+		if strconv.FormatInt(f.ID, 10) == id {
+			w.Header().Set("Content-Length", strconv.Itoa(len(f.Content)))
+			_, _ = w.Write(f.Content)
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("file %s not found", id), http.StatusNotFound)
+}
+
+// corruptWriter flips the first byte written.
+type corruptWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (c *corruptWriter) Write(p []byte) (int, error) {
+	if !c.written && len(p) > 0 {
+		c.written = true
+		p = append([]byte{p[0] ^ 0xff}, p[1:]...)
+	}
+	return c.ResponseWriter.Write(p)
+}
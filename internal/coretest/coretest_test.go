@@ -0,0 +1,71 @@
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+package coretest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func get(t *testing.T, s *Server, path, key string, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, s.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set("X-Device-Id", key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, body
+}
+
+func TestServer(t *testing.T) {
+	s := New("key")
+	defer s.Close()
+	s.SetFiles(File{ID: 1, Filename: "a.mp4", Content: []byte("aaa")}, File{ID: 2, Filename: "b.mp4", Content: []byte("bb")})
+
+	if resp, _ := get(t, s, "/api/devicesync", "other", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unknown device: status %d", resp.StatusCode)
+	}
+
+	resp, body := get(t, s, "/api/devicesync?limit=1", "key", nil)
+	var items []manifestItem
+	if err := json.Unmarshal(body, &items); err != nil || len(items) != 1 || resp.Header.Get("X-Next-Cursor") != "1" {
+		t.Fatalf("first page %s, cursor %q, err %v", body, resp.Header.Get("X-Next-Cursor"), err)
+	}
+	if resp, _ := get(t, s, "/api/devicesync", "key", http.Header{"If-None-Match": {resp.Header.Get("ETag")}}); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("unchanged manifest: status %d", resp.StatusCode)
+	}
+	if _, body := get(t, s, "/api/devicesync/1", "key", nil); string(body) != "aaa" {
+		t.Fatalf("file body %q", body)
+	}
+	if resp, _ := get(t, s, "/api/devicesync/playlist", "key", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("no playlist: status %d", resp.StatusCode)
+	}
+
+	s.Inject("/api/devicesync/1", Fault{Corrupt: true, Times: 1})
+	if _, body := get(t, s, "/api/devicesync/1", "key", nil); string(body) == "aaa" {
+		t.Fatal("the body must be corrupted")
+	}
+	if _, body := get(t, s, "/api/devicesync/1", "key", nil); string(body) != "aaa" {
+		t.Fatalf("the fault must apply once, body %q", body)
+	}
+	s.Inject("/api/devicesync", Fault{Status: http.StatusServiceUnavailable})
+	if resp, _ := get(t, s, "/api/devicesync", "key", nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("injected status: %d", resp.StatusCode)
+	}
+	if got := len(s.Requests()); got != 8 {
+		t.Fatalf("recorded %d requests", got)
+	}
+}
@@ -40,12 +40,16 @@ rm -rf "${WORK}"
 # - /usr/local/bin      -> исполняемый бинарник
 # - /etc/media-pi-agent -> конфигурация (agent.yaml)
 # - /etc/polkit-1/localauthority/50-local.d -> правило polkit (.pkla)
+# - /usr/share/polkit-1/actions -> действия polkit для helper (helper.polkit)
 # - /etc/systemd/system -> systemd service файл
+# - /etc/media-pi-helper -> политика привилегированного helper (только root)
 # - ${WORK}/DEBIAN      -> метаданные пакета (control, conffiles, postinst)
 mkdir -p "${ROOT}/usr/local/bin"
 mkdir -p "${ROOT}/etc/media-pi-agent"
 mkdir -p "${ROOT}/etc/polkit-1/localauthority/50-local.d"
+mkdir -p "${ROOT}/usr/share/polkit-1/actions"
 mkdir -p "${ROOT}/etc/systemd/system"
+mkdir -p "${ROOT}/etc/media-pi-helper"
 mkdir -p "${WORK}/DEBIAN"
 
 # Set proper permissions for DEBIAN directory
@@ -64,16 +68,23 @@ install -m 0644 "${SCRIPT_DIR}/agent.yaml" "${ROOT}/etc/media-pi-agent/agent.yam
 # setup-media-pi.sh --> /usr/local/bin
 install -m 0755 "${SCRIPT_DIR}/../setup/setup-media-pi.sh" "${ROOT}/usr/local/bin/setup-media-pi.sh"
 
+# Действия polkit, которые проверяет привилегированный helper для crontab,
+# unit-файлов и asound.conf
+install -m 0644 "${SCRIPT_DIR}/consulting.sw.media-pi.policy" "${ROOT}/usr/share/polkit-1/actions/consulting.sw.media-pi.policy"
+
 # systemd service file --> /etc/systemd/system
 install -m 0644 "${SCRIPT_DIR}/media-pi-agent.service" "${ROOT}/etc/systemd/system/media-pi-agent.service"
 
 # Создаём правило polkit в формате .pkla для polkit 0.105 (Raspberry Pi OS Bullseye).
 # Этот формат не поддерживает фильтрацию по имени unit'а, поэтому предоставляет
 # доступ ко всем операциям manage-units/manage-unit-files для группы media-pi.
+# Перезагрузка systemd, reboot/power-off, crontab, unit-файлы и asound.conf
+# нужны агенту без root,
+# когда привилегированный helper проверяет запросы через polkit (helper.polkit).
 cat > "${ROOT}/etc/polkit-1/localauthority/50-local.d/media-pi-agent.pkla" <<EOF
 [Media Pi Agent]
 Identity=unix-group:media-pi
-Action=org.freedesktop.systemd1.manage-units;org.freedesktop.systemd1.manage-unit-files
+Action=org.freedesktop.systemd1.manage-units;org.freedesktop.systemd1.manage-unit-files;org.freedesktop.systemd1.reload-daemon;org.freedesktop.login1.reboot;org.freedesktop.login1.power-off;consulting.sw.media-pi.manage-crontab;consulting.sw.media-pi.manage-system-files
 ResultAny=yes
 ResultInactive=yes
 ResultActive=yes
@@ -211,7 +222,8 @@ grant_media_pi_group_access() {
         /etc/media-pi-agent \
         /opt/media-pi \
         /opt/media-pi-agent \
-        /var/media-pi
+        /var/media-pi \
+        /var/lib/media-pi-agent
     do
         if [ -e "$path" ]; then
             chgrp -R media-pi "$path" 2>/dev/null || true
@@ -229,6 +241,11 @@ grant_media_pi_group_access() {
             chmod g+r,g-w "$path" 2>/dev/null || true
         fi
     done
+    # The helper refuses a policy that anyone but root can change.
+    if [ -d /etc/media-pi-helper ]; then
+        chown -R root:root /etc/media-pi-helper 2>/dev/null || true
+        chmod -R go-w /etc/media-pi-helper 2>/dev/null || true
+    fi
 }
 
 ensure_media_pi_group
@@ -254,10 +271,11 @@ if [ ! -d "$MEDIA_DIR" ]; then
     mkdir -p "$MEDIA_DIR"
 fi
 
-# Ensure sync status directory exists
-SYNC_STATUS_DIR="${MEDIA_DIR}/sync"
-if [ ! -d "$SYNC_STATUS_DIR" ]; then
-    mkdir -p "$SYNC_STATUS_DIR"
+# Ensure the agent state directory exists; it is kept out of the media
+# directory so sync garbage collection never touches it
+STATE_DIR="/var/lib/media-pi-agent"
+if [ ! -d "$STATE_DIR" ]; then
+    mkdir -p "$STATE_DIR"
 fi
 
 grant_media_pi_group_access
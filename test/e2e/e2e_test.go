@@ -0,0 +1,247 @@
+//go:build integration
+
+// Copyright (C) 2025-2026 sw.consulting
+// This file is a part of Media Pi device agent
+
+// Package e2e drives the real agent binary, in simulation mode, against the
+// fake core of internal/coretest.
+package e2e
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sw-consulting/media-pi.device/internal/coretest"
+)
+
+const deviceKey = "e2e-device-key"
+
+// agentBinary is built once by TestMain.
+var agentBinary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "media-pi-e2e-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	agentBinary = filepath.Join(dir, "media-pi-agent")
+	build := exec.Command("go", "build", "-o", agentBinary, "./cmd/media-pi")
+	build.Dir = filepath.Join("..", "..")
+	if out, err := build.CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "build failed: %v\n%s", err, out)
+		os.Exit(1)
+	}
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// agent is a running agent process.
+type agent struct {
+	url      string
+	mediaDir string
+}
+
+// startAgent runs the agent against core with a state root in a temp dir.
+func startAgent(t *testing.T, core *coretest.Server, key string) *agent {
+	t.Helper()
+	root := t.TempDir()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listen := ln.Addr().String()
+	_ = ln.Close()
+
+	a := &agent{url: "http://" + listen, mediaDir: filepath.Join(root, "media")}
+	configPath := filepath.Join(root, "agent.yaml")
+	config := fmt.Sprintf("server_key: %q\nlisten_addr: %q\ncore_api_base: %q\nallowed_units: [play.video.service]\nplaylist:\n  destination: %q\n", key, listen, core.URL, a.mediaDir)
+	if err := os.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(agentBinary, "--simulate")
+	cmd.Env = append(os.Environ(),
+		"MEDIA_PI_AGENT_CONFIG="+configPath,
+		"MEDIA_PI_AGENT_ROOT="+root,
+		"MEDIA_PI_AGENT_CONTAINER=1",
+	)
+	output, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.Stdout = cmd.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		scanner := bufio.NewScanner(output)
+		for scanner.Scan() {
+			t.Logf("agent: %s", scanner.Text())
+		}
+	}()
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		<-logged
+		_ = cmd.Wait()
+	})
+
+	eventually(t, 10*time.Second, func() bool {
+		resp, err := http.Get(a.url + "/health/live")
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	})
+	return a
+}
+
+// call sends an authenticated request and decodes data of the response.
+func (a *agent) call(t *testing.T, method, path string, body, data any) int {
+	t.Helper()
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, a.url+path, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+deviceKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if data != nil {
+		envelope := struct {
+			Data any `json:"data"`
+		}{Data: data}
+		_ = json.NewDecoder(resp.Body).Decode(&envelope)
+	}
+	return resp.StatusCode
+}
+
+// syncReport is the part of the agent's sync report the tests check.
+type syncReport struct {
+	SessionID string `json:"sessionId"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error"`
+	Added     []struct {
+		ID int64 `json:"id"`
+	} `json:"added"`
+	Failed []struct {
+		ID int64 `json:"id"`
+	} `json:"failed"`
+}
+
+// syncNow starts a video sync and waits for a report of a new session.
+func (a *agent) syncNow(t *testing.T, previous string) syncReport {
+	t.Helper()
+	if status := a.call(t, http.MethodPost, "/api/menu/video/start-upload", nil, nil); status != http.StatusOK {
+		t.Fatalf("start-upload: status %d", status)
+	}
+	var report syncReport
+	eventually(t, 20*time.Second, func() bool {
+		report = syncReport{}
+		return a.call(t, http.MethodGet, "/api/sync/report", nil, &report) == http.StatusOK &&
+			report.SessionID != "" && report.SessionID != previous
+	})
+	return report
+}
+
+func eventually(t *testing.T, timeout time.Duration, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within %s", timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestSyncDownloadsManifest(t *testing.T) {
+	core := coretest.New(deviceKey)
+	defer core.Close()
+	core.SetFiles(
+		coretest.File{ID: 1, Filename: "intro.mp4", Content: []byte("intro video")},
+		coretest.File{ID: 2, Filename: "promo.mp4", Content: []byte("promo video")},
+	)
+	a := startAgent(t, core, deviceKey)
+
+	report := a.syncNow(t, "")
+	if !report.OK || len(report.Added) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	for name, content := range map[string]string{"intro.mp4": "intro video", "promo.mp4": "promo video"} {
+		if data, err := os.ReadFile(filepath.Join(a.mediaDir, name)); err != nil || string(data) != content {
+			t.Fatalf("%s: %q, %v", name, data, err)
+		}
+	}
+	eventually(t, 5*time.Second, func() bool { return len(core.Posted("/api/devicesync/sync-report")) > 0 })
+	for _, r := range core.Requests() {
+		if r.DeviceID != deviceKey {
+			t.Fatalf("%s %s without the device key", r.Method, r.Path)
+		}
+		if r.Path == "/api/devicesync/1" && r.SessionID != report.SessionID {
+			t.Fatalf("download session %q, report session %q", r.SessionID, report.SessionID)
+		}
+	}
+}
+
+func TestSyncRecoversFromCorruptDownload(t *testing.T) {
+	core := coretest.New(deviceKey)
+	defer core.Close()
+	core.SetFiles(coretest.File{ID: 7, Filename: "clip.mp4", Content: []byte("clip content")})
+	core.Inject("/api/devicesync/7", coretest.Fault{Corrupt: true, Delay: 200 * time.Millisecond})
+	a := startAgent(t, core, deviceKey)
+
+	report := a.syncNow(t, "")
+	if report.OK || len(report.Failed) != 1 || report.Failed[0].ID != 7 {
+		t.Fatalf("a corrupt download must fail the sync: %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(a.mediaDir, "clip.mp4")); !os.IsNotExist(err) {
+		t.Fatalf("a corrupt file must not be stored: %v", err)
+	}
+
+	core.Inject("/api/devicesync/7", coretest.Fault{})
+	if report = a.syncNow(t, report.SessionID); !report.OK {
+		t.Fatalf("sync after the fault: %+v", report)
+	}
+	if data, _ := os.ReadFile(filepath.Join(a.mediaDir, "clip.mp4")); string(data) != "clip content" {
+		t.Fatalf("clip.mp4 = %q", data)
+	}
+}
+
+func TestSyncFailsForUnknownDevice(t *testing.T) {
+	core := coretest.New("another-device")
+	defer core.Close()
+	core.SetFiles(coretest.File{ID: 1, Filename: "intro.mp4", Content: []byte("intro video")})
+	a := startAgent(t, core, deviceKey)
+
+	if report := a.syncNow(t, ""); report.OK || report.Error == "" {
+		t.Fatalf("a rejected device must fail the sync: %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(a.mediaDir, "intro.mp4")); !os.IsNotExist(err) {
+		t.Fatalf("nothing must be downloaded: %v", err)
+	}
+}